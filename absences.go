@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Absence is a team member's vacation or other time off, inclusive dates
+type Absence struct {
+	Person string `json:"person"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Type   string `json:"type,omitempty"` // vacation, sick, training, ...
+	Note   string `json:"note,omitempty"`
+}
+
+// AbsencesData is absences.json
+type AbsencesData struct {
+	Absences []Absence `json:"absences"`
+}
+
+// covers reports whether the absence includes the given ISO date
+func (a Absence) covers(date string) bool {
+	return a.From <= date && date <= a.To
+}
+
+// loadAbsences reads absences.json
+func loadAbsences() (AbsencesData, error) {
+	var absences AbsencesData
+	err := readDataFile("absences.json", &absences)
+	return absences, err
+}
+
+// absencesOn returns the absences of a person covering a date
+func (d AbsencesData) absencesOn(person, date string) []Absence {
+	var result []Absence
+	for _, a := range d.Absences {
+		if a.Person == person && a.covers(date) {
+			result = append(result, a)
+		}
+	}
+	return result
+}
+
+// validateAbsences checks absences.json: well-formed ranges and no
+// overlapping absences for the same person
+func validateAbsences(data interface{}) error {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("absences.json must be an object")
+	}
+	if _, ok := m["absences"]; !ok {
+		return fmt.Errorf("missing absences array")
+	}
+	var doc AbsencesData
+	if err := decodeInto(data, &doc); err != nil {
+		return fmt.Errorf("absences must be an array of absence objects")
+	}
+
+	byPerson := map[string][]Absence{}
+	for i, a := range doc.Absences {
+		if a.Person == "" {
+			return fmt.Errorf("absence %d: missing person", i)
+		}
+		from, err1 := time.Parse(dateLayout, a.From)
+		to, err2 := time.Parse(dateLayout, a.To)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("absence %d: from/to must be dates (YYYY-MM-DD)", i)
+		}
+		if to.Before(from) {
+			return fmt.Errorf("absence %d: 'to' is before 'from'", i)
+		}
+		byPerson[a.Person] = append(byPerson[a.Person], a)
+	}
+	for person, list := range byPerson {
+		sort.Slice(list, func(i, j int) bool { return list[i].From < list[j].From })
+		for i := 1; i < len(list); i++ {
+			if list[i].From <= list[i-1].To {
+				return fmt.Errorf("absences of %s overlap: %s..%s and %s..%s", person, list[i-1].From, list[i-1].To, list[i].From, list[i].To)
+			}
+		}
+	}
+	return nil
+}
+
+// Handle absences: GET with optional person/from/to filters, POST replaces
+// the document with backups like the other data files
+func handleAbsences(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Join(dataDir, "absences.json")
+
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Get("person") == "" && q.Get("from") == "" && q.Get("to") == "" {
+			serveJSONFile(w, filePath)
+			return
+		}
+
+		absences, err := loadAbsences()
+		if err != nil {
+			http.Error(w, "Error reading absences", http.StatusInternalServerError)
+			return
+		}
+		result := AbsencesData{Absences: []Absence{}}
+		for _, a := range absences.Absences {
+			if p := q.Get("person"); p != "" && a.Person != p {
+				continue
+			}
+			if from := q.Get("from"); from != "" && a.To < from {
+				continue
+			}
+			if to := q.Get("to"); to != "" && a.From > to {
+				continue
+			}
+			result.Absences = append(result.Absences, a)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+	case http.MethodPost:
+		updateJSONFileWithBackup(w, r, filePath, maxBackupsFromRequest(r))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// absenceOverlap is an absence together with the releases scheduled during it
+type absenceOverlap struct {
+	Absence
+	Releases []string `json:"releases"`
+}
+
+// Handle overlap report: absences that coincide with scheduled releases
+func handleAbsenceOverlaps(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	absences, err := loadAbsences()
+	if err != nil {
+		http.Error(w, "Error reading absences", http.StatusInternalServerError)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	from := r.URL.Query().Get("from")
+	if from == "" {
+		from = today().Format(dateLayout)
+	}
+	env := r.URL.Query().Get("env")
+
+	result := []absenceOverlap{}
+	for _, a := range absences.Absences {
+		if a.To < from {
+			continue
+		}
+		overlap := absenceOverlap{Absence: a, Releases: []string{}}
+		for name, entries := range releases {
+			if env != "" && name != env {
+				continue
+			}
+			for _, e := range entries {
+				if a.covers(e.Date) {
+					overlap.Releases = append(overlap.Releases, releaseID(name, e.Date))
+				}
+			}
+		}
+		if len(overlap.Releases) > 0 {
+			sort.Strings(overlap.Releases)
+			result = append(result, overlap)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
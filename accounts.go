@@ -0,0 +1,907 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserAccount is a local account of users.json. The file is maintained by
+// the server only, through the /api/users endpoints, as it holds password
+// hashes.
+type UserAccount struct {
+	Username     string `json:"username"`
+	DisplayName  string `json:"displayName,omitempty"`
+	PasswordHash string `json:"passwordHash"`    // bcrypt
+	Admin        bool   `json:"admin,omitempty"` // whether role is admin, see setRole
+	Role         string `json:"role,omitempty"`  // see roleRanks
+	Disabled     bool   `json:"disabled,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	// Source is where the account comes from, "saml" for users provisioned
+	// at their first single sign-on, empty for local ones
+	Source string `json:"source,omitempty"`
+}
+
+// usersFile is users.json
+type usersFile struct {
+	Users []UserAccount `json:"users"`
+}
+
+// userInfo is an account as the API shows it, without its hash
+type userInfo struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName,omitempty"`
+	Admin       bool   `json:"admin,omitempty"`
+	Role        string `json:"role"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	Source      string `json:"source,omitempty"`
+}
+
+// info returns the account without its password hash
+func (u UserAccount) info() userInfo {
+	return userInfo{Username: u.Username, DisplayName: u.DisplayName, Admin: u.role() == "admin", Role: u.role(), Disabled: u.Disabled,
+		CreatedAt: u.CreatedAt, Source: u.Source}
+}
+
+// Usernames are short identifiers, as permissions.json and the team roster
+// refer to them
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// minPasswordLength is the shortest password accepted; bcrypt reads at
+// most 72 bytes of it
+const minPasswordLength = 8
+
+// sessionCookie is the cookie holding a login session, valid for sessionTTL
+const (
+	sessionCookie = "relplanner_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+// A session's writes must send its CSRF token, which the frontend reads from
+// csrfCookie, in csrfHeader: other sites' pages can make the browser send
+// the session cookie but can't read the token
+const (
+	csrfCookie = "relplanner_csrf"
+	csrfHeader = "X-CSRF-Token"
+)
+
+// accounts is the user store, read from users.json and kept in memory until
+// the file changes, e.g. saved by another instance
+var accounts struct {
+	sync.Mutex
+	loaded bool
+	stamp  fileStamp // of users.json when read
+	users  []UserAccount
+	// setupToken is required to create the first admin, see handleSetup
+	setupToken string
+}
+
+// session is a logged in user
+type session struct {
+	username string
+	csrf     string
+	expires  time.Time
+}
+
+// sessions are the login sessions by token; they don't survive a restart.
+// Instances sharing the data directory behind a cluster lock keep them in
+// sessionDir instead.
+var sessions = struct {
+	sync.Mutex
+	byToken map[string]session
+}{byToken: map[string]session{}}
+
+// sessionDir holds the sessions of instances sharing the data directory, a
+// file per session named by the hash of its token, so any instance takes
+// the session's requests and a logout ends it everywhere
+func sessionDir() string {
+	return filepath.Join(dataDir, "sessions")
+}
+
+// sessionRecord is a session's file of sessionDir
+type sessionRecord struct {
+	Username string    `json:"username"`
+	CSRF     string    `json:"csrf"`
+	Expires  time.Time `json:"expires"`
+}
+
+// readSession reads a session's file, false when it has none
+func readSession(path string) (session, bool) {
+	var rec sessionRecord
+	b, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(b, &rec) != nil {
+		return session{}, false
+	}
+	return session{username: rec.Username, csrf: rec.CSRF, expires: rec.Expires}, true
+}
+
+// lookupSession returns the session of a token
+func lookupSession(token string) (session, bool) {
+	if clusterConfig != nil {
+		return readSession(filepath.Join(sessionDir(), hashAPIKey(token)+".json"))
+	}
+	sessions.Lock()
+	defer sessions.Unlock()
+	s, ok := sessions.byToken[token]
+	return s, ok
+}
+
+// storeSession keeps a new session, ending the expired ones
+func storeSession(token string, s session) error {
+	dropSessions(func(other session) bool { return time.Now().After(other.expires) })
+	if clusterConfig == nil {
+		sessions.Lock()
+		sessions.byToken[token] = s
+		sessions.Unlock()
+		return nil
+	}
+	if err := os.MkdirAll(sessionDir(), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(sessionRecord{Username: s.username, CSRF: s.csrf, Expires: s.expires})
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Join(sessionDir(), hashAPIKey(token)+".json"), b, 0600)
+}
+
+// endSession ends the session of a token
+func endSession(token string) {
+	if clusterConfig != nil {
+		os.Remove(filepath.Join(sessionDir(), hashAPIKey(token)+".json"))
+		return
+	}
+	sessions.Lock()
+	delete(sessions.byToken, token)
+	sessions.Unlock()
+}
+
+// dropSessions ends the sessions matching; unreadable session files go too
+func dropSessions(match func(s session) bool) {
+	if clusterConfig != nil {
+		paths, _ := filepath.Glob(filepath.Join(sessionDir(), "*.json"))
+		for _, path := range paths {
+			if s, ok := readSession(path); !ok || match(s) {
+				os.Remove(path)
+			}
+		}
+		return
+	}
+	sessions.Lock()
+	defer sessions.Unlock()
+	for t, s := range sessions.byToken {
+		if match(s) {
+			delete(sessions.byToken, t)
+		}
+	}
+}
+
+// dummyHash is compared against when logging in as an unknown user, so
+// that takes as long as a wrong password
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("relplanner"), bcrypt.DefaultCost)
+
+// loadAccountsLocked reads users.json the first time and again once it
+// changed; accounts must be locked
+func loadAccountsLocked() error {
+	stamp := statFile(filepath.Join(dataDir, "users.json"))
+	if accounts.loaded && stamp.equal(accounts.stamp) {
+		return nil
+	}
+	var data usersFile
+	if err := readDataFile("users.json", &data); err != nil {
+		return err
+	}
+	accounts.users, accounts.loaded, accounts.stamp = data.Users, true, stamp
+	return nil
+}
+
+// lockAccounts takes the write lock shared with other instances, then
+// accounts, and rereads users.json if another instance changed it, for a
+// change of the accounts; the returned func unlocks both
+func lockAccounts(ctx context.Context) (func(), error) {
+	release, err := clusterLock(ctx)
+	if err != nil {
+		return nil, &saveError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("Try again, %v", err)}
+	}
+	accounts.Lock()
+	if err := loadAccountsLocked(); err != nil {
+		accounts.Unlock()
+		release()
+		return nil, err
+	}
+	return func() {
+		accounts.Unlock()
+		release()
+	}, nil
+}
+
+// saveAccountsLocked writes users.json, readable by the server only, and
+// audits the change of an account by a user; accounts must be locked with
+// lockAccounts
+func saveAccountsLocked(by, action, username string) error {
+	data, err := json.MarshalIndent(usersFile{Users: accounts.users}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, "users.json")
+	before, _ := os.ReadFile(path)
+	if err := replaceFile(path, data, 0600); err != nil {
+		return err
+	}
+	accounts.stamp = statFile(path)
+	auditWrite(by, action, "users.json", username, before, data)
+	return nil
+}
+
+// findAccountLocked returns the index of an account, -1 if there is none;
+// accounts must be locked
+func findAccountLocked(username string) int {
+	for i, u := range accounts.users {
+		if strings.EqualFold(u.Username, username) {
+			return i
+		}
+	}
+	return -1
+}
+
+// accountsEnabled reports whether any local account exists or users log in
+// with SAML. Until then, writes stay open as before and the user is the one
+// authenticated by a reverse proxy, if any.
+func accountsEnabled() bool {
+	if samlConfigured() {
+		return true
+	}
+	accounts.Lock()
+	defer accounts.Unlock()
+	if err := loadAccountsLocked(); err != nil {
+		// An unreadable user store must not open the server up
+		logAuth.Error("Error reading users.json", "err", err)
+		return true
+	}
+	return len(accounts.users) > 0
+}
+
+// account returns an enabled account by username
+func account(username string) (UserAccount, bool) {
+	accounts.Lock()
+	defer accounts.Unlock()
+	if err := loadAccountsLocked(); err != nil {
+		return UserAccount{}, false
+	}
+	if i := findAccountLocked(username); i >= 0 && !accounts.users[i].Disabled {
+		return accounts.users[i], true
+	}
+	return UserAccount{}, false
+}
+
+// hashPassword checks a new password and hashes it
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	if len(password) > 72 {
+		return "", fmt.Errorf("password must be at most 72 bytes")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// newToken returns a random hex token of n bytes
+func newToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSession logs a user in, setting the session cookie
+func startSession(w http.ResponseWriter, r *http.Request, username string) error {
+	token, csrf := newToken(32), newToken(16)
+	expires := time.Now().Add(sessionTTL)
+	if err := storeSession(token, session{username: username, csrf: csrf, expires: expires}); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: token, Path: "/", Expires: expires,
+		HttpOnly: true, Secure: requestIsHTTPS(r), SameSite: http.SameSiteLaxMode})
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: csrf, Path: "/", Expires: expires,
+		Secure: requestIsHTTPS(r), SameSite: http.SameSiteStrictMode})
+	return nil
+}
+
+// validCSRF reports whether a request sends the CSRF token of its session
+func validCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	s, ok := lookupSession(cookie.Value)
+	return ok && subtle.ConstantTimeCompare([]byte(r.Header.Get(csrfHeader)), []byte(s.csrf)) == 1
+}
+
+// endSessions logs a user out everywhere, e.g. once disabled
+func endSessions(username string) {
+	dropSessions(func(s session) bool { return strings.EqualFold(s.username, username) })
+}
+
+// requestIsHTTPS reports whether the client connected over TLS, directly or
+// through a trusted proxy
+func requestIsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || fromTrustedProxy(r) && strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// sessionUser returns the user logged in with the request's session cookie
+func sessionUser(r *http.Request) (UserAccount, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return UserAccount{}, false
+	}
+	s, ok := lookupSession(cookie.Value)
+	if !ok || time.Now().After(s.expires) {
+		return UserAccount{}, false
+	}
+	return account(s.username)
+}
+
+// authExemptPaths take writes without a session, authenticating them their
+// own way: a token, a signature or a password
+var authExemptPaths = map[string]bool{
+	"/api/login":                       true,
+	"/api/logout":                      true,
+	"/api/setup":                       true,
+	"/api/saml/acs":                    true,
+	"/api/jira/webhook":                true,
+	"/api/inbound/releases":            true,
+	"/api/integrations/slack/command":  true,
+	"/api/integrations/github/webhook": true,
+}
+
+// requireLogin rejects writes to the API without a login session once local
+// accounts exist, writes with a session but without its CSRF token, and
+// requests with an API key that is invalid or not scoped for writes
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write := writeRequest(r)
+		if _, bearer := bearerAPIKey(r); bearer && strings.HasPrefix(r.URL.Path, "/api/") && !authExemptPaths[r.URL.Path] {
+			key, ok := requestAPIKey(r)
+			switch {
+			case !ok:
+				w.Header().Set("WWW-Authenticate", `Bearer realm="relplanner"`)
+				http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+				return
+			case write && !key.allows("write"):
+				http.Error(w, "Read-only API key", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if write && strings.HasPrefix(r.URL.Path, "/api/") && !authExemptPaths[r.URL.Path] {
+			_, loggedIn := sessionUser(r)
+			if !loggedIn && accountsEnabled() {
+				http.Error(w, "Login required", http.StatusUnauthorized)
+				return
+			}
+			if loggedIn && !validCSRF(r) {
+				http.Error(w, "Missing or invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// initAccounts prepares the first admin's setup when there are no accounts
+func initAccounts() {
+	accounts.Lock()
+	defer accounts.Unlock()
+	if err := loadAccountsLocked(); err != nil {
+		logAuth.Error("Error reading users.json", "err", err)
+		return
+	}
+	if len(accounts.users) == 0 {
+		accounts.setupToken = newToken(16)
+		logAuth.Warn("No user accounts yet, anyone can make changes. Create the first admin with POST /api/setup and the setup token", "setupToken", accounts.setupToken)
+	}
+}
+
+// credentials is the body of POST /api/login and /api/setup
+type credentials struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	DisplayName string `json:"displayName,omitempty"` // setup only
+	SetupToken  string `json:"setupToken,omitempty"`  // setup only
+}
+
+// Handle logging in with a local account
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req credentials
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if wait := loginLockedOut(r, req.Username); wait > 0 {
+		writeLockedOut(w, wait)
+		return
+	}
+	user, ok := account(req.Username)
+	hash := dummyHash
+	if ok {
+		hash = []byte(user.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(req.Password)) != nil || !ok {
+		logAuth.WarnContext(r.Context(), "Failed login", "user", req.Username, "remote", clientIP(r))
+		loginFailed(r, req.Username)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	loginSucceeded(r, req.Username)
+	if err := startSession(w, r, user.Username); err != nil {
+		http.Error(w, fmt.Sprintf("Error starting the session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	logAuth.InfoContext(r.Context(), "Logged in", "user", user.Username, "remote", clientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user.info())
+}
+
+// Handle logging out of the current session
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		endSession(cookie.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: "", Path: "/", MaxAge: -1,
+		HttpOnly: true, Secure: requestIsHTTPS(r), SameSite: http.SameSiteLaxMode})
+	http.SetCookie(w, &http.Cookie{Name: csrfCookie, Value: "", Path: "/", MaxAge: -1,
+		Secure: requestIsHTTPS(r), SameSite: http.SameSiteStrictMode})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handle creating the first admin account: GET tells whether it is still
+// needed, POST creates it with the setup token logged at startup and logs
+// the admin in
+func handleSetup(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]bool{"required": !accountsEnabled()})
+
+	case http.MethodPost:
+		var req credentials
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		unlock, err := lockAccounts(r.Context())
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		defer unlock()
+		if len(accounts.users) > 0 || accounts.setupToken == "" {
+			http.Error(w, "Setup is already done", http.StatusConflict)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.SetupToken), []byte(accounts.setupToken)) != 1 {
+			http.Error(w, "Invalid setup token, see the server log", http.StatusForbidden)
+			return
+		}
+		user, err := newAccount(req.Username, req.DisplayName, req.Password, "admin")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		accounts.users = append(accounts.users, user)
+		if err := saveAccountsLocked(user.Username, auditCreate, user.Username); err != nil {
+			accounts.users = nil
+			http.Error(w, fmt.Sprintf("Error saving users: %v", err), http.StatusInternalServerError)
+			return
+		}
+		accounts.setupToken = ""
+		logAuth.InfoContext(r.Context(), "Created the first admin", "user", user.Username)
+		if err := startSession(w, r, user.Username); err != nil {
+			http.Error(w, fmt.Sprintf("Error starting the session: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(user.info())
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// newAccount checks and creates an account
+func newAccount(username, displayName, password, role string) (UserAccount, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return UserAccount{}, fmt.Errorf("invalid username %q", username)
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return UserAccount{}, err
+	}
+	if !validRole(role) {
+		return UserAccount{}, fmt.Errorf("invalid role %q", role)
+	}
+	user := UserAccount{Username: username, DisplayName: strings.TrimSpace(displayName), PasswordHash: hash,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	user.setRole(role)
+	return user, nil
+}
+
+// provisionAccount creates or updates the account of a user authenticated
+// elsewhere, e.g. by SAML, with the display name and role given there.
+// It has no password, and a local account of the same name is not taken over.
+func provisionAccount(ctx context.Context, username, displayName, role, source string) (UserAccount, error) {
+	username = strings.TrimSpace(username)
+	if !usernamePattern.MatchString(username) {
+		return UserAccount{}, fmt.Errorf("invalid username %q", username)
+	}
+	unlock, err := lockAccounts(ctx)
+	if err != nil {
+		return UserAccount{}, err
+	}
+	defer unlock()
+	user := UserAccount{Username: username, Source: source, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	i := findAccountLocked(username)
+	if i >= 0 {
+		user = accounts.users[i]
+	}
+	switch {
+	case user.Source != source:
+		return UserAccount{}, fmt.Errorf("a local account %s already exists", user.Username)
+	case user.Disabled:
+		return UserAccount{}, fmt.Errorf("account %s is disabled", user.Username)
+	}
+	if displayName = strings.TrimSpace(displayName); displayName != "" {
+		user.DisplayName = displayName
+	}
+	user.setRole(role)
+	previous := accounts.users
+	accounts.users = append([]UserAccount{}, accounts.users...)
+	action := auditUpdate
+	if i >= 0 {
+		accounts.users[i] = user
+	} else {
+		accounts.users = append(accounts.users, user)
+		action = auditCreate
+	}
+	if err := saveAccountsLocked(source, action, user.Username); err != nil {
+		accounts.users = previous
+		return UserAccount{}, err
+	}
+	accounts.setupToken = ""
+	return user, nil
+}
+
+// meResponse is the response of GET /api/me
+type meResponse struct {
+	User          *userInfo `json:"user"` // null when not logged in
+	Accounts      bool      `json:"accounts"`
+	SetupRequired bool      `json:"setupRequired"`
+	SAML          bool      `json:"saml"` // log in at /api/saml/login
+}
+
+// Handle who the current user is, and whether logging in is needed
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := meResponse{Accounts: accountsEnabled(), SAML: samlConfigured()}
+	resp.SetupRequired = !resp.Accounts
+	if user, ok := sessionUser(r); ok {
+		info := user.info()
+		resp.User = &info
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// passwordChange is the body of PUT /api/me/password
+type passwordChange struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// Handle changing the current user's password; other sessions are logged out
+func handleMyPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+	var req passwordChange
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)) != nil {
+		http.Error(w, "Current password is wrong", http.StatusForbidden)
+		return
+	}
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = updateAccount(r.Context(), user.Username, user.Username, func(u *UserAccount) error {
+		u.PasswordHash = hash
+		return nil
+	})
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	endSessions(user.Username)
+	if err := startSession(w, r, user.Username); err != nil {
+		http.Error(w, fmt.Sprintf("Error starting the session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateAccount changes an account for a user and saves users.json; an admin
+// can't be demoted or disabled when none would be left
+func updateAccount(ctx context.Context, username, by string, change func(u *UserAccount) error) error {
+	unlock, err := lockAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	i := findAccountLocked(username)
+	if i < 0 {
+		return &saveError{status: http.StatusNotFound, msg: "User not found"}
+	}
+	updated := accounts.users[i]
+	if err := change(&updated); err != nil {
+		return err
+	}
+	if !activeAdminsExcept(i) && (updated.role() != "admin" || updated.Disabled) {
+		return &saveError{status: http.StatusConflict, msg: "The last admin can't be demoted or disabled"}
+	}
+	previous := accounts.users[i]
+	accounts.users[i] = updated
+	if err := saveAccountsLocked(by, auditUpdate, updated.Username); err != nil {
+		accounts.users[i] = previous
+		return err
+	}
+	return nil
+}
+
+// activeAdminsExcept reports whether an enabled admin other than the
+// account at index skip exists; accounts must be locked
+func activeAdminsExcept(skip int) bool {
+	for i, u := range accounts.users {
+		if i != skip && u.role() == "admin" && !u.Disabled {
+			return true
+		}
+	}
+	return false
+}
+
+// requireAdmin fails with a 401 or 403 saveError unless an admin is logged
+// in or the request has an admin API key
+func requireAdmin(r *http.Request) error {
+	if key, ok := requestAPIKey(r); ok {
+		if !key.allows("admin") {
+			return &saveError{status: http.StatusForbidden, msg: "Only admin API keys can manage users"}
+		}
+		return nil
+	}
+	user, ok := sessionUser(r)
+	if !ok {
+		return &saveError{status: http.StatusUnauthorized, msg: "Login required"}
+	}
+	if user.role() != "admin" {
+		return &saveError{status: http.StatusForbidden, msg: "Only admins can manage users"}
+	}
+	return nil
+}
+
+// userRequest is the body of POST /api/users and PUT /api/users/{username};
+// on update, absent fields are kept
+type userRequest struct {
+	Username    string  `json:"username"`
+	DisplayName *string `json:"displayName,omitempty"`
+	Password    string  `json:"password,omitempty"`
+	Role        string  `json:"role,omitempty"`
+	Admin       *bool   `json:"admin,omitempty"` // role admin, or the default role when false
+	Disabled    *bool   `json:"disabled,omitempty"`
+}
+
+// role returns the role a request sets, else current
+func (req userRequest) role(current string) string {
+	switch {
+	case req.Role != "":
+		return req.Role
+	case req.Admin != nil && *req.Admin:
+		return "admin"
+	case req.Admin != nil && current == "admin":
+		return defaultRole
+	}
+	return current
+}
+
+// Handle the local accounts, for admins: GET lists them, POST creates one
+func handleUsers(w http.ResponseWriter, r *http.Request) {
+	if err := requireAdmin(r); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	// Taken before locking the stores, which requestUser reads
+	by := requestUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		accounts.Lock()
+		err := loadAccountsLocked()
+		list := []userInfo{}
+		for _, u := range accounts.users {
+			list = append(list, u.info())
+		}
+		accounts.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading users: %v", err), http.StatusInternalServerError)
+			return
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Username < list[j].Username })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		displayName := ""
+		if req.DisplayName != nil {
+			displayName = *req.DisplayName
+		}
+		user, err := newAccount(req.Username, displayName, req.Password, req.role(defaultRole))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		unlock, err := lockAccounts(r.Context())
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		if findAccountLocked(user.Username) >= 0 {
+			unlock()
+			http.Error(w, fmt.Sprintf("User %s already exists", user.Username), http.StatusConflict)
+			return
+		}
+		accounts.users = append(accounts.users, user)
+		err = saveAccountsLocked(by, auditCreate, user.Username)
+		if err != nil {
+			accounts.users = accounts.users[:len(accounts.users)-1]
+		}
+		unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving users: %v", err), http.StatusInternalServerError)
+			return
+		}
+		logAuth.InfoContext(r.Context(), "Created user", "user", user.Username, "by", modifierName(by))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(user.info())
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle a local account, for admins: PUT changes its display name,
+// password, role or disabled flag, DELETE removes it
+func handleUser(w http.ResponseWriter, r *http.Request) {
+	if err := requireAdmin(r); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	// Taken before locking the stores, which requestUser reads
+	by := requestUser(r)
+	username := r.PathValue("username")
+	switch r.Method {
+	case http.MethodPut:
+		var req userRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var info userInfo
+		err := updateAccount(r.Context(), username, by, func(u *UserAccount) error {
+			if req.DisplayName != nil {
+				u.DisplayName = strings.TrimSpace(*req.DisplayName)
+			}
+			if req.Role != "" || req.Admin != nil {
+				if role := req.role(u.role()); validRole(role) {
+					u.setRole(role)
+				} else {
+					return &saveError{status: http.StatusBadRequest, msg: fmt.Sprintf("invalid role %q", role)}
+				}
+			}
+			if req.Disabled != nil {
+				u.Disabled = *req.Disabled
+			}
+			if req.Password != "" {
+				hash, err := hashPassword(req.Password)
+				if err != nil {
+					return &saveError{status: http.StatusBadRequest, msg: err.Error()}
+				}
+				u.PasswordHash = hash
+			}
+			info = u.info()
+			return nil
+		})
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		if req.Password != "" || info.Disabled {
+			endSessions(info.Username)
+		}
+		logAuth.InfoContext(r.Context(), "Updated user", "user", info.Username, "by", modifierName(by))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+
+	case http.MethodDelete:
+		unlock, err := lockAccounts(r.Context())
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		i := findAccountLocked(username)
+		switch {
+		case i < 0:
+			err = &saveError{status: http.StatusNotFound, msg: "User not found"}
+		case accounts.users[i].role() == "admin" && !activeAdminsExcept(i):
+			err = &saveError{status: http.StatusConflict, msg: "The last admin can't be deleted"}
+		default:
+			users := append(append([]UserAccount{}, accounts.users[:i]...), accounts.users[i+1:]...)
+			previous := accounts.users
+			accounts.users = users
+			if err = saveAccountsLocked(by, auditDelete, username); err != nil {
+				accounts.users = previous
+			}
+		}
+		unlock()
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		endSessions(username)
+		logAuth.InfoContext(r.Context(), "Deleted user", "user", username, "by", modifierName(by))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dataFileInfo is a file of the data directory in GET /api/admin/files
+type dataFileInfo struct {
+	Name string `json:"name"`
+	// Kind is data for the planning data, config for the integrations'
+	// configs, private for accounts, keys and preferences and state for
+	// what the server keeps for itself
+	Kind        string        `json:"kind"`
+	Size        int64         `json:"size"`
+	Modified    string        `json:"modified"`
+	ETag        string        `json:"etag"`
+	Backups     int           `json:"backups"`
+	BackupBytes int64         `json:"backupBytes"`
+	LastWriter  *modification `json:"lastWriter,omitempty"` // unknown for files written outside saves
+}
+
+// dataFileKind tells what a file of the data directory holds
+func dataFileKind(name string) string {
+	switch {
+	case privateFiles[name]:
+		return "private"
+	case strings.HasSuffix(name, "-config.json"):
+		return "config"
+	case serverStateFiles[name] || !sharedFile(name):
+		return "state"
+	}
+	return "data"
+}
+
+// Handle listing the files of the data directory, for admins: their size,
+// last modification, ETag, backups and who last saved them, to spot files
+// grown too large or left stale
+func handleAdminFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, _, role := requestIdentity(r); !roleAllows(role, "admin") {
+		http.Error(w, "Only admins can list the data files", http.StatusForbidden)
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing data files: %v", err), http.StatusInternalServerError)
+		return
+	}
+	backups, err := os.ReadDir(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, fmt.Sprintf("Error listing backups: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writers := loadModifications().Files
+
+	files := []dataFileInfo{}
+	for _, path := range names {
+		name := filepath.Base(path)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading %s: %v", name, err), http.StatusInternalServerError)
+			return
+		}
+		f := dataFileInfo{Name: name, Kind: dataFileKind(name), Size: info.Size(),
+			Modified: info.ModTime().UTC().Format(time.RFC3339), ETag: checksum(content)}
+		prefix := strings.TrimSuffix(name, ".json") + "."
+		for _, b := range backups {
+			if b.IsDir() || !strings.HasPrefix(b.Name(), prefix) || !strings.HasSuffix(b.Name(), ".json") {
+				continue
+			}
+			f.Backups++
+			if bi, err := b.Info(); err == nil {
+				f.BackupBytes += bi.Size()
+			}
+		}
+		if m, ok := writers[name]; ok {
+			f.LastWriter = &m
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+// invalidFile is a data file failing validation
+type invalidFile struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// reloadReport is the JSON response of POST /api/admin/reload
+type reloadReport struct {
+	Files   int           `json:"files"`   // read and validated
+	Changed []string      `json:"changed"` // edited on disk since the server last saw them
+	Invalid []invalidFile `json:"invalid"`
+	Caches  []string      `json:"caches"` // dropped
+}
+
+// validateDataFile checks a file of the data directory as saves do, and the
+// account and key stores as they are decoded
+func validateDataFile(name string, content []byte) error {
+	var data interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	switch name {
+	case "users.json":
+		return json.Unmarshal(content, &usersFile{})
+	case "api-keys.json":
+		return json.Unmarshal(content, &apiKeysFile{})
+	}
+	return validateByPath(name, data)
+}
+
+// Handle reloading the data directory after fixes or restores made outside
+// the API: every file is reread and validated, edits not yet taken in are
+// taken in like the watcher's, and the caches of the configs, accounts, keys,
+// message catalogs and search index are dropped. Stores failing validation
+// are kept as they were.
+func handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	names, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing data files: %v", err), http.StatusInternalServerError)
+		return
+	}
+	report := reloadReport{Changed: []string{}, Invalid: []invalidFile{}, Caches: []string{}}
+	invalid := map[string]bool{}
+	for _, path := range names {
+		name := filepath.Base(path)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			report.Invalid = append(report.Invalid, invalidFile{name, err.Error()})
+			invalid[name] = true
+			continue
+		}
+		report.Files++
+		if err := validateDataFile(name, content); err != nil {
+			report.Invalid = append(report.Invalid, invalidFile{name, err.Error()})
+			invalid[name] = true
+		}
+		fileMu.Lock()
+		previous, known := dataFiles[name]
+		fileMu.Unlock()
+		if watchedFile(name) && (!known || !bytes.Equal(previous, content)) {
+			report.Changed = append(report.Changed, name)
+		}
+	}
+
+	// Files deleted on disk
+	fileMu.Lock()
+	for name := range dataFiles {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); os.IsNotExist(err) {
+			report.Changed = append(report.Changed, name)
+		}
+	}
+	fileMu.Unlock()
+	for _, name := range report.Changed {
+		checkExternalEdit(name)
+	}
+	report.Caches = dropDataCaches(invalid)
+
+	sort.Strings(report.Changed)
+	logServer.InfoContext(r.Context(), "Data directory reloaded", "by", requestUser(r),
+		"files", report.Files, "changed", len(report.Changed), "invalid", len(report.Invalid))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// dropDataCaches drops the caches of the configs, accounts, keys, message
+// catalogs and search index, keeping those of the invalid stores, and
+// returns the caches dropped
+func dropDataCaches(invalid map[string]bool) []string {
+	caches := []string{}
+	drop := func(cache string, fn func()) {
+		fn()
+		caches = append(caches, cache)
+	}
+	drop("cors-config.json", func() {
+		corsConfigCache.Lock()
+		corsConfigCache.loaded = time.Time{}
+		corsConfigCache.Unlock()
+	})
+	drop("cache-config.json", func() {
+		cacheConfigCache.Lock()
+		cacheConfigCache.loaded = time.Time{}
+		cacheConfigCache.Unlock()
+	})
+	drop("network-config.json", func() {
+		networksCache.Lock()
+		networksCache.loaded = time.Time{}
+		networksCache.Unlock()
+	})
+	drop("ratelimit-config.json", func() {
+		rateLimiter.Lock()
+		rateLimiter.loaded = time.Time{}
+		rateLimiter.Unlock()
+	})
+	drop("i18n", func() {
+		catalogs.Lock()
+		catalogs.m = map[string]*catalog{}
+		catalogs.Unlock()
+	})
+	if !invalid["users.json"] {
+		drop("users.json", func() {
+			accounts.Lock()
+			accounts.loaded = false
+			accounts.Unlock()
+		})
+	}
+	if !invalid["api-keys.json"] {
+		drop("api-keys.json", func() {
+			apiKeys.Lock()
+			apiKeys.loaded = false
+			apiKeys.Unlock()
+		})
+	}
+	drop("search", searchIndex.rebuild)
+	return caches
+}
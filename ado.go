@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ADOConfig is ado-config.json, kept on disk only since it holds a personal
+// access token. Work items come from a WIQL query; releases using the "ado"
+// ticket provider also get the work items of their iteration.
+type ADOConfig struct {
+	OrganizationURL string            `json:"organizationUrl"` // e.g. https://dev.azure.com/acme
+	Project         string            `json:"project"`
+	Team            string            `json:"team,omitempty"` // for the iterations list, default team otherwise
+	Token           string            `json:"token"`
+	WIQL            string            `json:"wiql"`
+	IterationRoot   string            `json:"iterationRoot,omitempty"` // e.g. Project\Releases, parent of iterations named after releases
+	Iterations      map[string]string `json:"iterations,omitempty"`    // release name -> iteration path
+	MaxTotalResults int               `json:"maxTotalResults,omitempty"`
+	CacheTTLSeconds *int              `json:"cacheTTLSeconds,omitempty"`
+}
+
+// adoKeyPattern matches a work item key such as AB#123, the form Azure
+// Boards uses to link work items from commits
+var adoKeyPattern = regexp.MustCompile(`^AB#[0-9]+$`)
+
+// adoCache holds WIQL query results keyed by query
+var adoCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// adoAPIVersion is the REST API version requested
+const adoAPIVersion = "7.0"
+
+// loadADOConfig reads ado-config.json; ok is false when Azure DevOps isn't configured
+func loadADOConfig() (cfg ADOConfig, ok bool, err error) {
+	if err := readDataFile("ado-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.OrganizationURL = strings.TrimSuffix(cfg.OrganizationURL, "/")
+	return cfg, cfg.OrganizationURL != "" && cfg.Project != "" && cfg.Token != "", nil
+}
+
+// adoDo calls the Azure DevOps REST API; path is relative to the organization
+func adoDo(cfg ADOConfig, method, path string, body, out interface{}) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequest(method, cfg.OrganizationURL+path+sep+"api-version="+adoAPIVersion, nil)
+	if err != nil {
+		return err
+	}
+	// Personal access tokens go in basic auth with an empty user name
+	req.SetBasicAuth("", cfg.Token)
+	return doJSON(req, body, out)
+}
+
+// adoPathSegment escapes a project or team name for a URL path
+func adoPathSegment(s string) string {
+	return url.PathEscape(s)
+}
+
+// adoWorkItem is the part of a work item we use
+type adoWorkItem struct {
+	ID     int `json:"id"`
+	Fields struct {
+		Title      string `json:"System.Title"`
+		State      string `json:"System.State"`
+		Type       string `json:"System.WorkItemType"`
+		Iteration  string `json:"System.IterationPath"`
+		AssignedTo *struct {
+			DisplayName string `json:"displayName"`
+		} `json:"System.AssignedTo"`
+		Priority int `json:"Microsoft.VSTS.Common.Priority"`
+	} `json:"fields"`
+}
+
+// adoTicketFromWorkItem converts a work item to the Jira ticket format
+func adoTicketFromWorkItem(cfg ADOConfig, item adoWorkItem) map[string]interface{} {
+	ticket := map[string]interface{}{
+		"key":       "AB#" + strconv.Itoa(item.ID),
+		"summary":   item.Fields.Title,
+		"status":    item.Fields.State,
+		"type":      item.Fields.Type,
+		"iteration": item.Fields.Iteration,
+		"url":       fmt.Sprintf("%s/%s/_workitems/edit/%d", cfg.OrganizationURL, adoPathSegment(cfg.Project), item.ID),
+		"provider":  "ado",
+	}
+	if item.Fields.AssignedTo != nil {
+		ticket["assignee"] = item.Fields.AssignedTo.DisplayName
+	}
+	if item.Fields.Priority > 0 {
+		ticket["priority"] = strconv.Itoa(item.Fields.Priority)
+	}
+	return ticket
+}
+
+// fetchADOWorkItems runs a WIQL query and loads the matching work items,
+// up to maxTotalResults
+func fetchADOWorkItems(cfg ADOConfig, wiql string) ([]map[string]interface{}, error) {
+	limit := defaultJiraResultLimit
+	if cfg.MaxTotalResults > 0 {
+		limit = min(cfg.MaxTotalResults, jiraResultHardCap)
+	}
+	var result struct {
+		WorkItems []struct {
+			ID int `json:"id"`
+		} `json:"workItems"`
+	}
+	path := "/" + adoPathSegment(cfg.Project) + "/_apis/wit/wiql?$top=" + strconv.Itoa(limit)
+	if err := adoDo(cfg, http.MethodPost, path, map[string]string{"query": wiql}, &result); err != nil {
+		return nil, err
+	}
+
+	// Work item details are fetched in batches of at most 200
+	fields := "System.Title,System.State,System.WorkItemType,System.IterationPath,System.AssignedTo,Microsoft.VSTS.Common.Priority"
+	tickets := []map[string]interface{}{}
+	for start := 0; start < len(result.WorkItems); start += 200 {
+		batch := result.WorkItems[start:min(start+200, len(result.WorkItems))]
+		ids := make([]string, len(batch))
+		for i, w := range batch {
+			ids[i] = strconv.Itoa(w.ID)
+		}
+		var items struct {
+			Value []adoWorkItem `json:"value"`
+		}
+		if err := adoDo(cfg, http.MethodGet, "/_apis/wit/workitems?ids="+strings.Join(ids, ",")+"&fields="+fields, nil, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items.Value {
+			tickets = append(tickets, adoTicketFromWorkItem(cfg, item))
+		}
+	}
+	return tickets, nil
+}
+
+// cachedADOSearch returns the work items of a WIQL query, cached and served
+// stale while Azure DevOps is unavailable like Jira searches
+func cachedADOSearch(cfg ADOConfig, wiql string, refresh bool) (jiraTicketsResult, error) {
+	ttl := defaultJiraCacheTTL
+	if cfg.CacheTTLSeconds != nil && *cfg.CacheTTLSeconds >= 0 {
+		ttl = time.Duration(*cfg.CacheTTLSeconds) * time.Second
+	}
+	cached, hit := adoCache.get(wiql)
+	if hit && !refresh && time.Since(cached.fetchedAt) < ttl {
+		return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+	}
+	tickets, err := fetchADOWorkItems(cfg, wiql)
+	if err != nil {
+		logADO.Error("Azure DevOps query failed", "err", err)
+		if hit {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, &jiraError{http.StatusBadGateway, fmt.Sprintf("Azure DevOps API error: %v", err)}
+	}
+	entry := adoCache.put(wiql, tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// cachedADOTickets returns the work items of the configured WIQL query
+func cachedADOTickets(refresh bool) (jiraTicketsResult, error) {
+	cfg, ok, err := loadADOConfig()
+	if err != nil {
+		return jiraTicketsResult{}, &jiraError{http.StatusInternalServerError, "Invalid Azure DevOps config"}
+	}
+	if !ok || cfg.WIQL == "" {
+		return jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "MISS"}, nil
+	}
+	return cachedADOSearch(cfg, cfg.WIQL, refresh)
+}
+
+// adoIterationPath is the iteration mapped to a release name: set in
+// iterations, or named after the release under iterationRoot
+func adoIterationPath(cfg ADOConfig, releaseName string) string {
+	if path := cfg.Iterations[releaseName]; path != "" {
+		return path
+	}
+	if cfg.IterationRoot != "" && releaseName != "" {
+		return cfg.IterationRoot + `\` + releaseName
+	}
+	return ""
+}
+
+// adoReleaseTickets returns the tickets of a release using the Azure DevOps
+// provider: the linked work items and those in its mapped iteration
+func adoReleaseTickets(release ReleaseEntry) []map[string]interface{} {
+	linked, _ := cachedADOTickets(false)
+	tickets := lookupTickets(release.linkedTickets(), linked, "ado")
+
+	cfg, ok, err := loadADOConfig()
+	path := adoIterationPath(cfg, release.ReleaseName)
+	if err != nil || !ok || path == "" {
+		return tickets
+	}
+	wiql := fmt.Sprintf("SELECT [System.Id] FROM WorkItems WHERE [System.TeamProject] = @project AND [System.IterationPath] UNDER '%s'",
+		strings.ReplaceAll(path, "'", "''"))
+	result, err := cachedADOSearch(cfg, wiql, false)
+	if err != nil {
+		logADO.Error("Fetching iteration work items failed", "iteration", path, "err", err)
+		return tickets
+	}
+	return appendNewTickets(tickets, result.tickets)
+}
+
+// adoProvider serves releases using the "ado" ticket provider
+type adoProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "ado", Name: "Azure DevOps", ConfigFile: "ado-config.json",
+		KeyFormat: "AB#number", KeyExample: "AB#123"}, adoProvider{})
+}
+
+func (adoProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	return cachedADOTickets(refresh)
+}
+
+func (adoProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	return adoReleaseTickets(release)
+}
+
+func (adoProvider) Link(key string) (string, bool) {
+	key = strings.ToUpper(key)
+	return key, adoKeyPattern.MatchString(key)
+}
+
+// adoIteration is one entry of GET /api/ado/iterations
+type adoIteration struct {
+	Name     string   `json:"name"`
+	Path     string   `json:"path"`
+	Start    string   `json:"start,omitempty"`
+	Finish   string   `json:"finish,omitempty"`
+	Releases []string `json:"releases"`
+}
+
+// Handle Azure DevOps iterations: the team's iterations, each mapped to the
+// releases whose iteration path it is
+func handleADOIterations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadADOConfig()
+	if err != nil {
+		http.Error(w, "Invalid Azure DevOps config", http.StatusInternalServerError)
+		return
+	}
+	iterations := []adoIteration{}
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(iterations)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	byPath := map[string][]string{}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if path := adoIterationPath(cfg, e.ReleaseName); path != "" {
+				byPath[strings.ToLower(path)] = append(byPath[strings.ToLower(path)], releaseID(env, e.Date))
+			}
+		}
+	}
+
+	path := "/" + adoPathSegment(cfg.Project)
+	if cfg.Team != "" {
+		path += "/" + adoPathSegment(cfg.Team)
+	}
+	var list struct {
+		Value []struct {
+			Name       string `json:"name"`
+			Path       string `json:"path"`
+			Attributes struct {
+				StartDate  string `json:"startDate"`
+				FinishDate string `json:"finishDate"`
+			} `json:"attributes"`
+		} `json:"value"`
+	}
+	if err := adoDo(cfg, http.MethodGet, path+"/_apis/work/teamsettings/iterations", nil, &list); err != nil {
+		http.Error(w, fmt.Sprintf("Azure DevOps API error: %v", err), http.StatusBadGateway)
+		return
+	}
+	for _, it := range list.Value {
+		ids := byPath[strings.ToLower(it.Path)]
+		sort.Strings(ids)
+		if ids == nil {
+			ids = []string{}
+		}
+		iterations = append(iterations, adoIteration{
+			Name:     it.Name,
+			Path:     it.Path,
+			Start:    strings.TrimSuffix(it.Attributes.StartDate, "T00:00:00Z"),
+			Finish:   strings.TrimSuffix(it.Attributes.FinishDate, "T00:00:00Z"),
+			Releases: ids,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(iterations)
+}
@@ -0,0 +1,700 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// frequencyBucket counts releases within one week or month
+type frequencyBucket struct {
+	Period   string         `json:"period"`
+	Start    string         `json:"start"`
+	Count    int            `json:"count"`
+	ByStatus map[string]int `json:"byStatus"`
+}
+
+// frequencyReport is the response of GET /api/analytics/frequency
+type frequencyReport struct {
+	From         string                       `json:"from"`
+	To           string                       `json:"to"`
+	Interval     string                       `json:"interval"`
+	Environments map[string][]frequencyBucket `json:"environments"`
+	Totals       map[string]int               `json:"totals"`
+}
+
+// bucketStart returns the first day of the week (Monday) or month containing t
+func bucketStart(t time.Time, interval string) time.Time {
+	if interval == "week" {
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+}
+
+// bucketLabel names a bucket as ISO week ("2025-W14") or month ("2025-04")
+func bucketLabel(start time.Time, interval string) string {
+	if interval == "week" {
+		y, w := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	}
+	return start.Format("2006-01")
+}
+
+// nextBucket advances to the start of the following bucket
+func nextBucket(start time.Time, interval string) time.Time {
+	if interval == "week" {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 1, 0)
+}
+
+// parseAnalyticsRange reads from/to query parameters, defaulting to the last year
+func parseAnalyticsRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	to, ok = parseDateParam(r, "to", today())
+	if !ok {
+		http.Error(w, "Invalid 'to' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	from, ok = parseDateParam(r, "from", to.AddDate(-1, 0, 0))
+	if !ok {
+		http.Error(w, "Invalid 'from' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "'to' must not be before 'from'", http.StatusBadRequest)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// Handle release frequency analytics
+func handleAnalyticsFrequency(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "month"
+	}
+	if interval != "week" && interval != "month" {
+		http.Error(w, "Invalid 'interval', expected week or month", http.StatusBadRequest)
+		return
+	}
+	envFilter := r.URL.Query().Get("env")
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	report := frequencyReport{
+		From:         from.Format(dateLayout),
+		To:           to.Format(dateLayout),
+		Interval:     interval,
+		Environments: map[string][]frequencyBucket{},
+		Totals:       map[string]int{},
+	}
+
+	for env, entries := range releases {
+		if envFilter != "" && env != envFilter {
+			continue
+		}
+
+		// Pre-create every bucket in range so gaps show up as zero counts
+		buckets := []frequencyBucket{}
+		index := map[string]int{}
+		for b := bucketStart(from, interval); !b.After(to); b = nextBucket(b, interval) {
+			label := bucketLabel(b, interval)
+			index[label] = len(buckets)
+			buckets = append(buckets, frequencyBucket{Period: label, Start: b.Format(dateLayout), ByStatus: map[string]int{}})
+		}
+
+		for _, e := range entries {
+			if !inDateRange(e.Date, from, to) {
+				continue
+			}
+			t, _ := time.ParseInLocation(dateLayout, e.Date, time.Local)
+			i := index[bucketLabel(bucketStart(t, interval), interval)]
+			buckets[i].Count++
+			buckets[i].ByStatus[e.Status]++
+			report.Totals[env]++
+		}
+		report.Environments[env] = buckets
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// utilizationGap is the longest stretch without releases in an environment
+type utilizationGap struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Days int    `json:"days"`
+}
+
+// environmentUtilization is the per-environment part of the utilization report
+type environmentUtilization struct {
+	AvailableWindows int             `json:"availableWindows"`
+	UsedWindows      int             `json:"usedWindows"`
+	Utilization      float64         `json:"utilization"`
+	UpcomingReleases int             `json:"upcomingReleases"`
+	UpcomingLoad     float64         `json:"upcomingLoad"`
+	BusiestWeek      string          `json:"busiestWeek,omitempty"`
+	BusiestWeekCount int             `json:"busiestWeekCount"`
+	LongestGap       *utilizationGap `json:"longestGap,omitempty"`
+}
+
+// utilizationReport is the response of GET /api/analytics/utilization
+type utilizationReport struct {
+	From         string                            `json:"from"`
+	To           string                            `json:"to"`
+	AheadDays    int                               `json:"aheadDays"`
+	Environments map[string]environmentUtilization `json:"environments"`
+}
+
+// isDeploymentWindow reports whether releases may be scheduled on a day,
+// matching the frontend which refuses weekends and holidays
+func isDeploymentWindow(day time.Time, holidays map[string]bool) bool {
+	if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+		return false
+	}
+	return !holidays[day.Format(dateLayout)]
+}
+
+// countDeploymentWindows counts schedulable days within [from, to]
+func countDeploymentWindows(from, to time.Time, holidays map[string]bool) int {
+	n := 0
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if isDeploymentWindow(d, holidays) {
+			n++
+		}
+	}
+	return n
+}
+
+// holidaySet returns the holiday dates as a lookup set
+func holidaySet(holidays HolidaysData) map[string]bool {
+	set := map[string]bool{}
+	for _, h := range holidays.Holidays {
+		set[h.Date] = true
+	}
+	return set
+}
+
+// Handle environment utilization report. The past period (from/to) measures
+// how many deployment windows were used; the next "ahead" days measure congestion.
+func handleAnalyticsUtilization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+	ahead := 28
+	if v := r.URL.Query().Get("ahead"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			ahead = n
+		}
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		http.Error(w, "Error reading holidays", http.StatusInternalServerError)
+		return
+	}
+	hset := holidaySet(holidays)
+
+	aheadFrom := today().AddDate(0, 0, 1)
+	aheadTo := aheadFrom.AddDate(0, 0, ahead-1)
+	available := countDeploymentWindows(from, to, hset)
+	availableAhead := countDeploymentWindows(aheadFrom, aheadTo, hset)
+
+	report := utilizationReport{
+		From:         from.Format(dateLayout),
+		To:           to.Format(dateLayout),
+		AheadDays:    ahead,
+		Environments: map[string]environmentUtilization{},
+	}
+
+	for env, entries := range releases {
+		u := environmentUtilization{AvailableWindows: available}
+
+		used := map[string]bool{}
+		upcoming := map[string]bool{}
+		weeks := map[string]int{}
+		for _, e := range entries {
+			if inDateRange(e.Date, from, to) {
+				used[e.Date] = true
+			}
+			if inDateRange(e.Date, aheadFrom, aheadTo) {
+				upcoming[e.Date] = true
+				t, _ := time.ParseInLocation(dateLayout, e.Date, time.Local)
+				weeks[bucketLabel(bucketStart(t, "week"), "week")]++
+			}
+		}
+
+		u.UsedWindows = len(used)
+		if available > 0 {
+			u.Utilization = float64(u.UsedWindows) / float64(available)
+		}
+		u.UpcomingReleases = len(upcoming)
+		if availableAhead > 0 {
+			u.UpcomingLoad = float64(u.UpcomingReleases) / float64(availableAhead)
+		}
+		for week, n := range weeks {
+			if n > u.BusiestWeekCount || (n == u.BusiestWeekCount && week < u.BusiestWeek) {
+				u.BusiestWeek, u.BusiestWeekCount = week, n
+			}
+		}
+
+		// Longest gap between consecutive used days, bounded by the period
+		dates := make([]string, 0, len(used))
+		for d := range used {
+			dates = append(dates, d)
+		}
+		sort.Strings(dates)
+		prev := from.AddDate(0, 0, -1)
+		bounds := append(dates, to.AddDate(0, 0, 1).Format(dateLayout))
+		for _, d := range bounds {
+			t, _ := time.ParseInLocation(dateLayout, d, time.Local)
+			gap := int(t.Sub(prev).Hours()/24+0.5) - 1
+			if gap > 0 && (u.LongestGap == nil || gap > u.LongestGap.Days) {
+				u.LongestGap = &utilizationGap{
+					From: prev.AddDate(0, 0, 1).Format(dateLayout),
+					To:   t.AddDate(0, 0, -1).Format(dateLayout),
+					Days: gap,
+				}
+			}
+			prev = t
+		}
+
+		report.Environments[env] = u
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// completedStatuses are the release statuses counted as successful deployments
+var completedStatuses = map[string]bool{"Done": true, "Hotfix Done": true}
+
+// doraLeadTime summarizes change lead time in days
+type doraLeadTime struct {
+	Samples     int      `json:"samples"`
+	MeanDays    float64  `json:"meanDays"`
+	MedianDays  float64  `json:"medianDays"`
+	P90Days     float64  `json:"p90Days"`
+	MissingKeys []string `json:"missingKeys,omitempty"`
+	Unavailable string   `json:"unavailable,omitempty"`
+}
+
+// doraReport is the response of GET /api/analytics/dora
+type doraReport struct {
+	From                string       `json:"from"`
+	To                  string       `json:"to"`
+	Environment         string       `json:"environment"`
+	Deployments         int          `json:"deployments"`
+	DeploymentsPerWeek  float64      `json:"deploymentsPerWeek"`
+	DeploymentFrequency string       `json:"deploymentFrequency"`
+	LeadTime            doraLeadTime `json:"leadTime"`
+}
+
+// doraFrequencyClass buckets deployments per week into the DORA performance levels
+func doraFrequencyClass(perWeek float64) string {
+	switch {
+	case perWeek >= 7:
+		return "elite"
+	case perWeek >= 1:
+		return "high"
+	case perWeek >= 0.25:
+		return "medium"
+	default:
+		return "low"
+	}
+}
+
+// ticketKeys splits a release's Jira ticket field, which may hold several keys
+func ticketKeys(field string) []string {
+	return strings.FieldsFunc(field, func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	})
+}
+
+// percentile returns the p-th percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// fetchTicketCreated looks up the creation time of the given Jira issues;
+// keys that aren't Jira issue keys are left out of the search
+func fetchTicketCreated(ctx context.Context, keys []string) (map[string]time.Time, error) {
+	client, _, err := newJiraClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, fmt.Errorf("Jira is not configured")
+	}
+
+	var valid []string
+	for _, k := range keys {
+		if jiraKeyPattern.MatchString(k) {
+			valid = append(valid, k)
+		}
+	}
+	keys = valid
+
+	created := map[string]time.Time{}
+	const batch = 50
+	for i := 0; i < len(keys); i += batch {
+		end := i + batch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		jql := fmt.Sprintf("key in (%s)", strings.Join(keys[i:end], ","))
+		issues, _, err := client.Issue.Search(jql, &jira.SearchOptions{MaxResults: batch, Fields: []string{"created"}})
+		if err != nil {
+			return nil, fmt.Errorf("Jira search failed: %w", err)
+		}
+		for _, issue := range issues {
+			if issue.Fields != nil {
+				created[issue.Key] = time.Time(issue.Fields.Created)
+			}
+		}
+	}
+	return created, nil
+}
+
+// Handle DORA-style metrics: deployment frequency and change lead time for
+// completed releases of one environment (production by default)
+func handleAnalyticsDORA(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+	env := r.URL.Query().Get("env")
+	if env == "" {
+		env = "production"
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	report := doraReport{
+		From:        from.Format(dateLayout),
+		To:          to.Format(dateLayout),
+		Environment: env,
+	}
+
+	deployedAt := map[string]time.Time{}
+	for _, e := range releases[env] {
+		if !completedStatuses[e.Status] || !inDateRange(e.Date, from, to) {
+			continue
+		}
+		report.Deployments++
+		// Lead times come from Jira, so only for the releases tracked there
+		if info, _ := ticketProviderFor(e.TicketProvider); info.ID != "jira" {
+			continue
+		}
+		start, _, err := e.window()
+		if err != nil {
+			continue
+		}
+		for _, key := range e.linkedTickets() {
+			// A ticket shipped in several releases counts from its first deployment
+			if t, ok := deployedAt[key]; !ok || start.Before(t) {
+				deployedAt[key] = start
+			}
+		}
+	}
+
+	weeks := to.Sub(from).Hours()/(24*7) + 1.0/7
+	report.DeploymentsPerWeek = float64(report.Deployments) / weeks
+	report.DeploymentFrequency = doraFrequencyClass(report.DeploymentsPerWeek)
+
+	if len(deployedAt) > 0 {
+		keys := make([]string, 0, len(deployedAt))
+		for k := range deployedAt {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		created, err := fetchTicketCreated(r.Context(), keys)
+		if err != nil {
+			logAnalytics.WarnContext(r.Context(), "DORA lead time unavailable", "err", err)
+			report.LeadTime.Unavailable = err.Error()
+		} else {
+			var days []float64
+			for _, k := range keys {
+				c, ok := created[k]
+				if !ok {
+					report.LeadTime.MissingKeys = append(report.LeadTime.MissingKeys, k)
+					continue
+				}
+				days = append(days, deployedAt[k].Sub(c).Hours()/24)
+			}
+			sort.Float64s(days)
+			report.LeadTime.Samples = len(days)
+			if len(days) > 0 {
+				sum := 0.0
+				for _, d := range days {
+					sum += d
+				}
+				report.LeadTime.MeanDays = sum / float64(len(days))
+				report.LeadTime.MedianDays = percentile(days, 0.5)
+				report.LeadTime.P90Days = percentile(days, 0.9)
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// slippageStats aggregates planned vs. actual dates for a group of releases
+type slippageStats struct {
+	Releases          int     `json:"releases"`
+	Rescheduled       int     `json:"rescheduled"`
+	RescheduleRate    float64 `json:"rescheduleRate"`
+	TotalReschedules  int     `json:"totalReschedules"`
+	AvgSlipDays       float64 `json:"avgSlipDays"`
+	MaxSlipDays       int     `json:"maxSlipDays"`
+	Completed         int     `json:"completed"`
+	CompletedLate     int     `json:"completedLate"`
+	AvgCompletionDays float64 `json:"avgCompletionDelayDays"`
+
+	slipSum       int
+	completionSum float64
+}
+
+// add accounts for one release
+func (s *slippageStats) add(e ReleaseEntry) {
+	s.Releases++
+	if len(e.Reschedules) > 0 {
+		s.Rescheduled++
+		s.TotalReschedules += len(e.Reschedules)
+	}
+
+	planned, err1 := time.ParseInLocation(dateLayout, e.OriginalDate, time.Local)
+	actual, err2 := time.ParseInLocation(dateLayout, e.Date, time.Local)
+	if err1 == nil && err2 == nil {
+		slip := int(actual.Sub(planned).Hours() / 24)
+		s.slipSum += slip
+		if slip > s.MaxSlipDays {
+			s.MaxSlipDays = slip
+		}
+	}
+
+	if e.CompletedAt != "" && err2 == nil {
+		if done, err := time.Parse(time.RFC3339, e.CompletedAt); err == nil {
+			s.Completed++
+			delay := done.Sub(actual.AddDate(0, 0, 1)).Hours() / 24
+			if delay > 0 {
+				s.CompletedLate++
+				s.completionSum += delay
+			}
+		}
+	}
+}
+
+// finish computes the averages
+func (s *slippageStats) finish() {
+	if s.Releases > 0 {
+		s.RescheduleRate = float64(s.Rescheduled) / float64(s.Releases)
+		s.AvgSlipDays = float64(s.slipSum) / float64(s.Releases)
+	}
+	if s.Completed > 0 {
+		s.AvgCompletionDays = s.completionSum / float64(s.Completed)
+	}
+}
+
+// slippageReport is the response of GET /api/analytics/slippage
+type slippageReport struct {
+	From         string                    `json:"from"`
+	To           string                    `json:"to"`
+	Environments map[string]*slippageStats `json:"environments"`
+	Labels       map[string]*slippageStats `json:"labels"`
+}
+
+// Handle SLA slippage statistics of planned vs. actual release dates
+func handleAnalyticsSlippage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	report := slippageReport{
+		From:         from.Format(dateLayout),
+		To:           to.Format(dateLayout),
+		Environments: map[string]*slippageStats{},
+		Labels:       map[string]*slippageStats{},
+	}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if !inDateRange(e.Date, from, to) {
+				continue
+			}
+			if e.OriginalDate == "" {
+				e.OriginalDate = e.Date
+			}
+			if report.Environments[env] == nil {
+				report.Environments[env] = &slippageStats{}
+			}
+			report.Environments[env].add(e)
+			for _, label := range e.Labels {
+				if report.Labels[label] == nil {
+					report.Labels[label] = &slippageStats{}
+				}
+				report.Labels[label].add(e)
+			}
+		}
+	}
+	for _, s := range report.Environments {
+		s.finish()
+	}
+	for _, s := range report.Labels {
+		s.finish()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// changeFailureStats counts the completed releases of a group that led to
+// incidents or were rolled back
+type changeFailureStats struct {
+	Deployments int            `json:"deployments"`
+	Failed      int            `json:"failed"`
+	FailureRate float64        `json:"changeFailureRate"`
+	Incidents   int            `json:"incidents"`
+	BySeverity  map[string]int `json:"bySeverity"`
+	RolledBack  int            `json:"rolledBack"`
+}
+
+// add accounts for one completed release
+func (s *changeFailureStats) add(e ReleaseEntry) {
+	s.Deployments++
+	rolledBack := e.Outcome != nil && e.Outcome.Result == "rolled-back"
+	if rolledBack {
+		s.RolledBack++
+	}
+	if len(e.Incidents) > 0 || rolledBack {
+		s.Failed++
+	}
+	for _, inc := range e.Incidents {
+		s.Incidents++
+		s.BySeverity[inc.Severity]++
+	}
+}
+
+// changeFailureReport is the response of GET /api/analytics/change-failure
+type changeFailureReport struct {
+	From         string                         `json:"from"`
+	To           string                         `json:"to"`
+	Environments map[string]*changeFailureStats `json:"environments"`
+	Labels       map[string]*changeFailureStats `json:"labels"`
+}
+
+// Handle change failure rate: the share of completed releases per
+// environment and label with linked incidents or a rolled-back outcome
+func handleAnalyticsChangeFailure(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	report := changeFailureReport{
+		From:         from.Format(dateLayout),
+		To:           to.Format(dateLayout),
+		Environments: map[string]*changeFailureStats{},
+		Labels:       map[string]*changeFailureStats{},
+	}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if !completedStatuses[e.Status] || !inDateRange(e.Date, from, to) {
+				continue
+			}
+			if report.Environments[env] == nil {
+				report.Environments[env] = &changeFailureStats{BySeverity: map[string]int{}}
+			}
+			report.Environments[env].add(e)
+			for _, label := range e.Labels {
+				if report.Labels[label] == nil {
+					report.Labels[label] = &changeFailureStats{BySeverity: map[string]int{}}
+				}
+				report.Labels[label].add(e)
+			}
+		}
+	}
+	for _, groups := range []map[string]*changeFailureStats{report.Environments, report.Labels} {
+		for _, s := range groups {
+			s.FailureRate = float64(s.Failed) / float64(s.Deployments)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is a key of api-keys.json for scripts such as CI jobs, sent as
+// "Authorization: Bearer <key>". Only its hash is kept; the key itself is
+// shown once, when it is created.
+type APIKey struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`          // read, write or admin
+	Hash      string `json:"hash,omitempty"` // SHA-256 of the key
+	Prefix    string `json:"prefix"`         // start of the key, to tell keys apart
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	CreatedBy string `json:"createdBy,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// apiKeysFile is api-keys.json
+type apiKeysFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+// API key scopes, each allowing what the previous ones do: read keys can't
+// make changes, write keys can't manage users or keys
+var apiKeyScopes = map[string]int{"read": 0, "write": 1, "admin": 2}
+
+// apiKeyPrefix starts every key, so they are recognizable in configs and logs
+const apiKeyPrefix = "rp_"
+
+// apiKeys is the key store, read from api-keys.json and kept in memory until
+// the file changes, e.g. saved by another instance
+var apiKeys struct {
+	sync.Mutex
+	loaded bool
+	stamp  fileStamp // of api-keys.json when read
+	keys   []APIKey
+}
+
+// loadAPIKeysLocked reads api-keys.json the first time and again once it
+// changed; apiKeys must be locked
+func loadAPIKeysLocked() error {
+	stamp := statFile(filepath.Join(dataDir, "api-keys.json"))
+	if apiKeys.loaded && stamp.equal(apiKeys.stamp) {
+		return nil
+	}
+	var data apiKeysFile
+	if err := readDataFile("api-keys.json", &data); err != nil {
+		return err
+	}
+	apiKeys.keys, apiKeys.loaded, apiKeys.stamp = data.Keys, true, stamp
+	return nil
+}
+
+// lockAPIKeys takes the write lock shared with other instances, then
+// apiKeys, and rereads api-keys.json if another instance changed it, for a
+// change of the keys; the returned func unlocks both
+func lockAPIKeys(ctx context.Context) (func(), error) {
+	release, err := clusterLock(ctx)
+	if err != nil {
+		return nil, &saveError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("Try again, %v", err)}
+	}
+	apiKeys.Lock()
+	if err := loadAPIKeysLocked(); err != nil {
+		apiKeys.Unlock()
+		release()
+		return nil, err
+	}
+	return func() {
+		apiKeys.Unlock()
+		release()
+	}, nil
+}
+
+// saveAPIKeysLocked writes api-keys.json, readable by the server only, and
+// audits the change of a key by a user; apiKeys must be locked with
+// lockAPIKeys
+func saveAPIKeysLocked(by, action, name string) error {
+	data, err := json.MarshalIndent(apiKeysFile{Keys: apiKeys.keys}, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dataDir, "api-keys.json")
+	before, _ := os.ReadFile(path)
+	if err := replaceFile(path, data, 0600); err != nil {
+		return err
+	}
+	apiKeys.stamp = statFile(path)
+	auditWrite(by, action, "api-keys.json", name, before, data)
+	return nil
+}
+
+// allows reports whether the key's scope covers a scope
+func (k APIKey) allows(scope string) bool {
+	return apiKeyScopes[k.Scope] >= apiKeyScopes[scope]
+}
+
+// hashAPIKey returns the hash api-keys.json keeps of a key
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// bearerAPIKey returns the request's bearer token if it is one of our API
+// keys, whether valid or not; other bearer tokens belong to the endpoints
+// with tokens of their own
+func bearerAPIKey(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer "+apiKeyPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(auth, "Bearer "), true
+}
+
+// requestAPIKey returns the unexpired API key a request is authenticated with
+func requestAPIKey(r *http.Request) (APIKey, bool) {
+	key, ok := bearerAPIKey(r)
+	if !ok {
+		return APIKey{}, false
+	}
+	hash := hashAPIKey(key)
+	apiKeys.Lock()
+	defer apiKeys.Unlock()
+	if err := loadAPIKeysLocked(); err != nil {
+		logAuth.ErrorContext(r.Context(), "Error reading api-keys.json", "err", err)
+		return APIKey{}, false
+	}
+	for _, k := range apiKeys.keys {
+		if k.Hash == hash {
+			if k.ExpiresAt != "" && k.ExpiresAt < today().Format(dateLayout) {
+				return APIKey{}, false
+			}
+			return k, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// user is how changes made with the key are attributed
+func (k APIKey) user() string {
+	return "apikey:" + k.Name
+}
+
+// apiKeyRequest is the body of POST /api/api-keys
+type apiKeyRequest struct {
+	Name      string `json:"name"`
+	Scope     string `json:"scope"`
+	ExpiresAt string `json:"expiresAt,omitempty"` // YYYY-MM-DD, last valid day
+}
+
+// Handle the API keys, for admins: GET lists them, POST creates one and
+// returns it, the only time the key is shown
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if err := requireAdmin(r); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	// Taken before locking the stores, which requestUser reads
+	by := requestUser(r)
+	switch r.Method {
+	case http.MethodGet:
+		apiKeys.Lock()
+		err := loadAPIKeysLocked()
+		list := append([]APIKey{}, apiKeys.keys...)
+		apiKeys.Unlock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading API keys: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for i := range list {
+			list[i].Hash = ""
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(list)
+
+	case http.MethodPost:
+		var req apiKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if !usernamePattern.MatchString(req.Name) {
+			http.Error(w, fmt.Sprintf("Invalid key name %q", req.Name), http.StatusBadRequest)
+			return
+		}
+		if _, ok := apiKeyScopes[req.Scope]; !ok {
+			http.Error(w, "Invalid scope, expected read, write or admin", http.StatusBadRequest)
+			return
+		}
+		if req.ExpiresAt != "" {
+			if _, err := time.Parse(dateLayout, req.ExpiresAt); err != nil {
+				http.Error(w, "Invalid expiresAt, expected YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		key := apiKeyPrefix + newToken(24)
+		k := APIKey{ID: newToken(8), Name: req.Name, Scope: req.Scope, Hash: hashAPIKey(key), Prefix: key[:len(apiKeyPrefix)+6],
+			ExpiresAt: req.ExpiresAt, CreatedBy: by, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+
+		unlock, err := lockAPIKeys(r.Context())
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		for _, other := range apiKeys.keys {
+			if strings.EqualFold(other.Name, k.Name) {
+				err = &saveError{status: http.StatusConflict, msg: fmt.Sprintf("API key %s already exists", k.Name)}
+			}
+		}
+		if err == nil {
+			apiKeys.keys = append(apiKeys.keys, k)
+			if err = saveAPIKeysLocked(by, auditCreate, k.Name); err != nil {
+				apiKeys.keys = apiKeys.keys[:len(apiKeys.keys)-1]
+			}
+		}
+		unlock()
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		logAuth.InfoContext(r.Context(), "Created API key", "key", k.Name, "scope", k.Scope, "by", modifierName(by))
+		k.Hash = ""
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"key": key, "apiKey": k})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle revoking an API key, for admins
+func handleAPIKey(w http.ResponseWriter, r *http.Request) {
+	if err := requireAdmin(r); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	// Taken before locking the stores, which requestUser reads
+	by := requestUser(r)
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+	unlock, err := lockAPIKeys(r.Context())
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	var revoked APIKey
+	err = &saveError{status: http.StatusNotFound, msg: "API key not found"}
+	for i, k := range apiKeys.keys {
+		if k.ID == id {
+			previous := apiKeys.keys
+			apiKeys.keys = append(append([]APIKey{}, previous[:i]...), previous[i+1:]...)
+			if err = saveAPIKeysLocked(by, auditDelete, k.Name); err != nil {
+				apiKeys.keys = previous
+			}
+			revoked = k
+			break
+		}
+	}
+	unlock()
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	logAuth.InfoContext(r.Context(), "Revoked API key", "key", revoked.Name, "by", modifierName(by))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArgoCDConfig is argocd-config.json, kept on disk only since it holds a
+// token. Each environment lists the ArgoCD applications deployed to it, by
+// name or by label selector.
+type ArgoCDConfig struct {
+	URL             string                       `json:"url"` // e.g. https://argocd.example.com
+	Token           string                       `json:"token"`
+	Environments    map[string]ArgoCDEnvironment `json:"environments"`
+	CacheTTLSeconds int                          `json:"cacheTTLSeconds,omitempty"` // default 60
+}
+
+// ArgoCDEnvironment selects the applications of an environment
+type ArgoCDEnvironment struct {
+	Applications []string `json:"applications,omitempty"`
+	Selector     string   `json:"selector,omitempty"` // labels, e.g. env=prod,team=web
+}
+
+// deployedVersion is an application running on an environment, as reported
+// by the cluster tooling
+type deployedVersion struct {
+	Source     string   `json:"source"` // argocd or kubernetes
+	Name       string   `json:"name"`
+	Version    string   `json:"version"` // the first image's tag, else the target revision
+	Revision   string   `json:"revision,omitempty"`
+	SyncStatus string   `json:"syncStatus,omitempty"` // Synced, OutOfSync...
+	Health     string   `json:"health,omitempty"`     // Healthy, Progressing, Degraded... or Available
+	Images     []string `json:"images,omitempty"`
+}
+
+// environmentVersions is what runs on an environment next to the version
+// of its latest completed release
+type environmentVersions struct {
+	Planned      string            `json:"planned,omitempty"`
+	Applications []deployedVersion `json:"applications"`
+}
+
+// argocdApplication is the part of an ArgoCD application we use
+type argocdApplication struct {
+	Metadata struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+	} `json:"metadata"`
+	Spec struct {
+		Source *struct {
+			TargetRevision string `json:"targetRevision"`
+		} `json:"source"`
+	} `json:"spec"`
+	Status struct {
+		Sync struct {
+			Status   string `json:"status"`
+			Revision string `json:"revision"`
+		} `json:"sync"`
+		Health struct {
+			Status string `json:"status"`
+		} `json:"health"`
+		Summary struct {
+			Images []string `json:"images"`
+		} `json:"summary"`
+	} `json:"status"`
+}
+
+// argocdCache holds the applications last read from ArgoCD
+var argocdCache struct {
+	sync.Mutex
+	apps      []argocdApplication
+	fetchedAt time.Time
+}
+
+// loadArgoCDConfig reads argocd-config.json; ok is false without a URL
+func loadArgoCDConfig() (cfg ArgoCDConfig, ok bool, err error) {
+	if err := readDataFile("argocd-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	if cfg.CacheTTLSeconds <= 0 {
+		cfg.CacheTTLSeconds = 60
+	}
+	return cfg, cfg.URL != "", nil
+}
+
+// argocdApplications returns the applications known to ArgoCD, cached for
+// cacheTTLSeconds unless refresh is set
+func argocdApplications(cfg ArgoCDConfig, refresh bool) ([]argocdApplication, error) {
+	argocdCache.Lock()
+	defer argocdCache.Unlock()
+	if !refresh && argocdCache.apps != nil && time.Since(argocdCache.fetchedAt) < time.Duration(cfg.CacheTTLSeconds)*time.Second {
+		return argocdCache.apps, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, cfg.URL+"/api/v1/applications", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	var list struct {
+		Items []argocdApplication `json:"items"`
+	}
+	if err := doJSON(req, nil, &list); err != nil {
+		return nil, err
+	}
+	if list.Items == nil {
+		list.Items = []argocdApplication{}
+	}
+	argocdCache.apps, argocdCache.fetchedAt = list.Items, time.Now()
+	return list.Items, nil
+}
+
+// matchesSelector reports whether labels satisfy a k=v,k2=v2 selector
+func matchesSelector(labels map[string]string, selector string) bool {
+	for _, term := range strings.Split(selector, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(term), "=")
+		if k == "" || labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// imageTag returns the tag of an image reference, empty without one
+func imageTag(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// deployedFromArgoCD summarizes an application
+func deployedFromArgoCD(app argocdApplication) deployedVersion {
+	v := deployedVersion{Source: "argocd", Name: app.Metadata.Name, Revision: app.Status.Sync.Revision,
+		SyncStatus: app.Status.Sync.Status, Health: app.Status.Health.Status, Images: app.Status.Summary.Images}
+	for _, image := range v.Images {
+		if v.Version = imageTag(image); v.Version != "" {
+			break
+		}
+	}
+	if v.Version == "" && app.Spec.Source != nil {
+		v.Version = app.Spec.Source.TargetRevision
+	}
+	return v
+}
+
+// plannedVersions returns the version of each environment's latest
+// completed release up to today
+func plannedVersions(releases ReleasesData) map[string]string {
+	planned := map[string]string{}
+	todayStr := today().Format(dateLayout)
+	for env, entries := range releases {
+		latest := ""
+		for _, e := range entries {
+			if completedStatuses[e.Status] && e.Date <= todayStr && e.Date > latest {
+				if v := releaseVersion(e); v != "" {
+					latest, planned[env] = e.Date, v
+				}
+			}
+		}
+	}
+	return planned
+}
+
+// Handle the versions ArgoCD has deployed on each configured environment,
+// with the version planned to be there; ?refresh=true bypasses the cache
+func handleArgoCDVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadArgoCDConfig()
+	if err != nil {
+		http.Error(w, "Invalid ArgoCD config", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "ArgoCD is not configured", http.StatusNotFound)
+		return
+	}
+	apps, err := argocdApplications(cfg, r.URL.Query().Get("refresh") == "true")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading ArgoCD applications: %v", err), http.StatusBadGateway)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	planned := plannedVersions(releases)
+
+	result := map[string]environmentVersions{}
+	for env, sel := range cfg.Environments {
+		versions := environmentVersions{Planned: planned[env], Applications: []deployedVersion{}}
+		for _, app := range apps {
+			if len(sel.Applications) > 0 && anyOf(sel.Applications, app.Metadata.Name) ||
+				sel.Selector != "" && matchesSelector(app.Metadata.Labels, sel.Selector) {
+				versions.Applications = append(versions.Applications, deployedFromArgoCD(app))
+			}
+		}
+		sort.Slice(versions.Applications, func(i, j int) bool { return versions.Applications[i].Name < versions.Applications[j].Name })
+		result[env] = versions
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
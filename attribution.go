@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// modification tells who saved a version of a data file, and when
+type modification struct {
+	By string `json:"by,omitempty"` // user, "apikey:<name>", or a job such as "sync:jira"
+	At string `json:"at"`
+}
+
+// modificationsFile is modifications.json, maintained by the server: the
+// last change of every data file and the change each backup holds
+type modificationsFile struct {
+	Files   map[string]modification `json:"files"`
+	Backups map[string]modification `json:"backups"`
+}
+
+// loadModifications reads modifications.json
+func loadModifications() modificationsFile {
+	var m modificationsFile
+	if err := readDataFile("modifications.json", &m); err != nil {
+		logServer.Error("Error reading modifications.json", "err", err)
+	}
+	if m.Files == nil {
+		m.Files = map[string]modification{}
+	}
+	if m.Backups == nil {
+		m.Backups = map[string]modification{}
+	}
+	return m
+}
+
+// modifierName is how a change's author is shown, also when there is none
+func modifierName(by string) string {
+	if by == "" {
+		return "anonymous"
+	}
+	return by
+}
+
+// recordModification notes who saved a data file; the change it replaced
+// goes with its backup, when one was made. Called with fileMu held.
+func recordModification(filename, backupFilename, by string) {
+	m := loadModifications()
+	if previous, ok := m.Files[filename]; ok && backupFilename != "" {
+		m.Backups[backupFilename] = previous
+	}
+	m.Files[filename] = modification{By: by, At: time.Now().UTC().Format(time.RFC3339)}
+	for name := range m.Backups {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			delete(m.Backups, name)
+		}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dataDir, "modifications.json"), data, 0644)
+	}
+	if err != nil {
+		logServer.Warn("Could not record the change of a data file", "file", filename, "err", err)
+	}
+}
+
+// backupModification returns who saved the version a backup holds
+func backupModification(backupFilename string) (modification, bool) {
+	m, ok := loadModifications().Backups[backupFilename]
+	return m, ok
+}
+
+// setModifiedHeaders tells who last changed a data file: X-Last-Modified-By
+// and Last-Modified, when the server saved it
+func setModifiedHeaders(w http.ResponseWriter, filePath string) {
+	m, ok := loadModifications().Files[filepath.Base(filePath)]
+	if !ok {
+		return
+	}
+	w.Header().Set("X-Last-Modified-By", modifierName(m.By))
+	if at, err := time.Parse(time.RFC3339, m.At); err == nil {
+		w.Header().Set("Last-Modified", at.UTC().Format(http.TimeFormat))
+	}
+}
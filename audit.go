@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// auditDir holds the audit log, apart from the data files and their backups
+// so restoring or editing those can't touch it
+const auditDir = "./audit"
+
+// defaultAuditRetentionDays is how long the audit log is kept without
+// retentionDays in audit-config.json
+const defaultAuditRetentionDays = 730
+
+// AuditConfig is audit-config.json
+type AuditConfig struct {
+	// RetentionDays is how long entries are kept; whole months are removed
+	// once their last day is older
+	RetentionDays int `json:"retentionDays,omitempty"`
+
+	// Forward sends the entries on to a syslog server or SIEM
+	Forward ForwardConfig `json:"forward"`
+}
+
+// Audit actions
+const (
+	auditCreate  = "create"
+	auditUpdate  = "update"
+	auditDelete  = "delete"
+	auditRestore = "restore"
+	auditUndo    = "undo"
+	auditRedo    = "redo"
+	auditPrune   = "prune" // months removed by the retention policy
+)
+
+// auditEntry is a line of the audit log. Entries are chained: Hash covers
+// the entry and the previous entry's hash, so changing, removing or
+// reordering entries breaks the chain from there on, see verifyAuditLog.
+type auditEntry struct {
+	Seq    int64  `json:"seq"`
+	Time   string `json:"time"`
+	User   string `json:"user,omitempty"` // as in modification.By
+	Action string `json:"action"`
+	File   string `json:"file"`
+	Record string `json:"record,omitempty"` // e.g. the user account changed
+	Before string `json:"before,omitempty"` // checksum of the previous content
+	After  string `json:"after,omitempty"`  // checksum of the new content
+	Detail string `json:"detail,omitempty"`
+	Prev   string `json:"prev"`
+	Hash   string `json:"hash"`
+}
+
+// auditLog is the tail of the chain, read from disk on first use and again
+// once another instance sharing the directory appended to the log
+var auditLog struct {
+	sync.Mutex
+	loaded bool
+	seq    int64
+	hash   string
+	file   string
+	stamp  fileStamp
+}
+
+// auditFiles lists the monthly audit files, oldest first
+func auditFiles() ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(auditDir, "audit-*.jsonl"))
+	sort.Strings(names)
+	return names, err
+}
+
+// hashAuditEntry computes an entry's chained hash
+func hashAuditEntry(e auditEntry) string {
+	e.Hash = ""
+	b, _ := json.Marshal(e)
+	sum := sha256.Sum256(append([]byte(e.Prev), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+// readAuditFile decodes the entries of an audit file
+func readAuditFile(path string, fn func(e auditEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("%s:%d: %w", filepath.Base(path), line, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// loadAuditTailLocked finds the last entry to chain onto, unless the last
+// file is as this instance left it; auditLog must be locked
+func loadAuditTailLocked() error {
+	files, err := auditFiles()
+	if err != nil {
+		return err
+	}
+	last := ""
+	if len(files) > 0 {
+		last = files[len(files)-1]
+	}
+	stamp := statFile(last)
+	if auditLog.loaded && (last == "" || last == auditLog.file && stamp.equal(auditLog.stamp)) {
+		return nil
+	}
+	if last != "" {
+		err := readAuditFile(last, func(e auditEntry) error {
+			auditLog.seq, auditLog.hash = e.Seq, e.Hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	auditLog.loaded, auditLog.file, auditLog.stamp = true, last, stamp
+	return nil
+}
+
+// checksum is the checksum the audit log keeps of content, as its ETag
+func checksum(content []byte) string {
+	if content == nil {
+		return ""
+	}
+	return strings.Trim(computeETag(content), `"`)
+}
+
+// audit appends an entry to the audit log and returns it as written.
+// Failures are logged rather than failing the change, which has already
+// been made; the entry returned then has no Seq. Instances sharing the
+// directory take turns through the audit lease.
+func audit(e auditEntry) auditEntry {
+	release, err := holdLease(context.Background(), "audit")
+	if err != nil {
+		logAudit.Error("Could not write the audit log", "err", err)
+		return auditEntry{}
+	}
+	defer release()
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if err := loadAuditTailLocked(); err != nil {
+		logAudit.Error("Could not write the audit log", "err", err)
+		return auditEntry{}
+	}
+	now := time.Now().UTC()
+	e.Seq, e.Time, e.Prev = auditLog.seq+1, now.Format(time.RFC3339Nano), auditLog.hash
+	e.Hash = hashAuditEntry(e)
+	line, _ := json.Marshal(e)
+
+	if err := os.MkdirAll(auditDir, 0700); err != nil {
+		logAudit.Error("Could not write the audit log", "err", err)
+		return auditEntry{}
+	}
+	path := filepath.Join(auditDir, "audit-"+now.Format("2006-01")+".jsonl")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		logAudit.Error("Could not write the audit log", "err", err)
+		return auditEntry{}
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		logAudit.Error("Could not write the audit log", "err", err)
+		return auditEntry{}
+	}
+	auditLog.seq, auditLog.hash = e.Seq, e.Hash
+	auditLog.file, auditLog.stamp = path, statFile(path)
+	forwardAudit(e)
+	return e
+}
+
+// auditWrite records a change of a file from before to after content; nil
+// before is a create, nil after a delete
+func auditWrite(by, action, file, record string, before, after []byte) auditEntry {
+	if action == "" {
+		action = auditUpdate
+		if before == nil {
+			action = auditCreate
+		}
+	}
+	return audit(auditEntry{User: by, Action: action, File: file, Record: record, Before: checksum(before), After: checksum(after)})
+}
+
+// auditVerification is the response of GET /api/audit/verify
+type auditVerification struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	First   int64  `json:"first,omitempty"` // earliest kept entry
+	Last    int64  `json:"last,omitempty"`
+	Broken  int64  `json:"broken,omitempty"` // first entry that doesn't chain
+	Error   string `json:"error,omitempty"`
+}
+
+// verifyAuditLog checks the chain of the kept entries. The oldest kept entry
+// is trusted to start it, as months before it were pruned.
+func verifyAuditLog() auditVerification {
+	var v auditVerification
+	files, err := auditFiles()
+	if err != nil {
+		v.Error = err.Error()
+		return v
+	}
+	prev := ""
+	for _, path := range files {
+		err := readAuditFile(path, func(e auditEntry) error {
+			if v.Entries > 0 && (e.Prev != prev || e.Seq != v.Last+1) || hashAuditEntry(e) != e.Hash {
+				v.Broken = e.Seq
+				return fmt.Errorf("entry %d does not chain", e.Seq)
+			}
+			if v.Entries == 0 {
+				v.First = e.Seq
+			}
+			v.Entries++
+			v.Last, prev = e.Seq, e.Hash
+			return nil
+		})
+		if err != nil {
+			v.Error = err.Error()
+			return v
+		}
+	}
+	v.Valid = true
+	return v
+}
+
+// pruneAuditLog removes the months whose last day is before the retention
+// period, recording so in the log
+func pruneAuditLog(now time.Time) error {
+	var cfg AuditConfig
+	if err := readDataFile("audit-config.json", &cfg); err != nil {
+		return err
+	}
+	days := cfg.RetentionDays
+	if days <= 0 {
+		days = defaultAuditRetentionDays
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	files, err := auditFiles()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		month, err := time.Parse("2006-01", strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "audit-"), ".jsonl"))
+		if err != nil || !month.AddDate(0, 1, 0).Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		audit(auditEntry{User: "retention", Action: auditPrune, File: filepath.Base(path),
+			Detail: fmt.Sprintf("older than %d days", days)})
+	}
+	return nil
+}
+
+// runAuditRetention prunes the audit log daily
+func runAuditRetention() {
+	for {
+		if err := pruneAuditLog(time.Now()); err != nil {
+			logAudit.Error("Audit retention failed", "err", err)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// Handle checking the audit log's hash chain
+func handleAuditVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	auditLog.Lock()
+	v := verifyAuditLog()
+	if v.Valid && auditLog.loaded && v.Last < auditLog.seq {
+		// Entries written since the server started are gone
+		v.Valid, v.Error = false, fmt.Sprintf("log ends at entry %d, expected %d", v.Last, auditLog.seq)
+	}
+	auditLog.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Page sizes of GET /api/audit
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditQuery selects audit entries; empty fields match all
+type auditQuery struct {
+	User     string
+	File     string
+	Action   string
+	From, To time.Time // To is exclusive
+}
+
+// matches reports whether an entry is selected; users and files match
+// regardless of case
+func (q auditQuery) matches(e auditEntry) bool {
+	if q.User != "" && !strings.EqualFold(e.User, q.User) ||
+		q.File != "" && !strings.EqualFold(e.File, q.File) ||
+		q.Action != "" && e.Action != q.Action {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339Nano, e.Time)
+	if err != nil {
+		return false
+	}
+	return (q.From.IsZero() || !t.Before(q.From)) && (q.To.IsZero() || t.Before(q.To))
+}
+
+// queryAuditLog returns the selected entries, oldest first, skipping the
+// months outside the query
+func queryAuditLog(q auditQuery) ([]auditEntry, error) {
+	files, err := auditFiles()
+	if err != nil {
+		return nil, err
+	}
+	entries := []auditEntry{}
+	for _, path := range files {
+		month, err := time.Parse("2006-01", strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "audit-"), ".jsonl"))
+		if err == nil && (!q.From.IsZero() && month.AddDate(0, 1, 0).Before(q.From) || !q.To.IsZero() && !month.Before(q.To)) {
+			continue
+		}
+		err = readAuditFile(path, func(e auditEntry) error {
+			if q.matches(e) {
+				entries = append(entries, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// auditPage is the JSON response of GET /api/audit
+type auditPage struct {
+	Entries []auditEntry `json:"entries"`
+	Total   int          `json:"total"`
+	Offset  int          `json:"offset"`
+	Limit   int          `json:"limit"`
+}
+
+// Handle querying the audit log, for admins: entries of ?user=, ?file= and
+// ?action= from ?from= to ?to= (dates, inclusive), a page of ?limit= from
+// ?offset= as JSON, or all of them as ?format=csv
+func handleAuditQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, _, role := requestIdentity(r); !roleAllows(role, "admin") {
+		http.Error(w, "Only admins can read the audit log", http.StatusForbidden)
+		return
+	}
+	query := r.URL.Query()
+	q := auditQuery{User: query.Get("user"), File: query.Get("file"), Action: query.Get("action")}
+	from, ok := parseDateParam(r, "from", time.Time{})
+	if !ok {
+		http.Error(w, "Invalid 'from' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	to, ok := parseDateParam(r, "to", time.Time{})
+	if !ok {
+		http.Error(w, "Invalid 'to' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	q.From = from
+	if !to.IsZero() {
+		q.To = to.AddDate(0, 0, 1)
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "Invalid 'format', expected json or csv", http.StatusBadRequest)
+		return
+	}
+
+	// Exports are whole unless a page is asked for
+	limit, offset := defaultAuditLimit, 0
+	if format == "csv" {
+		limit = 0
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAuditLimit {
+			http.Error(w, fmt.Sprintf("Invalid 'limit', expected 1 to %d", maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'offset'", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	entries, err := queryAuditLog(q)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading the audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	total := len(entries)
+	entries = entries[min(offset, total):]
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "audit-"+time.Now().Format(dateLayout)+".csv"))
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"seq", "time", "user", "action", "file", "record", "before", "after", "detail", "hash"})
+		for _, e := range entries {
+			cw.Write([]string{strconv.FormatInt(e.Seq, 10), e.Time, modifierName(e.User), e.Action, e.File, e.Record, e.Before, e.After, e.Detail, e.Hash})
+		}
+		cw.Flush()
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(auditPage{Entries: entries, Total: total, Offset: offset, Limit: limit})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Base risk scores out of 10 of the risk levels, see cabRiskScore
+var cabRiskBase = map[string]int{"critical": 8, "high": 6, "medium": 4, "low": 2}
+
+// cabItem is a release on the CAB agenda
+type cabItem struct {
+	ID              string   `json:"id"`
+	Environment     string   `json:"environment"`
+	EnvironmentName string   `json:"environmentName"`
+	Date            string   `json:"date"`
+	Name            string   `json:"name"`
+	Status          string   `json:"status"`
+	Approved        bool     `json:"approved"` // in an approved status, see needsApproval
+	Window          string   `json:"window,omitempty"`
+	Risk            string   `json:"risk,omitempty"` // the release's, else the environment tier
+	RiskScore       int      `json:"riskScore"`      // 1-10
+	RiskFactors     []string `json:"riskFactors,omitempty"`
+	ChangeRequest   string   `json:"changeRequest,omitempty"`
+	ChangeApproval  string   `json:"changeApproval,omitempty"`
+	Tickets         []string `json:"tickets,omitempty"`
+	ReleaseManager  string   `json:"releaseManager,omitempty"` // display names from the team roster
+	Deployers       []string `json:"deployers,omitempty"`
+	DependsOn       string   `json:"dependsOn,omitempty"`
+	Note            string   `json:"note,omitempty"`
+}
+
+// cabAgenda is the response of GET /api/cab/agenda
+type cabAgenda struct {
+	From  string    `json:"from"` // Monday of the week
+	To    string    `json:"to"`
+	Items []cabItem `json:"items"`
+}
+
+// cabRiskScore scores a release from 1 to 10: its risk level, else 4, plus
+// a point for each thing that makes it riskier, which are returned too
+func cabRiskScore(e ReleaseEntry, risk string, failedRecently bool) (int, []string) {
+	score, ok := cabRiskBase[risk]
+	if !ok {
+		score = 4
+	}
+	var factors []string
+	if e.ChangeRequest == "" {
+		factors = append(factors, "no change request")
+	} else if !strings.EqualFold(e.ChangeApproval, "approved") {
+		factors = append(factors, "change not approved")
+	}
+	if n := len(e.linkedTickets()); n > 10 {
+		factors = append(factors, fmt.Sprintf("%d tickets", n))
+	}
+	if e.DependsOn != "" {
+		factors = append(factors, "depends on "+e.DependsOn)
+	}
+	if open := e.openItems(); len(open) > 0 {
+		factors = append(factors, fmt.Sprintf("open checklist items (%d)", len(open)))
+	}
+	if failedRecently {
+		factors = append(factors, "recent failed change in the environment")
+	}
+	score += len(factors)
+	if score > 10 {
+		score = 10
+	}
+	return score, factors
+}
+
+// buildCABAgenda lists the pending and approved releases of the week
+// starting on monday
+func buildCABAgenda(monday time.Time) (cabAgenda, error) {
+	sunday := monday.AddDate(0, 0, 6)
+	agenda := cabAgenda{From: monday.Format(dateLayout), To: sunday.Format(dateLayout), Items: []cabItem{}}
+	releases, err := loadReleases()
+	if err != nil {
+		return agenda, err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return agenda, err
+	}
+	team, err := loadTeam()
+	if err != nil {
+		return agenda, err
+	}
+	name := func(id string) string {
+		if p, ok := team.person(id); ok && p.DisplayName != "" {
+			return p.DisplayName
+		}
+		return id
+	}
+
+	// Environments with a change that failed in the 90 days before the week
+	failedSince := monday.AddDate(0, 0, -90)
+	failed := map[string]bool{}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if completedStatuses[e.Status] && inDateRange(e.Date, failedSince, monday.AddDate(0, 0, -1)) &&
+				(len(e.Incidents) > 0 || e.Outcome != nil && e.Outcome.Result == "rolled-back") {
+				failed[env] = true
+			}
+		}
+	}
+
+	for env, entries := range releases {
+		for _, e := range entries {
+			if e.Status == "None" || completedStatuses[e.Status] || !inDateRange(e.Date, monday, sunday) {
+				continue
+			}
+			event := newReleaseEvent("", env, e, envs)
+			item := cabItem{
+				ID: event.ID, Environment: env, EnvironmentName: event.EnvironmentName, Date: e.Date,
+				Name: event.Name, Status: e.Status, Approved: !needsApproval(e.Status), Window: event.Window,
+				Risk: event.Risk, ChangeRequest: e.ChangeRequest, ChangeApproval: e.ChangeApproval,
+				Tickets: e.linkedTickets(), DependsOn: e.DependsOn, Note: e.Note,
+			}
+			item.RiskScore, item.RiskFactors = cabRiskScore(e, event.Risk, failed[env])
+			if e.ReleaseManager != "" {
+				item.ReleaseManager = name(e.ReleaseManager)
+			}
+			for _, d := range e.Deployers {
+				item.Deployers = append(item.Deployers, name(d))
+			}
+			agenda.Items = append(agenda.Items, item)
+		}
+	}
+	sort.Slice(agenda.Items, func(i, j int) bool {
+		a, b := agenda.Items[i], agenda.Items[j]
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.RiskScore != b.RiskScore {
+			return a.RiskScore > b.RiskScore
+		}
+		return a.Environment < b.Environment
+	})
+	return agenda, nil
+}
+
+// title is the heading of the agenda documents
+func (a cabAgenda) title() string {
+	return fmt.Sprintf("CAB agenda: %s to %s", a.From, a.To)
+}
+
+// change describes an item's change request and its approval
+func (item cabItem) change() string {
+	if item.ChangeRequest == "" {
+		return ""
+	}
+	if item.ChangeApproval == "" {
+		return item.ChangeRequest
+	}
+	return item.ChangeRequest + " (" + item.ChangeApproval + ")"
+}
+
+// owners lists the release manager and deployers of an item
+func (item cabItem) owners() string {
+	var owners []string
+	if item.ReleaseManager != "" {
+		owners = append(owners, item.ReleaseManager+" (manager)")
+	}
+	return strings.Join(append(owners, item.Deployers...), ", ")
+}
+
+// risk describes an item's risk score, level and factors
+func (item cabItem) risk() string {
+	s := fmt.Sprintf("%d/10", item.RiskScore)
+	if item.Risk != "" {
+		s += " " + item.Risk
+	}
+	if len(item.RiskFactors) > 0 {
+		s += ": " + strings.Join(item.RiskFactors, ", ")
+	}
+	return s
+}
+
+// markdownCell escapes text for a Markdown table cell
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// markdown renders the agenda as a Markdown table
+func (a cabAgenda) markdown() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s\n\n", a.title())
+	if len(a.Items) == 0 {
+		buf.WriteString("No releases to review.\n")
+		return buf.String()
+	}
+	buf.WriteString("| Date | Environment | Release | Status | Window | Risk | Change | Tickets | Owners |\n")
+	buf.WriteString("|---|---|---|---|---|---|---|---|---|\n")
+	for _, item := range a.Items {
+		cells := []string{item.Date, item.EnvironmentName, item.Name, item.Status, item.Window, item.risk(),
+			item.change(), strings.Join(item.Tickets, ", "), item.owners()}
+		for i, c := range cells {
+			cells[i] = markdownCell(c)
+		}
+		fmt.Fprintf(&buf, "| %s |\n", strings.Join(cells, " | "))
+	}
+	return buf.String()
+}
+
+// html renders the agenda as a standalone page
+func (a cabAgenda) html() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<!DOCTYPE html>\n<html><head><meta charset=\"utf-8\"><title>%s</title>\n", html.EscapeString(a.title()))
+	buf.WriteString("<style>body{font-family:sans-serif}table{border-collapse:collapse}th,td{border:1px solid #ccc;padding:4px 8px;text-align:left;vertical-align:top}</style>\n")
+	fmt.Fprintf(&buf, "</head><body>\n<h1>%s</h1>\n", html.EscapeString(a.title()))
+	if len(a.Items) == 0 {
+		buf.WriteString("<p>No releases to review.</p>\n</body></html>\n")
+		return buf.String()
+	}
+	buf.WriteString("<table>\n<tr><th>Date</th><th>Environment</th><th>Release</th><th>Status</th><th>Window</th><th>Risk</th><th>Change</th><th>Tickets</th><th>Owners</th></tr>\n")
+	for _, item := range a.Items {
+		buf.WriteString("<tr>")
+		for _, c := range []string{item.Date, item.EnvironmentName, item.Name, item.Status, item.Window, item.risk(),
+			item.change(), strings.Join(item.Tickets, ", "), item.owners()} {
+			fmt.Fprintf(&buf, "<td>%s</td>", html.EscapeString(c))
+		}
+		buf.WriteString("</tr>\n")
+	}
+	buf.WriteString("</table>\n</body></html>\n")
+	return buf.String()
+}
+
+// lines renders the agenda as text for the PDF, a block per release
+func (a cabAgenda) lines() []string {
+	if len(a.Items) == 0 {
+		return []string{"No releases to review."}
+	}
+	var lines []string
+	for _, item := range a.Items {
+		head := fmt.Sprintf("%s  %s  %s  [%s]", item.Date, item.EnvironmentName, item.Name, item.Status)
+		if item.Window != "" {
+			head += "  " + item.Window
+		}
+		lines = append(lines, head, "    Risk: "+item.risk())
+		if c := item.change(); c != "" {
+			lines = append(lines, "    Change: "+c)
+		}
+		if len(item.Tickets) > 0 {
+			lines = append(lines, "    Tickets: "+strings.Join(item.Tickets, ", "))
+		}
+		if o := item.owners(); o != "" {
+			lines = append(lines, "    Owners: "+o)
+		}
+		if item.Note != "" {
+			lines = append(lines, "    Note: "+item.Note)
+		}
+		lines = append(lines, "")
+	}
+	return lines
+}
+
+// Handle the Change Advisory Board agenda of the week containing ?week=
+// (a date, a week from today by default): the pending and approved
+// releases with their risk, change requests, tickets and owners, as JSON or
+// ?format=markdown, html or pdf
+func handleCABAgenda(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	day, ok := parseDateParam(r, "week", today().AddDate(0, 0, 7))
+	if !ok {
+		http.Error(w, "Invalid 'week' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "markdown" && format != "html" && format != "pdf" {
+		http.Error(w, "Invalid 'format', expected json, markdown, html or pdf", http.StatusBadRequest)
+		return
+	}
+
+	agenda, err := buildCABAgenda(monday)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building agenda: %v", err), http.StatusInternalServerError)
+		return
+	}
+	filename := "cab-agenda-" + agenda.From
+	switch format {
+	case "markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename+".md"))
+		w.Write([]byte(agenda.markdown()))
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(agenda.html()))
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".pdf"))
+		writeTextPDF(w, agenda.title(), agenda.lines())
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agenda)
+	}
+}
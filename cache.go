@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig is cache-config.json: how long browsers and proxies may keep
+// responses, set in their Cache-Control headers
+type CacheConfig struct {
+	// DataMaxAge is how many seconds a data file GET, such as
+	// /api/releases.json, may be reused without asking again, default 5; 0
+	// revalidates every time
+	DataMaxAge *int `json:"dataMaxAge,omitempty"`
+	// StaticMaxAge is the same for the static files, default 0
+	StaticMaxAge int `json:"staticMaxAge,omitempty"`
+	// HashedMaxAge is for static files with a content hash in their name,
+	// such as app.3f9a2c1b.js, which never change; default a year
+	HashedMaxAge int `json:"hashedMaxAge,omitempty"`
+	// NoStore are more path prefixes never stored, beside cacheNoStorePaths
+	NoStore []string `json:"noStore,omitempty"`
+}
+
+// cacheNoStorePaths are never stored: backups, admin and account data
+var cacheNoStorePaths = []string{
+	"/api/backup", "/api/admin/", "/api/users", "/api/api-keys",
+	"/api/me", "/api/setup", "/api/login", "/api/logout", "/api/jira-config", "/api/audit", "/api/replication",
+	"/api/cloud-export", "/debug/",
+}
+
+// hashedAssetPattern matches static file names carrying a content hash
+var hashedAssetPattern = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[a-z0-9]+$`)
+
+// cacheConfigCache holds cache-config.json, reread every minute
+var cacheConfigCache struct {
+	sync.Mutex
+	config CacheConfig
+	loaded time.Time
+}
+
+// loadCacheConfig returns cache-config.json with its defaults
+func loadCacheConfig() CacheConfig {
+	cacheConfigCache.Lock()
+	defer cacheConfigCache.Unlock()
+	if time.Since(cacheConfigCache.loaded) > time.Minute {
+		var cfg CacheConfig
+		readDataFile("cache-config.json", &cfg)
+		if cfg.DataMaxAge == nil || *cfg.DataMaxAge < 0 {
+			dataMaxAge := 5
+			cfg.DataMaxAge = &dataMaxAge
+		}
+		if cfg.HashedMaxAge <= 0 {
+			cfg.HashedMaxAge = 365 * 24 * 60 * 60
+		}
+		cacheConfigCache.config, cacheConfigCache.loaded = cfg, time.Now()
+	}
+	return cacheConfigCache.config
+}
+
+// cachePolicy returns the Cache-Control of a GET, empty to leave it unset
+func (c CacheConfig) cachePolicy(p string) string {
+	for _, prefix := range append(cacheNoStorePaths, c.NoStore...) {
+		if strings.HasPrefix(p, prefix) {
+			return "no-store"
+		}
+	}
+	switch {
+	case strings.HasPrefix(p, "/api/data/") || strings.HasPrefix(p, "/api/") && strings.HasSuffix(p, ".json"):
+		if *c.DataMaxAge == 0 {
+			return "private, no-cache"
+		}
+		return fmt.Sprintf("private, max-age=%d", *c.DataMaxAge)
+	case strings.HasPrefix(p, "/api/"):
+		// Feeds, reports and searches change with every save
+		return "private, no-cache"
+	case strings.HasPrefix(p, "/dav/") || strings.HasPrefix(p, "/w/"):
+		return ""
+	case hashedAssetPattern.MatchString(path.Base(p)):
+		return fmt.Sprintf("public, max-age=%d, immutable", c.HashedMaxAge)
+	case c.StaticMaxAge > 0:
+		return fmt.Sprintf("public, max-age=%d", c.StaticMaxAge)
+	}
+	return "no-cache"
+}
+
+// cacheControl sets the Cache-Control of GETs as cache-config.json says;
+// handlers may set their own. API responses depend on who asks, so they
+// vary with the credentials.
+func cacheControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			if policy := loadCacheConfig().cachePolicy(r.URL.Path); policy != "" {
+				w.Header().Set("Cache-Control", policy)
+			}
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				w.Header().Add("Vary", "Authorization")
+				w.Header().Add("Vary", "Cookie")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
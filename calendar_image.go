@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Geometry of the rendered calendar grid
+const (
+	svgLabelWidth = 120
+	svgCellWidth  = 28
+	svgRowHeight  = 24
+	svgTitleSize  = 30
+	svgMonthGap   = 20
+)
+
+// Colors for cells without a release
+const (
+	svgWeekendColor = "#d9d9d9"
+	svgHolidayColor = "#f4cccc"
+	svgEmptyColor   = "#ffffff"
+	svgGridColor    = "#999999"
+)
+
+// renderMonthSVG draws one month grid (environments as rows, days as
+// columns) starting at vertical offset y and returns its height
+func renderMonthSVG(buf *bytes.Buffer, y int, year int, month time.Month, envs EnvironmentsData, releases ReleasesData, holidays map[string]string) int {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+	days := first.AddDate(0, 1, -1).Day()
+
+	fmt.Fprintf(buf, `<text x="0" y="%d" font-size="16" font-weight="bold">%s</text>`+"\n", y+20, first.Format("January 2006"))
+	y += svgTitleSize
+
+	// Header row with day numbers
+	for d := 1; d <= days; d++ {
+		x := svgLabelWidth + (d-1)*svgCellWidth
+		fmt.Fprintf(buf, `<text x="%d" y="%d" font-size="11" text-anchor="middle">%d</text>`+"\n", x+svgCellWidth/2, y+16, d)
+	}
+	y += svgRowHeight
+
+	for _, env := range envs.Environments {
+		if !env.Visible {
+			continue
+		}
+		fmt.Fprintf(buf, `<text x="4" y="%d" font-size="12">%s</text>`+"\n", y+16, html.EscapeString(env.DisplayName))
+
+		byDate := map[string]ReleaseEntry{}
+		for _, e := range releases[env.Name] {
+			byDate[e.Date] = e
+		}
+
+		for d := 1; d <= days; d++ {
+			day := time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+			iso := day.Format(dateLayout)
+			x := svgLabelWidth + (d-1)*svgCellWidth
+
+			fill, text, title := svgEmptyColor, "#000000", ""
+			if day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+				fill = svgWeekendColor
+			}
+			if name, ok := holidays[iso]; ok {
+				fill, title = svgHolidayColor, name
+			}
+			if e, ok := byDate[iso]; ok {
+				if c, ok := envs.ReleaseStatuses[e.Status]; ok {
+					fill, text = c.Background, c.Foreground
+				}
+				title = e.Status
+				if e.ReleaseName != "" {
+					title += " " + e.ReleaseName
+				}
+			}
+
+			fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" stroke="%s">`, x, y, svgCellWidth, svgRowHeight, html.EscapeString(fill), svgGridColor)
+			if title != "" {
+				fmt.Fprintf(buf, `<title>%s</title>`, html.EscapeString(title))
+			}
+			buf.WriteString("</rect>\n")
+			if e, ok := byDate[iso]; ok && e.Status != "" {
+				fmt.Fprintf(buf, `<text x="%d" y="%d" font-size="10" text-anchor="middle" fill="%s">%s</text>`+"\n",
+					x+svgCellWidth/2, y+16, html.EscapeString(text), html.EscapeString(string([]rune(e.Status)[:1])))
+			}
+		}
+		y += svgRowHeight
+	}
+
+	return svgTitleSize + svgRowHeight*(1+visibleEnvironmentCount(envs))
+}
+
+// visibleEnvironmentCount returns how many environments are shown on the calendar
+func visibleEnvironmentCount(envs EnvironmentsData) int {
+	n := 0
+	for _, env := range envs.Environments {
+		if env.Visible {
+			n++
+		}
+	}
+	return n
+}
+
+// renderCalendarSVG renders the given consecutive months as a single SVG
+// document, holidays named in the first of langs they have a name in
+func renderCalendarSVG(year int, month time.Month, months int, langs []string) ([]byte, error) {
+	releases, err := loadReleases()
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return nil, err
+	}
+	holidays = localizeHolidays(holidays, langs)
+	envs, err := loadEnvironments()
+	if err != nil {
+		return nil, err
+	}
+
+	holidayNames := map[string]string{}
+	for _, h := range holidays.Holidays {
+		holidayNames[h.Date] = h.Name
+	}
+
+	var body bytes.Buffer
+	height := 0
+	for i := 0; i < months; i++ {
+		m := time.Date(year, month+time.Month(i), 1, 0, 0, 0, 0, time.Local)
+		height += renderMonthSVG(&body, height, m.Year(), m.Month(), envs, releases, holidayNames) + svgMonthGap
+	}
+	width := svgLabelWidth + 31*svgCellWidth
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif">`+"\n", width, height, width, height)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/>`+"\n", width, height)
+	buf.Write(body.Bytes())
+	buf.WriteString("</svg>\n")
+	return buf.Bytes(), nil
+}
+
+// Handle server-rendered calendar image. Query: year, month (1-12) or
+// quarter (1-4); defaults to the current month.
+func handleCalendarImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	year, month, months := now.Year(), now.Month(), 1
+
+	q := r.URL.Query()
+	if v := q.Get("year"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid 'year' parameter", http.StatusBadRequest)
+			return
+		}
+		year = n
+	}
+	if v := q.Get("quarter"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 4 {
+			http.Error(w, "Invalid 'quarter' parameter, expected 1-4", http.StatusBadRequest)
+			return
+		}
+		month, months = time.Month((n-1)*3+1), 3
+	} else if v := q.Get("month"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 12 {
+			http.Error(w, "Invalid 'month' parameter, expected 1-12", http.StatusBadRequest)
+			return
+		}
+		month = time.Month(n)
+	}
+
+	svg, err := renderCalendarSVG(year, month, months, requestLanguages(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error rendering calendar: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Write(svg)
+}
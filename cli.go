@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// commands are the subcommands of the binary besides serve, for admin work
+// offline and from cron jobs
+var commands = map[string]struct {
+	usage string
+	run   func(args []string) error
+}{
+	"backup":   {"backup [--max-backups N] --all | <file>...", runBackup},
+	"restore":  {"restore <file> <timestamp>", runRestore},
+	"validate": {"validate [<data directory>]", runValidate},
+	"export":   {"export [--format json|csv] [--output <file>]", runExport},
+}
+
+// errUsage fails a command given wrong arguments
+var errUsage = fmt.Errorf("invalid arguments")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "serve" {
+		serve()
+		return
+	}
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		if name != "help" && name != "-h" && name != "--help" {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", name)
+		}
+		printUsage()
+		os.Exit(2)
+	}
+	// Restores and validation run the validator plugins as saves do, and
+	// take the lock of servers sharing the data directory
+	loadPlugins()
+	if err := loadCluster(); err != nil {
+		fmt.Fprintf(os.Stderr, "relplanner %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if err == errUsage {
+			fmt.Fprintf(os.Stderr, "Usage: relplanner %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "relplanner %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// printUsage lists the commands
+func printUsage() {
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(os.Stderr, "Usage: relplanner [command], in the directory holding data/")
+	fmt.Fprintln(os.Stderr, "  serve (default)")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+}
+
+// cliUser is who the audit log and modification records name for changes
+// made with the commands
+func cliUser() string {
+	if user := os.Getenv("USER"); user != "" {
+		return "cli:" + user
+	}
+	return "cli"
+}
+
+// serverRunning reports whether a server serves this directory, so commands
+// leave recording their changes to it: its watcher takes them in, and the
+// audit log's chain is only appended to by one process
+func serverRunning() bool {
+	conn, err := net.DialTimeout("unix", workspaceSocket, 500*time.Millisecond)
+	if err != nil {
+		conn, err = net.DialTimeout("tcp", fmt.Sprintf("localhost:%d", port), 500*time.Millisecond)
+	}
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// dataFileName turns "releases" or "releases.json" into "releases.json",
+// failing for anything but a file of the data directory
+func dataFileName(arg string) (string, error) {
+	name := arg
+	if !strings.HasSuffix(name, ".json") {
+		name += ".json"
+	}
+	if filepath.Base(name) != name {
+		return "", fmt.Errorf("%s is not a data file", arg)
+	}
+	return name, nil
+}
+
+// runBackup backs up data files as saves do, keeping the newest backups
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	all := fs.Bool("all", false, "Back up every data file")
+	maxBackups := fs.Int("max-backups", defaultMaxBackups, "Backups to keep of each file")
+	if err := fs.Parse(args); err != nil || *all == (fs.NArg() > 0) || *maxBackups < 1 {
+		return errUsage
+	}
+	var names []string
+	if *all {
+		paths, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	for _, arg := range fs.Args() {
+		name, err := dataFileName(arg)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+
+	// Servers sharing the data directory don't save or clean up meanwhile
+	release, err := clusterLock(context.Background())
+	if err != nil {
+		return err
+	}
+	defer release()
+	timestamp := time.Now().Format("20060102-150405")
+	for _, name := range names {
+		path := filepath.Join(dataDir, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Backups keep the file's permissions, those of the accounts and keys
+		// are readable by the server only
+		backup := fmt.Sprintf("%s.%s.json", strings.TrimSuffix(name, ".json"), timestamp)
+		if err := os.WriteFile(filepath.Join(backupDir, backup), content, info.Mode().Perm()); err != nil {
+			return err
+		}
+		writeChecksum(filepath.Join(backupDir, backup))
+		if err := cleanupOldBackups(name, *maxBackups); err != nil {
+			return err
+		}
+		fmt.Println(backup)
+	}
+	return nil
+}
+
+// runRestore restores a data file from its backup of a timestamp, as
+// listed by GET /api/backups, after validating it. The current version is
+// backed up first.
+func runRestore(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	name, err := dataFileName(args[0])
+	if err != nil {
+		return err
+	}
+	backup := fmt.Sprintf("%s.%s.json", strings.TrimSuffix(name, ".json"), strings.TrimSuffix(args[1], ".json"))
+	if filepath.Base(backup) != backup {
+		return fmt.Errorf("invalid timestamp %s", args[1])
+	}
+	content, err := os.ReadFile(filepath.Join(backupDir, backup))
+	if err != nil {
+		return err
+	}
+	if sum, err := os.ReadFile(filepath.Join(backupDir, backup+".sha256")); err == nil && strings.TrimSpace(string(sum)) != fmt.Sprintf("%x", sha256.Sum256(content)) {
+		return fmt.Errorf("%s does not match its checksum", backup)
+	}
+	if err := validateDataFile(name, content); err != nil {
+		return fmt.Errorf("%s: %v", backup, err)
+	}
+	path := filepath.Join(dataDir, name)
+
+	if serverRunning() {
+		// The server's watcher backs up, records and audits the change
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			perm = info.Mode().Perm()
+		}
+		if err := os.WriteFile(path, content, perm); err != nil {
+			return err
+		}
+		fmt.Printf("Restored %s from %s, taken in by the running server\n", name, backup)
+		return nil
+	}
+	var data interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return err
+	}
+	if _, err := writeJSONFileAction(withServerFields(context.Background()), path, data, "", defaultMaxBackups, cliUser(), auditRestore); err != nil {
+		return err
+	}
+	fmt.Printf("Restored %s from %s\n", name, backup)
+	return nil
+}
+
+// runValidate checks the data files of a directory, the server's by
+// default, and their references to each other, failing on any problem, e.g.
+// to verify backups
+func runValidate(args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+	dir := dataDir
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	files, problems, err := validateDataDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problems in %d files", len(problems), files)
+	}
+	fmt.Printf("%d files valid\n", files)
+	return nil
+}
+
+// runExport writes the environments, releases and holidays like the web
+// app's export: one JSON document, or CSV sections
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "json or csv")
+	output := fs.String("output", "", "File to write, standard output by default")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || *format != "json" && *format != "csv" {
+		return errUsage
+	}
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if *format == "json" {
+		doc := map[string]interface{}{"exportDate": time.Now().UTC().Format(time.RFC3339)}
+		for key, name := range map[string]string{"environmentsData": "environments.json", "releasesData": "releases.json", "holidaysData": "holidays.json"} {
+			var v interface{}
+			if err := readDataFile(name, &v); err != nil {
+				return err
+			}
+			doc[key] = v
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		return err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return err
+	}
+	section := func(title string, header []string, rows [][]string) error {
+		fmt.Fprintf(out, "# %s\n", title)
+		w := csv.NewWriter(out)
+		w.Write(header)
+		w.WriteAll(rows)
+		_, err := fmt.Fprintln(out)
+		return err
+	}
+	var rows [][]string
+	for _, e := range envs.Environments {
+		rows = append(rows, []string{e.Name, e.DisplayName, fmt.Sprint(e.Visible)})
+	}
+	if err := section("Environments", []string{"name", "displayName", "visible"}, rows); err != nil {
+		return err
+	}
+	rows = nil
+	names := []string{}
+	for env := range releases {
+		names = append(names, env)
+	}
+	sort.Strings(names)
+	for _, env := range names {
+		for _, r := range releases[env] {
+			rows = append(rows, []string{env, r.Date, r.Status, r.Note})
+		}
+	}
+	if err := section("Releases", []string{"environment", "date", "status", "note"}, rows); err != nil {
+		return err
+	}
+	rows = nil
+	for _, h := range holidays.Holidays {
+		rows = append(rows, []string{h.Date, h.Name})
+	}
+	return section("Holidays", []string{"date", "name"}, rows)
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CloudExportConfig is cloud-export-config.json: an off-box copy of the data
+// uploaded to a cloud drive on a schedule, for teams without object storage
+type CloudExportConfig struct {
+	Provider      string `json:"provider"`                // gdrive, dropbox or onedrive
+	IntervalHours int    `json:"intervalHours,omitempty"` // default 24
+	// Folder is where bundles go: a folder ID on Google Drive, a path on
+	// Dropbox and OneDrive such as /Backups/relplanner
+	Folder string `json:"folder,omitempty"`
+	// An OAuth refresh token, exchanged for an access token at each export,
+	// or a long-lived access token
+	ClientID     string `json:"clientId,omitempty"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	AccessToken  string `json:"accessToken,omitempty"`
+	APIURL       string `json:"apiUrl,omitempty"`   // the provider's API, e.g. a proxy
+	TokenURL     string `json:"tokenUrl,omitempty"` // its OAuth token endpoint
+}
+
+// cloudExportRun is the outcome of an export
+type cloudExportRun struct {
+	Time     string `json:"time"`
+	File     string `json:"file,omitempty"`
+	Files    int    `json:"files,omitempty"` // data files in the bundle
+	Bytes    int    `json:"bytes,omitempty"`
+	Location string `json:"location,omitempty"` // the file's ID or path at the provider
+	Error    string `json:"error,omitempty"`
+}
+
+// cloudExportState is cloud-export.json, the last exports
+type cloudExportState struct {
+	LastRun     *cloudExportRun `json:"lastRun,omitempty"`
+	LastSuccess *cloudExportRun `json:"lastSuccess,omitempty"`
+}
+
+// cloudDrive is a provider bundles can be uploaded to
+type cloudDrive struct {
+	apiURL, tokenURL string
+	// upload stores a bundle in the configured folder, returning where
+	upload func(cfg CloudExportConfig, token, name string, bundle []byte) (string, error)
+}
+
+// cloudDrives are the supported providers by name
+var cloudDrives = map[string]cloudDrive{
+	"gdrive":   {"https://www.googleapis.com", "https://oauth2.googleapis.com/token", uploadGoogleDrive},
+	"dropbox":  {"https://content.dropboxapi.com", "https://api.dropboxapi.com/oauth2/token", uploadDropbox},
+	"onedrive": {"https://graph.microsoft.com", "https://login.microsoftonline.com/common/oauth2/v2.0/token", uploadOneDrive},
+}
+
+// cloudExportClient uploads bundles, which can take a while
+var cloudExportClient = &http.Client{Timeout: 5 * time.Minute}
+
+// cloudExportMu serializes exports
+var cloudExportMu sync.Mutex
+
+// cloudExportRunning tells the status API an export is under way
+var cloudExportRunning atomic.Bool
+
+// loadCloudExportConfig reads cloud-export-config.json; ok is false when the
+// export isn't configured
+func loadCloudExportConfig() (cfg CloudExportConfig, ok bool, err error) {
+	if err := readDataFile("cloud-export-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.Provider == "" {
+		return cfg, false, nil
+	}
+	drive, known := cloudDrives[cfg.Provider]
+	if !known {
+		return cfg, false, fmt.Errorf("unknown provider %q, expected gdrive, dropbox or onedrive", cfg.Provider)
+	}
+	if cfg.IntervalHours <= 0 {
+		cfg.IntervalHours = 24
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = drive.apiURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = drive.tokenURL
+	}
+	return cfg, cfg.RefreshToken != "" || cfg.AccessToken != "", nil
+}
+
+// loadCloudExportState reads cloud-export.json
+func loadCloudExportState() (cloudExportState, error) {
+	var state cloudExportState
+	err := readDataFile("cloud-export.json", &state)
+	return state, err
+}
+
+// save writes cloud-export.json, server-maintained like
+// statuspage-maintenances.json
+func (s cloudExportState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "cloud-export.json"), data, 0644)
+}
+
+// exportBundle zips the data files, leaving out the accounts, keys,
+// preferences and integration configs, which hold credentials
+func exportBundle() ([]byte, int, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	paths, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		return nil, 0, err
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := 0
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if kind := dataFileKind(name); kind == "private" || kind == "config" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		f, err := zw.Create(name)
+		if err != nil {
+			return nil, 0, err
+		}
+		if _, err := f.Write(content); err != nil {
+			return nil, 0, err
+		}
+		files++
+	}
+	if err := zw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), files, nil
+}
+
+// cloudAccessToken returns the token to upload with, from the refresh
+// token when there is one
+func cloudAccessToken(cfg CloudExportConfig) (string, error) {
+	if cfg.RefreshToken == "" {
+		return cfg.AccessToken, nil
+	}
+	form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {cfg.RefreshToken},
+		"client_id": {cfg.ClientID}, "client_secret": {cfg.ClientSecret}}
+	req, err := http.NewRequest(http.MethodPost, cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := doCloudRequest(req, &token); err != nil {
+		return "", fmt.Errorf("refreshing the access token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("refreshing the access token: no token returned")
+	}
+	return token.AccessToken, nil
+}
+
+// doCloudRequest sends a request, decoding the JSON response into out
+func doCloudRequest(req *http.Request, out interface{}) error {
+	resp, err := cloudExportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// uploadGoogleDrive creates the bundle in the folder with a multipart upload
+func uploadGoogleDrive(cfg CloudExportConfig, token, name string, bundle []byte) (string, error) {
+	metadata := map[string]interface{}{"name": name, "mimeType": "application/zip"}
+	if cfg.Folder != "" {
+		metadata["parents"] = []string{cfg.Folder}
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/json; charset=UTF-8"}})
+	json.NewEncoder(part).Encode(metadata)
+	part, _ = mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/zip"}})
+	part.Write(bundle)
+	mw.Close()
+
+	req, err := http.NewRequest(http.MethodPost, cfg.APIURL+"/upload/drive/v3/files?uploadType=multipart", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "multipart/related; boundary="+mw.Boundary())
+	var file struct {
+		ID string `json:"id"`
+	}
+	if err := doCloudRequest(req, &file); err != nil {
+		return "", err
+	}
+	return file.ID, nil
+}
+
+// uploadDropbox stores the bundle at the folder's path
+func uploadDropbox(cfg CloudExportConfig, token, name string, bundle []byte) (string, error) {
+	path := strings.TrimSuffix(cfg.Folder, "/") + "/" + name
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	arg, _ := json.Marshal(map[string]interface{}{"path": path, "mode": "add", "autorename": true})
+	req, err := http.NewRequest(http.MethodPost, cfg.APIURL+"/2/files/upload", bytes.NewReader(bundle))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", string(arg))
+	var file struct {
+		PathDisplay string `json:"path_display"`
+	}
+	if err := doCloudRequest(req, &file); err != nil {
+		return "", err
+	}
+	return file.PathDisplay, nil
+}
+
+// uploadOneDrive puts the bundle at the folder's path of the user's drive
+func uploadOneDrive(cfg CloudExportConfig, token, name string, bundle []byte) (string, error) {
+	path := strings.Trim(cfg.Folder, "/")
+	if path != "" {
+		path += "/"
+	}
+	target := (&url.URL{Path: "/" + path + name}).EscapedPath()
+	req, err := http.NewRequest(http.MethodPut, cfg.APIURL+"/v1.0/me/drive/root:"+target+":/content", bytes.NewReader(bundle))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/zip")
+	var item struct {
+		ID string `json:"id"`
+	}
+	if err := doCloudRequest(req, &item); err != nil {
+		return "", err
+	}
+	return item.ID, nil
+}
+
+// runCloudExportOnce bundles the data and uploads it, recording the outcome
+// in cloud-export.json
+func runCloudExportOnce(cfg CloudExportConfig) cloudExportRun {
+	cloudExportMu.Lock()
+	defer cloudExportMu.Unlock()
+	cloudExportRunning.Store(true)
+	defer cloudExportRunning.Store(false)
+
+	now := time.Now()
+	run := cloudExportRun{Time: now.UTC().Format(time.RFC3339), File: "relplanner-" + now.Format("20060102-150405") + ".zip"}
+	bundle, files, err := exportBundle()
+	if err == nil {
+		run.Files, run.Bytes = files, len(bundle)
+		var token string
+		if token, err = cloudAccessToken(cfg); err == nil {
+			run.Location, err = cloudDrives[cfg.Provider].upload(cfg, token, run.File, bundle)
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+		logCloudExport.Error("Cloud export failed", "provider", cfg.Provider, "err", err)
+	} else {
+		logCloudExport.Info("Exported the data", "provider", cfg.Provider, "file", run.File, "bytes", run.Bytes)
+	}
+
+	state, err := loadCloudExportState()
+	if err != nil {
+		logCloudExport.Warn("Could not read cloud-export.json", "err", err)
+	}
+	state.LastRun = &run
+	if run.Error == "" {
+		state.LastSuccess = &run
+	}
+	if err := state.save(); err != nil {
+		logCloudExport.Error("Could not save cloud-export.json", "err", err)
+	}
+	return run
+}
+
+// nextCloudExport is when the next scheduled export is due: an interval
+// after the last one, now when there was none
+func nextCloudExport(cfg CloudExportConfig, state cloudExportState) time.Time {
+	if state.LastRun == nil {
+		return time.Now()
+	}
+	last, err := time.Parse(time.RFC3339, state.LastRun.Time)
+	if err != nil {
+		return time.Now()
+	}
+	return last.Add(time.Duration(cfg.IntervalHours) * time.Hour)
+}
+
+// runCloudExport exports the data whenever it is due
+func runCloudExport() {
+	for {
+		cfg, ok, err := loadCloudExportConfig()
+		if err != nil {
+			logCloudExport.Error("Invalid cloud-export-config.json", "err", err)
+		}
+		if ok {
+			state, _ := loadCloudExportState()
+			if !nextCloudExport(cfg, state).After(time.Now()) {
+				runCloudExportOnce(cfg)
+			}
+		}
+		time.Sleep(5 * time.Minute)
+	}
+}
+
+// Handle the cloud export: GET its schedule and last exports, for admins;
+// POST exports now
+func handleCloudExport(w http.ResponseWriter, r *http.Request) {
+	if _, _, role := requestIdentity(r); !roleAllows(role, "admin") {
+		http.Error(w, "Only admins can manage the cloud export", http.StatusForbidden)
+		return
+	}
+	cfg, ok, err := loadCloudExportConfig()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading cloud-export-config.json: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		state, err := loadCloudExportState()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading cloud-export.json: %v", err), http.StatusInternalServerError)
+			return
+		}
+		status := map[string]interface{}{
+			"provider":    cfg.Provider,
+			"configured":  ok,
+			"running":     cloudExportRunning.Load(),
+			"lastRun":     state.LastRun,
+			"lastSuccess": state.LastSuccess,
+		}
+		if ok {
+			status["intervalHours"] = cfg.IntervalHours
+			status["nextRun"] = nextCloudExport(cfg, state).UTC().Format(time.RFC3339)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	case http.MethodPost:
+		if !ok {
+			http.Error(w, "The cloud export is not configured", http.StatusConflict)
+			return
+		}
+		run := runCloudExportOnce(cfg)
+		w.Header().Set("Content-Type", "application/json")
+		if run.Error != "" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(run)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
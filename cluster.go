@@ -0,0 +1,541 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClusterConfig is cluster-config.json: for replicas sharing the data
+// directory behind a load balancer, a lock the instances take around saves
+// and backup cleanup, held in a lease file of the shared storage or in Redis.
+// A second lease of the same kind elects the instance running the background
+// jobs.
+type ClusterConfig struct {
+	Lock string `json:"lock"` // file or redis; no lock when empty
+	// LeaseSeconds is how long a lock is held before others may take it, in
+	// case its instance died holding it; default 30
+	LeaseSeconds int `json:"leaseSeconds,omitempty"`
+	// WaitSeconds is how long a save waits for the lock, default 10
+	WaitSeconds int `json:"waitSeconds,omitempty"`
+	// LockFile is the lease file, default .relplanner.lock of the data
+	// directory; the jobs and audit leases are beside it, .jobs and .audit
+	// before the extension
+	LockFile      string `json:"lockFile,omitempty"`
+	RedisAddr     string `json:"redisAddr,omitempty"` // host:port
+	RedisPassword string `json:"redisPassword,omitempty"`
+	RedisDB       int    `json:"redisDB,omitempty"`
+	RedisKey      string `json:"redisKey,omitempty"` // default relplanner:lock; the other leases are <key>:jobs and <key>:audit
+}
+
+// clusterLease is the lease file's content
+type clusterLease struct {
+	Token   string `json:"token"`
+	Host    string `json:"host"`
+	PID     int    `json:"pid"`
+	Expires string `json:"expires"`
+}
+
+// clusterPollInterval is how often a busy lock is tried again
+const clusterPollInterval = 50 * time.Millisecond
+
+// clusterConfig is the lock configured at startup, nil without one
+var clusterConfig *ClusterConfig
+
+// errClusterBusy is a lock another instance held for the whole wait
+var errClusterBusy = errors.New("another instance holds the write lock")
+
+// clusterLeaseName returns where a lease is held: the lease file or the
+// Redis key, of the write lock or, with a suffix, of another lease
+func clusterLeaseName(cfg *ClusterConfig, suffix string) string {
+	if cfg.Lock == "redis" {
+		if suffix == "" {
+			return cfg.RedisKey
+		}
+		return cfg.RedisKey + ":" + suffix
+	}
+	if suffix == "" {
+		return cfg.LockFile
+	}
+	ext := filepath.Ext(cfg.LockFile)
+	return strings.TrimSuffix(cfg.LockFile, ext) + "." + suffix + ext
+}
+
+// acquireLease takes a lease unless another instance holds it
+func acquireLease(cfg *ClusterConfig, name, token string, lease time.Duration) (bool, error) {
+	if cfg.Lock == "redis" {
+		return redisAcquire(cfg, name, token, lease)
+	}
+	return fileAcquire(name, token, lease)
+}
+
+// renewLease extends a lease if it is still this token's
+func renewLease(cfg *ClusterConfig, name, token string, lease time.Duration) (bool, error) {
+	if cfg.Lock == "redis" {
+		return redisRenew(cfg, name, token, lease)
+	}
+	return fileRenew(name, token, lease)
+}
+
+// releaseLease gives a lease up if it is still this token's
+func releaseLease(cfg *ClusterConfig, name, token string) error {
+	if cfg.Lock == "redis" {
+		return redisRelease(cfg, name, token)
+	}
+	return fileRelease(name, token)
+}
+
+// loadCluster reads cluster-config.json. Called once at startup: the lock is
+// not reloaded.
+func loadCluster() error {
+	var cfg ClusterConfig
+	if err := readDataFile("cluster-config.json", &cfg); err != nil {
+		return err
+	}
+	switch cfg.Lock {
+	case "":
+		return nil
+	case "file":
+		if cfg.LockFile == "" {
+			cfg.LockFile = filepath.Join(dataDir, ".relplanner.lock")
+		}
+	case "redis":
+		if cfg.RedisAddr == "" {
+			return fmt.Errorf("cluster-config.json: the redis lock needs redisAddr")
+		}
+		if cfg.RedisKey == "" {
+			cfg.RedisKey = "relplanner:lock"
+		}
+	default:
+		return fmt.Errorf("cluster-config.json: unknown lock %q, use file or redis", cfg.Lock)
+	}
+	if cfg.LeaseSeconds <= 0 {
+		cfg.LeaseSeconds = 30
+	}
+	if cfg.WaitSeconds <= 0 {
+		cfg.WaitSeconds = 10
+	}
+	clusterConfig = &cfg
+	logServer.Info("Coordinating writes with other instances", "lock", cfg.Lock)
+	return nil
+}
+
+// clusterLock takes the lock shared with the other instances, waiting for
+// it up to waitSeconds, and returns its release. Without a lock configured
+// it returns at once. Take it before fileMu, never while holding it.
+func clusterLock(ctx context.Context) (func(), error) {
+	return holdLease(ctx, "")
+}
+
+// holdLease takes the lease of a suffix, as clusterLeaseName names it, the
+// way clusterLock takes the write lock
+func holdLease(ctx context.Context, suffix string) (func(), error) {
+	cfg := clusterConfig
+	if cfg == nil {
+		return func() {}, nil
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	lease := time.Duration(cfg.LeaseSeconds) * time.Second
+	deadline := time.Now().Add(time.Duration(cfg.WaitSeconds) * time.Second)
+	name, what := clusterLeaseName(cfg, suffix), suffix
+	if what == "" {
+		what = "write"
+	}
+	for {
+		ok, err := acquireLease(cfg, name, token, lease)
+		if err != nil {
+			return nil, fmt.Errorf("taking the %s lock: %v", what, err)
+		}
+		if ok {
+			// Renewed while held, so a slow save doesn't outlive its lease
+			done, stopped := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-done:
+						return
+					case <-time.After(lease / 3):
+					}
+					if ok, err := renewLease(cfg, name, token, lease); err != nil {
+						logServer.Warn("Could not renew the "+what+" lock", "lock", cfg.Lock, "err", err)
+					} else if !ok {
+						logServer.Error("Lost the "+what+" lock to another instance", "lock", cfg.Lock)
+						return
+					}
+				}
+			}()
+			return func() {
+				close(done)
+				<-stopped
+				if err := releaseLease(cfg, name, token); err != nil {
+					logServer.Warn("Could not release the "+what+" lock", "lock", cfg.Lock, "err", err)
+				}
+			}, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, errClusterBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(clusterPollInterval):
+		}
+	}
+}
+
+// fileAcquire creates the lease file, unless another instance holds an
+// unexpired lease. An expired one is moved aside and removed, and the
+// creation tried again.
+func fileAcquire(path, token string, lease time.Duration) (bool, error) {
+	host, _ := os.Hostname()
+	content, _ := json.Marshal(clusterLease{Token: token, Host: host, PID: os.Getpid(),
+		Expires: time.Now().Add(lease).UTC().Format(time.RFC3339Nano)})
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		_, err = f.Write(content)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(path)
+			return false, err
+		}
+		return true, nil
+	}
+	if !os.IsExist(err) {
+		return false, err
+	}
+
+	// A lease being written reads as empty; it is only taken over once its
+	// file is older than a lease
+	var held clusterLease
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var expires time.Time
+	perr := errors.New("unreadable lease")
+	if json.Unmarshal(b, &held) == nil {
+		expires, perr = time.Parse(time.RFC3339Nano, held.Expires)
+	}
+	if perr != nil {
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, nil
+		}
+		expires = info.ModTime().Add(lease)
+	}
+	if time.Now().Before(expires) {
+		return false, nil
+	}
+
+	// Instances taking it over at once each move aside what is there. Only the
+	// one that moved the expired lease removes it; the others put back the
+	// lease they moved, a new one, unless yet another was created since.
+	stale := path + "." + newToken(8) + ".expired"
+	if err := os.Rename(path, stale); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer os.Remove(stale)
+	if moved, err := os.ReadFile(stale); err != nil || !bytes.Equal(moved, b) {
+		if err := os.Link(stale, path); err != nil && !os.IsExist(err) {
+			return false, err
+		}
+		return false, nil
+	}
+	logServer.Warn("Took over an expired lease", "lease", filepath.Base(path), "host", held.Host, "pid", held.PID)
+	return false, nil
+}
+
+// fileRelease removes the lease file if it is still this lease
+func fileRelease(path, token string) error {
+	var held clusterLease
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if json.Unmarshal(b, &held) != nil || held.Token != token {
+		return fmt.Errorf("the lease expired and was taken over")
+	}
+	return os.Remove(path)
+}
+
+// fileRenew extends the lease file's expiry if it is still this lease
+func fileRenew(path, token string, lease time.Duration) (bool, error) {
+	var held clusterLease
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if json.Unmarshal(b, &held) != nil || held.Token != token {
+		return false, nil
+	}
+	held.Expires = time.Now().Add(lease).UTC().Format(time.RFC3339Nano)
+	content, _ := json.Marshal(held)
+	return true, replaceFile(path, content, 0644)
+}
+
+// redisReleaseScript deletes the key only while it holds the token
+const redisReleaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// redisRenewScript extends the key's expiry only while it holds the token
+const redisRenewScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+
+// redisAcquire sets the key to the token unless it exists, expiring it
+// after the lease
+func redisAcquire(cfg *ClusterConfig, key, token string, lease time.Duration) (bool, error) {
+	reply, err := redisCommand(cfg, "SET", key, token, "NX", "PX", strconv.FormatInt(lease.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == "OK", nil
+}
+
+// redisRelease deletes the key if it is still this lock's
+func redisRelease(cfg *ClusterConfig, key, token string) error {
+	reply, err := redisCommand(cfg, "EVAL", redisReleaseScript, "1", key, token)
+	if err != nil {
+		return err
+	}
+	if reply != "1" {
+		return fmt.Errorf("the lease expired and was taken over")
+	}
+	return nil
+}
+
+// redisRenew extends the key's expiry if it is still this lease's
+func redisRenew(cfg *ClusterConfig, key, token string, lease time.Duration) (bool, error) {
+	reply, err := redisCommand(cfg, "EVAL", redisRenewScript, "1", key, token, strconv.FormatInt(lease.Milliseconds(), 10))
+	if err != nil {
+		return false, err
+	}
+	return reply == "1", nil
+}
+
+// redisCommand runs a command on a connection of its own, after AUTH and
+// SELECT as configured, returning a simple, integer or bulk reply as text;
+// a nil reply is empty
+func redisCommand(cfg *ClusterConfig, args ...string) (string, error) {
+	conn, err := net.DialTimeout("tcp", cfg.RedisAddr, 5*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	var commands [][]string
+	if cfg.RedisPassword != "" {
+		commands = append(commands, []string{"AUTH", cfg.RedisPassword})
+	}
+	if cfg.RedisDB != 0 {
+		commands = append(commands, []string{"SELECT", strconv.Itoa(cfg.RedisDB)})
+	}
+	commands = append(commands, args)
+	var reply string
+	for _, command := range commands {
+		var b strings.Builder
+		fmt.Fprintf(&b, "*%d\r\n", len(command))
+		for _, arg := range command {
+			fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		if _, err := conn.Write([]byte(b.String())); err != nil {
+			return "", err
+		}
+		if reply, err = readRedisReply(r); err != nil {
+			return "", fmt.Errorf("redis %s: %v", command[0], err)
+		}
+	}
+	return reply, nil
+}
+
+// readRedisReply reads a reply of the RESP protocol other than an array
+func readRedisReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", errors.New(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid reply %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return "", err
+		}
+		return string(b[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
+
+// peerSaved reports whether a data file changed on disk was saved by another
+// instance sharing the directory: saves back up the version they replace, so
+// the newest backup is the version this instance last saw. Edits by hand
+// leave no backup.
+func peerSaved(name string, previous []byte) bool {
+	if clusterConfig == nil || previous == nil {
+		return false
+	}
+	backups, err := listBackups(strings.TrimSuffix(name, ".json") + ".")
+	if err != nil {
+		return false
+	}
+	newest := ""
+	for _, b := range backups {
+		if strings.HasSuffix(b, ".json") && b > newest {
+			newest = b
+		}
+	}
+	if newest == "" {
+		return false
+	}
+	content, err := os.ReadFile(filepath.Join(backupDir, newest))
+	return err == nil && bytes.Equal(content, previous)
+}
+
+// replaceFile writes a file through a temporary file renamed over it, so
+// readers, other instances among them, see either version and never a
+// partial write
+func replaceFile(path string, content []byte, perm os.FileMode) error {
+	tmp := path + ".saving"
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// fileStamp tells whether a file changed since it was read, e.g. saved by
+// another instance sharing the directory
+type fileStamp struct {
+	modified time.Time
+	size     int64
+}
+
+// equal reports whether two stamps are of the same version of a file
+func (s fileStamp) equal(o fileStamp) bool {
+	return s.modified.Equal(o.modified) && s.size == o.size
+}
+
+// statFile returns a file's stamp, the zero stamp when it doesn't exist
+func statFile(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{info.ModTime(), info.Size()}
+}
+
+// clusterJobs are the background jobs waiting for this instance to be
+// elected their runner
+var clusterJobs struct {
+	sync.Mutex
+	elect   sync.Once
+	runner  bool
+	pending []func()
+}
+
+// startJob starts a background job such as the reminders: at once without a
+// lock configured, else once this instance holds the jobs lease, so replicas
+// don't each send the reminders or open the change requests
+func startJob(job func()) {
+	cfg := clusterConfig
+	if cfg == nil {
+		go job()
+		return
+	}
+	clusterJobs.Lock()
+	defer clusterJobs.Unlock()
+	clusterJobs.elect.Do(func() { go electJobRunner(cfg) })
+	if clusterJobs.runner {
+		go job()
+		return
+	}
+	clusterJobs.pending = append(clusterJobs.pending, job)
+}
+
+// electJobRunner tries for the jobs lease every third of a lease, starting
+// the jobs once it holds it and renewing it from then on. A runner that
+// can't renew its lease before it expires exits, to be restarted, rather
+// than run the jobs beside the instance taking over.
+func electJobRunner(cfg *ClusterConfig) {
+	name := clusterLeaseName(cfg, "jobs")
+	token := newToken(16)
+	lease := time.Duration(cfg.LeaseSeconds) * time.Second
+	var renewed time.Time
+	for {
+		if renewed.IsZero() {
+			ok, err := acquireLease(cfg, name, token, lease)
+			if err != nil {
+				logServer.Warn("Could not take the jobs lease", "lock", cfg.Lock, "err", err)
+			} else if ok {
+				renewed = time.Now()
+				logServer.Info("Running the background jobs for the cluster", "lock", cfg.Lock)
+				clusterJobs.Lock()
+				clusterJobs.runner = true
+				for _, job := range clusterJobs.pending {
+					go job()
+				}
+				clusterJobs.pending = nil
+				clusterJobs.Unlock()
+			}
+		} else {
+			ok, err := renewLease(cfg, name, token, lease)
+			switch {
+			case err == nil && ok:
+				renewed = time.Now()
+			case err == nil:
+				logServer.Error("Lost the jobs lease to another instance, exiting", "lock", cfg.Lock)
+				os.Exit(1)
+			case time.Since(renewed) >= lease:
+				logServer.Error("Could not renew the jobs lease before it expired, exiting", "lock", cfg.Lock, "err", err)
+				os.Exit(1)
+			default:
+				logServer.Warn("Could not renew the jobs lease", "lock", cfg.Lock, "err", err)
+			}
+		}
+		time.Sleep(lease / 3)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// compressMinSize is the smallest response worth compressing
+const compressMinSize = 1024
+
+// compressibleTypes are the content types compressed, by prefix; images
+// but SVG and archives are compressed already
+var compressibleTypes = []string{
+	"application/json", "application/javascript", "application/xml",
+	"text/html", "text/css", "text/plain", "text/javascript", "text/csv", "text/markdown", "text/calendar",
+	"image/svg+xml",
+}
+
+// compressible reports whether a content type is compressed
+func compressible(contentType string) bool {
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriters reuses gzip writers, which are expensive to set up
+var gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(io.Discard) }}
+
+// acceptedEncoding picks gzip or deflate from Accept-Encoding, empty when
+// the client takes neither
+func acceptedEncoding(r *http.Request) string {
+	deflate := false
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			deflate = true
+		}
+	}
+	if deflate {
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter compresses a response once it knows its type and that it
+// is large enough, buffering its start until then
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser // nil when not compressing
+}
+
+// decide settles whether to compress, from the headers and what was
+// written so far, and sends the headers
+func (c *compressWriter) decide(final bool) {
+	c.decided = true
+	h := c.Header()
+	if h.Get("Content-Type") == "" && len(c.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(c.buf))
+	}
+	size := len(c.buf)
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+		size = n
+	} else if !final {
+		size = compressMinSize
+	}
+	if c.status == http.StatusOK && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		size >= compressMinSize && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", c.encoding)
+		h.Add("Vary", "Accept-Encoding")
+		if c.encoding == "gzip" {
+			gz := gzipWriters.Get().(*gzip.Writer)
+			gz.Reset(c.ResponseWriter)
+			c.enc = gz
+		} else {
+			c.enc = zlib.NewWriter(c.ResponseWriter)
+		}
+	}
+	c.ResponseWriter.WriteHeader(c.status)
+	buf := c.buf
+	c.buf = nil
+	if len(buf) > 0 {
+		c.write(buf)
+	}
+}
+
+func (c *compressWriter) write(p []byte) (int, error) {
+	if c.enc != nil {
+		return c.enc.Write(p)
+	}
+	return c.ResponseWriter.Write(p)
+}
+
+func (c *compressWriter) WriteHeader(status int) {
+	if c.decided || c.status != 0 {
+		return
+	}
+	c.status = status
+	if status != http.StatusOK {
+		c.decide(true)
+	}
+}
+
+func (c *compressWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	if !c.decided {
+		c.buf = append(c.buf, p...)
+		_, known := c.Header()["Content-Length"]
+		if len(c.buf) >= compressMinSize || known {
+			c.decide(false)
+		}
+		return len(p), nil
+	}
+	return c.write(p)
+}
+
+// Flush sends what was written so far, as streaming responses need
+func (c *compressWriter) Flush() {
+	if !c.decided {
+		if c.status == 0 {
+			c.status = http.StatusOK
+		}
+		c.decide(false)
+	}
+	if f, ok := c.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(c.ResponseWriter).Flush()
+}
+
+// close ends the response, writing a small one as is
+func (c *compressWriter) close() {
+	if !c.decided {
+		if c.status == 0 {
+			return
+		}
+		c.decide(true)
+	}
+	if c.enc != nil {
+		c.enc.Close()
+		if gz, ok := c.enc.(*gzip.Writer); ok {
+			gzipWriters.Put(gz)
+		}
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (c *compressWriter) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// compress compresses responses of compressible types with gzip or
+// deflate, as the client accepts
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r)
+		if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConfluenceConfig is confluence-config.json, kept on disk only since it
+// holds credentials. The upcoming months of the calendar are published as
+// a page of the configured space, on demand or every publishIntervalMinutes.
+type ConfluenceConfig struct {
+	URL             string `json:"url"` // e.g. https://acme.atlassian.net/wiki
+	Username        string `json:"username,omitempty"`
+	APIToken        string `json:"apiToken,omitempty"` // Cloud: with username; Server/Data Center: a personal access token
+	SpaceKey        string `json:"spaceKey"`
+	ParentPageID    string `json:"parentPageId,omitempty"`
+	Title           string `json:"title,omitempty"`  // default "Release calendar"
+	Months          int    `json:"months,omitempty"` // default 3, starting with the current month
+	IntervalMinutes int    `json:"publishIntervalMinutes,omitempty"`
+}
+
+// confluencePublish is confluence-publish.json, the page last published
+type confluencePublish struct {
+	PageID      string `json:"pageId,omitempty"`
+	Version     int    `json:"version,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Checksum    string `json:"checksum,omitempty"` // of the page body, to skip unchanged publishes
+	PublishedAt string `json:"publishedAt,omitempty"`
+}
+
+// confluenceMu serializes publishes so the page is never created twice
+var confluenceMu sync.Mutex
+
+// loadConfluenceConfig reads confluence-config.json; ok is false when
+// publishing isn't configured
+func loadConfluenceConfig() (cfg ConfluenceConfig, ok bool, err error) {
+	if err := readDataFile("confluence-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	if cfg.Title == "" {
+		cfg.Title = "Release calendar"
+	}
+	if cfg.Months <= 0 {
+		cfg.Months = 3
+	}
+	return cfg, cfg.URL != "" && cfg.SpaceKey != "" && cfg.APIToken != "", nil
+}
+
+// confluenceDo calls the Confluence REST API
+func confluenceDo(cfg ConfluenceConfig, method, path string, body, out interface{}) error {
+	req, err := http.NewRequest(method, cfg.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.Username != "" {
+		req.SetBasicAuth(cfg.Username, cfg.APIToken)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+	return doJSON(req, body, out)
+}
+
+// renderConfluenceCalendar renders the releases of the months starting at
+// from as Confluence storage format: one table per month, with the status
+// cells in the status colors of the planner
+func renderConfluenceCalendar(from time.Time, months int) (string, error) {
+	releases, err := loadReleases()
+	if err != nil {
+		return "", err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return "", err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return "", err
+	}
+	displayNames := map[string]string{}
+	for _, env := range envs.Environments {
+		displayNames[env.Name] = env.DisplayName
+	}
+
+	type row struct {
+		env   string
+		entry ReleaseEntry
+	}
+	to := from.AddDate(0, months, 0)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<p>Releases planned from %s to %s, published by the release planner. Edits here are overwritten on the next publish.</p>\n",
+		from.Format("2 January 2006"), to.AddDate(0, 0, -1).Format("2 January 2006"))
+	for m := from; m.Before(to); m = m.AddDate(0, 1, 0) {
+		end := m.AddDate(0, 1, 0)
+		var rows []row
+		for env, entries := range releases {
+			for _, e := range entries {
+				if d, err := time.ParseInLocation(dateLayout, e.Date, time.Local); err == nil && !d.Before(m) && d.Before(end) {
+					rows = append(rows, row{env, e})
+				}
+			}
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].entry.Date != rows[j].entry.Date {
+				return rows[i].entry.Date < rows[j].entry.Date
+			}
+			return rows[i].env < rows[j].env
+		})
+
+		fmt.Fprintf(&buf, "<h2>%s</h2>\n", m.Format("January 2006"))
+		var monthHolidays []string
+		for _, h := range holidays.Holidays {
+			if h.Date >= m.Format(dateLayout) && h.Date < end.Format(dateLayout) {
+				monthHolidays = append(monthHolidays, fmt.Sprintf("%s %s", h.Date, h.Name))
+			}
+		}
+		if len(rows) == 0 {
+			buf.WriteString("<p><em>No releases planned.</em></p>\n")
+		} else {
+			buf.WriteString("<table><tbody>\n<tr><th>Date</th><th>Environment</th><th>Release</th><th>Status</th><th>Window</th><th>Tickets</th><th>Change</th></tr>\n")
+			for _, r := range rows {
+				e := r.entry
+				env := displayNames[r.env]
+				if env == "" {
+					env = r.env
+				}
+				window := ""
+				if start, end, err := e.window(); err == nil && e.StartTime != "" {
+					window = start.Format("15:04") + " - " + end.Format("15:04")
+					if end.Format(dateLayout) != e.Date {
+						window = start.Format("15:04") + " - " + end.Format("2 Jan 15:04")
+					}
+				}
+				statusCell := "<td>"
+				if c, ok := envs.ReleaseStatuses[e.Status]; ok && c.Background != "" {
+					statusCell = fmt.Sprintf(`<td data-highlight-colour="%s">`, html.EscapeString(c.Background))
+				}
+				change := e.ChangeRequest
+				if change != "" && e.ChangeApproval != "" {
+					change += " (" + e.ChangeApproval + ")"
+				}
+				fmt.Fprintf(&buf, "<tr><td>%s</td><td>%s</td><td>%s</td>%s%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n",
+					html.EscapeString(e.Date), html.EscapeString(env), html.EscapeString(e.ReleaseName),
+					statusCell, html.EscapeString(e.Status), html.EscapeString(window),
+					html.EscapeString(strings.Join(e.linkedTickets(), ", ")), html.EscapeString(change))
+			}
+			buf.WriteString("</tbody></table>\n")
+		}
+		if len(monthHolidays) > 0 {
+			fmt.Fprintf(&buf, "<p>Holidays: %s</p>\n", html.EscapeString(strings.Join(monthHolidays, ", ")))
+		}
+	}
+	return buf.String(), nil
+}
+
+// loadConfluencePublish reads confluence-publish.json
+func loadConfluencePublish() (confluencePublish, error) {
+	var state confluencePublish
+	err := readDataFile("confluence-publish.json", &state)
+	return state, err
+}
+
+// save writes confluence-publish.json, server-maintained like jira-sync.json
+func (s confluencePublish) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "confluence-publish.json"), data, 0644)
+}
+
+// confluencePage is the part of a content object we use
+type confluencePage struct {
+	ID      string `json:"id"`
+	Version struct {
+		Number int `json:"number"`
+	} `json:"version"`
+	Links struct {
+		Base  string `json:"base"`
+		WebUI string `json:"webui"`
+	} `json:"_links"`
+}
+
+// publishConfluenceCalendar creates or updates the calendar page; an
+// unchanged calendar isn't published again unless force is set
+func publishConfluenceCalendar(force bool) (confluencePublish, error) {
+	confluenceMu.Lock()
+	defer confluenceMu.Unlock()
+
+	state, err := loadConfluencePublish()
+	if err != nil {
+		return state, err
+	}
+	cfg, ok, err := loadConfluenceConfig()
+	if err != nil || !ok {
+		return state, err
+	}
+	now := time.Now()
+	body, err := renderConfluenceCalendar(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local), cfg.Months)
+	if err != nil {
+		return state, err
+	}
+	sum := sha256.Sum256([]byte(cfg.Title + "\x00" + body))
+	checksum := hex.EncodeToString(sum[:])
+	if !force && state.PageID != "" && state.Checksum == checksum {
+		return state, nil
+	}
+
+	// The page may have been created by hand or edited since, so look it up
+	var found struct {
+		Results []confluencePage `json:"results"`
+	}
+	params := url.Values{"spaceKey": {cfg.SpaceKey}, "title": {cfg.Title}, "expand": {"version"}}
+	if err := confluenceDo(cfg, http.MethodGet, "/rest/api/content?"+params.Encode(), nil, &found); err != nil {
+		return state, err
+	}
+
+	content := map[string]interface{}{
+		"type":  "page",
+		"title": cfg.Title,
+		"space": map[string]string{"key": cfg.SpaceKey},
+		"body":  map[string]interface{}{"storage": map[string]string{"value": body, "representation": "storage"}},
+	}
+	var page confluencePage
+	if len(found.Results) == 0 {
+		if cfg.ParentPageID != "" {
+			content["ancestors"] = []map[string]string{{"id": cfg.ParentPageID}}
+		}
+		if err := confluenceDo(cfg, http.MethodPost, "/rest/api/content", content, &page); err != nil {
+			return state, fmt.Errorf("creating page: %w", err)
+		}
+		logConfluence.Info("Created Confluence page", "page", page.ID)
+	} else {
+		existing := found.Results[0]
+		content["id"] = existing.ID
+		content["version"] = map[string]interface{}{"number": existing.Version.Number + 1, "message": "Updated by the release planner"}
+		if err := confluenceDo(cfg, http.MethodPut, "/rest/api/content/"+existing.ID, content, &page); err != nil {
+			return state, fmt.Errorf("updating page %s: %w", existing.ID, err)
+		}
+	}
+
+	state = confluencePublish{
+		PageID:      page.ID,
+		Version:     page.Version.Number,
+		Checksum:    checksum,
+		PublishedAt: now.UTC().Format(time.RFC3339),
+	}
+	if page.Links.WebUI != "" {
+		base := page.Links.Base
+		if base == "" {
+			base = cfg.URL
+		}
+		state.URL = base + page.Links.WebUI
+	}
+	return state, state.save()
+}
+
+// runConfluencePublisher publishes the calendar every publishIntervalMinutes;
+// with no interval configured publishing is on demand only
+func runConfluencePublisher() {
+	for {
+		interval := time.Minute
+		if cfg, ok, _ := loadConfluenceConfig(); ok && cfg.IntervalMinutes > 0 {
+			interval = time.Duration(cfg.IntervalMinutes) * time.Minute
+			if _, err := publishConfluenceCalendar(false); err != nil {
+				logConfluence.Error("Confluence publish failed", "err", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Handle the Confluence calendar page: GET returns the last publish, or the
+// page body with ?preview=1; POST publishes now
+func handleConfluenceCalendar(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if r.URL.Query().Get("preview") == "1" {
+			cfg, _, err := loadConfluenceConfig()
+			if err != nil {
+				http.Error(w, "Invalid Confluence config", http.StatusInternalServerError)
+				return
+			}
+			now := time.Now()
+			body, err := renderConfluenceCalendar(time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local), cfg.Months)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error rendering calendar: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(body))
+			return
+		}
+		state, err := loadConfluencePublish()
+		if err != nil {
+			http.Error(w, "Error reading Confluence publish state", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+
+	case http.MethodPost:
+		if _, ok, err := loadConfluenceConfig(); err != nil || !ok {
+			http.Error(w, "Confluence publishing is not configured", http.StatusBadRequest)
+			return
+		}
+		state, err := publishConfluenceCalendar(true)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Confluence API error: %v", err), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
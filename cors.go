@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CORSConfig is cors-config.json: the other origins, such as dashboards,
+// whose pages may call the API. Without it the API is same-origin only.
+type CORSConfig struct {
+	// AllowedOrigins are origins like https://dash.example.com, or "*" for
+	// any; credentials are never allowed for "*"
+	AllowedOrigins   []string `json:"allowedOrigins,omitempty"`
+	AllowedMethods   []string `json:"allowedMethods,omitempty"` // default GET, HEAD, POST, PUT, PATCH, DELETE
+	AllowedHeaders   []string `json:"allowedHeaders,omitempty"` // default corsDefaultHeaders
+	ExposedHeaders   []string `json:"exposedHeaders,omitempty"` // default corsExposedHeaders
+	AllowCredentials bool     `json:"allowCredentials,omitempty"`
+	MaxAge           int      `json:"maxAge,omitempty"` // seconds browsers cache a preflight, default 600
+}
+
+// corsDefaultHeaders are the request headers the API reads
+var corsDefaultHeaders = []string{"Content-Type", "Authorization", "If-Match", "X-CSRF-Token", "X-Max-Backups", "X-Restore"}
+
+// corsExposedHeaders are the response headers the API sets for clients
+var corsExposedHeaders = []string{"ETag", "Last-Modified", "X-Last-Modified-By", "X-Total-Count", "Retry-After", "X-Request-ID"}
+
+// corsConfigCache holds cors-config.json, reread every minute
+var corsConfigCache struct {
+	sync.Mutex
+	config CORSConfig
+	loaded time.Time
+}
+
+// loadCORSConfig returns cors-config.json with its defaults
+func loadCORSConfig() CORSConfig {
+	corsConfigCache.Lock()
+	defer corsConfigCache.Unlock()
+	if time.Since(corsConfigCache.loaded) > time.Minute {
+		var cfg CORSConfig
+		readDataFile("cors-config.json", &cfg)
+		if len(cfg.AllowedMethods) == 0 {
+			cfg.AllowedMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+		}
+		if len(cfg.AllowedHeaders) == 0 {
+			cfg.AllowedHeaders = corsDefaultHeaders
+		}
+		if len(cfg.ExposedHeaders) == 0 {
+			cfg.ExposedHeaders = corsExposedHeaders
+		}
+		if cfg.MaxAge <= 0 {
+			cfg.MaxAge = 600
+		}
+		corsConfigCache.config, corsConfigCache.loaded = cfg, time.Now()
+	}
+	return corsConfigCache.config
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin for an origin,
+// empty when it isn't allowed
+func (c CORSConfig) allowedOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		switch {
+		case strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin):
+			return origin
+		case allowed == "*" && c.AllowCredentials:
+			// A wildcard can't carry credentials, so they are only for listed origins
+			continue
+		case allowed == "*":
+			return "*"
+		}
+	}
+	return ""
+}
+
+// cors adds the CORS headers to API responses for allowed origins and
+// answers their preflight requests
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cfg := loadCORSConfig()
+		allowed := cfg.allowedOrigin(origin)
+		w.Header().Add("Vary", "Origin")
+		if allowed == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if cfg.AllowCredentials && allowed != "*" {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
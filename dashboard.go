@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Default look-ahead window of the dashboard in days
+const defaultDashboardDays = 14
+
+// upcomingRelease is a release entry annotated with its environment
+type upcomingRelease struct {
+	ID          string `json:"id"`
+	Environment string `json:"environment"`
+	ReleaseEntry
+}
+
+// dashboardJira summarizes the configured Jira query
+type dashboardJira struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"byStatus"`
+	Error    string         `json:"error,omitempty"`
+	Stale    bool           `json:"stale,omitempty"` // Jira was down, counts are from the cache
+}
+
+// dashboardSummary is the response of GET /api/dashboard
+type dashboardSummary struct {
+	From             string                       `json:"from"`
+	To               string                       `json:"to"`
+	UpcomingReleases map[string][]upcomingRelease `json:"upcomingReleases"`
+	UpcomingHolidays []Holiday                    `json:"upcomingHolidays"`
+	ActiveFreezes    []appliedFreeze              `json:"activeFreezes"`
+	LockedEnvs       map[string]*EnvironmentLock  `json:"lockedEnvironments"`
+	PendingApprovals []upcomingRelease            `json:"pendingApprovals"` // from today on, any date
+	Jira             *dashboardJira               `json:"jira,omitempty"`
+}
+
+// releasesBetween returns the releases within [from, to] per environment, sorted by date
+func releasesBetween(releases ReleasesData, from, to time.Time) map[string][]upcomingRelease {
+	result := map[string][]upcomingRelease{}
+	for env, entries := range releases {
+		list := []upcomingRelease{}
+		for _, e := range entries {
+			if inDateRange(e.Date, from, to) {
+				list = append(list, upcomingRelease{ID: releaseID(env, e.Date), Environment: env, ReleaseEntry: e})
+			}
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+		result[env] = list
+	}
+	return result
+}
+
+// Handle dashboard summary API
+func handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := defaultDashboardDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		}
+	}
+	from := today()
+	to := from.AddDate(0, 0, days)
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		http.Error(w, "Error reading holidays", http.StatusInternalServerError)
+		return
+	}
+	holidays = localizeHolidays(holidays, requestLanguages(r))
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+
+	summary := dashboardSummary{
+		From:             from.Format(dateLayout),
+		To:               to.Format(dateLayout),
+		UpcomingReleases: releasesBetween(releases, from, to),
+		UpcomingHolidays: []Holiday{},
+		ActiveFreezes:    envs.activeFreezes(from, to),
+		LockedEnvs:       map[string]*EnvironmentLock{},
+		PendingApprovals: []upcomingRelease{},
+	}
+	for _, env := range envs.Environments {
+		if env.Lock.active(time.Now()) {
+			summary.LockedEnvs[env.Name] = env.Lock
+		}
+	}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if needsApproval(e.Status) && e.Date >= summary.From {
+				summary.PendingApprovals = append(summary.PendingApprovals, upcomingRelease{ID: releaseID(env, e.Date), Environment: env, ReleaseEntry: e})
+			}
+		}
+	}
+	sort.Slice(summary.PendingApprovals, func(i, j int) bool {
+		return summary.PendingApprovals[i].Date < summary.PendingApprovals[j].Date
+	})
+	for _, h := range holidays.Holidays {
+		if inDateRange(h.Date, from, to) {
+			summary.UpcomingHolidays = append(summary.UpcomingHolidays, h)
+		}
+	}
+	sort.Slice(summary.UpcomingHolidays, func(i, j int) bool {
+		return summary.UpcomingHolidays[i].Date < summary.UpcomingHolidays[j].Date
+	})
+
+	// Jira counts are best effort: a failing Jira must not break the dashboard
+	if r.URL.Query().Get("jira") != "0" {
+		summary.Jira = &dashboardJira{ByStatus: map[string]int{}}
+		result, err := cachedJiraTickets(false)
+		if err != nil {
+			summary.Jira.Error = err.Error()
+		}
+		summary.Jira.Stale = result.stale
+		for _, t := range result.tickets {
+			summary.Jira.Total++
+			if status, ok := t["status"].(string); ok {
+				summary.Jira.ByStatus[status]++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// nextRelease is the response of GET /api/next-release
+type nextRelease struct {
+	upcomingRelease
+	Start            time.Time                `json:"start"`
+	CountdownSeconds int64                    `json:"countdownSeconds"`
+	Countdown        string                   `json:"countdown"`
+	Tickets          []map[string]interface{} `json:"tickets"`
+}
+
+// formatCountdown renders a duration as "3d 4h 12m"
+func formatCountdown(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	}
+	return fmt.Sprintf("%dh %dm", hours, minutes)
+}
+
+// findNextRelease returns the earliest release that hasn't started yet and
+// isn't completed, optionally restricted to one environment
+func findNextRelease(releases ReleasesData, env string, now time.Time) (*upcomingRelease, time.Time) {
+	var best *upcomingRelease
+	var bestStart time.Time
+	for name, entries := range releases {
+		if env != "" && name != env {
+			continue
+		}
+		for _, e := range entries {
+			if completedStatuses[e.Status] {
+				continue
+			}
+			start, _, err := e.window()
+			if err != nil || start.Before(now) {
+				continue
+			}
+			if best == nil || start.Before(bestStart) {
+				best = &upcomingRelease{ID: releaseID(name, e.Date), Environment: name, ReleaseEntry: e}
+				bestStart = start
+			}
+		}
+	}
+	return best, bestStart
+}
+
+// Handle next upcoming release with countdown, for wallboards and chat integrations
+func handleNextRelease(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	next, start := findNextRelease(releases, r.URL.Query().Get("env"), now)
+	if next == nil {
+		http.Error(w, "No upcoming release", http.StatusNotFound)
+		return
+	}
+
+	resp := nextRelease{
+		upcomingRelease:  *next,
+		Start:            start,
+		CountdownSeconds: int64(start.Sub(now).Seconds()),
+		Countdown:        formatCountdown(start.Sub(now)),
+		Tickets:          []map[string]interface{}{},
+	}
+
+	// Enrich linked tickets from Jira when possible, otherwise just list the keys
+	resp.Tickets = releaseTickets(next.ReleaseEntry)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
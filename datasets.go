@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DatasetsConfig is datasets-config.json: data files a site keeps beside the
+// built-in ones, such as a vendor list, served under /api/data/{name} and
+// saved with the same validation, backups and ETags
+type DatasetsConfig struct {
+	Datasets []Dataset `json:"datasets"`
+}
+
+// Dataset is a data file of the registry
+type Dataset struct {
+	Name        string         `json:"name"` // in /api/data/{name}
+	File        string         `json:"file"` // of the data directory, e.g. vendors.json
+	Description string         `json:"description,omitempty"`
+	Schema      *datasetSchema `json:"schema,omitempty"` // saves are checked against it
+	// MaxBackups is how many backups are kept of the file, overriding
+	// X-Max-Backups; 0 leaves it to the request
+	MaxBackups int `json:"maxBackups,omitempty"`
+}
+
+// datasetSchema is the subset of JSON Schema datasets are checked with:
+// type, required, properties, items and enum
+type datasetSchema struct {
+	Type       string                    `json:"type,omitempty"` // object, array, string, number, integer or boolean
+	Required   []string                  `json:"required,omitempty"`
+	Properties map[string]*datasetSchema `json:"properties,omitempty"`
+	Items      *datasetSchema            `json:"items,omitempty"`
+	Enum       []interface{}             `json:"enum,omitempty"`
+}
+
+// datasetNamePattern is what dataset names may be, to sit in a URL path
+var datasetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// builtinDataFiles are the data files the server has its own API for, which
+// datasets may not take over
+var builtinDataFiles = map[string]bool{
+	"environments.json": true, "releases.json": true, "holidays.json": true, "absences.json": true,
+	"team.json": true, "permissions.json": true, "notification-rules.json": true, "maintenance-windows.json": true,
+}
+
+// loadDatasets reads datasets-config.json
+func loadDatasets() (DatasetsConfig, error) {
+	var cfg DatasetsConfig
+	if err := readDataFile("datasets-config.json", &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, validateDatasetsConfig(cfg)
+}
+
+// datasetByName looks a dataset up by name
+func (cfg DatasetsConfig) datasetByName(name string) (Dataset, bool) {
+	for _, d := range cfg.Datasets {
+		if d.Name == name {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// datasetByFile looks a dataset up by its file
+func (cfg DatasetsConfig) datasetByFile(file string) (Dataset, bool) {
+	for _, d := range cfg.Datasets {
+		if d.File == file {
+			return d, true
+		}
+	}
+	return Dataset{}, false
+}
+
+// validateDatasetsConfig checks the registry: unique names and files, each a
+// plain data file the server has no other use for
+func validateDatasetsConfig(cfg DatasetsConfig) error {
+	names, files := map[string]bool{}, map[string]bool{}
+	for i, d := range cfg.Datasets {
+		switch {
+		case !datasetNamePattern.MatchString(d.Name):
+			return fmt.Errorf("dataset %d: name %q must be lowercase letters, digits and dashes", i+1, d.Name)
+		case names[d.Name]:
+			return fmt.Errorf("duplicate dataset name %q", d.Name)
+		case filepath.Base(d.File) != d.File || !strings.HasSuffix(d.File, ".json"):
+			return fmt.Errorf("dataset %s: file %q must be a .json file of the data directory", d.Name, d.File)
+		case files[d.File]:
+			return fmt.Errorf("dataset %s: file %s belongs to another dataset", d.Name, d.File)
+		case builtinDataFiles[d.File] || !watchedFile(d.File):
+			return fmt.Errorf("dataset %s: file %s is managed by the server", d.Name, d.File)
+		case d.MaxBackups < 0:
+			return fmt.Errorf("dataset %s: maxBackups must not be negative", d.Name)
+		}
+		if d.Schema != nil {
+			if err := d.Schema.check(); err != nil {
+				return fmt.Errorf("dataset %s: schema: %v", d.Name, err)
+			}
+		}
+		names[d.Name], files[d.File] = true, true
+	}
+	return nil
+}
+
+// check reports types the schema doesn't know
+func (s *datasetSchema) check() error {
+	switch s.Type {
+	case "", "object", "array", "string", "number", "integer", "boolean":
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+	for name, p := range s.Properties {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if s.Items != nil {
+		return s.Items.check()
+	}
+	return nil
+}
+
+// validate checks a value against the schema; path names the value in errors
+func (s *datasetSchema) validate(path string, v interface{}) error {
+	switch s.Type {
+	case "object":
+		if _, ok := v.(map[string]interface{}); !ok {
+			return fmt.Errorf("%s must be an object", path)
+		}
+	case "array":
+		if _, ok := v.([]interface{}); !ok {
+			return fmt.Errorf("%s must be an array", path)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s must be a string", path)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s must be a number", path)
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s must be an integer", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s must be true or false", path)
+		}
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == fmt.Sprint(v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, s.Enum)
+		}
+	}
+	if m, ok := v.(map[string]interface{}); ok {
+		for _, name := range s.Required {
+			if _, ok := m[name]; !ok {
+				return fmt.Errorf("%s is missing %s", path, name)
+			}
+		}
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if pv, ok := m[name]; ok {
+				if err := s.Properties[name].validate(path+"."+name, pv); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if list, ok := v.([]interface{}); ok && s.Items != nil {
+		for i, item := range list {
+			if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateDataset checks a file of the registry against its schema; other
+// files pass. A registry that can't be read is reported by /api/data and
+// reloads rather than failing the saves of every other file.
+func validateDataset(file string, data interface{}) error {
+	var cfg DatasetsConfig
+	if err := readDataFile("datasets-config.json", &cfg); err != nil {
+		return nil
+	}
+	d, ok := cfg.datasetByFile(file)
+	if !ok || d.Schema == nil {
+		return nil
+	}
+	return d.Schema.validate(d.Name, data)
+}
+
+// Handle listing the datasets of the registry
+func handleDatasets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, err := loadDatasets()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading datasets-config.json: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if cfg.Datasets == nil {
+		cfg.Datasets = []Dataset{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg.Datasets)
+}
+
+// Handle a dataset of the registry like holidays.json: GET serves the file,
+// POST saves it after checking its schema, backing up the previous version
+// as the dataset's backup policy says
+func handleDataset(w http.ResponseWriter, r *http.Request) {
+	cfg, err := loadDatasets()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading datasets-config.json: %v", err), http.StatusInternalServerError)
+		return
+	}
+	d, ok := cfg.datasetByName(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "Unknown dataset", http.StatusNotFound)
+		return
+	}
+	filePath := filepath.Join(dataDir, d.File)
+
+	switch r.Method {
+	case http.MethodGet:
+		serveJSONFile(w, filePath)
+	case http.MethodPost:
+		maxBackups := d.MaxBackups
+		if maxBackups == 0 {
+			maxBackups = maxBackupsFromRequest(r)
+		}
+		updateJSONFileWithBackup(w, r, filePath, maxBackups)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof/ on the default mux
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// runtimeStats is the response of /debug/runtime
+type runtimeStats struct {
+	Uptime     int64  `json:"uptimeSeconds"`
+	GoVersion  string `json:"goVersion"`
+	CPUs       int    `json:"cpus"`
+	MaxProcs   int    `json:"maxProcs"`
+	Goroutines int    `json:"goroutines"`
+	OpenFiles  *int   `json:"openFiles,omitempty"` // where the OS tells
+	Memory     struct {
+		Alloc       uint64 `json:"allocBytes"`      // live heap objects
+		TotalAlloc  uint64 `json:"totalAllocBytes"` // allocated since start
+		Sys         uint64 `json:"sysBytes"`        // obtained from the OS
+		HeapInuse   uint64 `json:"heapInuseBytes"`
+		HeapIdle    uint64 `json:"heapIdleBytes"`
+		HeapObjects uint64 `json:"heapObjects"`
+		StackInuse  uint64 `json:"stackInuseBytes"`
+	} `json:"memory"`
+	GC struct {
+		Count       uint32  `json:"count"`
+		PauseTotal  float64 `json:"pauseTotalMs"`
+		LastPause   float64 `json:"lastPauseMs"`
+		Last        string  `json:"last,omitempty"`
+		Next        uint64  `json:"nextHeapBytes"` // heap size of the next collection
+		CPUFraction float64 `json:"cpuFraction"`
+	} `json:"gc"`
+}
+
+// openFileCount counts the process's open file descriptors, where /proc
+// lists them
+func openFileCount() (int, bool) {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	return len(entries), true
+}
+
+// Handle runtime statistics, for following memory and goroutine growth
+func handleRuntimeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats := runtimeStats{
+		Uptime:     int64(time.Since(startedAt).Seconds()),
+		GoVersion:  runtime.Version(),
+		CPUs:       runtime.NumCPU(),
+		MaxProcs:   runtime.GOMAXPROCS(0),
+		Goroutines: runtime.NumGoroutine(),
+	}
+	if n, ok := openFileCount(); ok {
+		stats.OpenFiles = &n
+	}
+	stats.Memory.Alloc, stats.Memory.TotalAlloc, stats.Memory.Sys = mem.Alloc, mem.TotalAlloc, mem.Sys
+	stats.Memory.HeapInuse, stats.Memory.HeapIdle, stats.Memory.HeapObjects = mem.HeapInuse, mem.HeapIdle, mem.HeapObjects
+	stats.Memory.StackInuse = mem.StackInuse
+	stats.GC.Count, stats.GC.Next, stats.GC.CPUFraction = mem.NumGC, mem.NextGC, mem.GCCPUFraction
+	stats.GC.PauseTotal = float64(mem.PauseTotalNs) / 1e6
+	if mem.NumGC > 0 {
+		stats.GC.LastPause = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+		stats.GC.Last = time.Unix(0, int64(mem.LastGC)).UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// requireDebugAdmin keeps /debug/, pprof's profiles and the runtime
+// statistics, to admins; profiles show the server's internals
+func requireDebugAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/") {
+			if _, _, role := requestIdentity(r); !roleAllows(role, "admin") {
+				http.Error(w, "Only admins can debug the server", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deployer is a CI system releases are deployed with. Like TicketProvider,
+// each lives in its own file, reads its own config and registers itself from
+// init, so the deploy API doesn't change when one is added.
+type Deployer interface {
+	// Target returns what deploys a release, such as a Jenkins job or a
+	// GitLab project; empty when nothing is configured for it
+	Target(env string, release ReleaseEntry) (string, error)
+	// Trigger starts deploying a release with a deployment prepared with its
+	// target in Job and the version, and returns it with what the CI
+	// reported, such as a run ID
+	Trigger(env string, release ReleaseEntry, d ReleaseDeployment, params map[string]string) (ReleaseDeployment, error)
+	// Poll reads a deployment's progress back; status is the release status
+	// a finished deployment leads to, empty to keep it
+	Poll(d ReleaseDeployment) (next ReleaseDeployment, status string, err error)
+	// PollInterval is how long to wait between polls
+	PollInterval() time.Duration
+}
+
+// Deployment statuses of ReleaseDeployment
+const (
+	deploymentQueued   = "queued"
+	deploymentRunning  = "running"
+	deploymentFinished = "finished"
+	deploymentError    = "error"
+)
+
+// deployers are the registered deployers by provider name
+var deployers = map[string]Deployer{}
+
+// registerDeployer makes a deployer available to releases; called from init
+func registerDeployer(name string, d Deployer) {
+	if _, dup := deployers[name]; dup {
+		panic("deployer registered twice: " + name)
+	}
+	deployers[name] = d
+}
+
+// active reports whether a deployment is still queued or running
+func (d *ReleaseDeployment) active() bool {
+	return d != nil && (d.Status == deploymentQueued || d.Status == deploymentRunning)
+}
+
+// releaseVersion is the version deployed for a release: its BE tag, FE tag
+// or release name
+func releaseVersion(e ReleaseEntry) string {
+	for _, v := range []string{e.BeTag, e.FeTag, e.ReleaseName} {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// deployMu serializes triggers so a release is never deployed twice at once
+var deployMu sync.Mutex
+
+// errDeploymentDone is returned when saving a deployment that was already
+// recorded as done, e.g. by a webhook while it was being polled
+var errDeploymentDone = errors.New("deployment already done")
+
+// saveReleaseDeployment writes a release's deployment into releases.json,
+// and its status unless empty, trying again when the file was edited meanwhile
+func saveReleaseDeployment(ctx context.Context, id string, d ReleaseDeployment, status string) error {
+	for attempt := 0; ; attempt++ {
+		doc, etag, err := loadReleasesDocument()
+		if err != nil {
+			return err
+		}
+		entry, ok := findReleaseEntry(doc, id)
+		if !ok {
+			return fmt.Errorf("release %s no longer exists", id)
+		}
+		var current ReleaseDeployment
+		decodeInto(entry["deployment"], &current)
+		if current.TriggeredAt == d.TriggeredAt && current.Provider == d.Provider &&
+			(current.Status == deploymentFinished || current.Status == deploymentError) {
+			return errDeploymentDone
+		}
+		entry["deployment"] = d
+		if outcome := outcomeFromDeployment(d); outcome != nil && entry["outcome"] == nil {
+			entry["outcome"] = outcome
+		}
+		if status != "" {
+			entry["status"] = status
+		}
+		_, err = writeJSONFile(withServerFields(ctx), filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, "deploy:"+d.Provider)
+		var se *saveError
+		if err == nil || attempt == 2 || !errors.As(err, &se) || se.status != http.StatusPreconditionFailed {
+			return err
+		}
+	}
+}
+
+// startDeployment triggers a deployment of a release with a deployer and
+// records it on the release, failed when the trigger failed. version
+// defaults to releaseVersion.
+func startDeployment(ctx context.Context, env string, release ReleaseEntry, provider, version string, params map[string]string, user string) (ReleaseDeployment, error) {
+	deployMu.Lock()
+	defer deployMu.Unlock()
+
+	id := releaseID(env, release.Date)
+	if release.Deployment.active() {
+		return ReleaseDeployment{}, &saveError{status: http.StatusConflict, msg: fmt.Sprintf("%s is already being deployed", id)}
+	}
+	deployer, ok := deployers[provider]
+	if !ok {
+		return ReleaseDeployment{}, &saveError{status: http.StatusBadRequest, msg: fmt.Sprintf("Unknown deployer %q", provider)}
+	}
+	target, err := deployer.Target(env, release)
+	if err != nil {
+		return ReleaseDeployment{}, err
+	}
+	if target == "" {
+		return ReleaseDeployment{}, &saveError{status: http.StatusConflict, msg: fmt.Sprintf("%s has nothing to deploy %s with", provider, id)}
+	}
+	if version == "" {
+		version = releaseVersion(release)
+	}
+
+	d := ReleaseDeployment{Provider: provider, Job: target, Version: version, Status: deploymentQueued,
+		TriggeredBy: user, TriggeredAt: time.Now().UTC().Format(time.RFC3339)}
+	triggered, err := deployer.Trigger(env, release, d, params)
+	if err != nil {
+		d.Status, d.Error = deploymentError, err.Error()
+		err = &saveError{status: http.StatusBadGateway, msg: fmt.Sprintf("Error triggering %s: %v", provider, err)}
+	} else {
+		d = triggered
+	}
+	if serr := saveReleaseDeployment(ctx, id, d, ""); serr != nil {
+		return d, serr
+	}
+	if err != nil {
+		return d, err
+	}
+	logDeploy.Info("Triggered deployment", "provider", provider, "job", d.Job, "release", id)
+	go watchDeployment(id, d)
+	return d, nil
+}
+
+// watchDeployment polls a deployment until it finishes, recording its
+// progress on the release. It is given up on after a while of errors, as
+// CI systems drop finished queue items and old runs.
+func watchDeployment(id string, d ReleaseDeployment) {
+	deployer, ok := deployers[d.Provider]
+	if !ok {
+		return
+	}
+	failures := 0
+	for d.active() {
+		interval := deployer.PollInterval()
+		if interval <= 0 {
+			interval = 30 * time.Second
+		}
+		time.Sleep(interval)
+		next, status, err := deployer.Poll(d)
+		if errors.Is(err, errNotConfigured) {
+			logDeploy.Error("Watching deployment failed", "provider", d.Provider, "release", id, "err", err)
+			return
+		}
+		if err != nil {
+			if failures++; failures < 20 {
+				continue
+			}
+			next, status = d, ""
+			next.Status, next.Error = deploymentError, err.Error()
+		}
+		failures = 0
+
+		if next != d {
+			if err := saveReleaseDeployment(context.Background(), id, next, status); err != nil {
+				if err != errDeploymentDone {
+					logDeploy.Error("Saving deployment failed", "provider", d.Provider, "release", id, "err", err)
+				}
+				return
+			}
+			d = next
+		}
+	}
+	logDeploy.Info("Deployment finished", "provider", d.Provider, "release", id, "status", d.Status, "result", d.Result)
+}
+
+// resumeDeploymentWatches picks up the deployments still queued or running
+// when the server last stopped
+func resumeDeploymentWatches() {
+	releases, err := loadReleases()
+	if err != nil {
+		logDeploy.Error("Resuming deployment watches failed", "err", err)
+		return
+	}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if e.Deployment.active() {
+				go watchDeployment(releaseID(env, e.Date), *e.Deployment)
+			}
+		}
+	}
+}
+
+// deployRequest is the optional body of POST /api/releases/{id}/deploy
+type deployRequest struct {
+	Provider   string            `json:"provider,omitempty"` // default the one deployer with a target for the release
+	Version    string            `json:"version,omitempty"`  // default the BE tag, FE tag or release name
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// Handle deploying a release: triggers its Jenkins job, GitHub workflow or
+// GitLab pipeline and records the deployment on the release as it progresses
+func handleReleaseDeploy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+
+	var req deployRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	env, date, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeEnvironments(r, env); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	var release *ReleaseEntry
+	for i, e := range releases[env] {
+		if e.Date == date {
+			release = &releases[env][i]
+		}
+	}
+	if release == nil {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	provider := req.Provider
+	if provider == "" {
+		var candidates []string
+		for name, d := range deployers {
+			if target, err := d.Target(env, *release); err == nil && target != "" {
+				candidates = append(candidates, name)
+			}
+		}
+		sort.Strings(candidates)
+		switch len(candidates) {
+		case 0:
+			http.Error(w, fmt.Sprintf("Nothing is configured to deploy %s", id), http.StatusConflict)
+			return
+		case 1:
+			provider = candidates[0]
+		default:
+			http.Error(w, fmt.Sprintf("%s can be deployed with %s, choose a provider", id, strings.Join(candidates, " or ")), http.StatusConflict)
+			return
+		}
+	}
+
+	d, err := startDeployment(r.Context(), env, *release, provider, req.Version, req.Parameters, requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// fieldChange is a value added, removed or changed at a JSON pointer
+type fieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from,omitempty"` // absent when added
+	To   interface{} `json:"to,omitempty"`   // absent when removed
+}
+
+// recordValue is a record added or removed
+type recordValue struct {
+	Record string      `json:"record"`
+	Value  interface{} `json:"value"`
+}
+
+// recordChange is a record changed, by field
+type recordChange struct {
+	Record  string        `json:"record"`
+	Changes []fieldChange `json:"changes"`
+}
+
+// fileDiff is the JSON response of GET /api/diff: the records of a data
+// file added, removed and changed between two versions, and the changes to
+// the rest of it
+type fileDiff struct {
+	File    string         `json:"file"`
+	From    string         `json:"from"` // ETags of the versions
+	To      string         `json:"to"`
+	Added   []recordValue  `json:"added"`
+	Removed []recordValue  `json:"removed"`
+	Changed []recordChange `json:"changed"`
+	Other   []fieldChange  `json:"other"`
+}
+
+// diffValues lists the changes from a to b at a path. Objects are compared
+// by key and arrays of records by their key, like merge3.
+func diffValues(path string, a, b interface{}, out *[]fieldChange) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	if am, ok := a.(map[string]interface{}); ok {
+		if bm, ok := b.(map[string]interface{}); ok {
+			for _, key := range unionKeys(am, bm) {
+				diffValues(path+"/"+pointerToken(key), valueOf(am, key), valueOf(bm, key), out)
+			}
+			return
+		}
+	}
+	if aa, ok := a.([]interface{}); ok {
+		if ba, ok := b.([]interface{}); ok {
+			if key := recordKey(aa, ba); key != "" {
+				am, bm := recordsBy(key, aa), recordsBy(key, ba)
+				for _, id := range recordOrder(key, aa, ba) {
+					diffValues(path+"/"+pointerToken(id), valueOf(am, id), valueOf(bm, id), out)
+				}
+				return
+			}
+		}
+	}
+	change := fieldChange{Path: path}
+	if a != absent {
+		change.From = a
+	}
+	if b != absent {
+		change.To = b
+	}
+	*out = append(*out, change)
+}
+
+// splitRecords separates the records of a data file from the rest of it:
+// releases by id, environments by name and holidays by date. Other files
+// are all rest.
+func splitRecords(file string, doc interface{}) (records map[string]interface{}, order []string, rest interface{}) {
+	records = map[string]interface{}{}
+	add := func(id string, v interface{}) {
+		records[id] = v
+		order = append(order, id)
+	}
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return records, nil, doc
+	}
+	byKey := func(field, key string) interface{} {
+		list, _ := obj[field].([]interface{})
+		for _, v := range list {
+			if r, ok := v.(map[string]interface{}); ok {
+				if id, ok := r[key].(string); ok {
+					add(id, r)
+				}
+			}
+		}
+		others := map[string]interface{}{}
+		for k, v := range obj {
+			if k != field {
+				others[k] = v
+			}
+		}
+		return others
+	}
+	switch file {
+	case "releases.json":
+		for _, env := range unionKeys(obj) {
+			entries, _ := obj[env].([]interface{})
+			for _, v := range entries {
+				if e, ok := v.(map[string]interface{}); ok {
+					if date, ok := e["date"].(string); ok {
+						add(releaseID(env, date), e)
+					}
+				}
+			}
+		}
+		return records, order, nil
+	case "environments.json":
+		return records, order, byKey("environments", "name")
+	case "holidays.json":
+		return records, order, byKey("holidays", "date")
+	}
+	return records, nil, doc
+}
+
+// diffDocuments compares two versions of a data file
+func diffDocuments(file string, a, b interface{}) fileDiff {
+	d := fileDiff{File: file, Added: []recordValue{}, Removed: []recordValue{}, Changed: []recordChange{}, Other: []fieldChange{}}
+	ar, aOrder, aRest := splitRecords(file, a)
+	br, bOrder, bRest := splitRecords(file, b)
+	for _, id := range aOrder {
+		if _, ok := br[id]; !ok {
+			d.Removed = append(d.Removed, recordValue{id, ar[id]})
+		}
+	}
+	for _, id := range bOrder {
+		before, ok := ar[id]
+		if !ok {
+			d.Added = append(d.Added, recordValue{id, br[id]})
+			continue
+		}
+		var changes []fieldChange
+		diffValues("", before, br[id], &changes)
+		if len(changes) > 0 {
+			d.Changed = append(d.Changed, recordChange{id, changes})
+		}
+	}
+	diffValues("", aRest, bRest, &d.Other)
+	return d
+}
+
+// readVersion returns a version of a data file: "current", the name of one
+// of its backups, or its ETag, in which case the version is looked up
+// among them
+func readVersion(file, ref string) ([]byte, error) {
+	if ref == "" || ref == "current" {
+		return os.ReadFile(filepath.Join(dataDir, file))
+	}
+	if strings.HasSuffix(ref, ".json") && filepath.Base(ref) == ref && strings.HasPrefix(ref, strings.TrimSuffix(file, ".json")+".") {
+		return os.ReadFile(filepath.Join(backupDir, ref))
+	}
+	if !strings.HasPrefix(ref, `"`) {
+		ref = `"` + ref + `"`
+	}
+	if content, ok := findVersion(file, ref); ok {
+		return content, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Handle comparing two versions of a data file: ?from= and ?to= (the
+// current version by default) each name a backup, an ETag or "current".
+// Records are compared by their fields, so the restore preview and audit
+// views show what changed rather than lines.
+func handleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	file := query.Get("file")
+	if !sharedFile(file) {
+		http.Error(w, "Unknown 'file'", http.StatusBadRequest)
+		return
+	}
+	if query.Get("from") == "" {
+		http.Error(w, "Missing 'from' version", http.StatusBadRequest)
+		return
+	}
+	var docs [2]interface{}
+	var etags [2]string
+	for i, param := range []string{"from", "to"} {
+		content, err := readVersion(file, query.Get(param))
+		if os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("Version '%s' of %s not found", query.Get(param), file), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading %s: %v", file, err), http.StatusInternalServerError)
+			return
+		}
+		if err := json.Unmarshal(content, &docs[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Version '%s' of %s is not valid JSON", query.Get(param), file), http.StatusUnprocessableEntity)
+			return
+		}
+		etags[i] = checksum(content)
+	}
+	d := diffDocuments(file, docs[0], docs[1])
+	d.From, d.To = etags[0], etags[1]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(d)
+}
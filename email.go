@@ -0,0 +1,430 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// eventFreezeStarting is mailed FreezeNoticeDays before a group freeze
+// begins; unlike release events it comes from runEmailSchedule
+const eventFreezeStarting = "freezeStarting"
+
+// EmailConfig is email-config.json, kept on disk only since it holds the
+// SMTP password. Release events are mailed to the people of the release
+// and the environment owner, approval requests to the approvers. People,
+// owners and approvers are team.json person IDs, team names or addresses.
+// Everyone involved is mailed, but for the kinds of mail they turned off in
+// their preferences.
+type EmailConfig struct {
+	Host      string            `json:"host"`
+	Port      int               `json:"port,omitempty"` // default 587, or 465 with tls
+	Username  string            `json:"username,omitempty"`
+	Password  string            `json:"password,omitempty"`
+	From      string            `json:"from"`
+	TLS       bool              `json:"tls,omitempty"` // implicit TLS; otherwise STARTTLS when offered
+	Approvers []string          `json:"approvers,omitempty"`
+	Events    []string          `json:"events,omitempty"`    // default: moved, approvalRequested, reminder, freezeStarting; also loginLockout
+	Subjects  map[string]string `json:"subjects,omitempty"`  // event type -> text/template
+	Templates map[string]string `json:"templates,omitempty"` // event type -> text/template for the body
+	BaseURL   string            `json:"baseUrl,omitempty"`   // planner URL, available to templates as .URL
+
+	// FreezeNoticeDays is how long before a freeze starts it is announced
+	FreezeNoticeDays int `json:"freezeNoticeDays,omitempty"`
+
+	// Digest is the weekly summary of the coming week, see sendDueDigest
+	Digest EmailDigestConfig `json:"digest"`
+}
+
+// defaultEmailEvents are mailed when the config doesn't list events
+var defaultEmailEvents = []string{eventMoved, eventApprovalRequested, eventReminder, eventFreezeStarting}
+
+// defaultEmailSubjects and defaultEmailTemplates word mails without a
+// configured template
+var defaultEmailSubjects = map[string]string{
+	eventCreated:           `{{.Name}} scheduled on {{.EnvironmentName}} for {{.Date}}`,
+	eventMoved:             `{{.Name}} on {{.EnvironmentName}} moved to {{.Date}}`,
+	eventApproved:          `{{.Name}} on {{.EnvironmentName}} is {{.Status}}`,
+	eventCancelled:         `{{.Name}} on {{.EnvironmentName}} cancelled`,
+	eventApprovalRequested: `Approval requested: {{.Name}} on {{.EnvironmentName}} for {{.Date}}`,
+	eventReminder:          `Reminder: {{.Name}} on {{.EnvironmentName}} in {{.Reminder}}`,
+	eventFreezeStarting:    `Release freeze for {{.GroupName}} starts {{.From}}`,
+	digestMail:             `Releases for the week of {{.From}}`,
+}
+
+var defaultEmailTemplates = map[string]string{
+	eventCreated: `{{.Name}} was scheduled on {{.EnvironmentName}} for {{.Date}}{{if .Window}} {{.Window}}{{end}} with status {{.Status}}.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventMoved: `{{.Name}} on {{.EnvironmentName}} was moved from {{.PreviousDate}} to {{.Date}}{{if .Window}} {{.Window}}{{end}}.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventApproved: `{{.Name}} on {{.EnvironmentName}} for {{.Date}}{{if .Window}} {{.Window}}{{end}} is now {{.Status}}.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventCancelled: `{{.Name}} on {{.EnvironmentName}} for {{.Date}} was cancelled.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventApprovalRequested: `{{.Name}} on {{.EnvironmentName}} for {{.Date}}{{if .Window}} {{.Window}}{{end}} is {{.Status}} and needs approval.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventReminder: `{{.Name}} on {{.EnvironmentName}} is due in {{.Reminder}}, on {{.Date}}{{if .Window}} {{.Window}}{{end}}.
+{{if .Unapproved}}
+It is still {{.Status}} and not approved.
+{{end}}{{if .OpenItems}}
+Open checklist items:
+{{range .OpenItems}}  - {{.}}
+{{end}}{{end}}{{if .URL}}
+{{.URL}}
+{{end}}`,
+	eventFreezeStarting: `The release freeze for {{.GroupName}} runs from {{.From}} to {{.To}}{{if .Reason}} ({{.Reason}}){{end}}.
+No new releases can be scheduled on {{join .Environments ", "}} in that time.
+{{if .URL}}
+{{.URL}}
+{{end}}`,
+	digestMail: defaultDigestTemplate,
+}
+
+// freezeNotice is what freezeStarting templates are executed with
+type freezeNotice struct {
+	Type         string
+	Group        string
+	GroupName    string // display name
+	From         string
+	To           string
+	Reason       string
+	Environments []string
+	URL          string
+}
+
+// loadEmailConfig reads email-config.json; ok is false when email isn't configured
+func loadEmailConfig() (cfg EmailConfig, ok bool, err error) {
+	if err := readDataFile("email-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.TLS {
+			cfg.Port = 465
+		}
+	}
+	if len(cfg.Events) == 0 {
+		cfg.Events = defaultEmailEvents
+	}
+	if cfg.FreezeNoticeDays <= 0 {
+		cfg.FreezeNoticeDays = 2
+	}
+	return cfg, cfg.Host != "" && cfg.From != "", nil
+}
+
+// wants reports whether an event type is mailed
+func (c EmailConfig) wants(kind string) bool {
+	for _, e := range c.Events {
+		if e == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// emailAddresses resolves person IDs, team names and plain addresses to
+// unique addresses; people without an email are skipped
+func emailAddresses(team TeamData, refs []string) []string {
+	seen := map[string]bool{}
+	var result []string
+	add := func(addr string) {
+		if addr != "" && !seen[strings.ToLower(addr)] {
+			seen[strings.ToLower(addr)] = true
+			result = append(result, addr)
+		}
+	}
+	for _, ref := range refs {
+		if strings.Contains(ref, "@") {
+			add(ref)
+			continue
+		}
+		if p, ok := team.person(ref); ok {
+			add(p.Email)
+			continue
+		}
+		for _, id := range team.members(ref) {
+			p, _ := team.person(id)
+			add(p.Email)
+		}
+	}
+	return result
+}
+
+// environmentOwner returns the owner of an environment, if it has one
+func environmentOwner(envs EnvironmentsData, env string) string {
+	for _, def := range envs.Environments {
+		if def.Name == env {
+			return def.Owner
+		}
+	}
+	return ""
+}
+
+// sendEmail mails a plain-text message over SMTP
+func sendEmail(cfg EmailConfig, to []string, subject, body string) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	if !cfg.TLS {
+		return smtp.SendMail(addr, auth, cfg.From, to, []byte(msg.String()))
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 15 * time.Second}, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	if err != nil {
+		return err
+	}
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.From); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// mailTemplates renders the subject and body of a mail
+func mailTemplates(cfg EmailConfig, kind string, data interface{}) (subject, body string, err error) {
+	subject, err = renderTemplate(kind, cfg.Subjects, defaultEmailSubjects, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err = renderTemplate(kind, cfg.Templates, defaultEmailTemplates, data)
+	return strings.TrimSpace(subject), body, err
+}
+
+func init() {
+	registerNotificationChannel("email", notificationChannel{defaults: emailRecipients, send: sendEventEmail})
+}
+
+// emailRecipients returns who email-config.json mails an event to: the
+// approvers for approval requests, otherwise the people of the release and
+// the environment owner
+func emailRecipients(event releaseEvent) ([]string, error) {
+	cfg, ok, err := loadEmailConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok || !cfg.wants(event.Type) {
+		return nil, nil
+	}
+	if event.Type == eventApprovalRequested {
+		return cfg.Approvers, nil
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	refs := event.Release.assignees()
+	if owner := environmentOwner(envs, event.Environment); owner != "" {
+		refs = append(refs, owner)
+	}
+	return refs, nil
+}
+
+// sendEventEmail mails an event to people, teams or addresses
+func sendEventEmail(event releaseEvent, refs []string) error {
+	cfg, ok, err := loadEmailConfig()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok {
+		return errNotConfigured
+	}
+	team, err := loadTeam()
+	if err != nil {
+		return err
+	}
+	to := emailAddresses(team, withoutOptedOut(team, refs, event.Type))
+	if len(to) == 0 {
+		return nil
+	}
+	subject, body, err := mailTemplates(cfg, event.Type, eventMessage{event, cfg.BaseURL})
+	if err != nil || subject == "" {
+		return err
+	}
+	return sendEmail(cfg, to, subject, body)
+}
+
+// emailNotified is email-notified.json: the freezes already announced,
+// keyed by group and start date, and the week last digested, so restarts
+// don't mail them again
+type emailNotified struct {
+	Freezes map[string]string `json:"freezes"`          // group:from -> sent at
+	Digest  string            `json:"digest,omitempty"` // first day of the week last digested
+}
+
+// emailNotifiedMu serializes scheduled mail runs
+var emailNotifiedMu sync.Mutex
+
+// loadEmailNotified reads email-notified.json
+func loadEmailNotified() (emailNotified, error) {
+	state := emailNotified{Freezes: map[string]string{}}
+	err := readDataFile("email-notified.json", &state)
+	if state.Freezes == nil {
+		state.Freezes = map[string]string{}
+	}
+	return state, err
+}
+
+// save writes email-notified.json, a server-maintained file
+func (s emailNotified) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "email-notified.json"), data, 0644)
+}
+
+// sendFreezeNotices mails the owners of a group's environments and the
+// approvers about freezes starting within FreezeNoticeDays
+func sendFreezeNotices(now time.Time) error {
+	emailNotifiedMu.Lock()
+	defer emailNotifiedMu.Unlock()
+
+	cfg, ok, err := loadEmailConfig()
+	if err != nil || !ok || !cfg.wants(eventFreezeStarting) {
+		return err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return err
+	}
+	team, err := loadTeam()
+	if err != nil {
+		return err
+	}
+	state, err := loadEmailNotified()
+	if err != nil {
+		return err
+	}
+
+	today := now.Format(dateLayout)
+	horizon := now.AddDate(0, 0, cfg.FreezeNoticeDays).Format(dateLayout)
+	var errs []error
+	changed := false
+	for _, f := range envs.activeFreezes(now, now.AddDate(0, 0, cfg.FreezeNoticeDays)) {
+		key := f.Group + ":" + f.From
+		if f.From < today || f.From > horizon || state.Freezes[key] != "" {
+			continue
+		}
+		g, _ := envs.group(f.Group)
+		notice := freezeNotice{
+			Type:         eventFreezeStarting,
+			Group:        g.Name,
+			GroupName:    g.DisplayName,
+			From:         f.From,
+			To:           f.To,
+			Reason:       f.Reason,
+			Environments: envs.groupEnvironments(g.Name),
+			URL:          cfg.BaseURL,
+		}
+		if notice.GroupName == "" {
+			notice.GroupName = g.Name
+		}
+		refs := append([]string{}, cfg.Approvers...)
+		for _, env := range notice.Environments {
+			if owner := environmentOwner(envs, env); owner != "" {
+				refs = append(refs, owner)
+			}
+		}
+		if to := emailAddresses(team, withoutOptedOut(team, refs, eventFreezeStarting)); len(to) > 0 {
+			subject, body, err := mailTemplates(cfg, eventFreezeStarting, notice)
+			if err != nil {
+				return err
+			}
+			if err := sendEmail(cfg, to, subject, body); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				continue
+			}
+			logNotify.Info("Mailed freeze notice", "freeze", key, "recipients", len(to))
+		}
+		state.Freezes[key] = now.Format(time.RFC3339)
+		changed = true
+	}
+
+	// Forget freezes that are long over
+	for key := range state.Freezes {
+		if i := strings.LastIndex(key, ":"); i >= 0 && key[i+1:] < now.AddDate(0, -1, 0).Format(dateLayout) {
+			delete(state.Freezes, key)
+			changed = true
+		}
+	}
+	if changed {
+		if err := state.save(); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("freeze notices: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// runEmailSchedule sends the freeze notices and digests that are due
+func runEmailSchedule() {
+	for {
+		now := time.Now()
+		if err := sendFreezeNotices(now); err != nil {
+			logNotify.Error("Freeze notices failed", "err", err)
+		}
+		if err := sendDueDigest(now); err != nil {
+			logNotify.Error("Email digest failed", "err", err)
+		}
+		time.Sleep(10 * time.Minute)
+	}
+}
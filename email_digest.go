@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// digestMail is the template kind of the weekly digest in the subjects and
+// templates of email-config.json
+const digestMail = "digest"
+
+// EmailDigestConfig schedules the weekly digest of the coming week's
+// releases, holidays and freezes
+type EmailDigestConfig struct {
+	Recipients []string `json:"recipients,omitempty"` // person IDs, team names or addresses
+	Weekday    string   `json:"weekday,omitempty"`    // default Friday
+	Time       string   `json:"time,omitempty"`       // local HH:MM, default 14:00
+}
+
+// schedule returns when the digest of now's week is due
+func (c EmailDigestConfig) schedule(now time.Time) (time.Time, error) {
+	weekday := time.Friday
+	if c.Weekday != "" {
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(d.String(), c.Weekday) {
+				weekday, found = d, true
+			}
+		}
+		if !found {
+			return time.Time{}, fmt.Errorf("invalid digest weekday %q", c.Weekday)
+		}
+	}
+	at := c.Time
+	if at == "" {
+		at = "14:00"
+	}
+	t, err := time.ParseInLocation("15:04", at, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid digest time %q, expected HH:MM", c.Time)
+	}
+	day := now.AddDate(0, 0, int(weekday)-int(now.Weekday()))
+	return time.Date(day.Year(), day.Month(), day.Day(), t.Hour(), t.Minute(), 0, 0, time.Local), nil
+}
+
+// emailDigest is what digest templates are executed with
+type emailDigest struct {
+	From     string // Monday of the digested week
+	To       string // Sunday
+	Holidays []Holiday
+	Groups   []digestGroup
+	URL      string
+}
+
+// digestGroup is a top-level environment group, or the environments in no
+// group, with its releases and the freezes of it and its child groups
+type digestGroup struct {
+	Name     string
+	Releases []releaseEvent
+	Freezes  []appliedFreeze
+}
+
+// defaultDigestTemplate lists the groups, then the holidays of the week
+const defaultDigestTemplate = `Releases from {{.From}} to {{.To}}
+{{range .Groups}}
+{{.Name}}
+{{range .Freezes}}  Freeze {{.From}} to {{.To}}{{if .Reason}}: {{.Reason}}{{end}}
+{{end}}{{range .Releases}}  {{.Date}} {{.EnvironmentName}}: {{.Name}} ({{.Status}}){{if .Window}} {{.Window}}{{end}}
+{{else}}  No releases
+{{end}}{{end}}{{if .Holidays}}
+Holidays
+{{range .Holidays}}  {{.Date}} {{.Name}}
+{{end}}{{end}}{{if .URL}}
+{{.URL}}
+{{end}}`
+
+// nextWeek returns the Monday of the week after now
+func nextWeek(now time.Time) time.Time {
+	days := (8 - int(now.Weekday())) % 7
+	if days == 0 {
+		days = 7
+	}
+	y, m, d := now.AddDate(0, 0, days).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// buildEmailDigest collects the releases, holidays and freezes of the week
+// starting at from, by top-level environment group
+func buildEmailDigest(from time.Time, baseURL string) (emailDigest, error) {
+	to := from.AddDate(0, 0, 6)
+	digest := emailDigest{From: from.Format(dateLayout), To: to.Format(dateLayout), URL: baseURL}
+
+	releases, err := loadReleases()
+	if err != nil {
+		return digest, err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return digest, err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return digest, err
+	}
+	for _, h := range holidays.Holidays {
+		if inDateRange(h.Date, from, to) {
+			digest.Holidays = append(digest.Holidays, h)
+		}
+	}
+	sort.Slice(digest.Holidays, func(i, j int) bool { return digest.Holidays[i].Date < digest.Holidays[j].Date })
+
+	eventsOf := func(names []string) []releaseEvent {
+		var result []releaseEvent
+		for _, env := range names {
+			for _, e := range releases[env] {
+				if e.Status != "None" && inDateRange(e.Date, from, to) {
+					result = append(result, newReleaseEvent("", env, e, envs))
+				}
+			}
+		}
+		sort.SliceStable(result, func(i, j int) bool { return result[i].Date < result[j].Date })
+		return result
+	}
+
+	// Freezes of child groups are listed under their top-level group
+	root := func(name string) string {
+		seen := map[string]bool{}
+		for g, ok := envs.group(name); ok && g.Parent != "" && !seen[g.Name]; g, ok = envs.group(g.Parent) {
+			seen[g.Name] = true
+			name = g.Parent
+		}
+		return name
+	}
+	freezes := map[string][]appliedFreeze{}
+	for _, f := range envs.activeFreezes(from, to) {
+		freezes[root(f.Group)] = append(freezes[root(f.Group)], f)
+	}
+
+	grouped := map[string]bool{}
+	for _, g := range envs.Groups {
+		if g.Parent != "" {
+			continue
+		}
+		names := envs.groupEnvironments(g.Name)
+		for _, env := range names {
+			grouped[env] = true
+		}
+		name := g.DisplayName
+		if name == "" {
+			name = g.Name
+		}
+		digest.Groups = append(digest.Groups, digestGroup{Name: name, Releases: eventsOf(names), Freezes: freezes[g.Name]})
+	}
+	var rest []string
+	for _, env := range releases.sortedEnvironmentNames() {
+		if !grouped[env] {
+			rest = append(rest, env)
+		}
+	}
+	if other := eventsOf(rest); len(other) > 0 || len(envs.Groups) == 0 {
+		name := "Other environments"
+		if len(envs.Groups) == 0 {
+			name = "All environments"
+		}
+		digest.Groups = append(digest.Groups, digestGroup{Name: name, Releases: other})
+	}
+	return digest, nil
+}
+
+// sendEmailDigest mails the digest of the week starting at from
+func sendEmailDigest(cfg EmailConfig, from time.Time) error {
+	team, err := loadTeam()
+	if err != nil {
+		return err
+	}
+	to := emailAddresses(team, withoutOptedOut(team, cfg.Digest.Recipients, digestMail))
+	if len(to) == 0 {
+		return fmt.Errorf("no digest recipients with an email address")
+	}
+	digest, err := buildEmailDigest(from, cfg.BaseURL)
+	if err != nil {
+		return err
+	}
+	subject, body, err := mailTemplates(cfg, digestMail, digest)
+	if err != nil {
+		return err
+	}
+	return sendEmail(cfg, to, subject, body)
+}
+
+// sendDueDigest mails the digest of next week once it is due, at most once
+// per week
+func sendDueDigest(now time.Time) error {
+	emailNotifiedMu.Lock()
+	defer emailNotifiedMu.Unlock()
+
+	cfg, ok, err := loadEmailConfig()
+	if err != nil || !ok || len(cfg.Digest.Recipients) == 0 {
+		return err
+	}
+	due, err := cfg.Digest.schedule(now)
+	if err != nil || now.Before(due) {
+		return err
+	}
+	state, err := loadEmailNotified()
+	if err != nil {
+		return err
+	}
+	from := nextWeek(now)
+	week := from.Format(dateLayout)
+	if state.Digest >= week {
+		return nil
+	}
+	if err := sendEmailDigest(cfg, from); err != nil {
+		return err
+	}
+	logNotify.Info("Mailed digest", "week", week)
+	state.Digest = week
+	return state.save()
+}
+
+// Handle the weekly email digest: GET renders next week's digest, POST
+// mails it to the digest recipients now
+func handleEmailDigest(w http.ResponseWriter, r *http.Request) {
+	cfg, ok, err := loadEmailConfig()
+	if err != nil {
+		http.Error(w, "Invalid email config", http.StatusInternalServerError)
+		return
+	}
+	from := nextWeek(time.Now())
+
+	switch r.Method {
+	case http.MethodGet:
+		digest, err := buildEmailDigest(from, cfg.BaseURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error building digest: %v", err), http.StatusInternalServerError)
+			return
+		}
+		subject, body, err := mailTemplates(cfg, digestMail, digest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "Subject: %s\n\n%s", subject, body)
+
+	case http.MethodPost:
+		if !ok {
+			http.Error(w, "Email is not configured", http.StatusConflict)
+			return
+		}
+		if err := sendEmailDigest(cfg, from); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
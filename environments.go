@@ -0,0 +1,551 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment names are used as keys in releases.json and in "env:date" references
+var environmentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Colors are written as #rgb or #rrggbb like the rest of environments.json
+var hexColorPattern = regexp.MustCompile(`^#([0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// validateEnvironment checks a single environment record
+func validateEnvironment(env Environment) error {
+	if !environmentNamePattern.MatchString(env.Name) {
+		return fmt.Errorf("invalid environment name %q: use letters, digits, '-' and '_'", env.Name)
+	}
+	if env.Tier != "" && !environmentTiers[env.Tier] {
+		return fmt.Errorf("environment %s: tier must be one of critical, high, medium, low", env.Name)
+	}
+	if env.Color != "" && !hexColorPattern.MatchString(env.Color) {
+		return fmt.Errorf("environment %s: color must be a hex color like #1e90ff", env.Name)
+	}
+	if env.URL != "" {
+		u, err := url.Parse(env.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("environment %s: url must be an absolute http(s) URL", env.Name)
+		}
+	}
+	return nil
+}
+
+// validateEnvironments checks the environments array of environments.json
+func validateEnvironments(v interface{}) error {
+	var envs []Environment
+	if err := decodeInto(v, &envs); err != nil {
+		return fmt.Errorf("environments must be an array of environment objects")
+	}
+	seen := map[string]bool{}
+	for _, env := range envs {
+		if err := validateEnvironment(env); err != nil {
+			return err
+		}
+		if seen[env.Name] {
+			return fmt.Errorf("duplicate environment name %q", env.Name)
+		}
+		seen[env.Name] = true
+	}
+	return nil
+}
+
+// environmentRequest is the body of POST/PUT /api/environments/{name}
+type environmentRequest struct {
+	Environment
+	Colors *ColorConfig `json:"colors,omitempty"`
+}
+
+// maxBackupsFromRequest reads the X-Max-Backups header, falling back to the default
+func maxBackupsFromRequest(r *http.Request) int {
+	if v := r.Header.Get("X-Max-Backups"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxBackups
+}
+
+// environmentsDocument is environments.json decoded just far enough to edit
+// single records while leaving every other key untouched
+type environmentsDocument struct {
+	raw          map[string]json.RawMessage
+	environments []Environment
+	colors       map[string]ColorConfig
+	groups       []EnvironmentGroup
+	etag         string
+}
+
+// loadEnvironmentsDocument reads environments.json for a record-level edit
+func loadEnvironmentsDocument() (*environmentsDocument, error) {
+	data, err := os.ReadFile(filepath.Join(dataDir, "environments.json"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	doc := &environmentsDocument{raw: map[string]json.RawMessage{}, colors: map[string]ColorConfig{}}
+	if err == nil {
+		doc.etag = computeETag(data)
+		if err := json.Unmarshal(data, &doc.raw); err != nil {
+			return nil, fmt.Errorf("environments.json: %w", err)
+		}
+	}
+	if v, ok := doc.raw["environments"]; ok {
+		if err := json.Unmarshal(v, &doc.environments); err != nil {
+			return nil, fmt.Errorf("environments.json: %w", err)
+		}
+	}
+	if v, ok := doc.raw["releaseEnvironments"]; ok {
+		if err := json.Unmarshal(v, &doc.colors); err != nil {
+			return nil, fmt.Errorf("environments.json: %w", err)
+		}
+	}
+	if v, ok := doc.raw["groups"]; ok {
+		if err := json.Unmarshal(v, &doc.groups); err != nil {
+			return nil, fmt.Errorf("environments.json: %w", err)
+		}
+	}
+	return doc, nil
+}
+
+// find returns the index of the named environment or -1
+func (d *environmentsDocument) find(name string) int {
+	for i, env := range d.environments {
+		if env.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the document back through the regular backup path as changed
+// by a user, failing if the file changed since it was loaded
+func (d *environmentsDocument) save(ctx context.Context, maxBackups int, by string) (string, error) {
+	envs, _ := json.Marshal(d.environments)
+	colors, _ := json.Marshal(d.colors)
+	d.raw["environments"] = envs
+	d.raw["releaseEnvironments"] = colors
+	if len(d.groups) > 0 {
+		groups, _ := json.Marshal(d.groups)
+		d.raw["groups"] = groups
+	} else {
+		delete(d.raw, "groups")
+	}
+
+	var generic interface{}
+	b, _ := json.Marshal(d.raw)
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return "", err
+	}
+	return writeJSONFile(ctx, filepath.Join(dataDir, "environments.json"), generic, d.etag, maxBackups, by)
+}
+
+// environmentReferences lists the releases that belong to or depend on an
+// environment, and the groups containing it
+func environmentReferences(name string) ([]string, error) {
+	releases, err := loadReleases()
+	if err != nil {
+		return nil, err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, g := range envs.Groups {
+		for _, member := range g.Environments {
+			if member == name {
+				refs = append(refs, "group:"+g.Name)
+			}
+		}
+	}
+	for env, entries := range releases {
+		for _, e := range entries {
+			depEnv, _, _ := parseReleaseID(e.DependsOn)
+			if env == name || depEnv == name {
+				refs = append(refs, releaseID(env, e.Date))
+			}
+		}
+	}
+	return refs, nil
+}
+
+// Handle a single environment record: GET, POST (create), PUT (update), DELETE
+func handleEnvironmentRecord(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	doc, err := loadEnvironmentsDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading environments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	idx := doc.find(name)
+
+	if r.Method != http.MethodGet {
+		if err := authorizeEnvironments(r, name); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if idx < 0 {
+			http.Error(w, "Environment not found", http.StatusNotFound)
+			return
+		}
+		writeEnvironmentRecord(w, doc, idx, doc.etag, http.StatusOK)
+
+	case http.MethodPost, http.MethodPut:
+		var req environmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Name == "" {
+			req.Name = name
+		}
+		if req.Name != name {
+			http.Error(w, "Environment name in body does not match the URL", http.StatusBadRequest)
+			return
+		}
+		if err := validateEnvironment(req.Environment); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.DisplayName == "" {
+			req.DisplayName = name
+		}
+		// Locks are taken and released through /lock, not set here
+		req.Lock = nil
+
+		if r.Method == http.MethodPost {
+			if idx >= 0 {
+				http.Error(w, "Environment already exists", http.StatusConflict)
+				return
+			}
+			for _, env := range doc.environments {
+				if strings.EqualFold(env.Name, name) {
+					http.Error(w, fmt.Sprintf("Environment name conflicts with %q", env.Name), http.StatusConflict)
+					return
+				}
+			}
+			doc.environments = append(doc.environments, req.Environment)
+			idx = len(doc.environments) - 1
+		} else {
+			if idx < 0 {
+				http.Error(w, "Environment not found", http.StatusNotFound)
+				return
+			}
+			req.Lock = doc.environments[idx].Lock
+			doc.environments[idx] = req.Environment
+		}
+		if req.Colors != nil {
+			doc.colors[name] = *req.Colors
+		}
+
+		etag, err := doc.save(r.Context(), maxBackupsFromRequest(r), requestUser(r))
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		writeEnvironmentRecord(w, doc, idx, etag, status)
+
+	case http.MethodDelete:
+		if idx < 0 {
+			http.Error(w, "Environment not found", http.StatusNotFound)
+			return
+		}
+		refs, err := environmentReferences(name)
+		if err != nil {
+			http.Error(w, "Error reading releases", http.StatusInternalServerError)
+			return
+		}
+		if len(refs) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":        "Environment is still referenced",
+				"referencedBy": refs,
+			})
+			return
+		}
+
+		doc.environments = append(doc.environments[:idx], doc.environments[idx+1:]...)
+		delete(doc.colors, name)
+		etag, err := doc.save(r.Context(), maxBackupsFromRequest(r), requestUser(r))
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		writeSuccess(w, r, "Environment deleted successfully")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// writeEnvironmentRecord responds with a single environment and its colors
+func writeEnvironmentRecord(w http.ResponseWriter, doc *environmentsDocument, idx int, etag string, status int) {
+	resp := environmentRequest{Environment: doc.environments[idx]}
+	if c, ok := doc.colors[resp.Name]; ok {
+		resp.Colors = &c
+	}
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// environment returns the named environment
+func (d EnvironmentsData) environment(name string) (Environment, bool) {
+	for _, env := range d.Environments {
+		if env.Name == name {
+			return env, true
+		}
+	}
+	return Environment{}, false
+}
+
+// lockRequest is the body of POST /api/environments/{name}/lock
+type lockRequest struct {
+	Reason      string `json:"reason"`
+	Maintenance bool   `json:"maintenance"`
+	Until       string `json:"until"`
+}
+
+// Handle environment locks: GET shows the lock, POST locks, DELETE unlocks
+func handleEnvironmentLock(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	doc, err := loadEnvironmentsDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading environments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	idx := doc.find(name)
+	if idx < 0 {
+		http.Error(w, "Environment not found", http.StatusNotFound)
+		return
+	}
+	env := &doc.environments[idx]
+
+	if r.Method != http.MethodGet {
+		if err := authorizeEnvironments(r, name); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"environment": name,
+			"locked":      env.Lock.active(time.Now()),
+			"lock":        env.Lock,
+		})
+		return
+
+	case http.MethodPost:
+		var req lockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if strings.TrimSpace(req.Reason) == "" {
+			http.Error(w, "Missing lock reason", http.StatusBadRequest)
+			return
+		}
+		if req.Until != "" {
+			until, err := time.Parse(time.RFC3339, req.Until)
+			if err != nil {
+				http.Error(w, "Invalid 'until', expected an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			if !until.After(time.Now()) {
+				http.Error(w, "'until' must be in the future", http.StatusBadRequest)
+				return
+			}
+		}
+		env.Lock = &EnvironmentLock{
+			Reason:      req.Reason,
+			Maintenance: req.Maintenance,
+			LockedAt:    time.Now().Format(time.RFC3339),
+			Until:       req.Until,
+		}
+		logServer.InfoContext(r.Context(), "Locking environment", "environment", name, "reason", req.Reason, "by", modifierName(requestUser(r)))
+
+	case http.MethodDelete:
+		if env.Lock == nil {
+			http.Error(w, "Environment is not locked", http.StatusNotFound)
+			return
+		}
+		env.Lock = nil
+		logServer.InfoContext(r.Context(), "Unlocking environment", "environment", name, "by", modifierName(requestUser(r)))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	etag, err := doc.save(r.Context(), maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	writeEnvironmentRecord(w, doc, idx, etag, http.StatusOK)
+}
+
+// cloneRequest is the body of POST /api/environments/{name}/clone
+type cloneRequest struct {
+	Name            string `json:"name"`
+	DisplayName     string `json:"displayName"`
+	IncludeReleases bool   `json:"includeReleases"`
+}
+
+// Handle cloning an environment's configuration, group memberships and
+// optionally its future releases under a new name. Releases that couldn't be
+// copied leave the clone in place, with copyError in the response.
+func handleEnvironmentClone(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	source := r.PathValue("name")
+
+	var req cloneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := authorizeEnvironments(r, req.Name); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	doc, err := loadEnvironmentsDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading environments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	idx := doc.find(source)
+	if idx < 0 {
+		http.Error(w, "Environment not found", http.StatusNotFound)
+		return
+	}
+	for _, env := range doc.environments {
+		if strings.EqualFold(env.Name, req.Name) {
+			http.Error(w, "Environment already exists", http.StatusConflict)
+			return
+		}
+	}
+
+	clone := doc.environments[idx]
+	clone.Name = req.Name
+	clone.DisplayName = req.DisplayName
+	if clone.DisplayName == "" {
+		clone.DisplayName = req.Name
+	}
+	clone.Lock = nil
+	if err := validateEnvironment(clone); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	doc.environments = append(doc.environments, clone)
+	if c, ok := doc.colors[source]; ok {
+		doc.colors[clone.Name] = c
+	}
+	for i, g := range doc.groups {
+		for _, member := range g.Environments {
+			if member == source {
+				doc.groups[i].Environments = append(doc.groups[i].Environments, clone.Name)
+				break
+			}
+		}
+	}
+
+	maxBackups := maxBackupsFromRequest(r)
+	etag, err := doc.save(r.Context(), maxBackups, requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{"environment": clone, "copiedReleases": 0}
+	if req.IncludeReleases {
+		copied, err := cloneFutureReleases(r.Context(), source, clone.Name, maxBackups, requestUser(r))
+		if err != nil {
+			logServer.ErrorContext(r.Context(), "Clone of an environment: copying releases failed", "source", source, "target", clone.Name, "err", err)
+			resp["copyError"] = err.Error()
+		}
+		resp["copiedReleases"] = copied
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// cloneFutureReleases copies releases from today onwards from one
+// environment to another, rewriting same-environment dependencies
+func cloneFutureReleases(ctx context.Context, source, target string, maxBackups int, by string) (int, error) {
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return 0, err
+	}
+
+	from := today().Format(dateLayout)
+	items, _ := doc[source].([]interface{})
+	existing, _ := doc[target].([]interface{})
+	copied := 0
+	for _, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if date, _ := entry["date"].(string); date < from {
+			continue
+		}
+		dup := map[string]interface{}{}
+		for k, v := range entry {
+			dup[k] = v
+		}
+		// History belongs to the original release
+		for _, field := range trackedReleaseFields {
+			delete(dup, field)
+		}
+		if dep, _ := dup["dependsOn"].(string); dep != "" {
+			if depEnv, depDate, ok := parseReleaseID(dep); ok && depEnv == source {
+				dup["dependsOn"] = releaseID(target, depDate)
+			}
+		}
+		existing = append(existing, dup)
+		copied++
+	}
+	if copied == 0 {
+		return 0, nil
+	}
+	doc[target] = existing
+
+	_, err = writeJSONFile(ctx, filepath.Join(dataDir, "releases.json"), doc, etag, maxBackups, by)
+	return copied, err
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// featureState is an optional subsystem in GET /api/features
+type featureState struct {
+	Enabled bool   `json:"enabled"`
+	Config  string `json:"config,omitempty"` // the file configuring it
+	Detail  string `json:"detail,omitempty"` // e.g. how users log in
+	Error   string `json:"error,omitempty"`  // its config can't be read
+}
+
+// featureChecks tell whether the optional subsystems are configured, from
+// their config files
+var featureChecks = []struct {
+	name, config string
+	check        func() (bool, error)
+}{
+	{"jira", "jira-config.json", func() (bool, error) {
+		cfg, err := loadJiraConfig()
+		baseURL, _ := cfg["baseUrl"].(string)
+		apiToken, _ := cfg["apiToken"].(string)
+		return baseURL != "" && apiToken != "", err
+	}},
+	{"github", "github-config.json", func() (bool, error) { _, ok, err := loadGitHubConfig(); return ok, err }},
+	{"gitlab", "gitlab-config.json", func() (bool, error) { _, ok, err := loadGitLabConfig(); return ok, err }},
+	{"linear", "linear-config.json", func() (bool, error) { _, ok, err := loadLinearConfig(); return ok, err }},
+	{"trello", "trello-config.json", func() (bool, error) { _, ok, err := loadTrelloConfig(); return ok, err }},
+	{"ado", "ado-config.json", func() (bool, error) { _, ok, err := loadADOConfig(); return ok, err }},
+	{"confluence", "confluence-config.json", func() (bool, error) { _, ok, err := loadConfluenceConfig(); return ok, err }},
+	{"jenkins", "jenkins-config.json", func() (bool, error) { _, ok, err := loadJenkinsConfig(); return ok, err }},
+	{"kubernetes", "kubernetes-config.json", func() (bool, error) { _, ok, err := loadKubernetesConfig(); return ok, err }},
+	{"argocd", "argocd-config.json", func() (bool, error) { _, ok, err := loadArgoCDConfig(); return ok, err }},
+	{"servicenow", "servicenow-config.json", func() (bool, error) { _, ok, err := loadServiceNowConfig(); return ok, err }},
+	{"statuspage", "statuspage-config.json", func() (bool, error) { _, ok, err := loadStatusPageConfig(); return ok, err }},
+	{"maintenance", "maintenance-config.json", func() (bool, error) { _, ok, err := loadMaintenanceConfig(); return ok, err }},
+	{"email", "email-config.json", func() (bool, error) { _, ok, err := loadEmailConfig(); return ok, err }},
+	{"slack", "slack-config.json", func() (bool, error) { _, ok, err := loadSlackConfig(); return ok, err }},
+	{"teams", "teams-config.json", func() (bool, error) { _, ok, err := loadTeamsConfig(); return ok, err }},
+	{"webhooks", "webhooks-config.json", func() (bool, error) { _, ok, err := loadWebhooksConfig(); return ok, err }},
+	{"inbound", "inbound-config.json", func() (bool, error) { _, ok, err := loadInboundConfig(); return ok, err }},
+	{"public", "public-config.json", func() (bool, error) { _, ok, err := loadPublicConfig(); return ok, err }},
+	{"saml", "saml-config.json", func() (bool, error) { _, ok, err := loadSAMLConfig(); return ok, err }},
+	{"grpc", "grpc-config.json", func() (bool, error) {
+		var cfg GRPCConfig
+		err := readDataFile("grpc-config.json", &cfg)
+		return cfg.Listen != "", err
+	}},
+	{"tracing", "tracing-config.json", func() (bool, error) {
+		var cfg TracingConfig
+		err := readDataFile("tracing-config.json", &cfg)
+		return cfg.Endpoint != "", err
+	}},
+	{"hooks", "hooks-config.json", func() (bool, error) {
+		cfg, err := loadHooksConfig()
+		return len(cfg.PreSave)+len(cfg.PostSave) > 0, err
+	}},
+	{"plugins", "plugins-config.json", func() (bool, error) {
+		var cfg PluginsConfig
+		err := readDataFile("plugins-config.json", &cfg)
+		return len(cfg.Plugins) > 0, err
+	}},
+	{"cloudExport", "cloud-export-config.json", func() (bool, error) { _, ok, err := loadCloudExportConfig(); return ok, err }},
+	{"datasets", "datasets-config.json", func() (bool, error) { cfg, err := loadDatasets(); return len(cfg.Datasets) > 0, err }},
+	{"cluster", "cluster-config.json", func() (bool, error) {
+		var cfg ClusterConfig
+		err := readDataFile("cluster-config.json", &cfg)
+		return cfg.Lock != "", err
+	}},
+	{"replication", "replication-config.json", func() (bool, error) { return standbyMode(), nil }},
+	{"webdav", "webdav-config.json", func() (bool, error) { cfg, err := loadWebDAVConfig(); return cfg.Enabled, err }},
+	{"workspaces", "workspaces-config.json", func() (bool, error) { return len(workspaces) > 0, nil }},
+}
+
+// notificationFeatures are the features delivering notifications
+var notificationFeatures = []string{"email", "slack", "teams", "webhooks"}
+
+// Handle reporting which optional subsystems are enabled, so the web app
+// and API clients can leave out what isn't configured rather than call it
+// and read errors
+func handleFeatures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	features := map[string]featureState{}
+	for _, f := range featureChecks {
+		enabled, err := f.check()
+		state := featureState{Enabled: enabled && err == nil, Config: f.config}
+		if err != nil {
+			state.Error = err.Error()
+		}
+		features[f.name] = state
+	}
+
+	notifications := featureState{Config: "notification-rules.json"}
+	var channels []string
+	for _, name := range notificationFeatures {
+		if features[name].Enabled {
+			channels = append(channels, name)
+		}
+	}
+	notifications.Enabled, notifications.Detail = len(channels) > 0, strings.Join(channels, ", ")
+	features["notifications"] = notifications
+
+	auth := featureState{Enabled: accountsEnabled(), Config: "users.json"}
+	switch {
+	case features["saml"].Enabled:
+		auth.Detail = "saml"
+	case auth.Enabled:
+		auth.Detail = "accounts"
+	}
+	features["auth"] = auth
+
+	langs, _ := filepath.Glob(filepath.Join(i18nDir, "*.json"))
+	for i, path := range langs {
+		langs[i] = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	features["i18n"] = featureState{Enabled: len(langs) > 0, Detail: strings.Join(langs, ", ")}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(features)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitHubConfig is github-config.json, kept on disk only since it holds a
+// token. It lists the repositories whose issues and pull requests can be
+// linked to releases that use the GitHub ticket provider.
+type GitHubConfig struct {
+	Token           string              `json:"token"`
+	APIURL          string              `json:"apiUrl,omitempty"` // GitHub Enterprise: https://host/api/v3
+	Repos           []GitHubRepoFilter  `json:"repos"`
+	MaxTotalResults int                 `json:"maxTotalResults,omitempty"`
+	CacheTTLSeconds *int                `json:"cacheTTLSeconds,omitempty"`
+	Sync            githubSyncConfig    `json:"sync"`
+	Actions         githubActionsConfig `json:"actions"`
+}
+
+// GitHubRepoFilter selects the tickets of one repository
+type GitHubRepoFilter struct {
+	Repo      string   `json:"repo"` // owner/name
+	Labels    []string `json:"labels,omitempty"`
+	Milestone string   `json:"milestone,omitempty"` // title, "*" or "none"
+	State     string   `json:"state,omitempty"`     // open (default), closed or all
+	Include   string   `json:"include,omitempty"`   // issues, pulls or all (default)
+}
+
+// githubKeyPattern matches a ticket key such as owner/repo#123
+var githubKeyPattern = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+#[0-9]+$`)
+
+// githubCache holds the tickets of the configured repositories
+var githubCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// loadGitHubConfig reads github-config.json; ok is false when GitHub isn't configured
+func loadGitHubConfig() (cfg GitHubConfig, ok bool, err error) {
+	if err := readDataFile("github-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.github.com"
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return cfg, len(cfg.Repos) > 0, nil
+}
+
+// githubGet fetches a GitHub API path into out
+func githubGet(cfg GitHubConfig, path string, out interface{}) error {
+	return githubDo(cfg, http.MethodGet, path, nil, out)
+}
+
+// githubDo calls the GitHub API with an optional JSON body
+func githubDo(cfg GitHubConfig, method, path string, body, out interface{}) error {
+	req, err := http.NewRequest(method, cfg.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+	return doJSON(req, body, out)
+}
+
+// githubMilestone resolves a milestone title to the number the issues API
+// filters by; "*" and "none" pass through
+func githubMilestone(cfg GitHubConfig, repo, title string) (string, error) {
+	if title == "*" || title == "none" {
+		return title, nil
+	}
+	var milestones []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	}
+	if err := githubGet(cfg, "/repos/"+repo+"/milestones?state=all&per_page=100", &milestones); err != nil {
+		return "", err
+	}
+	for _, m := range milestones {
+		if m.Title == title {
+			return strconv.Itoa(m.Number), nil
+		}
+	}
+	return "", fmt.Errorf("%s has no milestone %q", repo, title)
+}
+
+// githubIssue is the part of a GitHub issue or pull request we use
+type githubIssue struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	State    string `json:"state"`
+	HTMLURL  string `json:"html_url"`
+	Assignee *struct {
+		Login string `json:"login"`
+	} `json:"assignee"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	PullRequest *struct {
+		MergedAt *string `json:"merged_at"`
+	} `json:"pull_request"`
+}
+
+// githubTicketFromIssue converts a GitHub issue to the Jira ticket format
+func githubTicketFromIssue(repo string, issue githubIssue) map[string]interface{} {
+	ticket := map[string]interface{}{
+		"key":      fmt.Sprintf("%s#%d", repo, issue.Number),
+		"summary":  issue.Title,
+		"status":   issue.State,
+		"url":      issue.HTMLURL,
+		"type":     "issue",
+		"provider": "github",
+	}
+	if issue.PullRequest != nil {
+		ticket["type"] = "pull"
+		if issue.PullRequest.MergedAt != nil {
+			ticket["status"] = "merged"
+		}
+	}
+	if issue.Assignee != nil {
+		ticket["assignee"] = issue.Assignee.Login
+	}
+	if issue.Milestone != nil {
+		ticket["milestone"] = issue.Milestone.Title
+	}
+	return ticket
+}
+
+// fetchGitHubTickets loads the issues and pull requests of all configured
+// repositories, up to maxTotalResults
+func fetchGitHubTickets(cfg GitHubConfig) ([]map[string]interface{}, error) {
+	limit := defaultJiraResultLimit
+	if cfg.MaxTotalResults > 0 {
+		limit = min(cfg.MaxTotalResults, jiraResultHardCap)
+	}
+
+	tickets := []map[string]interface{}{}
+	for _, repo := range cfg.Repos {
+		params := url.Values{}
+		params.Set("per_page", "100")
+		params.Set("state", repo.State)
+		if repo.State == "" {
+			params.Set("state", "open")
+		}
+		if len(repo.Labels) > 0 {
+			params.Set("labels", strings.Join(repo.Labels, ","))
+		}
+		if repo.Milestone != "" {
+			number, err := githubMilestone(cfg, repo.Repo, repo.Milestone)
+			if err != nil {
+				return nil, err
+			}
+			params.Set("milestone", number)
+		}
+
+		for page := 1; len(tickets) < limit; page++ {
+			params.Set("page", strconv.Itoa(page))
+			var issues []githubIssue
+			if err := githubGet(cfg, "/repos/"+repo.Repo+"/issues?"+params.Encode(), &issues); err != nil {
+				return nil, fmt.Errorf("%s: %w", repo.Repo, err)
+			}
+			for _, issue := range issues {
+				isPull := issue.PullRequest != nil
+				if (repo.Include == "issues" && isPull) || (repo.Include == "pulls" && !isPull) {
+					continue
+				}
+				tickets = append(tickets, githubTicketFromIssue(repo.Repo, issue))
+			}
+			if len(issues) < 100 {
+				break
+			}
+		}
+	}
+	if len(tickets) > limit {
+		logGitHub.Warn("GitHub search stopped early, raise maxTotalResults to fetch more", "tickets", limit)
+		tickets = tickets[:limit]
+	}
+	return tickets, nil
+}
+
+// cachedGitHubTickets returns the tickets of the configured repositories,
+// cached and served stale while GitHub is unavailable like Jira searches
+func cachedGitHubTickets(refresh bool) (jiraTicketsResult, error) {
+	cfg, ok, err := loadGitHubConfig()
+	if err != nil {
+		return jiraTicketsResult{}, &jiraError{http.StatusInternalServerError, "Invalid GitHub config"}
+	}
+	if !ok {
+		return jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "MISS"}, nil
+	}
+	ttl := defaultJiraCacheTTL
+	if cfg.CacheTTLSeconds != nil && *cfg.CacheTTLSeconds >= 0 {
+		ttl = time.Duration(*cfg.CacheTTLSeconds) * time.Second
+	}
+
+	cached, hit := githubCache.get("")
+	if hit && !refresh && time.Since(cached.fetchedAt) < ttl {
+		return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+	}
+	tickets, err := fetchGitHubTickets(cfg)
+	if err != nil {
+		logGitHub.Error("GitHub fetch failed", "err", err)
+		if hit {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, &jiraError{http.StatusBadGateway, fmt.Sprintf("GitHub API error: %v", err)}
+	}
+	entry := githubCache.put("", tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// enrichGitHubTickets looks linked owner/repo#123 keys up in the GitHub cache
+func enrichGitHubTickets(keys []string) []map[string]interface{} {
+	result, _ := cachedGitHubTickets(false)
+	return lookupTickets(keys, result, "github")
+}
+
+// githubProvider serves releases using the "github" ticket provider
+type githubProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "github", Name: "GitHub", ConfigFile: "github-config.json",
+		KeyFormat: "owner/repo#number", KeyExample: "owner/repo#123"}, githubProvider{})
+}
+
+func (githubProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	return cachedGitHubTickets(refresh)
+}
+
+func (githubProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	return enrichGitHubTickets(release.linkedTickets())
+}
+
+func (githubProvider) Link(key string) (string, bool) {
+	return key, githubKeyPattern.MatchString(key)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// githubActionsConfig is the "actions" section of github-config.json. A
+// release entering one of Statuses dispatches the workflow of its
+// environment; the run's conclusion sets the release's status.
+type githubActionsConfig struct {
+	Repo             string            `json:"repo"`                       // owner/name
+	Workflow         string            `json:"workflow,omitempty"`         // workflow file or ID
+	Workflows        map[string]string `json:"workflows,omitempty"`        // environment -> workflow, overriding Workflow
+	Ref              string            `json:"ref,omitempty"`              // default main
+	Statuses         []string          `json:"statuses,omitempty"`         // default In Progress
+	EnvironmentInput string            `json:"environmentInput,omitempty"` // default environment
+	VersionInput     string            `json:"versionInput,omitempty"`     // default version
+	Inputs           map[string]string `json:"inputs,omitempty"`           // extra inputs of every run
+	SuccessStatus    string            `json:"successStatus,omitempty"`    // default Done
+	FailureStatus    string            `json:"failureStatus,omitempty"`    // unchanged when empty
+	WebhookSecret    string            `json:"webhookSecret,omitempty"`    // for workflow_run webhooks
+	PollSeconds      int               `json:"pollIntervalSeconds,omitempty"`
+}
+
+// defaultWorkflowStatuses are the statuses that dispatch a workflow
+var defaultWorkflowStatuses = []string{"In Progress"}
+
+// workflowDispatchState is github-actions.json: the releases a workflow was
+// dispatched for, by release ID, until they leave the dispatching status
+type workflowDispatchState struct {
+	Dispatched map[string]string `json:"dispatched"` // release ID -> status
+}
+
+// githubActionsMu serializes dispatches so a run is never started twice
+var githubActionsMu sync.Mutex
+
+// loadGitHubActions returns the GitHub config when workflows are configured
+func loadGitHubActions() (GitHubConfig, bool, error) {
+	cfg, _, err := loadGitHubConfig()
+	if err != nil {
+		return cfg, false, err
+	}
+	a := &cfg.Actions
+	if a.Workflow == "" && len(a.Workflows) == 0 {
+		return cfg, false, nil
+	}
+	if a.Repo == "" {
+		return cfg, false, fmt.Errorf("GitHub Actions needs the repo of the workflows")
+	}
+	if a.Ref == "" {
+		a.Ref = "main"
+	}
+	if len(a.Statuses) == 0 {
+		a.Statuses = defaultWorkflowStatuses
+	}
+	if a.EnvironmentInput == "" {
+		a.EnvironmentInput = "environment"
+	}
+	if a.VersionInput == "" {
+		a.VersionInput = "version"
+	}
+	if a.SuccessStatus == "" {
+		a.SuccessStatus = "Done"
+	}
+	if a.PollSeconds <= 0 {
+		a.PollSeconds = 30
+	}
+	return cfg, true, nil
+}
+
+// workflow returns the workflow of an environment, empty when there is none
+func (c githubActionsConfig) workflow(env string) string {
+	if w, ok := c.Workflows[env]; ok {
+		return w
+	}
+	return c.Workflow
+}
+
+// loadWorkflowDispatchState reads github-actions.json
+func loadWorkflowDispatchState() (workflowDispatchState, error) {
+	var state workflowDispatchState
+	err := readDataFile("github-actions.json", &state)
+	if state.Dispatched == nil {
+		state.Dispatched = map[string]string{}
+	}
+	return state, err
+}
+
+// save writes github-actions.json, a server-maintained file
+func (s workflowDispatchState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "github-actions.json"), data, 0644)
+}
+
+// githubWorkflowRun is the part of a workflow run we use
+type githubWorkflowRun struct {
+	ID         int64  `json:"id"`
+	Status     string `json:"status"`     // queued, in_progress, completed...
+	Conclusion string `json:"conclusion"` // success, failure, cancelled... once completed
+	HTMLURL    string `json:"html_url"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// dispatchWorkflow starts a workflow run for a release. GitHub returns the
+// run's ID when asked to; older servers don't, and the run is found later.
+func dispatchWorkflow(cfg GitHubConfig, workflow string, inputs map[string]string) (string, error) {
+	var resp struct {
+		RunID int64 `json:"workflow_run_id"`
+	}
+	body := map[string]interface{}{"ref": cfg.Actions.Ref, "inputs": inputs, "return_run_details": true}
+	path := "/repos/" + cfg.Actions.Repo + "/actions/workflows/" + url.PathEscape(workflow) + "/dispatches"
+	if err := githubDo(cfg, http.MethodPost, path, body, &resp); err != nil && err != io.EOF {
+		return "", err
+	}
+	if resp.RunID == 0 {
+		return "", nil
+	}
+	return strconv.FormatInt(resp.RunID, 10), nil
+}
+
+// findWorkflowRun looks up the run a dispatch without run details started:
+// the earliest dispatched run of the workflow created since the trigger
+func findWorkflowRun(cfg GitHubConfig, d ReleaseDeployment) (githubWorkflowRun, bool, error) {
+	triggered, err := time.Parse(time.RFC3339, d.TriggeredAt)
+	if err != nil {
+		return githubWorkflowRun{}, false, err
+	}
+	params := url.Values{}
+	params.Set("event", "workflow_dispatch")
+	params.Set("branch", cfg.Actions.Ref)
+	params.Set("created", ">="+triggered.Add(-time.Minute).UTC().Format(time.RFC3339))
+	var runs struct {
+		WorkflowRuns []githubWorkflowRun `json:"workflow_runs"`
+	}
+	path := "/repos/" + cfg.Actions.Repo + "/actions/workflows/" + url.PathEscape(d.Job) + "/runs?" + params.Encode()
+	if err := githubGet(cfg, path, &runs); err != nil {
+		return githubWorkflowRun{}, false, err
+	}
+	var found githubWorkflowRun
+	for _, run := range runs.WorkflowRuns {
+		if run.CreatedAt >= triggered.UTC().Format(time.RFC3339) && (found.ID == 0 || run.CreatedAt < found.CreatedAt) {
+			found = run
+		}
+	}
+	return found, found.ID != 0, nil
+}
+
+// applyWorkflowRun records a run's progress on a deployment; status is the
+// release status a completed run leads to, empty to keep it
+func applyWorkflowRun(cfg githubActionsConfig, d ReleaseDeployment, run githubWorkflowRun) (next ReleaseDeployment, status string) {
+	next = d
+	next.ID, next.URL = strconv.FormatInt(run.ID, 10), run.HTMLURL
+	if run.Status != "completed" {
+		if run.Status != "queued" && run.Status != "waiting" && run.Status != "pending" {
+			next.Status = deploymentRunning
+		}
+		return next, ""
+	}
+	next.Status, next.Result = deploymentFinished, run.Conclusion
+	next.FinishedAt = time.Now().Format(time.RFC3339)
+	if run.Conclusion == "success" {
+		return next, cfg.SuccessStatus
+	}
+	return next, cfg.FailureStatus
+}
+
+func init() {
+	registerDeployer("github", githubDeployer{})
+}
+
+// githubDeployer dispatches GitHub Actions workflows with the environment
+// and version as inputs
+type githubDeployer struct{}
+
+// Target returns the workflow of the release's environment
+func (githubDeployer) Target(env string, release ReleaseEntry) (string, error) {
+	cfg, ok, err := loadGitHubActions()
+	if err != nil || !ok {
+		return "", err
+	}
+	return cfg.Actions.workflow(env), nil
+}
+
+// Trigger dispatches the workflow on the configured ref
+func (githubDeployer) Trigger(env string, release ReleaseEntry, d ReleaseDeployment, extra map[string]string) (ReleaseDeployment, error) {
+	cfg, ok, err := loadGitHubActions()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, err
+	}
+	inputs := map[string]string{}
+	for k, v := range cfg.Actions.Inputs {
+		inputs[k] = v
+	}
+	for k, v := range extra {
+		inputs[k] = v
+	}
+	inputs[cfg.Actions.EnvironmentInput] = env
+	if d.Version != "" {
+		inputs[cfg.Actions.VersionInput] = d.Version
+	}
+	d.Ref = cfg.Actions.Ref
+	d.ID, err = dispatchWorkflow(cfg, d.Job, inputs)
+	return d, err
+}
+
+// Poll reads the run back, finding it first when the dispatch didn't
+// return its ID
+func (githubDeployer) Poll(d ReleaseDeployment) (ReleaseDeployment, string, error) {
+	cfg, ok, err := loadGitHubActions()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, "", err
+	}
+	var run githubWorkflowRun
+	if d.ID != "" {
+		err = githubGet(cfg, "/repos/"+cfg.Actions.Repo+"/actions/runs/"+d.ID, &run)
+	} else {
+		var found bool
+		if run, found, err = findWorkflowRun(cfg, d); err == nil && !found {
+			return d, "", nil
+		}
+	}
+	if err != nil {
+		return d, "", err
+	}
+	next, status := applyWorkflowRun(cfg.Actions, d, run)
+	return next, status, nil
+}
+
+// PollInterval is pollIntervalSeconds of the actions section
+func (githubDeployer) PollInterval() time.Duration {
+	cfg, _, _ := loadGitHubActions()
+	return time.Duration(cfg.Actions.PollSeconds) * time.Second
+}
+
+// dispatchWorkflows starts the workflow of every release that entered a
+// dispatching status since the last check
+func dispatchWorkflows() error {
+	githubActionsMu.Lock()
+	defer githubActionsMu.Unlock()
+
+	cfg, ok, err := loadGitHubActions()
+	if err != nil || !ok {
+		return err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	state, err := loadWorkflowDispatchState()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	current := map[string]bool{}
+	var errs []error
+	for env, entries := range releases {
+		workflow := cfg.Actions.workflow(env)
+		for _, e := range entries {
+			id := releaseID(env, e.Date)
+			if workflow == "" || !anyOf(cfg.Actions.Statuses, e.Status) {
+				continue
+			}
+			current[id] = true
+			if state.Dispatched[id] == e.Status {
+				continue
+			}
+			state.Dispatched[id] = e.Status
+			changed = true
+			if _, err := startDeployment(context.Background(), env, e, "github", "", nil, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			}
+		}
+	}
+	// A release leaving the status is dispatched again when it reenters it
+	for id := range state.Dispatched {
+		if !current[id] {
+			delete(state.Dispatched, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := state.save(); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("GitHub Actions: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// dispatchWorkflowsOnChange is the data change hook dispatching workflows
+// in the background
+func dispatchWorkflowsOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := dispatchWorkflows(); err != nil {
+			logDeploy.Error("GitHub Actions dispatch failed", "err", err)
+		}
+	}()
+}
+
+// Handle GitHub webhooks: completed workflow_run events finish the
+// deployment of the release they were dispatched for without waiting for
+// the next poll
+func handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadGitHubActions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok || cfg.Actions.WebhookSecret == "" {
+		http.Error(w, "GitHub webhook secret is not configured", http.StatusForbidden)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	mac := hmac.New(sha256.New, []byte(cfg.Actions.WebhookSecret))
+	mac.Write(body)
+	if !hmac.Equal([]byte(r.Header.Get("X-Hub-Signature-256")), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+		http.Error(w, "Invalid webhook signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") != "workflow_run" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var event struct {
+		Action      string            `json:"action"`
+		WorkflowRun githubWorkflowRun `json:"workflow_run"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil || event.WorkflowRun.ID == 0 {
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	runID := strconv.FormatInt(event.WorkflowRun.ID, 10)
+	for env, entries := range releases {
+		for _, e := range entries {
+			if d := e.Deployment; d != nil && d.Provider == "github" && d.ID == runID {
+				next, status := applyWorkflowRun(cfg.Actions, *d, event.WorkflowRun)
+				if next == *d {
+					break
+				}
+				if err := saveReleaseDeployment(r.Context(), releaseID(env, e.Date), next, status); err != nil && err != errDeploymentDone {
+					writeSaveError(w, err)
+					return
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
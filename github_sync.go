@@ -0,0 +1,432 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubSyncConfig is the "sync" section of github-config.json. Releases are
+// pushed to one repository as milestones, GitHub Releases or both.
+type githubSyncConfig struct {
+	Repo              string   `json:"repo"` // owner/name
+	Milestones        bool     `json:"milestones"`
+	Releases          bool     `json:"releases"`
+	Statuses          []string `json:"statuses,omitempty"`
+	TagPrefix         string   `json:"tagPrefix,omitempty"` // GitHub Release tag: prefix + release name
+	PublishOnComplete bool     `json:"publishOnComplete"`
+}
+
+// githubSyncedMilestone is what was last pushed for a milestone, with the
+// progress GitHub reported for it
+type githubSyncedMilestone struct {
+	Title        string `json:"title"`
+	DueOn        string `json:"dueOn"`
+	Closed       bool   `json:"closed"`
+	OpenIssues   int    `json:"openIssues"`
+	ClosedIssues int    `json:"closedIssues"`
+}
+
+// percent is the share of the milestone's issues that are closed
+func (m githubSyncedMilestone) percent() int {
+	if total := m.OpenIssues + m.ClosedIssues; total > 0 {
+		return m.ClosedIssues * 100 / total
+	}
+	return 0
+}
+
+// githubSyncedRelease is what was last pushed for a GitHub Release
+type githubSyncedRelease struct {
+	Name  string `json:"name"`
+	Tag   string `json:"tag"`
+	Body  string `json:"body"`
+	Draft bool   `json:"draft"`
+}
+
+// githubSyncState is github-sync.json: milestones by number, releases by ID
+type githubSyncState struct {
+	Milestones map[string]githubSyncedMilestone `json:"milestones"`
+	Releases   map[string]githubSyncedRelease   `json:"releases"`
+	ProgressAt time.Time                        `json:"progressAt,omitempty"`
+}
+
+// githubSyncMu serializes syncs so nothing is created twice
+var githubSyncMu sync.Mutex
+
+// loadGitHubSyncState reads github-sync.json
+func loadGitHubSyncState() (githubSyncState, error) {
+	var state githubSyncState
+	err := readDataFile("github-sync.json", &state)
+	if state.Milestones == nil {
+		state.Milestones = map[string]githubSyncedMilestone{}
+	}
+	if state.Releases == nil {
+		state.Releases = map[string]githubSyncedRelease{}
+	}
+	return state, err
+}
+
+// save writes github-sync.json, server-maintained like jira-sync.json
+func (s githubSyncState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "github-sync.json"), data, 0644)
+}
+
+// githubMilestoneResponse is the part of a GitHub milestone we use
+type githubMilestoneResponse struct {
+	Number       int    `json:"number"`
+	Title        string `json:"title"`
+	State        string `json:"state"`
+	DueOn        string `json:"due_on"`
+	OpenIssues   int    `json:"open_issues"`
+	ClosedIssues int    `json:"closed_issues"`
+}
+
+// releaseGroup is every release sharing a name, which share a milestone and
+// a GitHub Release like they share a Jira fixVersion
+type releaseGroup struct {
+	name      string
+	entries   []map[string]interface{}
+	envs      []string
+	date      string // the latest date
+	done      bool
+	scheduled bool
+}
+
+// groupReleases groups the releases document by versionName
+func groupReleases(doc map[string]interface{}, statuses map[string]bool) []*releaseGroup {
+	groups := map[string]*releaseGroup{}
+	var names []string
+	for env, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			name := versionName(env, entry)
+			g := groups[name]
+			if g == nil {
+				g = &releaseGroup{name: name, done: true}
+				groups[name] = g
+				names = append(names, name)
+			}
+			g.entries = append(g.entries, entry)
+			g.envs = append(g.envs, env)
+			date, _ := entry["date"].(string)
+			if date > g.date {
+				g.date = date
+			}
+			status, _ := entry["status"].(string)
+			g.done = g.done && completedStatuses[status]
+			g.scheduled = g.scheduled || statuses[status]
+		}
+	}
+	sort.Strings(names)
+	list := make([]*releaseGroup, len(names))
+	for i, name := range names {
+		list[i] = groups[name]
+	}
+	return list
+}
+
+// groupField returns the value of a server-maintained field set on any
+// release of the group
+func groupField(g *releaseGroup, field string) string {
+	for _, entry := range g.entries {
+		if v, _ := entry[field].(string); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setGroupField sets a field on every release of the group and reports
+// whether any changed
+func setGroupField(g *releaseGroup, field, value string) bool {
+	changed := false
+	for _, entry := range g.entries {
+		if entry[field] != value {
+			entry[field] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// syncMilestones keeps one milestone per release name: its due date follows
+// the latest release and it is closed once all of them are done
+func syncMilestones(cfg GitHubConfig, groups []*releaseGroup, state githubSyncState) (bool, []error) {
+	docChanged := false
+	var errs []error
+	for _, g := range groups {
+		number := groupField(g, "githubMilestone")
+		if number == "" {
+			for n, m := range state.Milestones {
+				if m.Title == g.name {
+					number = n
+				}
+			}
+		}
+		if number == "" && !g.scheduled {
+			continue
+		}
+
+		envs := append([]string(nil), g.envs...)
+		sort.Strings(envs)
+		current, known := state.Milestones[number]
+		want := githubSyncedMilestone{Title: g.name, DueOn: g.date + "T00:00:00Z", Closed: g.done,
+			OpenIssues: current.OpenIssues, ClosedIssues: current.ClosedIssues}
+		if !known || current != want {
+			body := map[string]interface{}{
+				"title":       want.Title,
+				"due_on":      want.DueOn,
+				"state":       "open",
+				"description": "Planned for " + strings.Join(envs, ", "),
+			}
+			if want.Closed {
+				body["state"] = "closed"
+			}
+			method, path := http.MethodPatch, "/repos/"+cfg.Sync.Repo+"/milestones/"+number
+			if number == "" {
+				method, path = http.MethodPost, "/repos/"+cfg.Sync.Repo+"/milestones"
+			}
+			var saved githubMilestoneResponse
+			if err := githubDo(cfg, method, path, body, &saved); err != nil {
+				errs = append(errs, fmt.Errorf("milestone %s: %w", g.name, err))
+				continue
+			}
+			if number == "" {
+				logGitHub.Info("Created GitHub milestone", "milestone", g.name, "number", saved.Number)
+			}
+			number = strconv.Itoa(saved.Number)
+			want.OpenIssues, want.ClosedIssues = saved.OpenIssues, saved.ClosedIssues
+			state.Milestones[number] = want
+		}
+		docChanged = setGroupField(g, "githubMilestone", number) || docChanged
+	}
+	return docChanged, errs
+}
+
+// syncGitHubReleases keeps a draft GitHub Release per named release. The
+// tag is only created when the release is published, which happens once
+// every release of the name is done if publishOnComplete is set.
+func syncGitHubReleases(cfg GitHubConfig, groups []*releaseGroup, state githubSyncState) (bool, []error) {
+	docChanged := false
+	var errs []error
+	for _, g := range groups {
+		name, _ := g.entries[0]["releaseName"].(string)
+		if name == "" {
+			// Without a release name there is no tag to create
+			continue
+		}
+		id := groupField(g, "githubRelease")
+		if id == "" {
+			for rid, r := range state.Releases {
+				if r.Name == name {
+					id = rid
+				}
+			}
+		}
+		if id == "" && !g.scheduled {
+			continue
+		}
+
+		lines := []string{}
+		for i, entry := range g.entries {
+			date, _ := entry["date"].(string)
+			lines = append(lines, fmt.Sprintf("- %s: %s", g.envs[i], date))
+		}
+		sort.Strings(lines)
+		want := githubSyncedRelease{
+			Name:  name,
+			Tag:   cfg.Sync.TagPrefix + name,
+			Body:  "Planned releases:\n" + strings.Join(lines, "\n"),
+			Draft: !(cfg.Sync.PublishOnComplete && g.done),
+		}
+		if current, ok := state.Releases[id]; ok && (current == want || !current.Draft) {
+			// Published releases are left alone
+			docChanged = setGroupField(g, "githubRelease", id) || docChanged
+			continue
+		}
+
+		body := map[string]interface{}{"tag_name": want.Tag, "name": want.Name, "body": want.Body, "draft": want.Draft}
+		method, path := http.MethodPatch, "/repos/"+cfg.Sync.Repo+"/releases/"+id
+		if id == "" {
+			method, path = http.MethodPost, "/repos/"+cfg.Sync.Repo+"/releases"
+		}
+		var saved struct {
+			ID int64 `json:"id"`
+		}
+		if err := githubDo(cfg, method, path, body, &saved); err != nil {
+			errs = append(errs, fmt.Errorf("release %s: %w", name, err))
+			continue
+		}
+		if id == "" {
+			logGitHub.Info("Created GitHub release", "release", name, "id", saved.ID)
+		}
+		id = strconv.FormatInt(saved.ID, 10)
+		state.Releases[id] = want
+		docChanged = setGroupField(g, "githubRelease", id) || docChanged
+	}
+	return docChanged, errs
+}
+
+// refreshMilestoneProgress reads the issue counts of the synced milestones
+func refreshMilestoneProgress(cfg GitHubConfig, state *githubSyncState) error {
+	var milestones []githubMilestoneResponse
+	if err := githubGet(cfg, "/repos/"+cfg.Sync.Repo+"/milestones?state=all&per_page=100", &milestones); err != nil {
+		return err
+	}
+	for _, m := range milestones {
+		number := strconv.Itoa(m.Number)
+		if synced, ok := state.Milestones[number]; ok {
+			synced.OpenIssues, synced.ClosedIssues = m.OpenIssues, m.ClosedIssues
+			state.Milestones[number] = synced
+		}
+	}
+	state.ProgressAt = time.Now()
+	return nil
+}
+
+// loadGitHubSync returns the GitHub config when its sync section is enabled
+func loadGitHubSync() (GitHubConfig, bool, error) {
+	cfg, _, err := loadGitHubConfig()
+	if err != nil {
+		return cfg, false, err
+	}
+	if !cfg.Sync.Milestones && !cfg.Sync.Releases {
+		return cfg, false, nil
+	}
+	if cfg.Sync.Repo == "" {
+		return cfg, false, fmt.Errorf("GitHub sync needs a repo to create milestones and releases in")
+	}
+	if len(cfg.Sync.Statuses) == 0 {
+		cfg.Sync.Statuses = defaultMaintenanceStatuses
+	}
+	return cfg, true, nil
+}
+
+// syncGitHub pushes releases to GitHub milestones and Releases
+func syncGitHub() error {
+	githubSyncMu.Lock()
+	defer githubSyncMu.Unlock()
+
+	cfg, ok, err := loadGitHubSync()
+	if err != nil || !ok {
+		return err
+	}
+	statuses := map[string]bool{}
+	for _, s := range cfg.Sync.Statuses {
+		statuses[s] = true
+	}
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return err
+	}
+	state, err := loadGitHubSyncState()
+	if err != nil {
+		return err
+	}
+
+	groups := groupReleases(doc, statuses)
+	docChanged := false
+	var errs []error
+	if cfg.Sync.Milestones {
+		changed, failed := syncMilestones(cfg, groups, state)
+		docChanged, errs = docChanged || changed, append(errs, failed...)
+	}
+	if cfg.Sync.Releases {
+		changed, failed := syncGitHubReleases(cfg, groups, state)
+		docChanged, errs = docChanged || changed, append(errs, failed...)
+	}
+
+	// Save the state first so a failed releases write can reattach them
+	if err := state.save(); err != nil {
+		return err
+	}
+	if docChanged {
+		if _, err := writeJSONFile(withServerFields(context.Background()), filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, "sync:github"); err != nil {
+			return fmt.Errorf("saving GitHub references: %w", err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("GitHub sync: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// syncGitHubOnChange is the data change hook pushing release changes to
+// GitHub in the background
+func syncGitHubOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := syncGitHub(); err != nil {
+			logGitHub.Error("GitHub sync failed", "err", err)
+		}
+	}()
+}
+
+// githubMilestoneProgress is one entry of GET /api/github/milestones
+type githubMilestoneProgress struct {
+	Number       string `json:"number"`
+	Title        string `json:"title"`
+	DueOn        string `json:"dueOn"`
+	Closed       bool   `json:"closed"`
+	OpenIssues   int    `json:"openIssues"`
+	ClosedIssues int    `json:"closedIssues"`
+	Percent      int    `json:"percent"`
+}
+
+// Handle GitHub milestones: GET lists the synced milestones with their
+// completion, refreshed from GitHub once the cache TTL passed; POST runs a
+// sync now
+func handleGitHubMilestones(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := syncGitHub(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	githubSyncMu.Lock()
+	state, err := loadGitHubSyncState()
+	if err == nil && len(state.Milestones) > 0 {
+		if cfg, ok, _ := loadGitHubSync(); ok && (r.Method == http.MethodPost || time.Since(state.ProgressAt) >= defaultJiraCacheTTL) {
+			if perr := refreshMilestoneProgress(cfg, &state); perr != nil {
+				logGitHub.ErrorContext(r.Context(), "Refreshing GitHub milestone progress failed", "err", perr)
+			} else {
+				err = state.save()
+			}
+		}
+	}
+	githubSyncMu.Unlock()
+	if err != nil {
+		http.Error(w, "Error reading GitHub sync state", http.StatusInternalServerError)
+		return
+	}
+
+	list := []githubMilestoneProgress{}
+	for number, m := range state.Milestones {
+		list = append(list, githubMilestoneProgress{Number: number, Title: m.Title, DueOn: m.DueOn, Closed: m.Closed,
+			OpenIssues: m.OpenIssues, ClosedIssues: m.ClosedIssues, Percent: m.percent()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].DueOn < list[j].DueOn })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitLabConfig is gitlab-config.json, kept on disk only since it holds a
+// token. It lists the projects whose issues can be linked to releases that
+// use the GitLab ticket provider.
+type GitLabConfig struct {
+	URL             string                `json:"url"` // e.g. https://gitlab.example.com
+	Token           string                `json:"token"`
+	Projects        []GitLabProjectFilter `json:"projects"`
+	MaxTotalResults int                   `json:"maxTotalResults,omitempty"`
+	CacheTTLSeconds *int                  `json:"cacheTTLSeconds,omitempty"`
+	Pipelines       gitlabPipelinesConfig `json:"pipelines"`
+}
+
+// GitLabProjectFilter selects the issues of one project
+type GitLabProjectFilter struct {
+	Project   string   `json:"project"` // full path, e.g. group/sub/project
+	Labels    []string `json:"labels,omitempty"`
+	Milestone string   `json:"milestone,omitempty"` // title, "Any", "None", "Started" or "Upcoming"
+	State     string   `json:"state,omitempty"`     // opened (default), closed or all
+}
+
+// gitlabKeyPattern matches a ticket key such as group/project#12
+var gitlabKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)+#[0-9]+$`)
+
+// gitlabCache holds the issues of the configured projects
+var gitlabCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// loadGitLabConfig reads gitlab-config.json; ok is false when GitLab isn't configured
+func loadGitLabConfig() (cfg GitLabConfig, ok bool, err error) {
+	if err := readDataFile("gitlab-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.URL == "" {
+		cfg.URL = "https://gitlab.com"
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return cfg, len(cfg.Projects) > 0, nil
+}
+
+// gitlabGet fetches a GitLab API v4 path into out
+func gitlabGet(cfg GitLabConfig, path string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, cfg.URL+"/api/v4"+path, nil)
+	if err != nil {
+		return err
+	}
+	if cfg.Token != "" {
+		req.Header.Set("PRIVATE-TOKEN", cfg.Token)
+	}
+	return doJSON(req, nil, out)
+}
+
+// gitlabProjectPath is the API path of a project given by its full path
+func gitlabProjectPath(project string) string {
+	return "/projects/" + url.PathEscape(project)
+}
+
+// gitlabIssue is the part of a GitLab issue we use
+type gitlabIssue struct {
+	IID      int    `json:"iid"`
+	Title    string `json:"title"`
+	State    string `json:"state"`
+	WebURL   string `json:"web_url"`
+	Assignee *struct {
+		Username string `json:"username"`
+	} `json:"assignee"`
+	Milestone *struct {
+		Title string `json:"title"`
+	} `json:"milestone"`
+	Labels []string `json:"labels"`
+}
+
+// gitlabTicketFromIssue converts a GitLab issue to the Jira ticket format
+func gitlabTicketFromIssue(project string, issue gitlabIssue) map[string]interface{} {
+	ticket := map[string]interface{}{
+		"key":      fmt.Sprintf("%s#%d", project, issue.IID),
+		"summary":  issue.Title,
+		"status":   issue.State,
+		"url":      issue.WebURL,
+		"provider": "gitlab",
+	}
+	if issue.Assignee != nil {
+		ticket["assignee"] = issue.Assignee.Username
+	}
+	if issue.Milestone != nil {
+		ticket["milestone"] = issue.Milestone.Title
+	}
+	return ticket
+}
+
+// fetchGitLabIssues loads the issues of one project matching params
+func fetchGitLabIssues(cfg GitLabConfig, project string, params url.Values, limit int) ([]map[string]interface{}, error) {
+	tickets := []map[string]interface{}{}
+	params.Set("per_page", "100")
+	for page := 1; len(tickets) < limit; page++ {
+		params.Set("page", strconv.Itoa(page))
+		var issues []gitlabIssue
+		if err := gitlabGet(cfg, gitlabProjectPath(project)+"/issues?"+params.Encode(), &issues); err != nil {
+			return nil, fmt.Errorf("%s: %w", project, err)
+		}
+		for _, issue := range issues {
+			tickets = append(tickets, gitlabTicketFromIssue(project, issue))
+		}
+		if len(issues) < 100 {
+			break
+		}
+	}
+	return tickets, nil
+}
+
+// gitlabLimit is maxTotalResults bounded like the Jira setting
+func gitlabLimit(cfg GitLabConfig) int {
+	if cfg.MaxTotalResults > 0 {
+		return min(cfg.MaxTotalResults, jiraResultHardCap)
+	}
+	return defaultJiraResultLimit
+}
+
+// fetchGitLabTickets loads the issues of all configured projects
+func fetchGitLabTickets(cfg GitLabConfig) ([]map[string]interface{}, error) {
+	limit := gitlabLimit(cfg)
+	tickets := []map[string]interface{}{}
+	for _, p := range cfg.Projects {
+		params := url.Values{}
+		params.Set("state", p.State)
+		if p.State == "" {
+			params.Set("state", "opened")
+		}
+		if len(p.Labels) > 0 {
+			params.Set("labels", strings.Join(p.Labels, ","))
+		}
+		if p.Milestone != "" {
+			params.Set("milestone", p.Milestone)
+		}
+		issues, err := fetchGitLabIssues(cfg, p.Project, params, limit-len(tickets))
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, issues...)
+		if len(tickets) >= limit {
+			logGitLab.Warn("GitLab search stopped early, raise maxTotalResults to fetch more", "tickets", limit)
+			return tickets[:limit], nil
+		}
+	}
+	return tickets, nil
+}
+
+// gitlabTTL reads cacheTTLSeconds from the GitLab config
+func gitlabTTL(cfg GitLabConfig) time.Duration {
+	if cfg.CacheTTLSeconds != nil && *cfg.CacheTTLSeconds >= 0 {
+		return time.Duration(*cfg.CacheTTLSeconds) * time.Second
+	}
+	return defaultJiraCacheTTL
+}
+
+// cachedGitLabSearch returns a cached GitLab result, fetching it with fetch
+// once the TTL passed and serving it stale while GitLab is unavailable
+func cachedGitLabSearch(cfg GitLabConfig, key string, refresh bool, fetch func() ([]map[string]interface{}, error)) (jiraTicketsResult, error) {
+	cached, hit := gitlabCache.get(key)
+	if hit && !refresh && time.Since(cached.fetchedAt) < gitlabTTL(cfg) {
+		return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+	}
+	tickets, err := fetch()
+	if err != nil {
+		logGitLab.Error("GitLab fetch failed", "err", err)
+		if hit {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, &jiraError{http.StatusBadGateway, fmt.Sprintf("GitLab API error: %v", err)}
+	}
+	entry := gitlabCache.put(key, tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// cachedGitLabTickets returns the issues of the configured projects
+func cachedGitLabTickets(refresh bool) (jiraTicketsResult, error) {
+	cfg, ok, err := loadGitLabConfig()
+	if err != nil {
+		return jiraTicketsResult{}, &jiraError{http.StatusInternalServerError, "Invalid GitLab config"}
+	}
+	if !ok {
+		return jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "MISS"}, nil
+	}
+	return cachedGitLabSearch(cfg, "", refresh, func() ([]map[string]interface{}, error) {
+		return fetchGitLabTickets(cfg)
+	})
+}
+
+// gitlabMilestoneTickets returns the issues of every configured project in
+// the milestone with the given title, the GitLab counterpart of a fixVersion
+func gitlabMilestoneTickets(title string) (jiraTicketsResult, error) {
+	cfg, ok, err := loadGitLabConfig()
+	if err != nil || !ok {
+		return jiraTicketsResult{}, err
+	}
+	return cachedGitLabSearch(cfg, "milestone\x00"+title, false, func() ([]map[string]interface{}, error) {
+		tickets := []map[string]interface{}{}
+		for _, p := range cfg.Projects {
+			params := url.Values{}
+			params.Set("state", "all")
+			params.Set("milestone", title)
+			issues, err := fetchGitLabIssues(cfg, p.Project, params, gitlabLimit(cfg))
+			if err != nil {
+				return nil, err
+			}
+			tickets = append(tickets, issues...)
+		}
+		return tickets, nil
+	})
+}
+
+// gitlabReleaseTickets returns the tickets of a release using the GitLab
+// provider: the linked issues and those in the milestone named after it
+func gitlabReleaseTickets(release ReleaseEntry) []map[string]interface{} {
+	linked, _ := cachedGitLabTickets(false)
+	tickets := lookupTickets(release.linkedTickets(), linked, "gitlab")
+	if release.ReleaseName == "" {
+		return tickets
+	}
+	result, err := gitlabMilestoneTickets(release.ReleaseName)
+	if err != nil {
+		logGitLab.Error("Fetching GitLab milestone issues failed", "milestone", release.ReleaseName, "err", err)
+		return tickets
+	}
+	return appendNewTickets(tickets, result.tickets)
+}
+
+// gitlabProvider serves releases using the "gitlab" ticket provider
+type gitlabProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "gitlab", Name: "GitLab", ConfigFile: "gitlab-config.json",
+		KeyFormat: "group/project#number", KeyExample: "group/project#12"}, gitlabProvider{})
+}
+
+func (gitlabProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	return cachedGitLabTickets(refresh)
+}
+
+func (gitlabProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	return gitlabReleaseTickets(release)
+}
+
+func (gitlabProvider) Link(key string) (string, bool) {
+	return key, gitlabKeyPattern.MatchString(key)
+}
+
+// gitlabMilestone is one entry of GET /api/gitlab/milestones
+type gitlabMilestone struct {
+	Project  string   `json:"project"`
+	Title    string   `json:"title"`
+	State    string   `json:"state"`
+	DueDate  string   `json:"dueDate,omitempty"`
+	WebURL   string   `json:"url"`
+	Releases []string `json:"releases"`
+}
+
+// Handle GitLab milestones: the milestones of the configured projects, each
+// mapped to the releases named after it
+func handleGitLabMilestones(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadGitLabConfig()
+	if err != nil {
+		http.Error(w, "Invalid GitLab config", http.StatusInternalServerError)
+		return
+	}
+	milestones := []gitlabMilestone{}
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(milestones)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	byName := map[string][]string{}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if e.ReleaseName != "" {
+				byName[e.ReleaseName] = append(byName[e.ReleaseName], releaseID(env, e.Date))
+			}
+		}
+	}
+
+	for _, p := range cfg.Projects {
+		var list []struct {
+			Title   string `json:"title"`
+			State   string `json:"state"`
+			DueDate string `json:"due_date"`
+			WebURL  string `json:"web_url"`
+		}
+		if err := gitlabGet(cfg, gitlabProjectPath(p.Project)+"/milestones?per_page=100&state=active", &list); err != nil {
+			http.Error(w, fmt.Sprintf("GitLab API error: %v", err), http.StatusBadGateway)
+			return
+		}
+		for _, m := range list {
+			ids := byName[m.Title]
+			sort.Strings(ids)
+			if ids == nil {
+				ids = []string{}
+			}
+			milestones = append(milestones, gitlabMilestone{Project: p.Project, Title: m.Title, State: m.State, DueDate: m.DueDate, WebURL: m.WebURL, Releases: ids})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(milestones)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gitlabPipelinesConfig is the "pipelines" section of gitlab-config.json.
+// Deploying a release triggers a pipeline of its project with the project's
+// trigger token; the token of the config is needed to follow the pipeline.
+type gitlabPipelinesConfig struct {
+	Projects            map[string]string `json:"projects,omitempty"`      // environment -> project path
+	TriggerTokens       map[string]string `json:"triggerTokens,omitempty"` // project path -> pipeline trigger token
+	Ref                 string            `json:"ref,omitempty"`           // default main
+	EnvironmentVariable string            `json:"environmentVariable,omitempty"`
+	VersionVariable     string            `json:"versionVariable,omitempty"`
+	Variables           map[string]string `json:"variables,omitempty"`     // extra variables of every pipeline
+	SuccessStatus       string            `json:"successStatus,omitempty"` // release status after a successful pipeline; unchanged when empty
+	FailureStatus       string            `json:"failureStatus,omitempty"`
+	PollSeconds         int               `json:"pollIntervalSeconds,omitempty"`
+}
+
+// loadGitLabPipelines returns the GitLab config when pipeline triggers are
+// configured
+func loadGitLabPipelines() (GitLabConfig, bool, error) {
+	cfg, _, err := loadGitLabConfig()
+	if err != nil {
+		return cfg, false, err
+	}
+	p := &cfg.Pipelines
+	if len(p.TriggerTokens) == 0 {
+		return cfg, false, nil
+	}
+	if cfg.Token == "" {
+		return cfg, false, fmt.Errorf("GitLab pipelines need a token to read pipeline statuses")
+	}
+	if p.Ref == "" {
+		p.Ref = "main"
+	}
+	if p.EnvironmentVariable == "" {
+		p.EnvironmentVariable = "ENVIRONMENT"
+	}
+	if p.VersionVariable == "" {
+		p.VersionVariable = "VERSION"
+	}
+	if p.PollSeconds <= 0 {
+		p.PollSeconds = 30
+	}
+	return cfg, true, nil
+}
+
+// gitlabPipeline is the part of a GitLab pipeline we use
+type gitlabPipeline struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"` // created, pending, running, success, failed, canceled...
+	Ref    string `json:"ref"`
+	WebURL string `json:"web_url"`
+}
+
+// applyGitLabPipeline records a pipeline's progress on a deployment
+func applyGitLabPipeline(cfg gitlabPipelinesConfig, d ReleaseDeployment, p gitlabPipeline) (ReleaseDeployment, string) {
+	d.ID, d.URL = strconv.FormatInt(p.ID, 10), p.WebURL
+	switch p.Status {
+	case "success", "failed", "canceled", "skipped":
+		d.Status, d.Result = deploymentFinished, p.Status
+		d.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		if p.Status == "success" {
+			return d, cfg.SuccessStatus
+		}
+		return d, cfg.FailureStatus
+	case "running", "manual":
+		d.Status = deploymentRunning
+	}
+	return d, ""
+}
+
+func init() {
+	registerDeployer("gitlab", gitlabDeployer{})
+}
+
+// gitlabDeployer triggers GitLab pipelines with the environment and version
+// as variables
+type gitlabDeployer struct{}
+
+// Target returns the release's gitlabProject, else its environment's project
+func (gitlabDeployer) Target(env string, release ReleaseEntry) (string, error) {
+	cfg, ok, err := loadGitLabPipelines()
+	if err != nil || !ok {
+		return "", err
+	}
+	if release.GitLabProject != "" {
+		return release.GitLabProject, nil
+	}
+	return cfg.Pipelines.Projects[env], nil
+}
+
+// Trigger starts a pipeline with the project's trigger token on the
+// release's gitlabRef, else the configured ref
+func (gitlabDeployer) Trigger(env string, release ReleaseEntry, d ReleaseDeployment, extra map[string]string) (ReleaseDeployment, error) {
+	cfg, ok, err := loadGitLabPipelines()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, err
+	}
+	token := cfg.Pipelines.TriggerTokens[d.Job]
+	if token == "" {
+		return d, fmt.Errorf("no trigger token for project %s", d.Job)
+	}
+	d.Ref = release.GitLabRef
+	if d.Ref == "" {
+		d.Ref = cfg.Pipelines.Ref
+	}
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("ref", d.Ref)
+	for k, v := range cfg.Pipelines.Variables {
+		form.Set("variables["+k+"]", v)
+	}
+	for k, v := range extra {
+		form.Set("variables["+k+"]", v)
+	}
+	form.Set("variables["+cfg.Pipelines.EnvironmentVariable+"]", env)
+	if d.Version != "" {
+		form.Set("variables["+cfg.Pipelines.VersionVariable+"]", d.Version)
+	}
+	req, err := http.NewRequest(http.MethodPost, cfg.URL+"/api/v4"+gitlabProjectPath(d.Job)+"/trigger/pipeline", strings.NewReader(form.Encode()))
+	if err != nil {
+		return d, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var p gitlabPipeline
+	if err := doJSON(req, nil, &p); err != nil {
+		return d, err
+	}
+	d, _ = applyGitLabPipeline(cfg.Pipelines, d, p)
+	return d, nil
+}
+
+// Poll reads the pipeline back
+func (gitlabDeployer) Poll(d ReleaseDeployment) (ReleaseDeployment, string, error) {
+	cfg, ok, err := loadGitLabPipelines()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, "", err
+	}
+	var p gitlabPipeline
+	if err := gitlabGet(cfg, gitlabProjectPath(d.Job)+"/pipelines/"+d.ID, &p); err != nil {
+		return d, "", err
+	}
+	next, status := applyGitLabPipeline(cfg.Pipelines, d, p)
+	return next, status, nil
+}
+
+// PollInterval is pollIntervalSeconds of the pipelines section
+func (gitlabDeployer) PollInterval() time.Duration {
+	cfg, _, _ := loadGitLabPipelines()
+	return time.Duration(cfg.Pipelines.PollSeconds) * time.Second
+}
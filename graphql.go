@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/graphql-go/graphql"
+)
+
+// graphData loads the data files a GraphQL query asks for, each once per
+// query however many fields read it
+type graphData struct {
+	releases     ReleasesData
+	environments *EnvironmentsData
+	holidays     *HolidaysData
+	langs        []string // of the request, holidays are named in
+}
+
+func (d *graphData) loadReleases() (ReleasesData, error) {
+	if d.releases == nil {
+		releases, err := loadReleases()
+		if err != nil {
+			return nil, fmt.Errorf("reading releases: %w", err)
+		}
+		d.releases = releases
+	}
+	return d.releases, nil
+}
+
+func (d *graphData) loadEnvironments() (EnvironmentsData, error) {
+	if d.environments == nil {
+		envs, err := loadEnvironments()
+		if err != nil {
+			return EnvironmentsData{}, fmt.Errorf("reading environments: %w", err)
+		}
+		d.environments = &envs
+	}
+	return *d.environments, nil
+}
+
+func (d *graphData) loadHolidays() (HolidaysData, error) {
+	if d.holidays == nil {
+		holidays, err := loadHolidays()
+		if err != nil {
+			return HolidaysData{}, fmt.Errorf("reading holidays: %w", err)
+		}
+		holidays = localizeHolidays(holidays, d.langs)
+		d.holidays = &holidays
+	}
+	return *d.holidays, nil
+}
+
+// queryData is the data of the query being resolved
+func queryData(p graphql.ResolveParams) *graphData {
+	return p.Info.RootValue.(map[string]interface{})["data"].(*graphData)
+}
+
+// graphRelease is a release with the environment it belongs to; fields
+// other than id and environment resolve from the entry as in releases.json
+type graphRelease struct {
+	env   string
+	entry ReleaseEntry
+}
+
+func (g graphRelease) Resolve(p graphql.ResolveParams) (interface{}, error) {
+	switch p.Info.FieldName {
+	case "id":
+		return releaseID(g.env, g.entry.Date), nil
+	case "environment":
+		envs, err := queryData(p).loadEnvironments()
+		if err != nil {
+			return nil, err
+		}
+		if env, ok := envs.environment(g.env); ok {
+			return env, nil
+		}
+		return Environment{Name: g.env}, nil // releases of an environment since removed
+	}
+	p.Source = g.entry
+	return graphql.DefaultResolveFn(p)
+}
+
+// graphBackup is a backup of a data file
+type graphBackup struct {
+	Filename   string `json:"filename"`
+	ModifiedBy string `json:"modifiedBy,omitempty"`
+	ModifiedAt string `json:"modifiedAt,omitempty"`
+}
+
+// releaseFilter holds the arguments filtering releases
+type releaseFilter struct {
+	envs     map[string]bool // nil for every environment
+	from, to string
+	status   string
+	label    string
+	risk     string
+	assignee string
+}
+
+// releaseFilterArgs are the arguments of fields listing releases
+var releaseFilterArgs = graphql.FieldConfigArgument{
+	"from":     &graphql.ArgumentConfig{Type: graphql.String, Description: "Releases from this date on, YYYY-MM-DD"},
+	"to":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Releases until this date, YYYY-MM-DD"},
+	"status":   &graphql.ArgumentConfig{Type: graphql.String},
+	"label":    &graphql.ArgumentConfig{Type: graphql.String},
+	"risk":     &graphql.ArgumentConfig{Type: graphql.String},
+	"assignee": &graphql.ArgumentConfig{Type: graphql.String, Description: "Release manager or deployer"},
+}
+
+// parseReleaseFilter reads the filter arguments, rejecting malformed dates
+func parseReleaseFilter(args map[string]interface{}) (releaseFilter, error) {
+	f := releaseFilter{}
+	f.from, _ = args["from"].(string)
+	f.to, _ = args["to"].(string)
+	f.status, _ = args["status"].(string)
+	f.label, _ = args["label"].(string)
+	f.risk, _ = args["risk"].(string)
+	f.assignee, _ = args["assignee"].(string)
+	for _, d := range []string{f.from, f.to} {
+		if _, err := time.Parse(dateLayout, d); d != "" && err != nil {
+			return f, fmt.Errorf("invalid date %q, use YYYY-MM-DD", d)
+		}
+	}
+	return f, nil
+}
+
+// matches reports whether a release passes the filter
+func (f releaseFilter) matches(env string, e ReleaseEntry) bool {
+	switch {
+	case f.envs != nil && !f.envs[env],
+		f.from != "" && e.Date < f.from,
+		f.to != "" && e.Date > f.to,
+		f.status != "" && e.Status != f.status,
+		f.risk != "" && e.Risk != f.risk:
+		return false
+	}
+	if f.label != "" && !containsString(e.Labels, f.label) {
+		return false
+	}
+	return f.assignee == "" || containsString(e.assignees(), f.assignee)
+}
+
+// containsString reports whether list holds s
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// filterReleases lists the releases passing the filter by date, then
+// environment
+func filterReleases(releases ReleasesData, f releaseFilter) []graphRelease {
+	list := []graphRelease{}
+	for env, entries := range releases {
+		for _, e := range entries {
+			if f.matches(env, e) {
+				list = append(list, graphRelease{env: env, entry: e})
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].entry.Date != list[j].entry.Date {
+			return list[i].entry.Date < list[j].entry.Date
+		}
+		return list[i].env < list[j].env
+	})
+	return list
+}
+
+// objectType declares a GraphQL object whose fields resolve by their JSON
+// names, all strings but for those given a type
+func objectType(name string, fields []string, typed graphql.Fields) *graphql.Object {
+	all := graphql.Fields{}
+	for _, f := range fields {
+		all[f] = &graphql.Field{Type: graphql.String}
+	}
+	for f, field := range typed {
+		all[f] = field
+	}
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: all})
+}
+
+// stringList is a list of strings
+var stringList = graphql.NewList(graphql.String)
+
+// graphSchema is the schema of /api/graphql: read-only queries over the
+// planning data
+var graphSchema = func() graphql.Schema {
+	lockType := objectType("EnvironmentLock", []string{"reason", "lockedAt", "until"},
+		graphql.Fields{"maintenance": &graphql.Field{Type: graphql.Boolean}})
+	ticketType := objectType("Ticket", []string{"key", "summary", "status", "assignee", "priority", "type", "url", "provider"}, nil)
+	holidayType := objectType("Holiday", []string{"date", "name"}, nil)
+	backupType := objectType("Backup", []string{"filename", "modifiedBy", "modifiedAt"}, nil)
+	outcomeType := objectType("ReleaseOutcome", []string{"startedAt", "finishedAt", "result", "logsUrl", "notes", "recordedBy", "recordedAt"}, nil)
+	incidentType := objectType("ReleaseIncident", []string{"id", "url", "severity", "title", "linkedBy", "linkedAt"}, nil)
+	deploymentType := objectType("ReleaseDeployment", []string{"provider", "job", "ref", "id", "version", "status", "result", "url", "error", "triggeredBy", "triggeredAt", "finishedAt"}, nil)
+	rescheduleType := objectType("ReleaseReschedule", []string{"from", "to", "at"}, nil)
+	checklistType := objectType("ChecklistItem", []string{"text"}, graphql.Fields{"done": &graphql.Field{Type: graphql.Boolean}})
+	retrospectiveType := objectType("Retrospective", []string{"url", "recordedBy", "recordedAt"}, graphql.Fields{
+		"findings": &graphql.Field{Type: graphql.NewList(objectType("RetrospectiveFinding", []string{"category", "text"}, nil))},
+		"actionItems": &graphql.Field{Type: graphql.NewList(objectType("RetrospectiveActionItem", []string{"text", "owner", "ticket"},
+			graphql.Fields{"done": &graphql.Field{Type: graphql.Boolean}}))},
+	})
+
+	var environmentType *graphql.Object
+	releaseType := graphql.NewObject(graphql.ObjectConfig{Name: "Release", Fields: graphql.FieldsThunk(func() graphql.Fields {
+		return graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.String), Description: "environment:date"},
+			"environment": &graphql.Field{Type: graphql.NewNonNull(environmentType)},
+			"tickets": &graphql.Field{Type: graphql.NewList(ticketType), Description: "Linked tickets with their details from the ticket provider",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return releaseTickets(p.Source.(graphRelease).entry), nil
+				}},
+			"date": &graphql.Field{Type: graphql.String}, "status": &graphql.Field{Type: graphql.String},
+			"feTag": &graphql.Field{Type: graphql.String}, "beTag": &graphql.Field{Type: graphql.String},
+			"releaseName": &graphql.Field{Type: graphql.String}, "jiraTicket": &graphql.Field{Type: graphql.String},
+			"startTime": &graphql.Field{Type: graphql.String}, "endDateTime": &graphql.Field{Type: graphql.String},
+			"note": &graphql.Field{Type: graphql.String}, "dependsOn": &graphql.Field{Type: graphql.String},
+			"labels": &graphql.Field{Type: stringList}, "risk": &graphql.Field{Type: graphql.String},
+			"ticketProvider": &graphql.Field{Type: graphql.String},
+			"releaseManager": &graphql.Field{Type: graphql.String}, "deployers": &graphql.Field{Type: stringList},
+			"checklist":    &graphql.Field{Type: graphql.NewList(checklistType)},
+			"originalDate": &graphql.Field{Type: graphql.String}, "reschedules": &graphql.Field{Type: graphql.NewList(rescheduleType)},
+			"completedAt":   &graphql.Field{Type: graphql.String},
+			"deployment":    &graphql.Field{Type: deploymentType},
+			"outcome":       &graphql.Field{Type: outcomeType},
+			"retrospective": &graphql.Field{Type: retrospectiveType},
+			"incidents":     &graphql.Field{Type: graphql.NewList(incidentType)},
+			"modifiedBy":    &graphql.Field{Type: graphql.String}, "modifiedAt": &graphql.Field{Type: graphql.String},
+		}
+	})})
+	environmentType = objectType("Environment", []string{"name", "displayName", "owner", "description", "url", "tier", "color"}, graphql.Fields{
+		"visible": &graphql.Field{Type: graphql.Boolean},
+		"lock":    &graphql.Field{Type: lockType},
+		"groups": &graphql.Field{Type: stringList, Description: "Groups the environment belongs to, directly or through a child group",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				envs, err := queryData(p).loadEnvironments()
+				if err != nil {
+					return nil, err
+				}
+				names := []string{}
+				for _, g := range envs.groupsOf(p.Source.(Environment).Name) {
+					names = append(names, g.Name)
+				}
+				return names, nil
+			}},
+		"releases": &graphql.Field{Type: graphql.NewList(releaseType), Args: releaseFilterArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				f, err := parseReleaseFilter(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				releases, err := queryData(p).loadReleases()
+				if err != nil {
+					return nil, err
+				}
+				f.envs = map[string]bool{p.Source.(Environment).Name: true}
+				return filterReleases(releases, f), nil
+			}},
+	})
+
+	releasesArgs := graphql.FieldConfigArgument{
+		"environment": &graphql.ArgumentConfig{Type: graphql.String},
+		"group":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Releases of the group's environments"},
+	}
+	for name, arg := range releaseFilterArgs {
+		releasesArgs[name] = arg
+	}
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"environments": &graphql.Field{Type: graphql.NewList(environmentType),
+			Args: graphql.FieldConfigArgument{
+				"group":   &graphql.ArgumentConfig{Type: graphql.String},
+				"visible": &graphql.ArgumentConfig{Type: graphql.Boolean},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				envs, err := queryData(p).loadEnvironments()
+				if err != nil {
+					return nil, err
+				}
+				var inGroup map[string]bool
+				if group, ok := p.Args["group"].(string); ok {
+					if _, exists := envs.group(group); !exists {
+						return nil, fmt.Errorf("no group %q", group)
+					}
+					inGroup = map[string]bool{}
+					for _, name := range envs.groupEnvironments(group) {
+						inGroup[name] = true
+					}
+				}
+				list := []Environment{}
+				for _, env := range envs.Environments {
+					if visible, ok := p.Args["visible"].(bool); ok && env.Visible != visible {
+						continue
+					}
+					if inGroup == nil || inGroup[env.Name] {
+						list = append(list, env)
+					}
+				}
+				return list, nil
+			}},
+		"environment": &graphql.Field{Type: environmentType,
+			Args: graphql.FieldConfigArgument{"name": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				envs, err := queryData(p).loadEnvironments()
+				if err != nil {
+					return nil, err
+				}
+				if env, ok := envs.environment(p.Args["name"].(string)); ok {
+					return env, nil
+				}
+				return nil, nil
+			}},
+		"releases": &graphql.Field{Type: graphql.NewList(releaseType), Args: releasesArgs,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				f, err := parseReleaseFilter(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				if env, ok := p.Args["environment"].(string); ok {
+					f.envs = map[string]bool{env: true}
+				}
+				if group, ok := p.Args["group"].(string); ok {
+					envs, err := queryData(p).loadEnvironments()
+					if err != nil {
+						return nil, err
+					}
+					if _, exists := envs.group(group); !exists {
+						return nil, fmt.Errorf("no group %q", group)
+					}
+					inGroup := map[string]bool{}
+					for _, name := range envs.groupEnvironments(group) {
+						if f.envs == nil || f.envs[name] {
+							inGroup[name] = true
+						}
+					}
+					f.envs = inGroup
+				}
+				releases, err := queryData(p).loadReleases()
+				if err != nil {
+					return nil, err
+				}
+				return filterReleases(releases, f), nil
+			}},
+		"release": &graphql.Field{Type: releaseType,
+			Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "environment:date"}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				env, date, ok := parseReleaseID(p.Args["id"].(string))
+				if !ok {
+					return nil, fmt.Errorf("invalid release id %q, use environment:date", p.Args["id"])
+				}
+				releases, err := queryData(p).loadReleases()
+				if err != nil {
+					return nil, err
+				}
+				for _, e := range releases[env] {
+					if e.Date == date {
+						return graphRelease{env: env, entry: e}, nil
+					}
+				}
+				return nil, nil
+			}},
+		"holidays": &graphql.Field{Type: graphql.NewList(holidayType),
+			Args: graphql.FieldConfigArgument{
+				"from": &graphql.ArgumentConfig{Type: graphql.String},
+				"to":   &graphql.ArgumentConfig{Type: graphql.String},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				f, err := parseReleaseFilter(p.Args)
+				if err != nil {
+					return nil, err
+				}
+				holidays, err := queryData(p).loadHolidays()
+				if err != nil {
+					return nil, err
+				}
+				list := []Holiday{}
+				for _, h := range holidays.Holidays {
+					if (f.from == "" || h.Date >= f.from) && (f.to == "" || h.Date <= f.to) {
+						list = append(list, h)
+					}
+				}
+				sort.Slice(list, func(i, j int) bool { return list[i].Date < list[j].Date })
+				return list, nil
+			}},
+		"tickets": &graphql.Field{Type: graphql.NewList(ticketType), Description: "Tickets a provider offers for linking",
+			Args: graphql.FieldConfigArgument{
+				"provider": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: defaultTicketProvider},
+				"refresh":  &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				info, ok := ticketProviderFor(p.Args["provider"].(string))
+				if !ok {
+					return nil, fmt.Errorf("unknown ticket provider %q", p.Args["provider"])
+				}
+				result, err := info.provider.Search(url.Values{}, p.Args["refresh"].(bool))
+				if err != nil && len(result.tickets) == 0 {
+					return nil, fmt.Errorf("fetching %s tickets: %w", info.Name, err)
+				}
+				return result.tickets, nil
+			}},
+		"backups": &graphql.Field{Type: graphql.NewList(backupType), Description: "Backups of a data file, oldest first",
+			Args: graphql.FieldConfigArgument{"prefix": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String), Description: "The data file, e.g. releases"}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				names, err := listBackups(p.Args["prefix"].(string))
+				if err != nil {
+					return nil, err
+				}
+				list := []graphBackup{}
+				for _, name := range names {
+					b := graphBackup{Filename: name}
+					if m, ok := backupModification(name); ok {
+						b.ModifiedBy, b.ModifiedAt = m.By, m.At
+					}
+					list = append(list, b)
+				}
+				return list, nil
+			}},
+	}})
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query})
+	if err != nil {
+		panic("GraphQL schema: " + err.Error())
+	}
+	return schema
+}()
+
+// graphRequest is a GraphQL request, posted as JSON or in the query string
+type graphRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Handle GraphQL queries over environments, releases, holidays, tickets and
+// backups, for dashboards that want several of them in one request
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" {
+		http.Error(w, "Missing query", http.StatusBadRequest)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		RootObject:     map[string]interface{}{"data": &graphData{langs: requestLanguages(r)}},
+		Context:        r.Context(),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
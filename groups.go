@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// validateGroups checks the optional groups array of environments.json
+func validateGroups(groupsValue, envsValue interface{}) error {
+	var groups []EnvironmentGroup
+	if err := decodeInto(groupsValue, &groups); err != nil {
+		return fmt.Errorf("groups must be an array of group objects")
+	}
+	var envs []Environment
+	decodeInto(envsValue, &envs)
+	known := map[string]bool{}
+	for _, env := range envs {
+		known[env.Name] = true
+	}
+
+	byName := map[string]EnvironmentGroup{}
+	for _, g := range groups {
+		if !environmentNamePattern.MatchString(g.Name) {
+			return fmt.Errorf("invalid group name %q", g.Name)
+		}
+		if _, dup := byName[g.Name]; dup {
+			return fmt.Errorf("duplicate group name %q", g.Name)
+		}
+		if known[g.Name] {
+			return fmt.Errorf("group %q has the same name as an environment", g.Name)
+		}
+		byName[g.Name] = g
+		for _, name := range g.Environments {
+			if !known[name] {
+				return fmt.Errorf("group %s: unknown environment %q", g.Name, name)
+			}
+		}
+		for _, f := range g.Freezes {
+			from, err1 := time.Parse(dateLayout, f.From)
+			to, err2 := time.Parse(dateLayout, f.To)
+			if err1 != nil || err2 != nil || to.Before(from) {
+				return fmt.Errorf("group %s: freeze needs valid from/to dates (YYYY-MM-DD)", g.Name)
+			}
+		}
+		if g.Capacity != nil && (g.Capacity.MaxPerDay < 0 || g.Capacity.MaxPerWeek < 0) {
+			return fmt.Errorf("group %s: capacity limits must not be negative", g.Name)
+		}
+	}
+
+	// Parents must exist and must not form a cycle
+	for _, g := range groups {
+		seen := map[string]bool{g.Name: true}
+		for p := g.Parent; p != ""; p = byName[p].Parent {
+			if _, ok := byName[p]; !ok {
+				return fmt.Errorf("group %s: unknown parent %q", g.Name, p)
+			}
+			if seen[p] {
+				return fmt.Errorf("group %s: parent chain forms a cycle", g.Name)
+			}
+			seen[p] = true
+		}
+	}
+	return nil
+}
+
+// group returns the named group
+func (d EnvironmentsData) group(name string) (EnvironmentGroup, bool) {
+	for _, g := range d.Groups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return EnvironmentGroup{}, false
+}
+
+// groupsOf returns every group an environment belongs to, directly or
+// through a child group, so rules set on a parent apply to the whole subtree
+func (d EnvironmentsData) groupsOf(env string) []EnvironmentGroup {
+	var result []EnvironmentGroup
+	added := map[string]bool{}
+	for _, g := range d.Groups {
+		direct := false
+		for _, name := range g.Environments {
+			if name == env {
+				direct = true
+				break
+			}
+		}
+		if !direct {
+			continue
+		}
+		for cur, ok := g, true; ok && !added[cur.Name]; cur, ok = d.group(cur.Parent) {
+			added[cur.Name] = true
+			result = append(result, cur)
+		}
+	}
+	return result
+}
+
+// groupEnvironments resolves all environments of a group including child groups
+func (d EnvironmentsData) groupEnvironments(name string) []string {
+	set := map[string]bool{}
+	var walk func(string, map[string]bool)
+	walk = func(group string, visiting map[string]bool) {
+		if visiting[group] {
+			return
+		}
+		visiting[group] = true
+		g, _ := d.group(group)
+		for _, env := range g.Environments {
+			set[env] = true
+		}
+		for _, child := range d.Groups {
+			if child.Parent == group {
+				walk(child.Name, visiting)
+			}
+		}
+	}
+	walk(name, map[string]bool{})
+
+	names := make([]string, 0, len(set))
+	for env := range set {
+		names = append(names, env)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// covers reports whether a freeze includes the given ISO date
+func (f FreezePeriod) covers(date string) bool {
+	return f.From <= date && date <= f.To
+}
+
+// appliedFreeze is a freeze together with the group that declared it
+type appliedFreeze struct {
+	Group string `json:"group"`
+	FreezePeriod
+}
+
+// freezesFor returns the freezes that apply to an environment on a date
+func (d EnvironmentsData) freezesFor(env, date string) []appliedFreeze {
+	var result []appliedFreeze
+	for _, g := range d.groupsOf(env) {
+		for _, f := range g.Freezes {
+			if f.covers(date) {
+				result = append(result, appliedFreeze{Group: g.Name, FreezePeriod: f})
+			}
+		}
+	}
+	return result
+}
+
+// activeFreezes returns every group freeze overlapping [from, to]
+func (d EnvironmentsData) activeFreezes(from, to time.Time) []appliedFreeze {
+	result := []appliedFreeze{}
+	lo, hi := from.Format(dateLayout), to.Format(dateLayout)
+	for _, g := range d.Groups {
+		for _, f := range g.Freezes {
+			if f.From <= hi && f.To >= lo {
+				result = append(result, appliedFreeze{Group: g.Name, FreezePeriod: f})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].From < result[j].From })
+	return result
+}
+
+// checkReleaseRules rejects releases that were added or moved onto a locked
+// environment or into a frozen period, or that push a group over its capacity. Entries that already existed
+// on the same date are left alone so existing plans stay saveable.
+func checkReleaseRules(current, next ReleasesData, envs EnvironmentsData) error {
+	for env, entries := range next {
+		existing := map[string]bool{}
+		for _, e := range current[env] {
+			existing[e.Date] = true
+		}
+		for _, e := range entries {
+			if existing[e.Date] {
+				continue
+			}
+			if meta, ok := envs.environment(env); ok && meta.Lock.active(time.Now()) {
+				state := "locked"
+				if meta.Lock.Maintenance {
+					state = "under maintenance"
+				}
+				return fmt.Errorf("cannot schedule %s: %s is %s: %s", releaseID(env, e.Date), env, state, meta.Lock.Reason)
+			}
+			if freezes := envs.freezesFor(env, e.Date); len(freezes) > 0 {
+				f := freezes[0]
+				msg := fmt.Sprintf("%s is frozen from %s to %s by group %s", env, f.From, f.To, f.Group)
+				if f.Reason != "" {
+					msg += ": " + f.Reason
+				}
+				return fmt.Errorf("cannot schedule %s: %s", releaseID(env, e.Date), msg)
+			}
+		}
+	}
+
+	for _, g := range envs.Groups {
+		if g.Capacity == nil || (g.Capacity.MaxPerDay == 0 && g.Capacity.MaxPerWeek == 0) {
+			continue
+		}
+		members := envs.groupEnvironments(g.Name)
+		count := func(data ReleasesData, key func(string) string) map[string]int {
+			counts := map[string]int{}
+			for _, env := range members {
+				for _, e := range data[env] {
+					counts[key(e.Date)]++
+				}
+			}
+			return counts
+		}
+		day := func(date string) string { return date }
+		week := func(date string) string {
+			t, err := time.Parse(dateLayout, date)
+			if err != nil {
+				return date
+			}
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		}
+
+		// Only fail when the new plan is worse than what is already saved
+		if max := g.Capacity.MaxPerDay; max > 0 {
+			before, after := count(current, day), count(next, day)
+			for k, n := range after {
+				if n > max && n > before[k] {
+					return fmt.Errorf("group %s allows at most %d releases per day, %s would have %d", g.Name, max, k, n)
+				}
+			}
+		}
+		if max := g.Capacity.MaxPerWeek; max > 0 {
+			before, after := count(current, week), count(next, week)
+			for k, n := range after {
+				if n > max && n > before[k] {
+					return fmt.Errorf("group %s allows at most %d releases per week, %s would have %d", g.Name, max, k, n)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// groupView is a group with its resolved environments and near-term plan
+type groupView struct {
+	EnvironmentGroup
+	AllEnvironments  []string                     `json:"allEnvironments"`
+	Children         []string                     `json:"children"`
+	ActiveFreezes    []appliedFreeze              `json:"activeFreezes"`
+	UpcomingReleases map[string][]upcomingRelease `json:"upcomingReleases,omitempty"`
+}
+
+// buildGroupView resolves a group for the API
+func buildGroupView(envs EnvironmentsData, g EnvironmentGroup) groupView {
+	view := groupView{
+		EnvironmentGroup: g,
+		AllEnvironments:  envs.groupEnvironments(g.Name),
+		Children:         []string{},
+		ActiveFreezes:    []appliedFreeze{},
+	}
+	for _, child := range envs.Groups {
+		if child.Parent == g.Name {
+			view.Children = append(view.Children, child.Name)
+		}
+	}
+	// Freezes inherited from parents apply as well
+	now := today().Format(dateLayout)
+	seen := map[string]bool{}
+	for cur, ok := g, true; ok && !seen[cur.Name]; cur, ok = envs.group(cur.Parent) {
+		seen[cur.Name] = true
+		for _, f := range cur.Freezes {
+			if f.To >= now {
+				view.ActiveFreezes = append(view.ActiveFreezes, appliedFreeze{Group: cur.Name, FreezePeriod: f})
+			}
+		}
+	}
+	return view
+}
+
+// Handle environment groups list
+func handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+
+	views := []groupView{}
+	for _, g := range envs.Groups {
+		views = append(views, buildGroupView(envs, g))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// Handle a single group: resolved environments, freezes and upcoming releases
+func handleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+	g, ok := envs.group(r.PathValue("name"))
+	if !ok {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+
+	days := defaultDashboardDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		}
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	view := buildGroupView(envs, g)
+	from := today()
+	upcoming := releasesBetween(releases, from, from.AddDate(0, 0, days))
+	view.UpcomingReleases = map[string][]upcomingRelease{}
+	for _, env := range view.AllEnvironments {
+		view.UpcomingReleases[env] = upcoming[env]
+		if view.UpcomingReleases[env] == nil {
+			view.UpcomingReleases[env] = []upcomingRelease{}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
@@ -0,0 +1,599 @@
+package main
+
+//go:generate protoc --go_out=. --go_opt=module=timeoff --go-grpc_out=. --go-grpc_opt=module=timeoff proto/relplanner/v1/relplanner.proto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+
+	pb "timeoff/proto/relplanner/v1"
+)
+
+// GRPCConfig is grpc-config.json; the gRPC API is off without a listen
+// address
+type GRPCConfig struct {
+	Listen string `json:"listen"` // e.g. ":9090"
+}
+
+// grpcWrites are the methods changing data, which need an API key allowed
+// to write once the server has accounts
+var grpcWrites = map[string]bool{
+	pb.ReleasePlanner_CreateRelease_FullMethodName: true,
+	pb.ReleasePlanner_UpdateRelease_FullMethodName: true,
+	pb.ReleasePlanner_DeleteRelease_FullMethodName: true,
+}
+
+// grpcRequestKey holds the request a call stands for in its context
+type grpcRequestKey struct{}
+
+// grpcRequest returns the HTTP request a call stands for, so the
+// permission checks and attribution of the HTTP API apply to it as they are
+func grpcRequest(ctx context.Context) *http.Request {
+	return ctx.Value(grpcRequestKey{}).(*http.Request)
+}
+
+// callRequestID tags a call with the x-request-id of its metadata, or a
+// new one, as requestID tags requests
+func callRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id := newRequestID()
+	if v := md.Get("x-request-id"); len(v) > 0 && validRequestID(v[0]) {
+		id = v[0]
+	}
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// authenticateCall checks the API key of a call like requireLogin and
+// requireRole check a request's, returning the request the call stands for
+func authenticateCall(ctx context.Context, method string) (*http.Request, error) {
+	write := grpcWrites[method]
+	httpMethod := http.MethodGet
+	if write {
+		httpMethod = http.MethodPost
+	}
+	r := (&http.Request{Method: httpMethod, URL: &url.URL{Path: method}, Header: http.Header{}}).WithContext(ctx)
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("authorization"); len(v) > 0 {
+		r.Header.Set("Authorization", v[0])
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.RemoteAddr = p.Addr.String()
+	}
+
+	// The network restrictions of the HTTP API apply to calls too
+	if msg := loadNetworks().refusal(clientIP(r), method, write); msg != "" {
+		logGRPC.WarnContext(ctx, "Refused a call by the network restrictions", "method", method, "remote", clientIP(r), "reason", msg)
+		return r, status.Error(codes.PermissionDenied, msg)
+	}
+
+	if _, bearer := bearerAPIKey(r); bearer {
+		key, ok := requestAPIKey(r)
+		switch {
+		case !ok:
+			return r, status.Error(codes.Unauthenticated, "Invalid or expired API key")
+		case write && !key.allows("write"):
+			return r, status.Error(codes.PermissionDenied, "Read-only API key")
+		}
+	} else if write && accountsEnabled() {
+		return r, status.Error(codes.Unauthenticated, "API key required")
+	}
+	if write {
+		if _, _, role := requestIdentity(r); !roleAllows(role, defaultRole) {
+			return r, status.Errorf(codes.PermissionDenied, "Your role %s can't do this, it needs %s", role, defaultRole)
+		}
+	}
+	return r, nil
+}
+
+// serveCall tags, traces, authenticates and logs a call, like the
+// middleware of the HTTP API does requests
+func serveCall(ctx context.Context, method string, call func(context.Context) error) error {
+	start := time.Now()
+	ctx = callRequestID(ctx)
+	var remote *remoteSpan
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("traceparent"); len(v) > 0 {
+		if p, ok := parseTraceparent(v[0]); ok {
+			remote = &p
+		}
+	}
+	ctx, s := startSpan(ctx, method, spanServer, remote)
+	s.set("rpc.system", "grpc")
+	s.set("rpc.method", method)
+
+	r, err := authenticateCall(ctx, method)
+	if err == nil {
+		err = call(context.WithValue(ctx, grpcRequestKey{}, r))
+	}
+
+	code := status.Code(err)
+	s.set("rpc.grpc.status_code", int(code))
+	if code == codes.Unknown || code == codes.Internal {
+		s.finish(err)
+	} else {
+		s.finish(nil)
+	}
+	logGRPC.InfoContext(ctx, "Call", "method", method, "code", code.String(),
+		"durationMs", float64(time.Since(start).Microseconds())/1000, "user", modifierName(requestUser(r)), "remote", r.RemoteAddr)
+	return err
+}
+
+// unaryInterceptor serves unary calls through serveCall
+func unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var resp interface{}
+	err := serveCall(ctx, info.FullMethod, func(ctx context.Context) (err error) {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+// streamInterceptor serves streaming calls through serveCall
+func streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return serveCall(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// contextStream is a server stream with the context of its call
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcError converts the errors of the data layer into gRPC statuses
+func grpcError(err error) error {
+	var se *saveError
+	if !errors.As(err, &se) {
+		return status.Error(codes.Internal, err.Error())
+	}
+	switch se.status {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, se.msg)
+	case http.StatusForbidden:
+		return status.Error(codes.PermissionDenied, se.msg)
+	case http.StatusNotFound:
+		return status.Error(codes.NotFound, se.msg)
+	case http.StatusConflict:
+		return status.Error(codes.FailedPrecondition, se.msg)
+	case http.StatusPreconditionFailed:
+		return status.Error(codes.Aborted, "The releases changed meanwhile, try again")
+	}
+	return status.Error(codes.Internal, se.msg)
+}
+
+// grpcReleaseFields map the settable fields of a Release, by their proto
+// name, to the fields of releases.json
+var grpcReleaseFields = []struct {
+	proto, json string
+	get         func(*pb.Release) interface{}
+}{
+	{"status", "status", func(r *pb.Release) interface{} { return r.Status }},
+	{"release_name", "releaseName", func(r *pb.Release) interface{} { return r.ReleaseName }},
+	{"fe_tag", "feTag", func(r *pb.Release) interface{} { return r.FeTag }},
+	{"be_tag", "beTag", func(r *pb.Release) interface{} { return r.BeTag }},
+	{"jira_ticket", "jiraTicket", func(r *pb.Release) interface{} { return r.JiraTicket }},
+	{"start_time", "startTime", func(r *pb.Release) interface{} { return r.StartTime }},
+	{"end_date_time", "endDateTime", func(r *pb.Release) interface{} { return r.EndDateTime }},
+	{"note", "note", func(r *pb.Release) interface{} { return r.Note }},
+	{"depends_on", "dependsOn", func(r *pb.Release) interface{} { return r.DependsOn }},
+	{"labels", "labels", func(r *pb.Release) interface{} { return r.Labels }},
+	{"risk", "risk", func(r *pb.Release) interface{} { return r.Risk }},
+	{"tickets", "tickets", func(r *pb.Release) interface{} { return r.Tickets }},
+	{"ticket_provider", "ticketProvider", func(r *pb.Release) interface{} { return r.TicketProvider }},
+	{"release_manager", "releaseManager", func(r *pb.Release) interface{} { return r.ReleaseManager }},
+	{"deployers", "deployers", func(r *pb.Release) interface{} { return r.Deployers }},
+}
+
+// setReleaseFields copies the fields of paths, all settable ones when
+// empty, into a releases.json entry; empty values clear them
+func setReleaseFields(entry map[string]interface{}, r *pb.Release, paths []string) error {
+	wanted := map[string]bool{}
+	for _, p := range paths {
+		wanted[p] = true
+	}
+	for _, f := range grpcReleaseFields {
+		if len(paths) > 0 && !wanted[f.proto] {
+			continue
+		}
+		delete(wanted, f.proto)
+		switch v := f.get(r).(type) {
+		case string:
+			if v == "" {
+				delete(entry, f.json)
+			} else {
+				entry[f.json] = v
+			}
+		case []string:
+			if len(v) == 0 {
+				delete(entry, f.json)
+			} else {
+				list := make([]interface{}, len(v))
+				for i, s := range v {
+					list[i] = s
+				}
+				entry[f.json] = list
+			}
+		}
+	}
+	delete(wanted, "date") // moves the release, see UpdateRelease
+	for p := range wanted {
+		return status.Errorf(codes.InvalidArgument, "Field %s can't be set", p)
+	}
+	return nil
+}
+
+// protoRelease converts a release of an environment
+func protoRelease(env string, e ReleaseEntry) *pb.Release {
+	return &pb.Release{
+		Id: releaseID(env, e.Date), Environment: env, Date: e.Date, Status: e.Status,
+		ReleaseName: e.ReleaseName, FeTag: e.FeTag, BeTag: e.BeTag, JiraTicket: e.JiraTicket,
+		StartTime: e.StartTime, EndDateTime: e.EndDateTime, Note: e.Note, DependsOn: e.DependsOn,
+		Labels: e.Labels, Risk: e.Risk, Tickets: e.Tickets, TicketProvider: e.TicketProvider,
+		ReleaseManager: e.ReleaseManager, Deployers: e.Deployers,
+		OriginalDate: e.OriginalDate, CompletedAt: e.CompletedAt, ModifiedBy: e.ModifiedBy, ModifiedAt: e.ModifiedAt,
+	}
+}
+
+// protoReleaseEntry converts a generic releases.json entry
+func protoReleaseEntry(env string, entry map[string]interface{}) *pb.Release {
+	var e ReleaseEntry
+	decodeInto(entry, &e)
+	return protoRelease(env, e)
+}
+
+// grpcServer implements the ReleasePlanner service
+type grpcServer struct {
+	pb.UnimplementedReleasePlannerServer
+}
+
+// GetPlan returns the plan between two dates
+func (grpcServer) GetPlan(ctx context.Context, req *pb.GetPlanRequest) (*pb.Plan, error) {
+	from, to := today(), time.Time{}
+	for _, d := range []struct {
+		value string
+		t     *time.Time
+	}{{req.From, &from}, {req.To, &to}} {
+		if d.value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(dateLayout, d.value, time.Local)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid date %q, expected YYYY-MM-DD", d.value)
+		}
+		*d.t = t
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 90)
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	plan := &pb.Plan{From: from.Format(dateLayout), To: to.Format(dateLayout)}
+	for _, env := range envs.Environments {
+		p := &pb.Environment{Name: env.Name, DisplayName: env.DisplayName, Visible: env.Visible,
+			Owner: env.Owner, Description: env.Description, Url: env.URL, Tier: env.Tier}
+		for _, g := range envs.groupsOf(env.Name) {
+			p.Groups = append(p.Groups, g.Name)
+		}
+		if env.Lock.active(time.Now()) {
+			p.Lock = &pb.EnvironmentLock{Reason: env.Lock.Reason, Maintenance: env.Lock.Maintenance,
+				LockedAt: env.Lock.LockedAt, Until: env.Lock.Until}
+		}
+		plan.Environments = append(plan.Environments, p)
+	}
+	for _, g := range filterReleases(releases, releaseFilter{from: plan.From, to: plan.To}) {
+		plan.Releases = append(plan.Releases, protoRelease(g.env, g.entry))
+	}
+	for _, h := range holidays.Holidays {
+		if inDateRange(h.Date, from, to) {
+			plan.Holidays = append(plan.Holidays, &pb.Holiday{Date: h.Date, Name: h.Name})
+		}
+	}
+	for _, f := range envs.activeFreezes(from, to) {
+		plan.Freezes = append(plan.Freezes, &pb.Freeze{Group: f.Group, From: f.From, To: f.To, Reason: f.Reason})
+	}
+	return plan, nil
+}
+
+// ListReleases returns the releases passing the filters
+func (grpcServer) ListReleases(ctx context.Context, req *pb.ListReleasesRequest) (*pb.ListReleasesResponse, error) {
+	f, err := parseReleaseFilter(map[string]interface{}{"from": req.From, "to": req.To, "status": req.Status, "label": req.Label})
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(req.Environments) > 0 {
+		f.envs = map[string]bool{}
+		for _, env := range req.Environments {
+			f.envs[env] = true
+		}
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &pb.ListReleasesResponse{}
+	for _, g := range filterReleases(releases, f) {
+		resp.Releases = append(resp.Releases, protoRelease(g.env, g.entry))
+	}
+	return resp, nil
+}
+
+// GetRelease returns a release by id
+func (grpcServer) GetRelease(ctx context.Context, req *pb.GetReleaseRequest) (*pb.Release, error) {
+	env, _, ok := parseReleaseID(req.Id)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Invalid release id, expected environment:date")
+	}
+	doc, _, err := loadReleasesDocument()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	entry, ok := findReleaseEntry(doc, req.Id)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "Release not found")
+	}
+	return protoReleaseEntry(env, entry), nil
+}
+
+// changeReleases applies a change to the releases document and saves it
+// as the caller, trying again when the file changed meanwhile
+func changeReleases(ctx context.Context, change func(doc map[string]interface{}) error) error {
+	r := grpcRequest(ctx)
+	filePath := filepath.Join(dataDir, "releases.json")
+	for attempt := 0; ; attempt++ {
+		doc, etag, err := loadReleasesDocument()
+		if err != nil {
+			return grpcError(err)
+		}
+		if err := change(doc); err != nil {
+			return err
+		}
+		if err := authorizeWrite(r, filePath, doc); err != nil {
+			return grpcError(err)
+		}
+		_, err = writeJSONFile(ctx, filePath, doc, etag, defaultMaxBackups, requestUser(r))
+		var se *saveError
+		if err == nil || attempt == 2 || !errors.As(err, &se) || se.status != http.StatusPreconditionFailed {
+			if err != nil {
+				return grpcError(err)
+			}
+			return nil
+		}
+	}
+}
+
+// knownEnvironment fails unless an environment exists
+func knownEnvironment(name string) error {
+	envs, err := loadEnvironments()
+	if err != nil {
+		return grpcError(err)
+	}
+	if _, ok := envs.environment(name); !ok {
+		return status.Errorf(codes.InvalidArgument, "Unknown environment %q", name)
+	}
+	return nil
+}
+
+// CreateRelease schedules a release
+func (grpcServer) CreateRelease(ctx context.Context, req *pb.CreateReleaseRequest) (*pb.Release, error) {
+	in := req.Release
+	if in == nil || in.Environment == "" {
+		return nil, status.Error(codes.InvalidArgument, "Missing environment")
+	}
+	if _, err := time.Parse(dateLayout, in.Date); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid date, expected YYYY-MM-DD")
+	}
+	if err := knownEnvironment(in.Environment); err != nil {
+		return nil, err
+	}
+	id := releaseID(in.Environment, in.Date)
+	var entry map[string]interface{}
+	err := changeReleases(ctx, func(doc map[string]interface{}) error {
+		if _, exists := findReleaseEntry(doc, id); exists {
+			return status.Errorf(codes.AlreadyExists, "%s already has a release on %s", in.Environment, in.Date)
+		}
+		entry = map[string]interface{}{"date": in.Date}
+		if err := setReleaseFields(entry, in, nil); err != nil {
+			return err
+		}
+		if entry["status"] == nil {
+			entry["status"] = "Planned"
+		}
+		list, _ := doc[in.Environment].([]interface{})
+		doc[in.Environment] = append(list, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protoReleaseEntry(in.Environment, entry), nil
+}
+
+// UpdateRelease changes the fields of a release
+func (grpcServer) UpdateRelease(ctx context.Context, req *pb.UpdateReleaseRequest) (*pb.Release, error) {
+	env, _, ok := parseReleaseID(req.Id)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Invalid release id, expected environment:date")
+	}
+	if req.Release == nil {
+		return nil, status.Error(codes.InvalidArgument, "Missing release")
+	}
+	paths := req.UpdateMask.GetPaths()
+	moveTo := ""
+	for _, p := range paths {
+		if p == "date" {
+			moveTo = req.Release.Date
+		}
+	}
+	if len(paths) == 0 {
+		moveTo = req.Release.Date
+	}
+	if _, err := time.Parse(dateLayout, moveTo); moveTo != "" && err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid date, expected YYYY-MM-DD")
+	}
+	var entry map[string]interface{}
+	err := changeReleases(ctx, func(doc map[string]interface{}) error {
+		var exists bool
+		entry, exists = findReleaseEntry(doc, req.Id)
+		if !exists {
+			return status.Error(codes.NotFound, "Release not found")
+		}
+		if err := setReleaseFields(entry, req.Release, paths); err != nil {
+			return err
+		}
+		if moveTo != "" && moveTo != entry["date"] {
+			if _, taken := entriesByDate(doc[env])[moveTo]; taken {
+				return status.Errorf(codes.AlreadyExists, "%s already has a release on %s", env, moveTo)
+			}
+			entry["date"] = moveTo
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return protoReleaseEntry(env, entry), nil
+}
+
+// DeleteRelease removes a release
+func (grpcServer) DeleteRelease(ctx context.Context, req *pb.DeleteReleaseRequest) (*pb.DeleteReleaseResponse, error) {
+	env, date, ok := parseReleaseID(req.Id)
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "Invalid release id, expected environment:date")
+	}
+	err := changeReleases(ctx, func(doc map[string]interface{}) error {
+		list, _ := doc[env].([]interface{})
+		for i, item := range list {
+			if entry, _ := item.(map[string]interface{}); entry["date"] == date {
+				doc[env] = append(list[:i:i], list[i+1:]...)
+				return nil
+			}
+		}
+		return status.Error(codes.NotFound, "Release not found")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &pb.DeleteReleaseResponse{}, nil
+}
+
+// changeFeed passes data file changes and release events on to the
+// WatchChanges streams; a stream too slow to keep up misses changes
+// rather than holding up the server
+var changeFeed = struct {
+	sync.Mutex
+	watchers map[chan *pb.Change]bool
+}{watchers: map[chan *pb.Change]bool{}}
+
+// publishChange sends a change to every watcher
+func publishChange(c *pb.Change) {
+	changeFeed.Lock()
+	defer changeFeed.Unlock()
+	for ch := range changeFeed.watchers {
+		select {
+		case ch <- c:
+		default:
+		}
+	}
+}
+
+// fileChangeToFeed is the data change hook feeding WatchChanges
+func fileChangeToFeed(filename string) {
+	publishChange(&pb.Change{Type: "file", At: time.Now().UTC().Format(time.RFC3339), File: filename})
+}
+
+// releaseEventToFeed is the release event subscriber feeding WatchChanges
+func releaseEventToFeed(event releaseEvent) {
+	if event.Type == eventReminder {
+		return
+	}
+	publishChange(&pb.Change{Type: event.Type, At: time.Now().UTC().Format(time.RFC3339),
+		Release: protoRelease(event.Environment, event.Release), PreviousDate: event.PreviousDate, PreviousStatus: event.PreviousStatus})
+}
+
+// WatchChanges streams changes until the client goes away
+func (grpcServer) WatchChanges(req *pb.WatchChangesRequest, stream pb.ReleasePlanner_WatchChangesServer) error {
+	ch := make(chan *pb.Change, 64)
+	changeFeed.Lock()
+	changeFeed.watchers[ch] = true
+	changeFeed.Unlock()
+	defer func() {
+		changeFeed.Lock()
+		delete(changeFeed.watchers, ch)
+		changeFeed.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case c := <-ch:
+			if c.Release == nil && req.ReleasesOnly {
+				continue
+			}
+			if c.Release != nil && len(req.Environments) > 0 && !anyOf(req.Environments, c.Release.Environment) {
+				continue
+			}
+			if err := stream.Send(c); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// startGRPC serves the gRPC API on the address of grpc-config.json
+func startGRPC() error {
+	var cfg GRPCConfig
+	if err := readDataFile("grpc-config.json", &cfg); err != nil {
+		return err
+	}
+	if cfg.Listen == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", cfg.Listen, err)
+	}
+	s := grpc.NewServer(grpc.UnaryInterceptor(unaryInterceptor), grpc.StreamInterceptor(streamInterceptor))
+	pb.RegisterReleasePlannerServer(s, grpcServer{})
+	reflection.Register(s)
+	onDataChange(fileChangeToFeed)
+	onReleaseEvent(releaseEventToFeed)
+	logGRPC.Info("Starting gRPC server", "addr", cfg.Listen)
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			logGRPC.Error("gRPC server stopped", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// startedAt is when the server started, for its uptime
+var startedAt = time.Now()
+
+// jiraCheckTTL is how long a readiness check's Jira result is reused, so
+// probes don't call Jira every few seconds
+const jiraCheckTTL = 5 * time.Minute
+
+// healthCheck is the outcome of one readiness check
+type healthCheck struct {
+	Status   string `json:"status"` // ok, failing or unconfigured
+	Error    string `json:"error,omitempty"`
+	Optional bool   `json:"optional,omitempty"` // doesn't make the server unready
+	Backups  *int   `json:"backups,omitempty"`
+	Checked  string `json:"checked,omitempty"` // when a cached result was taken
+}
+
+// healthResponse is the response of /healthz and /readyz
+type healthResponse struct {
+	Status string                 `json:"status"` // ok or failing
+	Uptime int64                  `json:"uptimeSeconds"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+// jiraHealth caches the last Jira check
+var jiraHealth struct {
+	sync.Mutex
+	check healthCheck
+	at    time.Time
+}
+
+// checkOf turns an error into a check
+func checkOf(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Status: "failing", Error: err.Error()}
+	}
+	return healthCheck{Status: "ok"}
+}
+
+// checkWritable checks that a directory exists and files can be created in it
+func checkWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkJira connects to the default Jira profile, reusing a recent result
+func checkJira() healthCheck {
+	jiraHealth.Lock()
+	defer jiraHealth.Unlock()
+	if time.Since(jiraHealth.at) < jiraCheckTTL {
+		return jiraHealth.check
+	}
+	check := healthCheck{Status: "unconfigured"}
+	if _, err := os.Stat(filepath.Join(dataDir, "jira-config.json")); err == nil {
+		client, _, err := newJiraClient(context.Background())
+		if check = checkOf(err); err == nil && client == nil {
+			check = healthCheck{Status: "unconfigured"}
+		}
+	}
+	check.Optional = true
+	check.Checked = time.Now().UTC().Format(time.RFC3339)
+	jiraHealth.check, jiraHealth.at = check, time.Now()
+	return check
+}
+
+// writeHealth answers a probe, 503 when failing
+func writeHealth(w http.ResponseWriter, r *http.Request, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if r.Method != http.MethodHead {
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// Handle liveness probes: the server answers requests
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeHealth(w, r, healthResponse{Status: "ok", Uptime: int64(time.Since(startedAt).Seconds())})
+}
+
+// Handle readiness probes: the data and backup directories are writable.
+// Jira is checked too, unless ?jira=false, without affecting readiness.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	resp := healthResponse{Status: "ok", Uptime: int64(time.Since(startedAt).Seconds()), Checks: map[string]healthCheck{}}
+	resp.Checks["dataDir"] = checkOf(checkWritable(dataDir))
+	backups := checkOf(checkWritable(backupDir))
+	if names, err := filepath.Glob(filepath.Join(backupDir, "*.json")); err == nil && backups.Status == "ok" {
+		n := len(names)
+		backups.Backups = &n
+	}
+	resp.Checks["backupDir"] = backups
+	if r.URL.Query().Get("jira") != "false" {
+		resp.Checks["jira"] = checkJira()
+	}
+	for _, check := range resp.Checks {
+		if check.Status == "failing" && !check.Optional {
+			resp.Status = "failing"
+		}
+	}
+	writeHealth(w, r, resp)
+}
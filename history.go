@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Fields of a release entry maintained by the server rather than the client
+var trackedReleaseFields = []string{"originalDate", "reschedules", "completedAt", "jiraIssue", "jiraVersion", "githubMilestone", "githubRelease", "changeRequest", "changeApproval", "changeState", "deployment", "outcome", "retrospective", "incidents", "modifiedBy", "modifiedAt"}
+
+// serverFieldsKey is the context key marking a save by the server itself,
+// a sync or the outcome endpoint say, whose changes of trackedReleaseFields
+// are kept
+type serverFieldsKey struct{}
+
+// withServerFields marks a save as setting server-maintained fields
+func withServerFields(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serverFieldsKey{}, true)
+}
+
+// prepareByPath lets the server derive fields before a validated document is
+// saved by a user, mirroring validateByPath
+func prepareByPath(ctx context.Context, path string, data interface{}, by string) interface{} {
+	switch filepath.Base(path) {
+	case "releases.json":
+		var current interface{}
+		if b, err := os.ReadFile(path); err == nil {
+			json.Unmarshal(b, &current)
+		}
+		server, _ := ctx.Value(serverFieldsKey{}).(bool)
+		trackReleaseHistory(current, data, by, server)
+	case "jira-config.json":
+		if config, ok := data.(map[string]interface{}); ok {
+			if _, err := encryptJiraSecrets(config); err != nil {
+				logJira.Warn("Could not encrypt Jira credentials", "err", err)
+			}
+		}
+	}
+	return data
+}
+
+// releaseMatchKey identifies the same release across a move; empty when the
+// entry has nothing stable to match on
+func releaseMatchKey(entry map[string]interface{}) string {
+	if issue, _ := entry["jiraIssue"].(string); issue != "" {
+		return "issue:" + issue
+	}
+	if name, _ := entry["releaseName"].(string); name != "" {
+		return "name:" + name
+	}
+	if ticket, _ := entry["jiraTicket"].(string); ticket != "" {
+		return "ticket:" + ticket
+	}
+	return ""
+}
+
+// entriesByDate indexes the release entries of one environment by date
+func entriesByDate(list interface{}) map[string]map[string]interface{} {
+	byDate := map[string]map[string]interface{}{}
+	items, _ := list.([]interface{})
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok {
+			if date, _ := entry["date"].(string); date != "" {
+				byDate[date] = entry
+			}
+		}
+	}
+	return byDate
+}
+
+// vanishedRelease is an entry gone from its date, or its environment, by a
+// save: a candidate for a move
+type vanishedRelease struct {
+	env   string
+	entry map[string]interface{}
+}
+
+// movedRelease finds the vanished entry a new entry of env was moved from
+// and takes it off the list. It is the only one with the same release name
+// or ticket, else with the original date the client carried over, looked for
+// in env first and then in the other environments; failing those, the only
+// entry gone from env when the new one is the only entry appearing there.
+func movedRelease(vanished *[]vanishedRelease, env string, entry map[string]interface{}, onlyNew bool) map[string]interface{} {
+	key := releaseMatchKey(entry)
+	original, _ := entry["originalDate"].(string)
+	sameKey := func(v vanishedRelease) bool { return key != "" && releaseMatchKey(v.entry) == key }
+	sameOriginal := func(v vanishedRelease) bool { return original != "" && v.entry["originalDate"] == original }
+	inEnv := func(v vanishedRelease) bool { return v.env == env }
+	passes := []func(v vanishedRelease) bool{
+		func(v vanishedRelease) bool { return inEnv(v) && sameKey(v) },
+		func(v vanishedRelease) bool { return inEnv(v) && sameOriginal(v) },
+		sameKey,
+		sameOriginal,
+	}
+	if onlyNew {
+		passes = append(passes, inEnv)
+	}
+	for _, match := range passes {
+		found := -1
+		for i, v := range *vanished {
+			if match(v) {
+				if found >= 0 {
+					found = -1
+					break
+				}
+				found = i
+			}
+		}
+		if found >= 0 {
+			old := (*vanished)[found].entry
+			*vanished = append((*vanished)[:found], (*vanished)[found+1:]...)
+			return old
+		}
+	}
+	return nil
+}
+
+// trackReleaseHistory records the original planned date, every reschedule,
+// the completion date and who last changed them on the entries of the new
+// releases document. The tracked fields of a client's save are those of the
+// saved version, an entry moved to another date or environment keeping
+// those of the entry it was moved from and new entries starting without
+// them; the server's own saves set them, and carry over those they leave out.
+func trackReleaseHistory(current, next interface{}, by string, server bool) {
+	nextEnvs, ok := next.(map[string]interface{})
+	if !ok {
+		return
+	}
+	currentEnvs, _ := current.(map[string]interface{})
+	now := time.Now().Format(time.RFC3339)
+
+	// Entries that vanished from their date or environment are candidates
+	// for a move, keeping their tracked fields
+	var vanished []vanishedRelease
+	for env, list := range currentEnvs {
+		newByDate := entriesByDate(nextEnvs[env])
+		for date, entry := range entriesByDate(list) {
+			if _, still := newByDate[date]; !still {
+				vanished = append(vanished, vanishedRelease{env, entry})
+			}
+		}
+	}
+
+	for env, list := range nextEnvs {
+		oldByDate := entriesByDate(currentEnvs[env])
+		newByDate := entriesByDate(list)
+		appeared := 0
+		for date := range newByDate {
+			if _, existed := oldByDate[date]; !existed {
+				appeared++
+			}
+		}
+
+		for date, entry := range newByDate {
+			old, existed := oldByDate[date]
+			if !existed {
+				old = movedRelease(&vanished, env, entry, appeared == 1)
+			}
+
+			for _, field := range trackedReleaseFields {
+				_, has := entry[field]
+				if server && has {
+					continue
+				}
+				if v, ok := old[field]; ok {
+					entry[field] = v
+				} else {
+					delete(entry, field)
+				}
+			}
+
+			if _, has := entry["originalDate"]; !has {
+				if old != nil {
+					entry["originalDate"] = old["date"]
+				} else {
+					entry["originalDate"] = date
+				}
+			}
+
+			if old != nil && old["date"] != date {
+				reschedules, _ := entry["reschedules"].([]interface{})
+				entry["reschedules"] = append(reschedules, map[string]interface{}{
+					"from": old["date"],
+					"to":   date,
+					"at":   now,
+				})
+			}
+
+			status, _ := entry["status"].(string)
+			if completedStatuses[status] {
+				if _, has := entry["completedAt"]; !has {
+					entry["completedAt"] = now
+				}
+			} else {
+				delete(entry, "completedAt")
+			}
+
+			if old == nil || !sameRelease(old, entry) {
+				entry["modifiedAt"] = now
+				if by != "" {
+					entry["modifiedBy"] = by
+				} else {
+					delete(entry, "modifiedBy")
+				}
+			}
+		}
+	}
+}
+
+// sameRelease reports whether a release entry is unchanged but for who last
+// changed it, comparing JSON as entries may hold decoded or typed values
+func sameRelease(old, entry map[string]interface{}) bool {
+	strip := func(e map[string]interface{}) string {
+		dup := map[string]interface{}{}
+		for k, v := range e {
+			if k != "modifiedBy" && k != "modifiedAt" {
+				dup[k] = v
+			}
+		}
+		b, _ := json.Marshal(dup)
+		return string(b)
+	}
+	return strip(old) == strip(entry)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HooksConfig is hooks-config.json: commands run on saves of data files,
+// for local automation such as syncing to a wiki
+type HooksConfig struct {
+	// PreSave hooks run before a save and veto it by failing
+	PreSave []SaveHook `json:"preSave,omitempty"`
+	// PostSave hooks run after a save, without waiting for them
+	PostSave []SaveHook `json:"postSave,omitempty"`
+}
+
+// SaveHook is a command given the save as JSON on its standard input
+type SaveHook struct {
+	Command        []string `json:"command"`                  // program and arguments, run in the server's directory
+	Files          []string `json:"files,omitempty"`          // data files it runs for, all without
+	TimeoutSeconds int      `json:"timeoutSeconds,omitempty"` // default 10
+}
+
+// defaultHookTimeout is how long a hook may run without timeoutSeconds
+const defaultHookTimeout = 10 * time.Second
+
+// saveEvent is what a hook is given on its standard input
+type saveEvent struct {
+	Hook   string          `json:"hook"` // preSave or postSave
+	File   string          `json:"file"`
+	By     string          `json:"by,omitempty"`
+	Action string          `json:"action,omitempty"` // as in the audit log, empty before the save
+	Time   string          `json:"time"`
+	ETag   string          `json:"etag,omitempty"` // of the version saved, after the save
+	Before json.RawMessage `json:"before"`         // null for a new file
+	After  json.RawMessage `json:"after"`          // null for a deleted one
+}
+
+// loadHooksConfig reads hooks-config.json
+func loadHooksConfig() (HooksConfig, error) {
+	var cfg HooksConfig
+	err := readDataFile("hooks-config.json", &cfg)
+	return cfg, err
+}
+
+// hooksFor returns the hooks of a file
+func hooksFor(hooks []SaveHook, file string) []SaveHook {
+	var matched []SaveHook
+	for _, h := range hooks {
+		if len(h.Command) == 0 {
+			continue
+		}
+		if len(h.Files) == 0 {
+			matched = append(matched, h)
+			continue
+		}
+		for _, f := range h.Files {
+			if f == file {
+				matched = append(matched, h)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// rawJSON is content for a saveEvent, null when there is none
+func rawJSON(content []byte) json.RawMessage {
+	if content == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(content)
+}
+
+// runHook runs a hook on an event, returning its output when it fails
+func runHook(ctx context.Context, h SaveHook, event saveEvent) error {
+	timeout := defaultHookTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	input, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "RELPLANNER_HOOK="+event.Hook, "RELPLANNER_FILE="+event.File, "RELPLANNER_USER="+event.By)
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(output.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// runPreSaveHooks runs the pre-save hooks of a file about to be written
+// with data, failing with a 409 saveError when one vetoes the save. A hook
+// that can't run vetoes too, so a broken check doesn't let saves through.
+func runPreSaveHooks(ctx context.Context, filePath string, data interface{}, by string) error {
+	cfg, err := loadHooksConfig()
+	if err != nil {
+		return &saveError{status: http.StatusInternalServerError, msg: fmt.Sprintf("Error reading hooks-config.json: %v", err)}
+	}
+	file := filepath.Base(filePath)
+	hooks := hooksFor(cfg.PreSave, file)
+	if len(hooks) == 0 {
+		return nil
+	}
+	before, _ := os.ReadFile(filePath)
+	after, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return &saveError{status: http.StatusInternalServerError, msg: "Error formatting JSON"}
+	}
+	event := saveEvent{Hook: "preSave", File: file, By: by, Time: time.Now().UTC().Format(time.RFC3339),
+		Before: rawJSON(before), After: rawJSON(after)}
+	for _, h := range hooks {
+		if err := runHook(ctx, h, event); err != nil {
+			logServer.WarnContext(ctx, "Save vetoed by a pre-save hook", "file", file, "hook", filepath.Base(h.Command[0]), "err", err)
+			return &saveError{status: http.StatusConflict, msg: fmt.Sprintf("Save vetoed by hook %s: %v", filepath.Base(h.Command[0]), err)}
+		}
+	}
+	return nil
+}
+
+// runPostSaveHooks starts the post-save hooks of a file, logging those
+// failing
+func runPostSaveHooks(file, by, action string, before, after []byte) {
+	cfg, err := loadHooksConfig()
+	if err != nil {
+		logServer.Error("Error reading hooks-config.json", "err", err)
+		return
+	}
+	event := saveEvent{Hook: "postSave", File: file, By: by, Action: action, Time: time.Now().UTC().Format(time.RFC3339),
+		ETag: checksum(after), Before: rawJSON(before), After: rawJSON(after)}
+	for _, h := range hooksFor(cfg.PostSave, file) {
+		go func(h SaveHook) {
+			if err := runHook(context.Background(), h, event); err != nil {
+				logServer.Warn("Post-save hook failed", "file", file, "hook", filepath.Base(h.Command[0]), "err", err)
+			}
+		}(h)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// i18nDir holds the message catalogs, one per language: i18n/de.json maps
+// the API's English messages to German. Messages with variable parts are
+// keys with placeholders, "Invalid '{0}' date, expected YYYY-MM-DD", which
+// the translation may reorder.
+var i18nDir = filepath.Join(dataDir, "i18n")
+
+// catalog is the messages of a language
+type catalog struct {
+	modTime  time.Time
+	messages map[string]string
+	patterns []catalogPattern
+}
+
+// catalogPattern is a message with placeholders
+type catalogPattern struct {
+	re          *regexp.Regexp
+	placeholder []string // in the order of re's groups
+	translation string
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\d+\}`)
+
+// catalogs are the loaded catalogs by language, reloaded when their file
+// changes
+var catalogs = struct {
+	sync.Mutex
+	m map[string]*catalog
+}{m: map[string]*catalog{}}
+
+// loadCatalog returns the catalog of a language, nil when there is none
+func loadCatalog(lang string) *catalog {
+	path := filepath.Join(i18nDir, lang+".json")
+	info, err := os.Stat(path)
+	catalogs.Lock()
+	defer catalogs.Unlock()
+	if err != nil {
+		delete(catalogs.m, lang)
+		return nil
+	}
+	if c, ok := catalogs.m[lang]; ok && c.modTime.Equal(info.ModTime()) {
+		return c
+	}
+	var messages map[string]string
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &messages)
+	}
+	if err != nil {
+		logServer.Warn("Invalid message catalog", "lang", lang, "err", err)
+		return nil
+	}
+	c := &catalog{modTime: info.ModTime(), messages: messages}
+	for key, translation := range messages {
+		if !placeholderPattern.MatchString(key) {
+			continue
+		}
+		p := catalogPattern{translation: translation}
+		var expr strings.Builder
+		last := 0
+		for _, loc := range placeholderPattern.FindAllStringIndex(key, -1) {
+			expr.WriteString(regexp.QuoteMeta(key[last:loc[0]]))
+			expr.WriteString("(.+?)")
+			p.placeholder = append(p.placeholder, key[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(key[last:]))
+		p.re = regexp.MustCompile("^" + expr.String() + "$")
+		c.patterns = append(c.patterns, p)
+	}
+	catalogs.m[lang] = c
+	return c
+}
+
+// translate returns the translation of a message, the message itself when
+// the catalog has none
+func (c *catalog) translate(msg string) string {
+	if c == nil {
+		return msg
+	}
+	if t, ok := c.messages[msg]; ok {
+		return t
+	}
+	for _, p := range c.patterns {
+		m := p.re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		t := p.translation
+		for i, ph := range p.placeholder {
+			t = strings.ReplaceAll(t, ph, m[i+1])
+		}
+		return t
+	}
+	return msg
+}
+
+// requestLanguages returns the languages of Accept-Language, preferred
+// first, lowercased
+func requestLanguages(r *http.Request) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var list []weighted
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			list = append(list, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].q > list[j].q })
+	langs := make([]string, len(list))
+	for i, w := range list {
+		langs[i] = w.tag
+	}
+	return langs
+}
+
+// matchLanguage returns the first of the languages available, trying each
+// language and then its base language, "de" for "de-ch"
+func matchLanguage(langs []string, available func(lang string) bool) string {
+	for _, lang := range langs {
+		if available(lang) {
+			return lang
+		}
+		if base, _, ok := strings.Cut(lang, "-"); ok && available(base) {
+			return base
+		}
+	}
+	return ""
+}
+
+// requestCatalog returns the catalog of the language a request prefers
+func requestCatalog(r *http.Request) (*catalog, string) {
+	var c *catalog
+	lang := matchLanguage(requestLanguages(r), func(lang string) bool {
+		c = loadCatalog(lang)
+		return c != nil
+	})
+	return c, lang
+}
+
+// localize translates a message to the language of a request
+func localize(r *http.Request, msg string) string {
+	c, _ := requestCatalog(r)
+	return c.translate(msg)
+}
+
+// writeSuccess reports a change done, with a message in the language of
+// the request
+func writeSuccess(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": localize(r, msg)})
+}
+
+// localizedName returns the name of a holiday in the first of the languages
+// it has one in, its name otherwise
+func (h Holiday) localizedName(langs []string) string {
+	if lang := matchLanguage(langs, func(lang string) bool { return h.Names[lang] != "" }); lang != "" {
+		return h.Names[lang]
+	}
+	return h.Name
+}
+
+// localizeHolidays names holidays in the languages of a request
+func localizeHolidays(holidays HolidaysData, langs []string) HolidaysData {
+	localized := HolidaysData{Holidays: make([]Holiday, len(holidays.Holidays))}
+	for i, h := range holidays.Holidays {
+		h.Name = h.localizedName(langs)
+		localized.Holidays[i] = h
+	}
+	return localized
+}
+
+// localizeWriter holds back plain text error responses to translate them
+type localizeWriter struct {
+	http.ResponseWriter
+	catalog *catalog
+	held    bool
+	body    bytes.Buffer
+}
+
+func (w *localizeWriter) WriteHeader(status int) {
+	h := w.Header()
+	w.held = status >= 400 && h.Get("Content-Encoding") == "" && strings.HasPrefix(h.Get("Content-Type"), "text/plain")
+	if w.held {
+		h.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *localizeWriter) Write(b []byte) (int, error) {
+	if w.held {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *localizeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to WebSockets
+func (w *localizeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// localizeErrors translates the plain text error messages of responses, line
+// by line, to the language of Accept-Language that has a catalog
+func localizeErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, lang := requestCatalog(r)
+		w.Header().Add("Vary", "Accept-Language")
+		if c == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Language", lang)
+		lw := &localizeWriter{ResponseWriter: w, catalog: c}
+		next.ServeHTTP(lw, r)
+		if !lw.held {
+			return
+		}
+		lines := strings.SplitAfter(lw.body.String(), "\n")
+		for i, line := range lines {
+			if text := strings.TrimSuffix(line, "\n"); text != "" {
+				lines[i] = c.translate(text) + line[len(text):]
+			}
+		}
+		w.Write([]byte(strings.Join(lines, "")))
+	})
+}
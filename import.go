@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Import strategies for records that exist already
+const (
+	importSkip      = "skip"      // keep the existing record
+	importOverwrite = "overwrite" // replace it
+	importMerge     = "merge"     // set the fields imported, keep the others
+)
+
+// bulkImportRequest is the body of POST /api/import/bulk: releases by
+// environment as in releases.json, and holidays as in holidays.json
+type bulkImportRequest struct {
+	Strategy string                              `json:"strategy"` // skip by default
+	Releases map[string][]map[string]interface{} `json:"releases,omitempty"`
+	Holidays []map[string]interface{}            `json:"holidays,omitempty"`
+}
+
+// importResult is what became of an imported record
+type importResult struct {
+	File   string `json:"file"`
+	Record string `json:"record"`          // release id or holiday date
+	Result string `json:"result"`          // created, skipped, overwritten, merged or error
+	Error  string `json:"error,omitempty"` // why the record was not imported
+}
+
+// bulkImportReport is the JSON response of POST /api/import/bulk
+type bulkImportReport struct {
+	Strategy string            `json:"strategy"`
+	DryRun   bool              `json:"dryRun,omitempty"`
+	Counts   map[string]int    `json:"counts"` // by result
+	Results  []importResult    `json:"results"`
+	ETags    map[string]string `json:"etags,omitempty"` // of the files written
+}
+
+// upsertRecord applies the strategy to an imported record and the existing
+// one, if any, returning the record to keep and the result
+func upsertRecord(strategy string, existing, imported map[string]interface{}) (map[string]interface{}, string) {
+	switch {
+	case existing == nil:
+		return imported, "created"
+	case strategy == importOverwrite:
+		return imported, "overwritten"
+	case strategy == importMerge:
+		merged := map[string]interface{}{}
+		for k, v := range existing {
+			merged[k] = v
+		}
+		for k, v := range imported {
+			merged[k] = v
+		}
+		return merged, "merged"
+	}
+	return existing, "skipped"
+}
+
+// Handle importing releases and holidays in bulk, e.g. migrated from a
+// spreadsheet: records are matched to existing ones by release id and
+// holiday date and created, skipped, overwritten or merged as the strategy
+// says. Invalid records are reported and left out; each file is then saved
+// once, validated and backed up like any save. ?dryRun=true only reports.
+func handleBulkImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req bulkImportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Strategy == "" {
+		req.Strategy = importSkip
+	}
+	if req.Strategy != importSkip && req.Strategy != importOverwrite && req.Strategy != importMerge {
+		http.Error(w, "Invalid 'strategy', expected skip, overwrite or merge", http.StatusBadRequest)
+		return
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading environments: %v", err), http.StatusInternalServerError)
+		return
+	}
+	known := map[string]bool{}
+	for _, e := range envs.Environments {
+		known[e.Name] = true
+	}
+
+	report := bulkImportReport{Strategy: req.Strategy, DryRun: r.URL.Query().Get("dryRun") == "true",
+		Counts: map[string]int{}, Results: []importResult{}, ETags: map[string]string{}}
+	add := func(file, record, result, errMsg string) {
+		report.Results = append(report.Results, importResult{file, record, result, errMsg})
+		report.Counts[result]++
+	}
+	validDate := func(v interface{}) (string, bool) {
+		s, _ := v.(string)
+		_, err := time.Parse(dateLayout, s)
+		return s, err == nil
+	}
+
+	type pendingWrite struct {
+		file string
+		doc  interface{}
+		etag string
+	}
+	var writes []pendingWrite
+
+	if len(req.Releases) > 0 {
+		doc, etag, err := loadReleasesDocument()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+			return
+		}
+		changed := false
+		names := []string{}
+		for env := range req.Releases {
+			names = append(names, env)
+		}
+		sort.Strings(names)
+		for _, env := range names {
+			for i, imported := range req.Releases[env] {
+				date, ok := validDate(imported["date"])
+				if !ok {
+					add("releases.json", fmt.Sprintf("%s[%d]", env, i), "error", "date must be YYYY-MM-DD")
+					continue
+				}
+				id := releaseID(env, date)
+				if !known[env] {
+					add("releases.json", id, "error", "unknown environment")
+					continue
+				}
+				if err := authorizeEnvironments(r, env); err != nil {
+					add("releases.json", id, "error", err.Error())
+					continue
+				}
+				existing, _ := findReleaseEntry(doc, id)
+				record, result := upsertRecord(req.Strategy, existing, imported)
+				if result != "skipped" {
+					list, _ := doc[env].([]interface{})
+					if existing == nil {
+						doc[env] = append(list, record)
+					} else {
+						for j, e := range list {
+							if m, ok := e.(map[string]interface{}); ok && m["date"] == date {
+								list[j] = record
+							}
+						}
+					}
+					changed = true
+				}
+				add("releases.json", id, result, "")
+			}
+		}
+		if changed {
+			writes = append(writes, pendingWrite{"releases.json", doc, etag})
+		}
+	}
+
+	if len(req.Holidays) > 0 {
+		doc := map[string]interface{}{}
+		etag := ""
+		content, err := os.ReadFile(filepath.Join(dataDir, "holidays.json"))
+		if err == nil {
+			etag = computeETag(content)
+			err = json.Unmarshal(content, &doc)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("Error reading holidays: %v", err), http.StatusInternalServerError)
+			return
+		}
+		list, _ := doc["holidays"].([]interface{})
+		changed := false
+		for i, imported := range req.Holidays {
+			date, ok := validDate(imported["date"])
+			if !ok {
+				add("holidays.json", fmt.Sprintf("holidays[%d]", i), "error", "date must be YYYY-MM-DD")
+				continue
+			}
+			if name, _ := imported["name"].(string); name == "" {
+				add("holidays.json", date, "error", "missing name")
+				continue
+			}
+			index := -1
+			var existing map[string]interface{}
+			for j, h := range list {
+				if m, ok := h.(map[string]interface{}); ok && m["date"] == date {
+					index, existing = j, m
+				}
+			}
+			record, result := upsertRecord(req.Strategy, existing, imported)
+			if result != "skipped" {
+				if index < 0 {
+					list = append(list, record)
+				} else {
+					list[index] = record
+				}
+				changed = true
+			}
+			add("holidays.json", date, result, "")
+		}
+		if changed {
+			doc["holidays"] = list
+			writes = append(writes, pendingWrite{"holidays.json", doc, etag})
+		}
+	}
+
+	// Every file is checked before any is written
+	for _, pw := range writes {
+		filePath := filepath.Join(dataDir, pw.file)
+		if err := validateByPath(filePath, pw.doc); err != nil {
+			http.Error(w, fmt.Sprintf("Import leaves %s invalid: %v", pw.file, err), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := authorizeWrite(r, filePath, pw.doc); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+	if !report.DryRun {
+		for _, pw := range writes {
+			filePath := filepath.Join(dataDir, pw.file)
+			// Only onto the versions the records were matched against
+			etag, err := writeJSONFile(r.Context(), filePath, pw.doc, pw.etag, maxBackupsFromRequest(r), requestUser(r))
+			if err != nil {
+				writeSaveError(w, err)
+				return
+			}
+			report.ETags[pw.file] = etag
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// InboundConfig is inbound-config.json: the tokens external systems such as
+// CI or ticketing use to schedule releases through /api/inbound/releases
+type InboundConfig struct {
+	Tokens []InboundToken `json:"tokens"` // the endpoint is off without any
+}
+
+// InboundToken is a caller of the inbound endpoint, limited to Environments
+// when given
+type InboundToken struct {
+	Name         string   `json:"name"`
+	Token        string   `json:"token"`
+	Environments []string `json:"environments,omitempty"`
+}
+
+// inboundReleaseFields are the release fields callers may set
+var inboundReleaseFields = []string{"status", "releaseName", "feTag", "beTag", "jiraTicket", "startTime", "endDateTime", "note", "labels", "risk", "tickets", "ticketProvider", "dependsOn"}
+
+// inboundRelease is the body of POST /api/inbound/releases. The release on
+// environment and date is updated, or created when there is none; moveTo
+// reschedules it. The other fields are those of inboundReleaseFields.
+type inboundRelease struct {
+	Environment string `json:"environment"`
+	Date        string `json:"date"`
+	MoveTo      string `json:"moveTo,omitempty"`
+}
+
+// loadInboundConfig reads inbound-config.json; ok is false without tokens
+func loadInboundConfig() (cfg InboundConfig, ok bool, err error) {
+	if err := readDataFile("inbound-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	return cfg, len(cfg.Tokens) > 0, nil
+}
+
+// caller returns the configured token matching a request's bearer token,
+// or one standing for a write API key
+func (c InboundConfig) caller(r *http.Request) (InboundToken, bool) {
+	if key, ok := requestAPIKey(r); ok && key.allows("write") {
+		return InboundToken{Name: key.user()}, true
+	}
+	token := publicToken(r)
+	var found InboundToken
+	ok := false
+	for _, t := range c.Tokens {
+		if t.Token != "" && subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// user is how changes made with the token are attributed; API keys standing
+// in for a token are attributed as everywhere else
+func (t InboundToken) user() string {
+	if strings.HasPrefix(t.Name, "apikey:") {
+		return t.Name
+	}
+	return "inbound:" + t.Name
+}
+
+// upsertInboundRelease applies a request of a caller to the releases
+// document and saves it; created reports whether the release is new. Only
+// approvers may set an approved status, as in the UI.
+func upsertInboundRelease(r *http.Request, req inboundRelease, fields map[string]interface{}, caller string) (entry map[string]interface{}, created bool, err error) {
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return nil, false, err
+	}
+	current, _, err := loadReleasesDocument()
+	if err != nil {
+		return nil, false, err
+	}
+	id := releaseID(req.Environment, req.Date)
+	entry, exists := findReleaseEntry(doc, id)
+	if !exists {
+		entry = map[string]interface{}{"date": req.Date, "status": "Planned"}
+		list, _ := doc[req.Environment].([]interface{})
+		doc[req.Environment] = append(list, entry)
+	}
+	for _, field := range inboundReleaseFields {
+		if v, ok := fields[field]; ok {
+			if v == nil {
+				delete(entry, field)
+			} else {
+				entry[field] = v
+			}
+		}
+	}
+	if req.MoveTo != "" && req.MoveTo != req.Date {
+		if _, taken := entriesByDate(doc[req.Environment])[req.MoveTo]; taken {
+			return nil, false, &saveError{status: http.StatusConflict, msg: fmt.Sprintf("%s already has a release on %s", req.Environment, req.MoveTo)}
+		}
+		entry["date"] = req.MoveTo
+	}
+	if err := authorizeApprovals(r, current, doc); err != nil {
+		return nil, false, err
+	}
+	if _, err := writeJSONFile(r.Context(), filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, caller); err != nil {
+		return nil, false, err
+	}
+	return entry, !exists, nil
+}
+
+// Handle releases scheduled by external systems: POST creates or updates a
+// release through the same validation, rules and backups as the UI
+func handleInboundReleases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadInboundConfig()
+	if err != nil {
+		http.Error(w, "Invalid inbound config", http.StatusInternalServerError)
+		return
+	}
+	if _, bearer := bearerAPIKey(r); !ok && !bearer {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	caller, ok := cfg.caller(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="relplanner"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var fields map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var req inboundRelease
+	decodeInto(fields, &req)
+	if req.Environment == "" {
+		http.Error(w, "Missing environment", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(dateLayout, req.Date); err != nil {
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(dateLayout, req.MoveTo); err != nil && req.MoveTo != "" {
+		http.Error(w, "Invalid moveTo, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if len(caller.Environments) > 0 && !anyOf(caller.Environments, req.Environment) {
+		http.Error(w, fmt.Sprintf("Token %s may not schedule releases on %s", caller.Name, req.Environment), http.StatusForbidden)
+		return
+	}
+	// API keys act as their user, limited by permissions.json like the UI;
+	// moveTo stays on the environment, so it is covered too
+	if _, isKey := requestAPIKey(r); isKey {
+		if err := authorizeEnvironments(r, req.Environment); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+	known := false
+	for _, def := range envs.Environments {
+		known = known || def.Name == req.Environment
+	}
+	if !known {
+		http.Error(w, fmt.Sprintf("Unknown environment %q", req.Environment), http.StatusBadRequest)
+		return
+	}
+	if status, ok := fields["status"].(string); ok && len(envs.ReleaseStatuses) > 0 && status != "None" {
+		if _, known := envs.ReleaseStatuses[status]; !known {
+			http.Error(w, fmt.Sprintf("Unknown status %q", status), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Edits made in the UI meanwhile are picked up by trying again
+	var entry map[string]interface{}
+	var created bool
+	for attempt := 0; ; attempt++ {
+		entry, created, err = upsertInboundRelease(r, req, fields, caller.user())
+		var se *saveError
+		if err == nil || attempt == 2 || !errors.As(err, &se) || se.status != http.StatusPreconditionFailed {
+			break
+		}
+	}
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	date, _ := entry["date"].(string)
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":      releaseID(req.Environment, date),
+		"created": created,
+		"release": entry,
+	})
+}
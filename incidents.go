@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// releaseIncidents decodes the incidents linked to a release entry
+func releaseIncidents(entry map[string]interface{}) []ReleaseIncident {
+	incidents := []ReleaseIncident{}
+	decodeInto(entry["incidents"], &incidents)
+	if incidents == nil {
+		incidents = []ReleaseIncident{}
+	}
+	return incidents
+}
+
+// incidentRelease returns the release an incident is linked to, if any
+func incidentRelease(doc map[string]interface{}, incident string) (string, bool) {
+	for env, list := range doc {
+		entries, _ := list.([]interface{})
+		for _, item := range entries {
+			entry, _ := item.(map[string]interface{})
+			date, _ := entry["date"].(string)
+			for _, inc := range releaseIncidents(entry) {
+				if strings.EqualFold(inc.ID, incident) {
+					return releaseID(env, date), true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// Handle the incidents of a release: GET lists them, POST links one the
+// release is suspected of causing. An incident is linked to one release.
+func handleReleaseIncidents(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(releaseIncidents(entry))
+
+	case http.MethodPost:
+		if err := authorizeEnvironments(r, env); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		var inc ReleaseIncident
+		if err := json.NewDecoder(r.Body).Decode(&inc); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		inc.ID = strings.TrimSpace(inc.ID)
+		inc.Severity = strings.ToLower(strings.TrimSpace(inc.Severity))
+		if inc.ID == "" || inc.Severity == "" {
+			http.Error(w, "An incident needs an id and a severity", http.StatusBadRequest)
+			return
+		}
+		if inc.URL != "" {
+			u, err := url.Parse(inc.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				http.Error(w, "url must be an http(s) URL", http.StatusBadRequest)
+				return
+			}
+		}
+		if other, ok := incidentRelease(doc, inc.ID); ok {
+			http.Error(w, fmt.Sprintf("Incident %s is already linked to %s", inc.ID, other), http.StatusConflict)
+			return
+		}
+		inc.LinkedBy = requestUser(r)
+		inc.LinkedAt = time.Now().UTC().Format(time.RFC3339)
+		entry["incidents"] = append(releaseIncidents(entry), inc)
+		writeReleaseIncidents(w, r, doc, etag, entry)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle unlinking a single incident from a release
+func handleReleaseIncident(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeEnvironments(r, env); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	incident := r.PathValue("incident")
+	linked := releaseIncidents(entry)
+	kept := []ReleaseIncident{}
+	for _, inc := range linked {
+		if !strings.EqualFold(inc.ID, incident) {
+			kept = append(kept, inc)
+		}
+	}
+	if len(kept) == len(linked) {
+		http.Error(w, "Incident is not linked to this release", http.StatusNotFound)
+		return
+	}
+	// An empty list rather than none, which would keep the linked incidents
+	entry["incidents"] = kept
+	writeReleaseIncidents(w, r, doc, etag, entry)
+}
+
+// writeReleaseIncidents saves the releases document and responds with the
+// release's incidents
+func writeReleaseIncidents(w http.ResponseWriter, r *http.Request, doc map[string]interface{}, etag string, entry map[string]interface{}) {
+	newETag, err := writeJSONFile(withServerFields(r.Context()), filepath.Join(dataDir, "releases.json"), doc, etag, maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", newETag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releaseIncidents(entry))
+}
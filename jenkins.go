@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// JenkinsConfig is jenkins-config.json, kept on disk only since it holds
+// credentials. Deploying a release builds its jenkinsJob, or the job of its
+// environment, with the environment and version as parameters.
+type JenkinsConfig struct {
+	URL                  string            `json:"url"` // e.g. https://jenkins.example.com
+	Username             string            `json:"username,omitempty"`
+	APIToken             string            `json:"apiToken,omitempty"`
+	Jobs                 map[string]string `json:"jobs,omitempty"`                 // environment -> job path
+	EnvironmentParameter string            `json:"environmentParameter,omitempty"` // default ENVIRONMENT
+	VersionParameter     string            `json:"versionParameter,omitempty"`     // default VERSION
+	Parameters           map[string]string `json:"parameters,omitempty"`           // extra parameters of every build
+	PollSeconds          int               `json:"pollIntervalSeconds,omitempty"`  // default 15
+}
+
+// loadJenkinsConfig reads jenkins-config.json; ok is false without a URL
+func loadJenkinsConfig() (cfg JenkinsConfig, ok bool, err error) {
+	if err := readDataFile("jenkins-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	if cfg.EnvironmentParameter == "" {
+		cfg.EnvironmentParameter = "ENVIRONMENT"
+	}
+	if cfg.VersionParameter == "" {
+		cfg.VersionParameter = "VERSION"
+	}
+	if cfg.PollSeconds <= 0 {
+		cfg.PollSeconds = 15
+	}
+	return cfg, cfg.URL != "", nil
+}
+
+// jobURL returns the URL of a job path, "folder/job" being /job/folder/job/job
+func (c JenkinsConfig) jobURL(job string) string {
+	var b strings.Builder
+	b.WriteString(c.URL)
+	for _, part := range strings.Split(strings.Trim(job, "/"), "/") {
+		b.WriteString("/job/" + url.PathEscape(part))
+	}
+	return b.String()
+}
+
+// request builds an authenticated request to Jenkins
+func (c JenkinsConfig) request(method, rawURL string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.APIToken)
+	}
+	return req, nil
+}
+
+// triggerJenkinsBuild queues a parameterized build and returns the URL of
+// its queue item
+func triggerJenkinsBuild(cfg JenkinsConfig, job string, params url.Values) (string, error) {
+	req, err := cfg.request(http.MethodPost, cfg.jobURL(job)+"/buildWithParameters", strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := maintenanceHTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("job %s: %s: %s", job, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	queue := resp.Header.Get("Location")
+	if queue == "" {
+		return "", fmt.Errorf("job %s: Jenkins returned no queue item", job)
+	}
+	return strings.TrimSuffix(queue, "/") + "/", nil
+}
+
+// jenkinsQueueItem is the part of a queue item's api/json read back
+type jenkinsQueueItem struct {
+	Cancelled  bool   `json:"cancelled"`
+	Why        string `json:"why"`
+	Executable *struct {
+		URL string `json:"url"`
+	} `json:"executable"`
+}
+
+// jenkinsBuild is the part of a build's api/json read back
+type jenkinsBuild struct {
+	Building bool   `json:"building"`
+	Result   string `json:"result"`
+}
+
+// getJenkinsJSON reads the api/json of a queue item or build URL
+func getJenkinsJSON(cfg JenkinsConfig, rawURL string, out interface{}) error {
+	req, err := cfg.request(http.MethodGet, strings.TrimSuffix(rawURL, "/")+"/api/json", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, nil, out)
+}
+
+func init() {
+	registerDeployer("jenkins", jenkinsDeployer{})
+}
+
+// jenkinsDeployer builds Jenkins jobs with the environment and version as
+// parameters
+type jenkinsDeployer struct{}
+
+// Target returns the release's jenkinsJob, else its environment's job
+func (jenkinsDeployer) Target(env string, release ReleaseEntry) (string, error) {
+	cfg, ok, err := loadJenkinsConfig()
+	if err != nil || !ok {
+		return "", err
+	}
+	if release.JenkinsJob != "" {
+		return release.JenkinsJob, nil
+	}
+	return cfg.Jobs[env], nil
+}
+
+// Trigger queues a build of the job
+func (jenkinsDeployer) Trigger(env string, release ReleaseEntry, d ReleaseDeployment, extra map[string]string) (ReleaseDeployment, error) {
+	cfg, ok, err := loadJenkinsConfig()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, err
+	}
+	params := url.Values{}
+	for k, v := range cfg.Parameters {
+		params.Set(k, v)
+	}
+	for k, v := range extra {
+		params.Set(k, v)
+	}
+	params.Set(cfg.EnvironmentParameter, env)
+	if d.Version != "" {
+		params.Set(cfg.VersionParameter, d.Version)
+	}
+	d.QueueURL, err = triggerJenkinsBuild(cfg, d.Job, params)
+	return d, err
+}
+
+// Poll follows a build from the queue to its result
+func (jenkinsDeployer) Poll(d ReleaseDeployment) (ReleaseDeployment, string, error) {
+	cfg, ok, err := loadJenkinsConfig()
+	if err == nil && !ok {
+		err = errNotConfigured
+	}
+	if err != nil {
+		return d, "", err
+	}
+	if d.URL == "" {
+		var item jenkinsQueueItem
+		if err := getJenkinsJSON(cfg, d.QueueURL, &item); err != nil {
+			return d, "", err
+		}
+		switch {
+		case item.Cancelled:
+			d.Status, d.Result = deploymentFinished, "CANCELLED"
+			d.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+		case item.Executable != nil && item.Executable.URL != "":
+			d.Status, d.URL = deploymentRunning, item.Executable.URL
+		}
+		return d, "", nil
+	}
+	var build jenkinsBuild
+	if err := getJenkinsJSON(cfg, d.URL, &build); err != nil {
+		return d, "", err
+	}
+	if !build.Building && build.Result != "" {
+		d.Status, d.Result = deploymentFinished, build.Result
+		d.FinishedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	return d, "", nil
+}
+
+// PollInterval is pollIntervalSeconds of jenkins-config.json
+func (jenkinsDeployer) PollInterval() time.Duration {
+	cfg, _, _ := loadJenkinsConfig()
+	return time.Duration(cfg.PollSeconds) * time.Second
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// defaultJiraCacheTTL applies when jira-config.json sets no cacheTTLSeconds
+const defaultJiraCacheTTL = 5 * time.Minute
+
+// jiraCacheEntry is the result of one JQL search
+type jiraCacheEntry struct {
+	tickets   []map[string]interface{}
+	fetchedAt time.Time
+}
+
+// jiraTicketCache holds search results keyed by profile and JQL
+type jiraTicketCache struct {
+	mu      sync.Mutex
+	entries map[string]jiraCacheEntry
+}
+
+var jiraCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// get returns the cached result for a JQL query
+func (c *jiraTicketCache) get(jql string) (jiraCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[jql]
+	return e, ok
+}
+
+// put stores a search result
+func (c *jiraTicketCache) put(jql string, tickets []map[string]interface{}) jiraCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := jiraCacheEntry{tickets: tickets, fetchedAt: time.Now()}
+	c.entries[jql] = e
+	return e
+}
+
+// updateTicket replaces the ticket with the given key in every cached result
+// that contains it. It returns the number of results changed.
+func (c *jiraTicketCache) updateTicket(key string, ticket map[string]interface{}) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := 0
+	for jql, e := range c.entries {
+		tickets := make([]map[string]interface{}, len(e.tickets))
+		found := false
+		for i, t := range e.tickets {
+			if t["key"] == key {
+				t, found = ticket, true
+			}
+			tickets[i] = t
+		}
+		if found {
+			// Keep the fetch time so the TTL still forces a full refresh
+			c.entries[jql] = jiraCacheEntry{tickets: tickets, fetchedAt: e.fetchedAt}
+			changed++
+		}
+	}
+	return changed
+}
+
+// keys returns the cache keys of all cached searches
+func (c *jiraTicketCache) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// removeTicket drops a ticket from every cached result
+func (c *jiraTicketCache) removeTicket(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	changed := 0
+	for jql, e := range c.entries {
+		tickets := make([]map[string]interface{}, 0, len(e.tickets))
+		for _, t := range e.tickets {
+			if t["key"] != key {
+				tickets = append(tickets, t)
+			}
+		}
+		if len(tickets) != len(e.tickets) {
+			c.entries[jql] = jiraCacheEntry{tickets: tickets, fetchedAt: e.fetchedAt}
+			changed++
+		}
+	}
+	return changed
+}
+
+// jiraTicketsResult is a ticket list together with where it came from
+type jiraTicketsResult struct {
+	tickets     []map[string]interface{}
+	fetchedAt   time.Time
+	cacheStatus string // HIT, MISS or STALE
+	stale       bool
+	warnings    []string // parts of the search that failed
+}
+
+// jiraCacheTTL reads cacheTTLSeconds from the Jira config
+func jiraCacheTTL(config map[string]interface{}) time.Duration {
+	if v, ok := config["cacheTTLSeconds"].(float64); ok && v >= 0 {
+		return time.Duration(v) * time.Second
+	}
+	return defaultJiraCacheTTL
+}
+
+// loadJiraConfig returns the default Jira profile
+func loadJiraConfig() (map[string]interface{}, error) {
+	return loadJiraProfile("")
+}
+
+// loadJiraProfile returns a named profile of jira-config.json. Profiles live
+// under "profiles" and inherit the top-level settings they don't set. The top
+// level itself is the default profile unless defaultProfile names another.
+func loadJiraProfile(name string) (map[string]interface{}, error) {
+	root, err := readJiraConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	return jiraProfileFrom(root, name)
+}
+
+// jiraProfileFrom resolves a profile of an already decoded jira-config.json
+func jiraProfileFrom(root map[string]interface{}, name string) (map[string]interface{}, error) {
+	if name == "" {
+		name, _ = root["defaultProfile"].(string)
+	}
+
+	config := map[string]interface{}{}
+	for k, v := range root {
+		if k != "profiles" && k != "defaultProfile" {
+			config[k] = v
+		}
+	}
+	if name == "" {
+		return config, nil
+	}
+	profiles, _ := root["profiles"].(map[string]interface{})
+	profile, ok := profiles[name].(map[string]interface{})
+	if !ok {
+		return nil, &jiraError{http.StatusNotFound, fmt.Sprintf("Unknown Jira profile %q", name)}
+	}
+	for k, v := range profile {
+		config[k] = v
+	}
+	config["profile"] = name
+	return config, nil
+}
+
+// jiraProfilesParam parses ?profile=: empty means the default profile, "all"
+// every configured profile, otherwise a comma separated list
+func jiraProfilesParam(param string) ([]string, error) {
+	if param == "" {
+		return []string{""}, nil
+	}
+	if param != "all" {
+		return strings.Split(param, ","), nil
+	}
+	root, err := readJiraConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	profiles, _ := root["profiles"].(map[string]interface{})
+	if len(profiles) == 0 {
+		return []string{""}, nil
+	}
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// cachedProfileTickets returns the tickets of the given profiles, narrowed to
+// a sprint when one is given. With several profiles every ticket is tagged
+// with its profile and a failing profile is reported in failed instead of
+// failing the whole request.
+func cachedProfileTickets(profiles []string, sprint string, refresh bool) (jiraTicketsResult, []string, error) {
+	merged := jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "HIT"}
+	var failed []string
+	for _, name := range profiles {
+		result, err := func() (jiraTicketsResult, error) {
+			config, err := loadJiraProfile(strings.TrimSpace(name))
+			if err != nil {
+				return jiraTicketsResult{}, err
+			}
+			jql, _ := config["jql"].(string)
+			if sprint != "" {
+				if jql, err = sprintJQL(jql, sprint); err != nil {
+					return jiraTicketsResult{}, err
+				}
+			}
+			return cachedJiraSearch(config, jql, refresh)
+		}()
+		if err != nil {
+			if len(profiles) == 1 {
+				return jiraTicketsResult{}, nil, err
+			}
+			failed = append(failed, fmt.Sprintf("profile %s: %v", name, err))
+			continue
+		}
+
+		if len(profiles) == 1 {
+			return result, nil, nil
+		}
+		for _, t := range result.tickets {
+			tagged := map[string]interface{}{"profile": name}
+			for k, v := range t {
+				tagged[k] = v
+			}
+			merged.tickets = append(merged.tickets, tagged)
+		}
+		// Report the least fresh of the merged results
+		switch {
+		case result.stale:
+			merged.stale, merged.cacheStatus = true, "STALE"
+		case result.cacheStatus == "MISS" && !merged.stale:
+			merged.cacheStatus = "MISS"
+		}
+		if merged.fetchedAt.IsZero() || result.fetchedAt.Before(merged.fetchedAt) {
+			merged.fetchedAt = result.fetchedAt
+		}
+	}
+	if len(failed) == len(profiles) {
+		return jiraTicketsResult{}, nil, &jiraError{http.StatusBadGateway, strings.Join(failed, "; ")}
+	}
+	return merged, failed, nil
+}
+
+// cachedJiraTickets returns the tickets of the default profile's JQL
+func cachedJiraTickets(refresh bool) (jiraTicketsResult, error) {
+	config, err := loadJiraConfig()
+	if err != nil {
+		return jiraTicketsResult{}, err
+	}
+	jql, _ := config["jql"].(string)
+	return cachedJiraSearch(config, jql, refresh)
+}
+
+// cachedJiraSearch returns the tickets of a JQL search, from the cache while
+// it is fresh. When Jira fails, a cached result is served as stale instead
+// of the error. While the background refresh runs, cached results are always
+// served and only searches it hasn't seen yet go to Jira.
+func cachedJiraSearch(config map[string]interface{}, jql string, refresh bool) (jiraTicketsResult, error) {
+	profile, _ := config["profile"].(string)
+	cacheKey := profile + "\x00" + jql
+	cached, ok := jiraCache.get(cacheKey)
+	if ok && !refresh {
+		if time.Since(cached.fetchedAt) < jiraCacheTTL(config) {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+		}
+		if jiraBackgroundRefresh() {
+			stale := time.Since(cached.fetchedAt) >= staleAfter(config)
+			status := "HIT"
+			if stale {
+				status = "STALE"
+			}
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: status, stale: stale}, nil
+		}
+	}
+
+	tickets, err := fetchJiraTickets(context.Background(), config, jql)
+	if err != nil {
+		if ok {
+			logJira.Warn("Jira unavailable, serving cached tickets", "cachedAt", cached.fetchedAt.Format(time.RFC3339), "err", err)
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, err
+	}
+	entry := jiraCache.put(cacheKey, tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// jiraWebhookEvent is the part of a Jira webhook payload we use
+type jiraWebhookEvent struct {
+	WebhookEvent string      `json:"webhookEvent"`
+	Issue        *jira.Issue `json:"issue"`
+	Changelog    struct {
+		Items []struct {
+			Field      string `json:"field"`
+			FromString string `json:"fromString"`
+			ToString   string `json:"toString"`
+		} `json:"items"`
+	} `json:"changelog"`
+}
+
+// maxWebhookBody bounds the size of an accepted webhook payload
+const maxWebhookBody = 1 << 20
+
+// verifyJiraWebhook checks the webhook secret from jira-config.json. Jira
+// Cloud signs the body (X-Hub-Signature: sha256=...); Data Center webhooks
+// can only carry the secret in the URL (?secret=...).
+func verifyJiraWebhook(r *http.Request, body []byte, secret string) bool {
+	if sig := r.Header.Get("X-Hub-Signature"); sig != "" {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(sig), []byte(expected))
+	}
+	given := r.URL.Query().Get("secret")
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(secret)) == 1
+}
+
+// renameLinkedTicket rewrites a ticket key in the jiraTicket field and the
+// linked tickets of every release that references it, e.g. after an issue moved to another project
+func renameLinkedTicket(ctx context.Context, oldKey, newKey string) (int, error) {
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			field, _ := entry["jiraTicket"].(string)
+			keys := ticketKeys(field)
+			changed := false
+			for i, k := range keys {
+				if k == oldKey {
+					keys[i], changed = newKey, true
+				}
+			}
+			if changed {
+				entry["jiraTicket"] = strings.Join(keys, ", ")
+			}
+			linked, _ := entry["tickets"].([]interface{})
+			for i, k := range linked {
+				if k == oldKey {
+					linked[i], changed = newKey, true
+				}
+			}
+			if changed {
+				updated++
+			}
+		}
+	}
+	if updated == 0 {
+		return 0, nil
+	}
+	if _, err := writeJSONFile(ctx, filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, "webhook:jira"); err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// Handle Jira webhooks: issue updates refresh the cached tickets, deletions
+// drop them, and key changes are carried over to linked releases
+func handleJiraWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, err := loadJiraConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	secret, _ := config["webhookSecret"].(string)
+	if secret == "" {
+		http.Error(w, "Jira webhook secret is not configured", http.StatusForbidden)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if !verifyJiraWebhook(r, body, secret) {
+		http.Error(w, "Invalid webhook secret", http.StatusUnauthorized)
+		return
+	}
+
+	var event jiraWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Issue == nil || event.Issue.Key == "" {
+		http.Error(w, "Invalid webhook payload", http.StatusBadRequest)
+		return
+	}
+
+	result := map[string]interface{}{"event": event.WebhookEvent, "key": event.Issue.Key}
+	switch event.WebhookEvent {
+	case "jira:issue_deleted":
+		result["updatedTickets"] = jiraCache.removeTicket(event.Issue.Key)
+	case "jira:issue_created", "jira:issue_updated":
+		ticket := jiraTicketFromIssue(*event.Issue)
+		updated := 0
+		for _, item := range event.Changelog.Items {
+			if item.Field != "Key" || item.FromString == "" {
+				continue
+			}
+			// The issue moved projects: cached copies under the old key are replaced
+			updated += jiraCache.updateTicket(item.FromString, ticket)
+			n, err := renameLinkedTicket(r.Context(), item.FromString, item.ToString)
+			if err != nil {
+				logJira.ErrorContext(r.Context(), "Jira webhook: updating linked releases failed", "issue", item.FromString, "err", err)
+				writeSaveError(w, fmt.Errorf("updating linked releases: %w", err))
+				return
+			}
+			result["updatedReleases"] = n
+		}
+		if updated == 0 {
+			updated = jiraCache.updateTicket(event.Issue.Key, ticket)
+		}
+		result["updatedTickets"] = updated
+	default:
+		result["ignored"] = true
+	}
+
+	logJira.InfoContext(r.Context(), "Jira webhook", "event", event.WebhookEvent, "issue", event.Issue.Key)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// jiraSecretFields are never sent to clients
+var jiraSecretFields = []string{"apiToken", "webhookSecret"}
+
+// jiraSecretMask replaces a secret on read. Posting it back keeps the saved value.
+const jiraSecretMask = "********"
+
+// jiraConfigSections returns the top level and every profile of a Jira config
+func jiraConfigSections(config map[string]interface{}) []map[string]interface{} {
+	sections := []map[string]interface{}{config}
+	profiles, _ := config["profiles"].(map[string]interface{})
+	for _, p := range profiles {
+		if profile, ok := p.(map[string]interface{}); ok {
+			sections = append(sections, profile)
+		}
+	}
+	return sections
+}
+
+// maskJiraConfig returns a copy of a Jira config with its secrets masked
+func maskJiraConfig(config map[string]interface{}) map[string]interface{} {
+	var masked map[string]interface{}
+	decodeInto(config, &masked)
+	for _, section := range jiraConfigSections(masked) {
+		for _, field := range jiraSecretFields {
+			if v, _ := section[field].(string); v != "" {
+				section[field] = jiraSecretMask
+			}
+		}
+	}
+	return masked
+}
+
+// unmaskJiraConfig puts the saved secrets back where a client returned the mask
+func unmaskJiraConfig(next, current map[string]interface{}) {
+	currentProfiles, _ := current["profiles"].(map[string]interface{})
+	restore := func(section, saved map[string]interface{}) {
+		for _, field := range jiraSecretFields {
+			if section[field] == jiraSecretMask {
+				if saved[field] != nil {
+					section[field] = saved[field]
+				} else {
+					delete(section, field)
+				}
+			}
+		}
+	}
+	restore(next, current)
+	profiles, _ := next["profiles"].(map[string]interface{})
+	for name, p := range profiles {
+		profile, _ := p.(map[string]interface{})
+		saved, _ := currentProfiles[name].(map[string]interface{})
+		if profile != nil {
+			restore(profile, saved)
+		}
+	}
+}
+
+// validateJiraConfig checks jira-config.json
+func validateJiraConfig(data interface{}) error {
+	config, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("jira-config.json must be an object")
+	}
+	if p, ok := config["profiles"]; ok {
+		if _, ok := p.(map[string]interface{}); !ok {
+			return fmt.Errorf("profiles must map names to profile objects")
+		}
+	}
+	profiles, _ := config["profiles"].(map[string]interface{})
+	if name, _ := config["defaultProfile"].(string); name != "" && profiles[name] == nil {
+		return fmt.Errorf("defaultProfile %q is not a configured profile", name)
+	}
+
+	for name, p := range profiles {
+		if _, ok := p.(map[string]interface{}); !ok {
+			return fmt.Errorf("profile %s must be an object", name)
+		}
+	}
+	for _, section := range jiraConfigSections(config) {
+		if base, _ := section["baseUrl"].(string); base != "" {
+			u, err := url.Parse(base)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid baseUrl %q", base)
+			}
+		}
+		if auth, _ := section["authType"].(string); auth != "" && auth != "basic" && auth != "bearer" && auth != "auto" {
+			return fmt.Errorf("unknown authType %q, expected basic, bearer or auto", auth)
+		}
+		if d, _ := section["deployment"].(string); d != "" && d != "cloud" && d != "server" {
+			return fmt.Errorf("unknown deployment %q, expected cloud or server", d)
+		}
+		for _, field := range jiraSecretFields {
+			if v, _ := section[field].(string); isEncrypted(v) {
+				aead, err := secretCipher()
+				if err != nil {
+					return err
+				}
+				if _, err := decryptSecret(aead, v); err != nil {
+					return fmt.Errorf("%s: %w", field, err)
+				}
+			}
+		}
+		for _, field := range []string{"maxResults", "maxTotalResults", "cacheTTLSeconds"} {
+			if v, ok := section[field]; ok {
+				if n, ok := v.(float64); !ok || n < 0 {
+					return fmt.Errorf("%s must be a non-negative number", field)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// testJiraConfig connects to Jira with every profile that has credentials
+func testJiraConfig(ctx context.Context, stored map[string]interface{}) error {
+	var config map[string]interface{}
+	decodeInto(stored, &config)
+	if err := decryptJiraSecrets(config); err != nil {
+		return err
+	}
+
+	names := []string{""}
+	profiles, _ := config["profiles"].(map[string]interface{})
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	for _, name := range names {
+		profile, err := jiraProfileFrom(config, name)
+		if err != nil {
+			return err
+		}
+		if _, _, err := newJiraClientFor(ctx, profile); err != nil {
+			if name == "" {
+				return err
+			}
+			return fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Handle jira-config.json: GET masks the secrets, POST validates the config,
+// tests the connection (skipped with ?test=0) and saves it with a backup
+func handleJiraConfig(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Join(dataDir, "jira-config.json")
+
+	current := map[string]interface{}{}
+	raw, err := os.ReadFile(filePath)
+	if err == nil {
+		if err := json.Unmarshal(raw, &current); err != nil {
+			http.Error(w, "Invalid Jira config", http.StatusInternalServerError)
+			return
+		}
+	} else if !os.IsNotExist(err) {
+		http.Error(w, "Failed to read Jira config", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if raw != nil {
+			w.Header().Set("ETag", computeETag(raw))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(maskJiraConfig(current))
+
+	case http.MethodPost:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Error reading request body", http.StatusBadRequest)
+			return
+		}
+		var next map[string]interface{}
+		if err := json.Unmarshal(body, &next); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		unmaskJiraConfig(next, current)
+		if err := validateJiraConfig(next); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("test") != "0" {
+			if err := testJiraConfig(r.Context(), next); err != nil {
+				http.Error(w, fmt.Sprintf("Jira connection test failed: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		etag, err := writeJSONFile(r.Context(), filePath, next, r.Header.Get("If-Match"), maxBackupsFromRequest(r), requestUser(r))
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		writeSuccess(w, r, "Jira config updated successfully with backup")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// jqlPreviewSize is the number of tickets validate-jql returns as a preview
+const jqlPreviewSize = 10
+
+// jqlValidation is the response of POST /api/jira/validate-jql
+type jqlValidation struct {
+	Valid   bool                     `json:"valid"`
+	Total   int                      `json:"total"`
+	Errors  []string                 `json:"errors,omitempty"`
+	Preview []map[string]interface{} `json:"preview"`
+}
+
+// Handle JQL validation: runs {"jql": ..., "profile": ...} against Jira with
+// strict validation and reports the result count, a preview of the first
+// tickets, or the errors Jira found in the query
+func handleValidateJQL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		JQL     string `json:"jql"`
+		Profile string `json:"profile"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.JQL) == "" {
+		http.Error(w, "Invalid request body, expected {\"jql\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	config, err := loadJiraProfile(req.Profile)
+	if err != nil {
+		writeJiraError(w, err)
+		return
+	}
+	client, _, err := newJiraClientFor(r.Context(), config)
+	if err != nil {
+		writeJiraError(w, err)
+		return
+	}
+	if client == nil {
+		http.Error(w, "Jira is not configured", http.StatusBadRequest)
+		return
+	}
+
+	result := jqlValidation{Preview: []map[string]interface{}{}}
+	var issues []jira.Issue
+	var response *jira.Response
+	if detectJiraDeployment(config).cloud() {
+		// The Cloud search validates strictly and counts separately
+		issues, _, response, err = searchJiraCloud(client, req.JQL, jqlPreviewSize, "")
+		if err == nil {
+			if result.Total, err = countJiraCloud(client, req.JQL); err != nil {
+				logJira.WarnContext(r.Context(), "Jira result count failed", "err", err)
+				result.Total, err = len(issues), nil
+			}
+		}
+	} else {
+		issues, response, err = client.Issue.Search(req.JQL, &jira.SearchOptions{MaxResults: jqlPreviewSize, ValidateQuery: "strict"})
+		if err == nil {
+			result.Total = response.Total
+		}
+	}
+	switch {
+	case err == nil:
+		result.Valid = true
+		for _, issue := range issues {
+			result.Preview = append(result.Preview, jiraTicketFromIssue(issue))
+		}
+	case response != nil && response.StatusCode == http.StatusBadRequest:
+		// Jira rejected the query itself, report its reasons
+		var jerr *jira.Error
+		if errors.As(err, &jerr) {
+			result.Errors = append(result.Errors, jerr.ErrorMessages...)
+			for field, msg := range jerr.Errors {
+				result.Errors = append(result.Errors, field+": "+msg)
+			}
+		}
+		if len(result.Errors) == 0 {
+			result.Errors = []string{err.Error()}
+		}
+	case response != nil:
+		writeJiraError(w, &jiraError{http.StatusBadGateway, fmt.Sprintf("Jira API error: %d", response.StatusCode)})
+		return
+	default:
+		writeJiraError(w, &jiraError{http.StatusBadGateway, "Failed to connect to Jira server"})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// jiraDeployment describes the kind of Jira behind a base URL. Cloud and
+// Server/Data Center differ in how tokens are sent and which search API is
+// available.
+type jiraDeployment struct {
+	Type    string `json:"type"`   // "cloud" or "server"
+	Source  string `json:"source"` // "config", "serverInfo" or "url"
+	Version string `json:"version,omitempty"`
+	Title   string `json:"serverTitle,omitempty"`
+}
+
+// cloud reports whether the deployment is Jira Cloud
+func (d jiraDeployment) cloud() bool { return d.Type == "cloud" }
+
+// jiraDeployments caches detection results by base URL
+var jiraDeployments = struct {
+	sync.Mutex
+	byURL map[string]jiraDeployment
+}{byURL: map[string]jiraDeployment{}}
+
+// jiraDetectClient is used for the unauthenticated serverInfo request
+var jiraDetectClient = &http.Client{Timeout: 10 * time.Second}
+
+// detectJiraDeployment works out whether a profile talks to Jira Cloud or
+// Server/Data Center. "deployment" in the config overrides the detection,
+// otherwise serverInfo is asked and the host name is the fallback.
+func detectJiraDeployment(config map[string]interface{}) jiraDeployment {
+	switch d, _ := config["deployment"].(string); d {
+	case "cloud", "server":
+		return jiraDeployment{Type: d, Source: "config"}
+	}
+
+	baseUrl, _ := config["baseUrl"].(string)
+	jiraDeployments.Lock()
+	defer jiraDeployments.Unlock()
+	if d, ok := jiraDeployments.byURL[baseUrl]; ok {
+		return d
+	}
+
+	d, err := fetchJiraServerInfo(baseUrl)
+	if err != nil {
+		logJira.Warn("Jira serverInfo unavailable, guessing the deployment from the URL", "baseUrl", baseUrl, "err", err)
+		d = jiraDeployment{Type: "server", Source: "url"}
+		if u, err := url.Parse(baseUrl); err == nil {
+			host := strings.ToLower(u.Hostname())
+			if strings.HasSuffix(host, ".atlassian.net") || strings.HasSuffix(host, ".jira.com") {
+				d.Type = "cloud"
+			}
+		}
+		// Don't remember a guess, serverInfo may answer next time
+		return d
+	}
+	jiraDeployments.byURL[baseUrl] = d
+	return d
+}
+
+// fetchJiraServerInfo reads rest/api/2/serverInfo, which needs no login
+func fetchJiraServerInfo(baseUrl string) (jiraDeployment, error) {
+	resp, err := jiraDetectClient.Get(strings.TrimSuffix(baseUrl, "/") + "/rest/api/2/serverInfo")
+	if err != nil {
+		return jiraDeployment{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return jiraDeployment{}, fmt.Errorf("serverInfo: %s", resp.Status)
+	}
+	var info struct {
+		DeploymentType string `json:"deploymentType"`
+		Version        string `json:"version"`
+		ServerTitle    string `json:"serverTitle"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return jiraDeployment{}, fmt.Errorf("serverInfo: %w", err)
+	}
+	d := jiraDeployment{Type: "server", Source: "serverInfo", Version: info.Version, Title: info.ServerTitle}
+	if strings.EqualFold(info.DeploymentType, "cloud") {
+		d.Type = "cloud"
+	}
+	return d, nil
+}
+
+// jiraAuthType resolves the authType of a profile. Without one (or with
+// "auto") Cloud uses basic auth with the account email, Server/Data Center
+// uses a personal access token unless a username is set.
+func jiraAuthType(config map[string]interface{}) string {
+	authType, _ := config["authType"].(string)
+	if authType != "" && authType != "auto" {
+		return authType
+	}
+	username, _ := config["username"].(string)
+	if username != "" || detectJiraDeployment(config).cloud() {
+		return "basic"
+	}
+	return "bearer"
+}
+
+// searchJiraCloud runs one page of the enhanced JQL search Jira Cloud
+// replaced rest/api/2/search with. It pages by token and reports no total.
+func searchJiraCloud(client *jira.Client, jql string, maxResults int, pageToken string) ([]jira.Issue, string, *jira.Response, error) {
+	params := url.Values{}
+	params.Set("jql", jql)
+	params.Set("maxResults", strconv.Itoa(maxResults))
+	params.Set("fields", "*navigable")
+	if pageToken != "" {
+		params.Set("nextPageToken", pageToken)
+	}
+	req, err := client.NewRequest(http.MethodGet, "rest/api/2/search/jql?"+params.Encode(), nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	var page struct {
+		Issues        []jira.Issue `json:"issues"`
+		NextPageToken string       `json:"nextPageToken"`
+		IsLast        bool         `json:"isLast"`
+	}
+	resp, err := client.Do(req, &page)
+	if err != nil {
+		return nil, "", resp, jira.NewJiraError(resp, err)
+	}
+	if page.IsLast {
+		page.NextPageToken = ""
+	}
+	return page.Issues, page.NextPageToken, resp, nil
+}
+
+// countJiraCloud asks Jira Cloud for the approximate number of results of a query
+func countJiraCloud(client *jira.Client, jql string) (int, error) {
+	req, err := client.NewRequest(http.MethodPost, "rest/api/2/search/approximate-count", map[string]string{"jql": jql})
+	if err != nil {
+		return 0, err
+	}
+	var result struct {
+		Count int `json:"count"`
+	}
+	resp, err := client.Do(req, &result)
+	if err != nil {
+		return 0, jira.NewJiraError(resp, err)
+	}
+	return result.Count, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultJiraRefreshInterval applies when jira-config.json sets no
+// refreshIntervalSeconds; 0 turns the background refresh off
+const defaultJiraRefreshInterval = 2 * time.Minute
+
+// jiraRefreshStatus is the state of the background Jira refresh
+type jiraRefreshStatus struct {
+	Enabled     bool            `json:"enabled"`
+	Deployment  *jiraDeployment `json:"deployment,omitempty"`
+	AuthType    string          `json:"authType,omitempty"`
+	Interval    int             `json:"intervalSeconds"`
+	LastSync    *time.Time      `json:"lastSync,omitempty"`
+	LastAttempt *time.Time      `json:"lastAttempt,omitempty"`
+	NextSync    *time.Time      `json:"nextSync,omitempty"`
+	LastError   string          `json:"lastError,omitempty"`
+	Count       int             `json:"count"`
+	Searches    int             `json:"searches"`
+	Sprints     int             `json:"sprints"`
+}
+
+// jiraRefresher runs the background refresh and keeps its status
+var jiraRefresher = struct {
+	sync.Mutex
+	status jiraRefreshStatus
+	now    chan struct{}
+}{now: make(chan struct{}, 1)}
+
+// jiraRefreshInterval reads refreshIntervalSeconds from the Jira config
+func jiraRefreshInterval(config map[string]interface{}) time.Duration {
+	if v, ok := config["refreshIntervalSeconds"].(float64); ok && v >= 0 {
+		return time.Duration(v) * time.Second
+	}
+	return defaultJiraRefreshInterval
+}
+
+// jiraBackgroundRefresh reports whether the background job keeps the cache
+// current, in which case requests are answered from the cache
+func jiraBackgroundRefresh() bool {
+	jiraRefresher.Lock()
+	defer jiraRefresher.Unlock()
+	return jiraRefresher.status.Enabled
+}
+
+// staleAfter is the age from which a cached result counts as stale: the
+// cache TTL, or two missed refreshes when the refresh runs less often
+func staleAfter(config map[string]interface{}) time.Duration {
+	ttl := jiraCacheTTL(config)
+	if interval := 2 * jiraRefreshInterval(config); interval > ttl {
+		return interval
+	}
+	return ttl
+}
+
+// refreshJira refetches the default search of every profile, every other
+// search in the cache and the sprints of the configured boards
+func refreshJira() (count, searches, sprints int, err error) {
+	ctx, span := startSpan(context.Background(), "refresh jira", spanInternal, nil)
+	defer func() { span.finish(err) }()
+	names, err := jiraProfilesParam("all")
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var errs []string
+	done := map[string]bool{}
+	search := func(config map[string]interface{}, jql string) int {
+		profile, _ := config["profile"].(string)
+		key := profile + "\x00" + jql
+		if done[key] {
+			return 0
+		}
+		done[key] = true
+		tickets, err := fetchJiraTickets(ctx, config, jql)
+		if err != nil {
+			if profile != "" {
+				err = fmt.Errorf("profile %s: %w", profile, err)
+			}
+			errs = append(errs, err.Error())
+			return 0
+		}
+		jiraCache.put(key, tickets)
+		searches++
+		return len(tickets)
+	}
+
+	// The default profile first, it may be the top level rather than a named one
+	profiles := map[string]map[string]interface{}{}
+	for _, name := range append([]string{""}, names...) {
+		config, err := loadJiraProfile(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		profile, _ := config["profile"].(string)
+		if _, ok := profiles[profile]; ok {
+			continue
+		}
+		profiles[profile] = config
+		jql, _ := config["jql"].(string)
+		count += search(config, jql)
+	}
+
+	// Searches requests made since, such as fixVersions and sprints
+	for _, key := range jiraCache.keys() {
+		name, jql, _ := strings.Cut(key, "\x00")
+		if config, ok := profiles[name]; ok {
+			search(config, jql)
+		}
+	}
+
+	config, _ := loadJiraConfig()
+	if boards := jiraBoards(config); len(boards) > 0 {
+		list, err := fetchSprints(ctx, boards)
+		if err != nil {
+			errs = append(errs, err.Error())
+		} else {
+			sprintCache.Lock()
+			sprintCache.sprints, sprintCache.fetchedAt = list, time.Now()
+			sprintCache.Unlock()
+			sprints = len(list)
+		}
+	}
+
+	if len(errs) > 0 {
+		err = errors.New(strings.Join(errs, "; "))
+	}
+	return count, searches, sprints, err
+}
+
+// runJiraRefresh keeps the Jira cache current in the background so requests
+// never wait on Jira. It rereads the config every round and wakes up early
+// when jira-config.json changes.
+func runJiraRefresh() {
+	for {
+		interval := defaultJiraRefreshInterval
+		config, err := loadJiraConfig()
+		if err == nil {
+			interval = jiraRefreshInterval(config)
+		}
+		_, statErr := os.Stat(filepath.Join(dataDir, "jira-config.json"))
+		enabled := statErr == nil && interval > 0
+
+		jiraRefresher.Lock()
+		jiraRefresher.status.Enabled = enabled
+		jiraRefresher.status.Interval = int(interval / time.Second)
+		jiraRefresher.status.NextSync = nil
+		jiraRefresher.Unlock()
+
+		if enabled && err == nil {
+			deployment := detectJiraDeployment(config)
+			jiraRefresher.Lock()
+			jiraRefresher.status.Deployment = &deployment
+			jiraRefresher.status.AuthType = jiraAuthType(config)
+			jiraRefresher.Unlock()
+		}
+		if enabled {
+			started := time.Now()
+			count, searches, sprints, err := refreshJira()
+			next := time.Now().Add(interval)
+
+			jiraRefresher.Lock()
+			s := &jiraRefresher.status
+			s.LastAttempt, s.NextSync = &started, &next
+			if err != nil {
+				logJira.Error("Background Jira refresh failed", "err", err)
+				s.LastError = err.Error()
+			} else {
+				s.LastError = ""
+			}
+			if searches > 0 {
+				s.LastSync = &started
+				s.Count, s.Searches, s.Sprints = count, searches, sprints
+			}
+			jiraRefresher.Unlock()
+		} else {
+			// Check again later in case Jira gets configured
+			interval = defaultJiraRefreshInterval
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-jiraRefresher.now:
+		}
+	}
+}
+
+// refreshJiraOnChange is the data change hook that reruns the refresh right
+// away when the Jira config is saved
+func refreshJiraOnChange(filename string) {
+	if filename != "jira-config.json" {
+		return
+	}
+	select {
+	case jiraRefresher.now <- struct{}{}:
+	default:
+	}
+}
+
+// Handle the Jira status: the state of the background refresh
+func handleJiraStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jiraRefresher.Lock()
+	status := jiraRefresher.status
+	jiraRefresher.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// jiraSyncConfig is the "sync" section of jira-config.json. Every direction
+// of the push to Jira has its own toggle.
+type jiraSyncConfig struct {
+	CreateIssues         bool     `json:"createIssues"`
+	Project              string   `json:"project"`
+	IssueType            string   `json:"issueType,omitempty"`
+	Statuses             []string `json:"statuses,omitempty"`
+	UpdateDueDate        bool     `json:"updateDueDate"`
+	TransitionOnComplete bool     `json:"transitionOnComplete"`
+	CompleteTransition   string   `json:"completeTransition,omitempty"`
+	FixVersions          bool     `json:"fixVersions"`
+}
+
+// jiraSyncedIssue is what was last pushed for a release issue
+type jiraSyncedIssue struct {
+	Release   string `json:"release"`
+	DueDate   string `json:"dueDate"`
+	Completed bool   `json:"completed,omitempty"`
+}
+
+// jiraSyncedVersion is what was last pushed for a fixVersion
+type jiraSyncedVersion struct {
+	Name        string `json:"name"`
+	ReleaseDate string `json:"releaseDate"`
+	Released    bool   `json:"released"`
+}
+
+// jiraSyncState is jira-sync.json: issues keyed by issue key, versions by ID
+type jiraSyncState struct {
+	Issues   map[string]jiraSyncedIssue   `json:"issues"`
+	Versions map[string]jiraSyncedVersion `json:"versions"`
+}
+
+// jiraSyncMu serializes syncs so an issue is never created twice
+var jiraSyncMu sync.Mutex
+
+// loadJiraSyncState reads jira-sync.json
+func loadJiraSyncState() (jiraSyncState, error) {
+	var state jiraSyncState
+	err := readDataFile("jira-sync.json", &state)
+	if state.Issues == nil {
+		state.Issues = map[string]jiraSyncedIssue{}
+	}
+	if state.Versions == nil {
+		state.Versions = map[string]jiraSyncedVersion{}
+	}
+	return state, err
+}
+
+// save writes jira-sync.json, server-maintained like maintenance-windows.json
+func (s jiraSyncState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "jira-sync.json"), data, 0644)
+}
+
+// unattached returns an issue created for the release that never made it
+// into releases.json, e.g. because the save raced with a client
+func (s jiraSyncState) unattached(release string, attached map[string]bool) string {
+	for key, issue := range s.Issues {
+		if issue.Release == release && !attached[key] {
+			return key
+		}
+	}
+	return ""
+}
+
+// versionID returns the ID of a fixVersion created under the given name
+func (s jiraSyncState) versionID(name string) string {
+	for id, v := range s.Versions {
+		if v.Name == name {
+			return id
+		}
+	}
+	return ""
+}
+
+// createReleaseIssue creates the Jira issue tracking a release
+func createReleaseIssue(client *jira.Client, cfg jiraSyncConfig, id string, entry map[string]interface{}) (string, error) {
+	env, date, _ := parseReleaseID(id)
+	name, _ := entry["releaseName"].(string)
+	summary := fmt.Sprintf("Release %s to %s on %s", name, env, date)
+	if name == "" {
+		summary = fmt.Sprintf("Release to %s on %s", env, date)
+	}
+	var lines []string
+	for _, field := range []string{"feTag", "beTag", "jiraTicket", "note"} {
+		if v, _ := entry[field].(string); v != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", field, v))
+		}
+	}
+	issueType := cfg.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": cfg.Project},
+			"issuetype":   map[string]string{"name": issueType},
+			"summary":     summary,
+			"description": strings.Join(lines, "\n"),
+			"duedate":     date,
+		},
+	}
+	req, err := client.NewRequest(http.MethodPost, "rest/api/2/issue", body)
+	if err != nil {
+		return "", err
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if _, err := client.Do(req, &created); err != nil {
+		return "", err
+	}
+	return created.Key, nil
+}
+
+// transitionIssue moves an issue through the transition with the given name
+func transitionIssue(client *jira.Client, key, name string) error {
+	transitions, _, err := client.Issue.GetTransitions(key)
+	if err != nil {
+		return err
+	}
+	for _, t := range transitions {
+		if strings.EqualFold(t.Name, name) || strings.EqualFold(t.To.Name, name) {
+			_, err := client.Issue.DoTransition(key, t.ID)
+			return err
+		}
+	}
+	return fmt.Errorf("no transition %q available for %s", name, key)
+}
+
+// syncReleaseIssues gives scheduled releases an issue, moves its due date
+// with the release and transitions it once the release is done. It reports
+// whether jiraIssue fields were added to the document.
+func syncReleaseIssues(client *jira.Client, cfg jiraSyncConfig, doc map[string]interface{}, state jiraSyncState, statuses map[string]bool) (bool, []error) {
+	attached := map[string]bool{}
+	for _, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			if key, _ := entry["jiraIssue"].(string); key != "" {
+				attached[key] = true
+			}
+		}
+	}
+
+	todayDate := today().Format(dateLayout)
+	docChanged := false
+	var errs []error
+	for env, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			date, _ := entry["date"].(string)
+			status, _ := entry["status"].(string)
+			id := releaseID(env, date)
+			key, _ := entry["jiraIssue"].(string)
+
+			if key == "" {
+				if !cfg.CreateIssues || !statuses[status] || date < todayDate {
+					continue
+				}
+				if key = state.unattached(id, attached); key == "" {
+					var err error
+					key, err = createReleaseIssue(client, cfg, id, entry)
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s: creating issue: %w", id, err))
+						continue
+					}
+					logJira.Info("Created Jira issue", "issue", key, "release", id)
+					state.Issues[key] = jiraSyncedIssue{Release: id, DueDate: date}
+				}
+				entry["jiraIssue"] = key
+				attached[key] = true
+				docChanged = true
+			}
+
+			synced, known := state.Issues[key]
+			if !known {
+				// Linked by hand: adopt it without pushing anything yet
+				synced = jiraSyncedIssue{Release: id, DueDate: date, Completed: completedStatuses[status]}
+			}
+			synced.Release = id
+			if cfg.UpdateDueDate && synced.DueDate != date {
+				if _, err := client.Issue.UpdateIssue(key, map[string]interface{}{
+					"fields": map[string]interface{}{"duedate": date},
+				}); err != nil {
+					errs = append(errs, fmt.Errorf("%s: updating due date of %s: %w", id, key, err))
+				} else {
+					synced.DueDate = date
+				}
+			}
+			if cfg.TransitionOnComplete && completedStatuses[status] && !synced.Completed {
+				if err := transitionIssue(client, key, cfg.CompleteTransition); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				} else {
+					synced.Completed = true
+				}
+			}
+			state.Issues[key] = synced
+		}
+	}
+	return docChanged, errs
+}
+
+// versionName is the Jira fixVersion of a release. Releases sharing a name,
+// e.g. one promoted through the pipeline, share the version.
+func versionName(env string, entry map[string]interface{}) string {
+	if name, _ := entry["releaseName"].(string); name != "" {
+		return name
+	}
+	date, _ := entry["date"].(string)
+	return env + " " + date
+}
+
+// saveVersion creates a fixVersion, or updates it when id is set, and
+// returns its ID
+func saveVersion(client *jira.Client, project, id string, v jiraSyncedVersion) (string, error) {
+	body := map[string]interface{}{
+		"name":        v.Name,
+		"releaseDate": v.ReleaseDate,
+		"released":    v.Released,
+	}
+	method, path := http.MethodPut, "rest/api/2/version/"+id
+	if id == "" {
+		body["project"] = project
+		method, path = http.MethodPost, "rest/api/2/version"
+	}
+	req, err := client.NewRequest(method, path, body)
+	if err != nil {
+		return "", err
+	}
+	var saved struct {
+		ID string `json:"id"`
+	}
+	if _, err := client.Do(req, &saved); err != nil {
+		return "", err
+	}
+	return saved.ID, nil
+}
+
+// syncFixVersions keeps one Jira fixVersion per release name: its release
+// date follows the latest release and it is released once all of them are
+// done. It reports whether jiraVersion fields were added to the document.
+func syncFixVersions(client *jira.Client, cfg jiraSyncConfig, doc map[string]interface{}, state jiraSyncState, statuses map[string]bool) (bool, []error) {
+	type versionGroup struct {
+		entries   []map[string]interface{}
+		id        string
+		want      jiraSyncedVersion
+		scheduled bool
+	}
+	groups := map[string]*versionGroup{}
+	var names []string
+	for env, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			name := versionName(env, entry)
+			g := groups[name]
+			if g == nil {
+				g = &versionGroup{want: jiraSyncedVersion{Name: name, Released: true}}
+				groups[name] = g
+				names = append(names, name)
+			}
+			g.entries = append(g.entries, entry)
+			if id, _ := entry["jiraVersion"].(string); id != "" {
+				g.id = id
+			}
+			date, _ := entry["date"].(string)
+			if date > g.want.ReleaseDate {
+				g.want.ReleaseDate = date
+			}
+			status, _ := entry["status"].(string)
+			g.want.Released = g.want.Released && completedStatuses[status]
+			g.scheduled = g.scheduled || statuses[status]
+		}
+	}
+	sort.Strings(names)
+
+	docChanged := false
+	var errs []error
+	for _, name := range names {
+		g := groups[name]
+		if g.id == "" {
+			g.id = state.versionID(name)
+		}
+		if g.id == "" && !g.scheduled {
+			continue
+		}
+		if current, ok := state.Versions[g.id]; !ok || current != g.want {
+			id, err := saveVersion(client, cfg.Project, g.id, g.want)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fixVersion %s: %w", name, err))
+				continue
+			}
+			if g.id == "" {
+				logJira.Info("Created Jira fixVersion", "version", name, "id", id)
+			}
+			g.id = id
+			state.Versions[id] = g.want
+		}
+		for _, entry := range g.entries {
+			if entry["jiraVersion"] != g.id {
+				entry["jiraVersion"] = g.id
+				docChanged = true
+			}
+		}
+	}
+	return docChanged, errs
+}
+
+// syncJiraIssues pushes releases to Jira: release issues and fixVersions,
+// each behind its own toggle in the sync section of jira-config.json
+func syncJiraIssues() (err error) {
+	jiraSyncMu.Lock()
+	defer jiraSyncMu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(dataDir, "jira-config.json")); os.IsNotExist(err) {
+		return nil
+	}
+	config, err := loadJiraConfig()
+	if err != nil {
+		return err
+	}
+	var cfg jiraSyncConfig
+	if err := decodeInto(config["sync"], &cfg); err != nil {
+		return fmt.Errorf("invalid sync section in Jira config: %w", err)
+	}
+	syncIssues := cfg.CreateIssues || cfg.UpdateDueDate || cfg.TransitionOnComplete
+	if !syncIssues && !cfg.FixVersions {
+		return nil
+	}
+	if (cfg.CreateIssues || cfg.FixVersions) && cfg.Project == "" {
+		return fmt.Errorf("Jira sync needs a project to create issues and versions in")
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = defaultMaintenanceStatuses
+	}
+	if cfg.CompleteTransition == "" {
+		cfg.CompleteTransition = "Done"
+	}
+	statuses := map[string]bool{}
+	for _, s := range cfg.Statuses {
+		statuses[s] = true
+	}
+
+	ctx, span := startSpan(context.Background(), "sync jira", spanInternal, nil)
+	defer func() { span.finish(err) }()
+	client, _, err := newJiraClient(ctx)
+	if err != nil || client == nil {
+		return err
+	}
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return err
+	}
+	state, err := loadJiraSyncState()
+	if err != nil {
+		return err
+	}
+
+	docChanged := false
+	var errs []error
+	if syncIssues {
+		changed, failed := syncReleaseIssues(client, cfg, doc, state, statuses)
+		docChanged, errs = docChanged || changed, append(errs, failed...)
+	}
+	if cfg.FixVersions {
+		changed, failed := syncFixVersions(client, cfg, doc, state, statuses)
+		docChanged, errs = docChanged || changed, append(errs, failed...)
+	}
+
+	// Save the state first so a failed releases write can reattach the issues
+	if err := state.save(); err != nil {
+		return err
+	}
+	if docChanged {
+		if _, err := writeJSONFile(withServerFields(ctx), filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, "sync:jira"); err != nil {
+			return fmt.Errorf("saving Jira keys: %w", err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("Jira sync: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// syncJiraOnChange is the data change hook pushing release changes to Jira in
+// the background
+func syncJiraOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := syncJiraIssues(); err != nil {
+			logJira.Error("Jira issue sync failed", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KubernetesConfig is kubernetes-config.json, kept on disk only since it
+// holds cluster tokens. Each environment lists the namespaces whose
+// Deployments run it; their image tags are read every refreshSeconds.
+type KubernetesConfig struct {
+	Clusters       []KubernetesCluster           `json:"clusters"`
+	Environments   map[string][]KubernetesSource `json:"environments"`
+	RefreshSeconds int                           `json:"refreshSeconds,omitempty"` // default 300
+}
+
+// KubernetesCluster is an API server and the credentials to read it with.
+// In a pod, tokenFile and caFile can point at the service account's.
+type KubernetesCluster struct {
+	Name      string `json:"name"`
+	Server    string `json:"server"` // e.g. https://k8s.example.com:6443
+	Token     string `json:"token,omitempty"`
+	TokenFile string `json:"tokenFile,omitempty"`
+	CAFile    string `json:"caFile,omitempty"`
+	CAData    string `json:"caData,omitempty"` // base64 PEM, as in a kubeconfig
+	Insecure  bool   `json:"insecureSkipTLSVerify,omitempty"`
+}
+
+// KubernetesSource selects Deployments of a namespace, all of them unless
+// deployments or a label selector narrow them down
+type KubernetesSource struct {
+	Cluster     string   `json:"cluster"`
+	Namespace   string   `json:"namespace"`
+	Selector    string   `json:"selector,omitempty"`
+	Deployments []string `json:"deployments,omitempty"`
+}
+
+// kubernetesDeployment is the part of an apps/v1 Deployment we use
+type kubernetesDeployment struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Replicas *int `json:"replicas"`
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Image string `json:"image"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+	Status struct {
+		ReadyReplicas   int `json:"readyReplicas"`
+		UpdatedReplicas int `json:"updatedReplicas"`
+	} `json:"status"`
+}
+
+// kubernetesCache holds the versions last read from the clusters
+var kubernetesCache struct {
+	sync.Mutex
+	versions  map[string]environmentVersions
+	fetchedAt time.Time
+}
+
+// loadKubernetesConfig reads kubernetes-config.json; ok is false without clusters
+func loadKubernetesConfig() (cfg KubernetesConfig, ok bool, err error) {
+	if err := readDataFile("kubernetes-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.RefreshSeconds <= 0 {
+		cfg.RefreshSeconds = 300
+	}
+	return cfg, len(cfg.Clusters) > 0, nil
+}
+
+// client returns an HTTP client trusting the cluster's CA, and its token
+func (c KubernetesCluster) client() (*http.Client, string, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Insecure}
+	if c.CAFile != "" || c.CAData != "" {
+		var pem []byte
+		var err error
+		if c.CAFile != "" {
+			pem, err = os.ReadFile(c.CAFile)
+		} else if pem, err = base64.StdEncoding.DecodeString(c.CAData); err != nil {
+			err = fmt.Errorf("invalid caData: %w", err)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, "", fmt.Errorf("no certificates in the CA of cluster %s", c.Name)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	token := c.Token
+	if c.TokenFile != "" {
+		data, err := os.ReadFile(c.TokenFile)
+		if err != nil {
+			return nil, "", err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Timeout: 15 * time.Second, Transport: transport}, token, nil
+}
+
+// listDeployments reads the Deployments of a source
+func listDeployments(cluster KubernetesCluster, src KubernetesSource) ([]kubernetesDeployment, error) {
+	client, token, err := cluster.client()
+	if err != nil {
+		return nil, err
+	}
+	u := strings.TrimSuffix(cluster.Server, "/") + "/apis/apps/v1/namespaces/" + url.PathEscape(src.Namespace) + "/deployments"
+	if src.Selector != "" {
+		u += "?labelSelector=" + url.QueryEscape(src.Selector)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: %s", cluster.Name, src.Namespace, resp.Status)
+	}
+	var list struct {
+		Items []kubernetesDeployment `json:"items"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&list)
+	return list.Items, err
+}
+
+// deployedFromKubernetes summarizes a Deployment; it is Available once every
+// replica runs the current template
+func deployedFromKubernetes(d kubernetesDeployment) deployedVersion {
+	v := deployedVersion{Source: "kubernetes", Name: d.Metadata.Name}
+	for _, c := range d.Spec.Template.Spec.Containers {
+		v.Images = append(v.Images, c.Image)
+		if v.Version == "" {
+			v.Version = imageTag(c.Image)
+		}
+	}
+	want := 1
+	if d.Spec.Replicas != nil {
+		want = *d.Spec.Replicas
+	}
+	v.Health = fmt.Sprintf("Progressing %d/%d", d.Status.ReadyReplicas, want)
+	if d.Status.ReadyReplicas >= want && d.Status.UpdatedReplicas >= want {
+		v.Health = "Available"
+	}
+	return v
+}
+
+// refreshKubernetesVersions reads the Deployments of every configured
+// environment into the cache. An unreachable cluster leaves its
+// environments with what was read before.
+func refreshKubernetesVersions(cfg KubernetesConfig) error {
+	clusters := map[string]KubernetesCluster{}
+	for _, c := range cfg.Clusters {
+		clusters[c.Name] = c
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	planned := plannedVersions(releases)
+
+	kubernetesCache.Lock()
+	previous := kubernetesCache.versions
+	kubernetesCache.Unlock()
+
+	versions := map[string]environmentVersions{}
+	var errs []error
+	for env, sources := range cfg.Environments {
+		result := environmentVersions{Planned: planned[env], Applications: []deployedVersion{}}
+		failed := false
+		for _, src := range sources {
+			cluster, ok := clusters[src.Cluster]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown cluster %q", env, src.Cluster))
+				failed = true
+				continue
+			}
+			deployments, err := listDeployments(cluster, src)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+				failed = true
+				continue
+			}
+			for _, d := range deployments {
+				if anyOf(src.Deployments, d.Metadata.Name) {
+					result.Applications = append(result.Applications, deployedFromKubernetes(d))
+				}
+			}
+		}
+		if failed && previous != nil {
+			if old, ok := previous[env]; ok {
+				result.Applications = old.Applications
+			}
+		}
+		sort.Slice(result.Applications, func(i, j int) bool { return result.Applications[i].Name < result.Applications[j].Name })
+		versions[env] = result
+	}
+
+	kubernetesCache.Lock()
+	kubernetesCache.versions, kubernetesCache.fetchedAt = versions, time.Now()
+	kubernetesCache.Unlock()
+	if len(errs) > 0 {
+		return fmt.Errorf("%d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// runKubernetesRefresh reads the clusters every refreshSeconds
+func runKubernetesRefresh() {
+	for {
+		interval := time.Minute
+		if cfg, ok, err := loadKubernetesConfig(); err != nil {
+			logKubernetes.Error("Error reading the Kubernetes config", "err", err)
+		} else if ok {
+			interval = time.Duration(cfg.RefreshSeconds) * time.Second
+			if err := refreshKubernetesVersions(cfg); err != nil {
+				logKubernetes.Error("Kubernetes refresh failed", "err", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Handle the versions running on each configured environment's clusters,
+// with the version planned to be there: GET serves the cache, POST reads
+// the clusters now
+func handleKubernetesVersions(w http.ResponseWriter, r *http.Request) {
+	cfg, ok, err := loadKubernetesConfig()
+	if err != nil {
+		http.Error(w, "Invalid Kubernetes config", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Kubernetes is not configured", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := refreshKubernetesVersions(cfg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kubernetesCache.Lock()
+	versions, fetchedAt := kubernetesCache.versions, kubernetesCache.fetchedAt
+	kubernetesCache.Unlock()
+	if versions == nil {
+		http.Error(w, "Kubernetes versions have not been read yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Last-Modified", fetchedAt.UTC().Format(http.TimeFormat))
+	json.NewEncoder(w).Encode(versions)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LinearConfig is linear-config.json, kept on disk only since it holds an
+// API key. Issues come from a team, optionally narrowed to projects;
+// releases using the "linear" ticket provider also get the issues of their cycle.
+type LinearConfig struct {
+	APIKey          string         `json:"apiKey"`
+	APIURL          string         `json:"apiUrl,omitempty"` // default https://api.linear.app/graphql
+	Team            string         `json:"team"`             // team key, e.g. ENG
+	Projects        []string       `json:"projects,omitempty"`
+	States          []string       `json:"states,omitempty"` // workflow state names, all when empty
+	Cycles          map[string]int `json:"cycles,omitempty"` // release name -> cycle number
+	CyclesByDate    bool           `json:"cyclesByDate"`     // map releases without a named cycle to the cycle they fall in
+	MaxTotalResults int            `json:"maxTotalResults,omitempty"`
+	CacheTTLSeconds *int           `json:"cacheTTLSeconds,omitempty"`
+}
+
+// linearKeyPattern matches an issue identifier such as ENG-123
+var linearKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9]*-[0-9]+$`)
+
+// linearCache holds issue searches keyed by their filter
+var linearCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// linearCycleCache holds the team's cycles, refreshed with the issue TTL
+var linearCycleCache struct {
+	sync.Mutex
+	cycles    []linearCycle
+	fetchedAt time.Time
+}
+
+// loadLinearConfig reads linear-config.json; ok is false when Linear isn't configured
+func loadLinearConfig() (cfg LinearConfig, ok bool, err error) {
+	if err := readDataFile("linear-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.linear.app/graphql"
+	}
+	return cfg, cfg.APIKey != "" && cfg.Team != "", nil
+}
+
+// cacheTTL is how long issue searches and cycles are reused
+func (c LinearConfig) cacheTTL() time.Duration {
+	if c.CacheTTLSeconds != nil && *c.CacheTTLSeconds >= 0 {
+		return time.Duration(*c.CacheTTLSeconds) * time.Second
+	}
+	return defaultJiraCacheTTL
+}
+
+// linearQuery runs a GraphQL query; errors reported in the response body
+// fail the call like HTTP errors
+func linearQuery(cfg LinearConfig, query string, variables map[string]interface{}, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, cfg.APIURL, nil)
+	if err != nil {
+		return err
+	}
+	// Personal API keys are sent as is, OAuth tokens with their Bearer prefix
+	req.Header.Set("Authorization", cfg.APIKey)
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := doJSON(req, map[string]interface{}{"query": query, "variables": variables}, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("GraphQL: %s", resp.Errors[0].Message)
+	}
+	return json.Unmarshal(resp.Data, out)
+}
+
+// linearIssuesQuery pages through issues matching a filter
+const linearIssuesQuery = `query Issues($filter: IssueFilter, $after: String) {
+  issues(filter: $filter, first: 100, after: $after) {
+    nodes {
+      identifier title url priorityLabel
+      state { name }
+      assignee { name }
+      project { name }
+      cycle { number name }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+// linearIssue is the part of an issue we use
+type linearIssue struct {
+	Identifier    string `json:"identifier"`
+	Title         string `json:"title"`
+	URL           string `json:"url"`
+	PriorityLabel string `json:"priorityLabel"`
+	State         struct {
+		Name string `json:"name"`
+	} `json:"state"`
+	Assignee *struct {
+		Name string `json:"name"`
+	} `json:"assignee"`
+	Project *struct {
+		Name string `json:"name"`
+	} `json:"project"`
+	Cycle *struct {
+		Number int    `json:"number"`
+		Name   string `json:"name"`
+	} `json:"cycle"`
+}
+
+// linearTicketFromIssue converts an issue to the Jira ticket format
+func linearTicketFromIssue(issue linearIssue) map[string]interface{} {
+	ticket := map[string]interface{}{
+		"key":      issue.Identifier,
+		"summary":  issue.Title,
+		"status":   issue.State.Name,
+		"priority": issue.PriorityLabel,
+		"url":      issue.URL,
+		"provider": "linear",
+	}
+	if issue.Assignee != nil {
+		ticket["assignee"] = issue.Assignee.Name
+	}
+	if issue.Project != nil {
+		ticket["project"] = issue.Project.Name
+	}
+	if issue.Cycle != nil {
+		ticket["cycle"] = issue.Cycle.Number
+	}
+	return ticket
+}
+
+// linearFilter is the issue filter of the configured team, projects and
+// states, narrowed to a cycle when cycle isn't 0
+func linearFilter(cfg LinearConfig, cycle int) map[string]interface{} {
+	filter := map[string]interface{}{
+		"team": map[string]interface{}{"key": map[string]string{"eq": cfg.Team}},
+	}
+	if len(cfg.Projects) > 0 {
+		filter["project"] = map[string]interface{}{"name": map[string][]string{"in": cfg.Projects}}
+	}
+	if len(cfg.States) > 0 {
+		filter["state"] = map[string]interface{}{"name": map[string][]string{"in": cfg.States}}
+	}
+	if cycle != 0 {
+		filter["cycle"] = map[string]interface{}{"number": map[string]int{"eq": cycle}}
+	}
+	return filter
+}
+
+// fetchLinearIssues loads the issues matching a filter, up to maxTotalResults
+func fetchLinearIssues(cfg LinearConfig, filter map[string]interface{}) ([]map[string]interface{}, error) {
+	limit := defaultJiraResultLimit
+	if cfg.MaxTotalResults > 0 {
+		limit = min(cfg.MaxTotalResults, jiraResultHardCap)
+	}
+	tickets := []map[string]interface{}{}
+	variables := map[string]interface{}{"filter": filter}
+	for len(tickets) < limit {
+		var page struct {
+			Issues struct {
+				Nodes    []linearIssue `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"issues"`
+		}
+		if err := linearQuery(cfg, linearIssuesQuery, variables, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues.Nodes {
+			if len(tickets) < limit {
+				tickets = append(tickets, linearTicketFromIssue(issue))
+			}
+		}
+		if !page.Issues.PageInfo.HasNextPage {
+			break
+		}
+		variables["after"] = page.Issues.PageInfo.EndCursor
+	}
+	return tickets, nil
+}
+
+// cachedLinearSearch returns the issues of a cycle (0 for all), cached and
+// served stale while Linear is unavailable like Jira searches
+func cachedLinearSearch(cfg LinearConfig, cycle int, refresh bool) (jiraTicketsResult, error) {
+	key := "cycle=" + strconv.Itoa(cycle)
+	cached, hit := linearCache.get(key)
+	if hit && !refresh && time.Since(cached.fetchedAt) < cfg.cacheTTL() {
+		return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+	}
+	tickets, err := fetchLinearIssues(cfg, linearFilter(cfg, cycle))
+	if err != nil {
+		logLinear.Error("Linear query failed", "err", err)
+		if hit {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, &jiraError{http.StatusBadGateway, fmt.Sprintf("Linear API error: %v", err)}
+	}
+	entry := linearCache.put(key, tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// cachedLinearTickets returns the issues of the configured team and projects
+func cachedLinearTickets(refresh bool) (jiraTicketsResult, error) {
+	cfg, ok, err := loadLinearConfig()
+	if err != nil {
+		return jiraTicketsResult{}, &jiraError{http.StatusInternalServerError, "Invalid Linear config"}
+	}
+	if !ok {
+		return jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "MISS"}, nil
+	}
+	return cachedLinearSearch(cfg, 0, refresh)
+}
+
+// linearCycle is a cycle of the configured team
+type linearCycle struct {
+	Number int       `json:"number"`
+	Name   string    `json:"name,omitempty"`
+	Start  time.Time `json:"startsAt"`
+	End    time.Time `json:"endsAt"`
+}
+
+// linearCyclesQuery lists the cycles of a team
+const linearCyclesQuery = `query Cycles($team: String!) {
+  teams(filter: { key: { eq: $team } }) {
+    nodes { cycles(first: 100) { nodes { number name startsAt endsAt } } }
+  }
+}`
+
+// cachedLinearCycles returns the team's cycles, served stale while Linear is down
+func cachedLinearCycles(cfg LinearConfig, refresh bool) ([]linearCycle, error) {
+	linearCycleCache.Lock()
+	defer linearCycleCache.Unlock()
+	if !refresh && linearCycleCache.cycles != nil && time.Since(linearCycleCache.fetchedAt) < cfg.cacheTTL() {
+		return linearCycleCache.cycles, nil
+	}
+	var resp struct {
+		Teams struct {
+			Nodes []struct {
+				Cycles struct {
+					Nodes []linearCycle `json:"nodes"`
+				} `json:"cycles"`
+			} `json:"nodes"`
+		} `json:"teams"`
+	}
+	if err := linearQuery(cfg, linearCyclesQuery, map[string]interface{}{"team": cfg.Team}, &resp); err != nil {
+		if linearCycleCache.cycles != nil {
+			logLinear.Warn("Linear unavailable, serving cached cycles", "cachedAt", linearCycleCache.fetchedAt.Format(time.RFC3339), "err", err)
+			return linearCycleCache.cycles, nil
+		}
+		return nil, err
+	}
+	cycles := []linearCycle{}
+	if len(resp.Teams.Nodes) > 0 {
+		cycles = resp.Teams.Nodes[0].Cycles.Nodes
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i].Number < cycles[j].Number })
+	linearCycleCache.cycles, linearCycleCache.fetchedAt = cycles, time.Now()
+	return cycles, nil
+}
+
+// linearReleaseCycle is the cycle mapped to a release: set in cycles, named
+// after the release or, with cyclesByDate, the one its date falls in
+func linearReleaseCycle(cfg LinearConfig, cycles []linearCycle, release ReleaseEntry) int {
+	if n := cfg.Cycles[release.ReleaseName]; n != 0 {
+		return n
+	}
+	for _, c := range cycles {
+		if release.ReleaseName != "" && c.Name == release.ReleaseName {
+			return c.Number
+		}
+	}
+	if cfg.CyclesByDate {
+		if date, err := time.Parse(dateLayout, release.Date); err == nil {
+			for _, c := range cycles {
+				if !date.Before(c.Start.Truncate(24*time.Hour)) && date.Before(c.End) {
+					return c.Number
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// linearReleaseTickets returns the tickets of a release using the Linear
+// provider: the linked issues and those in its mapped cycle
+func linearReleaseTickets(release ReleaseEntry) []map[string]interface{} {
+	linked, _ := cachedLinearTickets(false)
+	tickets := lookupTickets(release.linkedTickets(), linked, "linear")
+
+	cfg, ok, err := loadLinearConfig()
+	if err != nil || !ok {
+		return tickets
+	}
+	cycles, err := cachedLinearCycles(cfg, false)
+	if err != nil {
+		logLinear.Error("Fetching Linear cycles failed", "err", err)
+		return tickets
+	}
+	cycle := linearReleaseCycle(cfg, cycles, release)
+	if cycle == 0 {
+		return tickets
+	}
+	result, err := cachedLinearSearch(cfg, cycle, false)
+	if err != nil {
+		logLinear.Error("Fetching cycle issues failed", "cycle", cycle, "err", err)
+		return tickets
+	}
+	return appendNewTickets(tickets, result.tickets)
+}
+
+// linearProvider serves releases using the "linear" ticket provider
+type linearProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "linear", Name: "Linear", ConfigFile: "linear-config.json",
+		KeyFormat: "TEAM-number", KeyExample: "ENG-123"}, linearProvider{})
+}
+
+func (linearProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	return cachedLinearTickets(refresh)
+}
+
+func (linearProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	return linearReleaseTickets(release)
+}
+
+func (linearProvider) Link(key string) (string, bool) {
+	key = strings.ToUpper(key)
+	return key, linearKeyPattern.MatchString(key)
+}
+
+// linearCycleEntry is one entry of GET /api/linear/cycles
+type linearCycleEntry struct {
+	linearCycle
+	Releases []string `json:"releases"`
+}
+
+// Handle Linear cycles: the team's cycles, each mapped to its releases
+func handleLinearCycles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadLinearConfig()
+	if err != nil {
+		http.Error(w, "Invalid Linear config", http.StatusInternalServerError)
+		return
+	}
+	entries := []linearCycleEntry{}
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+	cycles, err := cachedLinearCycles(cfg, r.URL.Query().Get("refresh") == "1")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Linear API error: %v", err), http.StatusBadGateway)
+		return
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+	byCycle := map[int][]string{}
+	for env, list := range releases {
+		for _, e := range list {
+			if n := linearReleaseCycle(cfg, cycles, e); n != 0 {
+				byCycle[n] = append(byCycle[n], releaseID(env, e.Date))
+			}
+		}
+	}
+	for _, c := range cycles {
+		ids := byCycle[c.Number]
+		sort.Strings(ids)
+		if ids == nil {
+			ids = []string{}
+		}
+		entries = append(entries, linearCycleEntry{c, ids})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
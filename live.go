@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// liveChange is a data file saved, as pushed to /api/ws clients
+type liveChange struct {
+	Seq     int64    `json:"seq,omitempty"` // of the audit log entry
+	Time    string   `json:"time"`
+	File    string   `json:"file"`
+	Action  string   `json:"action"`            // create, update, restore, undo or redo
+	Records []string `json:"records,omitempty"` // release ids, environment names or holiday dates changed
+	By      string   `json:"by,omitempty"`
+	ETag    string   `json:"etag"` // of the saved file, unquoted
+}
+
+// Intervals of the WebSocket keepalive: clients not answering a ping in
+// livePongWait are dropped
+const (
+	livePingInterval = 30 * time.Second
+	livePongWait     = 60 * time.Second
+	liveWriteWait    = 10 * time.Second
+)
+
+// liveClient is a connected /api/ws client
+type liveClient struct {
+	send  chan liveChange
+	files map[string]bool // nil for all files
+}
+
+// liveClients are the connected clients
+var liveClients = struct {
+	sync.Mutex
+	clients map[*liveClient]bool
+}{clients: map[*liveClient]bool{}}
+
+// privateFiles are data files of accounts and their settings, whose
+// changes are the audit log's business rather than every planner's
+var privateFiles = map[string]bool{"users.json": true, "api-keys.json": true, "preferences.json": true}
+
+// sharedFile reports whether changes of a file are followed by planners:
+// the data files, not integration configs, private files or backups
+func sharedFile(file string) bool {
+	return strings.HasSuffix(file, ".json") && !strings.Contains(file, "/") &&
+		!strings.HasSuffix(file, "-config.json") && !privateFiles[file]
+}
+
+// publishLiveChange pushes a change to the clients. A client too slow to
+// keep up is dropped rather than holding up the save, and reloads when it
+// reconnects.
+func publishLiveChange(c liveChange) {
+	if !sharedFile(c.File) {
+		return
+	}
+	liveClients.Lock()
+	defer liveClients.Unlock()
+	for client := range liveClients.clients {
+		if client.files != nil && !client.files[c.File] {
+			continue
+		}
+		select {
+		case client.send <- c:
+		default:
+			delete(liveClients.clients, client)
+			close(client.send)
+		}
+	}
+}
+
+// recordVersions returns the records of a data file by key, each as its
+// JSON to compare versions by; nil for files without records
+func recordVersions(file string, content []byte) map[string]string {
+	if content == nil {
+		return map[string]string{}
+	}
+	versions := map[string]string{}
+	add := func(key string, v interface{}) {
+		b, _ := json.Marshal(v)
+		versions[key] = string(b)
+	}
+	switch file {
+	case "releases.json":
+		var releases ReleasesData
+		if json.Unmarshal(content, &releases) != nil {
+			return nil
+		}
+		for env, entries := range releases {
+			for _, e := range entries {
+				add(releaseID(env, e.Date), e)
+			}
+		}
+	case "environments.json":
+		var envs EnvironmentsData
+		if json.Unmarshal(content, &envs) != nil {
+			return nil
+		}
+		for _, env := range envs.Environments {
+			add(env.Name, env)
+		}
+	case "holidays.json":
+		var holidays HolidaysData
+		if json.Unmarshal(content, &holidays) != nil {
+			return nil
+		}
+		for _, h := range holidays.Holidays {
+			add(h.Date, h)
+		}
+	default:
+		return nil
+	}
+	return versions
+}
+
+// changedRecords lists the records of a data file added, changed or
+// removed between two versions
+func changedRecords(file string, before, after []byte) []string {
+	old, next := recordVersions(file, before), recordVersions(file, after)
+	if old == nil || next == nil {
+		return nil
+	}
+	var changed []string
+	for key, v := range next {
+		if old[key] != v {
+			changed = append(changed, key)
+		}
+	}
+	for key := range old {
+		if _, ok := next[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// liveUpgrader accepts WebSockets from the server's own pages and the
+// origins allowed by cors-config.json
+var liveUpgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		return loadCORSConfig().allowedOrigin(origin) != ""
+	},
+}
+
+// Handle the live updates WebSocket: every data file saved is pushed to
+// the client as a liveChange, only those of the files query parameter when
+// given, so planners see each other's changes as they are made
+func handleLiveUpdates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	client := &liveClient{send: make(chan liveChange, 64)}
+	if files := r.URL.Query().Get("files"); files != "" {
+		client.files = map[string]bool{}
+		for _, f := range strings.Split(files, ",") {
+			client.files[strings.TrimSpace(f)] = true
+		}
+	}
+	conn, err := liveUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader has responded
+	}
+	defer conn.Close()
+	liveClients.Lock()
+	liveClients.clients[client] = true
+	liveClients.Unlock()
+	defer func() {
+		liveClients.Lock()
+		if liveClients.clients[client] {
+			delete(liveClients.clients, client)
+			close(client.send)
+		}
+		liveClients.Unlock()
+	}()
+	logHTTP.DebugContext(r.Context(), "Live updates connected", "remote", clientIP(r))
+
+	// Clients only answer pings; reading notices them going away
+	gone := make(chan struct{})
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case c, ok := <-client.send:
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "Too slow, reconnect"))
+				return
+			}
+			if err := conn.WriteJSON(c); err != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// Page sizes of GET /api/changes
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+)
+
+// changesPage is the JSON response of GET /api/changes
+type changesPage struct {
+	Cursor  int64        `json:"cursor"` // since= of the next poll
+	Changes []liveChange `json:"changes"`
+	More    bool         `json:"more,omitempty"` // poll again for the rest
+}
+
+// auditCursor returns the sequence number of the last audit entry
+func auditCursor() (int64, error) {
+	auditLog.Lock()
+	defer auditLog.Unlock()
+	if err := loadAuditTailLocked(); err != nil {
+		return 0, err
+	}
+	return auditLog.seq, nil
+}
+
+// Handle polling for changes: the data files saved after the ?since=
+// cursor, of ?file= only when given, a page of ?limit= at a time, read from
+// the audit log. Without since only the cursor is returned, to start from.
+// Changes to records are listed on /api/ws only, the audit log keeping
+// checksums of whole files.
+func handleChanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	since := int64(-1)
+	if v := query.Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'since' cursor", http.StatusBadRequest)
+			return
+		}
+		since = n
+	}
+	limit := defaultChangesLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxChangesLimit {
+			http.Error(w, fmt.Sprintf("Invalid 'limit', expected 1 to %d", maxChangesLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	file := query.Get("file")
+
+	cursor, err := auditCursor()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading the audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if since > cursor {
+		http.Error(w, "Cursor is ahead of the change log, start over without 'since'", http.StatusGone)
+		return
+	}
+	page := changesPage{Cursor: cursor, Changes: []liveChange{}}
+
+	// Polls finding nothing new don't read the log
+	if since >= 0 && since < cursor {
+		files, err := auditFiles()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading the audit log: %v", err), http.StatusInternalServerError)
+			return
+		}
+		first := int64(0)
+		for _, path := range files {
+			err := readAuditFile(path, func(e auditEntry) error {
+				if first == 0 {
+					first = e.Seq
+				}
+				if e.Seq <= since || page.More || !sharedFile(e.File) || file != "" && !strings.EqualFold(e.File, file) {
+					return nil
+				}
+				if len(page.Changes) == limit {
+					page.More = true
+					page.Cursor = page.Changes[limit-1].Seq
+					return nil
+				}
+				page.Changes = append(page.Changes, liveChange{Seq: e.Seq, Time: e.Time, File: e.File, Action: e.Action, By: e.User, ETag: e.After})
+				return nil
+			})
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Error reading the audit log: %v", err), http.StatusInternalServerError)
+				return
+			}
+		}
+		// Entries after the cursor removed by the retention policy
+		if first > since+1 {
+			http.Error(w, "Changes since the cursor are no longer kept, start over without 'since'", http.StatusGone)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Failed logins allowed before lockouts start, how long the first lockout
+// lasts, doubling with every further failure up to the longest, and how
+// long failures are remembered without another
+const (
+	loginFailuresAllowed = 5
+	loginLockoutBase     = 30 * time.Second
+	loginLockoutMax      = 15 * time.Minute
+	loginFailureWindow   = time.Hour
+)
+
+// eventLoginLockout mails the admins when an account is locked out, when
+// email-config.json lists it in its events
+const eventLoginLockout = "loginLockout"
+
+// auditLockout is the audit action of a lockout
+const auditLockout = "lockout"
+
+// loginFailures counts the failed logins of a username from a client
+// address, or of a client address
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// loginAttempts holds the failed logins by "user:<name>@<address>" and
+// "ip:<address>".
+// Instances sharing the data directory behind a cluster lock keep them in
+// loginAttemptDir instead.
+var loginAttempts = struct {
+	sync.Mutex
+	byKey map[string]loginFailures
+}{byKey: map[string]loginFailures{}}
+
+// loginAttemptDir holds the failed logins of instances sharing the data
+// directory, a file per key named by its hash, so a lockout holds whichever
+// instance the next attempt reaches
+func loginAttemptDir() string {
+	return filepath.Join(dataDir, "login-attempts")
+}
+
+// loginFailuresRecord is a key's file of loginAttemptDir
+type loginFailuresRecord struct {
+	Count       int       `json:"count"`
+	Last        time.Time `json:"last"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// readLoginFailures reads a key's file, false when it has none
+func readLoginFailures(path string) (loginFailures, bool) {
+	var rec loginFailuresRecord
+	b, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(b, &rec) != nil {
+		return loginFailures{}, false
+	}
+	return loginFailures{count: rec.Count, last: rec.Last, lockedUntil: rec.LockedUntil}, true
+}
+
+// lookupLoginFailures returns the failed logins counted against a key;
+// loginAttempts must be locked
+func lookupLoginFailures(key string) (loginFailures, bool) {
+	if clusterConfig != nil {
+		return readLoginFailures(filepath.Join(loginAttemptDir(), hashAPIKey(key)+".json"))
+	}
+	f, ok := loginAttempts.byKey[key]
+	return f, ok
+}
+
+// storeLoginFailures keeps the failed logins of a key; loginAttempts must be
+// locked
+func storeLoginFailures(key string, f loginFailures) error {
+	if clusterConfig == nil {
+		loginAttempts.byKey[key] = f
+		return nil
+	}
+	if err := os.MkdirAll(loginAttemptDir(), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(loginFailuresRecord{Count: f.count, Last: f.last, LockedUntil: f.lockedUntil})
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Join(loginAttemptDir(), hashAPIKey(key)+".json"), b, 0600)
+}
+
+// endLoginFailures forgets the failed logins of a key; loginAttempts must be
+// locked
+func endLoginFailures(key string) {
+	if clusterConfig != nil {
+		os.Remove(filepath.Join(loginAttemptDir(), hashAPIKey(key)+".json"))
+		return
+	}
+	delete(loginAttempts.byKey, key)
+}
+
+// dropLoginFailures forgets the failed logins matching; unreadable files go
+// too. loginAttempts must be locked.
+func dropLoginFailures(match func(f loginFailures) bool) {
+	if clusterConfig != nil {
+		paths, _ := filepath.Glob(filepath.Join(loginAttemptDir(), "*.json"))
+		for _, path := range paths {
+			if f, ok := readLoginFailures(path); !ok || match(f) {
+				os.Remove(path)
+			}
+		}
+		return
+	}
+	for key, f := range loginAttempts.byKey {
+		if match(f) {
+			delete(loginAttempts.byKey, key)
+		}
+	}
+}
+
+// loginAttemptKeys are the keys a login attempt counts against: the
+// username, whether or not it exists, from the client's address, and the
+// address. A username is only locked for the address failing its logins, so
+// others can't lock its user out.
+func loginAttemptKeys(r *http.Request, username string) []string {
+	ip := clientIP(r)
+	return []string{"user:" + strings.ToLower(username) + "@" + ip, "ip:" + ip}
+}
+
+// loginLockedOut returns how long logins are still locked for a username
+// from the client's address, or for the address
+func loginLockedOut(r *http.Request, username string) time.Duration {
+	loginAttempts.Lock()
+	defer loginAttempts.Unlock()
+	var wait time.Duration
+	for _, key := range loginAttemptKeys(r, username) {
+		if f, ok := lookupLoginFailures(key); ok {
+			wait = max(wait, time.Until(f.lockedUntil))
+		}
+	}
+	return wait
+}
+
+// loginLockout is how long the failure after count others locks logins
+func loginLockout(count int) time.Duration {
+	if count < loginFailuresAllowed {
+		return 0
+	}
+	d := time.Duration(float64(loginLockoutBase) * math.Pow(2, float64(count-loginFailuresAllowed)))
+	if d <= 0 || d > loginLockoutMax {
+		return loginLockoutMax
+	}
+	return d
+}
+
+// loginFailed counts a failed login, locking further ones out once there
+// were too many, which is audited and mailed to the admins
+func loginFailed(r *http.Request, username string) {
+	now := time.Now()
+	ip := clientIP(r)
+	var locked time.Duration
+	loginAttempts.Lock()
+	dropLoginFailures(func(f loginFailures) bool {
+		return now.Sub(f.last) > loginFailureWindow && now.After(f.lockedUntil)
+	})
+	for _, key := range loginAttemptKeys(r, username) {
+		f, _ := lookupLoginFailures(key)
+		f.count++
+		f.last = now
+		if d := loginLockout(f.count); d > 0 {
+			f.lockedUntil = now.Add(d)
+			locked = max(locked, d)
+		}
+		if err := storeLoginFailures(key, f); err != nil {
+			logAuth.ErrorContext(r.Context(), "Could not count a failed login", "err", err)
+		}
+	}
+	loginAttempts.Unlock()
+
+	if locked == 0 {
+		return
+	}
+	logAuth.WarnContext(r.Context(), "Logins locked after failed attempts", "user", username, "remote", ip, "lockout", locked)
+	audit(auditEntry{Action: auditLockout, File: "users.json", Record: username,
+		Detail: fmt.Sprintf("failed logins from %s, locked for %s", ip, locked)})
+	go mailLockout(username, ip, locked)
+}
+
+// loginSucceeded forgets the failed logins of a username and address
+func loginSucceeded(r *http.Request, username string) {
+	loginAttempts.Lock()
+	defer loginAttempts.Unlock()
+	for _, key := range loginAttemptKeys(r, username) {
+		endLoginFailures(key)
+	}
+}
+
+// writeLockedOut answers a login attempt while logins are locked
+func writeLockedOut(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, fmt.Sprintf("Too many failed logins, try again in %ds", seconds), http.StatusTooManyRequests)
+}
+
+// mailLockout tells the admins, who are team.json people by username, of a
+// lockout when email-config.json asks for it
+func mailLockout(username, ip string, locked time.Duration) {
+	cfg, ok, err := loadEmailConfig()
+	if err != nil || !ok || !cfg.wants(eventLoginLockout) {
+		return
+	}
+	team, err := loadTeam()
+	if err != nil {
+		logNotify.Error("Error mailing a lockout", "err", err)
+		return
+	}
+	var admins []string
+	accounts.Lock()
+	for _, u := range accounts.users {
+		if u.role() == "admin" && !u.Disabled {
+			admins = append(admins, u.Username)
+		}
+	}
+	accounts.Unlock()
+	to := emailAddresses(team, admins)
+	if len(to) == 0 {
+		return
+	}
+	subject := fmt.Sprintf("Logins of %s from %s locked after failed attempts", username, ip)
+	body := fmt.Sprintf("Repeated failed logins of %q from %s locked further logins from there for %s.\n", username, ip, locked)
+	if err := sendEmail(cfg, to, subject, body); err != nil {
+		logNotify.Error("Error mailing a lockout", "err", err)
+	}
+}
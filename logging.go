@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LoggingConfig is logging-config.json, read at startup
+type LoggingConfig struct {
+	Level  string `json:"level,omitempty"`  // debug, info, warn or error, default info
+	Format string `json:"format,omitempty"` // text or json, default text
+	// Components overrides the level of components, e.g. {"jira": "debug"}
+	Components map[string]string `json:"components,omitempty"`
+	// Redact names fields masked in log output besides passwords, tokens,
+	// keys and other credentials, e.g. ["email"]
+	Redact   []string    `json:"redact,omitempty"`
+	Rotation LogRotation `json:"rotation,omitempty"`
+}
+
+// Component loggers; their output can be told apart by the component
+// attribute and their levels set apart in logging-config.json
+var (
+	logServer      = newLogger("server")
+	logHTTP        = newLogger("http")
+	logAuth        = newLogger("auth")
+	logAudit       = newLogger("audit")
+	logJira        = newLogger("jira")
+	logGitHub      = newLogger("github")
+	logGitLab      = newLogger("gitlab")
+	logADO         = newLogger("ado")
+	logLinear      = newLogger("linear")
+	logTrello      = newLogger("trello")
+	logConfluence  = newLogger("confluence")
+	logServiceNow  = newLogger("servicenow")
+	logStatusPage  = newLogger("statuspage")
+	logKubernetes  = newLogger("kubernetes")
+	logMaintenance = newLogger("maintenance")
+	logNotify      = newLogger("notify")
+	logDeploy      = newLogger("deploy")
+	logSearch      = newLogger("search")
+	logAnalytics   = newLogger("analytics")
+	logPublic      = newLogger("public")
+	logGRPC        = newLogger("grpc")
+	logPlugins     = newLogger("plugins")
+	logCloudExport = newLogger("cloudexport")
+	logReplication = newLogger("replication")
+)
+
+// logSetup is the handler all loggers write through and their levels; text
+// to stderr at info until configureLogging runs
+var logSetup = struct {
+	sync.RWMutex
+	handler    slog.Handler
+	level      slog.Level
+	components map[string]slog.Level
+}{handler: slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})}
+
+// parseLevel parses a level name
+func parseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	if err != nil {
+		return level, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// configureLogging sets where and how logs are written, from
+// logging-config.json; the standard log package goes through it as well
+func configureLogging(out io.Writer) error {
+	var cfg LoggingConfig
+	err := readDataFile("logging-config.json", &cfg)
+	level := slog.LevelInfo
+	if err == nil && cfg.Level != "" {
+		level, err = parseLevel(cfg.Level)
+	}
+	components := map[string]slog.Level{}
+	for name, l := range cfg.Components {
+		if err != nil {
+			break
+		}
+		components[strings.ToLower(name)], err = parseLevel(l)
+	}
+	opts := &slog.HandlerOptions{Level: slog.LevelDebug}
+	var handler slog.Handler = slog.NewTextHandler(out, opts)
+	if strings.EqualFold(cfg.Format, "json") {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+
+	setRedactedFields(cfg.Redact)
+	logSetup.Lock()
+	logSetup.handler, logSetup.level, logSetup.components = handler, level, components
+	logSetup.Unlock()
+	slog.SetDefault(newLogger(""))
+	return err
+}
+
+// componentLevel returns the level a component logs from
+func componentLevel(component string) slog.Level {
+	logSetup.RLock()
+	defer logSetup.RUnlock()
+	if level, ok := logSetup.components[component]; ok {
+		return level
+	}
+	return logSetup.level
+}
+
+// componentHandler writes a component's records through the configured
+// handler, which may change after the logger was made
+type componentHandler struct {
+	component string
+	with      []func(slog.Handler) slog.Handler // attributes and groups, in order
+}
+
+// newLogger returns the logger of a component
+func newLogger(component string) *slog.Logger {
+	return slog.New(&componentHandler{component: component})
+}
+
+func (h *componentHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= componentLevel(h.component)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	logSetup.RLock()
+	handler := logSetup.handler
+	logSetup.RUnlock()
+	if h.component != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("component", h.component)})
+	}
+	if id := requestIDFrom(ctx); id != "" {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("requestId", id)})
+	}
+	if s := spanFrom(ctx); s != nil {
+		handler = handler.WithAttrs([]slog.Attr{slog.String("traceId", fmt.Sprintf("%x", s.traceID))})
+	}
+	for _, with := range h.with {
+		handler = with(handler)
+	}
+	return handler.Handle(ctx, redactRecord(r))
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	attrs = redactAttrs(attrs)
+	return h.adding(func(handler slog.Handler) slog.Handler { return handler.WithAttrs(attrs) })
+}
+
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.adding(func(handler slog.Handler) slog.Handler { return handler.WithGroup(name) })
+}
+
+// adding returns a copy of the handler adding attributes or a group
+func (h *componentHandler) adding(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &componentHandler{component: h.component, with: append(append([]func(slog.Handler) slog.Handler{}, h.with...), with)}
+}
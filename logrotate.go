@@ -0,0 +1,171 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LogRotation is the rotation section of logging-config.json: server.log
+// is moved aside once it reaches a size or an age, keeping the newest
+// rotated files
+type LogRotation struct {
+	MaxSizeMB  int   `json:"maxSizeMB,omitempty"`  // default 100; negative never by size
+	MaxAgeDays int   `json:"maxAgeDays,omitempty"` // 0 never by age
+	Keep       int   `json:"keep,omitempty"`       // rotated files kept, default 10
+	Compress   *bool `json:"compress,omitempty"`   // gzip rotated files, default true
+}
+
+// rotatingFile is a log file that rotates itself as it is written
+type rotatingFile struct {
+	sync.Mutex
+	path     string
+	rotation LogRotation
+	file     *os.File
+	size     int64
+	started  time.Time // when the current file was begun
+}
+
+// openRotatingFile opens a log file for appending, rotating by the config
+func openRotatingFile(path string, rotation LogRotation) (*rotatingFile, error) {
+	if rotation.MaxSizeMB == 0 {
+		rotation.MaxSizeMB = 100
+	}
+	if rotation.Keep <= 0 {
+		rotation.Keep = 10
+	}
+	f := &rotatingFile{path: path, rotation: rotation}
+	return f, f.open()
+}
+
+// open opens the current file, which began when it was last written if it
+// has content already
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.started = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.started = info.ModTime()
+	}
+	return nil
+}
+
+// due reports whether the file must rotate before n more bytes
+func (f *rotatingFile) due(n int) bool {
+	maxSize := int64(f.rotation.MaxSizeMB) << 20
+	if f.rotation.MaxSizeMB > 0 && f.size > 0 && f.size+int64(n) > maxSize {
+		return true
+	}
+	return f.rotation.MaxAgeDays > 0 && time.Since(f.started) >= time.Duration(f.rotation.MaxAgeDays)*24*time.Hour
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the current file rather than losing lines
+			fmt.Fprintf(os.Stderr, "Log rotation failed: %v\n", err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside, e.g. to server.log.20260102-150405,
+// and starts a new one; compressing and pruning the rotated files happens
+// in the background
+func (f *rotatingFile) rotate() error {
+	rotated := f.path + "." + time.Now().Format("20060102-150405")
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", f.path, time.Now().Format("20060102-150405"), i)
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, rotated); err != nil {
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	go func() {
+		if f.rotation.Compress == nil || *f.rotation.Compress {
+			if err := gzipFile(rotated); err != nil {
+				logServer.Error("Compressing a rotated log failed", "file", rotated, "err", err)
+			}
+		}
+		f.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated files beyond those kept
+func (f *rotatingFile) prune() {
+	names, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return
+	}
+	// Timestamps sort by name, compressed or not
+	sort.Slice(names, func(i, j int) bool {
+		return strings.TrimSuffix(names[i], ".gz") > strings.TrimSuffix(names[j], ".gz")
+	})
+	for i := f.rotation.Keep; i < len(names); i++ {
+		if err := os.Remove(names[i]); err != nil {
+			logServer.Error("Removing an old log failed", "file", names[i], "err", err)
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.file.Close()
+}
+
+// gzipFile compresses a file to name.gz, removing the original
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
+
+// fileExists reports whether a file exists
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
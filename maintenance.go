@@ -0,0 +1,385 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaintenanceConfig is maintenance-config.json, kept on disk next to
+// jira-config.json since it holds an API key. Releases in one of Statuses
+// get a maintenance window on the configured provider so alerting is
+// suppressed while they deploy.
+type MaintenanceConfig struct {
+	Provider string              `json:"provider"` // "opsgenie" or "pagerduty"
+	APIKey   string              `json:"apiKey"`
+	APIURL   string              `json:"apiUrl,omitempty"`
+	From     string              `json:"from,omitempty"` // PagerDuty requester email
+	Statuses []string            `json:"statuses,omitempty"`
+	Services map[string][]string `json:"services"` // environment -> service/integration IDs
+}
+
+// defaultMaintenanceStatuses are the statuses of a release that is going ahead
+var defaultMaintenanceStatuses = []string{"Planned", "Hotfix Planned"}
+
+// MaintenanceWindow is a window the server created for a release
+type MaintenanceWindow struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+}
+
+// MaintenanceState is maintenance-windows.json, keyed by release ID
+type MaintenanceState struct {
+	Windows map[string]MaintenanceWindow `json:"windows"`
+}
+
+// maintenanceMu serializes syncs so windows are never created twice
+var maintenanceMu sync.Mutex
+
+// loadMaintenanceConfig reads maintenance-config.json; ok is false when the
+// sync isn't configured
+func loadMaintenanceConfig() (cfg MaintenanceConfig, ok bool, err error) {
+	if err := readDataFile("maintenance-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.Provider == "" || cfg.APIKey == "" {
+		return cfg, false, nil
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = defaultMaintenanceStatuses
+	}
+	return cfg, true, nil
+}
+
+// loadMaintenanceState reads maintenance-windows.json
+func loadMaintenanceState() (MaintenanceState, error) {
+	state := MaintenanceState{Windows: map[string]MaintenanceWindow{}}
+	err := readDataFile("maintenance-windows.json", &state)
+	if state.Windows == nil {
+		state.Windows = map[string]MaintenanceWindow{}
+	}
+	return state, err
+}
+
+// save writes maintenance-windows.json. It is server-maintained, so it skips
+// the backups and concurrency checks of client-edited files.
+func (s MaintenanceState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "maintenance-windows.json"), data, 0644)
+}
+
+// maintenanceProvider creates and removes windows on an alerting service
+type maintenanceProvider interface {
+	create(release string, start, end time.Time, services []string) (string, error)
+	remove(id string) error
+}
+
+// newMaintenanceProvider returns the client for the configured provider
+func newMaintenanceProvider(cfg MaintenanceConfig) (maintenanceProvider, error) {
+	switch cfg.Provider {
+	case "opsgenie":
+		url := cfg.APIURL
+		if url == "" {
+			url = "https://api.opsgenie.com"
+		}
+		return &opsgenieClient{baseURL: url, apiKey: cfg.APIKey}, nil
+	case "pagerduty":
+		url := cfg.APIURL
+		if url == "" {
+			url = "https://api.pagerduty.com"
+		}
+		return &pagerDutyClient{baseURL: url, apiKey: cfg.APIKey, from: cfg.From}, nil
+	}
+	return nil, fmt.Errorf("unknown maintenance provider %q", cfg.Provider)
+}
+
+// maintenanceHTTPClient is shared by the provider clients
+var maintenanceHTTPClient = &http.Client{Timeout: 15 * time.Second}
+
+// doJSON sends a request with an optional JSON body and decodes the response into out
+func doJSON(req *http.Request, body, out interface{}) error {
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := maintenanceHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(msg))
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// opsgenieClient uses the Opsgenie maintenance API
+type opsgenieClient struct {
+	baseURL string
+	apiKey  string
+}
+
+func (c *opsgenieClient) request(method, path string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "GenieKey "+c.apiKey)
+	return req, nil
+}
+
+func (c *opsgenieClient) create(release string, start, end time.Time, services []string) (string, error) {
+	rules := make([]map[string]interface{}, len(services))
+	for i, id := range services {
+		rules[i] = map[string]interface{}{
+			"state":  "disabled",
+			"entity": map[string]string{"id": id, "type": "integration"},
+		}
+	}
+	body := map[string]interface{}{
+		"description": "Release " + release,
+		"time": map[string]string{
+			"type":      "schedule",
+			"startDate": start.UTC().Format(time.RFC3339),
+			"endDate":   end.UTC().Format(time.RFC3339),
+		},
+		"rules": rules,
+	}
+	req, err := c.request(http.MethodPost, "/v1/maintenance")
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := doJSON(req, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.Data.ID, nil
+}
+
+func (c *opsgenieClient) remove(id string) error {
+	req, err := c.request(http.MethodDelete, "/v1/maintenance/"+id)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, nil, nil)
+}
+
+// pagerDutyClient uses the PagerDuty REST API v2
+type pagerDutyClient struct {
+	baseURL string
+	apiKey  string
+	from    string
+}
+
+func (c *pagerDutyClient) request(method, path string) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token token="+c.apiKey)
+	req.Header.Set("Accept", "application/vnd.pagerduty+json;version=2")
+	if c.from != "" {
+		req.Header.Set("From", c.from)
+	}
+	return req, nil
+}
+
+func (c *pagerDutyClient) create(release string, start, end time.Time, services []string) (string, error) {
+	refs := make([]map[string]string, len(services))
+	for i, id := range services {
+		refs[i] = map[string]string{"id": id, "type": "service_reference"}
+	}
+	body := map[string]interface{}{
+		"maintenance_window": map[string]interface{}{
+			"type":        "maintenance_window",
+			"description": "Release " + release,
+			"start_time":  start.Format(time.RFC3339),
+			"end_time":    end.Format(time.RFC3339),
+			"services":    refs,
+		},
+	}
+	req, err := c.request(http.MethodPost, "/maintenance_windows")
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		MaintenanceWindow struct {
+			ID string `json:"id"`
+		} `json:"maintenance_window"`
+	}
+	if err := doJSON(req, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.MaintenanceWindow.ID, nil
+}
+
+func (c *pagerDutyClient) remove(id string) error {
+	req, err := c.request(http.MethodDelete, "/maintenance_windows/"+id)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, nil, nil)
+}
+
+// syncMaintenanceWindows creates windows for upcoming releases in one of the
+// configured statuses and removes the windows of releases that were
+// cancelled, moved or deleted
+func syncMaintenanceWindows() error {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+
+	cfg, ok, err := loadMaintenanceConfig()
+	if err != nil || !ok {
+		return err
+	}
+	provider, err := newMaintenanceProvider(cfg)
+	if err != nil {
+		return err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	state, err := loadMaintenanceState()
+	if err != nil {
+		return err
+	}
+
+	statuses := map[string]bool{}
+	for _, s := range cfg.Statuses {
+		statuses[s] = true
+	}
+	now := time.Now()
+
+	// The windows the current plan needs
+	wanted := map[string]MaintenanceWindow{}
+	for env, entries := range releases {
+		if len(cfg.Services[env]) == 0 {
+			continue
+		}
+		for _, e := range entries {
+			if !statuses[e.Status] {
+				continue
+			}
+			start, end, err := e.window()
+			if err != nil || !end.After(now) {
+				continue
+			}
+			wanted[releaseID(env, e.Date)] = MaintenanceWindow{
+				Provider: cfg.Provider,
+				Start:    start.Format(time.RFC3339),
+				End:      end.Format(time.RFC3339),
+			}
+		}
+	}
+
+	var errs []error
+	ids := make([]string, 0, len(state.Windows))
+	for id := range state.Windows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		existing := state.Windows[id]
+		want, keep := wanted[id]
+		if keep && want.Provider == existing.Provider && want.Start == existing.Start && want.End == existing.End {
+			delete(wanted, id)
+			continue
+		}
+		// Windows that are already over expire on their own
+		if end, err := time.Parse(time.RFC3339, existing.End); err != nil || end.After(now) {
+			if existing.Provider == cfg.Provider {
+				if err := provider.remove(existing.ID); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+					continue
+				}
+			}
+		}
+		logMaintenance.Info("Removed maintenance window", "window", existing.ID, "release", id)
+		delete(state.Windows, id)
+	}
+
+	for id, want := range wanted {
+		env, _, _ := parseReleaseID(id)
+		start, _ := time.Parse(time.RFC3339, want.Start)
+		end, _ := time.Parse(time.RFC3339, want.End)
+		windowID, err := provider.create(id, start, end, cfg.Services[env])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		want.ID = windowID
+		state.Windows[id] = want
+		logMaintenance.Info("Created maintenance window", "window", windowID, "release", id)
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("maintenance sync: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// syncMaintenanceOnChange is the data change hook that keeps windows in step
+// with releases.json. It runs in the background so saves don't wait on the provider.
+func syncMaintenanceOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := syncMaintenanceWindows(); err != nil {
+			logMaintenance.Error("Maintenance window sync failed", "err", err)
+		}
+	}()
+}
+
+// Handle maintenance windows: GET lists the windows created for releases,
+// POST runs a sync now
+func handleMaintenanceWindows(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := syncMaintenanceWindows(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := loadMaintenanceState()
+	if err != nil {
+		http.Error(w, "Error reading maintenance windows", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// mergeRequest is the body of POST /api/merge/{file}: a client's version of
+// a data file and the ETag of the version it started from
+type mergeRequest struct {
+	Base     string      `json:"base"`
+	Document interface{} `json:"document"`
+}
+
+// mergeConflict is a value both the client and another save changed
+// differently since the base; the merged document keeps the saved value
+type mergeConflict struct {
+	Path   string      `json:"path"` // JSON pointer, with records of arrays by key
+	Base   interface{} `json:"base,omitempty"`
+	Ours   interface{} `json:"ours,omitempty"`   // the client's, absent when it removed it
+	Theirs interface{} `json:"theirs,omitempty"` // saved, absent when removed
+}
+
+// mergeResult is the response of POST /api/merge/{file}
+type mergeResult struct {
+	Merged    interface{}     `json:"merged"`
+	Conflicts []mergeConflict `json:"conflicts"`
+	ETag      string          `json:"etag"` // of the saved version, for If-Match saving the merge
+}
+
+// absentValue stands for a key or record missing from a version
+type absentValue struct{}
+
+var absent = absentValue{}
+
+// recordKeys are the fields identifying records of arrays, by which their
+// versions are merged rather than as whole arrays
+var recordKeys = []string{"id", "date", "name"}
+
+// findVersion returns the content of a data file with an ETag, the saved
+// version or one of its backups
+func findVersion(file, etag string) ([]byte, bool) {
+	if current, err := os.ReadFile(filepath.Join(dataDir, file)); err == nil && computeETag(current) == etag {
+		return current, true
+	}
+	prefix := strings.TrimSuffix(file, ".json") + "."
+	backups, _ := listBackups(prefix)
+	for _, name := range backups {
+		if !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		if content, err := os.ReadFile(filepath.Join(backupDir, name)); err == nil && computeETag(content) == etag {
+			return content, true
+		}
+	}
+	return nil, false
+}
+
+// pointerToken escapes a JSON pointer token
+func pointerToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+// recordKey returns the field identifying the records of arrays, when all
+// their elements are objects with distinct values of one
+func recordKey(arrays ...[]interface{}) string {
+	for _, key := range recordKeys {
+		ok := true
+		for _, a := range arrays {
+			seen := map[string]bool{}
+			for _, v := range a {
+				obj, isObj := v.(map[string]interface{})
+				id, isStr := obj[key].(string)
+				if !isObj || !isStr || seen[id] {
+					ok = false
+					break
+				}
+				seen[id] = true
+			}
+			if !ok {
+				break
+			}
+		}
+		if ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// asArray returns a version as an array; absent is empty
+func asArray(v interface{}) ([]interface{}, bool) {
+	if v == absent {
+		return nil, true
+	}
+	a, ok := v.([]interface{})
+	return a, ok
+}
+
+// asObject returns a version as an object; absent is empty
+func asObject(v interface{}) (map[string]interface{}, bool) {
+	if v == absent {
+		return nil, true
+	}
+	m, ok := v.(map[string]interface{})
+	return m, ok
+}
+
+// merge3 merges the changes from base of ours and theirs at a path. Objects
+// merge by key and arrays of records by their key; values changed on both
+// sides differently are conflicts, resolved to theirs.
+func merge3(path string, base, ours, theirs interface{}, conflicts *[]mergeConflict) interface{} {
+	switch {
+	case reflect.DeepEqual(ours, theirs):
+		return theirs
+	case reflect.DeepEqual(base, ours):
+		return theirs
+	case reflect.DeepEqual(base, theirs):
+		return ours
+	}
+
+	// Objects, or one added on both sides
+	if o, ok := asObject(ours); ok && o != nil {
+		if t, ok := asObject(theirs); ok && t != nil {
+			b, _ := asObject(base)
+			merged := map[string]interface{}{}
+			for _, key := range unionKeys(b, o, t) {
+				if v := merge3(path+"/"+pointerToken(key), valueOf(b, key), valueOf(o, key), valueOf(t, key), conflicts); v != absent {
+					merged[key] = v
+				}
+			}
+			return merged
+		}
+	}
+
+	// Arrays of records, keeping the saved order and the client's additions
+	if o, ok := asArray(ours); ok && o != nil {
+		if t, ok := asArray(theirs); ok && t != nil {
+			b, _ := asArray(base)
+			if key := recordKey(b, o, t); key != "" {
+				bm, om, tm := recordsBy(key, b), recordsBy(key, o), recordsBy(key, t)
+				merged := []interface{}{}
+				for _, id := range recordOrder(key, t, o) {
+					if v := merge3(path+"/"+pointerToken(id), valueOf(bm, id), valueOf(om, id), valueOf(tm, id), conflicts); v != absent {
+						merged = append(merged, v)
+					}
+				}
+				return merged
+			}
+		}
+	}
+
+	conflict := mergeConflict{Path: path}
+	if base != absent {
+		conflict.Base = base
+	}
+	if ours != absent {
+		conflict.Ours = ours
+	}
+	if theirs != absent {
+		conflict.Theirs = theirs
+	}
+	if conflict.Path == "" {
+		conflict.Path = "/"
+	}
+	*conflicts = append(*conflicts, conflict)
+	return theirs
+}
+
+// valueOf returns a key of an object, absent when missing
+func valueOf(m map[string]interface{}, key string) interface{} {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return absent
+}
+
+// unionKeys lists the keys of objects, in the order first seen
+func unionKeys(maps ...map[string]interface{}) []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, m := range maps {
+		sorted := make([]string, 0, len(m))
+		for k := range m {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// recordsBy indexes records by their key
+func recordsBy(key string, records []interface{}) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, r := range records {
+		m[r.(map[string]interface{})[key].(string)] = r
+	}
+	return m
+}
+
+// recordOrder lists the keys of records of arrays, in the order first seen
+func recordOrder(key string, arrays ...[]interface{}) []string {
+	var ids []string
+	seen := map[string]bool{}
+	for _, a := range arrays {
+		for _, r := range a {
+			id := r.(map[string]interface{})[key].(string)
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// Handle merging a save that failed its If-Match check: the client's
+// document is merged three ways with the saved version and the version its
+// base ETag names, the saved one or a backup. Changes only one side made
+// are kept; conflicts keep the saved value and are listed for the client
+// to resolve before saving the merge with If-Match of the returned ETag.
+func handleMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	file := r.PathValue("file")
+	if !sharedFile(file) {
+		http.Error(w, "Unknown data file", http.StatusNotFound)
+		return
+	}
+	var req mergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Document == nil {
+		http.Error(w, "Invalid JSON, expected base and document", http.StatusBadRequest)
+		return
+	}
+	if req.Base == "" {
+		http.Error(w, "Missing 'base' ETag", http.StatusBadRequest)
+		return
+	}
+	if !strings.HasPrefix(req.Base, `"`) {
+		req.Base = `"` + req.Base + `"`
+	}
+
+	current, err := os.ReadFile(filepath.Join(dataDir, file))
+	if err != nil {
+		http.Error(w, "Data file not found", http.StatusNotFound)
+		return
+	}
+	baseContent, ok := findVersion(file, req.Base)
+	if !ok {
+		http.Error(w, "The base version is no longer kept, reload and edit again", http.StatusConflict)
+		return
+	}
+	var base, theirs interface{}
+	if err := json.Unmarshal(baseContent, &base); err != nil {
+		http.Error(w, fmt.Sprintf("Error reading the base version: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := json.Unmarshal(current, &theirs); err != nil {
+		http.Error(w, fmt.Sprintf("Error reading %s: %v", file, err), http.StatusInternalServerError)
+		return
+	}
+
+	result := mergeResult{Conflicts: []mergeConflict{}, ETag: computeETag(current)}
+	result.Merged = merge3("", base, req.Document, theirs, &result.Conflicts)
+	w.Header().Set("ETag", result.ETag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
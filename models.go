@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Date layout used by every date field in the data files
+const dateLayout = "2006-01-02"
+
+// Layout of the endDateTime field of a release
+const dateTimeLayout = "2006-01-02T15:04"
+
+// ReleaseEntry mirrors a single release in releases.json
+type ReleaseEntry struct {
+	Date        string   `json:"date"`
+	Status      string   `json:"status"`
+	FeTag       string   `json:"feTag,omitempty"`
+	BeTag       string   `json:"beTag,omitempty"`
+	ReleaseName string   `json:"releaseName,omitempty"`
+	JiraTicket  string   `json:"jiraTicket,omitempty"`
+	StartTime   string   `json:"startTime,omitempty"`
+	EndDateTime string   `json:"endDateTime,omitempty"`
+	Note        string   `json:"note,omitempty"`
+	DependsOn   string   `json:"dependsOn,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Risk        string   `json:"risk,omitempty"`    // critical, high, medium or low
+	Tickets     []string `json:"tickets,omitempty"` // linked tickets, see handleReleaseTickets
+
+	// Checklist of steps before the release can go ahead
+	Checklist []ChecklistItem `json:"checklist,omitempty"`
+
+	// JenkinsJob is the job deploying the release, a path like "folder/job";
+	// the environment's job in jenkins-config.json when unset
+	JenkinsJob string `json:"jenkinsJob,omitempty"`
+
+	// GitLab project and ref whose pipeline deploys the release; the
+	// environment's project and the configured ref when unset
+	GitLabProject string `json:"gitlabProject,omitempty"`
+	GitLabRef     string `json:"gitlabRef,omitempty"`
+
+	// TicketProvider is where the tickets of the release live, the ID of a
+	// registered TicketProvider; "jira" when unset
+	TicketProvider string `json:"ticketProvider,omitempty"`
+
+	// People assigned from the team roster
+	ReleaseManager string   `json:"releaseManager,omitempty"`
+	Deployers      []string `json:"deployers,omitempty"`
+
+	// Maintained by the server, see trackReleaseHistory
+	OriginalDate    string              `json:"originalDate,omitempty"`
+	Reschedules     []ReleaseReschedule `json:"reschedules,omitempty"`
+	CompletedAt     string              `json:"completedAt,omitempty"`
+	JiraIssue       string              `json:"jiraIssue,omitempty"`       // see syncJiraIssues
+	JiraVersion     string              `json:"jiraVersion,omitempty"`     // fixVersion ID, see syncFixVersions
+	GitHubMilestone string              `json:"githubMilestone,omitempty"` // milestone number, see syncMilestones
+	GitHubRelease   string              `json:"githubRelease,omitempty"`   // release ID, see syncGitHubReleases
+	ChangeRequest   string              `json:"changeRequest,omitempty"`   // ServiceNow CHG number, see syncChangeRequests
+	ChangeApproval  string              `json:"changeApproval,omitempty"`
+	ChangeState     string              `json:"changeState,omitempty"`
+	Deployment      *ReleaseDeployment  `json:"deployment,omitempty"`    // last triggered, see handleReleaseDeploy
+	Outcome         *ReleaseOutcome     `json:"outcome,omitempty"`       // see handleReleaseOutcome
+	Retrospective   *Retrospective      `json:"retrospective,omitempty"` // see handleReleaseRetrospective
+	Incidents       []ReleaseIncident   `json:"incidents,omitempty"`     // see handleReleaseIncidents
+	ModifiedBy      string              `json:"modifiedBy,omitempty"`    // who last changed it, see writeJSONFile
+	ModifiedAt      string              `json:"modifiedAt,omitempty"`
+}
+
+// ReleaseDeployment is a CI build deploying a release
+type ReleaseDeployment struct {
+	Provider    string `json:"provider"`      // a registered Deployer: jenkins, github or gitlab
+	Job         string `json:"job"`           // Jenkins job, workflow file or GitLab project
+	Ref         string `json:"ref,omitempty"` // branch or tag of a workflow or pipeline
+	ID          string `json:"id,omitempty"`  // workflow run or pipeline ID
+	Version     string `json:"version,omitempty"`
+	Status      string `json:"status"`           // queued, running, finished or error
+	Result      string `json:"result,omitempty"` // as reported by the CI, e.g. SUCCESS or FAILURE
+	URL         string `json:"url,omitempty"`    // the build, once started
+	QueueURL    string `json:"queueUrl,omitempty"`
+	Error       string `json:"error,omitempty"`
+	TriggeredBy string `json:"triggeredBy,omitempty"`
+	TriggeredAt string `json:"triggeredAt"`
+	FinishedAt  string `json:"finishedAt,omitempty"`
+}
+
+// ReleaseOutcome records how a release actually went
+type ReleaseOutcome struct {
+	StartedAt  string `json:"startedAt,omitempty"` // RFC 3339
+	FinishedAt string `json:"finishedAt,omitempty"`
+	Result     string `json:"result"` // success, partial or rolled-back
+	LogsURL    string `json:"logsUrl,omitempty"`
+	Notes      string `json:"notes,omitempty"`
+	RecordedBy string `json:"recordedBy,omitempty"`
+	RecordedAt string `json:"recordedAt"`
+}
+
+// Retrospective is the post-release review of a completed release
+type Retrospective struct {
+	URL         string                    `json:"url,omitempty"` // the retrospective document
+	Findings    []RetrospectiveFinding    `json:"findings,omitempty"`
+	ActionItems []RetrospectiveActionItem `json:"actionItems,omitempty"`
+	RecordedBy  string                    `json:"recordedBy,omitempty"`
+	RecordedAt  string                    `json:"recordedAt"`
+}
+
+// RetrospectiveFinding is something that went wrong; findings of the same
+// category across releases are reported as recurring
+type RetrospectiveFinding struct {
+	Category string `json:"category,omitempty"` // e.g. database, config, testing
+	Text     string `json:"text"`
+}
+
+// RetrospectiveActionItem is a follow-up agreed in a retrospective
+type RetrospectiveActionItem struct {
+	Text   string `json:"text"`
+	Owner  string `json:"owner,omitempty"`
+	Ticket string `json:"ticket,omitempty"`
+	Done   bool   `json:"done,omitempty"`
+}
+
+// ReleaseIncident is an incident the release is suspected of causing
+type ReleaseIncident struct {
+	ID       string `json:"id"` // e.g. INC0012345 or a PagerDuty incident number
+	URL      string `json:"url,omitempty"`
+	Severity string `json:"severity"` // as the incident tool has it, e.g. sev1 or critical
+	Title    string `json:"title,omitempty"`
+	LinkedBy string `json:"linkedBy,omitempty"`
+	LinkedAt string `json:"linkedAt"`
+}
+
+// linkedTickets returns the Jira keys of the free-text jiraTicket field and
+// the linked tickets, without duplicates
+func (e ReleaseEntry) linkedTickets() []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, k := range append(ticketKeys(e.JiraTicket), e.Tickets...) {
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// assignees returns everyone assigned to the release
+func (e ReleaseEntry) assignees() []string {
+	var people []string
+	if e.ReleaseManager != "" {
+		people = append(people, e.ReleaseManager)
+	}
+	return append(people, e.Deployers...)
+}
+
+// ChecklistItem is a step of a release's checklist
+type ChecklistItem struct {
+	Text string `json:"text"`
+	Done bool   `json:"done,omitempty"`
+}
+
+// openItems returns the checklist items that aren't done
+func (e ReleaseEntry) openItems() []string {
+	var items []string
+	for _, item := range e.Checklist {
+		if !item.Done {
+			items = append(items, item.Text)
+		}
+	}
+	return items
+}
+
+// ReleaseReschedule records a release being moved to another date
+type ReleaseReschedule struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	At   string `json:"at"`
+}
+
+// ReleasesData is releases.json: release entries keyed by environment
+type ReleasesData map[string][]ReleaseEntry
+
+// Holiday mirrors a single entry in holidays.json
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+	// Names are its name in other languages, by language tag such as "de"
+	// or "fr-ch", shown to planners who prefer them
+	Names map[string]string `json:"names,omitempty"`
+}
+
+// HolidaysData is holidays.json
+type HolidaysData struct {
+	Holidays []Holiday `json:"holidays"`
+}
+
+// Environment mirrors a single entry of the environments array
+type Environment struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+	Visible     bool   `json:"visible"`
+
+	// Optional metadata shown on the calendar and in notifications
+	Owner       string `json:"owner,omitempty"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Tier        string `json:"tier,omitempty"`
+	Color       string `json:"color,omitempty"`
+
+	// Set while the environment is locked or under maintenance
+	Lock *EnvironmentLock `json:"lock,omitempty"`
+}
+
+// EnvironmentLock blocks scheduling new releases on an environment
+type EnvironmentLock struct {
+	Reason      string `json:"reason"`
+	Maintenance bool   `json:"maintenance,omitempty"`
+	LockedAt    string `json:"lockedAt"`
+	Until       string `json:"until,omitempty"` // RFC 3339; empty means until unlocked
+}
+
+// active reports whether the lock is still in force at t
+func (l *EnvironmentLock) active(t time.Time) bool {
+	if l == nil {
+		return false
+	}
+	if l.Until == "" {
+		return true
+	}
+	until, err := time.Parse(time.RFC3339, l.Until)
+	return err != nil || t.Before(until)
+}
+
+// Criticality tiers an environment may declare
+var environmentTiers = map[string]bool{"critical": true, "high": true, "medium": true, "low": true}
+
+// ColorConfig is a background/foreground pair used for environments and statuses
+type ColorConfig struct {
+	Background string `json:"background"`
+	Foreground string `json:"foreground"`
+}
+
+// EnvironmentsData is environments.json
+type EnvironmentsData struct {
+	Config              map[string]interface{} `json:"config"`
+	ReleaseEnvironments map[string]ColorConfig `json:"releaseEnvironments"`
+	ReleaseStatuses     map[string]ColorConfig `json:"releaseStatuses"`
+	Environments        []Environment          `json:"environments"`
+	Groups              []EnvironmentGroup     `json:"groups,omitempty"`
+	Pipeline            []PipelineStage        `json:"pipeline,omitempty"`
+}
+
+// PipelineStage is one step of the promotion pipeline; LeadDays is the
+// default gap after the previous stage's release
+type PipelineStage struct {
+	Environment string `json:"environment"`
+	LeadDays    int    `json:"leadDays,omitempty"`
+}
+
+// EnvironmentGroup bundles environments (and child groups via Parent) so
+// freezes and capacity rules can be declared once for a whole platform
+type EnvironmentGroup struct {
+	Name         string         `json:"name"`
+	DisplayName  string         `json:"displayName,omitempty"`
+	Parent       string         `json:"parent,omitempty"`
+	Environments []string       `json:"environments"`
+	Freezes      []FreezePeriod `json:"freezes,omitempty"`
+	Capacity     *GroupCapacity `json:"capacity,omitempty"`
+}
+
+// FreezePeriod blocks new releases between two dates (inclusive)
+type FreezePeriod struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// GroupCapacity limits how many releases the environments of a group may
+// take; zero means unlimited
+type GroupCapacity struct {
+	MaxPerDay  int `json:"maxPerDay,omitempty"`
+	MaxPerWeek int `json:"maxPerWeek,omitempty"`
+}
+
+// releaseID builds the identifier of a release, using the same
+// "environment:date" form the frontend uses for dependsOn references
+func releaseID(env, date string) string {
+	return env + ":" + date
+}
+
+// parseReleaseID splits a release identifier into environment and date
+func parseReleaseID(id string) (env, date string, ok bool) {
+	i := strings.LastIndex(id, ":")
+	if i <= 0 || i == len(id)-1 {
+		return "", "", false
+	}
+	return id[:i], id[i+1:], true
+}
+
+// readDataFile decodes a JSON file from the data directory into v.
+// A missing file leaves v untouched and is not an error.
+func readDataFile(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(dataDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeInto converts a generically decoded JSON value into a typed one
+func decodeInto(v interface{}, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+// loadReleasesDocument reads releases.json generically, keeping fields the
+// typed model doesn't know about, for server-side edits. It also returns the
+// ETag of the content for the If-Match check on save.
+func loadReleasesDocument() (map[string]interface{}, string, error) {
+	doc := map[string]interface{}{}
+	data, err := os.ReadFile(filepath.Join(dataDir, "releases.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return doc, "", nil
+		}
+		return nil, "", err
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, "", fmt.Errorf("releases.json: %w", err)
+	}
+	return doc, computeETag(data), nil
+}
+
+// loadReleases reads releases.json
+func loadReleases() (ReleasesData, error) {
+	releases := ReleasesData{}
+	if err := readDataFile("releases.json", &releases); err != nil {
+		return nil, err
+	}
+	return releases, nil
+}
+
+// loadHolidays reads holidays.json
+func loadHolidays() (HolidaysData, error) {
+	var holidays HolidaysData
+	err := readDataFile("holidays.json", &holidays)
+	return holidays, err
+}
+
+// loadEnvironments reads environments.json
+func loadEnvironments() (EnvironmentsData, error) {
+	var envs EnvironmentsData
+	err := readDataFile("environments.json", &envs)
+	return envs, err
+}
+
+// sortedEnvironmentNames returns the environment keys of releases in a stable order
+func (rd ReleasesData) sortedEnvironmentNames() []string {
+	names := make([]string, 0, len(rd))
+	for name := range rd {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// window returns the start and end of a release. Without a start time the
+// release begins at midnight; without an end it lasts until the end of its day.
+func (e ReleaseEntry) window() (start, end time.Time, err error) {
+	start, err = time.ParseInLocation(dateLayout, e.Date, time.Local)
+	if err != nil {
+		return start, end, err
+	}
+	if e.StartTime != "" {
+		if t, err := time.ParseInLocation("15:04", e.StartTime, time.Local); err == nil {
+			start = start.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+		}
+	}
+	end = time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.Local)
+	if e.EndDateTime != "" {
+		if t, err := time.ParseInLocation(dateTimeLayout, e.EndDateTime, time.Local); err == nil && t.After(start) {
+			end = t
+		}
+	}
+	return start, end, nil
+}
+
+// windowLabel describes the deployment window for messages: "10:00-12:00",
+// "from 10:00" without an end, or "" without a start time
+func (e ReleaseEntry) windowLabel() string {
+	start, end, err := e.window()
+	if err != nil || e.StartTime == "" {
+		return ""
+	}
+	if e.EndDateTime == "" {
+		return "from " + start.Format("15:04")
+	}
+	if end.Format(dateLayout) != e.Date {
+		return start.Format("15:04") + "-" + end.Format("2 Jan 15:04")
+	}
+	return start.Format("15:04") + "-" + end.Format("15:04")
+}
+
+// today returns the current date truncated to midnight local time
+func today() time.Time {
+	y, m, d := time.Now().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+// inDateRange reports whether an ISO date lies within [from, to]
+func inDateRange(date string, from, to time.Time) bool {
+	t, err := time.ParseInLocation(dateLayout, date, time.Local)
+	if err != nil {
+		return false
+	}
+	return !t.Before(from) && !t.After(to)
+}
+
+// parseDateParam reads an ISO date query parameter, falling back to def when
+// it is absent. The boolean is false when the value is malformed.
+func parseDateParam(r *http.Request, name string, def time.Time) (time.Time, bool) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, true
+	}
+	t, err := time.ParseInLocation(dateLayout, v, time.Local)
+	if err != nil {
+		return def, false
+	}
+	return t, true
+}
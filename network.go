@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkConfig is network-config.json: the networks allowed to use the
+// server and to change its data, and the proxies trusted to say who their
+// clients are. Entries are CIDR ranges or single addresses.
+type NetworkConfig struct {
+	// Allowed may use the server at all; anyone when empty
+	Allowed []string `json:"allowed,omitempty"`
+	// Writes may change data through the API; anyone allowed when empty
+	Writes []string `json:"writes,omitempty"`
+	// WriteExempt are API paths, by prefix, anyone allowed may write to,
+	// such as webhooks of hosted services
+	WriteExempt []string `json:"writeExempt,omitempty"`
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For and
+	// X-Real-IP are believed; the local host when empty, as in nginx-config
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+}
+
+// networks is network-config.json, parsed
+type networks struct {
+	allowed, writes, proxies []*net.IPNet
+	writeExempt              []string
+}
+
+// networksCache holds network-config.json, reread every minute
+var networksCache struct {
+	sync.Mutex
+	networks networks
+	loaded   time.Time
+}
+
+// parseNetworks parses CIDR ranges and addresses
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q", entry)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// loadNetworks returns network-config.json. An invalid config is logged and
+// the previous one kept, as dropping the restrictions would open the server.
+func loadNetworks() networks {
+	networksCache.Lock()
+	defer networksCache.Unlock()
+	if time.Since(networksCache.loaded) < time.Minute {
+		return networksCache.networks
+	}
+	networksCache.loaded = time.Now()
+	var cfg NetworkConfig
+	err := readDataFile("network-config.json", &cfg)
+	var n networks
+	if err == nil {
+		n.allowed, err = parseNetworks(cfg.Allowed)
+	}
+	if err == nil {
+		n.writes, err = parseNetworks(cfg.Writes)
+	}
+	if err == nil {
+		n.proxies, err = parseNetworks(cfg.TrustedProxies)
+	}
+	if err != nil {
+		logServer.Error("Error reading network-config.json", "err", err)
+		return networksCache.networks
+	}
+	n.writeExempt = cfg.WriteExempt
+	networksCache.networks = n
+	return n
+}
+
+// contains reports whether an address is in one of the networks
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// trustedProxy reports whether the server believes what a peer says of its
+// clients
+func (n networks) trustedProxy(ip net.IP) bool {
+	if len(n.proxies) == 0 {
+		return ip.IsLoopback()
+	}
+	return contains(n.proxies, ip)
+}
+
+// clientIP returns the address of the client. Behind trusted proxies it is
+// the last address of X-Forwarded-For that isn't one, as earlier ones are
+// whatever the client sent, or else X-Real-IP. A workspace server's peer on
+// its Unix socket is the server that started it, a trusted proxy.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !fromTrustedProxy(r) {
+		return host
+	}
+	n := loadNetworks()
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if host = ip.String(); !n.trustedProxy(ip) {
+				return host
+			}
+		}
+		return host
+	}
+	if real := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); real != nil {
+		return real.String()
+	}
+	return host
+}
+
+// fromTrustedProxy reports whether a request's peer is a trusted proxy, whose
+// forwarding headers are believed
+func fromTrustedProxy(r *http.Request) bool {
+	if unixPeer(r) {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && loadNetworks().trustedProxy(ip)
+}
+
+// unixPeer reports whether a request came in on a Unix socket
+func unixPeer(r *http.Request) bool {
+	_, ok := r.Context().Value(http.LocalAddrContextKey).(*net.UnixAddr)
+	return ok
+}
+
+// restrictNetworks turns away clients outside the allowed networks, and
+// writes to the API or over WebDAV from outside the networks allowed to
+// change data
+func restrictNetworks(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := loadNetworks()
+		if len(n.allowed) == 0 && len(n.writes) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := clientIP(r)
+		write := writeRequest(r) && strings.HasPrefix(r.URL.Path, "/api/") ||
+			davWriteMethods[r.Method] && strings.HasPrefix(r.URL.Path, "/dav/")
+		if msg := n.refusal(client, r.URL.Path, write); msg != "" {
+			logHTTP.WarnContext(r.Context(), "Refused a request by the network restrictions", "method", r.Method, "path", r.URL.Path,
+				"remote", client, "reason", msg)
+			http.Error(w, msg, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// refusal tells why a client is turned away, empty when it isn't: it is
+// outside the allowed networks, or makes a write from outside the networks
+// allowed to change data to a path that isn't exempt
+func (n networks) refusal(client, path string, write bool) string {
+	ip := net.ParseIP(client)
+	if len(n.allowed) > 0 && (ip == nil || !contains(n.allowed, ip)) {
+		return "Forbidden from your network"
+	}
+	if write && len(n.writes) > 0 && (ip == nil || !contains(n.writes, ip)) {
+		for _, prefix := range n.writeExempt {
+			if strings.HasPrefix(path, prefix) {
+				return ""
+			}
+		}
+		return "Changes are not allowed from your network"
+	}
+	return ""
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Release event types
+const (
+	eventCreated   = "created"
+	eventMoved     = "moved"
+	eventApproved  = "approved"
+	eventCancelled = "cancelled"
+
+	// eventApprovalRequested is a release created in, or set to, a status
+	// that still needs approval, see needsApproval
+	eventApprovalRequested = "approvalRequested"
+
+	// eventReminder is sent ahead of a release, see sendDueReminders
+	eventReminder = "reminder"
+)
+
+// needsApproval reports whether a release in a status is still to be
+// approved: neither approved, done nor None
+func needsApproval(status string) bool {
+	for _, s := range defaultMaintenanceStatuses {
+		if s == status {
+			return false
+		}
+	}
+	return status != "None" && !completedStatuses[status]
+}
+
+// releaseEvent is a change to a release that notifiers report
+type releaseEvent struct {
+	Type            string       `json:"type"`
+	ID              string       `json:"id"`
+	Environment     string       `json:"environment"`
+	EnvironmentName string       `json:"environmentName"` // display name
+	Date            string       `json:"date"`
+	PreviousDate    string       `json:"previousDate,omitempty"` // moved
+	Name            string       `json:"name"`                   // release name, "Release" when unnamed
+	Status          string       `json:"status"`
+	PreviousStatus  string       `json:"previousStatus,omitempty"`
+	Window          string       `json:"window,omitempty"`   // see windowLabel
+	Risk            string       `json:"risk,omitempty"`     // the release's, else the environment tier
+	Reminder        string       `json:"reminder,omitempty"` // how long before the release, e.g. "24 hours"
+	Unapproved      bool         `json:"unapproved,omitempty"`
+	OpenItems       []string     `json:"openItems,omitempty"` // unfinished checklist items
+	Release         ReleaseEntry `json:"release"`
+}
+
+// webhookRouting is the part of a chat notifier's config choosing where
+// events go
+type webhookRouting struct {
+	Webhooks map[string]string   `json:"webhooks"`         // channel name -> incoming webhook URL
+	Routes   map[string][]string `json:"routes,omitempty"` // environment or "*" -> channel names; every channel when empty
+	Events   []string            `json:"events,omitempty"` // default: every event type
+}
+
+// wants reports whether an event type is enabled
+func (c webhookRouting) wants(event releaseEvent) bool {
+	if len(c.Events) == 0 {
+		return true
+	}
+	for _, e := range c.Events {
+		if e == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// channels returns the names of the channels routed for an event's
+// environment; service names the notifier in logs
+func (c webhookRouting) channels(event releaseEvent, service string) []string {
+	var result []string
+	if len(c.Routes) == 0 {
+		for name := range c.Webhooks {
+			result = append(result, name)
+		}
+		sort.Strings(result)
+		return result
+	}
+	names, ok := c.Routes[event.Environment]
+	if !ok {
+		names = c.Routes["*"]
+	}
+	for _, name := range names {
+		if _, ok := c.Webhooks[name]; ok {
+			result = append(result, name)
+		} else {
+			logNotify.Warn("Unknown notification channel", "service", service, "channel", name, "environment", event.Environment)
+		}
+	}
+	return result
+}
+
+// eventMessage is what notification templates are executed with
+type eventMessage struct {
+	releaseEvent
+	URL string
+}
+
+// renderEventTemplate words an event with its configured template, or the
+// notifier's default for the event type
+func renderEventTemplate(templates, defaults map[string]string, event releaseEvent, baseURL string) (string, error) {
+	return renderTemplate(event.Type, templates, defaults, eventMessage{event, baseURL})
+}
+
+// templateFuncs are available to every notification template
+var templateFuncs = template.FuncMap{"join": strings.Join}
+
+// renderTemplate executes the configured template of a kind, or its default,
+// with data; kinds without either render empty
+func renderTemplate(kind string, templates, defaults map[string]string, data interface{}) (string, error) {
+	text, ok := templates[kind]
+	if !ok {
+		text = defaults[kind]
+	}
+	tmpl, err := template.New(kind).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %s: %w", kind, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("template %s: %w", kind, err)
+	}
+	return buf.String(), nil
+}
+
+// releaseEventSubscribers are called for every event, see onReleaseEvent
+var releaseEventSubscribers []func(releaseEvent)
+
+// onReleaseEvent registers a notifier for release events
+func onReleaseEvent(fn func(releaseEvent)) {
+	releaseEventSubscribers = append(releaseEventSubscribers, fn)
+}
+
+// releaseSnapshot is the releases document events were last computed
+// against, since data change hooks only learn which file changed
+var releaseSnapshot struct {
+	sync.Mutex
+	releases ReleasesData
+}
+
+// initReleaseEvents records the releases on disk as the starting point
+func initReleaseEvents() {
+	releases, err := loadReleases()
+	if err != nil {
+		logNotify.Warn("Release notifications disabled until releases.json is readable", "err", err)
+		return
+	}
+	releaseSnapshot.Lock()
+	releaseSnapshot.releases = releases
+	releaseSnapshot.Unlock()
+}
+
+// newReleaseEvent describes an entry of an environment
+func newReleaseEvent(kind, env string, e ReleaseEntry, envs EnvironmentsData) releaseEvent {
+	event := releaseEvent{
+		Type:            kind,
+		ID:              releaseID(env, e.Date),
+		Environment:     env,
+		EnvironmentName: env,
+		Date:            e.Date,
+		Name:            e.ReleaseName,
+		Status:          e.Status,
+		Release:         e,
+	}
+	for _, def := range envs.Environments {
+		if def.Name != env {
+			continue
+		}
+		if def.DisplayName != "" {
+			event.EnvironmentName = def.DisplayName
+		}
+		event.Risk = def.Tier
+	}
+	if event.Name == "" {
+		event.Name = "Release"
+	}
+	if e.Risk != "" {
+		event.Risk = e.Risk
+	}
+	event.Window = e.windowLabel()
+	return event
+}
+
+// releaseEventsBetween compares two versions of releases.json. A release
+// that appeared with a reschedule from a vanished date moved; other new
+// releases were created, vanished ones cancelled, like those set to None.
+func releaseEventsBetween(old, next ReleasesData, envs EnvironmentsData) []releaseEvent {
+	approved := map[string]bool{}
+	for _, s := range defaultMaintenanceStatuses {
+		approved[s] = true
+	}
+	var events []releaseEvent
+	for env := range mergedEnvironmentKeys(old, next) {
+		oldByDate := map[string]ReleaseEntry{}
+		for _, e := range old[env] {
+			oldByDate[e.Date] = e
+		}
+		newByDate := map[string]ReleaseEntry{}
+		for _, e := range next[env] {
+			newByDate[e.Date] = e
+		}
+
+		movedFrom := map[string]bool{}
+		for date, e := range newByDate {
+			before, existed := oldByDate[date]
+			if !existed {
+				n := len(e.Reschedules)
+				if n > 0 && e.Reschedules[n-1].To == date {
+					from := e.Reschedules[n-1].From
+					if prev, ok := oldByDate[from]; ok {
+						if _, still := newByDate[from]; !still {
+							movedFrom[from] = true
+							event := newReleaseEvent(eventMoved, env, e, envs)
+							event.PreviousDate, event.PreviousStatus = from, prev.Status
+							events = append(events, event)
+							before, existed = prev, true
+						}
+					}
+				}
+				if !existed {
+					if e.Status != "None" {
+						events = append(events, newReleaseEvent(eventCreated, env, e, envs))
+					}
+					if needsApproval(e.Status) {
+						events = append(events, newReleaseEvent(eventApprovalRequested, env, e, envs))
+					}
+					continue
+				}
+			}
+			if e.Status == before.Status {
+				continue
+			}
+			var kind string
+			switch {
+			case approved[e.Status] && !approved[before.Status]:
+				kind = eventApproved
+			case e.Status == "None" && !completedStatuses[before.Status]:
+				kind = eventCancelled
+			case needsApproval(e.Status) && !needsApproval(before.Status):
+				kind = eventApprovalRequested
+			default:
+				continue
+			}
+			event := newReleaseEvent(kind, env, e, envs)
+			event.PreviousStatus = before.Status
+			events = append(events, event)
+		}
+		for date, e := range oldByDate {
+			if _, still := newByDate[date]; still || movedFrom[date] || e.Status == "None" || completedStatuses[e.Status] {
+				continue
+			}
+			event := newReleaseEvent(eventCancelled, env, e, envs)
+			event.PreviousStatus = e.Status
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Date != events[j].Date {
+			return events[i].Date < events[j].Date
+		}
+		return events[i].Environment < events[j].Environment
+	})
+	return events
+}
+
+// mergedEnvironmentKeys returns the environments of either document
+func mergedEnvironmentKeys(a, b ReleasesData) map[string]bool {
+	keys := map[string]bool{}
+	for env := range a {
+		keys[env] = true
+	}
+	for env := range b {
+		keys[env] = true
+	}
+	return keys
+}
+
+// releaseEventsOnChange is the data change hook that turns releases.json
+// writes into release events for the subscribed notifiers
+func releaseEventsOnChange(filename string) {
+	if filename != "releases.json" || len(releaseEventSubscribers) == 0 {
+		return
+	}
+	releaseSnapshot.Lock()
+	defer releaseSnapshot.Unlock()
+	next, err := loadReleases()
+	if err != nil {
+		logNotify.Error("Release notifications failed", "err", err)
+		return
+	}
+	old := releaseSnapshot.releases
+	releaseSnapshot.releases = next
+	if old == nil {
+		return
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		logNotify.Error("Release notifications failed", "err", err)
+		return
+	}
+	events := releaseEventsBetween(old, next, envs)
+	if len(events) == 0 {
+		return
+	}
+	go func() {
+		for _, event := range events {
+			for _, fn := range releaseEventSubscribers {
+				fn(event)
+			}
+		}
+	}()
+}
@@ -0,0 +1,773 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// apiParam is a query parameter or request header of an operation
+type apiParam struct {
+	name string
+	typ  string // string, integer, boolean or date; string when empty
+	desc string
+}
+
+// apiOp is an operation of the API as documented in /api/openapi.json
+type apiOp struct {
+	method  string
+	summary string
+	query   []apiParam
+	headers []apiParam
+	body    string // request body: a schema name, object, array or form; none when empty
+	resp    string // response: a schema name, object, array, text or a media type; object when empty
+	admin   bool   // for admins only
+	save    bool   // saves a data file with a backup: If-Match, X-Max-Backups and X-Restore
+	record  bool   // changes a record of a data file: X-Max-Backups, ETag of the saved file
+}
+
+// apiRoute is a documented path with its operations
+type apiRoute struct {
+	path string
+	tag  string
+	ops  []apiOp
+}
+
+// Parameters shared by many operations
+var (
+	fromParam    = apiParam{"from", "date", "Start date, YYYY-MM-DD"}
+	toParam      = apiParam{"to", "date", "End date, YYYY-MM-DD"}
+	envParam     = apiParam{"env", "", "Environment name"}
+	refreshParam = apiParam{"refresh", "boolean", "Bypass the cache"}
+	fileParam    = apiParam{"file", "", "Data file, e.g. releases.json"}
+)
+
+// apiRoutes documents every route registered in main; keep it in step
+// when adding one
+var apiRoutes = []apiRoute{
+	// Data files
+	{"/api/releases.json", "Data files", []apiOp{
+		{method: "GET", summary: "Read the releases of every environment", resp: "ReleasesData"},
+		{method: "POST", summary: "Replace the releases, backing up the previous version", body: "ReleasesData", save: true},
+	}},
+	{"/api/environments.json", "Data files", []apiOp{
+		{method: "GET", summary: "Read the environments, groups and pipeline", resp: "EnvironmentsData"},
+		{method: "POST", summary: "Replace the environments, backing up the previous version", body: "EnvironmentsData", save: true},
+	}},
+	{"/api/holidays.json", "Data files", []apiOp{
+		{method: "GET", summary: "Read the holidays", resp: "HolidaysData"},
+		{method: "POST", summary: "Replace the holidays, backing up the previous version", body: "HolidaysData", save: true},
+	}},
+	{"/api/data", "Data files", []apiOp{
+		{method: "GET", summary: "List the datasets of datasets-config.json", resp: "array"},
+	}},
+	{"/api/data/{name}", "Data files", []apiOp{
+		{method: "GET", summary: "Read a dataset", resp: "object"},
+		{method: "POST", summary: "Replace a dataset after checking its schema, backing up the previous version", body: "object", save: true},
+	}},
+	{"/api/import/bulk", "Data files", []apiOp{
+		{method: "POST", summary: "Import releases and holidays, skipping, overwriting or merging existing records, with a result per record", body: "object",
+			query: []apiParam{{"dryRun", "boolean", "Only report the results"}}, headers: []apiParam{maxBackupsHeader}},
+	}},
+	{"/api/team", "Data files", []apiOp{
+		{method: "GET", summary: "Read the team", resp: "TeamData"},
+		{method: "POST", summary: "Replace the team, backing up the previous version", body: "TeamData", save: true},
+	}},
+	{"/api/absences", "Data files", []apiOp{
+		{method: "GET", summary: "List absences", resp: "AbsencesData", query: []apiParam{{"person", "", "Only this person's absences"}, fromParam, toParam}},
+		{method: "POST", summary: "Replace the absences, backing up the previous version", body: "AbsencesData", save: true},
+	}},
+	{"/api/permissions.json", "Data files", []apiOp{
+		{method: "GET", summary: "Read who may modify which environments"},
+		{method: "POST", summary: "Replace the permissions, backing up the previous version", body: "object", save: true, admin: true},
+	}},
+	{"/api/notification-rules", "Notifications", []apiOp{
+		{method: "GET", summary: "Read the notification rules"},
+		{method: "POST", summary: "Replace the notification rules, backing up the previous version", body: "object", save: true, admin: true},
+	}},
+	{"/api/notification-rules/test", "Notifications", []apiOp{
+		{method: "POST", summary: "Test-fire an event: the rules and destinations it is routed to, delivered unless dryRun", body: "object"},
+	}},
+	{"/api/backups", "Backups", []apiOp{
+		{method: "GET", summary: "List the backups, or read one", query: []apiParam{{"prefix", "", "Only backups of this data file, e.g. releases"}, {"filename", "", "Read this backup"}, {"raw", "", "With filename, serve the backup itself, with Range requests"}}, admin: true},
+		{method: "DELETE", summary: "Delete a backup, named by the filename of the body", body: "object", resp: "text", admin: true},
+	}},
+	{"/api/cloud-export", "Backups", []apiOp{
+		{method: "GET", summary: "Read the cloud export's schedule and last exports", admin: true},
+		{method: "POST", summary: "Export the data to the cloud drive now", admin: true},
+	}},
+	{"/api/backup-settings", "Backups", []apiOp{
+		{method: "GET", summary: "Read the backup settings", admin: true},
+	}},
+	{"/api/replication", "Backups", []apiOp{
+		{method: "GET", summary: "Read whether the server is a primary or a standby, and how far a standby has copied", admin: true},
+	}},
+	{"/api/replication/manifest", "Backups", []apiOp{
+		{method: "GET", summary: "List the data files' checksums and the backups' sizes for standbys", admin: true},
+	}},
+	{"/api/replication/files/{name}", "Backups", []apiOp{
+		{method: "GET", summary: "Read a data file as stored, for standbys", admin: true},
+	}},
+	{"/api/replication/backups/{name}", "Backups", []apiOp{
+		{method: "GET", summary: "Read a backup as stored, for standbys", admin: true},
+	}},
+
+	// Environments
+	{"/api/environments/{name}", "Environments", []apiOp{
+		{method: "GET", summary: "Read an environment", resp: "Environment"},
+		{method: "POST", summary: "Create an environment", body: "Environment", resp: "Environment", record: true},
+		{method: "PUT", summary: "Update an environment", body: "Environment", resp: "Environment", record: true},
+		{method: "DELETE", summary: "Delete an environment", resp: "text", record: true},
+	}},
+	{"/api/environments/{name}/lock", "Environments", []apiOp{
+		{method: "GET", summary: "Read an environment's lock", resp: "EnvironmentLock"},
+		{method: "POST", summary: "Lock an environment", body: "EnvironmentLock", resp: "EnvironmentLock", record: true},
+		{method: "DELETE", summary: "Unlock an environment", resp: "text", record: true},
+	}},
+	{"/api/environments/{name}/clone", "Environments", []apiOp{
+		{method: "POST", summary: "Clone an environment's configuration, groups and optionally its future releases", body: "object", record: true},
+	}},
+	{"/api/groups", "Environments", []apiOp{
+		{method: "GET", summary: "List the environment groups", resp: "array"},
+	}},
+	{"/api/groups/{name}", "Environments", []apiOp{
+		{method: "GET", summary: "Read a group: its environments, freezes and upcoming releases", query: []apiParam{{"days", "integer", "How far ahead to list releases"}}},
+	}},
+
+	// Releases
+	{"/api/releases/{id}/promote", "Releases", []apiOp{
+		{method: "POST", summary: "Promote a release to the next environment of the pipeline", body: "object", record: true},
+	}},
+	{"/api/releases/{id}/assignments", "Releases", []apiOp{
+		{method: "GET", summary: "Read who is assigned to a release"},
+		{method: "PUT", summary: "Replace the assignments, reporting availability warnings", body: "object", record: true},
+	}},
+	{"/api/releases/{id}/tickets", "Releases", []apiOp{
+		{method: "GET", summary: "List a release's tickets with their details", resp: "array"},
+		{method: "POST", summary: "Link tickets to a release", body: "object", record: true},
+	}},
+	{"/api/releases/{id}/tickets/{key}", "Releases", []apiOp{
+		{method: "DELETE", summary: "Unlink a ticket from a release", resp: "text", record: true},
+	}},
+	{"/api/releases/{id}/incidents", "Releases", []apiOp{
+		{method: "GET", summary: "List the incidents linked to a release", resp: "array"},
+		{method: "POST", summary: "Link an incident the release is suspected of causing", body: "ReleaseIncident", record: true},
+	}},
+	{"/api/releases/{id}/incidents/{incident}", "Releases", []apiOp{
+		{method: "DELETE", summary: "Unlink an incident from a release", resp: "text", record: true},
+	}},
+	{"/api/releases/{id}/outcome", "Releases", []apiOp{
+		{method: "GET", summary: "Read a release's recorded outcome", resp: "ReleaseOutcome"},
+		{method: "PUT", summary: "Record when a release actually ran and how it went", body: "ReleaseOutcome", resp: "ReleaseOutcome", record: true},
+		{method: "DELETE", summary: "Clear a release's outcome", resp: "text", record: true},
+	}},
+	{"/api/releases/{id}/retrospective", "Releases", []apiOp{
+		{method: "GET", summary: "Read a release's retrospective", resp: "Retrospective"},
+		{method: "PUT", summary: "Attach a retrospective with its findings and action items", body: "Retrospective", resp: "Retrospective", record: true},
+		{method: "DELETE", summary: "Clear a release's retrospective", resp: "text", record: true},
+	}},
+	{"/api/releases/{id}/deploy", "Releases", []apiOp{
+		{method: "POST", summary: "Deploy a release through its Jenkins job, GitHub workflow or GitLab pipeline", body: "object", resp: "ReleaseDeployment"},
+	}},
+	{"/api/retrospectives", "Releases", []apiOp{
+		{method: "GET", summary: "Query retrospectives and their recurring finding categories", query: []apiParam{fromParam, toParam, envParam, {"category", "", "Only findings of this category"}}},
+	}},
+	{"/api/inbound/releases", "Releases", []apiOp{
+		{method: "POST", summary: "Create or update a release from an external system", body: "object"},
+	}},
+	{"/api/next-release", "Releases", []apiOp{
+		{method: "GET", summary: "The next upcoming release with a countdown", query: []apiParam{envParam}},
+	}},
+
+	// Planning views
+	{"/api/dashboard", "Planning", []apiOp{
+		{method: "GET", summary: "Dashboard summary", query: []apiParam{{"days", "integer", "How far ahead to look"}, {"jira", "boolean", "Include Jira tickets"}}},
+	}},
+	{"/api/timeline", "Planning", []apiOp{
+		{method: "GET", summary: "Gantt/timeline bars", query: []apiParam{fromParam, toParam, {"group", "", "Only this group's environments"}}},
+	}},
+	{"/api/plan", "Planning", []apiOp{
+		{method: "GET", summary: "Releases per environment by week of a quarter or month of a year, with freezes and holidays",
+			query: []apiParam{{"granularity", "", "quarter (default) or year"}, {"from", "date", "A date of the quarter or year, default today"}, {"group", "", "Only this group's environments"}}},
+	}},
+	{"/api/absences/overlaps", "Planning", []apiOp{
+		{method: "GET", summary: "Absences that coincide with scheduled releases", query: []apiParam{envParam, fromParam}},
+	}},
+	{"/api/calendar.svg", "Planning", []apiOp{
+		{method: "GET", summary: "Calendar image of a month or quarter", resp: "image/svg+xml", query: []apiParam{{"year", "integer", ""}, {"month", "integer", "1-12"}, {"quarter", "integer", "1-4"}}},
+	}},
+	{"/api/cab/agenda", "Planning", []apiOp{
+		{method: "GET", summary: "Change Advisory Board agenda of a week", resp: "agenda", query: []apiParam{{"week", "date", "A date of the week, a week from today by default"}, {"format", "", "json, markdown, html or pdf"}}},
+	}},
+	{"/api/graphql", "Planning", []apiOp{
+		{method: "GET", summary: "GraphQL query over environments, releases, holidays, tickets and backups", query: []apiParam{{"query", "", "The GraphQL query"}, {"variables", "", "Its variables as JSON"}, {"operationName", "", ""}}},
+		{method: "POST", summary: "GraphQL query posted as JSON: query, variables and operationName; reads only", body: "object"},
+	}},
+	{"/api/ws", "Planning", []apiOp{
+		{method: "GET", summary: "WebSocket pushing each data file saved: file, records changed, author and new ETag", query: []apiParam{{"files", "", "Comma-separated data files to follow, all by default"}}},
+	}},
+	{"/api/changes", "Planning", []apiOp{
+		{method: "GET", summary: "Data files saved after a cursor, from the audit log; 410 when the cursor is no longer valid", query: []apiParam{{"since", "integer", "Cursor of the previous poll; only the current cursor is returned without it"}, {"file", "", "Only changes of this data file"}, {"limit", "integer", "Changes per page, up to 1000"}}},
+	}},
+	{"/api/presence", "Planning", []apiOp{
+		{method: "GET", summary: "Users editing data files or their records", resp: "array", query: []apiParam{{"file", "", "Only those editing this data file"}, {"record", "", "Only those editing this record of it, or all of the file"}}},
+		{method: "POST", summary: "Heartbeat while editing a file or record, every 20 seconds; returns the others editing it", body: "object", resp: "array"},
+		{method: "DELETE", summary: "Stop editing a file or record", body: "object", resp: "none"},
+	}},
+	{"/api/merge/{file}", "Planning", []apiOp{
+		{method: "POST", summary: "Three-way merge of a document with the saved version, from the version of its base ETag; conflicts keep the saved value", body: "object"},
+	}},
+	{"/api/undo", "Planning", []apiOp{
+		{method: "GET", summary: "How many saves of a data file can be undone and redone", query: []apiParam{fileParam}},
+		{method: "POST", summary: "Undo the last save of a data file", query: []apiParam{fileParam}, headers: []apiParam{maxBackupsHeader}},
+	}},
+	{"/api/redo", "Planning", []apiOp{
+		{method: "GET", summary: "How many saves of a data file can be undone and redone", query: []apiParam{fileParam}},
+		{method: "POST", summary: "Redo the last undo of a data file", query: []apiParam{fileParam}, headers: []apiParam{maxBackupsHeader}},
+	}},
+	{"/api/diff", "Planning", []apiOp{
+		{method: "GET", summary: "Records added, removed and changed between two versions of a data file", query: []apiParam{fileParam, {"from", "", "Backup name, ETag or current"}, {"to", "", "Backup name, ETag or current, the default"}}},
+	}},
+	{"/api/workspaces", "Planning", []apiOp{
+		{method: "GET", summary: "Workspaces the server hosts, each with its API under /api/{workspace}/, and the one the web app works on"},
+	}},
+	{"/api/search", "Planning", []apiOp{
+		{method: "GET", summary: "Full-text search over release notes and holidays", query: []apiParam{{"q", "", "Search terms"}, {"type", "", "Only results of this type"}, {"limit", "integer", ""}}},
+	}},
+
+	// Analytics
+	{"/api/analytics/frequency", "Analytics", []apiOp{
+		{method: "GET", summary: "Release frequency", query: []apiParam{envParam, fromParam, toParam, {"interval", "", "week or month"}}},
+	}},
+	{"/api/analytics/slippage", "Analytics", []apiOp{
+		{method: "GET", summary: "Slippage of planned vs. actual release dates", query: []apiParam{fromParam, toParam}},
+	}},
+	{"/api/analytics/utilization", "Analytics", []apiOp{
+		{method: "GET", summary: "Deployment window utilization and congestion ahead", query: []apiParam{fromParam, toParam, {"ahead", "integer", "Days ahead measuring congestion"}}},
+	}},
+	{"/api/analytics/change-failure", "Analytics", []apiOp{
+		{method: "GET", summary: "Change failure rate per environment and label", query: []apiParam{fromParam, toParam}},
+	}},
+	{"/api/analytics/dora", "Analytics", []apiOp{
+		{method: "GET", summary: "DORA deployment frequency and change lead time", query: []apiParam{envParam, fromParam, toParam}},
+	}},
+
+	// Tickets
+	{"/api/ticket-providers", "Tickets", []apiOp{
+		{method: "GET", summary: "List the ticket providers and whether they are configured", resp: "array"},
+	}},
+	{"/api/tickets/{provider}", "Tickets", []apiOp{
+		{method: "GET", summary: "Tickets of a provider offered for linking", query: []apiParam{refreshParam}},
+	}},
+	{"/api/jira-tickets", "Tickets", []apiOp{{method: "GET", summary: "Jira tickets, as /api/tickets/jira", query: []apiParam{refreshParam}}}},
+	{"/api/github/tickets", "Tickets", []apiOp{{method: "GET", summary: "GitHub issues, as /api/tickets/github", query: []apiParam{refreshParam}}}},
+	{"/api/gitlab/tickets", "Tickets", []apiOp{{method: "GET", summary: "GitLab issues, as /api/tickets/gitlab", query: []apiParam{refreshParam}}}},
+	{"/api/ado/tickets", "Tickets", []apiOp{{method: "GET", summary: "Azure DevOps work items, as /api/tickets/ado", query: []apiParam{refreshParam}}}},
+	{"/api/linear/tickets", "Tickets", []apiOp{{method: "GET", summary: "Linear issues, as /api/tickets/linear", query: []apiParam{refreshParam}}}},
+
+	// Integrations
+	{"/api/jira-config", "Integrations", []apiOp{
+		{method: "GET", summary: "Read the Jira config, secrets masked", admin: true},
+		{method: "POST", summary: "Validate, test and save the Jira config", body: "object", query: []apiParam{{"test", "boolean", "Test the connection, default true"}}, headers: []apiParam{ifMatchHeader, maxBackupsHeader}, admin: true},
+	}},
+	{"/api/jira/validate-jql", "Integrations", []apiOp{
+		{method: "POST", summary: "Validate a JQL query: its result count, a preview or Jira's errors", body: "object"},
+	}},
+	{"/api/jira/sprints", "Integrations", []apiOp{
+		{method: "GET", summary: "Active and future sprints of the configured boards", query: []apiParam{refreshParam, {"state", "", "Only sprints in this state"}}},
+	}},
+	{"/api/jira/status", "Integrations", []apiOp{
+		{method: "GET", summary: "State of the background Jira refresh"},
+	}},
+	{"/api/jira/webhook", "Integrations", []apiOp{
+		{method: "POST", summary: "Jira webhook: issue updates, deletions and key changes", body: "object", query: []apiParam{{"secret", "", "The webhook secret, unless signed"}}, headers: []apiParam{{"X-Hub-Signature", "", "HMAC signature of the body"}}},
+	}},
+	{"/api/github/milestones", "Integrations", []apiOp{
+		{method: "GET", summary: "Synced GitHub milestones with their completion"},
+		{method: "POST", summary: "Sync GitHub milestones now"},
+	}},
+	{"/api/integrations/github/webhook", "Integrations", []apiOp{
+		{method: "POST", summary: "GitHub webhook: completed workflow runs finish deployments", body: "object", headers: []apiParam{{"X-GitHub-Event", "", "Event type"}, {"X-Hub-Signature-256", "", "HMAC-SHA256 signature of the body"}}},
+	}},
+	{"/api/gitlab/milestones", "Integrations", []apiOp{
+		{method: "GET", summary: "GitLab milestones mapped to their releases"},
+	}},
+	{"/api/ado/iterations", "Integrations", []apiOp{
+		{method: "GET", summary: "Azure DevOps iterations mapped to their releases"},
+	}},
+	{"/api/linear/cycles", "Integrations", []apiOp{
+		{method: "GET", summary: "Linear cycles mapped to their releases", query: []apiParam{refreshParam}},
+	}},
+	{"/api/confluence/calendar", "Integrations", []apiOp{
+		{method: "GET", summary: "The last Confluence calendar publish, or the page body", query: []apiParam{{"preview", "boolean", "Return the page body"}}},
+		{method: "POST", summary: "Publish the Confluence calendar now"},
+	}},
+	{"/api/servicenow/changes", "Integrations", []apiOp{
+		{method: "GET", summary: "ServiceNow change requests created for releases"},
+		{method: "POST", summary: "Sync ServiceNow change requests now"},
+	}},
+	{"/api/statuspage/maintenances", "Integrations", []apiOp{
+		{method: "GET", summary: "Status page maintenances scheduled for releases"},
+		{method: "POST", summary: "Sync status page maintenances now"},
+	}},
+	{"/api/maintenance-windows", "Integrations", []apiOp{
+		{method: "GET", summary: "Maintenance windows created for releases"},
+		{method: "POST", summary: "Sync maintenance windows now"},
+	}},
+	{"/api/kubernetes/versions", "Integrations", []apiOp{
+		{method: "GET", summary: "Versions running on each environment's clusters, as cached"},
+		{method: "POST", summary: "Read the clusters' versions now"},
+	}},
+	{"/api/argocd/versions", "Integrations", []apiOp{
+		{method: "GET", summary: "Versions ArgoCD deployed on each environment", query: []apiParam{refreshParam}},
+	}},
+	{"/api/integrations/slack/command", "Integrations", []apiOp{
+		{method: "POST", summary: "The /releases Slack slash command", body: "form", headers: []apiParam{{"X-Slack-Signature", "", "Slack request signature"}, {"X-Slack-Request-Timestamp", "integer", "Slack request time"}}},
+	}},
+	{"/api/email/digest", "Notifications", []apiOp{
+		{method: "GET", summary: "Render next week's email digest"},
+		{method: "POST", summary: "Mail the digest to its recipients now"},
+	}},
+	{"/api/webhooks/deliveries", "Notifications", []apiOp{
+		{method: "GET", summary: "Webhook delivery log, newest first", query: []apiParam{{"endpoint", "", ""}, {"type", "", "Event type"}, {"status", "", "Delivery status"}}, admin: true},
+	}},
+	{"/api/webhooks/deliveries/{id}/redeliver", "Notifications", []apiOp{
+		{method: "POST", summary: "Send a logged webhook again", admin: true},
+	}},
+	{"/api/public/status", "Public", []apiOp{
+		{method: "GET", summary: "Upcoming releases, freezes and locks for a public status token", query: []apiParam{{"token", "", "Public status token, instead of a bearer token"}}},
+	}},
+
+	// Accounts
+	{"/api/setup", "Accounts", []apiOp{
+		{method: "GET", summary: "Whether the first admin still needs to be created"},
+		{method: "POST", summary: "Create the first admin with the setup token from the server log", body: "object"},
+	}},
+	{"/api/login", "Accounts", []apiOp{
+		{method: "POST", summary: "Log in with a local account", body: "object"},
+	}},
+	{"/api/logout", "Accounts", []apiOp{
+		{method: "POST", summary: "Log out of the current session", resp: "none"},
+	}},
+	{"/api/me", "Accounts", []apiOp{
+		{method: "GET", summary: "The current user, and whether logging in is needed"},
+	}},
+	{"/api/me/password", "Accounts", []apiOp{
+		{method: "PUT", summary: "Change the current user's password", body: "object", resp: "none"},
+	}},
+	{"/api/me/preferences", "Accounts", []apiOp{
+		{method: "GET", summary: "The current user's preferences"},
+		{method: "PUT", summary: "Replace the current user's preferences", body: "object"},
+	}},
+	{"/api/me/permissions", "Accounts", []apiOp{
+		{method: "GET", summary: "Environments the current user may modify"},
+	}},
+	{"/api/whoami", "Accounts", []apiOp{
+		{method: "GET", summary: "The current user and what their role lets them do"},
+	}},
+	{"/api/users", "Accounts", []apiOp{
+		{method: "GET", summary: "List the local accounts", resp: "array", admin: true},
+		{method: "POST", summary: "Create a local account", body: "object", admin: true},
+	}},
+	{"/api/users/{username}", "Accounts", []apiOp{
+		{method: "PUT", summary: "Change an account's display name, password, role or disabled flag", body: "object", admin: true},
+		{method: "DELETE", summary: "Delete an account", resp: "none", admin: true},
+	}},
+	{"/api/api-keys", "Accounts", []apiOp{
+		{method: "GET", summary: "List the API keys", resp: "array", admin: true},
+		{method: "POST", summary: "Create an API key, the only time it is shown", body: "object", admin: true},
+	}},
+	{"/api/api-keys/{id}", "Accounts", []apiOp{
+		{method: "DELETE", summary: "Revoke an API key", resp: "none", admin: true},
+	}},
+	{"/api/saml/login", "Accounts", []apiOp{
+		{method: "GET", summary: "Start a SAML login at the IdP", resp: "redirect", query: []apiParam{{"redirect", "", "Where to go after logging in"}}},
+	}},
+	{"/api/saml/acs", "Accounts", []apiOp{
+		{method: "POST", summary: "SAML assertion consumer: the IdP posts its response here", body: "form", resp: "redirect"},
+	}},
+	{"/api/saml/metadata", "Accounts", []apiOp{
+		{method: "GET", summary: "Service provider metadata for the IdP", resp: "application/samlmetadata+xml"},
+	}},
+
+	// Operations
+	{"/api/audit", "Operations", []apiOp{
+		{method: "GET", summary: "Query the audit log", resp: "audit", admin: true, query: []apiParam{
+			{"user", "", ""}, {"file", "", ""}, {"action", "", "create, update, delete, restore, undo, redo, prune or lockout"}, fromParam, toParam,
+			{"limit", "integer", "Page size, default 100, at most 1000"}, {"offset", "integer", ""}, {"format", "", "json or csv"},
+		}},
+	}},
+	{"/api/audit/verify", "Operations", []apiOp{
+		{method: "GET", summary: "Check the audit log's hash chain", admin: true},
+	}},
+	{"/api/admin/files", "Operations", []apiOp{
+		{method: "GET", summary: "List the data files with their size, modification, ETag, backups and last writer", resp: "array", admin: true},
+	}},
+	{"/api/admin/reload", "Operations", []apiOp{
+		{method: "POST", summary: "Reread and validate the data files, take in edits made on disk and drop the caches", admin: true},
+	}},
+	{"/api/features", "Operations", []apiOp{
+		{method: "GET", summary: "The optional subsystems, such as Jira, notifications, login and workspaces, and whether they are enabled"},
+	}},
+	{"/api/openapi.json", "Operations", []apiOp{
+		{method: "GET", summary: "This document"},
+	}},
+	{"/healthz", "Operations", []apiOp{
+		{method: "GET", summary: "Liveness probe"},
+	}},
+	{"/readyz", "Operations", []apiOp{
+		{method: "GET", summary: "Readiness probe, 503 when failing", query: []apiParam{{"jira", "boolean", "Check Jira, default true"}}},
+	}},
+	{"/debug/runtime", "Operations", []apiOp{
+		{method: "GET", summary: "Runtime statistics: goroutines, memory and open files", admin: true},
+	}},
+	{"/debug/pprof/{profile}", "Operations", []apiOp{
+		{method: "GET", summary: "pprof profiles: heap, goroutine, profile, trace, ...", resp: "application/octet-stream", admin: true},
+	}},
+}
+
+// Headers of data file saves
+var (
+	ifMatchHeader    = apiParam{"If-Match", "", "ETag of the version the change is based on; 412 when the file changed since"}
+	maxBackupsHeader = apiParam{"X-Max-Backups", "integer", "Backups of the file to keep"}
+	restoreHeader    = apiParam{"X-Restore", "boolean", "The save restores a backup, audited as such"}
+)
+
+// apiSchemaTypes are the data types documented as schemas, by name
+var apiSchemaTypes = map[string]reflect.Type{
+	"ReleasesData":      reflect.TypeOf(ReleasesData{}),
+	"EnvironmentsData":  reflect.TypeOf(EnvironmentsData{}),
+	"Environment":       reflect.TypeOf(Environment{}),
+	"EnvironmentLock":   reflect.TypeOf(EnvironmentLock{}),
+	"HolidaysData":      reflect.TypeOf(HolidaysData{}),
+	"TeamData":          reflect.TypeOf(TeamData{}),
+	"AbsencesData":      reflect.TypeOf(AbsencesData{}),
+	"ReleaseOutcome":    reflect.TypeOf(ReleaseOutcome{}),
+	"Retrospective":     reflect.TypeOf(Retrospective{}),
+	"ReleaseIncident":   reflect.TypeOf(ReleaseIncident{}),
+	"ReleaseDeployment": reflect.TypeOf(ReleaseDeployment{}),
+}
+
+// schemaBuilder turns Go types into OpenAPI schemas, named structs becoming
+// components referenced by $ref
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of a type
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // placeholder, for types referring to themselves
+			b.schemas[t.Name()] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]interface{}{}
+}
+
+// structSchema returns the object schema of a struct's JSON fields
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			if embedded, ok := b.schema(f.Type)["$ref"]; ok {
+				ref := strings.TrimPrefix(embedded.(string), "#/components/schemas/")
+				if s, ok := b.schemas[ref].(map[string]interface{}); ok {
+					for k, v := range s["properties"].(map[string]interface{}) {
+						props[k] = v
+					}
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	s := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// paramSchema is the schema of a parameter type
+func paramSchema(typ string) map[string]interface{} {
+	switch typ {
+	case "date":
+		return map[string]interface{}{"type": "string", "format": "date"}
+	case "integer", "boolean":
+		return map[string]interface{}{"type": typ}
+	}
+	return map[string]interface{}{"type": "string"}
+}
+
+// pathParamPattern finds the {name} wildcards of a route
+var pathParamPattern = regexp.MustCompile(`\{(\w+)\}`)
+
+// content is the content of a request or response body
+func (b *schemaBuilder) content(kind string) map[string]interface{} {
+	var mediaType string
+	var schema map[string]interface{}
+	switch kind {
+	case "", "object":
+		mediaType, schema = "application/json", map[string]interface{}{"type": "object"}
+	case "array":
+		mediaType, schema = "application/json", map[string]interface{}{"type": "array", "items": map[string]interface{}{}}
+	case "text":
+		mediaType, schema = "text/plain", map[string]interface{}{"type": "string"}
+	case "form":
+		mediaType, schema = "application/x-www-form-urlencoded", map[string]interface{}{"type": "object"}
+	default:
+		if t, ok := apiSchemaTypes[kind]; ok {
+			mediaType, schema = "application/json", b.schema(t)
+		} else {
+			mediaType, schema = kind, map[string]interface{}{"type": "string", "format": "binary"}
+		}
+	}
+	return map[string]interface{}{mediaType: map[string]interface{}{"schema": schema}}
+}
+
+// response documents the successful response of an operation
+func (b *schemaBuilder) response(op apiOp) (string, map[string]interface{}) {
+	switch op.resp {
+	case "none":
+		return "204", map[string]interface{}{"description": "Done"}
+	case "redirect":
+		return "302", map[string]interface{}{"description": "Redirect"}
+	case "agenda":
+		content := b.content("object")
+		for _, t := range []string{"text/markdown", "text/html", "application/pdf"} {
+			content[t] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		}
+		return "200", map[string]interface{}{"description": "The agenda in the requested format", "content": content}
+	case "audit":
+		content := b.content("object")
+		content["text/csv"] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+		return "200", map[string]interface{}{"description": "A page of entries, or all of them as CSV", "content": content,
+			"headers": map[string]interface{}{"X-Total-Count": headerDoc("Entries matching the filters", "integer")}}
+	}
+	resp := map[string]interface{}{"description": "OK", "content": b.content(op.resp)}
+	if op.method == "GET" && op.resp != "" && apiSchemaTypes[op.resp] != nil {
+		resp["headers"] = map[string]interface{}{
+			"ETag":               headerDoc("Version of the data, for If-Match", ""),
+			"Last-Modified":      headerDoc("When the data file was saved", ""),
+			"X-Last-Modified-By": headerDoc("Who saved the data file", ""),
+		}
+	}
+	if op.save || op.record {
+		resp["headers"] = map[string]interface{}{"ETag": headerDoc("Version of the saved data file", "")}
+	}
+	return "200", resp
+}
+
+// headerDoc documents a response header
+func headerDoc(desc, typ string) map[string]interface{} {
+	return map[string]interface{}{"description": desc, "schema": paramSchema(typ)}
+}
+
+// errorResponse documents a plain text error
+func errorResponse(desc string) map[string]interface{} {
+	return map[string]interface{}{"description": desc, "content": map[string]interface{}{
+		"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}},
+	}}
+}
+
+// buildOpenAPI generates the OpenAPI document of apiRoutes
+func buildOpenAPI() map[string]interface{} {
+	b := &schemaBuilder{schemas: map[string]interface{}{}}
+	paths := map[string]interface{}{}
+	tags := map[string]bool{}
+	for _, route := range apiRoutes {
+		tags[route.tag] = true
+		var pathParams []interface{}
+		for _, m := range pathParamPattern.FindAllStringSubmatch(route.path, -1) {
+			pathParams = append(pathParams, map[string]interface{}{"name": m[1], "in": "path", "required": true, "schema": paramSchema("")})
+		}
+		item := map[string]interface{}{}
+		if len(pathParams) > 0 {
+			item["parameters"] = pathParams
+		}
+		for _, op := range route.ops {
+			var params []interface{}
+			for _, p := range op.query {
+				params = append(params, map[string]interface{}{"name": p.name, "in": "query", "description": p.desc, "schema": paramSchema(p.typ)})
+			}
+			headers := op.headers
+			if op.save {
+				headers = append(headers, ifMatchHeader, maxBackupsHeader, restoreHeader)
+			} else if op.record {
+				headers = append(headers, maxBackupsHeader)
+			}
+			for _, h := range headers {
+				params = append(params, map[string]interface{}{"name": h.name, "in": "header", "description": h.desc, "schema": paramSchema(h.typ)})
+			}
+			status, resp := b.response(op)
+			responses := map[string]interface{}{status: resp}
+			if op.method != "GET" {
+				responses["400"] = errorResponse("Invalid request")
+			}
+			if op.admin {
+				responses["403"] = errorResponse("Not an admin")
+			}
+			if op.save {
+				responses["409"] = errorResponse("A planning rule rejected the change")
+				responses["412"] = errorResponse("The file changed since the If-Match version; its ETag is in the response")
+			}
+			doc := map[string]interface{}{
+				"summary":     op.summary,
+				"operationId": operationID(op.method, route.path),
+				"tags":        []string{route.tag},
+				"responses":   responses,
+			}
+			if len(params) > 0 {
+				doc["parameters"] = params
+			}
+			if op.body != "" {
+				doc["requestBody"] = map[string]interface{}{"required": true, "content": b.content(op.body)}
+			}
+			item[strings.ToLower(op.method)] = doc
+		}
+		paths[route.path] = item
+	}
+
+	var tagList []interface{}
+	for tag := range tags {
+		tagList = append(tagList, map[string]interface{}{"name": tag})
+	}
+	sort.Slice(tagList, func(i, j int) bool {
+		return tagList[i].(map[string]interface{})["name"].(string) < tagList[j].(map[string]interface{})["name"].(string)
+	})
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Release Planner API",
+			"version": "1",
+			"description": "Writes need a session with its " + csrfHeader + " header, or an API key as a bearer token, once accounts exist. " +
+				"Every response carries an X-Request-ID to quote when reporting problems; errors are plain text.",
+		},
+		"paths": paths,
+		"tags":  tagList,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": sessionCookie},
+				"apiKey":  map[string]interface{}{"type": "http", "scheme": "bearer", "description": "An API key from /api/api-keys"},
+			},
+		},
+		"security": []interface{}{map[string]interface{}{"session": []string{}}, map[string]interface{}{"apiKey": []string{}}},
+	}
+}
+
+// operationID names an operation after its method and path, e.g.
+// putReleasesIdOutcome
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') }) {
+		if part == "api" {
+			continue
+		}
+		id += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return id
+}
+
+// openAPI caches the generated document, which only changes with the code
+var openAPI struct {
+	sync.Once
+	doc []byte
+}
+
+// Handle the OpenAPI document of the API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	openAPI.Do(func() {
+		openAPI.doc, _ = json.MarshalIndent(buildOpenAPI(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI.doc)
+}
+
+// swaggerInitializer points the embedded Swagger UI at our document
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/api/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    plugins: [SwaggerUIBundle.plugins.DownloadUrl],
+    layout: "StandaloneLayout",
+    requestInterceptor: function(req) {
+      var csrf = document.cookie.match(/(?:^|; )` + csrfCookie + `=([^;]*)/);
+      if (csrf) req.headers["` + csrfHeader + `"] = decodeURIComponent(csrf[1]);
+      return req;
+    }
+  });
+};
+`
+
+// swaggerUI serves the embedded Swagger UI files
+var swaggerUI = http.StripPrefix("/api/docs/", http.FileServer(http.FS(swaggerFiles.FS)))
+
+// Handle the Swagger UI of the API at /api/docs
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/api/docs":
+		http.Redirect(w, r, "/api/docs/", http.StatusMovedPermanently)
+	case "/api/docs/swagger-initializer.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Write([]byte(swaggerInitializer))
+	default:
+		swaggerUI.ServeHTTP(w, r)
+	}
+}
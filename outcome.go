@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Results a release outcome can record
+var outcomeResults = map[string]bool{"success": true, "partial": true, "rolled-back": true}
+
+// parseOutcomeTime accepts RFC 3339 or the yyyy-mm-ddThh:mm of a
+// datetime-local input, in server time, and returns it as RFC 3339
+func parseOutcomeTime(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		if t, err = time.ParseInLocation(dateTimeLayout, s, time.Local); err != nil {
+			return "", fmt.Errorf("invalid time %q, expected RFC 3339", s)
+		}
+	}
+	return t.UTC().Format(time.RFC3339), nil
+}
+
+// validateOutcome checks and normalizes an outcome sent by a client
+func validateOutcome(o *ReleaseOutcome) error {
+	o.Result = strings.ToLower(strings.TrimSpace(o.Result))
+	if !outcomeResults[o.Result] {
+		return fmt.Errorf("result must be success, partial or rolled-back")
+	}
+	var err error
+	if o.StartedAt, err = parseOutcomeTime(o.StartedAt); err != nil {
+		return err
+	}
+	if o.FinishedAt, err = parseOutcomeTime(o.FinishedAt); err != nil {
+		return err
+	}
+	if o.StartedAt != "" && o.FinishedAt != "" && o.FinishedAt < o.StartedAt {
+		return fmt.Errorf("finishedAt is before startedAt")
+	}
+	if o.LogsURL != "" {
+		u, err := url.Parse(o.LogsURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("logsUrl must be an http(s) URL")
+		}
+	}
+	o.Notes = strings.TrimSpace(o.Notes)
+	return nil
+}
+
+// outcomeFromDeployment is the outcome of a deployment that finished
+// successfully, nil otherwise: a failed build doesn't tell whether the
+// release was partly out or rolled back, so that is left to be recorded
+func outcomeFromDeployment(d ReleaseDeployment) *ReleaseOutcome {
+	if d.Status != deploymentFinished || !strings.EqualFold(d.Result, "success") {
+		return nil
+	}
+	return &ReleaseOutcome{StartedAt: d.TriggeredAt, FinishedAt: d.FinishedAt, Result: "success",
+		LogsURL: d.URL, RecordedBy: d.Provider, RecordedAt: time.Now().UTC().Format(time.RFC3339)}
+}
+
+// Handle the recorded outcome of a release: GET reads it, PUT records when
+// it actually started and finished, how it went and where its logs are, and
+// DELETE clears it
+func handleReleaseOutcome(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		if err := authorizeEnvironments(r, env); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if entry["outcome"] == nil {
+			http.Error(w, "No outcome recorded", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry["outcome"])
+		return
+
+	case http.MethodPut:
+		var outcome ReleaseOutcome
+		if err := json.NewDecoder(r.Body).Decode(&outcome); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateOutcome(&outcome); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		outcome.RecordedBy = requestUser(r)
+		outcome.RecordedAt = time.Now().UTC().Format(time.RFC3339)
+		entry["outcome"] = outcome
+
+	case http.MethodDelete:
+		// null rather than absent, which would keep the recorded outcome
+		entry["outcome"] = nil
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filePath := filepath.Join(dataDir, "releases.json")
+	warnings := warningsByPath(filePath, doc)
+	newETag, err := writeJSONFile(withServerFields(r.Context()), filePath, doc, etag, maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", newETag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"release":  entry,
+		"warnings": warnings,
+	})
+}
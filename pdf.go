@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PDF page layout of writeTextPDF, in points: A4 with 50pt margins
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 50
+	pdfLeading    = 14
+	pdfLineChars  = 95 // what fits a line of 10pt Helvetica
+)
+
+// pdfEscape makes text a PDF string literal; the standard fonts only have
+// Latin-1, so other characters are replaced
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteString("    ")
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
+
+// wrapPDFLine splits a line to fit the page, continuing it indented
+func wrapPDFLine(line string) []string {
+	var lines []string
+	indent := line[:len(line)-len(strings.TrimLeft(line, " "))] + "    "
+	for len([]rune(line)) > pdfLineChars {
+		runes := []rune(line)
+		cut := strings.LastIndex(string(runes[:pdfLineChars]), " ")
+		if cut <= len(indent) {
+			cut = len(string(runes[:pdfLineChars]))
+		}
+		lines = append(lines, line[:cut])
+		line = indent + strings.TrimLeft(line[cut:], " ")
+	}
+	return append(lines, line)
+}
+
+// writeTextPDF writes a plain document of a bold title and lines of text,
+// paginated, using only the standard Helvetica fonts so it needs no
+// library or embedded font
+func writeTextPDF(w io.Writer, title string, lines []string) error {
+	var wrapped []string
+	for _, line := range lines {
+		wrapped = append(wrapped, wrapPDFLine(line)...)
+	}
+	perPage := (pdfPageHeight - 2*pdfMargin) / pdfLeading
+	var pages [][]string
+	first := perPage - 2 // the title takes two lines
+	for len(wrapped) > 0 || len(pages) == 0 {
+		n := perPage
+		if len(pages) == 0 {
+			n = first
+		}
+		if n > len(wrapped) {
+			n = len(wrapped)
+		}
+		pages = append(pages, wrapped[:n])
+		wrapped = wrapped[n:]
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	buf.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 page tree, 3-4 fonts, then a page and its content each
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range pages {
+		var content bytes.Buffer
+		y := pdfPageHeight - pdfMargin
+		if i == 0 {
+			fmt.Fprintf(&content, "BT /F2 14 Tf %d %d Td (%s) Tj ET\n", pdfMargin, y, pdfEscape(title))
+			y -= 2 * pdfLeading
+		}
+		content.WriteString("BT /F1 10 Tf\n")
+		fmt.Fprintf(&content, "%d %d Td %d TL\n", pdfMargin, y, pdfLeading)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT /F1 8 Tf %d %d Td (%d / %d) Tj ET\n", pdfPageWidth-pdfMargin-20, pdfMargin/2, i+1, len(pages))
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, len(offsets)+2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
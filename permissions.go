@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// PermissionsData is permissions.json: the users allowed to modify the
+// releases of an environment. Environments that aren't listed are open to everyone.
+type PermissionsData struct {
+	Environments map[string][]string `json:"environments"`
+}
+
+// requestUser returns the user making the request: its API key, the one
+// logged in, else, until the server has its own accounts, the user
+// authenticated by the reverse proxy
+func requestUser(r *http.Request) string {
+	user, _, _ := requestIdentity(r)
+	return user
+}
+
+// loadPermissions reads permissions.json
+func loadPermissions() (PermissionsData, error) {
+	perms := PermissionsData{Environments: map[string][]string{}}
+	err := readDataFile("permissions.json", &perms)
+	if perms.Environments == nil {
+		perms.Environments = map[string][]string{}
+	}
+	return perms, err
+}
+
+// canModify reports whether a user may change releases of an environment
+func (p PermissionsData) canModify(user, env string) bool {
+	allowed, restricted := p.Environments[env]
+	if !restricted {
+		return true
+	}
+	for _, u := range allowed {
+		if u == user && user != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeEnvironments fails with a 403 saveError when the request's user
+// may not modify one of the given environments
+func authorizeEnvironments(r *http.Request, envs ...string) error {
+	perms, err := loadPermissions()
+	if err != nil {
+		return fmt.Errorf("error reading permissions: %w", err)
+	}
+	user := requestUser(r)
+	for _, env := range envs {
+		if !perms.canModify(user, env) {
+			return &saveError{status: http.StatusForbidden, msg: fmt.Sprintf("Not allowed to modify releases of %s", env)}
+		}
+	}
+	return nil
+}
+
+// withoutTrackedFields copies a release list dropping the server-maintained
+// fields, which clients may or may not send back
+func withoutTrackedFields(list interface{}) []map[string]interface{} {
+	items, _ := list.([]interface{})
+	result := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		entry, _ := item.(map[string]interface{})
+		dup := map[string]interface{}{}
+		for k, v := range entry {
+			dup[k] = v
+		}
+		for _, field := range trackedReleaseFields {
+			delete(dup, field)
+		}
+		result = append(result, dup)
+	}
+	return result
+}
+
+// changedEnvironments lists the environments whose release lists differ
+// between the saved and the submitted releases document
+func changedEnvironments(current, next map[string]interface{}) []string {
+	var changed []string
+	for env, list := range next {
+		if !reflect.DeepEqual(withoutTrackedFields(current[env]), withoutTrackedFields(list)) {
+			changed = append(changed, env)
+		}
+	}
+	for env, list := range current {
+		if _, ok := next[env]; !ok && len(withoutTrackedFields(list)) > 0 {
+			changed = append(changed, env)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// authorizeWrite checks a whole-file write against the per-environment
+// permissions, and the approver role for approvals, before it is saved
+func authorizeWrite(r *http.Request, filePath string, data interface{}) error {
+	switch filepath.Base(filePath) {
+	case "releases.json":
+		next, ok := data.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current, _, err := loadReleasesDocument()
+		if err != nil {
+			return err
+		}
+		if err := authorizeEnvironments(r, changedEnvironments(current, next)...); err != nil {
+			return err
+		}
+		return authorizeApprovals(r, current, next)
+	}
+	return nil
+}
+
+// validatePermissions checks permissions.json
+func validatePermissions(data interface{}) error {
+	var perms PermissionsData
+	if err := decodeInto(data, &perms); err != nil {
+		return fmt.Errorf("permissions.json must map environments to arrays of users")
+	}
+	return nil
+}
+
+// Handle permissions.json
+func handlePermissions(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Join(dataDir, "permissions.json")
+
+	switch r.Method {
+	case http.MethodGet:
+		serveJSONFile(w, filePath)
+	case http.MethodPost:
+		updateJSONFileWithBackup(w, r, filePath, maxBackupsFromRequest(r))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle "my permissions": which environments the current user may modify
+func handleMyPermissions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	perms, err := loadPermissions()
+	if err != nil {
+		http.Error(w, "Error reading permissions", http.StatusInternalServerError)
+		return
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+
+	user := requestUser(r)
+	result := map[string]bool{}
+	for _, env := range envs.Environments {
+		result[env.Name] = perms.canModify(user, env.Name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":         user,
+		"environments": result,
+	})
+}
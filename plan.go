@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// planBucket is a week of a quarter's plan or a month of a year's, with the
+// holidays falling in it
+type planBucket struct {
+	Label       string    `json:"label"` // e.g. 2026-W41 or 2026-10
+	From        string    `json:"from"`
+	To          string    `json:"to"`          // inclusive
+	WorkingDays int       `json:"workingDays"` // weekdays that aren't holidays
+	Releases    int       `json:"releases"`    // of all rows
+	Holidays    []Holiday `json:"holidays"`
+}
+
+// planCell is an environment's releases and freezes in a bucket
+type planCell struct {
+	Releases   int            `json:"releases"`
+	ByStatus   map[string]int `json:"byStatus"`
+	IDs        []string       `json:"ids"`        // of the releases, see /api/releases/{id}
+	FrozenDays int            `json:"frozenDays"` // days of the bucket under a freeze
+	Freezes    []string       `json:"freezes"`    // group:from of the freezes touching it
+}
+
+// planRow is an environment's cells, one per bucket
+type planRow struct {
+	Environment string     `json:"environment"`
+	DisplayName string     `json:"displayName"`
+	Releases    int        `json:"releases"`
+	Cells       []planCell `json:"cells"`
+}
+
+// planData is the response of GET /api/plan
+type planData struct {
+	Granularity string          `json:"granularity"` // quarter or year
+	From        string          `json:"from"`
+	To          string          `json:"to"`
+	Buckets     []planBucket    `json:"buckets"`
+	Rows        []planRow       `json:"rows"`
+	Freezes     []appliedFreeze `json:"freezes"`
+}
+
+// planPeriod returns the quarter or year holding a date, and its buckets:
+// the weeks of a quarter, from Monday and clipped to it, or the months of a
+// year
+func planPeriod(granularity string, date time.Time) (from, to time.Time, buckets []planBucket) {
+	y, m, _ := date.Date()
+	if granularity == "year" {
+		from = time.Date(y, time.January, 1, 0, 0, 0, 0, time.Local)
+		to = from.AddDate(1, 0, -1)
+		for start := from; !start.After(to); start = start.AddDate(0, 1, 0) {
+			buckets = append(buckets, planBucket{Label: start.Format("2006-01"), From: start.Format(dateLayout),
+				To: start.AddDate(0, 1, -1).Format(dateLayout)})
+		}
+		return from, to, buckets
+	}
+	from = time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, time.Local)
+	to = from.AddDate(0, 3, -1)
+	for start := from; !start.After(to); {
+		end := start.AddDate(0, 0, (7-int(start.Weekday()))%7) // through Sunday
+		if end.After(to) {
+			end = to
+		}
+		wy, w := start.ISOWeek()
+		buckets = append(buckets, planBucket{Label: fmt.Sprintf("%d-W%02d", wy, w), From: start.Format(dateLayout),
+			To: end.Format(dateLayout)})
+		start = end.AddDate(0, 0, 1)
+	}
+	return from, to, buckets
+}
+
+// buildPlan counts the releases of each environment per bucket of the
+// quarter or year holding date, with the freezes and holidays overlaid
+func buildPlan(granularity string, date time.Time, group string, langs []string) (planData, error) {
+	releases, err := loadReleases()
+	if err != nil {
+		return planData{}, err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return planData{}, err
+	}
+	holidays = localizeHolidays(holidays, langs)
+	envs, err := loadEnvironments()
+	if err != nil {
+		return planData{}, err
+	}
+	order, err := rowEnvironments(envs, releases, group)
+	if err != nil {
+		return planData{}, err
+	}
+
+	from, to, buckets := planPeriod(granularity, date)
+	data := planData{
+		Granularity: granularity,
+		From:        from.Format(dateLayout),
+		To:          to.Format(dateLayout),
+		Buckets:     buckets,
+		Rows:        []planRow{},
+		Freezes:     envs.activeFreezes(from, to),
+	}
+	// bucketOf finds the bucket of a date of the period
+	bucketOf := func(date string) int {
+		return sort.Search(len(buckets), func(i int) bool { return buckets[i].To >= date })
+	}
+
+	holidayDates := map[string]bool{}
+	for i := range data.Buckets {
+		data.Buckets[i].Holidays = []Holiday{}
+	}
+	for _, h := range holidays.Holidays {
+		if !inDateRange(h.Date, from, to) {
+			continue
+		}
+		b := &data.Buckets[bucketOf(h.Date)]
+		b.Holidays = append(b.Holidays, h)
+		holidayDates[h.Date] = true
+	}
+	for i := range data.Buckets {
+		b := &data.Buckets[i]
+		sort.Slice(b.Holidays, func(x, y int) bool { return b.Holidays[x].Date < b.Holidays[y].Date })
+		start, _ := time.ParseInLocation(dateLayout, b.From, time.Local)
+		end, _ := time.ParseInLocation(dateLayout, b.To, time.Local)
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			if d.Weekday() != time.Saturday && d.Weekday() != time.Sunday && !holidayDates[d.Format(dateLayout)] {
+				b.WorkingDays++
+			}
+		}
+	}
+
+	for _, env := range order {
+		row := planRow{Environment: env.Name, DisplayName: env.DisplayName, Cells: make([]planCell, len(buckets))}
+		for i := range row.Cells {
+			row.Cells[i] = planCell{ByStatus: map[string]int{}, IDs: []string{}, Freezes: []string{}}
+		}
+		entries := append([]ReleaseEntry(nil), releases[env.Name]...)
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+		for _, e := range entries {
+			if !inDateRange(e.Date, from, to) {
+				continue
+			}
+			i := bucketOf(e.Date)
+			c := &row.Cells[i]
+			c.Releases++
+			c.ByStatus[e.Status]++
+			c.IDs = append(c.IDs, releaseID(env.Name, e.Date))
+			data.Buckets[i].Releases++
+			row.Releases++
+		}
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			date := d.Format(dateLayout)
+			freezes := envs.freezesFor(env.Name, date)
+			if len(freezes) == 0 {
+				continue
+			}
+			c := &row.Cells[bucketOf(date)]
+			c.FrozenDays++
+			for _, f := range freezes {
+				if id := f.Group + ":" + f.From; !slices.Contains(c.Freezes, id) {
+					c.Freezes = append(c.Freezes, id)
+				}
+			}
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	return data, nil
+}
+
+// Handle the long-range plan: releases counted per week of a quarter or per
+// month of a year, for each environment, with freezes and holidays
+func handlePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	granularity := r.URL.Query().Get("granularity")
+	switch granularity {
+	case "":
+		granularity = "quarter"
+	case "quarter", "year":
+	default:
+		http.Error(w, "Invalid 'granularity', expected quarter or year", http.StatusBadRequest)
+		return
+	}
+	date, ok := parseDateParam(r, "from", today())
+	if !ok {
+		http.Error(w, "Invalid 'from' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group != "" {
+		if envs, err := loadEnvironments(); err == nil {
+			if _, ok := envs.group(group); !ok {
+				http.Error(w, fmt.Sprintf("Unknown group %q", group), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	data, err := buildPlan(granularity, date, group, requestLanguages(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building the plan: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
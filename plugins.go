@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// PluginsConfig is plugins-config.json: site-specific ticket providers,
+// validators and notifiers kept outside the binary, loaded at startup
+type PluginsConfig struct {
+	Plugins []PluginConfig `json:"plugins"`
+}
+
+// PluginConfig is a program serving some of the extension points. Each call
+// runs it with one JSON-RPC 2.0 request on its standard input, read until
+// EOF, and reads the response from its standard output.
+type PluginConfig struct {
+	// Name is the ticketProvider of releases and the channel of notification
+	// rules it serves
+	Name    string   `json:"name"`
+	Command []string `json:"command"` // program and arguments, run in the server's directory
+	// Provides lists what it serves: tickets, validator and notifier
+	Provides   []string               `json:"provides"`
+	Files      []string               `json:"files,omitempty"`      // data files it validates, all without
+	KeyFormat  string                 `json:"keyFormat,omitempty"`  // of its ticket keys, e.g. SD-number
+	KeyExample string                 `json:"keyExample,omitempty"` // e.g. SD-1234
+	Config     map[string]interface{} `json:"config,omitempty"`     // its own settings, passed with every call
+	// TimeoutSeconds bounds each call, default 10
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+}
+
+// Extension points plugins can provide
+const (
+	pluginTickets   = "tickets"
+	pluginValidator = "validator"
+	pluginNotifier  = "notifier"
+)
+
+// defaultPluginTimeout is how long a call may take without timeoutSeconds
+const defaultPluginTimeout = 10 * time.Second
+
+// pluginValidators are the plugins checking saves, see validateWithPlugins
+var pluginValidators []PluginConfig
+
+// rpcRequest is a JSON-RPC 2.0 request to a plugin
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// rpcResponse is a plugin's answer: a result or an error
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// call runs the plugin for a method, decoding its result into result
+// unless nil. The plugin's config is added to params under "config".
+func (p PluginConfig) call(method string, params map[string]interface{}, result interface{}) error {
+	timeout := defaultPluginTimeout
+	if p.TimeoutSeconds > 0 {
+		timeout = time.Duration(p.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	params["config"] = p.Config
+	input, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: 1, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(), "RELPLANNER_PLUGIN="+p.Name)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("plugin %s: %s timed out after %s", p.Name, method, timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("plugin %s: %s", p.Name, msg)
+		}
+		return fmt.Errorf("plugin %s: %v", p.Name, err)
+	}
+	var resp rpcResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return fmt.Errorf("plugin %s: invalid response to %s: %v", p.Name, method, err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("%s", resp.Error.Message)
+	}
+	if result == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("plugin %s: invalid result of %s: %v", p.Name, method, err)
+	}
+	return nil
+}
+
+// loadPlugins registers the plugins of plugins-config.json with the
+// ticket providers, notification channels and validators. Called once at
+// startup: plugins are not reloaded. A plugin whose name is taken by a
+// built-in is logged and left out.
+func loadPlugins() {
+	var cfg PluginsConfig
+	if err := readDataFile("plugins-config.json", &cfg); err != nil {
+		logPlugins.Error("Plugins disabled, plugins-config.json is invalid", "err", err)
+		return
+	}
+	for _, p := range cfg.Plugins {
+		if p.Name == "" || len(p.Command) == 0 {
+			logPlugins.Error("Plugin left out, it needs a name and a command", "plugin", p.Name)
+			continue
+		}
+		for _, point := range p.Provides {
+			switch point {
+			case pluginTickets:
+				if _, dup := ticketProviders[p.Name]; dup {
+					logPlugins.Error("Plugin left out of ticket providers, the name is taken", "plugin", p.Name)
+					continue
+				}
+				registerTicketProvider(ticketProviderInfo{ID: p.Name, Name: p.Name, ConfigFile: "plugins-config.json",
+					KeyFormat: p.KeyFormat, KeyExample: p.KeyExample}, pluginTicketProvider{p})
+			case pluginNotifier:
+				if _, dup := notificationChannels[p.Name]; dup {
+					logPlugins.Error("Plugin left out of notification channels, the name is taken", "plugin", p.Name)
+					continue
+				}
+				n := pluginChannel{p}
+				registerNotificationChannel(p.Name, notificationChannel{defaults: n.defaults, send: n.send})
+			case pluginValidator:
+				pluginValidators = append(pluginValidators, p)
+			default:
+				logPlugins.Error("Unknown extension point", "plugin", p.Name, "provides", point)
+				continue
+			}
+			logPlugins.Info("Plugin loaded", "plugin", p.Name, "provides", point)
+		}
+	}
+}
+
+// validateWithPlugins runs the validator plugins of a data file. A plugin
+// that can't be run fails the save too, so a broken check doesn't let
+// saves through.
+func validateWithPlugins(file string, data interface{}) error {
+	for _, p := range pluginValidators {
+		if len(p.Files) > 0 && !anyOf(p.Files, file) {
+			continue
+		}
+		if err := p.call("validate", map[string]interface{}{"file": file, "data": data}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pluginTicketProvider is a TicketProvider served by a plugin with the methods
+// tickets.search, tickets.get and tickets.link
+type pluginTicketProvider struct {
+	plugin PluginConfig
+}
+
+// Search passes the query parameters on; the plugin returns the tickets
+func (p pluginTicketProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	var tickets []map[string]interface{}
+	err := p.plugin.call("tickets.search", map[string]interface{}{"query": query, "refresh": refresh}, &tickets)
+	if err != nil {
+		return jiraTicketsResult{}, err
+	}
+	if tickets == nil {
+		tickets = []map[string]interface{}{}
+	}
+	return jiraTicketsResult{tickets: tickets, fetchedAt: time.Now(), cacheStatus: "MISS"}, nil
+}
+
+// Get returns the linked tickets bare when the plugin fails
+func (p pluginTicketProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	var tickets []map[string]interface{}
+	if err := p.plugin.call("tickets.get", map[string]interface{}{"release": release}, &tickets); err != nil {
+		logPlugins.Error("Fetching release tickets failed", "plugin", p.plugin.Name, "release", release.Date, "err", err)
+		return lookupTickets(release.linkedTickets(), jiraTicketsResult{}, p.plugin.Name)
+	}
+	return tickets
+}
+
+// Link refuses keys while the plugin fails
+func (p pluginTicketProvider) Link(key string) (string, bool) {
+	var result struct {
+		Key   string `json:"key"`
+		Valid bool   `json:"valid"`
+	}
+	if err := p.plugin.call("tickets.link", map[string]interface{}{"key": key}, &result); err != nil {
+		logPlugins.Error("Checking a ticket key failed", "plugin", p.plugin.Name, "key", key, "err", err)
+		return key, false
+	}
+	if result.Key == "" {
+		result.Key = key
+	}
+	return result.Key, result.Valid
+}
+
+// pluginChannel is a notification channel served by a plugin with the
+// methods notify.defaults and notify.send
+type pluginChannel struct {
+	plugin PluginConfig
+}
+
+// defaults returns the destinations the plugin routes an event to itself
+func (n pluginChannel) defaults(event releaseEvent) ([]string, error) {
+	var to []string
+	err := n.plugin.call("notify.defaults", map[string]interface{}{"event": event}, &to)
+	return to, err
+}
+
+func (n pluginChannel) send(event releaseEvent, to []string) error {
+	return n.plugin.call("notify.send", map[string]interface{}{"event": event, "to": to}, nil)
+}
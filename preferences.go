@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserPreferences are a user's settings, kept on the server so they follow
+// the user across browsers
+type UserPreferences struct {
+	// Environments the planner shows by default, all visible ones when empty
+	Environments []string `json:"environments,omitempty"`
+	TimeZone     string   `json:"timeZone,omitempty"` // IANA name, e.g. Europe/Athens
+	// Email maps mail kinds, see defaultEmailSubjects, to whether the user
+	// wants them; kinds not listed are mailed as before
+	Email map[string]bool `json:"email,omitempty"`
+	// UI holds the frontend's own settings, as it sees fit
+	UI        map[string]interface{} `json:"ui,omitempty"`
+	UpdatedAt string                 `json:"updatedAt,omitempty"`
+}
+
+// preferencesFile is preferences.json, maintained by the server only
+type preferencesFile struct {
+	Users map[string]UserPreferences `json:"users"`
+}
+
+// preferencesMu serializes the read-modify-write of preferences.json
+var preferencesMu sync.Mutex
+
+// loadPreferences reads preferences.json
+func loadPreferences() (preferencesFile, error) {
+	prefs := preferencesFile{Users: map[string]UserPreferences{}}
+	err := readDataFile("preferences.json", &prefs)
+	if prefs.Users == nil {
+		prefs.Users = map[string]UserPreferences{}
+	}
+	return prefs, err
+}
+
+// user returns a user's preferences; usernames are matched regardless of
+// case, as accounts are
+func (f preferencesFile) user(username string) UserPreferences {
+	for name, p := range f.Users {
+		if strings.EqualFold(name, username) {
+			return p
+		}
+	}
+	return UserPreferences{}
+}
+
+// validatePreferences checks preferences against the environments and mail
+// kinds
+func validatePreferences(p UserPreferences) error {
+	if len(p.Environments) > 0 {
+		envs, err := loadEnvironments()
+		if err != nil {
+			return err
+		}
+		for _, name := range p.Environments {
+			if _, ok := envs.environment(name); !ok {
+				return fmt.Errorf("unknown environment %q", name)
+			}
+		}
+	}
+	if p.TimeZone != "" {
+		if _, err := time.LoadLocation(p.TimeZone); err != nil {
+			return fmt.Errorf("unknown time zone %q", p.TimeZone)
+		}
+	}
+	for kind := range p.Email {
+		if _, ok := defaultEmailSubjects[kind]; !ok {
+			return fmt.Errorf("unknown email kind %q", kind)
+		}
+	}
+	return nil
+}
+
+// withoutOptedOut drops from mail recipients the people who don't want a
+// kind of mail: their person IDs, and them from the teams listed, which are
+// expanded to their members. People match accounts by username.
+func withoutOptedOut(team TeamData, refs []string, kind string) []string {
+	prefs, err := loadPreferences()
+	if err != nil || len(prefs.Users) == 0 {
+		return refs
+	}
+	out := func(id string) bool {
+		wants, set := prefs.user(id).Email[kind]
+		return set && !wants
+	}
+	var result []string
+	for _, ref := range refs {
+		if _, ok := team.person(ref); ok || strings.Contains(ref, "@") {
+			if !out(ref) {
+				result = append(result, ref)
+			}
+			continue
+		}
+		members := team.members(ref)
+		kept := []string{}
+		for _, id := range members {
+			if !out(id) {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == len(members) {
+			result = append(result, ref)
+		} else {
+			result = append(result, kept...)
+		}
+	}
+	return result
+}
+
+// Handle the current user's preferences: GET returns them, PUT replaces
+// them
+func handleMyPreferences(w http.ResponseWriter, r *http.Request) {
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, "Login required", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		prefs, err := loadPreferences()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading preferences: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(prefs.user(user))
+
+	case http.MethodPut:
+		var p UserPreferences
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validatePreferences(p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+		preferencesMu.Lock()
+		defer preferencesMu.Unlock()
+		prefs, err := loadPreferences()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error reading preferences: %v", err), http.StatusInternalServerError)
+			return
+		}
+		for name := range prefs.Users {
+			if strings.EqualFold(name, user) {
+				delete(prefs.Users, name)
+			}
+		}
+		prefs.Users[user] = p
+		path := filepath.Join(dataDir, "preferences.json")
+		before, _ := os.ReadFile(path)
+		data, err := json.MarshalIndent(prefs, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path, data, 0644)
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Error saving preferences: %v", err), http.StatusInternalServerError)
+			return
+		}
+		auditWrite(user, auditUpdate, "preferences.json", user, before, data)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
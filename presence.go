@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// presenceTTL is how long a heartbeat keeps a user present; clients beat
+// well within it, every 20 seconds
+const presenceTTL = time.Minute
+
+// presence is a user editing a data file, or one of its records
+type presence struct {
+	User   string `json:"user"`
+	File   string `json:"file"`
+	Record string `json:"record,omitempty"` // e.g. a release id; the whole file when empty
+	Since  string `json:"since"`
+	Seen   string `json:"seen"`
+
+	seen time.Time
+}
+
+// presenceKey identifies a presence
+type presenceKey struct{ user, file, record string }
+
+// editors are the users editing, by what they edit
+var editors = struct {
+	sync.Mutex
+	m map[presenceKey]*presence
+}{m: map[presenceKey]*presence{}}
+
+// overlaps reports whether two presences are on the same thing: the same
+// record, or the same file when either is on all of it
+func (p *presence) overlaps(file, record string) bool {
+	return p.File == file && (record == "" || p.Record == "" || p.Record == record)
+}
+
+// presentEditors lists those editing a file, or a record of it when given,
+// other than a user; expired heartbeats are dropped along the way
+func presentEditors(file, record, except string) []presence {
+	editors.Lock()
+	defer editors.Unlock()
+	now := time.Now()
+	list := []presence{}
+	for key, p := range editors.m {
+		if now.Sub(p.seen) > presenceTTL {
+			delete(editors.m, key)
+			continue
+		}
+		if (file == "" || p.overlaps(file, record)) && p.User != except {
+			list = append(list, *p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].File != list[j].File {
+			return list[i].File < list[j].File
+		}
+		if list[i].Record != list[j].Record {
+			return list[i].Record < list[j].Record
+		}
+		return list[i].User < list[j].User
+	})
+	return list
+}
+
+// presenceRequest is the body of POST and DELETE /api/presence
+type presenceRequest struct {
+	File   string `json:"file"`
+	Record string `json:"record,omitempty"`
+}
+
+// Handle editing presence: GET lists who is editing, of ?file= and
+// ?record= when given; POST is a signed-in user's heartbeat while editing a
+// file or record, answered with the others editing it; DELETE is them
+// leaving
+func handlePresence(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(presentEditors(query.Get("file"), query.Get("record"), ""))
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user := requestUser(r)
+	if user == "" {
+		http.Error(w, "Presence is shared by signed-in users only", http.StatusUnauthorized)
+		return
+	}
+	var req presenceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.File, req.Record = strings.TrimSpace(req.File), strings.TrimSpace(req.Record)
+	if !sharedFile(req.File) {
+		http.Error(w, "Unknown 'file'", http.StatusBadRequest)
+		return
+	}
+	key := presenceKey{user, req.File, req.Record}
+
+	editors.Lock()
+	if r.Method == http.MethodDelete {
+		delete(editors.m, key)
+		editors.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	now := time.Now()
+	p, ok := editors.m[key]
+	if !ok {
+		p = &presence{User: user, File: req.File, Record: req.Record, Since: now.UTC().Format(time.RFC3339)}
+		editors.m[key] = p
+	}
+	p.seen, p.Seen = now, now.UTC().Format(time.RFC3339)
+	editors.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(presentEditors(req.File, req.Record, user))
+}
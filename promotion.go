@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// Lead time used when a pipeline stage doesn't declare one
+const defaultLeadDays = 1
+
+// Fields copied from a release to its promoted follow-up
+var promotedReleaseFields = []string{"feTag", "beTag", "releaseName", "jiraTicket", "tickets", "ticketProvider", "startTime", "labels", "note"}
+
+// validatePipeline checks the optional promotion pipeline of environments.json
+func validatePipeline(pipelineValue, envsValue interface{}) error {
+	var stages []PipelineStage
+	if err := decodeInto(pipelineValue, &stages); err != nil {
+		return fmt.Errorf("pipeline must be an array of {environment, leadDays} stages")
+	}
+	var envs []Environment
+	decodeInto(envsValue, &envs)
+	known := map[string]bool{}
+	for _, env := range envs {
+		known[env.Name] = true
+	}
+
+	seen := map[string]bool{}
+	for _, stage := range stages {
+		if !known[stage.Environment] {
+			return fmt.Errorf("pipeline: unknown environment %q", stage.Environment)
+		}
+		if seen[stage.Environment] {
+			return fmt.Errorf("pipeline: environment %q appears twice", stage.Environment)
+		}
+		if stage.LeadDays < 0 {
+			return fmt.Errorf("pipeline: leadDays of %s must not be negative", stage.Environment)
+		}
+		seen[stage.Environment] = true
+	}
+	return nil
+}
+
+// nextStage returns the pipeline stage following an environment
+func (d EnvironmentsData) nextStage(env string) (PipelineStage, bool) {
+	for i, stage := range d.Pipeline {
+		if stage.Environment == env && i+1 < len(d.Pipeline) {
+			return d.Pipeline[i+1], true
+		}
+	}
+	return PipelineStage{}, false
+}
+
+// findReleaseEntry returns the generic release entry with the given ID
+func findReleaseEntry(doc map[string]interface{}, id string) (map[string]interface{}, bool) {
+	env, date, ok := parseReleaseID(id)
+	if !ok {
+		return nil, false
+	}
+	entry, ok := entriesByDate(doc[env])[date]
+	return entry, ok
+}
+
+// promoteRequest is the optional body of POST /api/releases/{id}/promote
+type promoteRequest struct {
+	Date string `json:"date"`
+}
+
+// Handle promotion of a release to the next environment of the pipeline
+func handleReleasePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.PathValue("id")
+
+	var req promoteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		http.Error(w, "Error reading holidays", http.StatusInternalServerError)
+		return
+	}
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	source, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+	env, date, _ := parseReleaseID(id)
+	stage, ok := envs.nextStage(env)
+	if !ok {
+		http.Error(w, fmt.Sprintf("No pipeline stage follows %s", env), http.StatusConflict)
+		return
+	}
+
+	// Default target: lead days later, moved forward to the next deployment window
+	target := req.Date
+	if target == "" {
+		lead := stage.LeadDays
+		if lead == 0 {
+			lead = defaultLeadDays
+		}
+		day, _ := time.ParseInLocation(dateLayout, date, time.Local)
+		day = day.AddDate(0, 0, lead)
+		hset := holidaySet(holidays)
+		for !isDeploymentWindow(day, hset) {
+			day = day.AddDate(0, 0, 1)
+		}
+		target = day.Format(dateLayout)
+	} else if _, err := time.Parse(dateLayout, target); err != nil {
+		http.Error(w, "Invalid 'date', expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if target < date {
+		http.Error(w, "Promoted release cannot be scheduled before its source", http.StatusBadRequest)
+		return
+	}
+
+	if err := authorizeEnvironments(r, stage.Environment); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	if _, exists := entriesByDate(doc[stage.Environment])[target]; exists {
+		http.Error(w, fmt.Sprintf("%s already has a release on %s", stage.Environment, target), http.StatusConflict)
+		return
+	}
+
+	promoted := map[string]interface{}{
+		"date":      target,
+		"status":    "Planned",
+		"dependsOn": id,
+	}
+	if status, _ := source["status"].(string); status == "Hotfix Planned" || status == "Hotfix Done" {
+		promoted["status"] = "Hotfix Planned"
+	}
+	for _, field := range promotedReleaseFields {
+		if v, ok := source[field]; ok {
+			promoted[field] = v
+		}
+	}
+
+	list, _ := doc[stage.Environment].([]interface{})
+	doc[stage.Environment] = append(list, promoted)
+
+	newETag, err := writeJSONFile(r.Context(), filepath.Join(dataDir, "releases.json"), doc, etag, maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", newETag)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":          releaseID(stage.Environment, target),
+		"environment": stage.Environment,
+		"release":     promoted,
+	})
+}
@@ -0,0 +1,1356 @@
+// gRPC API of the release planner, served on the address of
+// grpc-config.json. Generate the Go types in proto/relplanner/v1 with
+//
+//	go generate ./...
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: proto/relplanner/v1/relplanner.proto
+
+package relplannerv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	fieldmaskpb "google.golang.org/protobuf/types/known/fieldmaskpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Release is a release of releases.json. Fields the server maintains, such
+// as completed_at and modified_by, are ignored on create and update.
+type Release struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // environment:date
+	Environment    string                 `protobuf:"bytes,2,opt,name=environment,proto3" json:"environment,omitempty"`
+	Date           string                 `protobuf:"bytes,3,opt,name=date,proto3" json:"date,omitempty"` // YYYY-MM-DD
+	Status         string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	ReleaseName    string                 `protobuf:"bytes,5,opt,name=release_name,json=releaseName,proto3" json:"release_name,omitempty"`
+	FeTag          string                 `protobuf:"bytes,6,opt,name=fe_tag,json=feTag,proto3" json:"fe_tag,omitempty"`
+	BeTag          string                 `protobuf:"bytes,7,opt,name=be_tag,json=beTag,proto3" json:"be_tag,omitempty"`
+	JiraTicket     string                 `protobuf:"bytes,8,opt,name=jira_ticket,json=jiraTicket,proto3" json:"jira_ticket,omitempty"`
+	StartTime      string                 `protobuf:"bytes,9,opt,name=start_time,json=startTime,proto3" json:"start_time,omitempty"`          // HH:MM
+	EndDateTime    string                 `protobuf:"bytes,10,opt,name=end_date_time,json=endDateTime,proto3" json:"end_date_time,omitempty"` // YYYY-MM-DDTHH:MM
+	Note           string                 `protobuf:"bytes,11,opt,name=note,proto3" json:"note,omitempty"`
+	DependsOn      string                 `protobuf:"bytes,12,opt,name=depends_on,json=dependsOn,proto3" json:"depends_on,omitempty"` // id of another release
+	Labels         []string               `protobuf:"bytes,13,rep,name=labels,proto3" json:"labels,omitempty"`
+	Risk           string                 `protobuf:"bytes,14,opt,name=risk,proto3" json:"risk,omitempty"` // critical, high, medium or low
+	Tickets        []string               `protobuf:"bytes,15,rep,name=tickets,proto3" json:"tickets,omitempty"`
+	TicketProvider string                 `protobuf:"bytes,16,opt,name=ticket_provider,json=ticketProvider,proto3" json:"ticket_provider,omitempty"`
+	ReleaseManager string                 `protobuf:"bytes,17,opt,name=release_manager,json=releaseManager,proto3" json:"release_manager,omitempty"`
+	Deployers      []string               `protobuf:"bytes,18,rep,name=deployers,proto3" json:"deployers,omitempty"`
+	OriginalDate   string                 `protobuf:"bytes,19,opt,name=original_date,json=originalDate,proto3" json:"original_date,omitempty"`
+	CompletedAt    string                 `protobuf:"bytes,20,opt,name=completed_at,json=completedAt,proto3" json:"completed_at,omitempty"`
+	ModifiedBy     string                 `protobuf:"bytes,21,opt,name=modified_by,json=modifiedBy,proto3" json:"modified_by,omitempty"`
+	ModifiedAt     string                 `protobuf:"bytes,22,opt,name=modified_at,json=modifiedAt,proto3" json:"modified_at,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Release) Reset() {
+	*x = Release{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Release) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Release) ProtoMessage() {}
+
+func (x *Release) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Release.ProtoReflect.Descriptor instead.
+func (*Release) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Release) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Release) GetEnvironment() string {
+	if x != nil {
+		return x.Environment
+	}
+	return ""
+}
+
+func (x *Release) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *Release) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *Release) GetReleaseName() string {
+	if x != nil {
+		return x.ReleaseName
+	}
+	return ""
+}
+
+func (x *Release) GetFeTag() string {
+	if x != nil {
+		return x.FeTag
+	}
+	return ""
+}
+
+func (x *Release) GetBeTag() string {
+	if x != nil {
+		return x.BeTag
+	}
+	return ""
+}
+
+func (x *Release) GetJiraTicket() string {
+	if x != nil {
+		return x.JiraTicket
+	}
+	return ""
+}
+
+func (x *Release) GetStartTime() string {
+	if x != nil {
+		return x.StartTime
+	}
+	return ""
+}
+
+func (x *Release) GetEndDateTime() string {
+	if x != nil {
+		return x.EndDateTime
+	}
+	return ""
+}
+
+func (x *Release) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+func (x *Release) GetDependsOn() string {
+	if x != nil {
+		return x.DependsOn
+	}
+	return ""
+}
+
+func (x *Release) GetLabels() []string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *Release) GetRisk() string {
+	if x != nil {
+		return x.Risk
+	}
+	return ""
+}
+
+func (x *Release) GetTickets() []string {
+	if x != nil {
+		return x.Tickets
+	}
+	return nil
+}
+
+func (x *Release) GetTicketProvider() string {
+	if x != nil {
+		return x.TicketProvider
+	}
+	return ""
+}
+
+func (x *Release) GetReleaseManager() string {
+	if x != nil {
+		return x.ReleaseManager
+	}
+	return ""
+}
+
+func (x *Release) GetDeployers() []string {
+	if x != nil {
+		return x.Deployers
+	}
+	return nil
+}
+
+func (x *Release) GetOriginalDate() string {
+	if x != nil {
+		return x.OriginalDate
+	}
+	return ""
+}
+
+func (x *Release) GetCompletedAt() string {
+	if x != nil {
+		return x.CompletedAt
+	}
+	return ""
+}
+
+func (x *Release) GetModifiedBy() string {
+	if x != nil {
+		return x.ModifiedBy
+	}
+	return ""
+}
+
+func (x *Release) GetModifiedAt() string {
+	if x != nil {
+		return x.ModifiedAt
+	}
+	return ""
+}
+
+type Environment struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	DisplayName   string                 `protobuf:"bytes,2,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	Visible       bool                   `protobuf:"varint,3,opt,name=visible,proto3" json:"visible,omitempty"`
+	Owner         string                 `protobuf:"bytes,4,opt,name=owner,proto3" json:"owner,omitempty"`
+	Description   string                 `protobuf:"bytes,5,opt,name=description,proto3" json:"description,omitempty"`
+	Url           string                 `protobuf:"bytes,6,opt,name=url,proto3" json:"url,omitempty"`
+	Tier          string                 `protobuf:"bytes,7,opt,name=tier,proto3" json:"tier,omitempty"`
+	Groups        []string               `protobuf:"bytes,8,rep,name=groups,proto3" json:"groups,omitempty"`
+	Lock          *EnvironmentLock       `protobuf:"bytes,9,opt,name=lock,proto3" json:"lock,omitempty"` // unset when unlocked
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Environment) Reset() {
+	*x = Environment{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Environment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Environment) ProtoMessage() {}
+
+func (x *Environment) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Environment.ProtoReflect.Descriptor instead.
+func (*Environment) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Environment) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Environment) GetDisplayName() string {
+	if x != nil {
+		return x.DisplayName
+	}
+	return ""
+}
+
+func (x *Environment) GetVisible() bool {
+	if x != nil {
+		return x.Visible
+	}
+	return false
+}
+
+func (x *Environment) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Environment) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *Environment) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Environment) GetTier() string {
+	if x != nil {
+		return x.Tier
+	}
+	return ""
+}
+
+func (x *Environment) GetGroups() []string {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *Environment) GetLock() *EnvironmentLock {
+	if x != nil {
+		return x.Lock
+	}
+	return nil
+}
+
+type EnvironmentLock struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Reason        string                 `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`
+	Maintenance   bool                   `protobuf:"varint,2,opt,name=maintenance,proto3" json:"maintenance,omitempty"`
+	LockedAt      string                 `protobuf:"bytes,3,opt,name=locked_at,json=lockedAt,proto3" json:"locked_at,omitempty"`
+	Until         string                 `protobuf:"bytes,4,opt,name=until,proto3" json:"until,omitempty"` // empty until unlocked
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnvironmentLock) Reset() {
+	*x = EnvironmentLock{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnvironmentLock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnvironmentLock) ProtoMessage() {}
+
+func (x *EnvironmentLock) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnvironmentLock.ProtoReflect.Descriptor instead.
+func (*EnvironmentLock) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EnvironmentLock) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *EnvironmentLock) GetMaintenance() bool {
+	if x != nil {
+		return x.Maintenance
+	}
+	return false
+}
+
+func (x *EnvironmentLock) GetLockedAt() string {
+	if x != nil {
+		return x.LockedAt
+	}
+	return ""
+}
+
+func (x *EnvironmentLock) GetUntil() string {
+	if x != nil {
+		return x.Until
+	}
+	return ""
+}
+
+type Holiday struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Date          string                 `protobuf:"bytes,1,opt,name=date,proto3" json:"date,omitempty"`
+	Name          string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Holiday) Reset() {
+	*x = Holiday{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Holiday) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Holiday) ProtoMessage() {}
+
+func (x *Holiday) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Holiday.ProtoReflect.Descriptor instead.
+func (*Holiday) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Holiday) GetDate() string {
+	if x != nil {
+		return x.Date
+	}
+	return ""
+}
+
+func (x *Holiday) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+// Freeze blocks new releases on the environments of a group.
+type Freeze struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Group         string                 `protobuf:"bytes,1,opt,name=group,proto3" json:"group,omitempty"`
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	Reason        string                 `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Freeze) Reset() {
+	*x = Freeze{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Freeze) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Freeze) ProtoMessage() {}
+
+func (x *Freeze) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Freeze.ProtoReflect.Descriptor instead.
+func (*Freeze) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Freeze) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Freeze) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Freeze) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Freeze) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type GetPlanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"` // today when empty
+	To            string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`     // 90 days after from when empty
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPlanRequest) Reset() {
+	*x = GetPlanRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPlanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPlanRequest) ProtoMessage() {}
+
+func (x *GetPlanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPlanRequest.ProtoReflect.Descriptor instead.
+func (*GetPlanRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetPlanRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *GetPlanRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+type Plan struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	From          string                 `protobuf:"bytes,1,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,2,opt,name=to,proto3" json:"to,omitempty"`
+	Environments  []*Environment         `protobuf:"bytes,3,rep,name=environments,proto3" json:"environments,omitempty"`
+	Releases      []*Release             `protobuf:"bytes,4,rep,name=releases,proto3" json:"releases,omitempty"`
+	Holidays      []*Holiday             `protobuf:"bytes,5,rep,name=holidays,proto3" json:"holidays,omitempty"`
+	Freezes       []*Freeze              `protobuf:"bytes,6,rep,name=freezes,proto3" json:"freezes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Plan) Reset() {
+	*x = Plan{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Plan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Plan) ProtoMessage() {}
+
+func (x *Plan) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Plan.ProtoReflect.Descriptor instead.
+func (*Plan) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Plan) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Plan) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Plan) GetEnvironments() []*Environment {
+	if x != nil {
+		return x.Environments
+	}
+	return nil
+}
+
+func (x *Plan) GetReleases() []*Release {
+	if x != nil {
+		return x.Releases
+	}
+	return nil
+}
+
+func (x *Plan) GetHolidays() []*Holiday {
+	if x != nil {
+		return x.Holidays
+	}
+	return nil
+}
+
+func (x *Plan) GetFreezes() []*Freeze {
+	if x != nil {
+		return x.Freezes
+	}
+	return nil
+}
+
+type ListReleasesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Environments  []string               `protobuf:"bytes,1,rep,name=environments,proto3" json:"environments,omitempty"` // all when empty
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            string                 `protobuf:"bytes,3,opt,name=to,proto3" json:"to,omitempty"`
+	Status        string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
+	Label         string                 `protobuf:"bytes,5,opt,name=label,proto3" json:"label,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReleasesRequest) Reset() {
+	*x = ListReleasesRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReleasesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReleasesRequest) ProtoMessage() {}
+
+func (x *ListReleasesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReleasesRequest.ProtoReflect.Descriptor instead.
+func (*ListReleasesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListReleasesRequest) GetEnvironments() []string {
+	if x != nil {
+		return x.Environments
+	}
+	return nil
+}
+
+func (x *ListReleasesRequest) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *ListReleasesRequest) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *ListReleasesRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *ListReleasesRequest) GetLabel() string {
+	if x != nil {
+		return x.Label
+	}
+	return ""
+}
+
+type ListReleasesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Releases      []*Release             `protobuf:"bytes,1,rep,name=releases,proto3" json:"releases,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListReleasesResponse) Reset() {
+	*x = ListReleasesResponse{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListReleasesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListReleasesResponse) ProtoMessage() {}
+
+func (x *ListReleasesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListReleasesResponse.ProtoReflect.Descriptor instead.
+func (*ListReleasesResponse) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListReleasesResponse) GetReleases() []*Release {
+	if x != nil {
+		return x.Releases
+	}
+	return nil
+}
+
+type GetReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetReleaseRequest) Reset() {
+	*x = GetReleaseRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetReleaseRequest) ProtoMessage() {}
+
+func (x *GetReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetReleaseRequest.ProtoReflect.Descriptor instead.
+func (*GetReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetReleaseRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CreateReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Release       *Release               `protobuf:"bytes,1,opt,name=release,proto3" json:"release,omitempty"` // environment and date are required
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CreateReleaseRequest) Reset() {
+	*x = CreateReleaseRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CreateReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateReleaseRequest) ProtoMessage() {}
+
+func (x *CreateReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateReleaseRequest.ProtoReflect.Descriptor instead.
+func (*CreateReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CreateReleaseRequest) GetRelease() *Release {
+	if x != nil {
+		return x.Release
+	}
+	return nil
+}
+
+type UpdateReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Release       *Release               `protobuf:"bytes,2,opt,name=release,proto3" json:"release,omitempty"`
+	UpdateMask    *fieldmaskpb.FieldMask `protobuf:"bytes,3,opt,name=update_mask,json=updateMask,proto3" json:"update_mask,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdateReleaseRequest) Reset() {
+	*x = UpdateReleaseRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdateReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdateReleaseRequest) ProtoMessage() {}
+
+func (x *UpdateReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdateReleaseRequest.ProtoReflect.Descriptor instead.
+func (*UpdateReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UpdateReleaseRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *UpdateReleaseRequest) GetRelease() *Release {
+	if x != nil {
+		return x.Release
+	}
+	return nil
+}
+
+func (x *UpdateReleaseRequest) GetUpdateMask() *fieldmaskpb.FieldMask {
+	if x != nil {
+		return x.UpdateMask
+	}
+	return nil
+}
+
+type DeleteReleaseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteReleaseRequest) Reset() {
+	*x = DeleteReleaseRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteReleaseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteReleaseRequest) ProtoMessage() {}
+
+func (x *DeleteReleaseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteReleaseRequest.ProtoReflect.Descriptor instead.
+func (*DeleteReleaseRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DeleteReleaseRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteReleaseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteReleaseResponse) Reset() {
+	*x = DeleteReleaseResponse{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteReleaseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteReleaseResponse) ProtoMessage() {}
+
+func (x *DeleteReleaseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteReleaseResponse.ProtoReflect.Descriptor instead.
+func (*DeleteReleaseResponse) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{13}
+}
+
+type WatchChangesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Environments  []string               `protobuf:"bytes,1,rep,name=environments,proto3" json:"environments,omitempty"`                      // release events of these only; all when empty
+	ReleasesOnly  bool                   `protobuf:"varint,2,opt,name=releases_only,json=releasesOnly,proto3" json:"releases_only,omitempty"` // leave out data file changes
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchChangesRequest) Reset() {
+	*x = WatchChangesRequest{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchChangesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchChangesRequest) ProtoMessage() {}
+
+func (x *WatchChangesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchChangesRequest.ProtoReflect.Descriptor instead.
+func (*WatchChangesRequest) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *WatchChangesRequest) GetEnvironments() []string {
+	if x != nil {
+		return x.Environments
+	}
+	return nil
+}
+
+func (x *WatchChangesRequest) GetReleasesOnly() bool {
+	if x != nil {
+		return x.ReleasesOnly
+	}
+	return false
+}
+
+// Change is a data file saved, or a release event such as created, moved,
+// approved or cancelled.
+type Change struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Type           string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"` // "file" or the release event type
+	At             string                 `protobuf:"bytes,2,opt,name=at,proto3" json:"at,omitempty"`     // RFC 3339
+	File           string                 `protobuf:"bytes,3,opt,name=file,proto3" json:"file,omitempty"` // the data file saved, e.g. releases.json
+	Release        *Release               `protobuf:"bytes,4,opt,name=release,proto3" json:"release,omitempty"`
+	PreviousDate   string                 `protobuf:"bytes,5,opt,name=previous_date,json=previousDate,proto3" json:"previous_date,omitempty"`       // moved
+	PreviousStatus string                 `protobuf:"bytes,6,opt,name=previous_status,json=previousStatus,proto3" json:"previous_status,omitempty"` // approved or cancelled
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Change) Reset() {
+	*x = Change{}
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Change) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Change) ProtoMessage() {}
+
+func (x *Change) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_relplanner_v1_relplanner_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Change.ProtoReflect.Descriptor instead.
+func (*Change) Descriptor() ([]byte, []int) {
+	return file_proto_relplanner_v1_relplanner_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Change) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Change) GetAt() string {
+	if x != nil {
+		return x.At
+	}
+	return ""
+}
+
+func (x *Change) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *Change) GetRelease() *Release {
+	if x != nil {
+		return x.Release
+	}
+	return nil
+}
+
+func (x *Change) GetPreviousDate() string {
+	if x != nil {
+		return x.PreviousDate
+	}
+	return ""
+}
+
+func (x *Change) GetPreviousStatus() string {
+	if x != nil {
+		return x.PreviousStatus
+	}
+	return ""
+}
+
+var File_proto_relplanner_v1_relplanner_proto protoreflect.FileDescriptor
+
+const file_proto_relplanner_v1_relplanner_proto_rawDesc = "" +
+	"\n" +
+	"$proto/relplanner/v1/relplanner.proto\x12\rrelplanner.v1\x1a google/protobuf/field_mask.proto\"\x8f\x05\n" +
+	"\aRelease\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12 \n" +
+	"\venvironment\x18\x02 \x01(\tR\venvironment\x12\x12\n" +
+	"\x04date\x18\x03 \x01(\tR\x04date\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12!\n" +
+	"\frelease_name\x18\x05 \x01(\tR\vreleaseName\x12\x15\n" +
+	"\x06fe_tag\x18\x06 \x01(\tR\x05feTag\x12\x15\n" +
+	"\x06be_tag\x18\a \x01(\tR\x05beTag\x12\x1f\n" +
+	"\vjira_ticket\x18\b \x01(\tR\n" +
+	"jiraTicket\x12\x1d\n" +
+	"\n" +
+	"start_time\x18\t \x01(\tR\tstartTime\x12\"\n" +
+	"\rend_date_time\x18\n" +
+	" \x01(\tR\vendDateTime\x12\x12\n" +
+	"\x04note\x18\v \x01(\tR\x04note\x12\x1d\n" +
+	"\n" +
+	"depends_on\x18\f \x01(\tR\tdependsOn\x12\x16\n" +
+	"\x06labels\x18\r \x03(\tR\x06labels\x12\x12\n" +
+	"\x04risk\x18\x0e \x01(\tR\x04risk\x12\x18\n" +
+	"\atickets\x18\x0f \x03(\tR\atickets\x12'\n" +
+	"\x0fticket_provider\x18\x10 \x01(\tR\x0eticketProvider\x12'\n" +
+	"\x0frelease_manager\x18\x11 \x01(\tR\x0ereleaseManager\x12\x1c\n" +
+	"\tdeployers\x18\x12 \x03(\tR\tdeployers\x12#\n" +
+	"\roriginal_date\x18\x13 \x01(\tR\foriginalDate\x12!\n" +
+	"\fcompleted_at\x18\x14 \x01(\tR\vcompletedAt\x12\x1f\n" +
+	"\vmodified_by\x18\x15 \x01(\tR\n" +
+	"modifiedBy\x12\x1f\n" +
+	"\vmodified_at\x18\x16 \x01(\tR\n" +
+	"modifiedAt\"\x88\x02\n" +
+	"\vEnvironment\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12!\n" +
+	"\fdisplay_name\x18\x02 \x01(\tR\vdisplayName\x12\x18\n" +
+	"\avisible\x18\x03 \x01(\bR\avisible\x12\x14\n" +
+	"\x05owner\x18\x04 \x01(\tR\x05owner\x12 \n" +
+	"\vdescription\x18\x05 \x01(\tR\vdescription\x12\x10\n" +
+	"\x03url\x18\x06 \x01(\tR\x03url\x12\x12\n" +
+	"\x04tier\x18\a \x01(\tR\x04tier\x12\x16\n" +
+	"\x06groups\x18\b \x03(\tR\x06groups\x122\n" +
+	"\x04lock\x18\t \x01(\v2\x1e.relplanner.v1.EnvironmentLockR\x04lock\"~\n" +
+	"\x0fEnvironmentLock\x12\x16\n" +
+	"\x06reason\x18\x01 \x01(\tR\x06reason\x12 \n" +
+	"\vmaintenance\x18\x02 \x01(\bR\vmaintenance\x12\x1b\n" +
+	"\tlocked_at\x18\x03 \x01(\tR\blockedAt\x12\x14\n" +
+	"\x05until\x18\x04 \x01(\tR\x05until\"1\n" +
+	"\aHoliday\x12\x12\n" +
+	"\x04date\x18\x01 \x01(\tR\x04date\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\"Z\n" +
+	"\x06Freeze\x12\x14\n" +
+	"\x05group\x18\x01 \x01(\tR\x05group\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"4\n" +
+	"\x0eGetPlanRequest\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\tR\x02to\"\x83\x02\n" +
+	"\x04Plan\x12\x12\n" +
+	"\x04from\x18\x01 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x02 \x01(\tR\x02to\x12>\n" +
+	"\fenvironments\x18\x03 \x03(\v2\x1a.relplanner.v1.EnvironmentR\fenvironments\x122\n" +
+	"\breleases\x18\x04 \x03(\v2\x16.relplanner.v1.ReleaseR\breleases\x122\n" +
+	"\bholidays\x18\x05 \x03(\v2\x16.relplanner.v1.HolidayR\bholidays\x12/\n" +
+	"\afreezes\x18\x06 \x03(\v2\x15.relplanner.v1.FreezeR\afreezes\"\x8b\x01\n" +
+	"\x13ListReleasesRequest\x12\"\n" +
+	"\fenvironments\x18\x01 \x03(\tR\fenvironments\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\tR\x02to\x12\x16\n" +
+	"\x06status\x18\x04 \x01(\tR\x06status\x12\x14\n" +
+	"\x05label\x18\x05 \x01(\tR\x05label\"J\n" +
+	"\x14ListReleasesResponse\x122\n" +
+	"\breleases\x18\x01 \x03(\v2\x16.relplanner.v1.ReleaseR\breleases\"#\n" +
+	"\x11GetReleaseRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"H\n" +
+	"\x14CreateReleaseRequest\x120\n" +
+	"\arelease\x18\x01 \x01(\v2\x16.relplanner.v1.ReleaseR\arelease\"\x95\x01\n" +
+	"\x14UpdateReleaseRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x120\n" +
+	"\arelease\x18\x02 \x01(\v2\x16.relplanner.v1.ReleaseR\arelease\x12;\n" +
+	"\vupdate_mask\x18\x03 \x01(\v2\x1a.google.protobuf.FieldMaskR\n" +
+	"updateMask\"&\n" +
+	"\x14DeleteReleaseRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"\x17\n" +
+	"\x15DeleteReleaseResponse\"^\n" +
+	"\x13WatchChangesRequest\x12\"\n" +
+	"\fenvironments\x18\x01 \x03(\tR\fenvironments\x12#\n" +
+	"\rreleases_only\x18\x02 \x01(\bR\freleasesOnly\"\xc0\x01\n" +
+	"\x06Change\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x0e\n" +
+	"\x02at\x18\x02 \x01(\tR\x02at\x12\x12\n" +
+	"\x04file\x18\x03 \x01(\tR\x04file\x120\n" +
+	"\arelease\x18\x04 \x01(\v2\x16.relplanner.v1.ReleaseR\arelease\x12#\n" +
+	"\rprevious_date\x18\x05 \x01(\tR\fpreviousDate\x12'\n" +
+	"\x0fprevious_status\x18\x06 \x01(\tR\x0epreviousStatus2\xb5\x04\n" +
+	"\x0eReleasePlanner\x12=\n" +
+	"\aGetPlan\x12\x1d.relplanner.v1.GetPlanRequest\x1a\x13.relplanner.v1.Plan\x12W\n" +
+	"\fListReleases\x12\".relplanner.v1.ListReleasesRequest\x1a#.relplanner.v1.ListReleasesResponse\x12F\n" +
+	"\n" +
+	"GetRelease\x12 .relplanner.v1.GetReleaseRequest\x1a\x16.relplanner.v1.Release\x12L\n" +
+	"\rCreateRelease\x12#.relplanner.v1.CreateReleaseRequest\x1a\x16.relplanner.v1.Release\x12L\n" +
+	"\rUpdateRelease\x12#.relplanner.v1.UpdateReleaseRequest\x1a\x16.relplanner.v1.Release\x12Z\n" +
+	"\rDeleteRelease\x12#.relplanner.v1.DeleteReleaseRequest\x1a$.relplanner.v1.DeleteReleaseResponse\x12K\n" +
+	"\fWatchChanges\x12\".relplanner.v1.WatchChangesRequest\x1a\x15.relplanner.v1.Change0\x01B*Z(timeoff/proto/relplanner/v1;relplannerv1b\x06proto3"
+
+var (
+	file_proto_relplanner_v1_relplanner_proto_rawDescOnce sync.Once
+	file_proto_relplanner_v1_relplanner_proto_rawDescData []byte
+)
+
+func file_proto_relplanner_v1_relplanner_proto_rawDescGZIP() []byte {
+	file_proto_relplanner_v1_relplanner_proto_rawDescOnce.Do(func() {
+		file_proto_relplanner_v1_relplanner_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_relplanner_v1_relplanner_proto_rawDesc), len(file_proto_relplanner_v1_relplanner_proto_rawDesc)))
+	})
+	return file_proto_relplanner_v1_relplanner_proto_rawDescData
+}
+
+var file_proto_relplanner_v1_relplanner_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_proto_relplanner_v1_relplanner_proto_goTypes = []any{
+	(*Release)(nil),               // 0: relplanner.v1.Release
+	(*Environment)(nil),           // 1: relplanner.v1.Environment
+	(*EnvironmentLock)(nil),       // 2: relplanner.v1.EnvironmentLock
+	(*Holiday)(nil),               // 3: relplanner.v1.Holiday
+	(*Freeze)(nil),                // 4: relplanner.v1.Freeze
+	(*GetPlanRequest)(nil),        // 5: relplanner.v1.GetPlanRequest
+	(*Plan)(nil),                  // 6: relplanner.v1.Plan
+	(*ListReleasesRequest)(nil),   // 7: relplanner.v1.ListReleasesRequest
+	(*ListReleasesResponse)(nil),  // 8: relplanner.v1.ListReleasesResponse
+	(*GetReleaseRequest)(nil),     // 9: relplanner.v1.GetReleaseRequest
+	(*CreateReleaseRequest)(nil),  // 10: relplanner.v1.CreateReleaseRequest
+	(*UpdateReleaseRequest)(nil),  // 11: relplanner.v1.UpdateReleaseRequest
+	(*DeleteReleaseRequest)(nil),  // 12: relplanner.v1.DeleteReleaseRequest
+	(*DeleteReleaseResponse)(nil), // 13: relplanner.v1.DeleteReleaseResponse
+	(*WatchChangesRequest)(nil),   // 14: relplanner.v1.WatchChangesRequest
+	(*Change)(nil),                // 15: relplanner.v1.Change
+	(*fieldmaskpb.FieldMask)(nil), // 16: google.protobuf.FieldMask
+}
+var file_proto_relplanner_v1_relplanner_proto_depIdxs = []int32{
+	2,  // 0: relplanner.v1.Environment.lock:type_name -> relplanner.v1.EnvironmentLock
+	1,  // 1: relplanner.v1.Plan.environments:type_name -> relplanner.v1.Environment
+	0,  // 2: relplanner.v1.Plan.releases:type_name -> relplanner.v1.Release
+	3,  // 3: relplanner.v1.Plan.holidays:type_name -> relplanner.v1.Holiday
+	4,  // 4: relplanner.v1.Plan.freezes:type_name -> relplanner.v1.Freeze
+	0,  // 5: relplanner.v1.ListReleasesResponse.releases:type_name -> relplanner.v1.Release
+	0,  // 6: relplanner.v1.CreateReleaseRequest.release:type_name -> relplanner.v1.Release
+	0,  // 7: relplanner.v1.UpdateReleaseRequest.release:type_name -> relplanner.v1.Release
+	16, // 8: relplanner.v1.UpdateReleaseRequest.update_mask:type_name -> google.protobuf.FieldMask
+	0,  // 9: relplanner.v1.Change.release:type_name -> relplanner.v1.Release
+	5,  // 10: relplanner.v1.ReleasePlanner.GetPlan:input_type -> relplanner.v1.GetPlanRequest
+	7,  // 11: relplanner.v1.ReleasePlanner.ListReleases:input_type -> relplanner.v1.ListReleasesRequest
+	9,  // 12: relplanner.v1.ReleasePlanner.GetRelease:input_type -> relplanner.v1.GetReleaseRequest
+	10, // 13: relplanner.v1.ReleasePlanner.CreateRelease:input_type -> relplanner.v1.CreateReleaseRequest
+	11, // 14: relplanner.v1.ReleasePlanner.UpdateRelease:input_type -> relplanner.v1.UpdateReleaseRequest
+	12, // 15: relplanner.v1.ReleasePlanner.DeleteRelease:input_type -> relplanner.v1.DeleteReleaseRequest
+	14, // 16: relplanner.v1.ReleasePlanner.WatchChanges:input_type -> relplanner.v1.WatchChangesRequest
+	6,  // 17: relplanner.v1.ReleasePlanner.GetPlan:output_type -> relplanner.v1.Plan
+	8,  // 18: relplanner.v1.ReleasePlanner.ListReleases:output_type -> relplanner.v1.ListReleasesResponse
+	0,  // 19: relplanner.v1.ReleasePlanner.GetRelease:output_type -> relplanner.v1.Release
+	0,  // 20: relplanner.v1.ReleasePlanner.CreateRelease:output_type -> relplanner.v1.Release
+	0,  // 21: relplanner.v1.ReleasePlanner.UpdateRelease:output_type -> relplanner.v1.Release
+	13, // 22: relplanner.v1.ReleasePlanner.DeleteRelease:output_type -> relplanner.v1.DeleteReleaseResponse
+	15, // 23: relplanner.v1.ReleasePlanner.WatchChanges:output_type -> relplanner.v1.Change
+	17, // [17:24] is the sub-list for method output_type
+	10, // [10:17] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_proto_relplanner_v1_relplanner_proto_init() }
+func file_proto_relplanner_v1_relplanner_proto_init() {
+	if File_proto_relplanner_v1_relplanner_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_relplanner_v1_relplanner_proto_rawDesc), len(file_proto_relplanner_v1_relplanner_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_proto_relplanner_v1_relplanner_proto_goTypes,
+		DependencyIndexes: file_proto_relplanner_v1_relplanner_proto_depIdxs,
+		MessageInfos:      file_proto_relplanner_v1_relplanner_proto_msgTypes,
+	}.Build()
+	File_proto_relplanner_v1_relplanner_proto = out.File
+	file_proto_relplanner_v1_relplanner_proto_goTypes = nil
+	file_proto_relplanner_v1_relplanner_proto_depIdxs = nil
+}
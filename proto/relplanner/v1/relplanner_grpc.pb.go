@@ -0,0 +1,390 @@
+// gRPC API of the release planner, served on the address of
+// grpc-config.json. Generate the Go types in proto/relplanner/v1 with
+//
+//	go generate ./...
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: proto/relplanner/v1/relplanner.proto
+
+package relplannerv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ReleasePlanner_GetPlan_FullMethodName       = "/relplanner.v1.ReleasePlanner/GetPlan"
+	ReleasePlanner_ListReleases_FullMethodName  = "/relplanner.v1.ReleasePlanner/ListReleases"
+	ReleasePlanner_GetRelease_FullMethodName    = "/relplanner.v1.ReleasePlanner/GetRelease"
+	ReleasePlanner_CreateRelease_FullMethodName = "/relplanner.v1.ReleasePlanner/CreateRelease"
+	ReleasePlanner_UpdateRelease_FullMethodName = "/relplanner.v1.ReleasePlanner/UpdateRelease"
+	ReleasePlanner_DeleteRelease_FullMethodName = "/relplanner.v1.ReleasePlanner/DeleteRelease"
+	ReleasePlanner_WatchChanges_FullMethodName  = "/relplanner.v1.ReleasePlanner/WatchChanges"
+)
+
+// ReleasePlannerClient is the client API for ReleasePlanner service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ReleasePlanner reads the plan and changes releases through the same
+// permissions, validation, planning rules and backups as the HTTP API.
+// Calls authenticate with an API key in the authorization metadata,
+// "Bearer <key>", once the server has accounts.
+type ReleasePlannerClient interface {
+	// GetPlan returns the environments with their releases, holidays and
+	// freezes between two dates.
+	GetPlan(ctx context.Context, in *GetPlanRequest, opts ...grpc.CallOption) (*Plan, error)
+	// ListReleases returns releases by date, then environment.
+	ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error)
+	// GetRelease returns a release by its id.
+	GetRelease(ctx context.Context, in *GetReleaseRequest, opts ...grpc.CallOption) (*Release, error)
+	// CreateRelease schedules a release; ALREADY_EXISTS when its environment
+	// has one on that date.
+	CreateRelease(ctx context.Context, in *CreateReleaseRequest, opts ...grpc.CallOption) (*Release, error)
+	// UpdateRelease changes the fields of a release named by update_mask, all
+	// of those clients may set when it is empty. Changing the date moves it.
+	UpdateRelease(ctx context.Context, in *UpdateReleaseRequest, opts ...grpc.CallOption) (*Release, error)
+	// DeleteRelease removes a release.
+	DeleteRelease(ctx context.Context, in *DeleteReleaseRequest, opts ...grpc.CallOption) (*DeleteReleaseResponse, error)
+	// WatchChanges streams changes to the data files and release events as
+	// they happen, until the client cancels.
+	WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error)
+}
+
+type releasePlannerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewReleasePlannerClient(cc grpc.ClientConnInterface) ReleasePlannerClient {
+	return &releasePlannerClient{cc}
+}
+
+func (c *releasePlannerClient) GetPlan(ctx context.Context, in *GetPlanRequest, opts ...grpc.CallOption) (*Plan, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Plan)
+	err := c.cc.Invoke(ctx, ReleasePlanner_GetPlan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) ListReleases(ctx context.Context, in *ListReleasesRequest, opts ...grpc.CallOption) (*ListReleasesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListReleasesResponse)
+	err := c.cc.Invoke(ctx, ReleasePlanner_ListReleases_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) GetRelease(ctx context.Context, in *GetReleaseRequest, opts ...grpc.CallOption) (*Release, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Release)
+	err := c.cc.Invoke(ctx, ReleasePlanner_GetRelease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) CreateRelease(ctx context.Context, in *CreateReleaseRequest, opts ...grpc.CallOption) (*Release, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Release)
+	err := c.cc.Invoke(ctx, ReleasePlanner_CreateRelease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) UpdateRelease(ctx context.Context, in *UpdateReleaseRequest, opts ...grpc.CallOption) (*Release, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Release)
+	err := c.cc.Invoke(ctx, ReleasePlanner_UpdateRelease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) DeleteRelease(ctx context.Context, in *DeleteReleaseRequest, opts ...grpc.CallOption) (*DeleteReleaseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteReleaseResponse)
+	err := c.cc.Invoke(ctx, ReleasePlanner_DeleteRelease_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *releasePlannerClient) WatchChanges(ctx context.Context, in *WatchChangesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Change], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ReleasePlanner_ServiceDesc.Streams[0], ReleasePlanner_WatchChanges_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchChangesRequest, Change]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReleasePlanner_WatchChangesClient = grpc.ServerStreamingClient[Change]
+
+// ReleasePlannerServer is the server API for ReleasePlanner service.
+// All implementations must embed UnimplementedReleasePlannerServer
+// for forward compatibility.
+//
+// ReleasePlanner reads the plan and changes releases through the same
+// permissions, validation, planning rules and backups as the HTTP API.
+// Calls authenticate with an API key in the authorization metadata,
+// "Bearer <key>", once the server has accounts.
+type ReleasePlannerServer interface {
+	// GetPlan returns the environments with their releases, holidays and
+	// freezes between two dates.
+	GetPlan(context.Context, *GetPlanRequest) (*Plan, error)
+	// ListReleases returns releases by date, then environment.
+	ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error)
+	// GetRelease returns a release by its id.
+	GetRelease(context.Context, *GetReleaseRequest) (*Release, error)
+	// CreateRelease schedules a release; ALREADY_EXISTS when its environment
+	// has one on that date.
+	CreateRelease(context.Context, *CreateReleaseRequest) (*Release, error)
+	// UpdateRelease changes the fields of a release named by update_mask, all
+	// of those clients may set when it is empty. Changing the date moves it.
+	UpdateRelease(context.Context, *UpdateReleaseRequest) (*Release, error)
+	// DeleteRelease removes a release.
+	DeleteRelease(context.Context, *DeleteReleaseRequest) (*DeleteReleaseResponse, error)
+	// WatchChanges streams changes to the data files and release events as
+	// they happen, until the client cancels.
+	WatchChanges(*WatchChangesRequest, grpc.ServerStreamingServer[Change]) error
+	mustEmbedUnimplementedReleasePlannerServer()
+}
+
+// UnimplementedReleasePlannerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedReleasePlannerServer struct{}
+
+func (UnimplementedReleasePlannerServer) GetPlan(context.Context, *GetPlanRequest) (*Plan, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetPlan not implemented")
+}
+func (UnimplementedReleasePlannerServer) ListReleases(context.Context, *ListReleasesRequest) (*ListReleasesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListReleases not implemented")
+}
+func (UnimplementedReleasePlannerServer) GetRelease(context.Context, *GetReleaseRequest) (*Release, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetRelease not implemented")
+}
+func (UnimplementedReleasePlannerServer) CreateRelease(context.Context, *CreateReleaseRequest) (*Release, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateRelease not implemented")
+}
+func (UnimplementedReleasePlannerServer) UpdateRelease(context.Context, *UpdateReleaseRequest) (*Release, error) {
+	return nil, status.Error(codes.Unimplemented, "method UpdateRelease not implemented")
+}
+func (UnimplementedReleasePlannerServer) DeleteRelease(context.Context, *DeleteReleaseRequest) (*DeleteReleaseResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteRelease not implemented")
+}
+func (UnimplementedReleasePlannerServer) WatchChanges(*WatchChangesRequest, grpc.ServerStreamingServer[Change]) error {
+	return status.Error(codes.Unimplemented, "method WatchChanges not implemented")
+}
+func (UnimplementedReleasePlannerServer) mustEmbedUnimplementedReleasePlannerServer() {}
+func (UnimplementedReleasePlannerServer) testEmbeddedByValue()                        {}
+
+// UnsafeReleasePlannerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ReleasePlannerServer will
+// result in compilation errors.
+type UnsafeReleasePlannerServer interface {
+	mustEmbedUnimplementedReleasePlannerServer()
+}
+
+func RegisterReleasePlannerServer(s grpc.ServiceRegistrar, srv ReleasePlannerServer) {
+	// If the following call panics, it indicates UnimplementedReleasePlannerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ReleasePlanner_ServiceDesc, srv)
+}
+
+func _ReleasePlanner_GetPlan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPlanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).GetPlan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_GetPlan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).GetPlan(ctx, req.(*GetPlanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_ListReleases_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListReleasesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).ListReleases(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_ListReleases_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).ListReleases(ctx, req.(*ListReleasesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_GetRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).GetRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_GetRelease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).GetRelease(ctx, req.(*GetReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_CreateRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).CreateRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_CreateRelease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).CreateRelease(ctx, req.(*CreateReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_UpdateRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).UpdateRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_UpdateRelease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).UpdateRelease(ctx, req.(*UpdateReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_DeleteRelease_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteReleaseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReleasePlannerServer).DeleteRelease(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ReleasePlanner_DeleteRelease_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReleasePlannerServer).DeleteRelease(ctx, req.(*DeleteReleaseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ReleasePlanner_WatchChanges_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChangesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ReleasePlannerServer).WatchChanges(m, &grpc.GenericServerStream[WatchChangesRequest, Change]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ReleasePlanner_WatchChangesServer = grpc.ServerStreamingServer[Change]
+
+// ReleasePlanner_ServiceDesc is the grpc.ServiceDesc for ReleasePlanner service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ReleasePlanner_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "relplanner.v1.ReleasePlanner",
+	HandlerType: (*ReleasePlannerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetPlan",
+			Handler:    _ReleasePlanner_GetPlan_Handler,
+		},
+		{
+			MethodName: "ListReleases",
+			Handler:    _ReleasePlanner_ListReleases_Handler,
+		},
+		{
+			MethodName: "GetRelease",
+			Handler:    _ReleasePlanner_GetRelease_Handler,
+		},
+		{
+			MethodName: "CreateRelease",
+			Handler:    _ReleasePlanner_CreateRelease_Handler,
+		},
+		{
+			MethodName: "UpdateRelease",
+			Handler:    _ReleasePlanner_UpdateRelease_Handler,
+		},
+		{
+			MethodName: "DeleteRelease",
+			Handler:    _ReleasePlanner_DeleteRelease_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchChanges",
+			Handler:       _ReleasePlanner_WatchChanges_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/relplanner/v1/relplanner.proto",
+}
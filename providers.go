@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// TicketProvider is a tracker the tickets of a release can come from. Each
+// provider lives in its own file, reads its own config file and registers
+// itself from init, so the ticket handlers don't change when one is added.
+type TicketProvider interface {
+	// Search returns the tickets offered for linking. query holds the
+	// parameters of the tickets API, such as a Jira profile or sprint.
+	Search(query url.Values, refresh bool) (jiraTicketsResult, error)
+	// Get returns the tickets of a release: the linked ones with their
+	// details and those the tracker assigns to it, such as a fixVersion.
+	Get(release ReleaseEntry) []map[string]interface{}
+	// Link checks a key about to be linked to a release and returns it in
+	// its canonical form
+	Link(key string) (string, bool)
+}
+
+// ticketProviderInfo describes a registered provider
+type ticketProviderInfo struct {
+	ID         string `json:"id"`   // the ticketProvider value of releases
+	Name       string `json:"name"` // shown in the UI and in errors
+	ConfigFile string `json:"configFile"`
+	KeyFormat  string `json:"keyFormat"` // e.g. owner/repo#number
+	KeyExample string `json:"keyExample"`
+	Configured bool   `json:"configured"`
+	provider   TicketProvider
+}
+
+// defaultTicketProvider serves releases without a ticketProvider
+const defaultTicketProvider = "jira"
+
+// ticketProviders are the registered providers by ID
+var ticketProviders = map[string]ticketProviderInfo{}
+
+// registerTicketProvider makes a provider available to releases and the
+// tickets API; called from init
+func registerTicketProvider(info ticketProviderInfo, p TicketProvider) {
+	if _, dup := ticketProviders[info.ID]; dup {
+		panic("ticket provider registered twice: " + info.ID)
+	}
+	info.provider = p
+	ticketProviders[info.ID] = info
+}
+
+// ticketProviderFor looks a provider up by the ticketProvider of a release
+func ticketProviderFor(id string) (ticketProviderInfo, bool) {
+	if id == "" {
+		id = defaultTicketProvider
+	}
+	info, ok := ticketProviders[id]
+	return info, ok
+}
+
+// lookupTickets returns the keys with their details from a search result,
+// bare (tagged with provider when given) for keys the search didn't return
+func lookupTickets(keys []string, result jiraTicketsResult, provider string) []map[string]interface{} {
+	byKey := map[string]map[string]interface{}{}
+	for _, t := range result.tickets {
+		if k, ok := t["key"].(string); ok {
+			byKey[k] = t
+		}
+	}
+	tickets := []map[string]interface{}{}
+	for _, k := range keys {
+		if t, ok := byKey[k]; ok {
+			tickets = append(tickets, t)
+		} else {
+			bare := map[string]interface{}{"key": k}
+			if provider != "" {
+				bare["provider"] = provider
+			}
+			tickets = append(tickets, bare)
+		}
+	}
+	return tickets
+}
+
+// appendNewTickets appends the tickets whose key isn't listed yet
+func appendNewTickets(tickets, more []map[string]interface{}) []map[string]interface{} {
+	seen := map[interface{}]bool{}
+	for _, t := range tickets {
+		seen[t["key"]] = true
+	}
+	for _, t := range more {
+		if !seen[t["key"]] {
+			seen[t["key"]] = true
+			tickets = append(tickets, t)
+		}
+	}
+	return tickets
+}
+
+// Handle the ticket providers list: every registered provider and whether
+// its config file exists, for the provider picker
+func handleTicketProviders(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := []ticketProviderInfo{}
+	for _, info := range ticketProviders {
+		_, err := os.Stat(filepath.Join(dataDir, info.ConfigFile))
+		info.Configured = err == nil
+		list = append(list, info)
+	}
+	// The default provider first, the others by name
+	sort.Slice(list, func(i, j int) bool {
+		if (list[i].ID == defaultTicketProvider) != (list[j].ID == defaultTicketProvider) {
+			return list[i].ID == defaultTicketProvider
+		}
+		return list[i].Name < list[j].Name
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Handle the tickets API of a provider: the tickets offered for linking.
+// ?refresh=1 bypasses the cache; stale results and failed parts of a
+// search are reported in Warning headers.
+func handleTickets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	info, ok := ticketProviders[r.PathValue("provider")]
+	if !ok {
+		http.Error(w, "Unknown ticket provider", http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	result, err := info.provider.Search(q, q.Get("refresh") == "1")
+	if err != nil {
+		writeJiraError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Cache", result.cacheStatus)
+	if result.stale {
+		w.Header().Add("Warning", fmt.Sprintf(`110 - "%s unavailable, serving tickets fetched at %s"`, info.Name, result.fetchedAt.Format(time.RFC3339)))
+	}
+	for _, msg := range result.warnings {
+		w.Header().Add("Warning", fmt.Sprintf("199 - %q", msg))
+	}
+	json.NewEncoder(w).Encode(result.tickets)
+}
+
+// ticketsHandler serves the tickets API of one provider under the route it
+// had before /api/tickets/{provider}
+func ticketsHandler(provider string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.SetPathValue("provider", provider)
+		handleTickets(w, r)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PublicConfig is public-config.json. It enables the read-only status API,
+// which exposes upcoming releases, freezes and maintenance locks but no
+// tickets, notes or people, for embedding in status pages.
+type PublicConfig struct {
+	Tokens       []string `json:"tokens"`                 // the API is off without any
+	Listen       string   `json:"listen,omitempty"`       // e.g. ":8081" to serve it on its own port too; read at startup
+	Environments []string `json:"environments,omitempty"` // default: the visible environments
+	Statuses     []string `json:"statuses,omitempty"`     // default: every status but None
+	Days         int      `json:"days,omitempty"`         // how far ahead, default 90
+}
+
+// defaultPublicDays is how far ahead the status API looks by default
+const defaultPublicDays = 90
+
+// loadPublicConfig reads public-config.json; ok is false when the status API is off
+func loadPublicConfig() (cfg PublicConfig, ok bool, err error) {
+	if err := readDataFile("public-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.Days <= 0 {
+		cfg.Days = defaultPublicDays
+	}
+	return cfg, len(cfg.Tokens) > 0, nil
+}
+
+// publicToken returns the token of a request: a bearer token, or ?token=
+// for embeds that can't set headers
+func publicToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.URL.Query().Get("token")
+}
+
+// validToken compares a token against the configured ones in constant time
+func (c PublicConfig) validToken(token string) bool {
+	valid := false
+	for _, t := range c.Tokens {
+		if t != "" && subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// publicRelease is a release as the status API shows it
+type publicRelease struct {
+	Environment string    `json:"environment"`
+	Date        string    `json:"date"`
+	Name        string    `json:"name,omitempty"`
+	Status      string    `json:"status"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+// publicFreeze is a group freeze, listed by the environments it covers
+type publicFreeze struct {
+	Environments []string `json:"environments"`
+	From         string   `json:"from"`
+	To           string   `json:"to"`
+	Reason       string   `json:"reason,omitempty"`
+}
+
+// publicLock is a locked environment
+type publicLock struct {
+	Environment string `json:"environment"`
+	Reason      string `json:"reason,omitempty"`
+	Maintenance bool   `json:"maintenance,omitempty"`
+	Until       string `json:"until,omitempty"`
+}
+
+// publicStatus is the response of GET /api/public/status
+type publicStatus struct {
+	GeneratedAt  time.Time       `json:"generatedAt"`
+	Environments []string        `json:"environments"`
+	Releases     []publicRelease `json:"releases"`
+	Freezes      []publicFreeze  `json:"freezes"`
+	Locks        []publicLock    `json:"locks"`
+}
+
+// buildPublicStatus collects the releases, freezes and locks of the exposed
+// environments over the next cfg.Days days, by display name
+func buildPublicStatus(cfg PublicConfig, now time.Time) (publicStatus, error) {
+	envs, err := loadEnvironments()
+	if err != nil {
+		return publicStatus{}, err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return publicStatus{}, err
+	}
+
+	exposed := map[string]string{}
+	status := publicStatus{GeneratedAt: now.UTC(), Environments: []string{}, Releases: []publicRelease{}, Freezes: []publicFreeze{}, Locks: []publicLock{}}
+	for _, env := range envs.Environments {
+		listed := env.Visible && len(cfg.Environments) == 0
+		for _, name := range cfg.Environments {
+			listed = listed || name == env.Name
+		}
+		if !listed {
+			continue
+		}
+		display := env.DisplayName
+		if display == "" {
+			display = env.Name
+		}
+		exposed[env.Name] = display
+		status.Environments = append(status.Environments, display)
+		if env.Lock.active(now) {
+			status.Locks = append(status.Locks, publicLock{Environment: display, Reason: env.Lock.Reason, Maintenance: env.Lock.Maintenance, Until: env.Lock.Until})
+		}
+	}
+
+	statuses := map[string]bool{}
+	for _, s := range cfg.Statuses {
+		statuses[s] = true
+	}
+	horizon := now.AddDate(0, 0, cfg.Days)
+	for env, entries := range releases {
+		display, ok := exposed[env]
+		if !ok {
+			continue
+		}
+		for _, e := range entries {
+			if (len(statuses) > 0 && !statuses[e.Status]) || (len(statuses) == 0 && e.Status == "None") {
+				continue
+			}
+			start, end, err := e.window()
+			if err != nil || !end.After(now) || start.After(horizon) {
+				continue
+			}
+			status.Releases = append(status.Releases, publicRelease{Environment: display, Date: e.Date, Name: e.ReleaseName, Status: e.Status, Start: start, End: end})
+		}
+	}
+	sort.Slice(status.Releases, func(i, j int) bool {
+		a, b := status.Releases[i], status.Releases[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		return a.Environment < b.Environment
+	})
+
+	for _, f := range envs.activeFreezes(now, horizon) {
+		freeze := publicFreeze{Environments: []string{}, From: f.From, To: f.To, Reason: f.Reason}
+		for _, env := range envs.groupEnvironments(f.Group) {
+			if display, ok := exposed[env]; ok {
+				freeze.Environments = append(freeze.Environments, display)
+			}
+		}
+		if len(freeze.Environments) > 0 {
+			status.Freezes = append(status.Freezes, freeze)
+		}
+	}
+	return status, nil
+}
+
+// Handle the public status API: upcoming releases, freezes and locks,
+// for a bearer token (or ?token=) from public-config.json
+func handlePublicStatus(w http.ResponseWriter, r *http.Request) {
+	// Status pages fetch this from other origins
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "GET")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadPublicConfig()
+	if err != nil {
+		http.Error(w, "Invalid public config", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Public status API is not enabled", http.StatusNotFound)
+		return
+	}
+	if !cfg.validToken(publicToken(r)) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="relplanner"`)
+		http.Error(w, "Invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := buildPublicStatus(cfg, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building status: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=60")
+	json.NewEncoder(w).Encode(status)
+}
+
+// startPublicListener serves only the public status API on the listen
+// address of public-config.json, so it can be exposed without the planner
+func startPublicListener() {
+	cfg, ok, err := loadPublicConfig()
+	if err != nil {
+		logPublic.Warn("Invalid public config", "err", err)
+		return
+	}
+	if !ok || cfg.Listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/public/status", handlePublicStatus)
+	go func() {
+		logPublic.Info("Starting public status listener", "addr", cfg.Listen)
+		if err := http.ListenAndServe(cfg.Listen, logMiddleware(mux)); err != nil {
+			logPublic.Error("Public status listener stopped", "err", err)
+		}
+	}()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit is a token bucket: Rate requests a second on average, up to
+// Burst at once. A negative rate turns the limit off.
+type RateLimit struct {
+	Rate  float64 `json:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// RateLimitConfig is ratelimit-config.json. API requests are limited per
+// API key, or per client address without one; writes and calls to Jira
+// through the server are limited further. Omitted limits are the defaults.
+type RateLimitConfig struct {
+	IP     RateLimit `json:"ip"`
+	APIKey RateLimit `json:"apiKey"`
+	Writes RateLimit `json:"writes"`
+	Jira   RateLimit `json:"jira"`
+}
+
+// defaultRateLimits apply without ratelimit-config.json
+var defaultRateLimits = RateLimitConfig{
+	IP:     RateLimit{Rate: 20, Burst: 100},
+	APIKey: RateLimit{Rate: 20, Burst: 100},
+	Writes: RateLimit{Rate: 5, Burst: 30},
+	Jira:   RateLimit{Rate: 2, Burst: 20},
+}
+
+// jiraProxyPaths are the API paths that call Jira, by prefix
+var jiraProxyPaths = []string{"/api/jira-tickets", "/api/jira/sprints", "/api/jira/validate-jql", "/api/jira/status"}
+
+// orDefault returns the limit, or def when it isn't configured
+func (l RateLimit) orDefault(def RateLimit) RateLimit {
+	if l.Rate == 0 {
+		return def
+	}
+	if l.Burst <= 0 {
+		l.Burst = int(math.Ceil(l.Rate))
+	}
+	return l
+}
+
+// tokenBucket is the state of a rate limit for one client
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds the buckets of the clients, by limit and client
+var rateLimiter = struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+	config  RateLimitConfig
+	loaded  time.Time
+	pruned  time.Time
+}{buckets: map[string]*tokenBucket{}}
+
+// rateLimitConfigTTL is how often ratelimit-config.json is reread
+const rateLimitConfigTTL = time.Minute
+
+// rateLimitsLocked returns the configured limits; rateLimiter must be locked
+func rateLimitsLocked() RateLimitConfig {
+	if time.Since(rateLimiter.loaded) > rateLimitConfigTTL {
+		var cfg RateLimitConfig
+		readDataFile("ratelimit-config.json", &cfg)
+		rateLimiter.config = RateLimitConfig{
+			IP:     cfg.IP.orDefault(defaultRateLimits.IP),
+			APIKey: cfg.APIKey.orDefault(defaultRateLimits.APIKey),
+			Writes: cfg.Writes.orDefault(defaultRateLimits.Writes),
+			Jira:   cfg.Jira.orDefault(defaultRateLimits.Jira),
+		}
+		rateLimiter.loaded = time.Now()
+	}
+	return rateLimiter.config
+}
+
+// takeLocked takes a token from a client's bucket, returning how long to
+// wait when there is none; rateLimiter must be locked
+func takeLocked(key string, limit RateLimit, now time.Time) time.Duration {
+	if limit.Rate < 0 {
+		return 0
+	}
+	b, ok := rateLimiter.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(limit.Burst), last: now}
+		rateLimiter.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// pruneBucketsLocked forgets clients whose buckets have been idle for a
+// while; rateLimiter must be locked
+func pruneBucketsLocked(now time.Time) {
+	if now.Sub(rateLimiter.pruned) < 10*time.Minute {
+		return
+	}
+	for key, b := range rateLimiter.buckets {
+		if now.Sub(b.last) > 10*time.Minute {
+			delete(rateLimiter.buckets, key)
+		}
+	}
+	rateLimiter.pruned = now
+}
+
+// rateLimit rejects API requests beyond the rate limits with 429 Too Many
+// Requests and the seconds to wait in Retry-After
+func rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := "ip:" + clientIP(r)
+		if key, ok := requestAPIKey(r); ok {
+			client = "apikey:" + key.ID
+		}
+		write := writeRequest(r)
+		jira := false
+		for _, prefix := range jiraProxyPaths {
+			jira = jira || strings.HasPrefix(r.URL.Path, prefix)
+		}
+
+		now := time.Now()
+		rateLimiter.Lock()
+		limits := rateLimitsLocked()
+		limit := limits.IP
+		if strings.HasPrefix(client, "apikey:") {
+			limit = limits.APIKey
+		}
+		wait := takeLocked(client, limit, now)
+		kind := "requests"
+		if wait == 0 && write {
+			wait, kind = takeLocked("writes:"+client, limits.Writes, now), "writes"
+		}
+		if wait == 0 && jira {
+			wait, kind = takeLocked("jira:"+client, limits.Jira, now), "Jira requests"
+		}
+		pruneBucketsLocked(now)
+		rateLimiter.Unlock()
+
+		if wait > 0 {
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			http.Error(w, fmt.Sprintf("Too many %s, retry in %ds", kind, seconds), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
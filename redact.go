@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// redacted replaces what log output must not show
+const redacted = "[REDACTED]"
+
+// sensitiveKeyParts mark a field as sensitive wherever they appear in its
+// name, ignoring case, dashes and underscores: apiToken, X-Api-Key, ...
+var sensitiveKeyParts = []string{"password", "passwd", "secret", "token", "apikey", "authorization", "cookie", "privatekey", "credential", "signature"}
+
+// redaction holds the extra sensitive fields of logging-config.json and the
+// secrets known to the server, masked wherever they turn up
+var redaction = struct {
+	sync.RWMutex
+	fields  map[string]bool
+	secrets map[string]bool
+}{fields: map[string]bool{}, secrets: map[string]bool{}}
+
+// Patterns of credentials in free text: authorization schemes, URL user
+// info, and sensitive-looking fields of JSON, query strings and key=value
+// pairs; the field pattern is rebuilt as fields are configured
+var (
+	authSchemePattern = regexp.MustCompile(`(?i)\b(bearer|basic|token)\s+[A-Za-z0-9._~+/=-]{8,}`)
+	urlUserPattern    = regexp.MustCompile(`(?i)([a-z][a-z0-9+.-]*://)[^/\s:@]+:[^/\s@]+@`)
+	fieldPattern      = buildFieldPattern(nil)
+	fieldPatternMu    sync.RWMutex
+)
+
+// normalizeKey lowercases a field name and drops its separators
+func normalizeKey(key string) string {
+	return strings.NewReplacer("-", "", "_", "", ".", "").Replace(strings.ToLower(key))
+}
+
+// shownKeys are logged on purpose though they look sensitive: the first
+// admin is created with the setup token from the log
+var shownKeys = map[string]bool{"setuptoken": true}
+
+// sensitiveKey reports whether a field's value must be masked
+func sensitiveKey(key string) bool {
+	k := normalizeKey(key)
+	if shownKeys[k] {
+		return false
+	}
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(k, part) {
+			return true
+		}
+	}
+	redaction.RLock()
+	defer redaction.RUnlock()
+	return redaction.fields[k]
+}
+
+// buildFieldPattern matches "field": "value", field=value and field: value
+// for the sensitive field names, the value being the last group
+func buildFieldPattern(extra []string) *regexp.Regexp {
+	names := []string{`[\w-]*(?:` + strings.Join(sensitiveKeyParts, "|") + `|api[_-]?key|private[_-]?key)[\w-]*`}
+	for _, f := range extra {
+		names = append(names, regexp.QuoteMeta(f))
+	}
+	return regexp.MustCompile(`(?i)("?\b(?:` + strings.Join(names, "|") + `)"?\s*[:=]\s*)("[^"]*"|[^\s,&;}"]+)`)
+}
+
+// setRedactedFields sets the extra sensitive fields of logging-config.json
+func setRedactedFields(fields []string) {
+	m := map[string]bool{}
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			m[normalizeKey(f)] = true
+		}
+	}
+	redaction.Lock()
+	redaction.fields = m
+	redaction.Unlock()
+	fieldPatternMu.Lock()
+	fieldPattern = buildFieldPattern(fields)
+	fieldPatternMu.Unlock()
+}
+
+// registerSecret makes a credential the server uses, a Jira API token
+// say, masked wherever it is logged
+func registerSecret(secret string) {
+	if len(secret) < 6 {
+		return // too short to mask without mangling ordinary text
+	}
+	redaction.Lock()
+	redaction.secrets[secret] = true
+	redaction.Unlock()
+}
+
+// redactString masks the credentials in a log message or value
+func redactString(s string) string {
+	redaction.RLock()
+	for secret := range redaction.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	redaction.RUnlock()
+	s = authSchemePattern.ReplaceAllString(s, "$1 "+redacted)
+	s = urlUserPattern.ReplaceAllString(s, "${1}"+redacted+"@")
+	fieldPatternMu.RLock()
+	pattern := fieldPattern
+	fieldPatternMu.RUnlock()
+	return pattern.ReplaceAllStringFunc(s, func(m string) string {
+		parts := pattern.FindStringSubmatch(m)
+		if strings.HasPrefix(parts[2], `"`) {
+			return parts[1] + `"` + redacted + `"`
+		}
+		return parts[1] + redacted
+	})
+}
+
+// redactAttr masks a log attribute: all of a sensitive one, the credentials
+// in the text of the others
+func redactAttr(a slog.Attr) slog.Attr {
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		out := make([]slog.Attr, len(attrs))
+		for i, attr := range attrs {
+			out[i] = redactAttr(attr)
+		}
+		return slog.Attr{Key: a.Key, Value: slog.GroupValue(out...)}
+	}
+	if sensitiveKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			return slog.String(a.Key, redactString(v.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, redactString(v.String()))
+		case encoding.TextMarshaler:
+			if b, err := v.MarshalText(); err == nil {
+				return slog.String(a.Key, redactString(string(b)))
+			}
+		case []byte:
+			return slog.String(a.Key, redactString(string(v)))
+		}
+	}
+	return a
+}
+
+// redactAttrs masks a list of attributes
+func redactAttrs(attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		out[i] = redactAttr(a)
+	}
+	return out
+}
+
+// redactRecord masks the message and attributes of a log record
+func redactRecord(r slog.Record) slog.Record {
+	out := slog.NewRecord(r.Time, r.Level, redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(redactAttr(a))
+		return true
+	})
+	return out
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reminderOffset is a parsed entry of NotificationRulesData.Reminders
+type reminderOffset struct {
+	before time.Duration
+	label  string
+}
+
+// parseReminderOffset reads "7d", "24h" or any time.ParseDuration value
+func parseReminderOffset(s string) (reminderOffset, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return reminderOffset{}, fmt.Errorf("invalid reminder %q, expected e.g. 7d or 24h", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return reminderOffset{}, fmt.Errorf("invalid reminder %q, expected e.g. 7d or 24h", s)
+		}
+	}
+	if d <= 0 {
+		return reminderOffset{}, fmt.Errorf("invalid reminder %q, must be positive", s)
+	}
+	label := d.String()
+	switch {
+	case strings.HasSuffix(s, "d"):
+		label = plural(int(d/(24*time.Hour)), "day")
+	case d%time.Hour == 0:
+		label = plural(int(d/time.Hour), "hour")
+	case d%time.Minute == 0:
+		label = plural(int(d/time.Minute), "minute")
+	}
+	return reminderOffset{before: d, label: label}, nil
+}
+
+// plural words a count of a unit, "1 day" or "3 days"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return strconv.Itoa(n) + " " + unit + "s"
+}
+
+// timeUntilLabel words the time left before a release, rounded to days from
+// two days out and to hours below that
+func timeUntilLabel(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return plural(int((d+12*time.Hour)/(24*time.Hour)), "day")
+	case d >= time.Hour:
+		return plural(int((d+30*time.Minute)/time.Hour), "hour")
+	}
+	return plural(max(1, int(d/time.Minute)), "minute")
+}
+
+// remindersSent is reminders-sent.json: the reminders already sent, keyed
+// by release ID, start and offset so a moved release is reminded again
+type remindersSent struct {
+	Sent map[string]string `json:"sent"` // key -> sent at
+}
+
+// remindersMu serializes reminder runs
+var remindersMu sync.Mutex
+
+// loadRemindersSent reads reminders-sent.json
+func loadRemindersSent() (remindersSent, error) {
+	state := remindersSent{Sent: map[string]string{}}
+	err := readDataFile("reminders-sent.json", &state)
+	if state.Sent == nil {
+		state.Sent = map[string]string{}
+	}
+	return state, err
+}
+
+// save writes reminders-sent.json, a server-maintained file
+func (s remindersSent) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "reminders-sent.json"), data, 0644)
+}
+
+// sendDueReminders sends the reminders of upcoming releases that are due.
+// Only the nearest due offset is sent, so a release planned three days out
+// with 7d and 24h reminders is reminded once now and once the day before.
+func sendDueReminders(now time.Time) error {
+	remindersMu.Lock()
+	defer remindersMu.Unlock()
+
+	rules, err := loadNotificationRules()
+	if err != nil || len(rules.Reminders) == 0 {
+		return err
+	}
+	var offsets []reminderOffset
+	for _, s := range rules.Reminders {
+		o, err := parseReminderOffset(s)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, o)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i].before < offsets[j].before })
+
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return err
+	}
+	state, err := loadRemindersSent()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, env := range releases.sortedEnvironmentNames() {
+		for _, e := range releases[env] {
+			if e.Status == "None" || completedStatuses[e.Status] {
+				continue
+			}
+			start, _, err := e.window()
+			if err != nil || !start.After(now) {
+				continue
+			}
+			prefix := releaseID(env, e.Date) + "|" + start.Format(time.RFC3339) + "|"
+			for i, o := range offsets {
+				if now.Before(start.Add(-o.before)) {
+					continue
+				}
+				if state.Sent[prefix+o.label] == "" {
+					event := newReleaseEvent(eventReminder, env, e, envs)
+					event.Reminder = timeUntilLabel(start.Sub(now))
+					event.Unapproved = needsApproval(e.Status)
+					event.OpenItems = e.openItems()
+					notifyChannels(event)
+					logNotify.Info("Sent reminder", "reminder", o.label, "release", event.ID)
+				}
+				// Later offsets are past, mark them so they aren't sent late
+				for _, later := range offsets[i:] {
+					if state.Sent[prefix+later.label] == "" {
+						state.Sent[prefix+later.label] = now.Format(time.RFC3339)
+						changed = true
+					}
+				}
+				break
+			}
+		}
+	}
+
+	// Forget the reminders of releases that started a while ago
+	for key := range state.Sent {
+		parts := strings.Split(key, "|")
+		if len(parts) != 3 {
+			continue
+		}
+		if start, err := time.Parse(time.RFC3339, parts[1]); err != nil || start.Before(now.AddDate(0, 0, -7)) {
+			delete(state.Sent, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return state.save()
+}
+
+// runReminders checks for due reminders every few minutes
+func runReminders() {
+	for {
+		if err := sendDueReminders(time.Now()); err != nil {
+			logNotify.Error("Release reminders failed", "err", err)
+		}
+		time.Sleep(5 * time.Minute)
+	}
+}
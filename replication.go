@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplicationConfig is replication-config.json. Its presence makes the
+// server a read-only standby of the primary: it follows the primary's change
+// feed and copies its data files and backups, and leaves notifying,
+// publishing and syncing to it. Promote a standby by removing the file and
+// restarting it.
+type ReplicationConfig struct {
+	Primary string `json:"primary"` // the primary's URL, e.g. https://planner.example.com
+	APIKey  string `json:"apiKey"`  // an admin API key of the primary
+	// IntervalSeconds is how often the change feed is polled, default 10
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// ResyncMinutes is how often the files are compared even when the feed
+	// has no changes, catching those it doesn't list; default 60
+	ResyncMinutes int `json:"resyncMinutes,omitempty"`
+}
+
+// replicationManifest is the JSON response of GET /api/replication/manifest
+type replicationManifest struct {
+	Cursor  int64             `json:"cursor"`  // of the change feed when listed
+	Files   map[string]string `json:"files"`   // data file -> checksum
+	Backups map[string]int64  `json:"backups"` // backup file -> size
+}
+
+// replicationStatus is a standby's progress, in GET /api/replication
+type replicationStatus struct {
+	Role          string `json:"role"` // primary or standby
+	Primary       string `json:"primary,omitempty"`
+	Cursor        int64  `json:"cursor"` // of the primary's change feed, as copied
+	LastCheck     string `json:"lastCheck,omitempty"`
+	LastSync      string `json:"lastSync,omitempty"` // files last copied
+	FilesCopied   int    `json:"filesCopied,omitempty"`
+	BackupsCopied int    `json:"backupsCopied,omitempty"`
+	Error         string `json:"error,omitempty"`
+}
+
+// replication is the standby's config, set once at startup, and status
+var replication struct {
+	sync.Mutex
+	cfg    *ReplicationConfig // nil on a primary
+	status replicationStatus
+}
+
+// replicationClient talks to the primary
+var replicationClient = &http.Client{Timeout: time.Minute}
+
+// standbyMode reports whether the server is a standby
+func standbyMode() bool {
+	replication.Lock()
+	defer replication.Unlock()
+	return replication.cfg != nil
+}
+
+// startReplication reads replication-config.json and, when it names a
+// primary, starts following it
+func startReplication() error {
+	var cfg ReplicationConfig
+	if err := readDataFile("replication-config.json", &cfg); err != nil {
+		return err
+	}
+	if cfg.Primary == "" {
+		return nil
+	}
+	if cfg.APIKey == "" {
+		return fmt.Errorf("replication-config.json needs the primary's apiKey")
+	}
+	cfg.Primary = strings.TrimSuffix(cfg.Primary, "/")
+	if cfg.IntervalSeconds <= 0 {
+		cfg.IntervalSeconds = 10
+	}
+	if cfg.ResyncMinutes <= 0 {
+		cfg.ResyncMinutes = 60
+	}
+	replication.Lock()
+	replication.cfg = &cfg
+	replication.status = replicationStatus{Role: "standby", Primary: cfg.Primary, Cursor: -1}
+	replication.Unlock()
+	logReplication.Info("Running as a read-only standby", "primary", cfg.Primary)
+	go runReplication(cfg)
+	return nil
+}
+
+// replicatedFile reports whether a data file is copied from the primary;
+// the standby keeps its own replication config
+func replicatedFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && name != "replication-config.json"
+}
+
+// fetchPrimary GETs a path of the primary's API
+func fetchPrimary(cfg ReplicationConfig, path string) ([]byte, int, error) {
+	req, err := http.NewRequest(http.MethodGet, cfg.Primary+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	resp, err := replicationClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusGone {
+		return nil, resp.StatusCode, fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, resp.StatusCode, nil
+}
+
+// writeReplicatedFile writes a file copied from the primary so the data
+// watcher doesn't take it for an edit, and readable by the server only when
+// it holds accounts or keys
+func writeReplicatedFile(path string, content []byte) error {
+	name := filepath.Base(path)
+	perm := os.FileMode(0644)
+	if privateFiles[name] || privateFiles[strings.SplitN(name, ".", 2)[0]+".json"] {
+		perm = 0600
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	tmp := path + ".replicating"
+	if err := os.WriteFile(tmp, content, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if filepath.Dir(path) == filepath.Clean(dataDir) {
+		noteDataWrite(name, content)
+	}
+	return nil
+}
+
+// replicateOnce follows the primary's change feed from the cursor and, when
+// it moved or full is set, copies the files differing from the primary's,
+// returning the new cursor
+func replicateOnce(cfg ReplicationConfig, cursor int64, full bool) (int64, error) {
+	if cursor >= 0 {
+		body, status, err := fetchPrimary(cfg, fmt.Sprintf("/api/changes?since=%d&limit=1", cursor))
+		if err != nil {
+			return cursor, err
+		}
+		var page changesPage
+		if status == http.StatusGone {
+			full = true // the feed was reset or pruned, compare everything
+		} else if err := json.Unmarshal(body, &page); err != nil {
+			return cursor, fmt.Errorf("invalid change feed: %v", err)
+		} else if len(page.Changes) == 0 && page.Cursor == cursor && !full {
+			return cursor, nil
+		}
+	}
+
+	body, _, err := fetchPrimary(cfg, "/api/replication/manifest")
+	if err != nil {
+		return cursor, err
+	}
+	var manifest replicationManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return cursor, fmt.Errorf("invalid manifest: %v", err)
+	}
+	local, err := localManifest()
+	if err != nil {
+		return cursor, err
+	}
+
+	var changed []string
+	copiedBackups := 0
+	for name, sum := range manifest.Files {
+		if !replicatedFile(name) || filepath.Base(name) != name || local.Files[name] == sum {
+			continue
+		}
+		content, _, err := fetchPrimary(cfg, "/api/replication/files/"+url.PathEscape(name))
+		if err != nil {
+			return cursor, err
+		}
+		if err := writeReplicatedFile(filepath.Join(dataDir, name), content); err != nil {
+			return cursor, err
+		}
+		changed = append(changed, name)
+		publishLiveChange(liveChange{Time: time.Now().UTC().Format(time.RFC3339), File: name, Action: auditUpdate,
+			By: "replication", ETag: checksum(content)})
+	}
+	for name := range local.Files {
+		if _, ok := manifest.Files[name]; !ok && replicatedFile(name) {
+			fileMu.Lock()
+			err := os.Remove(filepath.Join(dataDir, name))
+			delete(dataFiles, name)
+			fileMu.Unlock()
+			if err != nil && !os.IsNotExist(err) {
+				return cursor, err
+			}
+			changed = append(changed, name)
+		}
+	}
+	for name, size := range manifest.Backups {
+		if filepath.Base(name) != name {
+			continue
+		}
+		if localSize, ok := local.Backups[name]; ok && localSize == size {
+			continue
+		}
+		content, _, err := fetchPrimary(cfg, "/api/replication/backups/"+url.PathEscape(name))
+		if err != nil {
+			return cursor, err
+		}
+		if err := writeReplicatedFile(filepath.Join(backupDir, name), content); err != nil {
+			return cursor, err
+		}
+		copiedBackups++
+	}
+	// Backups the primary's cleanup removed
+	for name := range local.Backups {
+		if _, ok := manifest.Backups[name]; !ok {
+			os.Remove(filepath.Join(backupDir, name))
+		}
+	}
+
+	if len(changed) > 0 {
+		dropDataCaches(nil)
+	}
+	replication.Lock()
+	replication.status.FilesCopied += len(changed)
+	replication.status.BackupsCopied += copiedBackups
+	if len(changed) > 0 || copiedBackups > 0 {
+		replication.status.LastSync = time.Now().UTC().Format(time.RFC3339)
+		logReplication.Info("Copied from the primary", "files", len(changed), "backups", copiedBackups, "cursor", manifest.Cursor)
+	}
+	replication.Unlock()
+	return manifest.Cursor, nil
+}
+
+// runReplication polls the primary, comparing every file now and then
+func runReplication(cfg ReplicationConfig) {
+	cursor := int64(-1)
+	lastFull := time.Time{}
+	for {
+		full := time.Since(lastFull) >= time.Duration(cfg.ResyncMinutes)*time.Minute
+		next, err := replicateOnce(cfg, cursor, full)
+		replication.Lock()
+		replication.status.LastCheck = time.Now().UTC().Format(time.RFC3339)
+		replication.status.Error = ""
+		if err != nil {
+			replication.status.Error = err.Error()
+			logReplication.Error("Replication failed", "primary", cfg.Primary, "err", err)
+		} else {
+			cursor = next
+			replication.status.Cursor = cursor
+			if full {
+				lastFull = time.Now()
+			}
+		}
+		replication.Unlock()
+		time.Sleep(time.Duration(cfg.IntervalSeconds) * time.Second)
+	}
+}
+
+// localManifest lists the data files with their checksums and the backups
+// with their sizes
+func localManifest() (replicationManifest, error) {
+	manifest := replicationManifest{Files: map[string]string{}, Backups: map[string]int64{}}
+	paths, err := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	if err != nil {
+		return manifest, err
+	}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if !replicatedFile(name) {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return manifest, err
+		}
+		manifest.Files[name] = checksum(content)
+	}
+	entries, err := os.ReadDir(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return manifest, err
+	}
+	for _, e := range entries {
+		if info, err := e.Info(); err == nil && !e.IsDir() {
+			manifest.Backups[e.Name()] = info.Size()
+		}
+	}
+	return manifest, nil
+}
+
+// rejectStandbyWrites turns away changes made through the API of a standby,
+// which would be overwritten by the primary's; logging in is still allowed
+func rejectStandbyWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writeRequest(r) && strings.HasPrefix(r.URL.Path, "/api/") && r.URL.Path != "/api/login" && r.URL.Path != "/api/logout" && standbyMode() {
+			replication.Lock()
+			primary := replication.cfg.Primary
+			replication.Unlock()
+			http.Error(w, fmt.Sprintf("This server is a read-only standby, make changes on %s", primary), http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireReplicationAdmin reports whether a replication request comes from
+// an admin, answering it with a 403 otherwise
+func requireReplicationAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if _, _, role := requestIdentity(r); !roleAllows(role, "admin") {
+		http.Error(w, "Only admins can replicate the data", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Handle the replication status: the role of the server and, on a standby,
+// how far it has copied the primary
+func handleReplication(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireReplicationAdmin(w, r) {
+		return
+	}
+	replication.Lock()
+	status := replication.status
+	replication.Unlock()
+	if status.Role == "" {
+		status.Role = "primary"
+		status.Cursor, _ = auditCursor()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// Handle the manifest standbys compare their files with: the data files'
+// checksums, the backups' sizes and the change feed's cursor
+func handleReplicationManifest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireReplicationAdmin(w, r) {
+		return
+	}
+	// The cursor is read first, so changes made while listing are found by
+	// the next poll
+	cursor, err := auditCursor()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading the audit log: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fileMu.Lock()
+	manifest, err := localManifest()
+	fileMu.Unlock()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error listing the data files: %v", err), http.StatusInternalServerError)
+		return
+	}
+	manifest.Cursor = cursor
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
+
+// Handle a data file or backup as stored, for standbys
+func handleReplicationFile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !requireReplicationAdmin(w, r) {
+		return
+	}
+	name := r.PathValue("name")
+	dir := dataDir
+	if strings.HasPrefix(r.URL.Path, "/api/replication/backups/") {
+		dir = backupDir
+	} else if !replicatedFile(name) {
+		http.NotFound(w, r)
+		return
+	}
+	if filepath.Base(name) != name {
+		http.Error(w, "Invalid file name", http.StatusBadRequest)
+		return
+	}
+	fileMu.Lock()
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	fileMu.Unlock()
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(content)
+}
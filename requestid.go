@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// requestIDHeader carries a request's ID, from a proxy or client that set
+// one, back in the response
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key of a request's ID
+type requestIDKey struct{}
+
+// requestIDFrom returns the ID of the request a context belongs to
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID reports whether a client's request ID is safe to log and
+// echo: short, and letters, digits and -_.:
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID makes a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDWriter adds the request ID to plain text error responses, so
+// users can quote it when reporting a problem
+type requestIDWriter struct {
+	http.ResponseWriter
+	id      string
+	errText bool
+}
+
+func (w *requestIDWriter) WriteHeader(status int) {
+	h := w.Header()
+	w.errText = status >= 400 && h.Get("Content-Encoding") == "" && strings.HasPrefix(h.Get("Content-Type"), "text/plain")
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to WebSockets
+func (w *requestIDWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// requestID gives every request an ID, the client's X-Request-ID when it
+// sent a valid one, which is in the response headers and log lines
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		rw := &requestIDWriter{ResponseWriter: w, id: id}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		if rw.errText && r.Method != http.MethodHead {
+			fmt.Fprintf(rw.ResponseWriter, "Request ID: %s\n", id)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// validateRetrospective checks and normalizes a retrospective sent by a
+// client; categories are lowercased so they group across releases
+func validateRetrospective(retro *Retrospective) error {
+	if retro.URL != "" {
+		u, err := url.Parse(retro.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+	}
+	for i := range retro.Findings {
+		f := &retro.Findings[i]
+		f.Category = strings.ToLower(strings.TrimSpace(f.Category))
+		f.Text = strings.TrimSpace(f.Text)
+		if f.Text == "" {
+			return fmt.Errorf("finding %d has no text", i+1)
+		}
+	}
+	for i := range retro.ActionItems {
+		item := &retro.ActionItems[i]
+		item.Text = strings.TrimSpace(item.Text)
+		if item.Text == "" {
+			return fmt.Errorf("action item %d has no text", i+1)
+		}
+	}
+	if retro.URL == "" && len(retro.Findings) == 0 && len(retro.ActionItems) == 0 {
+		return fmt.Errorf("a retrospective needs a url, findings or action items")
+	}
+	return nil
+}
+
+// Handle the retrospective of a completed release: GET reads it, PUT
+// attaches the document and its findings and action items, DELETE clears it
+func handleReleaseRetrospective(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		if err := authorizeEnvironments(r, env); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if entry["retrospective"] == nil {
+			http.Error(w, "No retrospective recorded", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entry["retrospective"])
+		return
+
+	case http.MethodPut:
+		if status, _ := entry["status"].(string); !completedStatuses[status] {
+			http.Error(w, "Only completed releases have a retrospective", http.StatusConflict)
+			return
+		}
+		var retro Retrospective
+		if err := json.NewDecoder(r.Body).Decode(&retro); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := validateRetrospective(&retro); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		retro.RecordedBy = requestUser(r)
+		retro.RecordedAt = time.Now().UTC().Format(time.RFC3339)
+		entry["retrospective"] = retro
+
+	case http.MethodDelete:
+		// null rather than absent, which would keep the recorded retrospective
+		entry["retrospective"] = nil
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filePath := filepath.Join(dataDir, "releases.json")
+	warnings := warningsByPath(filePath, doc)
+	newETag, err := writeJSONFile(withServerFields(r.Context()), filePath, doc, etag, maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	w.Header().Set("ETag", newETag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"release":  entry,
+		"warnings": warnings,
+	})
+}
+
+// retrospectiveEntry is a release's retrospective in the report
+type retrospectiveEntry struct {
+	ID            string        `json:"id"`
+	Environment   string        `json:"environment"`
+	Date          string        `json:"date"`
+	ReleaseName   string        `json:"releaseName,omitempty"`
+	Retrospective Retrospective `json:"retrospective"`
+}
+
+// recurringFinding is a category of findings seen in several releases of
+// an environment
+type recurringFinding struct {
+	Environment string   `json:"environment"`
+	Category    string   `json:"category"`
+	Count       int      `json:"count"`
+	Releases    []string `json:"releases"`
+}
+
+// retrospectiveReport is the response of GET /api/retrospectives
+type retrospectiveReport struct {
+	From            string               `json:"from"`
+	To              string               `json:"to"`
+	Retrospectives  []retrospectiveEntry `json:"retrospectives"`
+	Recurring       []recurringFinding   `json:"recurring"`
+	OpenActionItems int                  `json:"openActionItems"`
+}
+
+// Handle querying retrospectives of releases between from and to (the past
+// year by default), optionally of one env and finding category, with the
+// categories that recur per environment
+func handleRetrospectives(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	from, to, ok := parseAnalyticsRange(w, r)
+	if !ok {
+		return
+	}
+	envFilter := r.URL.Query().Get("env")
+	category := strings.ToLower(r.URL.Query().Get("category"))
+
+	releases, err := loadReleases()
+	if err != nil {
+		http.Error(w, "Error reading releases", http.StatusInternalServerError)
+		return
+	}
+
+	report := retrospectiveReport{
+		From:           from.Format(dateLayout),
+		To:             to.Format(dateLayout),
+		Retrospectives: []retrospectiveEntry{},
+		Recurring:      []recurringFinding{},
+	}
+	recurring := map[[2]string]*recurringFinding{}
+	for env, entries := range releases {
+		if envFilter != "" && env != envFilter {
+			continue
+		}
+		for _, e := range entries {
+			if e.Retrospective == nil || !inDateRange(e.Date, from, to) {
+				continue
+			}
+			id := releaseID(env, e.Date)
+			matched := category == ""
+			seen := map[string]bool{}
+			for _, f := range e.Retrospective.Findings {
+				matched = matched || f.Category == category
+				if f.Category == "" || seen[f.Category] {
+					continue
+				}
+				seen[f.Category] = true
+				key := [2]string{env, f.Category}
+				if recurring[key] == nil {
+					recurring[key] = &recurringFinding{Environment: env, Category: f.Category}
+				}
+				recurring[key].Count++
+				recurring[key].Releases = append(recurring[key].Releases, id)
+			}
+			if !matched {
+				continue
+			}
+			for _, item := range e.Retrospective.ActionItems {
+				if !item.Done {
+					report.OpenActionItems++
+				}
+			}
+			report.Retrospectives = append(report.Retrospectives, retrospectiveEntry{
+				ID: id, Environment: env, Date: e.Date, ReleaseName: e.ReleaseName, Retrospective: *e.Retrospective,
+			})
+		}
+	}
+	for _, f := range recurring {
+		if f.Count > 1 && (category == "" || f.Category == category) {
+			sort.Strings(f.Releases)
+			report.Recurring = append(report.Recurring, *f)
+		}
+	}
+	sort.Slice(report.Retrospectives, func(i, j int) bool {
+		a, b := report.Retrospectives[i], report.Retrospectives[j]
+		if a.Date != b.Date {
+			return a.Date > b.Date
+		}
+		return a.Environment < b.Environment
+	})
+	sort.Slice(report.Recurring, func(i, j int) bool {
+		a, b := report.Recurring[i], report.Recurring[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Environment != b.Environment {
+			return a.Environment < b.Environment
+		}
+		return a.Category < b.Category
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
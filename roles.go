@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Roles of user accounts, each allowed what the previous ones are: viewers
+// only read, planners change releases and the planning data, approvers also
+// approve releases, admins also manage users, keys and the server's config
+var roleRanks = map[string]int{"viewer": 0, "planner": 1, "approver": 2, "admin": 3}
+
+// defaultRole is the role of accounts without one, unless they are admins
+const defaultRole = "planner"
+
+// adminPaths are the API paths only admins may change, by prefix
+var adminPaths = []string{
+	"/api/users",
+	"/api/api-keys",
+	"/api/backups",
+	"/api/backup-settings",
+	"/api/jira-config",
+	"/api/permissions.json",
+	"/api/notification-rules",
+	"/api/webhooks/",
+	"/api/admin/",
+	"/api/cloud-export",
+}
+
+// validRole reports whether a role exists
+func validRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// roleAllows reports whether a role covers another
+func roleAllows(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// role returns the account's role; accounts of before roles have theirs
+// from the admin flag
+func (u UserAccount) role() string {
+	if u.Role != "" {
+		return u.Role
+	}
+	if u.Admin {
+		return "admin"
+	}
+	return defaultRole
+}
+
+// setRole sets the account's role, keeping the admin flag in step
+func (u *UserAccount) setRole(role string) {
+	u.Role, u.Admin = role, role == "admin"
+}
+
+// apiKeyRoles are the roles of the API key scopes
+var apiKeyRoles = map[string]string{"read": "viewer", "write": "planner", "admin": "admin"}
+
+// requestIdentity tells who makes a request, how they are authenticated
+// and with which role. Until the server has accounts, anyone may do
+// anything, as before roles, and a trusted proxy names the user.
+func requestIdentity(r *http.Request) (user, via, role string) {
+	if key, ok := requestAPIKey(r); ok {
+		return key.user(), "apikey", apiKeyRoles[key.Scope]
+	}
+	if u, ok := sessionUser(r); ok {
+		return u.Username, "session", u.role()
+	}
+	if accountsEnabled() {
+		return "", "anonymous", ""
+	}
+	if user := r.Header.Get("X-Remote-User"); user != "" && fromTrustedProxy(r) {
+		return user, "proxy", "admin"
+	}
+	return "", "anonymous", "admin"
+}
+
+// requiredRole returns the role a write to an API path needs; anyone may
+// change their own password and preferences
+func requiredRole(path string) string {
+	if strings.HasPrefix(path, "/api/me/") {
+		return "viewer"
+	}
+	for _, prefix := range adminPaths {
+		if strings.HasPrefix(path, prefix) {
+			return "admin"
+		}
+	}
+	return defaultRole
+}
+
+// queryPaths take POSTs that only read, such as GraphQL queries too long
+// for a query string
+var queryPaths = map[string]bool{"/api/graphql": true}
+
+// writeRequest reports whether a request may change something: any method
+// but GET, HEAD and OPTIONS, unless it posts a query to a queryPaths path
+func writeRequest(r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+		return false
+	}
+	return !(r.Method == http.MethodPost && queryPaths[r.URL.Path])
+}
+
+// requireRole rejects writes to the API by users whose role doesn't allow
+// them; requireLogin has already turned away those not logged in
+func requireRole(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write := writeRequest(r)
+		if write && strings.HasPrefix(r.URL.Path, "/api/") && !authExemptPaths[r.URL.Path] {
+			_, _, role := requestIdentity(r)
+			if required := requiredRole(r.URL.Path); !roleAllows(role, required) {
+				http.Error(w, fmt.Sprintf("Your role %s can't do this, it needs %s", role, required), http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// approvedStatus reports whether a status means the release was approved
+func approvedStatus(status string) bool {
+	return status != "None" && !needsApproval(status) && !completedStatuses[status]
+}
+
+// authorizeApprovals fails with a 403 saveError when a releases.json write
+// approves a release and the user is no approver: a release moved into an
+// approved status from one that needed approval, or, when some status needs
+// approval, a new release created approved
+func authorizeApprovals(r *http.Request, current, next map[string]interface{}) error {
+	if _, _, role := requestIdentity(r); roleAllows(role, "approver") {
+		return nil
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return err
+	}
+	workflow := false
+	for status := range envs.ReleaseStatuses {
+		workflow = workflow || needsApproval(status)
+	}
+	for env, list := range next {
+		entries, _ := list.([]interface{})
+		for _, item := range entries {
+			entry, _ := item.(map[string]interface{})
+			date, _ := entry["date"].(string)
+			status, _ := entry["status"].(string)
+			if !approvedStatus(status) {
+				continue
+			}
+			before, existed := findReleaseEntry(current, releaseID(env, date))
+			previous, _ := before["status"].(string)
+			if existed && needsApproval(previous) || !existed && workflow {
+				return &saveError{status: http.StatusForbidden, msg: fmt.Sprintf("Only approvers can approve releases (%s)", releaseID(env, date))}
+			}
+		}
+	}
+	return nil
+}
+
+// whoami is the response of GET /api/whoami
+type whoami struct {
+	User     string `json:"user,omitempty"`
+	Via      string `json:"via"` // session, apikey, proxy or anonymous
+	Role     string `json:"role,omitempty"`
+	CanWrite bool   `json:"canWrite"`
+	Approver bool   `json:"approver"`
+	Admin    bool   `json:"admin"`
+}
+
+// Handle who the current user is and what their role lets them do
+func handleWhoami(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, via, role := requestIdentity(r)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(whoami{User: user, Via: via, Role: role, CanWrite: roleAllows(role, "planner"),
+		Approver: roleAllows(role, "approver"), Admin: roleAllows(role, "admin")})
+}
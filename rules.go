@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// notificationChannel is a notifier release events can be routed to
+type notificationChannel struct {
+	// defaults returns the destinations the notifier's own config routes an
+	// event to, used while no rule names the channel; nil when disabled
+	defaults func(event releaseEvent) ([]string, error)
+	// send delivers an event to destinations: channel names for chat
+	// notifiers, person IDs, team names or addresses for email
+	send func(event releaseEvent, to []string) error
+}
+
+// errNotConfigured is returned when sending through a notifier without config
+var errNotConfigured = errors.New("not configured")
+
+// notificationChannels are the registered notifiers by name
+var notificationChannels = map[string]notificationChannel{}
+
+// registerNotificationChannel makes a notifier available to rules under name
+func registerNotificationChannel(name string, c notificationChannel) {
+	notificationChannels[name] = c
+}
+
+// NotificationRule routes matching events to destinations of a channel.
+// Empty criteria match everything; labels match when the release has any.
+type NotificationRule struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name,omitempty"`
+	Events       []string `json:"events,omitempty"`
+	Environments []string `json:"environments,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	Risks        []string `json:"risks,omitempty"` // see releaseEvent.Risk
+	Channel      string   `json:"channel"`
+	To           []string `json:"to"`
+	Disabled     bool     `json:"disabled,omitempty"`
+}
+
+// NotificationRulesData is notification-rules.json. A channel named by a
+// rule is routed by the rules alone; the others keep their own routing.
+type NotificationRulesData struct {
+	Rules     []NotificationRule `json:"rules"`
+	Reminders []string           `json:"reminders,omitempty"` // before each release, e.g. "7d", "24h"
+}
+
+// notificationEventTypes are the event types rules may match
+var notificationEventTypes = map[string]bool{
+	eventCreated: true, eventMoved: true, eventApproved: true, eventCancelled: true, eventApprovalRequested: true,
+	eventReminder: true,
+}
+
+// loadNotificationRules reads notification-rules.json
+func loadNotificationRules() (NotificationRulesData, error) {
+	var rules NotificationRulesData
+	err := readDataFile("notification-rules.json", &rules)
+	return rules, err
+}
+
+// anyOf reports whether a filter is empty or contains one of values
+func anyOf(filter []string, values ...string) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	for _, f := range filter {
+		for _, v := range values {
+			if strings.EqualFold(f, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matches reports whether a rule applies to an event
+func (rule NotificationRule) matches(event releaseEvent) bool {
+	if rule.Disabled || !anyOf(rule.Events, event.Type) || !anyOf(rule.Environments, event.Environment) || !anyOf(rule.Risks, event.Risk) {
+		return false
+	}
+	return len(rule.Labels) == 0 || anyOf(rule.Labels, event.Release.Labels...)
+}
+
+// notificationDelivery is an event sent, or due to be sent, to a channel
+type notificationDelivery struct {
+	Channel string   `json:"channel"`
+	To      []string `json:"to"`
+	Rules   []string `json:"rules,omitempty"` // empty when routed by the channel's config
+	Error   string   `json:"error,omitempty"`
+}
+
+// routeNotification resolves where an event goes on every channel
+func routeNotification(event releaseEvent, rules NotificationRulesData) []notificationDelivery {
+	ruled := map[string]*notificationDelivery{}
+	for _, rule := range rules.Rules {
+		if _, ok := ruled[rule.Channel]; !ok {
+			ruled[rule.Channel] = &notificationDelivery{Channel: rule.Channel}
+		}
+		if !rule.matches(event) {
+			continue
+		}
+		d := ruled[rule.Channel]
+		d.Rules = append(d.Rules, rule.ID)
+		for _, to := range rule.To {
+			if len(d.To) == 0 || !anyOf(d.To, to) {
+				d.To = append(d.To, to)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(notificationChannels))
+	for name := range notificationChannels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var deliveries []notificationDelivery
+	for _, name := range names {
+		if d, ok := ruled[name]; ok {
+			if len(d.To) > 0 {
+				deliveries = append(deliveries, *d)
+			}
+			continue
+		}
+		to, err := notificationChannels[name].defaults(event)
+		if err != nil {
+			deliveries = append(deliveries, notificationDelivery{Channel: name, Error: err.Error()})
+		} else if len(to) > 0 {
+			deliveries = append(deliveries, notificationDelivery{Channel: name, To: to})
+		}
+	}
+	return deliveries
+}
+
+// dispatchNotification routes an event and, unless dryRun, sends it
+func dispatchNotification(event releaseEvent, dryRun bool) ([]notificationDelivery, error) {
+	rules, err := loadNotificationRules()
+	if err != nil {
+		return nil, fmt.Errorf("notification-rules.json: %w", err)
+	}
+	deliveries := routeNotification(event, rules)
+	if dryRun {
+		return deliveries, nil
+	}
+	for i, d := range deliveries {
+		if d.Error != "" {
+			continue
+		}
+		if err := notificationChannels[d.Channel].send(event, d.To); err != nil {
+			deliveries[i].Error = err.Error()
+		}
+	}
+	return deliveries, nil
+}
+
+// notifyChannels is the release event subscriber delivering to every
+// registered notification channel
+func notifyChannels(event releaseEvent) {
+	deliveries, err := dispatchNotification(event, false)
+	if err != nil {
+		logNotify.Error("Notifications failed", "release", event.ID, "err", err)
+		return
+	}
+	for _, d := range deliveries {
+		if d.Error != "" {
+			logNotify.Error("Notification failed", "channel", d.Channel, "release", event.ID, "err", d.Error)
+		}
+	}
+}
+
+// validateNotificationRules checks notification-rules.json: unique IDs,
+// known channels, event types and risk levels, valid reminders
+func validateNotificationRules(data interface{}) error {
+	var rules NotificationRulesData
+	if err := decodeInto(data, &rules); err != nil {
+		return fmt.Errorf("notification-rules.json has malformed rules: %v", err)
+	}
+	for _, s := range rules.Reminders {
+		if _, err := parseReminderOffset(s); err != nil {
+			return err
+		}
+	}
+	seen := map[string]bool{}
+	for i, rule := range rules.Rules {
+		if rule.ID == "" {
+			return fmt.Errorf("rule %d needs an id", i+1)
+		}
+		if seen[rule.ID] {
+			return fmt.Errorf("duplicate rule id %q", rule.ID)
+		}
+		seen[rule.ID] = true
+		if _, ok := notificationChannels[rule.Channel]; !ok {
+			return fmt.Errorf("rule %s: unknown channel %q", rule.ID, rule.Channel)
+		}
+		if len(rule.To) == 0 {
+			return fmt.Errorf("rule %s: needs at least one destination in to", rule.ID)
+		}
+		for _, e := range rule.Events {
+			if !notificationEventTypes[e] {
+				return fmt.Errorf("rule %s: unknown event type %q", rule.ID, e)
+			}
+		}
+		for _, r := range rule.Risks {
+			if !environmentTiers[r] {
+				return fmt.Errorf("rule %s: unknown risk %q, expected critical, high, medium or low", rule.ID, r)
+			}
+		}
+	}
+	return nil
+}
+
+// Handle notification-rules.json
+func handleNotificationRules(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Join(dataDir, "notification-rules.json")
+
+	switch r.Method {
+	case http.MethodGet:
+		serveJSONFile(w, filePath)
+	case http.MethodPost:
+		updateJSONFileWithBackup(w, r, filePath, maxBackupsFromRequest(r))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// notificationTestRequest is the body of POST /api/notification-rules/test:
+// an event for an existing release, or for a made-up one on an environment
+type notificationTestRequest struct {
+	Type        string   `json:"type"`
+	Release     string   `json:"release,omitempty"` // environment:date
+	Environment string   `json:"environment,omitempty"`
+	Labels      []string `json:"labels,omitempty"`
+	Risk        string   `json:"risk,omitempty"`
+	DryRun      bool     `json:"dryRun,omitempty"`
+}
+
+// Handle test-firing an event: reports the rules and destinations it is
+// routed to and, unless dryRun, delivers it
+func handleNotificationTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req notificationTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || !notificationEventTypes[req.Type] {
+		http.Error(w, "Invalid request body, expected {\"type\": event type, \"release\": \"environment:date\"}", http.StatusBadRequest)
+		return
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		http.Error(w, "Error reading environments", http.StatusInternalServerError)
+		return
+	}
+
+	env, release := req.Environment, ReleaseEntry{Date: today().Format(dateLayout), Status: "Planned", ReleaseName: "Test release"}
+	if req.Release != "" {
+		var date string
+		var ok bool
+		if env, date, ok = parseReleaseID(req.Release); !ok {
+			http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+			return
+		}
+		releases, err := loadReleases()
+		if err != nil {
+			http.Error(w, "Error reading releases", http.StatusInternalServerError)
+			return
+		}
+		found := false
+		for _, e := range releases[env] {
+			if e.Date == date {
+				release, found = e, true
+			}
+		}
+		if !found {
+			http.Error(w, "Release not found", http.StatusNotFound)
+			return
+		}
+	} else if env == "" {
+		http.Error(w, "Either release or environment is required", http.StatusBadRequest)
+		return
+	}
+	if req.Labels != nil {
+		release.Labels = req.Labels
+	}
+	if req.Risk != "" {
+		release.Risk = req.Risk
+	}
+
+	event := newReleaseEvent(req.Type, env, release, envs)
+	switch event.Type {
+	case eventMoved:
+		event.PreviousDate = event.Date
+		if n := len(release.Reschedules); n > 0 {
+			event.PreviousDate = release.Reschedules[n-1].From
+		}
+	case eventReminder:
+		event.Reminder = "24 hours"
+		event.Unapproved = needsApproval(release.Status)
+		event.OpenItems = release.openItems()
+	}
+	deliveries, err := dispatchNotification(event, req.DryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []notificationDelivery{}
+	}
+	resp := struct {
+		Event      releaseEvent           `json:"event"`
+		Deliveries []notificationDelivery `json:"deliveries"`
+	}{event, deliveries}
+
+	w.Header().Set("Content-Type", "application/json")
+	for _, d := range deliveries {
+		if d.Error != "" {
+			w.WriteHeader(http.StatusBadGateway)
+			break
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
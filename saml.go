@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SAMLConfig is saml-config.json, setting the planner up as a SAML 2.0
+// service provider. Users log in at the IdP and get a local account of
+// source "saml", updated from their attributes on every login.
+type SAMLConfig struct {
+	RootURL         string `json:"rootUrl"`                   // public URL of the planner, e.g. https://planner.example.com
+	EntityID        string `json:"entityId,omitempty"`        // default the metadata URL
+	IDPMetadataURL  string `json:"idpMetadataUrl,omitempty"`  // or idpMetadata
+	IDPMetadata     string `json:"idpMetadata,omitempty"`     // the IdP's metadata XML
+	CertificateFile string `json:"certificateFile,omitempty"` // PEM; with keyFile, requests are signed and assertions may be encrypted
+	KeyFile         string `json:"keyFile,omitempty"`
+
+	UsernameAttribute    string `json:"usernameAttribute,omitempty"`    // default the NameID
+	DisplayNameAttribute string `json:"displayNameAttribute,omitempty"` // default displayName
+	RolesAttribute       string `json:"rolesAttribute,omitempty"`       // default groups
+	// Roles maps a role (see roleRanks) to the values of rolesAttribute
+	// granting it; users get the highest they have. Users without any are
+	// planners, unless a role other than admin is mapped: then they may not
+	// log in. "user" is an alias of planner.
+	Roles map[string][]string `json:"roles,omitempty"`
+}
+
+// loadSAMLConfig reads saml-config.json; ok is false without a root URL
+// and IdP metadata
+func loadSAMLConfig() (cfg SAMLConfig, ok bool, err error) {
+	if err := readDataFile("saml-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.RootURL = strings.TrimSuffix(cfg.RootURL, "/")
+	if cfg.DisplayNameAttribute == "" {
+		cfg.DisplayNameAttribute = "displayName"
+	}
+	if cfg.RolesAttribute == "" {
+		cfg.RolesAttribute = "groups"
+	}
+	return cfg, cfg.RootURL != "" && (cfg.IDPMetadataURL != "" || cfg.IDPMetadata != ""), nil
+}
+
+// samlConfigured reports whether users log in with SAML
+func samlConfigured() bool {
+	_, ok, _ := loadSAMLConfig()
+	return ok
+}
+
+// idpMetadataCache holds the IdP metadata fetched from idpMetadataUrl, for
+// an hour
+var idpMetadataCache struct {
+	sync.Mutex
+	url       string
+	metadata  *saml.EntityDescriptor
+	fetchedAt time.Time
+}
+
+// parseIDPMetadata reads an EntityDescriptor, or the first of an
+// EntitiesDescriptor
+func parseIDPMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	var entity saml.EntityDescriptor
+	if err := xml.Unmarshal(data, &entity); err == nil {
+		return &entity, nil
+	}
+	var entities saml.EntitiesDescriptor
+	if err := xml.Unmarshal(data, &entities); err != nil {
+		return nil, fmt.Errorf("invalid IdP metadata: %w", err)
+	}
+	if len(entities.EntityDescriptors) == 0 {
+		return nil, errors.New("no entity in the IdP metadata")
+	}
+	return &entities.EntityDescriptors[0], nil
+}
+
+// idpMetadata returns the IdP's metadata, from the config or fetched
+func idpMetadata(cfg SAMLConfig) (*saml.EntityDescriptor, error) {
+	if cfg.IDPMetadata != "" {
+		return parseIDPMetadata([]byte(cfg.IDPMetadata))
+	}
+	idpMetadataCache.Lock()
+	defer idpMetadataCache.Unlock()
+	if idpMetadataCache.url == cfg.IDPMetadataURL && time.Since(idpMetadataCache.fetchedAt) < time.Hour {
+		return idpMetadataCache.metadata, nil
+	}
+	resp, err := maintenanceHTTPClient.Get(cfg.IDPMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("IdP metadata: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := parseIDPMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	idpMetadataCache.url, idpMetadataCache.metadata, idpMetadataCache.fetchedAt = cfg.IDPMetadataURL, metadata, time.Now()
+	return metadata, nil
+}
+
+// serviceProvider builds the SAML service provider of a config
+func serviceProvider(cfg SAMLConfig) (*saml.ServiceProvider, error) {
+	root, err := url.Parse(cfg.RootURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rootUrl: %w", err)
+	}
+	sp := &saml.ServiceProvider{
+		EntityID:          cfg.EntityID,
+		MetadataURL:       *root.JoinPath("/api/saml/metadata"),
+		AcsURL:            *root.JoinPath("/api/saml/acs"),
+		HTTPClient:        maintenanceHTTPClient,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if sp.EntityID == "" {
+		sp.EntityID = sp.MetadataURL.String()
+	}
+	if cfg.CertificateFile != "" && cfg.KeyFile != "" {
+		pair, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("SAML certificate: %w", err)
+		}
+		key, ok := pair.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("SAML key must be an RSA key")
+		}
+		sp.Key, sp.Certificate, sp.SignatureMethod = key, pair.Leaf, dsig.RSASHA256SignatureMethod
+	}
+	if sp.IDPMetadata, err = idpMetadata(cfg); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// samlRequest is a login in progress, keyed by its relay state
+type samlRequest struct {
+	id       string
+	redirect string
+	expires  time.Time
+}
+
+// samlRequests are the logins waiting for the IdP's response. Instances
+// sharing the data directory behind a cluster lock keep them in
+// samlRequestDir instead.
+var samlRequests = struct {
+	sync.Mutex
+	byRelayState map[string]samlRequest
+}{byRelayState: map[string]samlRequest{}}
+
+// samlRequestDir holds the logins in progress of instances sharing the data
+// directory, a file per login named by the hash of its relay state, as the
+// IdP may post the user back to any of them
+func samlRequestDir() string {
+	return filepath.Join(dataDir, "saml-requests")
+}
+
+// samlRequestRecord is a login's file of samlRequestDir
+type samlRequestRecord struct {
+	ID       string    `json:"id"`
+	Redirect string    `json:"redirect"`
+	Expires  time.Time `json:"expires"`
+}
+
+// readSAMLRequest reads a login's file, false when it has none
+func readSAMLRequest(path string) (samlRequest, bool) {
+	var rec samlRequestRecord
+	b, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(b, &rec) != nil {
+		return samlRequest{}, false
+	}
+	return samlRequest{id: rec.ID, redirect: rec.Redirect, expires: rec.Expires}, true
+}
+
+// storeSAMLRequest keeps a login in progress, forgetting the expired ones
+func storeSAMLRequest(relayState string, p samlRequest) error {
+	now := time.Now()
+	if clusterConfig == nil {
+		samlRequests.Lock()
+		defer samlRequests.Unlock()
+		for k, other := range samlRequests.byRelayState {
+			if now.After(other.expires) {
+				delete(samlRequests.byRelayState, k)
+			}
+		}
+		samlRequests.byRelayState[relayState] = p
+		return nil
+	}
+	paths, _ := filepath.Glob(filepath.Join(samlRequestDir(), "*.json"))
+	for _, path := range paths {
+		if other, ok := readSAMLRequest(path); !ok || now.After(other.expires) {
+			os.Remove(path)
+		}
+	}
+	if err := os.MkdirAll(samlRequestDir(), 0700); err != nil {
+		return err
+	}
+	b, err := json.Marshal(samlRequestRecord{ID: p.id, Redirect: p.redirect, Expires: p.expires})
+	if err != nil {
+		return err
+	}
+	return replaceFile(filepath.Join(samlRequestDir(), hashAPIKey(relayState)+".json"), b, 0600)
+}
+
+// takeSAMLRequest returns a login in progress and forgets it, so its
+// response is only taken once
+func takeSAMLRequest(relayState string) (samlRequest, bool) {
+	if clusterConfig != nil {
+		path := filepath.Join(samlRequestDir(), hashAPIKey(relayState)+".json")
+		p, ok := readSAMLRequest(path)
+		// Of a response posted twice, the instance removing the file takes it
+		return p, ok && os.Remove(path) == nil
+	}
+	samlRequests.Lock()
+	defer samlRequests.Unlock()
+	p, ok := samlRequests.byRelayState[relayState]
+	delete(samlRequests.byRelayState, relayState)
+	return p, ok
+}
+
+// localRedirect returns a path on this server to go back to, "/" for
+// anything else
+func localRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+// Handle starting a SAML login: redirects to the IdP, which posts the
+// user back to /api/saml/acs; ?redirect= is where to go afterwards
+func handleSAMLLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadSAMLConfig()
+	if err != nil || !ok {
+		http.Error(w, "SAML is not configured", http.StatusNotFound)
+		return
+	}
+	sp, err := serviceProvider(cfg)
+	if err != nil {
+		logAuth.ErrorContext(r.Context(), "SAML is misconfigured", "err", err)
+		http.Error(w, "SAML is misconfigured, see the server log", http.StatusInternalServerError)
+		return
+	}
+	req, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		logAuth.ErrorContext(r.Context(), "SAML is misconfigured", "err", err)
+		http.Error(w, "SAML is misconfigured, see the server log", http.StatusInternalServerError)
+		return
+	}
+	relayState := newToken(16)
+	target, err := req.Redirect(relayState, sp)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building the SAML request: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	err = storeSAMLRequest(relayState, samlRequest{id: req.ID, redirect: localRedirect(r.URL.Query().Get("redirect")),
+		expires: time.Now().Add(10 * time.Minute)})
+	if err != nil {
+		logAuth.ErrorContext(r.Context(), "Could not keep the SAML login", "err", err)
+		http.Error(w, "Could not start the SAML login", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// samlAttribute returns the values of an assertion's attribute, matched by
+// name or friendly name
+func samlAttribute(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if attr.Name == name || attr.FriendlyName == name {
+				for _, v := range attr.Values {
+					values = append(values, v.Value)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// samlRole maps an assertion to the user's role, "" when they may not log in
+func samlRole(cfg SAMLConfig, assertion *saml.Assertion) string {
+	values := samlAttribute(assertion, cfg.RolesAttribute)
+	has := func(role string) bool {
+		for _, want := range cfg.Roles[role] {
+			if anyOf(values, want) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, role := range []string{"admin", "approver", "planner", "viewer"} {
+		if has(role) || role == "planner" && has("user") {
+			return role
+		}
+	}
+	for role, values := range cfg.Roles {
+		if role != "admin" && len(values) > 0 {
+			return ""
+		}
+	}
+	return defaultRole
+}
+
+// Handle the IdP posting a SAML response back: verifies it, provisions the
+// user's account and logs them in
+func handleSAMLACS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadSAMLConfig()
+	if err != nil || !ok {
+		http.Error(w, "SAML is not configured", http.StatusNotFound)
+		return
+	}
+	sp, err := serviceProvider(cfg)
+	if err != nil {
+		logAuth.ErrorContext(r.Context(), "SAML is misconfigured", "err", err)
+		http.Error(w, "SAML is misconfigured, see the server log", http.StatusInternalServerError)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	relayState := r.PostForm.Get("RelayState")
+	pending, ok := takeSAMLRequest(relayState)
+	if !ok || time.Now().After(pending.expires) {
+		http.Error(w, "Unknown or expired SAML login, please try again", http.StatusForbidden)
+		return
+	}
+
+	assertion, err := sp.ParseResponse(r, []string{pending.id})
+	if err != nil {
+		var invalid *saml.InvalidResponseError
+		if errors.As(err, &invalid) {
+			err = invalid.PrivateErr
+		}
+		logAuth.WarnContext(r.Context(), "SAML login failed", "err", err)
+		http.Error(w, "SAML login failed", http.StatusForbidden)
+		return
+	}
+
+	username := ""
+	if cfg.UsernameAttribute != "" {
+		if values := samlAttribute(assertion, cfg.UsernameAttribute); len(values) > 0 {
+			username = values[0]
+		}
+	} else if assertion.Subject != nil && assertion.Subject.NameID != nil {
+		username = assertion.Subject.NameID.Value
+	}
+	role := samlRole(cfg, assertion)
+	if role == "" {
+		logAuth.WarnContext(r.Context(), "SAML login refused, no role", "user", username)
+		http.Error(w, "You have no role in the release planner", http.StatusForbidden)
+		return
+	}
+	displayName := ""
+	if values := samlAttribute(assertion, cfg.DisplayNameAttribute); len(values) > 0 {
+		displayName = values[0]
+	}
+	user, err := provisionAccount(r.Context(), username, displayName, role, "saml")
+	if err != nil {
+		logAuth.WarnContext(r.Context(), "SAML login refused", "user", username, "err", err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := startSession(w, r, user.Username); err != nil {
+		http.Error(w, fmt.Sprintf("Error starting the session: %v", err), http.StatusInternalServerError)
+		return
+	}
+	logAuth.InfoContext(r.Context(), "Logged in with SAML", "user", user.Username, "remote", clientIP(r))
+	http.Redirect(w, r, pending.redirect, http.StatusSeeOther)
+}
+
+// Handle the service provider metadata to register the planner at the IdP
+func handleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, ok, err := loadSAMLConfig()
+	if err != nil || !ok {
+		http.Error(w, "SAML is not configured", http.StatusNotFound)
+		return
+	}
+	sp, err := serviceProvider(cfg)
+	if err != nil {
+		logAuth.ErrorContext(r.Context(), "SAML is misconfigured", "err", err)
+		http.Error(w, "SAML is misconfigured, see the server log", http.StatusInternalServerError)
+		return
+	}
+	data, err := xml.MarshalIndent(sp.Metadata(), "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
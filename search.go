@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// searchDoc is a single indexed record
+type searchDoc struct {
+	ID          string `json:"id"`
+	Type        string `json:"type"`
+	Source      string `json:"source"`
+	Environment string `json:"environment,omitempty"`
+	Date        string `json:"date"`
+	Title       string `json:"title"`
+	Text        string `json:"text,omitempty"`
+}
+
+// searchHit is a document matched by a query
+type searchHit struct {
+	searchDoc
+	Score int `json:"score"`
+}
+
+// invertedIndex maps tokens to the documents containing them, so queries
+// don't need to re-read and scan the data files
+type invertedIndex struct {
+	mu       sync.RWMutex
+	docs     map[string]searchDoc
+	postings map[string]map[string]int // token -> doc ID -> occurrences
+	bySource map[string][]string       // source file -> doc IDs
+}
+
+var searchIndex = newInvertedIndex()
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		docs:     map[string]searchDoc{},
+		postings: map[string]map[string]int{},
+		bySource: map[string][]string{},
+	}
+}
+
+// tokenize lowercases text and splits it on anything that isn't a letter or digit
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// add indexes a document; the caller must hold the write lock
+func (idx *invertedIndex) add(doc searchDoc) {
+	idx.docs[doc.ID] = doc
+	idx.bySource[doc.Source] = append(idx.bySource[doc.Source], doc.ID)
+	for _, tok := range tokenize(doc.Title + " " + doc.Text) {
+		if idx.postings[tok] == nil {
+			idx.postings[tok] = map[string]int{}
+		}
+		idx.postings[tok][doc.ID]++
+	}
+}
+
+// removeSource drops every document that came from a data file; the caller
+// must hold the write lock
+func (idx *invertedIndex) removeSource(source string) {
+	for _, id := range idx.bySource[source] {
+		doc := idx.docs[id]
+		for _, tok := range tokenize(doc.Title + " " + doc.Text) {
+			delete(idx.postings[tok], id)
+			if len(idx.postings[tok]) == 0 {
+				delete(idx.postings, tok)
+			}
+		}
+		delete(idx.docs, id)
+	}
+	delete(idx.bySource, source)
+}
+
+// reindexFile rebuilds the documents of a single data file
+func (idx *invertedIndex) reindexFile(filename string) {
+	var docs []searchDoc
+	switch filename {
+	case "releases.json":
+		releases, err := loadReleases()
+		if err != nil {
+			logSearch.Error("Could not index releases", "err", err)
+			return
+		}
+		for env, entries := range releases {
+			for _, e := range entries {
+				title := e.ReleaseName
+				if title == "" {
+					title = strings.TrimSpace(e.Status + " " + env)
+				}
+				docs = append(docs, searchDoc{
+					ID:          releaseID(env, e.Date),
+					Type:        "release",
+					Source:      filename,
+					Environment: env,
+					Date:        e.Date,
+					Title:       title,
+					Text:        strings.Join(strings.Fields(strings.Join([]string{e.Status, e.FeTag, e.BeTag, e.JiraTicket, strings.Join(e.Tickets, " "), e.Note}, " ")), " "),
+				})
+			}
+		}
+	case "holidays.json":
+		holidays, err := loadHolidays()
+		if err != nil {
+			logSearch.Error("Could not index holidays", "err", err)
+			return
+		}
+		for _, h := range holidays.Holidays {
+			docs = append(docs, searchDoc{
+				ID:     "holiday:" + h.Date,
+				Type:   "holiday",
+				Source: filename,
+				Date:   h.Date,
+				Title:  h.Name,
+			})
+		}
+	default:
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeSource(filename)
+	for _, doc := range docs {
+		idx.add(doc)
+	}
+}
+
+// rebuild indexes all searchable data files from scratch
+func (idx *invertedIndex) rebuild() {
+	for _, name := range []string{"releases.json", "holidays.json"} {
+		idx.reindexFile(name)
+	}
+}
+
+// search returns documents containing every query term. The last term is
+// matched as a prefix so partially typed words still find results.
+func (idx *invertedIndex) search(query, docType string, limit int) []searchHit {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []searchHit{}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[string]int
+	for i, term := range terms {
+		matches := map[string]int{}
+		if i == len(terms)-1 {
+			for tok, postings := range idx.postings {
+				if strings.HasPrefix(tok, term) {
+					for id, n := range postings {
+						matches[id] += n
+					}
+				}
+			}
+		} else {
+			for id, n := range idx.postings[term] {
+				matches[id] = n
+			}
+		}
+
+		if scores == nil {
+			scores = matches
+			continue
+		}
+		for id := range scores {
+			if n, ok := matches[id]; ok {
+				scores[id] += n
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]searchHit, 0, len(scores))
+	for id, score := range scores {
+		doc := idx.docs[id]
+		if docType != "" && doc.Type != docType {
+			continue
+		}
+		hits = append(hits, searchHit{searchDoc: doc, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Date > hits[j].Date
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Handle full-text search over release notes and holidays
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		http.Error(w, "Missing 'q' parameter", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			limit = n
+		}
+	}
+
+	hits := searchIndex.search(query, r.URL.Query().Get("type"), limit)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The key that encrypts credentials in data files comes from
+// RELPLANNER_SECRET_KEY, or from the file named by RELPLANNER_SECRET_KEY_FILE
+// such as one rendered by a Vault agent. Without a key secrets stay plaintext.
+const (
+	secretKeyEnv     = "RELPLANNER_SECRET_KEY"
+	secretKeyFileEnv = "RELPLANNER_SECRET_KEY_FILE"
+	encryptedPrefix  = "enc:v1:"
+)
+
+// secretKey derives the AES-256 key; nil when no key is configured
+func secretKey() ([]byte, error) {
+	value := os.Getenv(secretKeyEnv)
+	if path := os.Getenv(secretKeyFileEnv); value == "" && path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", secretKeyFileEnv, err)
+		}
+		value = string(b)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(value))
+	return sum[:], nil
+}
+
+// secretCipher returns the AEAD for the configured key, nil without one
+func secretCipher() (cipher.AEAD, error) {
+	key, err := secretKey()
+	if err != nil || key == nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted reports whether a value was written by encryptSecret
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// encryptSecret seals a value with AES-GCM as enc:v1:base64(nonce|ciphertext)
+func encryptSecret(aead cipher.AEAD, plain string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret opens a value sealed by encryptSecret
+func decryptSecret(aead cipher.AEAD, value string) (string, error) {
+	if aead == nil {
+		return "", fmt.Errorf("credentials are encrypted but %s is not set", secretKeyEnv)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt credentials, check %s", secretKeyEnv)
+	}
+	return string(plain), nil
+}
+
+// encryptJiraSecrets encrypts the plaintext secrets of a Jira config in
+// place. It reports whether anything changed; without a key it is a no-op.
+func encryptJiraSecrets(config map[string]interface{}) (bool, error) {
+	aead, err := secretCipher()
+	if err != nil || aead == nil {
+		return false, err
+	}
+	changed := false
+	for _, section := range jiraConfigSections(config) {
+		for _, field := range jiraSecretFields {
+			v, _ := section[field].(string)
+			if v == "" || v == jiraSecretMask || isEncrypted(v) {
+				continue
+			}
+			if section[field], err = encryptSecret(aead, v); err != nil {
+				return changed, err
+			}
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// decryptJiraSecrets decrypts the secrets of a Jira config in place;
+// plaintext values from before encryption was set up pass through
+func decryptJiraSecrets(config map[string]interface{}) error {
+	aead, err := secretCipher()
+	if err != nil {
+		return err
+	}
+	for _, section := range jiraConfigSections(config) {
+		for _, field := range jiraSecretFields {
+			v, _ := section[field].(string)
+			if !isEncrypted(v) {
+				continue
+			}
+			if section[field], err = decryptSecret(aead, v); err != nil {
+				return fmt.Errorf("%s: %w", field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// migrateJiraSecrets encrypts the plaintext secrets left in jira-config.json
+// and its backups once a key is configured. It runs at startup.
+func migrateJiraSecrets() error {
+	if aead, err := secretCipher(); err != nil || aead == nil {
+		return err
+	}
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(backupDir, "jira-config.*.json"))
+	paths = append(paths, filepath.Join(dataDir, "jira-config.json"))
+	for _, path := range paths {
+		b, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		var config map[string]interface{}
+		if err := json.Unmarshal(b, &config); err != nil {
+			logJira.Warn("Skipping secret migration", "file", path, "err", err)
+			continue
+		}
+		changed, err := encryptJiraSecrets(config)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		out, err := json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, out, 0644); err != nil {
+			return err
+		}
+		if filepath.Dir(path) == filepath.Clean(backupDir) {
+			writeChecksum(path)
+		}
+		logJira.Info("Encrypted Jira credentials", "file", path)
+	}
+	return nil
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/andygrunwald/go-jira"
@@ -28,68 +34,383 @@ const (
 	defaultMaxBackups = 10
 )
 
-func main() {
-	// Create log file
-	logFile, err := os.OpenFile("server.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+// serve runs the server, the default command
+func serve() {
+	// Create log file, rotated as logging-config.json says; the config's
+	// errors are reported once logging is configured
+	var logCfg LoggingConfig
+	readDataFile("logging-config.json", &logCfg)
+	logFile, err := openRotatingFile("server.log", logCfg.Rotation)
 	if err != nil {
 		log.Fatal("Failed to open log file:", err)
 	}
 	defer logFile.Close()
 
-	// Set log output to both file and console
-	log.SetOutput(io.MultiWriter(os.Stdout, logFile))
+	// Log to both file and console, as logging-config.json says
+	if err := configureLogging(io.MultiWriter(os.Stdout, logFile)); err != nil {
+		logServer.Error("Invalid logging config", "err", err)
+	}
 
 	// Create data directory if it doesn't exist
 	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(dataDir, 0755); err != nil {
-			log.Fatalf("Failed to create data directory: %v", err)
+			logServer.Error("Failed to create data directory", "dir", dataDir, "err", err)
+			os.Exit(1)
 		}
 	}
 
 	// Create backup directory if it doesn't exist
 	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
 		if err := os.MkdirAll(backupDir, 0755); err != nil {
-			log.Printf("Creating backup directory: %s", backupDir)
+			logServer.Info("Creating backup directory", "dir", backupDir)
 			if err := os.MkdirAll(backupDir, 0755); err != nil {
-				log.Fatalf("Failed to create backup directory: %v", err)
+				logServer.Error("Failed to create backup directory", "dir", backupDir, "err", err)
+				os.Exit(1)
 			}
 		}
 	}
 
+	// Site-specific ticket providers, validators and notifiers
+	loadPlugins()
+
+	// Lock shared with other instances on the same data directory
+	if err := loadCluster(); err != nil {
+		logServer.Error("Failed to set up the write lock", "err", err)
+		os.Exit(1)
+	}
+
+	// Warm standby following a primary, when replication-config.json names one
+	if err := startReplication(); err != nil {
+		logServer.Error("Failed to start replication", "err", err)
+	}
+	standby := standbyMode()
+	http.HandleFunc("/api/replication", handleReplication)
+	http.HandleFunc("/api/replication/manifest", handleReplicationManifest)
+	http.HandleFunc("/api/replication/files/{name}", handleReplicationFile)
+	http.HandleFunc("/api/replication/backups/{name}", handleReplicationFile)
+
+	// Runtime statistics beside pprof's /debug/pprof/, both for admins only
+	http.HandleFunc("/debug/runtime", handleRuntimeStats)
+
+	// GraphQL queries over the planning data
+	http.HandleFunc("/api/graphql", handleGraphQL)
+
+	// Live updates of the data files saved, over a WebSocket
+	http.HandleFunc("/api/ws", handleLiveUpdates)
+
+	// Changes since a cursor, for clients polling rather than listening
+	http.HandleFunc("/api/changes", handleChanges)
+
+	// Who is editing what, from the heartbeats of open editors
+	http.HandleFunc("/api/presence", handlePresence)
+
+	// Three-way merge of saves refused for a stale If-Match
+	http.HandleFunc("/api/merge/{file}", handleMerge)
+
+	// Undo and redo of recent saves, apart from the backups
+	http.HandleFunc("/api/undo", handleUndo)
+	http.HandleFunc("/api/redo", handleUndo)
+
+	// Record by record comparison of versions of a data file
+	http.HandleFunc("/api/diff", handleDiff)
+
+	// Optional subsystems enabled by their configs
+	http.HandleFunc("/api/features", handleFeatures)
+
+	// OpenAPI document of the API and its Swagger UI
+	http.HandleFunc("/api/openapi.json", handleOpenAPI)
+	http.HandleFunc("/api/docs", handleDocs)
+	http.HandleFunc("/api/docs/", handleDocs)
+
+	// Export traces when tracing-config.json names a collector
+	if err := startTracing(); err != nil {
+		logServer.Error("Invalid tracing config", "err", err)
+	}
+
+	// Encrypt credentials stored before a secret key was configured
+	if err := migrateJiraSecrets(); err != nil {
+		logJira.Warn("Could not encrypt Jira credentials", "err", err)
+	}
+
+	// Local accounts, or the first admin's setup token when there are none
+	initAccounts()
+
 	// File server for static files (HTML, CSS, JS)
 	fs := http.FileServer(http.Dir("./static"))
 
 	// Register handlers
 	http.Handle("/", fs)
-	http.HandleFunc("/api/environments.json", handleEmployees)
-	http.HandleFunc("/api/releases.json", handleDaysOff)
+	http.HandleFunc("/api/environments.json", handleEnvironments)
+	http.HandleFunc("/api/environments/{name}", handleEnvironmentRecord)
+	http.HandleFunc("/api/environments/{name}/lock", handleEnvironmentLock)
+	http.HandleFunc("/api/environments/{name}/clone", handleEnvironmentClone)
+	http.HandleFunc("/api/releases/{id}/promote", handleReleasePromote)
+	http.HandleFunc("/api/team", handleTeam)
+	http.HandleFunc("/api/releases/{id}/assignments", handleReleaseAssignments)
+	http.HandleFunc("/api/releases/{id}/tickets", handleReleaseTickets)
+	http.HandleFunc("/api/releases/{id}/tickets/{key}", handleReleaseTicket)
+	http.HandleFunc("/api/absences", handleAbsences)
+	http.HandleFunc("/api/absences/overlaps", handleAbsenceOverlaps)
+	http.HandleFunc("/api/permissions.json", handlePermissions)
+	http.HandleFunc("/api/login", handleLogin)
+	http.HandleFunc("/api/logout", handleLogout)
+	http.HandleFunc("/api/setup", handleSetup)
+	http.HandleFunc("/api/saml/login", handleSAMLLogin)
+	http.HandleFunc("/api/saml/acs", handleSAMLACS)
+	http.HandleFunc("/api/saml/metadata", handleSAMLMetadata)
+	http.HandleFunc("/api/me", handleMe)
+	http.HandleFunc("/api/me/password", handleMyPassword)
+	http.HandleFunc("/api/me/preferences", handleMyPreferences)
+	http.HandleFunc("/api/users", handleUsers)
+	http.HandleFunc("/api/users/{username}", handleUser)
+	http.HandleFunc("/api/api-keys", handleAPIKeys)
+	http.HandleFunc("/api/api-keys/{id}", handleAPIKey)
+	http.HandleFunc("/api/me/permissions", handleMyPermissions)
+	http.HandleFunc("/api/whoami", handleWhoami)
+	http.HandleFunc("/api/groups", handleGroups)
+	http.HandleFunc("/api/groups/{name}", handleGroup)
+	http.HandleFunc("/api/releases.json", handleReleases)
 	http.HandleFunc("/api/holidays.json", handleHolidays)
-	http.HandleFunc("/api/jira-tickets", handleJiraTickets)
+	http.HandleFunc("/api/data", handleDatasets)
+	http.HandleFunc("/api/data/{name}", handleDataset)
+	http.HandleFunc("/api/ticket-providers", handleTicketProviders)
+	http.HandleFunc("/api/tickets/{provider}", handleTickets)
+	http.HandleFunc("/api/jira-tickets", ticketsHandler("jira"))
+	http.HandleFunc("/api/jira/webhook", handleJiraWebhook)
+	http.HandleFunc("/api/jira/sprints", handleJiraSprints)
+	http.HandleFunc("/api/jira-config", handleJiraConfig)
+	http.HandleFunc("/api/jira/validate-jql", handleValidateJQL)
+	http.HandleFunc("/api/github/tickets", ticketsHandler("github"))
+	http.HandleFunc("/api/github/milestones", handleGitHubMilestones)
+	onDataChange(syncGitHubOnChange)
+	http.HandleFunc("/api/gitlab/tickets", ticketsHandler("gitlab"))
+	http.HandleFunc("/api/gitlab/milestones", handleGitLabMilestones)
+	http.HandleFunc("/api/ado/tickets", ticketsHandler("ado"))
+	http.HandleFunc("/api/ado/iterations", handleADOIterations)
+	http.HandleFunc("/api/linear/tickets", ticketsHandler("linear"))
+	http.HandleFunc("/api/linear/cycles", handleLinearCycles)
+	onDataChange(syncJiraOnChange)
+
+	// Jira is fetched in the background, requests read the cache
+	http.HandleFunc("/api/jira/status", handleJiraStatus)
+	onDataChange(refreshJiraOnChange)
+	go runJiraRefresh()
 
 	// Add new handlers for backup management
 	http.HandleFunc("/api/backups", handleBackups)
 	http.HandleFunc("/api/backup-settings", handleBackupSettings)
 
-	// Setup logger middleware
-	loggedRouter := logMiddleware(http.DefaultServeMux)
+	// Full-text search, kept current through the data change hooks
+	searchIndex.rebuild()
+	onDataChange(searchIndex.reindexFile)
+	http.HandleFunc("/api/search", handleSearch)
+
+	// Aggregated views
+	http.HandleFunc("/api/dashboard", handleDashboard)
+	http.HandleFunc("/api/timeline", handleTimeline)
+	http.HandleFunc("/api/plan", handlePlan)
+	http.HandleFunc("/api/calendar.svg", handleCalendarImage)
+	http.HandleFunc("/api/confluence/calendar", handleConfluenceCalendar)
+	if !standby {
+		startJob(runConfluencePublisher)
+	}
+	http.HandleFunc("/api/next-release", handleNextRelease)
+
+	// Read-only status API, optionally on its own listener
+	http.HandleFunc("/api/public/status", handlePublicStatus)
+	startPublicListener()
+
+	// Reporting
+	http.HandleFunc("/api/analytics/frequency", handleAnalyticsFrequency)
+	http.HandleFunc("/api/analytics/utilization", handleAnalyticsUtilization)
+	http.HandleFunc("/api/analytics/dora", handleAnalyticsDORA)
+	http.HandleFunc("/api/analytics/slippage", handleAnalyticsSlippage)
+	http.HandleFunc("/api/analytics/change-failure", handleAnalyticsChangeFailure)
+
+	// Alerting maintenance windows follow the release plan
+	onDataChange(syncMaintenanceOnChange)
+	http.HandleFunc("/api/maintenance-windows", handleMaintenanceWindows)
+
+	// Release event notifications
+	initReleaseEvents()
+	onDataChange(releaseEventsOnChange)
+	onReleaseEvent(notifyChannels)
+	http.HandleFunc("/api/notification-rules", handleNotificationRules)
+	http.HandleFunc("/api/notification-rules/test", handleNotificationTest)
+	if !standby {
+		startJob(runReminders)
+	}
+
+	// Releases scheduled by external systems
+	http.HandleFunc("/api/inbound/releases", handleInboundReleases)
+
+	// Signed outbound webhooks for data changes and release events
+	onDataChange(webhooksOnChange)
+	http.HandleFunc("/api/webhooks/deliveries", handleWebhookDeliveries)
+	http.HandleFunc("/api/webhooks/deliveries/{id}/redeliver", handleWebhookRedeliver)
+	if !standby {
+		startJob(runEmailSchedule)
+	}
+
+	// The managed data files for desktop tools
+	http.HandleFunc("/dav/", handleWebDAV)
+
+	// Off-box copies of the data on a cloud drive
+	http.HandleFunc("/api/cloud-export", handleCloudExport)
+	if !standby {
+		startJob(runCloudExport)
+	}
+	http.HandleFunc("/api/email/digest", handleEmailDigest)
+	http.HandleFunc("/api/integrations/slack/command", handleSlackCommand)
+
+	// Scheduled maintenances on the public status page
+	onDataChange(syncStatusPageOnChange)
+	http.HandleFunc("/api/statuspage/maintenances", handleStatusPageMaintenances)
+
+	// ServiceNow change requests for approved releases
+	onDataChange(syncChangeRequestsOnChange)
+	http.HandleFunc("/api/servicenow/changes", handleChangeRequests)
+	if !standby {
+		startJob(pollChangeRequests)
+	}
+
+	// Hash-chained audit log of every change
+	http.HandleFunc("/api/audit", handleAuditQuery)
+	http.HandleFunc("/api/audit/verify", handleAuditVerify)
+	startJob(runAuditRetention)
+	go runLogForwarding()
+
+	// Bulk import of releases and holidays, e.g. from spreadsheets
+	http.HandleFunc("/api/import/bulk", handleBulkImport)
+
+	// Inventory and reload of the data directory, for admins
+	http.HandleFunc("/api/admin/files", handleAdminFiles)
+	http.HandleFunc("/api/admin/reload", handleAdminReload)
+
+	// Change Advisory Board agenda of a week's releases
+	http.HandleFunc("/api/cab/agenda", handleCABAgenda)
+
+	// Deployments through Jenkins, GitHub Actions and GitLab CI
+	http.HandleFunc("/api/releases/{id}/deploy", handleReleaseDeploy)
+	onDataChange(dispatchWorkflowsOnChange)
+	http.HandleFunc("/api/integrations/github/webhook", handleGitHubWebhook)
+	if !standby {
+		startJob(resumeDeploymentWatches)
+	}
+
+	// Versions deployed by ArgoCD and running on Kubernetes
+	http.HandleFunc("/api/argocd/versions", handleArgoCDVersions)
+	http.HandleFunc("/api/kubernetes/versions", handleKubernetesVersions)
+	go runKubernetesRefresh()
+
+	// How releases actually went and what was learned from them
+	http.HandleFunc("/api/releases/{id}/outcome", handleReleaseOutcome)
+	http.HandleFunc("/api/releases/{id}/retrospective", handleReleaseRetrospective)
+	http.HandleFunc("/api/releases/{id}/incidents", handleReleaseIncidents)
+	http.HandleFunc("/api/releases/{id}/incidents/{incident}", handleReleaseIncident)
+	http.HandleFunc("/api/retrospectives", handleRetrospectives)
+
+	// Edits made to the data files outside the server
+	if err := startDataWatcher(); err != nil {
+		logServer.Error("Failed to watch the data directory", "err", err)
+	}
+
+	// Liveness and readiness probes
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
+
+	// Workspaces of their own, served by servers of their own
+	if err := startWorkspaces(); err != nil {
+		logServer.Error("Failed to start workspaces", "err", err)
+	}
+	http.HandleFunc("/api/workspaces", handleWorkspaces)
+	http.HandleFunc("/w/{workspace}", handleWorkspaceSwitch)
+	http.HandleFunc("/w/", handleWorkspaceSwitch)
+
+	// gRPC API beside the HTTP one, when grpc-config.json gives an address
+	if err := startGRPC(); err != nil {
+		logServer.Error("Failed to start the gRPC server", "err", err)
+	}
+
+	// Setup localization, request ID, tracing, logger, workspace, compression, caching, network, CORS, rate limit, login and standby middleware
+	loggedRouter := localizeErrors(requestID(traceRequests(logMiddleware(routeWorkspaces(compress(cacheControl(restrictNetworks(cors(rateLimit(requireLogin(requireRole(requireDebugAdmin(rejectStandbyWrites(http.DefaultServeMux))))))))))))))
 
 	// Start the server
-	serverAddr := fmt.Sprintf(":%d", port)
-	log.Printf("Starting server on %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, loggedRouter))
+	listener, err := serverListener()
+	if err != nil {
+		logServer.Error("Failed to listen", "err", err)
+		os.Exit(1)
+	}
+	logServer.Info("Starting server", "addr", listener.Addr().String())
+	err = http.Serve(listener, loggedRouter)
+	logServer.Error("Server stopped", "err", err)
+	os.Exit(1)
+}
+
+// dataChangeHooks are called with the base filename after a data file is written
+var dataChangeHooks []func(filename string)
+
+// onDataChange registers a hook to run after data file writes
+func onDataChange(fn func(filename string)) {
+	dataChangeHooks = append(dataChangeHooks, fn)
+}
+
+// notifyDataChange runs all registered data change hooks
+func notifyDataChange(filename string) {
+	for _, fn := range dataChangeHooks {
+		fn(filename)
+	}
 }
 
 // Logger middleware
 func logMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		next.ServeHTTP(w, r)
-		log.Printf("%s %s %s", r.Method, r.RequestURI, time.Since(start))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		duration := time.Since(start)
+		user, remote := requestUser(r), clientIP(r)
+		// Probes would drown the other requests
+		level := slog.LevelInfo
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			level = slog.LevelDebug
+		}
+		logHTTP.Log(r.Context(), level, "Request", "method", r.Method, "uri", r.RequestURI, "status", rec.status,
+			"durationMs", float64(duration.Microseconds())/1000, "user", modifierName(user), "remote", remote)
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			forwardAccess(accessEvent{Method: r.Method, Path: r.URL.Path, Status: rec.status,
+				Duration: duration.Milliseconds(), User: user, Remote: remote, ID: requestIDFrom(r.Context())})
+		}
 	})
 }
 
+// statusRecorder notes the status of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// Hijack hands the connection over to WebSockets, which switch protocols
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(s.ResponseWriter).Hijack()
+	if err == nil {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
 // Handle environments.json
-func handleEmployees(w http.ResponseWriter, r *http.Request) {
+func handleEnvironments(w http.ResponseWriter, r *http.Request) {
 	filePath := filepath.Join(dataDir, "environments.json")
 
 	switch r.Method {
@@ -111,7 +432,7 @@ func handleEmployees(w http.ResponseWriter, r *http.Request) {
 }
 
 // Handle releases.json
-func handleDaysOff(w http.ResponseWriter, r *http.Request) {
+func handleReleases(w http.ResponseWriter, r *http.Request) {
 	filePath := filepath.Join(dataDir, "releases.json")
 
 	switch r.Method {
@@ -132,131 +453,246 @@ func handleDaysOff(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Handle Jira tickets API
-func handleJiraTickets(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// jiraError carries the HTTP status and message to report for a failed Jira call
+type jiraError struct {
+	status int
+	msg    string
+}
+
+func (e *jiraError) Error() string { return e.msg }
+
+// writeJiraError reports a failed Jira call to the client
+func writeJiraError(w http.ResponseWriter, err error) {
+	var jerr *jiraError
+	if errors.As(err, &jerr) {
+		http.Error(w, jerr.msg, jerr.status)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
+}
+
+// Jira searches are paged; defaultJiraResultLimit applies without
+// maxTotalResults in jira-config.json and jiraResultHardCap bounds it
+const (
+	defaultJiraResultLimit = 1000
+	jiraResultHardCap      = 5000
+)
 
-	// Read Jira config
+// readJiraConfigFile reads jira-config.json with its secrets decrypted, see
+// loadJiraProfile
+func readJiraConfigFile() (map[string]interface{}, error) {
 	configPath := filepath.Join(dataDir, "jira-config.json")
 	configData, err := os.ReadFile(configPath)
 	if err != nil {
-		http.Error(w, "Failed to read Jira config", http.StatusInternalServerError)
-		return
+		return nil, &jiraError{http.StatusInternalServerError, "Failed to read Jira config"}
 	}
 
 	var config map[string]interface{}
 	if err := json.Unmarshal(configData, &config); err != nil {
-		http.Error(w, "Invalid Jira config", http.StatusInternalServerError)
-		return
+		return nil, &jiraError{http.StatusInternalServerError, "Invalid Jira config"}
 	}
+	if err := decryptJiraSecrets(config); err != nil {
+		return nil, &jiraError{http.StatusInternalServerError, fmt.Sprintf("Jira config: %v", err)}
+	}
+	return config, nil
+}
 
-	// Check if API token and username are configured
-	apiToken, hasToken := config["apiToken"].(string)
-	username, hasUsername := config["username"].(string)
-
-	if !hasToken || !hasUsername || apiToken == "" || username == "" {
-		// Return empty array if not configured
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte("[]"))
-		return
+// newJiraClient returns an authenticated client for the default Jira profile
+// along with its config. A nil client without error means Jira isn't configured.
+func newJiraClient(ctx context.Context) (*jira.Client, map[string]interface{}, error) {
+	config, err := loadJiraConfig()
+	if err != nil {
+		return nil, nil, err
 	}
+	return newJiraClientFor(ctx, config)
+}
 
-	// Create Jira client using the library
-	baseUrl := config["baseUrl"].(string)
-	jql := config["jql"].(string)
-	maxResults := int(config["maxResults"].(float64))
+// newJiraClientFor returns an authenticated client for a Jira profile config
+func newJiraClientFor(ctx context.Context, config map[string]interface{}) (*jira.Client, map[string]interface{}, error) {
+
+	// authType selects how the API token is sent: "basic" (Jira Cloud:
+	// account email + API token) or "bearer" (Data Center personal access
+	// token). Unset, it follows the detected deployment, see jiraAuthType.
+	apiToken, _ := config["apiToken"].(string)
+	username, _ := config["username"].(string)
+	registerSecret(apiToken)
+	authType := jiraAuthType(config)
+
+	var httpClient *http.Client
+	switch authType {
+	case "basic":
+		if apiToken == "" || username == "" {
+			return nil, config, nil
+		}
+		httpClient = (&jira.BasicAuthTransport{Username: username, Password: apiToken}).Client()
+	case "bearer":
+		if apiToken == "" {
+			return nil, config, nil
+		}
+		httpClient = (&jira.BearerAuthTransport{Token: apiToken}).Client()
+	default:
+		return nil, nil, &jiraError{http.StatusInternalServerError, fmt.Sprintf("Invalid Jira config: unknown authType %q, expected basic, bearer or auto", authType)}
+	}
 
-	log.Printf("Connecting to Jira at: %s with user: %s", baseUrl, username)
+	baseUrl, _ := config["baseUrl"].(string)
+	logJira.Debug("Connecting to Jira", "baseUrl", baseUrl, "authType", authType)
 
-	// Create Jira client (same method as your working code)
-	client, err := jira.NewClient(nil, baseUrl)
+	client, err := jira.NewClient(traceClient(ctx, httpClient, "Jira"), baseUrl)
 	if err != nil {
-		log.Printf("Failed to create Jira client: %v", err)
-		http.Error(w, "Failed to connect to Jira", http.StatusInternalServerError)
-		return
+		logJira.Error("Failed to create Jira client", "baseUrl", baseUrl, "err", err)
+		return nil, nil, &jiraError{http.StatusInternalServerError, "Failed to connect to Jira - check baseUrl"}
 	}
 
-	// Authenticate using session cookie (username + password)
-	_, err = client.Authentication.AcquireSessionCookie(username, apiToken)
+	// Verify the credentials up front so failures name the likely cause
+	_, resp, err := client.User.GetSelf()
 	if err != nil {
-		log.Printf("Jira authentication failed: %v", err)
-		http.Error(w, "Jira authentication failed - check username and password", http.StatusUnauthorized)
-		return
+		logJira.Error("Jira authentication check failed", "baseUrl", baseUrl, "err", err)
+		if resp == nil {
+			return nil, nil, &jiraError{http.StatusBadGateway, "Failed to connect to Jira server"}
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized:
+			if authType == "bearer" {
+				return nil, nil, &jiraError{http.StatusUnauthorized, "Jira rejected the personal access token - check that it is valid and not expired"}
+			}
+			return nil, nil, &jiraError{http.StatusUnauthorized, "Jira rejected the credentials - Jira Cloud needs your account email as username and an API token; use authType \"bearer\" for Data Center personal access tokens"}
+		case http.StatusForbidden:
+			return nil, nil, &jiraError{http.StatusForbidden, "Jira denied access - the account may be locked or require a CAPTCHA login in the browser"}
+		default:
+			return nil, nil, &jiraError{http.StatusBadGateway, fmt.Sprintf("Jira authentication check failed: %d", resp.StatusCode)}
+		}
 	}
-	log.Printf("Jira authentication successful with username: %s", username)
 
-	// Search for issues using the library (exact same pattern as your working code)
-	searchOptions := jira.SearchOptions{MaxResults: maxResults}
-	issues, response, err := client.Issue.Search(jql, &searchOptions)
+	return client, config, nil
+}
+
+// fetchJiraTickets runs a JQL search on a Jira profile and returns the
+// tickets in our format. An unconfigured Jira yields an empty list.
+func fetchJiraTickets(ctx context.Context, config map[string]interface{}, jql string) ([]map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "Jira search", spanInternal, nil)
+	profile, _ := config["profile"].(string)
+	span.set("jira.profile", profile)
+	span.set("jira.jql", jql)
+	tickets, err := searchJiraTickets(ctx, config, jql)
+	span.set("jira.tickets", len(tickets))
+	span.finish(err)
+	return tickets, err
+}
+
+// searchJiraTickets pages through a JQL search, see fetchJiraTickets
+func searchJiraTickets(ctx context.Context, config map[string]interface{}, jql string) ([]map[string]interface{}, error) {
+	client, config, err := newJiraClientFor(ctx, config)
 	if err != nil {
-		log.Printf("Jira search failed: %v", err)
-		if response != nil {
-			log.Printf("Response status: %d", response.StatusCode)
-			log.Printf("Response body: %s", response.Body)
-		}
-		log.Printf("JQL query: %s", jql)
-		log.Printf("Base URL: %s", baseUrl)
-		log.Printf("Username: %s", username)
-
-		var errorMsg string
-		if response != nil {
-			switch response.StatusCode {
-			case 401:
-				errorMsg = "Jira authentication failed - check username and password/token"
-			case 403:
-				errorMsg = "Jira access forbidden - check user permissions"
-			case 404:
-				errorMsg = "Jira project not found - check project key"
-			default:
-				errorMsg = fmt.Sprintf("Jira API error: %d", response.StatusCode)
+		return nil, err
+	}
+	if client == nil {
+		// Return empty array if not configured
+		return []map[string]interface{}{}, nil
+	}
+
+	baseUrl, _ := config["baseUrl"].(string)
+
+	// maxResults is the page size, maxTotalResults caps the whole search
+	maxResults := 50
+	if v, ok := config["maxResults"].(float64); ok {
+		maxResults = int(v)
+	}
+	limit := defaultJiraResultLimit
+	if v, ok := config["maxTotalResults"].(float64); ok && v > 0 {
+		limit = int(v)
+	}
+	if limit > jiraResultHardCap {
+		limit = jiraResultHardCap
+	}
+
+	// Page through the results until Jira reports no more or the cap is hit.
+	// Jira Cloud only offers the token paged search, without a total.
+	cloud := detectJiraDeployment(config).cloud()
+	var issues []jira.Issue
+	total, pageToken, more := 0, "", false
+	for len(issues) < limit {
+		var page []jira.Issue
+		var response *jira.Response
+		var err error
+		pageSize := min(maxResults, limit-len(issues))
+		if cloud {
+			page, pageToken, response, err = searchJiraCloud(client, jql, pageSize, pageToken)
+		} else {
+			page, response, err = client.Issue.Search(jql, &jira.SearchOptions{StartAt: len(issues), MaxResults: pageSize})
+		}
+		if err != nil {
+			attrs := []any{"jql", jql, "baseUrl", baseUrl, "err", err}
+			if response != nil {
+				attrs = append(attrs, "status", response.StatusCode)
+			}
+			logJira.Error("Jira search failed", attrs...)
+
+			var errorMsg string
+			if response != nil {
+				switch response.StatusCode {
+				case 401:
+					errorMsg = "Jira authentication failed - check username and API token"
+				case 403:
+					errorMsg = "Jira access forbidden - check user permissions"
+				case 404:
+					errorMsg = "Jira project not found - check project key"
+				default:
+					errorMsg = fmt.Sprintf("Jira API error: %d", response.StatusCode)
+				}
+			} else {
+				errorMsg = "Failed to connect to Jira server"
 			}
+			return nil, &jiraError{http.StatusInternalServerError, errorMsg}
+		}
+		issues = append(issues, page...)
+		if cloud {
+			more = pageToken != ""
 		} else {
-			errorMsg = "Failed to connect to Jira server"
+			total = response.Total
+			more = len(issues) < total
 		}
-		http.Error(w, errorMsg, http.StatusInternalServerError)
-		return
+		if len(page) == 0 || !more {
+			break
+		}
+	}
+	if len(issues) > limit {
+		issues, more = issues[:limit], true
+	}
+	if more && cloud {
+		logJira.Warn("Jira search stopped early, raise maxTotalResults to fetch more", "tickets", len(issues))
+	} else if more {
+		logJira.Warn("Jira search stopped early, raise maxTotalResults to fetch more", "tickets", len(issues), "total", total)
 	}
 
 	// Transform tickets to our format
 	tickets := make([]map[string]interface{}, 0)
 	for _, issue := range issues {
-		ticket := map[string]interface{}{
-			"key":     issue.Key,
-			"summary": issue.Fields.Summary,
-			"status":  issue.Fields.Status.Name,
-		}
-
-		// Add optional fields if they exist
-		if issue.Fields.Assignee != nil {
-			ticket["assignee"] = issue.Fields.Assignee.DisplayName
-		}
-		if issue.Fields.Priority != nil {
-			ticket["priority"] = issue.Fields.Priority.Name
-		}
-
-		tickets = append(tickets, ticket)
+		tickets = append(tickets, jiraTicketFromIssue(issue))
 	}
 
-	log.Printf("Successfully fetched %d tickets from Jira", len(tickets))
-
-	// Return tickets as JSON
-	w.Header().Set("Content-Type", "application/json")
+	logJira.Info("Fetched tickets from Jira", "tickets", len(tickets))
+	return tickets, nil
+}
 
-	// Force tickets to be an empty slice if it's nil
-	if tickets == nil {
-		tickets = []map[string]interface{}{}
+// jiraTicketFromIssue converts a Jira issue to our ticket format
+func jiraTicketFromIssue(issue jira.Issue) map[string]interface{} {
+	ticket := map[string]interface{}{"key": issue.Key}
+	if issue.Fields == nil {
+		return ticket
+	}
+	ticket["summary"] = issue.Fields.Summary
+	if issue.Fields.Status != nil {
+		ticket["status"] = issue.Fields.Status.Name
 	}
 
-	jsonData, err := json.Marshal(tickets)
-	if err != nil {
-		log.Printf("JSON marshal error: %v", err)
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+	// Add optional fields if they exist
+	if issue.Fields.Assignee != nil {
+		ticket["assignee"] = issue.Fields.Assignee.DisplayName
+	}
+	if issue.Fields.Priority != nil {
+		ticket["priority"] = issue.Fields.Priority.Name
 	}
-	w.Write(jsonData)
+	return ticket
 }
 
 // Handle holidays.json
@@ -289,18 +725,11 @@ func handleBackups(w http.ResponseWriter, r *http.Request) {
 		if filename := r.URL.Query().Get("filename"); filename != "" {
 			fname := filepath.Base(filename)
 			path := filepath.Join(backupDir, fname)
-			data, err := os.ReadFile(path)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error reading backup: %v", err), http.StatusInternalServerError)
+			if strings.HasPrefix(fname, "jira-config.") {
+				serveJiraConfigBackup(w, fname, path)
 				return
 			}
-			resp := map[string]any{
-				"filename": fname,
-				"checksum": computeETag(data),
-				"content":  string(data),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(resp)
+			serveBackup(w, r, fname, path)
 			return
 		}
 
@@ -341,19 +770,92 @@ func handleBackups(w http.ResponseWriter, r *http.Request) {
 		filename := filepath.Base(requestData.Filename)
 		filePath := filepath.Join(backupDir, filename)
 
+		content, _ := os.ReadFile(filePath)
 		if err := os.Remove(filePath); err != nil {
 			http.Error(w, fmt.Sprintf("Error deleting backup: %v", err), http.StatusInternalServerError)
 			return
 		}
+		auditWrite(requestUser(r), auditDelete, "backups/"+filename, "", content, nil)
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write([]byte(`{"success": true, "message": "Backup deleted successfully"}`))
+		writeSuccess(w, r, "Backup deleted successfully")
 
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// serveBackup streams a backup: raw=1 serves the file itself, with Range
+// requests for large ones; otherwise it is embedded in the JSON of
+// GET /api/backups, written as it is read
+func serveBackup(w http.ResponseWriter, r *http.Request, fname, path string) {
+	f, info, err := openForStreaming(path)
+	if os.IsNotExist(err) {
+		http.Error(w, "Backup not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	etag, err := fileETag(f)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	m, modified := backupModification(fname)
+
+	if raw, _ := strconv.ParseBool(r.URL.Query().Get("raw")); raw {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		if modified {
+			w.Header().Set("X-Last-Modified-By", modifierName(m.By))
+		}
+		http.ServeContent(w, r, fname, info.ModTime(), f)
+		return
+	}
+
+	head := map[string]any{"filename": fname, "checksum": etag}
+	if modified {
+		head["modifiedBy"], head["modifiedAt"] = m.By, m.At
+	}
+	fields, _ := json.Marshal(head)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(fields[:len(fields)-1])
+	w.Write([]byte(`,"content":"`))
+	if _, err := io.Copy(jsonStringWriter{w}, f); err != nil {
+		logServer.Debug("Streaming a backup failed", "backup", fname, "err", err)
+		return
+	}
+	w.Write([]byte("\"}\n"))
+}
+
+// serveJiraConfigBackup serves a backup of the Jira config, small enough to
+// read whole, with its credentials masked
+func serveJiraConfigBackup(w http.ResponseWriter, fname, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading backup: %v", err), http.StatusInternalServerError)
+		return
+	}
+	content := string(data)
+	var config map[string]interface{}
+	if json.Unmarshal(data, &config) == nil {
+		masked, _ := json.MarshalIndent(maskJiraConfig(config), "", "  ")
+		content = string(masked)
+	}
+	resp := map[string]any{
+		"filename": fname,
+		"checksum": computeETag(data),
+		"content":  content,
+	}
+	if m, ok := backupModification(fname); ok {
+		resp["modifiedBy"], resp["modifiedAt"] = m.By, m.At
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
 // Handle backup settings
 func handleBackupSettings(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -375,21 +877,25 @@ func handleBackupSettings(w http.ResponseWriter, r *http.Request) {
 // Serve a JSON file
 func serveJSONFile(w http.ResponseWriter, filePath string) {
 	// If file doesn't exist, return an empty JSON object
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	f, info, err := openForStreaming(filePath)
+	if os.IsNotExist(err) {
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte("{}"))
 		return
 	}
-
-	// Read and serve the file
-	data, err := os.ReadFile(filePath)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error reading file: %v", err), http.StatusInternalServerError)
 		return
 	}
+	defer f.Close()
 
+	// Stream the file rather than holding large plans in memory
+	setModifiedHeaders(w, filePath)
 	w.Header().Set("Content-Type", "application/json")
-	w.Write(data)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	if _, err := io.Copy(w, f); err != nil {
+		logServer.Debug("Streaming a data file failed", "file", filepath.Base(filePath), "err", err)
+	}
 }
 
 // Update a JSON file with data from POST request
@@ -437,7 +943,7 @@ func updateJSONFile(w http.ResponseWriter, r *http.Request, filePath string) {
 		// Create a backup of the existing file if it exists
 		backupPath := filePath + ".bak." + time.Now().Format("20060102-150405")
 		if err := os.Rename(filePath, backupPath); err != nil {
-			log.Printf("Warning: could not create backup of %s: %v", filePath, err)
+			logServer.WarnContext(r.Context(), "Could not create backup", "file", filePath, "err", err)
 		}
 		writeChecksum(backupPath)
 	}
@@ -447,12 +953,11 @@ func updateJSONFile(w http.ResponseWriter, r *http.Request, filePath string) {
 		http.Error(w, "Error writing file", http.StatusInternalServerError)
 		return
 	}
+	notifyDataChange(filepath.Base(filePath))
 
 	// Respond with success and new ETag
 	w.Header().Set("ETag", computeETag(prettyJSON))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"success": true, "message": "File updated successfully"}`))
+	writeSuccess(w, r, "File updated successfully")
 }
 
 // Update a JSON file with data from POST request and manage backups
@@ -472,69 +977,202 @@ func updateJSONFileWithBackup(w http.ResponseWriter, r *http.Request, filePath s
 		return
 	}
 
+	// Per-environment permissions
+	if err := authorizeWrite(r, filePath, jsonData); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	// Advisory checks against the state before the write
+	warnings := warningsByPath(filePath, jsonData)
+
+	// The frontend's restore dialog marks its writes
+	action := ""
+	if r.Header.Get("X-Restore") != "" {
+		action = auditRestore
+	}
+	etag, err := writeJSONFileAction(r.Context(), filePath, jsonData, r.Header.Get("If-Match"), maxBackups, requestUser(r), action)
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	// Respond with success and new ETag
+	w.Header().Set("ETag", etag)
+	setModifiedHeaders(w, filePath)
+	if warnings == nil {
+		writeSuccess(w, r, "File updated successfully with backup")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"message":  localize(r, "File updated successfully with backup"),
+		"warnings": warnings,
+	})
+}
+
+// saveError carries the HTTP status and message for a rejected write. ETag is
+// set to the current version when the If-Match precondition failed.
+type saveError struct {
+	status int
+	msg    string
+	etag   string
+}
+
+func (e *saveError) Error() string { return e.msg }
+
+// writeSaveError reports a writeJSONFile error to the client
+func writeSaveError(w http.ResponseWriter, err error) {
+	var serr *saveError
+	if !errors.As(err, &serr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if serr.etag != "" {
+		w.Header().Set("ETag", serr.etag)
+	}
+	http.Error(w, serr.msg, serr.status)
+}
+
+// fileMu serializes the check-backup-write sequence of data file updates
+var fileMu sync.Mutex
+
+// writeJSONFile validates and saves a JSON document changed by a user, or a
+// job such as "sync:jira", backing up the previous version first. A
+// non-empty ifMatch must equal the ETag of the file on disk. It returns the
+// ETag of the new content.
+func writeJSONFile(ctx context.Context, filePath string, jsonData interface{}, ifMatch string, maxBackups int, by string) (string, error) {
+	return writeJSONFileAction(ctx, filePath, jsonData, ifMatch, maxBackups, by, "")
+}
+
+// writeJSONFileAction is writeJSONFile recording the write in the audit log
+// as an action, auditRestore say, rather than as a create or update
+func writeJSONFileAction(ctx context.Context, filePath string, jsonData interface{}, ifMatch string, maxBackups int, by, action string) (string, error) {
+	ctx, span := startSpan(ctx, "save "+filepath.Base(filePath), spanInternal, nil)
+	span.set("file", filepath.Base(filePath))
+	span.set("by", modifierName(by))
+
+	// A standby's files are the primary's copies
+	if standbyMode() {
+		span.finish(nil)
+		return "", &saveError{status: http.StatusServiceUnavailable, msg: "This server is a read-only standby"}
+	}
+
 	// Basic schema validation depending on file
 	if err := validateByPath(filePath, jsonData); err != nil {
-		http.Error(w, fmt.Sprintf("Schema validation failed: %v", err), http.StatusBadRequest)
-		return
+		span.finish(err)
+		return "", &saveError{status: http.StatusBadRequest, msg: fmt.Sprintf("Schema validation failed: %v", err)}
+	}
+
+	// Pre-save hooks may veto the save; they run before the lock so slow
+	// ones don't hold up saves of other files
+	if err := runPreSaveHooks(ctx, filePath, jsonData, by); err != nil {
+		span.finish(err)
+		return "", err
+	}
+
+	etag, err := writeJSONFileLocked(ctx, filePath, jsonData, ifMatch, maxBackups, by, action)
+	span.finish(err)
+	if err != nil {
+		return "", err
 	}
+	logServer.Info("Saved data file", "file", filepath.Base(filePath), "by", modifierName(by))
+
+	// Hooks run outside the lock so they may write data files themselves
+	notifyDataChange(filepath.Base(filePath))
+	return etag, nil
+}
+
+// writeJSONFileLocked performs the backup and write of writeJSONFile while holding fileMu
+func writeJSONFileLocked(ctx context.Context, filePath string, jsonData interface{}, ifMatch string, maxBackups int, by, action string) (string, error) {
+	waiting := time.Now()
+	release, err := clusterLock(ctx)
+	if err != nil {
+		return "", &saveError{status: http.StatusServiceUnavailable, msg: fmt.Sprintf("Try again, %v", err)}
+	}
+	defer release()
+	fileMu.Lock()
+	defer fileMu.Unlock()
+	spanFrom(ctx).set("lockWaitMs", float64(time.Since(waiting).Microseconds())/1000)
+
+	// Planning rules are checked against the saved state, so under the lock
+	if err := checkRulesByPath(filePath, jsonData); err != nil {
+		return "", &saveError{status: http.StatusConflict, msg: err.Error()}
+	}
+
+	// Fill in server-maintained fields such as release history
+	jsonData = prepareByPath(ctx, filePath, jsonData, by)
 
 	// Pretty print the JSON
 	prettyJSON, err := json.MarshalIndent(jsonData, "", "  ")
 	if err != nil {
-		http.Error(w, "Error formatting JSON", http.StatusInternalServerError)
-		return
+		return "", &saveError{status: http.StatusInternalServerError, msg: "Error formatting JSON"}
 	}
 
 	// Get the base filename without path
 	baseFilename := filepath.Base(filePath)
 
 	// Concurrency: If-Match when file exists
+	backupFilename := ""
+	var before []byte
 	if _, err := os.Stat(filePath); err == nil {
-		ifMatch := r.Header.Get("If-Match")
 		if ifMatch != "" {
 			current, _ := os.ReadFile(filePath)
 			if computeETag(current) != ifMatch {
-				w.Header().Set("ETag", computeETag(current))
-				http.Error(w, "Precondition Failed", http.StatusPreconditionFailed)
-				return
+				return "", &saveError{status: http.StatusPreconditionFailed, etag: computeETag(current),
+					msg: "Precondition Failed: " + baseFilename + " changed since your version, merge it with POST /api/merge/" + baseFilename}
 			}
 		}
 
 		// Create a backup in the backups directory
+		_, backupSpan := startSpan(ctx, "backup "+baseFilename, spanInternal, nil)
 		timestamp := time.Now().Format("20060102-150405")
-		backupFilename := fmt.Sprintf("%s.%s.json", strings.TrimSuffix(baseFilename, ".json"), timestamp)
+		backupFilename = fmt.Sprintf("%s.%s.json", strings.TrimSuffix(baseFilename, ".json"), timestamp)
 		backupPath := filepath.Join(backupDir, backupFilename)
 
 		// Copy the original file to the backup (don't move it)
 		origData, err := os.ReadFile(filePath)
+		before = origData
 		if err != nil {
-			log.Printf("Warning: could not read original file for backup %s: %v", filePath, err)
+			logServer.Warn("Could not read original file for backup", "file", filePath, "err", err)
 		} else {
 			if err := os.WriteFile(backupPath, origData, 0644); err != nil {
-				log.Printf("Warning: could not create backup of %s: %v", filePath, err)
+				logServer.Warn("Could not create backup", "file", filePath, "err", err)
+				backupFilename = ""
 			} else {
-				log.Printf("Created backup: %s", backupPath)
+				logServer.Debug("Created backup", "backup", backupPath)
 				writeChecksum(backupPath)
 
 				// Clean up old backups
 				if err := cleanupOldBackups(baseFilename, maxBackups); err != nil {
-					log.Printf("Warning: error cleaning up old backups: %v", err)
+					logServer.Warn("Error cleaning up old backups", "file", baseFilename, "err", err)
 				}
 			}
 		}
+		backupSpan.set("backup", backupFilename)
+		backupSpan.finish(nil)
 	}
 
-	// Write the new JSON to file
-	if err := os.WriteFile(filePath, prettyJSON, 0644); err != nil {
-		http.Error(w, "Error writing file", http.StatusInternalServerError)
-		return
+	// Write the new JSON to file, through a rename so readers streaming the
+	// old version read it whole
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(filePath); err == nil {
+		perm = info.Mode().Perm()
 	}
-
-	// Respond with success and new ETag
-	w.Header().Set("ETag", computeETag(prettyJSON))
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"success": true, "message": "File updated successfully with backup"}`))
+	if err := replaceFile(filePath, prettyJSON, perm); err != nil {
+		return "", &saveError{status: http.StatusInternalServerError, msg: "Error writing file"}
+	}
+	noteDataWrite(baseFilename, prettyJSON)
+	recordModification(baseFilename, backupFilename, by)
+	entry := auditWrite(by, action, baseFilename, "", before, prettyJSON)
+	etag := computeETag(prettyJSON)
+	pushUndo(baseFilename, before, etag, action)
+	publishLiveChange(liveChange{Seq: entry.Seq, Time: time.Now().UTC().Format(time.RFC3339), File: baseFilename,
+		Action: entry.Action, Records: changedRecords(baseFilename, before, prettyJSON), By: by, ETag: strings.Trim(etag, `"`)})
+	runPostSaveHooks(baseFilename, by, entry.Action, before, prettyJSON)
+
+	return etag, nil
 }
 
 // computeETag returns a weak ETag of the content
@@ -556,8 +1194,17 @@ func writeChecksum(path string) {
 	_ = os.WriteFile(path+".sha256", []byte(fmt.Sprintf("%x\n", sum)), 0644)
 }
 
-// validateByPath performs minimal schema checks per JSON file type
+// validateByPath performs minimal schema checks per JSON file type, then
+// runs the validator plugins of the file
 func validateByPath(path string, data interface{}) error {
+	if err := validateSchemaByPath(path, data); err != nil {
+		return err
+	}
+	return validateWithPlugins(filepath.Base(path), data)
+}
+
+// validateSchemaByPath performs the built-in checks of validateByPath
+func validateSchemaByPath(path string, data interface{}) error {
 	base := filepath.Base(path)
 	switch base {
 	case "environments.json":
@@ -568,10 +1215,33 @@ func validateByPath(path string, data interface{}) error {
 		if _, ok := m["environments"]; !ok {
 			return fmt.Errorf("missing environments array")
 		}
+		if err := validateEnvironments(m["environments"]); err != nil {
+			return err
+		}
+		if groups, ok := m["groups"]; ok {
+			if err := validateGroups(groups, m["environments"]); err != nil {
+				return err
+			}
+		}
+		if pipeline, ok := m["pipeline"]; ok {
+			if err := validatePipeline(pipeline, m["environments"]); err != nil {
+				return err
+			}
+		}
 	case "releases.json":
 		if _, ok := data.(map[string]interface{}); !ok {
 			return fmt.Errorf("releases.json must be an object keyed by environment")
 		}
+	case "permissions.json":
+		return validatePermissions(data)
+	case "absences.json":
+		return validateAbsences(data)
+	case "team.json":
+		return validateTeam(data)
+	case "jira-config.json":
+		return validateJiraConfig(data)
+	case "notification-rules.json":
+		return validateNotificationRules(data)
 	case "holidays.json":
 		m, ok := data.(map[string]interface{})
 		if !ok {
@@ -580,6 +1250,66 @@ func validateByPath(path string, data interface{}) error {
 		if _, ok := m["holidays"]; !ok {
 			return fmt.Errorf("missing holidays array")
 		}
+	case "datasets-config.json":
+		var cfg DatasetsConfig
+		if err := decodeInto(data, &cfg); err != nil {
+			return fmt.Errorf("datasets-config.json is malformed: %v", err)
+		}
+		return validateDatasetsConfig(cfg)
+	default:
+		return validateDataset(base, data)
+	}
+	return nil
+}
+
+// checkRulesByPath enforces planning rules that depend on the saved state,
+// such as group freezes, capacity limits and assignments for releases.json
+func checkRulesByPath(path string, data interface{}) error {
+	switch filepath.Base(path) {
+	case "releases.json":
+		var next ReleasesData
+		if err := decodeInto(data, &next); err != nil {
+			return fmt.Errorf("releases.json entries are malformed: %v", err)
+		}
+		current, err := loadReleases()
+		if err != nil {
+			return err
+		}
+		envs, err := loadEnvironments()
+		if err != nil {
+			return err
+		}
+		if err := checkReleaseRules(current, next, envs); err != nil {
+			return err
+		}
+		if err := checkChangeApprovals(current, next); err != nil {
+			return err
+		}
+		return checkAssignments(current, next)
+	}
+	return nil
+}
+
+// warningsByPath returns advisory warnings for a write that is allowed but
+// worth a second look, such as assignees who are away. Nil means the file
+// has no such checks.
+func warningsByPath(path string, data interface{}) []availabilityWarning {
+	switch filepath.Base(path) {
+	case "releases.json":
+		var next ReleasesData
+		if err := decodeInto(data, &next); err != nil {
+			return nil
+		}
+		current, err := loadReleases()
+		if err != nil {
+			return nil
+		}
+		warnings, err := availabilityWarnings(current, next)
+		if err != nil {
+			logServer.Error("Availability check failed", "err", err)
+			return nil
+		}
+		return warnings
 	}
 	return nil
 }
@@ -639,9 +1369,10 @@ func cleanupOldBackups(baseFilename string, maxBackups int) error {
 	// Delete all backups beyond maxBackups (keep newest ones)
 	for i := maxBackups; i < len(backups); i++ {
 		backupPath := filepath.Join(backupDir, backups[i])
-		log.Printf("Deleting old backup: %s", backupPath)
+		logServer.Debug("Deleting old backup", "backup", backupPath)
 
-		if err := os.Remove(backupPath); err != nil {
+		// Another instance sharing the backups may have deleted it first
+		if err := os.Remove(backupPath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to delete backup %s: %w", backupPath, err)
 		}
 	}
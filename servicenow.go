@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServiceNowConfig is servicenow-config.json, kept on disk only since it
+// holds credentials. Releases of the listed environments that reach one of
+// Statuses get a change request for their window; its approval is polled
+// back onto the release.
+type ServiceNowConfig struct {
+	InstanceURL     string            `json:"instanceUrl"` // e.g. https://acme.service-now.com
+	Username        string            `json:"username,omitempty"`
+	Password        string            `json:"password,omitempty"`
+	Token           string            `json:"token,omitempty"` // OAuth bearer token instead of basic auth
+	Environments    []string          `json:"environments,omitempty"`
+	Statuses        []string          `json:"statuses,omitempty"`
+	Type            string            `json:"type,omitempty"` // normal (default), standard or emergency
+	AssignmentGroup string            `json:"assignmentGroup,omitempty"`
+	Category        string            `json:"category,omitempty"`
+	Fields          map[string]string `json:"fields,omitempty"` // extra change_request fields
+	RequireApproval bool              `json:"requireApproval"`  // block marking a release done without an approved change
+	PollSeconds     int               `json:"pollIntervalSeconds,omitempty"`
+}
+
+// defaultServiceNowPoll is how often approvals are read back
+const defaultServiceNowPoll = 5 * time.Minute
+
+// serviceNowTimeLayout is the Table API date format, in UTC
+const serviceNowTimeLayout = "2006-01-02 15:04:05"
+
+// serviceNowChange is what was last pushed and read for a change request
+type serviceNowChange struct {
+	SysID    string `json:"sysId"`
+	Release  string `json:"release"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Approval string `json:"approval"`
+	State    string `json:"state"`
+}
+
+// serviceNowState is servicenow-changes.json, keyed by change number
+type serviceNowState struct {
+	Changes map[string]serviceNowChange `json:"changes"`
+}
+
+// serviceNowMu serializes syncs so a change is never created twice
+var serviceNowMu sync.Mutex
+
+// loadServiceNowConfig reads servicenow-config.json; ok is false when the
+// integration isn't configured
+func loadServiceNowConfig() (cfg ServiceNowConfig, ok bool, err error) {
+	if err := readDataFile("servicenow-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	cfg.InstanceURL = strings.TrimSuffix(cfg.InstanceURL, "/")
+	if cfg.InstanceURL == "" || (cfg.Token == "" && cfg.Username == "") {
+		return cfg, false, nil
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = defaultMaintenanceStatuses
+	}
+	if cfg.Type == "" {
+		cfg.Type = "normal"
+	}
+	return cfg, true, nil
+}
+
+// covers reports whether releases of an environment need a change request
+func (c ServiceNowConfig) covers(env string) bool {
+	if len(c.Environments) == 0 {
+		return true
+	}
+	for _, e := range c.Environments {
+		if e == env {
+			return true
+		}
+	}
+	return false
+}
+
+// loadServiceNowState reads servicenow-changes.json
+func loadServiceNowState() (serviceNowState, error) {
+	var state serviceNowState
+	err := readDataFile("servicenow-changes.json", &state)
+	if state.Changes == nil {
+		state.Changes = map[string]serviceNowChange{}
+	}
+	return state, err
+}
+
+// save writes servicenow-changes.json, server-maintained like jira-sync.json
+func (s serviceNowState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "servicenow-changes.json"), data, 0644)
+}
+
+// serviceNowDo calls the Table API for change_request
+func serviceNowDo(cfg ServiceNowConfig, method, path string, body interface{}) (serviceNowRecord, error) {
+	params := url.Values{}
+	params.Set("sysparm_fields", "sys_id,number,approval,state")
+	params.Set("sysparm_display_value", "true")
+	req, err := http.NewRequest(method, cfg.InstanceURL+"/api/now/table/change_request"+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return serviceNowRecord{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	} else {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	var resp struct {
+		Result serviceNowRecord `json:"result"`
+	}
+	err = doJSON(req, body, &resp)
+	return resp.Result, err
+}
+
+// serviceNowRecord is the part of a change_request record we read
+type serviceNowRecord struct {
+	SysID    string `json:"sys_id"`
+	Number   string `json:"number"`
+	Approval string `json:"approval"`
+	State    string `json:"state"`
+}
+
+// changeRequestBody describes a release as change_request fields
+func changeRequestBody(cfg ServiceNowConfig, env string, entry map[string]interface{}, start, end time.Time) map[string]interface{} {
+	name, _ := entry["releaseName"].(string)
+	short := fmt.Sprintf("Release %s to %s", name, env)
+	if name == "" {
+		short = fmt.Sprintf("Release to %s on %s", env, start.Format(dateLayout))
+	}
+	var lines []string
+	for _, field := range []string{"feTag", "beTag", "jiraTicket", "note"} {
+		if v, _ := entry[field].(string); v != "" {
+			lines = append(lines, fmt.Sprintf("%s: %s", field, v))
+		}
+	}
+	body := map[string]interface{}{
+		"short_description": short,
+		"description":       strings.Join(lines, "\n"),
+		"type":              cfg.Type,
+		"start_date":        start.UTC().Format(serviceNowTimeLayout),
+		"end_date":          end.UTC().Format(serviceNowTimeLayout),
+	}
+	if cfg.AssignmentGroup != "" {
+		body["assignment_group"] = cfg.AssignmentGroup
+	}
+	if cfg.Category != "" {
+		body["category"] = cfg.Category
+	}
+	for k, v := range cfg.Fields {
+		body[k] = v
+	}
+	return body
+}
+
+// syncChangeRequests creates change requests for releases entering one of
+// the configured statuses, moves their window with the release and copies
+// their number, approval and state onto the release
+func syncChangeRequests() error {
+	serviceNowMu.Lock()
+	defer serviceNowMu.Unlock()
+
+	cfg, ok, err := loadServiceNowConfig()
+	if err != nil || !ok {
+		return err
+	}
+	statuses := map[string]bool{}
+	for _, s := range cfg.Statuses {
+		statuses[s] = true
+	}
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		return err
+	}
+	state, err := loadServiceNowState()
+	if err != nil {
+		return err
+	}
+	attached := map[string]bool{}
+	for _, list := range doc {
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			if number, _ := entry["changeRequest"].(string); number != "" {
+				attached[number] = true
+			}
+		}
+	}
+
+	now := time.Now()
+	docChanged := false
+	var errs []error
+	for env, list := range doc {
+		if !cfg.covers(env) {
+			continue
+		}
+		items, _ := list.([]interface{})
+		for _, item := range items {
+			entry, _ := item.(map[string]interface{})
+			var release ReleaseEntry
+			decodeInto(entry, &release)
+			id := releaseID(env, release.Date)
+			start, end, err := release.window()
+			if err != nil {
+				continue
+			}
+			number := release.ChangeRequest
+
+			if number == "" {
+				if !statuses[release.Status] || !end.After(now) {
+					continue
+				}
+				// Reattach a change whose releases write failed last time
+				for n, c := range state.Changes {
+					if c.Release == id && !attached[n] {
+						number = n
+					}
+				}
+				if number == "" {
+					rec, err := serviceNowDo(cfg, http.MethodPost, "", changeRequestBody(cfg, env, entry, start, end))
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s: creating change request: %w", id, err))
+						continue
+					}
+					number = rec.Number
+					state.Changes[number] = serviceNowChange{SysID: rec.SysID, Release: id,
+						Start: start.UTC().Format(serviceNowTimeLayout), End: end.UTC().Format(serviceNowTimeLayout),
+						Approval: rec.Approval, State: rec.State}
+					logServiceNow.Info("Created ServiceNow change", "change", number, "release", id)
+				}
+				entry["changeRequest"] = number
+				attached[number] = true
+				docChanged = true
+			}
+
+			change, known := state.Changes[number]
+			if !known {
+				// Entered by hand: look it up by number
+				var found struct {
+					Result []serviceNowRecord `json:"result"`
+				}
+				if err := serviceNowLookup(cfg, number, &found); err != nil || len(found.Result) == 0 {
+					errs = append(errs, fmt.Errorf("%s: change %s not found: %v", id, number, err))
+					continue
+				}
+				change = serviceNowChange{SysID: found.Result[0].SysID}
+			}
+			change.Release = id
+
+			// Move the planned window with the release, read approval back
+			wantStart, wantEnd := start.UTC().Format(serviceNowTimeLayout), end.UTC().Format(serviceNowTimeLayout)
+			var rec serviceNowRecord
+			if known && (change.Start != wantStart || change.End != wantEnd) {
+				rec, err = serviceNowDo(cfg, http.MethodPatch, "/"+change.SysID, map[string]string{"start_date": wantStart, "end_date": wantEnd})
+				if err == nil {
+					change.Start, change.End = wantStart, wantEnd
+				}
+			} else {
+				rec, err = serviceNowDo(cfg, http.MethodGet, "/"+change.SysID, nil)
+				if !known {
+					change.Start, change.End = wantStart, wantEnd
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: change %s: %w", id, number, err))
+				state.Changes[number] = change
+				continue
+			}
+			change.Approval, change.State = rec.Approval, rec.State
+			state.Changes[number] = change
+			if entry["changeApproval"] != rec.Approval || entry["changeState"] != rec.State {
+				entry["changeApproval"], entry["changeState"] = rec.Approval, rec.State
+				docChanged = true
+			}
+		}
+	}
+
+	// Save the state first so a failed releases write can reattach the changes
+	if err := state.save(); err != nil {
+		return err
+	}
+	if docChanged {
+		if _, err := writeJSONFile(withServerFields(context.Background()), filepath.Join(dataDir, "releases.json"), doc, etag, defaultMaxBackups, "sync:servicenow"); err != nil {
+			return fmt.Errorf("saving change requests: %w", err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("ServiceNow sync: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// serviceNowLookup finds a change request by number
+func serviceNowLookup(cfg ServiceNowConfig, number string, out interface{}) error {
+	params := url.Values{}
+	params.Set("sysparm_query", "number="+number)
+	params.Set("sysparm_fields", "sys_id,number,approval,state")
+	params.Set("sysparm_limit", "1")
+	req, err := http.NewRequest(http.MethodGet, cfg.InstanceURL+"/api/now/table/change_request?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if cfg.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.Token)
+	} else {
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+	return doJSON(req, nil, out)
+}
+
+// checkChangeApprovals rejects marking a release done in a covered
+// environment unless its change request is approved, when requireApproval is set
+func checkChangeApprovals(current, next ReleasesData) error {
+	cfg, ok, err := loadServiceNowConfig()
+	if err != nil || !ok || !cfg.RequireApproval {
+		return err
+	}
+	for env, entries := range next {
+		if !cfg.covers(env) {
+			continue
+		}
+		before := map[string]ReleaseEntry{}
+		for _, e := range current[env] {
+			before[e.Date] = e
+		}
+		for _, e := range entries {
+			old, existed := before[e.Date]
+			if !completedStatuses[e.Status] || (existed && completedStatuses[old.Status]) {
+				continue
+			}
+			// The client may not send the server-maintained fields back
+			if !strings.EqualFold(old.ChangeApproval, "approved") {
+				return fmt.Errorf("%s needs an approved ServiceNow change request before it is marked done", releaseID(env, e.Date))
+			}
+		}
+	}
+	return nil
+}
+
+// syncChangeRequestsOnChange is the data change hook creating change
+// requests in the background
+func syncChangeRequestsOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := syncChangeRequests(); err != nil {
+			logServiceNow.Error("ServiceNow sync failed", "err", err)
+		}
+	}()
+}
+
+// pollChangeRequests reads approvals back every pollIntervalSeconds
+func pollChangeRequests() {
+	for {
+		interval := defaultServiceNowPoll
+		if cfg, ok, _ := loadServiceNowConfig(); ok {
+			if cfg.PollSeconds > 0 {
+				interval = time.Duration(cfg.PollSeconds) * time.Second
+			}
+			if err := syncChangeRequests(); err != nil {
+				logServiceNow.Error("ServiceNow sync failed", "err", err)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Handle ServiceNow change requests: GET lists the changes created for
+// releases, POST syncs now
+func handleChangeRequests(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := syncChangeRequests(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := loadServiceNowState()
+	if err != nil {
+		http.Error(w, "Error reading change requests", http.StatusInternalServerError)
+		return
+	}
+	type change struct {
+		Number string `json:"number"`
+		serviceNowChange
+	}
+	list := []change{}
+	for number, c := range state.Changes {
+		list = append(list, change{number, c})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ForwardConfig is the forward section of audit-config.json: where audit
+// entries, and optionally access events, are sent for central collection
+type ForwardConfig struct {
+	Address  string `json:"address,omitempty"`  // host:port; nothing is forwarded without
+	Protocol string `json:"protocol,omitempty"` // udp, tcp or tls, default udp
+	Format   string `json:"format,omitempty"`   // rfc5424 or json (JSON lines), default rfc5424
+	Facility int    `json:"facility,omitempty"` // syslog facility, default 13 (log audit)
+	AppName  string `json:"appName,omitempty"`  // default relplanner
+	Access   bool   `json:"access,omitempty"`   // also forward every API request
+	CAFile   string `json:"caFile,omitempty"`   // PEM CAs of the collector, for tls
+	Insecure bool   `json:"insecure,omitempty"` // skip verifying the collector's certificate
+}
+
+// defaultForwardFacility is syslog's log audit facility
+const defaultForwardFacility = 13
+
+// forwardEvent is an event on its way to the collector, as a JSON line
+type forwardEvent struct {
+	Type     string      `json:"type"` // audit or access
+	Time     string      `json:"time"`
+	Host     string      `json:"host"`    // this server
+	App      string      `json:"app"`     // AppName
+	Sequence int64       `json:"seq"`     // of the forwarded events, showing gaps
+	Message  string      `json:"message"` // summary, the syslog MSG
+	Data     interface{} `json:"data"`    // the audit entry or accessEvent
+
+	Severity int         `json:"-"` // syslog severity
+	Params   [][2]string `json:"-"` // RFC 5424 structured data
+}
+
+// accessEvent is an API request, as forwarded
+type accessEvent struct {
+	Method   string `json:"method"`
+	Path     string `json:"path"`
+	Status   int    `json:"status"`
+	Duration int64  `json:"durationMs"`
+	User     string `json:"user,omitempty"`
+	Remote   string `json:"remote,omitempty"`
+	ID       string `json:"requestId,omitempty"`
+}
+
+// forwardQueue holds events until the forwarder sends them; when the
+// collector can't keep up, events are dropped rather than slowing requests
+var forwardQueue = make(chan forwardEvent, 1000)
+
+// forwardConfigTTL is how often the forwarder rereads its config
+const forwardConfigTTL = time.Minute
+
+// loadForwardConfig reads the forward section of audit-config.json
+func loadForwardConfig() (ForwardConfig, error) {
+	var cfg AuditConfig
+	err := readDataFile("audit-config.json", &cfg)
+	return cfg.Forward, err
+}
+
+// forwardingAccess caches whether access events are forwarded, so requests
+// don't read the config
+var forwardingAccess struct {
+	sync.Mutex
+	enabled bool
+	checked time.Time
+}
+
+// forward queues an event; runLogForwarding drops it unless forwarding is
+// configured
+func forward(e forwardEvent) {
+	e.Time = time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00") // RFC 5424 allows microseconds
+	select {
+	case forwardQueue <- e:
+	default:
+		logAudit.Warn("Log forwarding queue full, dropped an event", "type", e.Type)
+	}
+}
+
+// forwardAudit queues an audit entry
+func forwardAudit(e auditEntry) {
+	msg := fmt.Sprintf("%s %s %s", modifierName(e.User), e.Action, e.File)
+	if e.Record != "" {
+		msg += " " + e.Record
+	}
+	forward(forwardEvent{Type: "audit", Severity: 5, Message: msg, Data: e, Params: [][2]string{
+		{"seq", fmt.Sprint(e.Seq)}, {"user", modifierName(e.User)}, {"action", e.Action}, {"file", e.File},
+		{"record", e.Record}, {"before", e.Before}, {"after", e.After}, {"hash", e.Hash},
+	}})
+}
+
+// forwardAccess queues an API request when access events are forwarded
+func forwardAccess(e accessEvent) {
+	forwardingAccess.Lock()
+	if time.Since(forwardingAccess.checked) > forwardConfigTTL {
+		cfg, _ := loadForwardConfig()
+		forwardingAccess.enabled, forwardingAccess.checked = cfg.Address != "" && cfg.Access, time.Now()
+	}
+	enabled := forwardingAccess.enabled
+	forwardingAccess.Unlock()
+	if !enabled {
+		return
+	}
+	severity := 6
+	if e.Status >= 400 {
+		severity = 4
+	}
+	forward(forwardEvent{Type: "access", Severity: severity, Data: e,
+		Message: fmt.Sprintf("%s %s %d %dms", e.Method, e.Path, e.Status, e.Duration),
+		Params: [][2]string{
+			{"method", e.Method}, {"path", e.Path}, {"status", fmt.Sprint(e.Status)},
+			{"user", modifierName(e.User)}, {"remote", e.Remote}, {"requestId", e.ID},
+		}})
+}
+
+// rfc5424Escape escapes a structured data parameter value
+var rfc5424Escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// format renders an event as a syslog message or a JSON line
+func (e forwardEvent) format(cfg ForwardConfig) []byte {
+	if cfg.Format == "json" {
+		b, _ := json.Marshal(e)
+		return b
+	}
+	facility := cfg.Facility
+	if facility <= 0 {
+		facility = defaultForwardFacility
+	}
+	var sd strings.Builder
+	sd.WriteString("[" + e.Type + "@32473")
+	for _, p := range e.Params {
+		if p[1] != "" {
+			sd.WriteString(fmt.Sprintf(` %s="%s"`, p[0], rfc5424Escape.Replace(p[1])))
+		}
+	}
+	sd.WriteString("]")
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s", facility*8+e.Severity, e.Time, e.Host, e.App,
+		os.Getpid(), e.Type, sd.String(), e.Message))
+}
+
+// dialForward connects to the collector
+func dialForward(cfg ForwardConfig) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	switch cfg.Protocol {
+	case "", "udp":
+		return dialer.Dial("udp", cfg.Address)
+	case "tcp":
+		return dialer.Dial("tcp", cfg.Address)
+	case "tls":
+		tlsConfig := &tls.Config{InsecureSkipVerify: cfg.Insecure}
+		if cfg.CAFile != "" {
+			pem, err := os.ReadFile(cfg.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in %s", cfg.CAFile)
+			}
+		}
+		return tls.DialWithDialer(dialer, "tcp", cfg.Address, tlsConfig)
+	default:
+		return nil, fmt.Errorf("unknown protocol %q, expected udp, tcp or tls", cfg.Protocol)
+	}
+}
+
+// runLogForwarding sends queued events to the collector, reconnecting
+// after failures. Streams frame syslog messages by octet counting, as
+// RFC 5425, and JSON by lines.
+func runLogForwarding() {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "-"
+	}
+	var (
+		cfg      ForwardConfig
+		loaded   time.Time
+		conn     net.Conn
+		seq      int64
+		failedAt time.Time
+	)
+	for e := range forwardQueue {
+		if time.Since(loaded) > forwardConfigTTL {
+			next, err := loadForwardConfig()
+			if err != nil {
+				logAudit.Error("Error reading the log forwarding config", "err", err)
+			}
+			if next != cfg && conn != nil {
+				conn.Close()
+				conn = nil
+			}
+			cfg, loaded = next, time.Now()
+		}
+		if cfg.Address == "" || e.Type == "access" && !cfg.Access {
+			continue
+		}
+		seq++
+		if conn == nil {
+			// Don't retry a failing collector for every event
+			if time.Since(failedAt) < 10*time.Second {
+				continue
+			}
+			c, err := dialForward(cfg)
+			if err != nil {
+				logAudit.Error("Log forwarding failed", "address", cfg.Address, "err", err)
+				failedAt = time.Now()
+				continue
+			}
+			conn = c
+		}
+
+		e.Host, e.App, e.Sequence = host, cfg.AppName, seq
+		if e.App == "" {
+			e.App = "relplanner"
+		}
+		msg := e.format(cfg)
+		switch {
+		case cfg.Protocol == "" || cfg.Protocol == "udp":
+		case cfg.Format == "json":
+			msg = append(msg, '\n')
+		default:
+			msg = append([]byte(fmt.Sprintf("%d ", len(msg))), msg...)
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if _, err := conn.Write(msg); err != nil {
+			logAudit.Error("Log forwarding failed", "address", cfg.Address, "err", err)
+			conn.Close()
+			conn, failedAt = nil, time.Now()
+		}
+	}
+}
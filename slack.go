@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SlackConfig is slack-config.json, kept on disk only since webhook URLs
+// are credentials. Release events are posted to the channels routed for
+// their environment, worded by per-event templates.
+type SlackConfig struct {
+	webhookRouting
+	Templates map[string]string `json:"templates,omitempty"` // event type -> text/template over releaseEvent
+	BaseURL   string            `json:"baseUrl,omitempty"`   // planner URL, available to templates as .URL
+
+	// SigningSecret verifies /releases slash commands, see handleSlackCommand
+	SigningSecret string `json:"signingSecret,omitempty"`
+}
+
+// defaultSlackTemplates word events without a configured template; Slack
+// renders <url|text> as a link
+var defaultSlackTemplates = map[string]string{
+	eventCreated:   `:calendar: *{{.Name}}* scheduled on {{.EnvironmentName}} for {{.Date}}{{if .Window}} {{.Window}}{{end}} ({{.Status}})`,
+	eventMoved:     `:arrows_counterclockwise: *{{.Name}}* on {{.EnvironmentName}} moved from {{.PreviousDate}} to {{.Date}}`,
+	eventApproved:  `:white_check_mark: *{{.Name}}* on {{.EnvironmentName}} is {{.Status}} for {{.Date}}{{if .Window}} {{.Window}}{{end}}`,
+	eventCancelled: `:x: *{{.Name}}* on {{.EnvironmentName}} for {{.Date}} was cancelled`,
+	eventReminder:  `:alarm_clock: *{{.Name}}* on {{.EnvironmentName}} in {{.Reminder}} ({{.Date}}{{if .Window}} {{.Window}}{{end}}){{if .Unapproved}}, still {{.Status}} and not approved{{end}}{{if .OpenItems}}. Open checklist: {{join .OpenItems ", "}}{{end}}`,
+}
+
+// loadSlackConfig reads slack-config.json; ok is false when Slack isn't configured
+func loadSlackConfig() (cfg SlackConfig, ok bool, err error) {
+	if err := readDataFile("slack-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	return cfg, len(cfg.Webhooks) > 0, nil
+}
+
+// postSlack sends a message to an incoming webhook
+func postSlack(webhook, text string) error {
+	req, err := http.NewRequest(http.MethodPost, webhook, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, map[string]string{"text": text}, nil)
+}
+
+func init() {
+	registerNotificationChannel("slack", notificationChannel{defaults: slackChannels, send: sendSlack})
+}
+
+// slackChannels returns the channels slack-config.json routes an event to
+func slackChannels(event releaseEvent) ([]string, error) {
+	cfg, ok, err := loadSlackConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok || !cfg.wants(event) {
+		return nil, nil
+	}
+	return cfg.channels(event, "Slack"), nil
+}
+
+// sendSlack posts an event to Slack channels
+func sendSlack(event releaseEvent, channels []string) error {
+	cfg, ok, err := loadSlackConfig()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok {
+		return errNotConfigured
+	}
+	text, err := renderEventTemplate(cfg.Templates, defaultSlackTemplates, event, cfg.BaseURL)
+	if err != nil || text == "" {
+		return err
+	}
+	var errs []error
+	for _, channel := range channels {
+		webhook, ok := cfg.Webhooks[channel]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown channel %q", channel))
+			continue
+		}
+		if err := postSlack(webhook, text); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackRequestMaxAge rejects replayed slash commands
+const slackRequestMaxAge = 5 * time.Minute
+
+// defaultSlackUpcomingDays is how far ahead "/releases upcoming" looks
+const defaultSlackUpcomingDays = 14
+
+// slackCommandHelp lists the slash command's subcommands
+const slackCommandHelp = "Usage:\n" +
+	"• `/releases next [environment]` the next release\n" +
+	"• `/releases upcoming [environment] [days]` releases in the next days (default 14)\n" +
+	"• `/releases freezes` freezes in the next 30 days"
+
+// verifySlackSignature checks the X-Slack-Signature of a request body
+// against the app's signing secret
+func verifySlackSignature(secret string, r *http.Request, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%d:", ts)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Slack-Signature")))
+}
+
+// resolveEnvironment matches a name typed in chat to an environment: its
+// name, display name or a unique prefix such as "prod"
+func resolveEnvironment(envs EnvironmentsData, typed string) (Environment, bool) {
+	typed = strings.ToLower(typed)
+	var prefixed []Environment
+	for _, env := range envs.Environments {
+		if strings.ToLower(env.Name) == typed || strings.ToLower(env.DisplayName) == typed {
+			return env, true
+		}
+		if strings.HasPrefix(strings.ToLower(env.Name), typed) || strings.HasPrefix(strings.ToLower(env.DisplayName), typed) {
+			prefixed = append(prefixed, env)
+		}
+	}
+	if len(prefixed) == 1 {
+		return prefixed[0], true
+	}
+	return Environment{}, false
+}
+
+// slackReleaseLine formats a release as one line of a reply
+func slackReleaseLine(env Environment, e ReleaseEntry) string {
+	name := e.ReleaseName
+	if name == "" {
+		name = "Release"
+	}
+	line := fmt.Sprintf("• *%s* on %s, %s", name, env.DisplayName, e.Date)
+	if window := e.windowLabel(); window != "" {
+		line += " " + window
+	}
+	return line + " (" + e.Status + ")"
+}
+
+// slackCommandReply answers the text of a /releases command
+func slackCommandReply(text string, now time.Time) (string, error) {
+	args := strings.Fields(text)
+	if len(args) == 0 || args[0] == "help" {
+		return slackCommandHelp, nil
+	}
+	envs, err := loadEnvironments()
+	if err != nil {
+		return "", err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return "", err
+	}
+	byName := map[string]Environment{}
+	for _, env := range envs.Environments {
+		if env.DisplayName == "" {
+			env.DisplayName = env.Name
+		}
+		byName[env.Name] = env
+	}
+
+	// An optional environment, then an optional number of days
+	var env *Environment
+	rest := args[1:]
+	if len(rest) > 0 {
+		if _, err := strconv.Atoi(rest[0]); err != nil {
+			found, ok := resolveEnvironment(envs, rest[0])
+			if !ok {
+				return fmt.Sprintf("Unknown environment %q.", rest[0]), nil
+			}
+			found = byName[found.Name]
+			env, rest = &found, rest[1:]
+		}
+	}
+
+	switch args[0] {
+	case "next":
+		name := ""
+		if env != nil {
+			name = env.Name
+		}
+		next, start := findNextRelease(releases, name, now)
+		if next == nil {
+			return "No upcoming release.", nil
+		}
+		return fmt.Sprintf("Next release, in %s:\n%s", formatCountdown(start.Sub(now)), slackReleaseLine(byName[next.Environment], next.ReleaseEntry)), nil
+
+	case "upcoming", "list":
+		days := defaultSlackUpcomingDays
+		if len(rest) > 0 {
+			if days, err = strconv.Atoi(rest[0]); err != nil || days < 1 || days > 365 {
+				return "Days must be a number from 1 to 365.", nil
+			}
+		}
+		type found struct {
+			env   Environment
+			entry ReleaseEntry
+			start time.Time
+		}
+		var list []found
+		horizon := now.AddDate(0, 0, days)
+		for name, entries := range releases {
+			if env != nil && name != env.Name {
+				continue
+			}
+			for _, e := range entries {
+				start, end, err := e.window()
+				if err != nil || e.Status == "None" || !end.After(now) || start.After(horizon) {
+					continue
+				}
+				list = append(list, found{byName[name], e, start})
+			}
+		}
+		if len(list) == 0 {
+			return fmt.Sprintf("No releases in the next %d days.", days), nil
+		}
+		sort.Slice(list, func(i, j int) bool { return list[i].start.Before(list[j].start) })
+		lines := []string{fmt.Sprintf("Releases in the next %d days:", days)}
+		for _, f := range list {
+			lines = append(lines, slackReleaseLine(f.env, f.entry))
+		}
+		return strings.Join(lines, "\n"), nil
+
+	case "freezes":
+		freezes := envs.activeFreezes(now, now.AddDate(0, 0, 30))
+		if len(freezes) == 0 {
+			return "No freezes in the next 30 days.", nil
+		}
+		lines := []string{"Freezes in the next 30 days:"}
+		for _, f := range freezes {
+			line := fmt.Sprintf("• %s: %s to %s", f.Group, f.From, f.To)
+			if f.Reason != "" {
+				line += " (" + f.Reason + ")"
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return fmt.Sprintf("Unknown command %q.\n%s", args[0], slackCommandHelp), nil
+}
+
+// Handle the /releases Slack slash command. Requests must carry a valid
+// Slack signature for the signingSecret of slack-config.json; replies are
+// only visible to the caller.
+func handleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, _, err := loadSlackConfig()
+	if err != nil || cfg.SigningSecret == "" {
+		http.Error(w, "Slack commands are not configured", http.StatusNotFound)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Error reading request", http.StatusBadRequest)
+		return
+	}
+	if !verifySlackSignature(cfg.SigningSecret, r, body, time.Now()) {
+		http.Error(w, "Invalid Slack signature", http.StatusUnauthorized)
+		return
+	}
+	form, err := url.ParseQuery(string(bytes.TrimSpace(body)))
+	if err != nil {
+		http.Error(w, "Invalid form body", http.StatusBadRequest)
+		return
+	}
+
+	text, err := slackCommandReply(form.Get("text"), time.Now())
+	if err != nil {
+		text = fmt.Sprintf("Sorry, the release plan could not be read: %v", err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"response_type": "ephemeral", "text": text})
+}
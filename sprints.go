@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andygrunwald/go-jira"
+)
+
+// jiraSprint is a sprint of one of the boards listed in jira-config.json
+type jiraSprint struct {
+	ID    int        `json:"id"`
+	Name  string     `json:"name"`
+	Board int        `json:"board"`
+	State string     `json:"state"`
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// sprintCache holds the active and future sprints of the configured boards
+var sprintCache struct {
+	sync.Mutex
+	sprints   []jiraSprint
+	fetchedAt time.Time
+}
+
+// jiraBoards reads the board IDs from the Jira config
+func jiraBoards(config map[string]interface{}) []int {
+	var boards []int
+	decodeInto(config["boards"], &boards)
+	return boards
+}
+
+// fetchSprints loads the active and future sprints of all configured boards
+func fetchSprints(ctx context.Context, boards []int) ([]jiraSprint, error) {
+	client, _, err := newJiraClient(ctx)
+	if err != nil || client == nil {
+		return []jiraSprint{}, err
+	}
+	sprints := []jiraSprint{}
+	for _, board := range boards {
+		opts := &jira.GetAllSprintsOptions{State: "active,future"}
+		for {
+			page, _, err := client.Board.GetAllSprintsWithOptions(board, opts)
+			if err != nil {
+				return nil, fmt.Errorf("board %d: %w", board, err)
+			}
+			for _, s := range page.Values {
+				sprints = append(sprints, jiraSprint{ID: s.ID, Name: s.Name, Board: board, State: s.State, Start: s.StartDate, End: s.EndDate})
+			}
+			if page.IsLast || len(page.Values) == 0 {
+				break
+			}
+			opts.StartAt += len(page.Values)
+		}
+	}
+	return sprints, nil
+}
+
+// cachedSprints returns the sprints of the configured boards, cached like
+// ticket searches and served stale while Jira is down
+func cachedSprints(refresh bool) ([]jiraSprint, error) {
+	config, err := loadJiraConfig()
+	if err != nil {
+		return nil, err
+	}
+	boards := jiraBoards(config)
+	if len(boards) == 0 {
+		return []jiraSprint{}, nil
+	}
+
+	sprintCache.Lock()
+	defer sprintCache.Unlock()
+	if !refresh && sprintCache.sprints != nil && (jiraBackgroundRefresh() || time.Since(sprintCache.fetchedAt) < jiraCacheTTL(config)) {
+		return sprintCache.sprints, nil
+	}
+	sprints, err := fetchSprints(context.Background(), boards)
+	if err != nil {
+		if sprintCache.sprints != nil {
+			logJira.Warn("Jira unavailable, serving cached sprints", "cachedAt", sprintCache.fetchedAt.Format(time.RFC3339), "err", err)
+			return sprintCache.sprints, nil
+		}
+		return nil, err
+	}
+	sprintCache.sprints, sprintCache.fetchedAt = sprints, time.Now()
+	return sprints, nil
+}
+
+// sprintJQL narrows a JQL query to the tickets of a sprint
+func sprintJQL(jql, sprint string) (string, error) {
+	if _, err := strconv.Atoi(sprint); err != nil {
+		return "", &jiraError{http.StatusBadRequest, "Invalid sprint id"}
+	}
+	if jql = strings.TrimSpace(jql); jql != "" {
+		// ORDER BY has to stay at the end of the query
+		order := ""
+		if i := strings.Index(strings.ToUpper(jql), "ORDER BY"); i >= 0 {
+			jql, order = strings.TrimSpace(jql[:i]), " "+jql[i:]
+		}
+		jql = fmt.Sprintf("(%s) AND sprint = %s%s", jql, sprint, order)
+	} else {
+		jql = "sprint = " + sprint
+	}
+	return jql, nil
+}
+
+// sprintBars returns the sprints overlapping [from, to) as timeline bars
+func sprintBars(from, to time.Time) []timelineBar {
+	bars := []timelineBar{}
+	sprints, err := cachedSprints(false)
+	if err != nil {
+		return bars
+	}
+	for _, s := range sprints {
+		if s.Start == nil || s.End == nil || !s.Start.Before(to) || !s.End.After(from) {
+			continue
+		}
+		bars = append(bars, timelineBar{
+			ID:    "sprint:" + strconv.Itoa(s.ID),
+			Type:  "sprint",
+			Label: s.Name,
+			Start: *s.Start,
+			End:   *s.End,
+		})
+	}
+	assignLanes(bars)
+	return bars
+}
+
+// Handle Jira sprints: the active and future sprints of the configured boards
+func handleJiraSprints(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sprints, err := cachedSprints(r.URL.Query().Get("refresh") == "1")
+	if err != nil {
+		writeJiraError(w, err)
+		return
+	}
+	if state := r.URL.Query().Get("state"); state != "" {
+		filtered := []jiraSprint{}
+		for _, s := range sprints {
+			if s.State == state {
+				filtered = append(filtered, s)
+			}
+		}
+		sprints = filtered
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprints)
+}
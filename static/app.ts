@@ -8,6 +8,12 @@ interface Environment {
   name: string;
   displayName: string;
   visible: boolean;
+  owner?: string;
+  description?: string;
+  url?: string;
+  tier?: "critical" | "high" | "medium" | "low";
+  color?: string; // Hex color e.g. "#1e90ff"
+  lock?: { reason: string; maintenance?: boolean; lockedAt: string; until?: string };
 }
 
 interface ReleaseEnvironmentConfig {
@@ -32,6 +38,60 @@ interface ReleaseEntry {
   endDateTime?: string; // End date & time e.g. "2025-04-16T03:00"
   note?: string;
   dependsOn?: string; // Dependency reference: "environment:date" e.g. "staging:2025-04-15"
+  labels?: string[];
+  risk?: string; // critical, high, medium or low
+  checklist?: { text: string; done?: boolean }[];
+  tickets?: string[]; // Tickets linked to this release
+  jenkinsJob?: string; // Jenkins job path e.g. "deploy/backend", the environment's job when unset
+  gitlabProject?: string; // GitLab project path whose pipeline deploys the release
+  gitlabRef?: string;
+  ticketProvider?: string; // a provider from /api/ticket-providers, "jira" when unset
+  releaseManager?: string; // Person ID from the team roster
+  deployers?: string[];
+  // Maintained by the server on save
+  originalDate?: string; // First planned date
+  reschedules?: { from: string; to: string; at: string }[];
+  completedAt?: string; // When the release was first marked done
+  jiraIssue?: string; // Release issue created in Jira by the server
+  jiraVersion?: string; // Jira fixVersion ID maintained by the server
+  githubMilestone?: string; // GitHub milestone number maintained by the server
+  changeRequest?: string; // ServiceNow CHG number maintained by the server
+  changeApproval?: string;
+  githubRelease?: string; // GitHub Release ID maintained by the server
+  deployment?: {
+    provider: string; // jenkins, github or gitlab
+    job: string; // Jenkins job, workflow file or GitLab project
+    ref?: string;
+    id?: string; // workflow run or pipeline ID
+    version?: string;
+    status: string; // queued, running, finished or error
+    result?: string;
+    url?: string;
+    triggeredAt: string;
+    finishedAt?: string;
+  };
+  outcome?: ReleaseOutcome | null; // How it actually went, see /api/releases/{id}/outcome
+  retrospective?: {
+    url?: string; // The retrospective document
+    findings?: { category?: string; text: string }[];
+    actionItems?: { text: string; owner?: string; ticket?: string; done?: boolean }[];
+    recordedBy?: string;
+    recordedAt: string;
+  } | null;
+  incidents?: { id: string; url?: string; severity: string; title?: string; linkedAt: string }[]; // Incidents it is suspected of causing
+  modifiedBy?: string; // Who last changed it, maintained by the server
+  modifiedAt?: string;
+}
+
+// Outcome recorded for a release once it went out
+interface ReleaseOutcome {
+  startedAt?: string;
+  finishedAt?: string;
+  result: string; // success, partial or rolled-back
+  logsUrl?: string;
+  notes?: string;
+  recordedBy?: string;
+  recordedAt: string;
 }
 
 interface ReleasesData {
@@ -51,6 +111,20 @@ interface JiraTicket {
 interface Holiday {
   date: string;
   name: string;
+  names?: { [lang: string]: string }; // by language tag, e.g. "de"
+}
+
+// holidayName returns a holiday's name in the browser's language, or the
+// base language, when it has one
+function holidayName(holiday: Holiday): string {
+  const names = holiday.names || {};
+  for (const lang of navigator.languages || [navigator.language]) {
+    const tag = lang.toLowerCase();
+    if (names[tag]) return names[tag];
+    const base = tag.split('-')[0];
+    if (names[base]) return names[base];
+  }
+  return holiday.name;
 }
 
 interface HolidaysData {
@@ -108,6 +182,7 @@ let beTagInput: HTMLInputElement;
 let releaseNameInput: HTMLInputElement;
 let jiraTicketInput: HTMLInputElement;
 let jiraLink: HTMLAnchorElement;
+let ticketProviderSelect: HTMLSelectElement;
 let loadJiraTicketsButton: HTMLButtonElement;
 let jiraTicketsList: HTMLDivElement;
 let ticketsContainer: HTMLDivElement;
@@ -145,6 +220,35 @@ let draggedEnvironment: string | null = null;
 let draggedReleaseEntry: ReleaseEntry | null = null;
 let draggedIndex: number = -1;
 
+// Completion percentage of synced GitHub milestones by number
+let milestoneProgress: { [number: string]: number } = {};
+
+// What runs on each environment per ArgoCD and Kubernetes, next to the
+// version of its latest completed release
+interface EnvironmentVersions {
+  planned?: string;
+  applications: {
+    source: string;
+    name: string;
+    version: string;
+    revision?: string;
+    syncStatus?: string; // Synced, OutOfSync...
+    health?: string;
+    images?: string[];
+  }[];
+}
+let deployedVersions: { [environment: string]: EnvironmentVersions } = {};
+
+// Ticket providers registered on the server, by ID
+interface TicketProviderInfo {
+  id: string;
+  name: string;
+  keyFormat: string;
+  keyExample: string;
+  configured: boolean;
+}
+let ticketProviders: { [id: string]: TicketProviderInfo } = {};
+
 const backupConfig = {
   maxBackups: 3,  // Maximum number of backups to keep for each file type
   enabled: true  // Whether backups are enabled
@@ -156,6 +260,7 @@ const backupConfig = {
 function closeModal() {
   modal.style.display = "none";
   modalContext = null;
+  stopPresence();
   console.log("Modal closed");
 }
 
@@ -176,6 +281,29 @@ function updateReleaseName() {
   releaseNameInput.value = generateReleaseName(feTag, beTag);
 }
 
+/**
+ * Describe a recorded outcome for tooltips, e.g. "Outcome: rolled-back 20:05-20:40"
+ */
+function describeOutcome(outcome: ReleaseOutcome): string {
+  const time = (t?: string) => t ? new Date(t).toTimeString().slice(0, 5) : '';
+  let text = `Outcome: ${outcome.result}`;
+  if (outcome.startedAt || outcome.finishedAt) text += ` ${time(outcome.startedAt)}-${time(outcome.finishedAt)}`;
+  if (outcome.notes) text += ` (${outcome.notes})`;
+  if (outcome.logsUrl) text += `\nLogs: ${outcome.logsUrl}`;
+  return text;
+}
+
+/**
+ * Describe a release's retrospective for tooltips: its findings and open action items
+ */
+function describeRetrospective(retro: NonNullable<ReleaseEntry['retrospective']>): string {
+  const findings = retro.findings || [];
+  const open = (retro.actionItems || []).filter(item => !item.done).length;
+  let text = `Retrospective: ${findings.length} finding${findings.length === 1 ? '' : 's'}, ${open} open action item${open === 1 ? '' : 's'}`;
+  if (retro.url) text += `\n${retro.url}`;
+  return text;
+}
+
 /**
  * Validate Jira ticket format (letters-dash-numbers)
  */
@@ -184,6 +312,21 @@ function isValidJiraTicket(ticket: string): boolean {
   return jiraPattern.test(ticket);
 }
 
+/**
+ * Validate GitHub ticket format (owner/repo#number)
+ */
+function isValidGitHubTicket(ticket: string): boolean {
+  return /^[A-Za-z0-9-]+\/[A-Za-z0-9._-]+#\d+$/.test(ticket);
+}
+
+/**
+ * Generate GitHub URL for a ticket; issue URLs redirect to pull requests
+ */
+function generateGitHubUrl(ticket: string): string {
+  const [repo, number] = ticket.split('#');
+  return `https://github.com/${repo}/issues/${number}`;
+}
+
 /**
  * Generate Jira URL for a ticket
  */
@@ -236,6 +379,26 @@ function parseReleaseFromSummary(summary: string): { feTag: string; beTag: strin
  * Update Jira link based on ticket input
  */
 function updateJiraLink() {
+  if (ticketProviderSelect.value !== "jira" && ticketProviderSelect.value !== "github") {
+    // The server URL isn't known here, so there is no link to open
+    const provider = ticketProviders[ticketProviderSelect.value];
+    jiraTicketInput.placeholder = provider ? `e.g. ${provider.keyExample}` : "";
+    jiraLink.style.display = "none";
+    return;
+  }
+  if (ticketProviderSelect.value === "github") {
+    const ticket = jiraTicketInput.value.trim();
+    jiraTicketInput.placeholder = "e.g. owner/repo#123";
+    if (ticket && isValidGitHubTicket(ticket)) {
+      jiraLink.href = generateGitHubUrl(ticket);
+      jiraLink.textContent = `🔗 Open ${ticket}`;
+      jiraLink.style.display = "inline";
+    } else {
+      jiraLink.style.display = "none";
+    }
+    return;
+  }
+  jiraTicketInput.placeholder = "e.g. REL-46";
   const ticket = jiraTicketInput.value.trim().toUpperCase();
   if (ticket && isValidJiraTicket(ticket)) {
     jiraLink.href = generateJiraUrl(ticket);
@@ -254,12 +417,21 @@ async function loadJiraTickets() {
     loadJiraTicketsButton.textContent = "⏳ Loading...";
     loadJiraTicketsButton.disabled = true;
     
-    const response = await fetch('/api/jira-tickets');
+    const provider = ticketProviderSelect.value;
+    const providerName = ticketProviders[provider] ? ticketProviders[provider].name : provider;
+    if (!featureEnabled(provider)) {
+      showNotification(`${providerName} is not configured on the server`, 'info');
+      return;
+    }
+    const response = await fetch(`/api/tickets/${encodeURIComponent(provider)}`);
     if (!response.ok) {
       throw new Error(`HTTP error! status: ${response.status}`);
     }
     
     const tickets: JiraTicket[] = await response.json();
+    if (response.headers.get('X-Cache') === 'STALE') {
+      showNotification(`${providerName} is unavailable, showing cached tickets`, 'info');
+    }
     console.log('loadJiraTickets - response.json() returned:', tickets);
     console.log('loadJiraTickets - tickets type:', typeof tickets);
     console.log('loadJiraTickets - tickets is null?', tickets === null);
@@ -414,6 +586,7 @@ function saveModal() {
     if (feTag !== "") releaseEntry.feTag = feTag;
     if (beTag !== "") releaseEntry.beTag = beTag;
     if (jiraTicket !== "") releaseEntry.jiraTicket = jiraTicket;
+    if (ticketProviderSelect.value !== "jira") releaseEntry.ticketProvider = ticketProviderSelect.value;
     if (startTime !== "") releaseEntry.startTime = startTime;
     if (endDateTime !== "") releaseEntry.endDateTime = endDateTime;
     if (dependsOn !== "") releaseEntry.dependsOn = dependsOn;
@@ -514,6 +687,26 @@ function updatePairedEmployeeCalendar(username: string, isoDate: string) {
 // Store last saved data hash to detect changes
 let lastSavedReleasesHash: string | null = null;
 
+// ETag of the releases as loaded or last saved, the base of our edits
+let releasesETag = '';
+
+/**
+ * Post the releases, conditional on the version they were edited from
+ */
+function postReleases(data: ReleasesData, ifMatch: string): Promise<Response> {
+  // Only send backup config if backups are enabled
+  const maxBackupsHeader = backupConfig.enabled ? backupConfig.maxBackups.toString() : "0";
+  return fetch("/api/releases.json", {
+    method: "POST",
+    headers: {
+      "Content-Type": "application/json",
+      "X-Max-Backups": maxBackupsHeader,
+      "If-Match": ifMatch
+    },
+    body: JSON.stringify(data)
+  });
+}
+
 /**
  * Generate a simple hash of the releases data to detect changes
  */
@@ -537,23 +730,31 @@ async function saveData(environment, forceSave = false) {
 
     console.log(`Saving data for ${environment}...`);
 
-    // Only send backup config if backups are enabled
-    const maxBackupsHeader = backupConfig.enabled ? backupConfig.maxBackups.toString() : "0";
-
-    // Get current ETags for optimistic concurrency
-    const etagDaysRes = await fetch('/api/releases.json');
-    const etagDays = etagDaysRes.headers.get('ETag') || '';
-
     // Only save releases - holidays are never modified in the app
-    const daysOffResponse = await fetch("/api/releases.json", {
-      method: "POST",
-      headers: {
-        "Content-Type": "application/json",
-        "X-Max-Backups": maxBackupsHeader,
-        "If-Match": etagDays
-      },
-      body: JSON.stringify(releasesData)
-    });
+    let daysOffResponse = await postReleases(releasesData, releasesETag);
+
+    // Others saved meanwhile: merge their changes with ours and save that
+    let conflicts: { path: string }[] = [];
+    if (daysOffResponse.status === 412) {
+      const mergeResponse = await fetch("/api/merge/releases.json", {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify({ base: releasesETag, document: releasesData })
+      });
+      if (!mergeResponse.ok) {
+        const txt = await mergeResponse.text();
+        throw new Error(`releases changed meanwhile and could not be merged (${mergeResponse.status}): ${txt}`);
+      }
+      const merge: { merged: ReleasesData; conflicts: { path: string }[]; etag: string } = await mergeResponse.json();
+      releasesData = merge.merged;
+      conflicts = merge.conflicts;
+      daysOffResponse = await postReleases(releasesData, merge.etag);
+      if (continuousViewMode) {
+        buildContinuousCalendar();
+      } else {
+        buildCalendar(currentYear, currentMonth);
+      }
+    }
 
     if (!daysOffResponse.ok) {
       const txt = await daysOffResponse.text();
@@ -562,15 +763,239 @@ async function saveData(environment, forceSave = false) {
 
     // Update the hash after successful save with current data
     lastSavedReleasesHash = generateReleasesHash(releasesData);
+    releasesETag = daysOffResponse.headers.get('ETag') || '';
+    lastSavedETag = releasesETag.replace(/"/g, '');
 
     console.log(`Data saved successfully for ${environment}`);
-    showNotification("Changes saved successfully", "success");
+    const saveResult = await daysOffResponse.json().catch(() => ({}));
+    const warnings: { message: string }[] = saveResult.warnings || [];
+    if (conflicts.length > 0) {
+      showNotification(`Merged with changes saved meanwhile, theirs kept for ${conflicts.map(c => c.path).join(", ")}`, "info");
+    } else if (warnings.length > 0) {
+      showNotification(`Saved with warnings: ${warnings.map(w => w.message).join("; ")}`, "info");
+    } else {
+      showNotification("Changes saved successfully", "success");
+    }
+    refreshUndoButtons();
   } catch (error) {
     console.error("Error saving data:", error);
     showNotification(`Failed to save changes: ${error instanceof Error ? error.message : error}` as any, "error");
   }
 }
 
+// ETag of our own last save, so live updates skip the echo of it
+let lastSavedETag = '';
+let liveSocket: WebSocket | null = null;
+let liveRetryDelay = 1000;
+// Cursor of the last change seen, to catch up on those missed while
+// disconnected from /api/changes
+let liveCursor = 0;
+
+const liveFiles = ['releases.json', 'environments.json', 'holidays.json'];
+
+interface LiveChange {
+  seq?: number;
+  file: string;
+  by?: string;
+  etag: string;
+  records?: string[];
+}
+
+/**
+ * Reload the data and the view after others changed a data file
+ */
+async function applyLiveChange(change: LiveChange) {
+  if (change.seq && change.seq > liveCursor) liveCursor = change.seq;
+  if (!liveFiles.includes(change.file)) return;
+  if (change.file === 'releases.json' && change.etag === lastSavedETag) return;
+  if (!(await loadData())) return;
+  lastSavedReleasesHash = generateReleasesHash(releasesData);
+  if (continuousViewMode) {
+    buildContinuousCalendar();
+  } else {
+    buildCalendar(currentYear, currentMonth);
+  }
+  showNotification(`${change.by || 'Someone'} changed ${change.file}`, "info");
+  refreshUndoButtons();
+}
+
+/**
+ * Apply the changes saved since the cursor, the latest of them being
+ * enough as each reloads everything
+ */
+async function catchUpLiveChanges() {
+  try {
+    const response = await fetch(`/api/changes?since=${liveCursor}&limit=1000`);
+    if (!response.ok) return;
+    const page: { cursor: number; changes: LiveChange[] } = await response.json();
+    const missed = page.changes.filter(c => liveFiles.includes(c.file) &&
+      !(c.file === 'releases.json' && c.etag === lastSavedETag));
+    if (missed.length > 0) {
+      await applyLiveChange(missed[missed.length - 1]);
+    }
+    liveCursor = Math.max(liveCursor, page.cursor);
+  } catch (error) {
+    console.error("Error catching up on changes:", error);
+  }
+}
+
+/**
+ * Follow changes other planners save over /api/ws, reloading the data and
+ * the view when one lands, reconnecting with backoff when the socket drops
+ */
+function connectLiveUpdates() {
+  const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
+  liveSocket = new WebSocket(`${protocol}//${location.host}/api/ws?files=${liveFiles.join(',')}`);
+  liveSocket.onopen = () => {
+    liveRetryDelay = 1000;
+    if (liveCursor > 0) catchUpLiveChanges();
+  };
+  liveSocket.onmessage = (event) => {
+    try {
+      applyLiveChange(JSON.parse(event.data));
+    } catch {
+      // not a change
+    }
+  };
+  liveSocket.onclose = () => {
+    liveSocket = null;
+    setTimeout(connectLiveUpdates, liveRetryDelay);
+    liveRetryDelay = Math.min(liveRetryDelay * 2, 30000);
+  };
+}
+
+/**
+ * Start following live updates from the current cursor
+ */
+async function initLiveUpdates() {
+  try {
+    const response = await fetch('/api/changes');
+    if (response.ok) liveCursor = (await response.json()).cursor || 0;
+  } catch (error) {
+    console.error("Error reading the change cursor:", error);
+  }
+  connectLiveUpdates();
+}
+
+/**
+ * Add a workspace switcher to the controls when the server hosts workspaces
+ */
+// serverFeatures are the optional subsystems of GET /api/features
+let serverFeatures: { [name: string]: { enabled: boolean } } | null = null;
+
+async function loadFeatures() {
+  try {
+    const response = await fetch('/api/features');
+    if (response.ok) serverFeatures = await response.json();
+  } catch (error) {
+    console.error("Error loading features:", error);
+  }
+}
+
+// featureEnabled reports whether the server has a subsystem configured;
+// unknown ones, and all before the features are known, count as enabled
+function featureEnabled(name: string): boolean {
+  const feature = serverFeatures && serverFeatures[name];
+  return !feature || feature.enabled;
+}
+
+async function addWorkspaceSelect() {
+  const controls = document.getElementById('controls');
+  if (!controls || !featureEnabled('workspaces')) return;
+  try {
+    const response = await fetch('/api/workspaces');
+    if (!response.ok) return;
+    const info: { current: string; workspaces: { name: string; displayName?: string }[] } = await response.json();
+    if (info.workspaces.length === 0) return;
+    const select = document.createElement('select');
+    select.id = 'workspaceSelect';
+    select.title = 'Workspace';
+    select.style.marginLeft = '10px';
+    const options = [{ name: '', displayName: 'Main workspace' }, ...info.workspaces];
+    for (const ws of options) {
+      const option = document.createElement('option');
+      option.value = ws.name;
+      option.text = ws.displayName || ws.name;
+      option.selected = ws.name === info.current;
+      select.appendChild(option);
+    }
+    select.addEventListener('change', () => {
+      location.href = `/w/${select.value}`;
+    });
+    controls.appendChild(select);
+  } catch (error) {
+    console.error("Error loading workspaces:", error);
+  }
+}
+
+/**
+ * Add the undo and redo buttons of release saves to the controls
+ */
+function addUndoButtons() {
+  const controls = document.getElementById('controls');
+  if (!controls) return;
+  for (const which of ['undo', 'redo'] as const) {
+    const button = document.createElement('button');
+    button.id = `${which}Button`;
+    button.textContent = which === 'undo' ? 'Undo' : 'Redo';
+    button.title = which === 'undo' ? 'Undo the last save of the releases' : 'Redo the last undo';
+    button.disabled = true;
+    button.style.cssText = `
+      padding: 6px 12px;
+      border-radius: 4px;
+      border: 1px solid #ccc;
+      cursor: pointer;
+      margin-left: 10px;
+    `;
+    button.addEventListener('click', () => undoSave(which));
+    controls.appendChild(button);
+  }
+  refreshUndoButtons();
+}
+
+/**
+ * Enable the undo and redo buttons when there is something to undo or redo
+ */
+async function refreshUndoButtons() {
+  const undoButton = document.getElementById('undoButton') as HTMLButtonElement | null;
+  const redoButton = document.getElementById('redoButton') as HTMLButtonElement | null;
+  if (!undoButton || !redoButton) return;
+  try {
+    const response = await fetch('/api/undo?file=releases.json');
+    if (!response.ok) return;
+    const state: { undo: number; redo: number } = await response.json();
+    undoButton.disabled = state.undo === 0;
+    redoButton.disabled = state.redo === 0;
+  } catch (error) {
+    console.error("Error reading the undo state:", error);
+  }
+}
+
+/**
+ * Undo the last save of the releases, or redo the last undo
+ */
+async function undoSave(which: 'undo' | 'redo') {
+  try {
+    const response = await fetch(`/api/${which}?file=releases.json`, { method: 'POST' });
+    if (!response.ok) {
+      throw new Error(`${response.status}: ${await response.text()}`);
+    }
+    lastSavedETag = (response.headers.get('ETag') || '').replace(/"/g, '');
+    if (await loadData()) {
+      lastSavedReleasesHash = generateReleasesHash(releasesData);
+      if (continuousViewMode) {
+        buildContinuousCalendar();
+      } else {
+        buildCalendar(currentYear, currentMonth);
+      }
+    }
+    showNotification(which === 'undo' ? "Last save undone" : "Undo redone", "success");
+  } catch (error) {
+    showNotification(`Failed to ${which}: ${error instanceof Error ? error.message : error}`, "error");
+  }
+  refreshUndoButtons();
+}
+
 /**
  * Save employees data (used when updating per-year allowances)
  */
@@ -641,6 +1066,15 @@ async function listBackups(filePrefix) {
 
 function saveBackupConfig() {
   localStorage.setItem("backupConfig", JSON.stringify(backupConfig));
+  // Signed in, the settings follow the user to other browsers
+  if (userPreferences) {
+    userPreferences = { ...userPreferences, ui: { ...userPreferences.ui, backupConfig } };
+    fetch('/api/me/preferences', {
+      method: 'PUT',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(userPreferences),
+    }).catch(error => console.error("Error saving preferences:", error));
+  }
   showNotification("Backup settings saved", "success");
 }
 
@@ -883,9 +1317,9 @@ async function createBackup(filename, data) {
 async function loadData() {
   try {
   const [employeesRes, daysOffRes, holidaysRes] = await Promise.all([
-    fetch("/api/environments.json"),
-    fetch("/api/releases.json"),
-    fetch("/api/holidays.json")
+    fetch("/api/environments.json", { cache: "no-cache" }),
+    fetch("/api/releases.json", { cache: "no-cache" }),
+    fetch("/api/holidays.json", { cache: "no-cache" })
   ]);
 
     // Check if responses are OK
@@ -895,7 +1329,11 @@ async function loadData() {
 
     environmentsData = await employeesRes.json();
     releasesData = await daysOffRes.json();
+    releasesETag = daysOffRes.headers.get('ETag') || '';
     holidaysData = await holidaysRes.json();
+    await loadMilestoneProgress();
+    await loadTicketProviders();
+    await loadDeployedVersions();
 
     // Validate data structure
     if (!environmentsData.environments || !Array.isArray(environmentsData.environments)) {
@@ -925,6 +1363,94 @@ async function loadData() {
   }
 }
 
+/**
+ * Load the completion of synced GitHub milestones; optional, so failures
+ * only leave the tooltips without it
+ */
+async function loadMilestoneProgress() {
+  try {
+    const response = await fetch("/api/github/milestones");
+    if (!response.ok) return;
+    const milestones: { number: string; percent: number }[] = await response.json();
+    milestoneProgress = {};
+    milestones.forEach((m) => { milestoneProgress[m.number] = m.percent; });
+  } catch (error) {
+    console.warn("Failed to load GitHub milestones", error);
+  }
+}
+
+/**
+ * Load the versions ArgoCD and Kubernetes report on each environment;
+ * optional, so failures only leave the environment names without them
+ */
+async function loadDeployedVersions() {
+  deployedVersions = {};
+  for (const path of ["/api/argocd/versions", "/api/kubernetes/versions"]) {
+    try {
+      const response = await fetch(path);
+      if (!response.ok) continue;
+      const versions: { [environment: string]: EnvironmentVersions } = await response.json();
+      Object.keys(versions).forEach((env) => {
+        const existing = deployedVersions[env];
+        if (existing) {
+          existing.applications.push(...versions[env].applications);
+        } else {
+          deployedVersions[env] = versions[env];
+        }
+      });
+    } catch (error) {
+      console.warn(`Failed to load deployed versions from ${path}`, error);
+    }
+  }
+}
+
+/**
+ * Show the deployed versions of an environment under its name, flagged when
+ * out of sync or not what the latest completed release planned
+ */
+function appendDeployedVersions(nameDiv: HTMLDivElement, environment: string) {
+  const versions = deployedVersions[environment];
+  if (!versions || versions.applications.length === 0) return;
+  const span = document.createElement("span");
+  span.classList.add("deployed-versions");
+  const drifted = versions.applications.some((a) =>
+    a.syncStatus === "OutOfSync" || (versions.planned !== undefined && a.version !== versions.planned));
+  if (drifted) span.classList.add("drifted");
+  span.textContent = versions.applications.map((a) => `${a.name} ${a.version}`).join(", ");
+  const lines = versions.applications.map((a) =>
+    `${a.name}: ${a.version}${a.syncStatus ? `, ${a.syncStatus}` : ""}${a.health ? `, ${a.health}` : ""}`);
+  if (versions.planned) lines.push(`Planned: ${versions.planned}`);
+  nameDiv.title += `\nDeployed:\n${lines.join("\n")}`;
+  nameDiv.appendChild(document.createElement("br"));
+  nameDiv.appendChild(span);
+}
+
+/**
+ * Load the ticket providers the server knows and offer them in the ticket
+ * provider picker; the options in index.html stay when this fails
+ */
+async function loadTicketProviders() {
+  try {
+    const response = await fetch("/api/ticket-providers");
+    if (!response.ok) return;
+    const providers: TicketProviderInfo[] = await response.json();
+    ticketProviders = {};
+    providers.forEach((p) => { ticketProviders[p.id] = p; });
+    if (!ticketProviderSelect) return;
+    const selected = ticketProviderSelect.value;
+    ticketProviderSelect.innerHTML = "";
+    providers.forEach((p) => {
+      const option = document.createElement("option");
+      option.value = p.id;
+      option.textContent = p.configured ? p.name : `${p.name} (not configured)`;
+      ticketProviderSelect.appendChild(option);
+    });
+    ticketProviderSelect.value = selected;
+  } catch (error) {
+    console.warn("Failed to load ticket providers", error);
+  }
+}
+
 /**
  * Show notification to the user
  */
@@ -1337,6 +1863,13 @@ function showOperationsDialog(initialTab: "export" | "backups" = "export") {
           const j = await r.json();
           meta.textContent = `checksum: ${j.checksum}`;
           preview.value = j.content || '';
+          // What restoring it would change
+          const d = await fetch(`/api/diff?file=${prefix}.json&from=current&to=${encodeURIComponent(fn)}`);
+          if (d.ok) {
+            const diff = await d.json();
+            meta.textContent += ` | restoring adds ${diff.added.length}, removes ${diff.removed.length}, changes ${diff.changed.length} records` +
+              (diff.other.length > 0 ? ` and ${diff.other.length} other values` : '');
+          }
         };
         list.appendChild(a);
       });
@@ -1361,6 +1894,7 @@ function showOperationsDialog(initialTab: "export" | "backups" = "export") {
         headers: {
           'Content-Type': 'application/json',
           'If-Match': etag,
+          'X-Restore': 'true',
         },
         body: content,
       });
@@ -1440,6 +1974,10 @@ function setupEventListeners() {
   
   // Update Jira link when ticket input changes
   jiraTicketInput.addEventListener("input", updateJiraLink);
+  ticketProviderSelect.addEventListener("change", () => {
+    jiraTicketsList.style.display = "none";
+    updateJiraLink();
+  });
   
   // Auto-set end date when end time is earlier than start time
   endDateTimeInput.addEventListener("change", updateEndDateTime);
@@ -1489,6 +2027,7 @@ function setupEventListeners() {
   });
 
   setupActionHandlers();
+  setupAccount();
   console.log("All event listeners set up");
 
   // Keyboard shortcuts
@@ -1862,6 +2401,9 @@ async function initApp() {
   // Load backup settings before loading data
   await loadBackupSettings();
 
+  // Learn which optional subsystems the server has configured
+  await loadFeatures();
+
   // Then load data
   const dataLoaded = await loadData();
   if (!dataLoaded) {
@@ -1890,6 +2432,15 @@ async function initApp() {
   // Add view toggle button
   addViewToggleButton();
 
+  // Undo and redo of saves
+  addUndoButtons();
+
+  // Switching between the workspaces the server hosts
+  addWorkspaceSelect();
+
+  // Follow changes saved by other planners
+  initLiveUpdates();
+
   // Add window resize listener for dynamic cell sizing
   window.addEventListener('resize', () => {
     setTimeout(() => {
@@ -1965,6 +2516,7 @@ function getDOMElements() {
   releaseNameInput = document.getElementById("releaseName") as HTMLInputElement;
   jiraTicketInput = document.getElementById("jiraTicket") as HTMLInputElement;
   jiraLink = document.getElementById("jiraLink") as HTMLAnchorElement;
+  ticketProviderSelect = document.getElementById("ticketProvider") as HTMLSelectElement;
   loadJiraTicketsButton = document.getElementById("loadJiraTickets") as HTMLButtonElement;
   jiraTicketsList = document.getElementById("jiraTicketsList") as HTMLDivElement;
   ticketsContainer = document.getElementById("ticketsContainer") as HTMLDivElement;
@@ -2306,6 +2858,7 @@ function buildCalendar(year, month) {
     nameDiv.dataset.environment = environment.name;
 
     nameDiv.title = `Environment: ${environment.displayName}`;
+    appendDeployedVersions(nameDiv, environment.name);
 
     // Add right-click functionality to show environment statistics
     nameDiv.addEventListener("contextmenu", (e) => {
@@ -2333,7 +2886,7 @@ function buildCalendar(year, month) {
       if (holiday) {
         cell.style.backgroundColor = "#885555";
         cell.style.color = "#000000";
-        cell.setAttribute('data-tooltip', holiday.name);
+        cell.setAttribute('data-tooltip', holidayName(holiday));
         cell.classList.add("holiday");
       } else {
         const environmentReleases = releasesData[environment.name] || [];
@@ -2355,6 +2908,21 @@ function buildCalendar(year, month) {
               tooltipParts.push(`Jira: ${releaseEntry.jiraTicket}`);
             }
           }
+          if (releaseEntry.tickets && releaseEntry.tickets.length > 0) {
+            tooltipParts.push(`Linked tickets: ${releaseEntry.tickets.join(", ")}`);
+          }
+          if (releaseEntry.githubMilestone && milestoneProgress[releaseEntry.githubMilestone] !== undefined) {
+            tooltipParts.push(`Milestone: ${milestoneProgress[releaseEntry.githubMilestone]}% complete`);
+          }
+          if (releaseEntry.changeRequest) {
+            tooltipParts.push(`Change: ${releaseEntry.changeRequest}${releaseEntry.changeApproval ? ` (${releaseEntry.changeApproval})` : ''}`);
+          }
+          if (releaseEntry.outcome) tooltipParts.push(describeOutcome(releaseEntry.outcome));
+          if (releaseEntry.retrospective) tooltipParts.push(describeRetrospective(releaseEntry.retrospective));
+          if (releaseEntry.incidents && releaseEntry.incidents.length > 0) {
+            tooltipParts.push(`Incidents: ${releaseEntry.incidents.map(i => `${i.id} (${i.severity})`).join(', ')}`);
+          }
+          if (releaseEntry.modifiedBy) tooltipParts.push(`Last changed by ${releaseEntry.modifiedBy}`);
           if (releaseEntry.startTime && releaseEntry.endDateTime) {
             const endDate = releaseEntry.endDateTime.split('T')[0];
             const endTime = releaseEntry.endDateTime.split('T')[1];
@@ -2524,6 +3092,7 @@ function buildContinuousCalendar() {
     nameDiv.textContent = environment.displayName;
     nameDiv.dataset.environment = environment.name;
     nameDiv.title = `Environment: ${environment.displayName}`;
+    appendDeployedVersions(nameDiv, environment.name);
 
     // Add right-click functionality
     nameDiv.addEventListener("contextmenu", (e) => {
@@ -2605,7 +3174,7 @@ function loadDayData(environment: string, isoDate: string, cell: HTMLDivElement)
   if (holiday) {
     cell.style.backgroundColor = "#885555";
     cell.style.color = "#000000";
-    cell.setAttribute('data-tooltip', holiday.name);
+    cell.setAttribute('data-tooltip', holidayName(holiday));
     cell.classList.add("holiday");
     return;
   }
@@ -2629,6 +3198,21 @@ function loadDayData(environment: string, isoDate: string, cell: HTMLDivElement)
         tooltipParts.push(`Jira: ${releaseEntry.jiraTicket}`);
       }
     }
+    if (releaseEntry.tickets && releaseEntry.tickets.length > 0) {
+      tooltipParts.push(`Linked tickets: ${releaseEntry.tickets.join(", ")}`);
+    }
+    if (releaseEntry.githubMilestone && milestoneProgress[releaseEntry.githubMilestone] !== undefined) {
+      tooltipParts.push(`Milestone: ${milestoneProgress[releaseEntry.githubMilestone]}% complete`);
+    }
+    if (releaseEntry.changeRequest) {
+      tooltipParts.push(`Change: ${releaseEntry.changeRequest}${releaseEntry.changeApproval ? ` (${releaseEntry.changeApproval})` : ''}`);
+    }
+    if (releaseEntry.outcome) tooltipParts.push(describeOutcome(releaseEntry.outcome));
+    if (releaseEntry.retrospective) tooltipParts.push(describeRetrospective(releaseEntry.retrospective));
+    if (releaseEntry.incidents && releaseEntry.incidents.length > 0) {
+      tooltipParts.push(`Incidents: ${releaseEntry.incidents.map(i => `${i.id} (${i.severity})`).join(', ')}`);
+    }
+    if (releaseEntry.modifiedBy) tooltipParts.push(`Last changed by ${releaseEntry.modifiedBy}`);
     if (releaseEntry.startTime && releaseEntry.endDateTime) {
       const endDate = releaseEntry.endDateTime.split('T')[0];
       const endTime = releaseEntry.endDateTime.split('T')[1];
@@ -3276,6 +3860,141 @@ function closeUserStatsModal() {
   userStatsModal.style.display = 'none';
 }
 
+// The logged in account, see /api/me
+interface AccountInfo {
+  username: string;
+  displayName?: string;
+  admin?: boolean;
+}
+
+let currentAccount: AccountInfo | null = null;
+let setupRequired = false;
+let samlLogin = false;
+let userPreferences: { ui?: Record<string, any>; [key: string]: any } | null = null;
+
+/**
+ * Load who is logged in and show it on the account action
+ */
+async function loadAccount() {
+  try {
+    const res = await fetch('/api/me');
+    if (!res.ok) return;
+    const me = await res.json();
+    currentAccount = me.user;
+    setupRequired = me.setupRequired;
+    samlLogin = me.saml;
+    userPreferences = null;
+    if (currentAccount) {
+      const prefs = await fetch('/api/me/preferences');
+      if (prefs.ok) userPreferences = await prefs.json();
+    }
+    const saved = userPreferences?.ui?.backupConfig;
+    if (saved) {
+      backupConfig.enabled = saved.enabled !== undefined ? saved.enabled : backupConfig.enabled;
+      backupConfig.maxBackups = saved.maxBackups || backupConfig.maxBackups;
+    }
+  } catch (error) {
+    console.error("Error loading account:", error);
+  }
+  const action = document.getElementById('actionAccount');
+  if (action) {
+    action.textContent = currentAccount
+      ? `Sign out (${currentAccount.displayName || currentAccount.username})`
+      : setupRequired ? 'Create admin account' : 'Sign in';
+  }
+}
+
+/**
+ * Show the login modal, or the first admin's setup while there are no accounts
+ */
+function showLoginModal() {
+  const loginModal = document.getElementById('loginModal') as HTMLDivElement;
+  if (!loginModal || loginModal.style.display === 'flex') return;
+  for (const id of ['loginSetupHint', 'loginSetupTokenGroup', 'loginDisplayNameGroup']) {
+    (document.getElementById(id) as HTMLElement).style.display = setupRequired ? '' : 'none';
+  }
+  (document.getElementById('loginTitle') as HTMLElement).textContent = setupRequired ? 'Create admin account' : 'Sign in';
+  (document.getElementById('loginButton') as HTMLElement).textContent = setupRequired ? 'Create' : 'Sign in';
+  (document.getElementById('loginSSOButton') as HTMLElement).style.display = samlLogin ? '' : 'none';
+  (document.getElementById('loginPassword') as HTMLInputElement).value = '';
+  loginModal.style.display = 'flex';
+  (document.getElementById('loginUsername') as HTMLInputElement).focus();
+}
+
+/**
+ * Close the login modal
+ */
+function closeLoginModal() {
+  (document.getElementById('loginModal') as HTMLDivElement).style.display = 'none';
+}
+
+/**
+ * Sign in, or create the first admin, with the login modal's fields
+ */
+async function submitLogin() {
+  const value = (id: string) => (document.getElementById(id) as HTMLInputElement).value;
+  const body: Record<string, string> = { username: value('loginUsername').trim(), password: value('loginPassword') };
+  if (setupRequired) {
+    body.setupToken = value('loginSetupToken').trim();
+    body.displayName = value('loginDisplayName').trim();
+  }
+  const res = await fetch(setupRequired ? '/api/setup' : '/api/login', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    body: JSON.stringify(body)
+  });
+  if (!res.ok) {
+    showNotification(await res.text(), 'error');
+    return;
+  }
+  closeLoginModal();
+  await loadAccount();
+  showNotification(`Signed in as ${currentAccount?.displayName || currentAccount?.username}`, 'success');
+}
+
+/**
+ * Wire the login modal and account action, send the session's CSRF token
+ * with every change, and ask to sign in whenever a change is rejected for
+ * want of a login
+ */
+function setupAccount() {
+  const originalFetch = window.fetch.bind(window);
+  window.fetch = async (input: RequestInfo | URL, init?: RequestInit) => {
+    const method = (init?.method || 'GET').toUpperCase();
+    const csrf = document.cookie.split('; ').find(c => c.startsWith('relplanner_csrf='));
+    if (method !== 'GET' && method !== 'HEAD' && csrf) {
+      // The session's writes must prove they come from this page
+      const headers = new Headers(init?.headers);
+      headers.set('X-CSRF-Token', csrf.substring('relplanner_csrf='.length));
+      init = { ...init, headers };
+    }
+    const res = await originalFetch(input, init);
+    if (res.status === 401 && method !== 'GET' && !String(input).startsWith('/api/login')) {
+      showLoginModal();
+    }
+    return res;
+  };
+
+  document.getElementById('loginButton')?.addEventListener('click', submitLogin);
+  document.getElementById('loginCancelButton')?.addEventListener('click', closeLoginModal);
+  document.getElementById('loginSSOButton')?.addEventListener('click', () => {
+    window.location.href = '/api/saml/login?redirect=' + encodeURIComponent(window.location.pathname + window.location.search);
+  });
+  document.getElementById('loginPassword')?.addEventListener('keydown', (e) => {
+    if ((e as KeyboardEvent).key === 'Enter') submitLogin();
+  });
+  document.getElementById('actionAccount')?.addEventListener('click', async () => {
+    if (!currentAccount) {
+      showLoginModal();
+      return;
+    }
+    await fetch('/api/logout', { method: 'POST' });
+    await loadAccount();
+    showNotification('Signed out', 'info');
+  });
+  loadAccount();
+}
+
 /**
  * Calculate yearly statistics for a user
  */
@@ -3380,6 +4099,21 @@ function setupDragEvents(cell, environment, releaseEntry) {
       tooltipParts.push(`Jira: ${releaseEntry.jiraTicket}`);
     }
   }
+  if (releaseEntry.tickets && releaseEntry.tickets.length > 0) {
+    tooltipParts.push(`Linked tickets: ${releaseEntry.tickets.join(", ")}`);
+  }
+  if (releaseEntry.githubMilestone && milestoneProgress[releaseEntry.githubMilestone] !== undefined) {
+    tooltipParts.push(`Milestone: ${milestoneProgress[releaseEntry.githubMilestone]}% complete`);
+  }
+  if (releaseEntry.changeRequest) {
+    tooltipParts.push(`Change: ${releaseEntry.changeRequest}${releaseEntry.changeApproval ? ` (${releaseEntry.changeApproval})` : ''}`);
+  }
+  if (releaseEntry.outcome) tooltipParts.push(describeOutcome(releaseEntry.outcome));
+  if (releaseEntry.retrospective) tooltipParts.push(describeRetrospective(releaseEntry.retrospective));
+  if (releaseEntry.incidents && releaseEntry.incidents.length > 0) {
+    tooltipParts.push(`Incidents: ${releaseEntry.incidents.map(i => `${i.id} (${i.severity})`).join(', ')}`);
+  }
+  if (releaseEntry.modifiedBy) tooltipParts.push(`Last changed by ${releaseEntry.modifiedBy}`);
   if (releaseEntry.startTime && releaseEntry.endDateTime) {
     const endDate = releaseEntry.endDateTime.split('T')[0];
     const endTime = releaseEntry.endDateTime.split('T')[1];
@@ -3699,7 +4433,7 @@ function openModal(environment, isoDate, cell) {
   const holiday = getHoliday(isoDate);
   if (holiday) {
     holidayInfo.style.display = "block";
-    holidayInfo.textContent = `Holiday: ${holiday.name}`;
+    holidayInfo.textContent = `Holiday: ${holidayName(holiday)}`;
     editableArea.style.display = "none";
     saveButton.style.display = "none";
     removeButton.style.display = "none";
@@ -3736,6 +4470,7 @@ function openModal(environment, isoDate, cell) {
       beTagInput.value = existingEntry.beTag || "";
       releaseNameInput.value = existingEntry.releaseName || "";
       jiraTicketInput.value = existingEntry.jiraTicket || "";
+      ticketProviderSelect.value = existingEntry.ticketProvider || "jira";
       startTimeInput.value = existingEntry.startTime || "20:00";
       endDateTimeInput.value = existingEntry.endDateTime || "";
       dependsOnSelect.value = existingEntry.dependsOn || "";
@@ -3751,6 +4486,7 @@ function openModal(environment, isoDate, cell) {
       beTagInput.value = "";
       releaseNameInput.value = "";
       jiraTicketInput.value = "";
+      ticketProviderSelect.value = "jira";
       startTimeInput.value = "20:00";
       endDateTimeInput.value = "";
       dependsOnSelect.value = "";
@@ -3768,9 +4504,78 @@ function openModal(environment, isoDate, cell) {
   }
   cancelButton.style.display = "inline-block";
   modal.style.display = "flex";
+  if (editableArea.style.display !== "none") {
+    startPresence(`${environment}:${isoDate}`);
+  }
   console.log("Modal opened for environment:", environment, "date:", isoDate);
 }
 
+// Release being edited, announced to others with heartbeats
+let presenceRecord: string | null = null;
+let presenceTimer: number | null = null;
+
+/**
+ * Send a presence heartbeat and warn of others editing the same release
+ */
+async function beatPresence() {
+  if (!presenceRecord) return;
+  const info = document.getElementById("presenceInfo") as HTMLDivElement | null;
+  try {
+    const response = await fetch("/api/presence", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ file: "releases.json", record: presenceRecord })
+    });
+    if (!response.ok) {
+      // Not signed in, or not allowed to edit: nothing to share
+      stopPresence();
+      return;
+    }
+    const others: { user: string }[] = await response.json();
+    if (!info) return;
+    const users = [...new Set(others.map(p => p.user))];
+    if (users.length > 0) {
+      info.textContent = `${users.join(", ")} ${users.length === 1 ? "is" : "are"} editing this release right now`;
+      info.style.display = "block";
+    } else {
+      info.style.display = "none";
+    }
+  } catch (error) {
+    console.error("Error sending presence heartbeat:", error);
+  }
+}
+
+/**
+ * Announce editing a release until stopPresence
+ */
+function startPresence(record: string) {
+  stopPresence();
+  presenceRecord = record;
+  beatPresence();
+  presenceTimer = window.setInterval(beatPresence, 20000);
+}
+
+/**
+ * Stop announcing the release being edited
+ */
+function stopPresence() {
+  if (presenceTimer !== null) {
+    clearInterval(presenceTimer);
+    presenceTimer = null;
+  }
+  const info = document.getElementById("presenceInfo");
+  if (info) info.style.display = "none";
+  if (!presenceRecord) return;
+  const record = presenceRecord;
+  presenceRecord = null;
+  fetch("/api/presence", {
+    method: "DELETE",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ file: "releases.json", record }),
+    keepalive: true
+  }).catch(() => {});
+}
+
 // No paired employees for environments
 
 // Check if a date has a release for a specific environment
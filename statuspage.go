@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// StatusPageConfig is statuspage-config.json, kept on disk only since it
+// holds an API key. Approved releases of the listed environments get a
+// scheduled maintenance on the public status page, which is resolved when
+// the release is marked done.
+type StatusPageConfig struct {
+	Provider     string              `json:"provider"` // "statuspage" (default) or "instatus"
+	APIKey       string              `json:"apiKey"`
+	APIURL       string              `json:"apiUrl,omitempty"`
+	PageID       string              `json:"pageId"`
+	Environments []string            `json:"environments,omitempty"` // default production
+	Statuses     []string            `json:"statuses,omitempty"`
+	Components   map[string][]string `json:"components,omitempty"` // environment -> component IDs
+	Message      string              `json:"message,omitempty"`    // maintenance body
+}
+
+// statusPageMaintenance is what the server last scheduled for a release
+type statusPageMaintenance struct {
+	Provider  string `json:"provider"`
+	ID        string `json:"id"`
+	Start     string `json:"start"`
+	End       string `json:"end"`
+	Completed bool   `json:"completed,omitempty"`
+}
+
+// statusPageState is statuspage-maintenances.json, keyed by release ID
+type statusPageState struct {
+	Maintenances map[string]statusPageMaintenance `json:"maintenances"`
+}
+
+// statusPageMu serializes syncs so maintenances are never created twice
+var statusPageMu sync.Mutex
+
+// loadStatusPageConfig reads statuspage-config.json; ok is false when the
+// sync isn't configured
+func loadStatusPageConfig() (cfg StatusPageConfig, ok bool, err error) {
+	if err := readDataFile("statuspage-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.Provider == "" {
+		cfg.Provider = "statuspage"
+	}
+	if len(cfg.Environments) == 0 {
+		cfg.Environments = []string{"production"}
+	}
+	if len(cfg.Statuses) == 0 {
+		cfg.Statuses = defaultMaintenanceStatuses
+	}
+	if cfg.Message == "" {
+		cfg.Message = "We are deploying a new release. Some services may be briefly unavailable."
+	}
+	return cfg, cfg.APIKey != "" && cfg.PageID != "", nil
+}
+
+// loadStatusPageState reads statuspage-maintenances.json
+func loadStatusPageState() (statusPageState, error) {
+	var state statusPageState
+	err := readDataFile("statuspage-maintenances.json", &state)
+	if state.Maintenances == nil {
+		state.Maintenances = map[string]statusPageMaintenance{}
+	}
+	return state, err
+}
+
+// save writes statuspage-maintenances.json, server-maintained like
+// maintenance-windows.json
+func (s statusPageState) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, "statuspage-maintenances.json"), data, 0644)
+}
+
+// scheduledMaintenance is a maintenance to create or update
+type scheduledMaintenance struct {
+	Name       string
+	Message    string
+	Start, End time.Time
+	Components []string
+}
+
+// statusPageProvider schedules, completes and removes maintenances
+type statusPageProvider interface {
+	schedule(id string, m scheduledMaintenance) (string, error) // creates when id is empty
+	complete(id string) error
+	remove(id string) error
+}
+
+// newStatusPageProvider returns the client for the configured provider
+func newStatusPageProvider(cfg StatusPageConfig) (statusPageProvider, error) {
+	switch cfg.Provider {
+	case "statuspage":
+		url := cfg.APIURL
+		if url == "" {
+			url = "https://api.statuspage.io/v1"
+		}
+		return &statuspageClient{baseURL: url + "/pages/" + cfg.PageID, apiKey: cfg.APIKey}, nil
+	case "instatus":
+		url := cfg.APIURL
+		if url == "" {
+			url = "https://api.instatus.com/v1"
+		}
+		return &instatusClient{baseURL: url + "/" + cfg.PageID, apiKey: cfg.APIKey}, nil
+	}
+	return nil, fmt.Errorf("unknown status page provider %q", cfg.Provider)
+}
+
+// statuspageClient uses the Atlassian Statuspage incidents API
+type statuspageClient struct {
+	baseURL string
+	apiKey  string
+}
+
+func (c *statuspageClient) do(method, path string, body, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "OAuth "+c.apiKey)
+	return doJSON(req, body, out)
+}
+
+func (c *statuspageClient) schedule(id string, m scheduledMaintenance) (string, error) {
+	incident := map[string]interface{}{
+		"name":                       m.Name,
+		"body":                       m.Message,
+		"scheduled_for":              m.Start.UTC().Format(time.RFC3339),
+		"scheduled_until":            m.End.UTC().Format(time.RFC3339),
+		"scheduled_auto_in_progress": true,
+	}
+	if len(m.Components) > 0 {
+		incident["component_ids"] = m.Components
+	}
+	method, path := http.MethodPatch, "/incidents/"+id
+	if id == "" {
+		incident["status"] = "scheduled"
+		method, path = http.MethodPost, "/incidents"
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(method, path, map[string]interface{}{"incident": incident}, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *statuspageClient) complete(id string) error {
+	return c.do(http.MethodPatch, "/incidents/"+id, map[string]interface{}{"incident": map[string]string{"status": "completed"}}, nil)
+}
+
+func (c *statuspageClient) remove(id string) error {
+	return c.do(http.MethodDelete, "/incidents/"+id, nil, nil)
+}
+
+// instatusClient uses the Instatus maintenances API
+type instatusClient struct {
+	baseURL string
+	apiKey  string
+}
+
+func (c *instatusClient) do(method, path string, body, out interface{}) error {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	return doJSON(req, body, out)
+}
+
+func (c *instatusClient) schedule(id string, m scheduledMaintenance) (string, error) {
+	statuses := make([]map[string]string, len(m.Components))
+	for i, component := range m.Components {
+		statuses[i] = map[string]string{"id": component, "status": "UNDERMAINTENANCE"}
+	}
+	body := map[string]interface{}{
+		"name":       m.Name,
+		"message":    m.Message,
+		"start":      m.Start.UTC().Format(time.RFC3339),
+		"duration":   strconv.Itoa(int(m.End.Sub(m.Start).Minutes())),
+		"autoStart":  true,
+		"autoEnd":    false,
+		"components": m.Components,
+		"statuses":   statuses,
+		"notify":     true,
+	}
+	method, path := http.MethodPut, "/maintenances/"+id
+	if id == "" {
+		method, path = http.MethodPost, "/maintenances"
+	}
+	var resp struct {
+		ID string `json:"id"`
+	}
+	if err := c.do(method, path, body, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (c *instatusClient) complete(id string) error {
+	body := map[string]interface{}{"message": "The release is complete.", "status": "COMPLETED", "notify": true}
+	return c.do(http.MethodPost, "/maintenances/"+id+"/maintenance-updates", body, nil)
+}
+
+func (c *instatusClient) remove(id string) error {
+	return c.do(http.MethodDelete, "/maintenances/"+id, nil, nil)
+}
+
+// syncStatusPage schedules maintenances for approved releases, moves them
+// with their release, completes them when the release is done and removes
+// those of cancelled or deleted releases
+func syncStatusPage() error {
+	statusPageMu.Lock()
+	defer statusPageMu.Unlock()
+
+	cfg, ok, err := loadStatusPageConfig()
+	if err != nil || !ok {
+		return err
+	}
+	provider, err := newStatusPageProvider(cfg)
+	if err != nil {
+		return err
+	}
+	releases, err := loadReleases()
+	if err != nil {
+		return err
+	}
+	state, err := loadStatusPageState()
+	if err != nil {
+		return err
+	}
+
+	statuses := map[string]bool{}
+	for _, s := range cfg.Statuses {
+		statuses[s] = true
+	}
+	covered := map[string]bool{}
+	for _, env := range cfg.Environments {
+		covered[env] = true
+	}
+	now := time.Now()
+
+	// The maintenances the plan needs, and the releases that are done
+	wanted := map[string]scheduledMaintenance{}
+	done := map[string]bool{}
+	for env, entries := range releases {
+		if !covered[env] {
+			continue
+		}
+		for _, e := range entries {
+			id := releaseID(env, e.Date)
+			if completedStatuses[e.Status] {
+				done[id] = true
+				continue
+			}
+			if !statuses[e.Status] {
+				continue
+			}
+			start, end, err := e.window()
+			if err != nil || !end.After(now) {
+				continue
+			}
+			name := "Release " + e.ReleaseName
+			if e.ReleaseName == "" {
+				name = "Scheduled release"
+			}
+			wanted[id] = scheduledMaintenance{Name: name, Message: cfg.Message, Start: start, End: end, Components: cfg.Components[env]}
+		}
+	}
+
+	var errs []error
+	ids := make([]string, 0, len(state.Maintenances))
+	for id := range state.Maintenances {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		existing := state.Maintenances[id]
+		if _, keep := wanted[id]; keep && existing.Provider == cfg.Provider && !existing.Completed {
+			continue
+		}
+		if done[id] {
+			if !existing.Completed && existing.Provider == cfg.Provider {
+				if err := provider.complete(existing.ID); err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", id, err))
+					continue
+				}
+				existing.Completed = true
+				state.Maintenances[id] = existing
+				logStatusPage.Info("Completed status page maintenance", "maintenance", existing.ID, "release", id)
+			}
+			continue
+		}
+		// Cancelled, deleted or moved: a moved release gets a new one below
+		if !existing.Completed && existing.Provider == cfg.Provider {
+			if err := provider.remove(existing.ID); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", id, err))
+				continue
+			}
+			logStatusPage.Info("Removed status page maintenance", "maintenance", existing.ID, "release", id)
+		}
+		delete(state.Maintenances, id)
+	}
+
+	wantedIDs := make([]string, 0, len(wanted))
+	for id := range wanted {
+		wantedIDs = append(wantedIDs, id)
+	}
+	sort.Strings(wantedIDs)
+	for _, id := range wantedIDs {
+		m := wanted[id]
+		start, end := m.Start.Format(time.RFC3339), m.End.Format(time.RFC3339)
+		existing, exists := state.Maintenances[id]
+		if exists && existing.Start == start && existing.End == end {
+			continue
+		}
+		maintenanceID, err := provider.schedule(existing.ID, m)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", id, err))
+			continue
+		}
+		if existing.ID != "" {
+			maintenanceID = existing.ID
+		}
+		state.Maintenances[id] = statusPageMaintenance{Provider: cfg.Provider, ID: maintenanceID, Start: start, End: end}
+		if exists {
+			logStatusPage.Info("Updated status page maintenance", "maintenance", maintenanceID, "release", id)
+		} else {
+			logStatusPage.Info("Scheduled status page maintenance", "maintenance", maintenanceID, "release", id)
+		}
+	}
+
+	if err := state.save(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("status page sync: %d failed, first: %w", len(errs), errs[0])
+	}
+	return nil
+}
+
+// syncStatusPageOnChange is the data change hook that keeps the status page
+// in step with releases.json, in the background
+func syncStatusPageOnChange(filename string) {
+	if filename != "releases.json" {
+		return
+	}
+	go func() {
+		if err := syncStatusPage(); err != nil {
+			logStatusPage.Error("Status page sync failed", "err", err)
+		}
+	}()
+}
+
+// Handle status page maintenances: GET lists those scheduled for releases,
+// POST runs a sync now
+func handleStatusPageMaintenances(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if err := syncStatusPage(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, err := loadStatusPageState()
+	if err != nil {
+		http.Error(w, "Error reading status page maintenances", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
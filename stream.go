@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fileETag is computeETag of a file's content, read in pieces
+func fileETag(f io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("\"%x\"", h.Sum(nil)[:8]), nil
+}
+
+// jsonStringWriter writes what it is given as the inside of a JSON string,
+// escaping quotes, backslashes and control characters, so a file can be
+// streamed into a JSON response. Multi-byte characters pass through as they
+// are, whichever writes they are split across.
+type jsonStringWriter struct {
+	w io.Writer
+}
+
+func (j jsonStringWriter) Write(p []byte) (int, error) {
+	const hex = "0123456789abcdef"
+	out := make([]byte, 0, len(p)+16)
+	for _, c := range p {
+		switch {
+		case c == '"' || c == '\\':
+			out = append(out, '\\', c)
+		case c == '\n':
+			out = append(out, '\\', 'n')
+		case c == '\r':
+			out = append(out, '\\', 'r')
+		case c == '\t':
+			out = append(out, '\\', 't')
+		case c < 0x20:
+			out = append(out, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+		default:
+			out = append(out, c)
+		}
+	}
+	if _, err := j.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// openForStreaming opens a file to stream, with its size
+func openForStreaming(path string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Person is a member of the team roster. ID is what releases and absences refer to.
+type Person struct {
+	ID          string `json:"id"`
+	DisplayName string `json:"displayName"`
+	Email       string `json:"email,omitempty"`
+	Team        string `json:"team,omitempty"`
+}
+
+// Team groups people, e.g. the prod operations team
+type Team struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// OnCallShift is a person being on call, inclusive dates
+type OnCallShift struct {
+	Person string `json:"person"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// TeamData is team.json
+type TeamData struct {
+	People []Person      `json:"people"`
+	Teams  []Team        `json:"teams,omitempty"`
+	OnCall []OnCallShift `json:"onCall,omitempty"`
+}
+
+// loadTeam reads team.json
+func loadTeam() (TeamData, error) {
+	var team TeamData
+	err := readDataFile("team.json", &team)
+	return team, err
+}
+
+// person returns the roster entry with the given ID
+func (d TeamData) person(id string) (Person, bool) {
+	for _, p := range d.People {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return Person{}, false
+}
+
+// members returns the IDs of everyone in a team
+func (d TeamData) members(team string) []string {
+	var ids []string
+	for _, p := range d.People {
+		if p.Team == team {
+			ids = append(ids, p.ID)
+		}
+	}
+	return ids
+}
+
+// onCallOn returns the on-call shift of a person covering a date
+func (d TeamData) onCallOn(person, date string) (OnCallShift, bool) {
+	for _, s := range d.OnCall {
+		if s.Person == person && s.From <= date && date <= s.To {
+			return s, true
+		}
+	}
+	return OnCallShift{}, false
+}
+
+// validateTeam checks team.json: unique IDs, known teams and on-call shifts of rostered people
+func validateTeam(data interface{}) error {
+	m, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("team.json must be an object")
+	}
+	if _, ok := m["people"]; !ok {
+		return fmt.Errorf("missing people array")
+	}
+	var team TeamData
+	if err := decodeInto(data, &team); err != nil {
+		return fmt.Errorf("team.json has malformed people or teams")
+	}
+
+	teams := map[string]bool{}
+	for _, t := range team.Teams {
+		if t.Name == "" || teams[t.Name] {
+			return fmt.Errorf("team names must be unique and non-empty")
+		}
+		teams[t.Name] = true
+	}
+	ids := map[string]bool{}
+	for _, p := range team.People {
+		if p.ID == "" {
+			return fmt.Errorf("person %q: missing id", p.DisplayName)
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate person id %q", p.ID)
+		}
+		ids[p.ID] = true
+		if p.Team != "" && !teams[p.Team] {
+			return fmt.Errorf("person %s: unknown team %q", p.ID, p.Team)
+		}
+	}
+	for i, shift := range team.OnCall {
+		if !ids[shift.Person] {
+			return fmt.Errorf("on-call shift %d: %q is not on the team roster", i, shift.Person)
+		}
+		from, err1 := time.Parse(dateLayout, shift.From)
+		to, err2 := time.Parse(dateLayout, shift.To)
+		if err1 != nil || err2 != nil || to.Before(from) {
+			return fmt.Errorf("on-call shift %d: needs valid from/to dates (YYYY-MM-DD)", i)
+		}
+	}
+	return nil
+}
+
+// reassigned returns the releases of next that are new, moved or have
+// different assignees than in current
+func reassigned(current, next ReleasesData) map[string]ReleaseEntry {
+	previous := map[string]ReleaseEntry{}
+	for env, entries := range current {
+		for _, e := range entries {
+			previous[releaseID(env, e.Date)] = e
+		}
+	}
+	result := map[string]ReleaseEntry{}
+	for env, entries := range next {
+		for _, e := range entries {
+			id := releaseID(env, e.Date)
+			if old, ok := previous[id]; ok && reflect.DeepEqual(old.assignees(), e.assignees()) {
+				continue
+			}
+			result[id] = e
+		}
+	}
+	return result
+}
+
+// checkAssignments validates the people assigned to new or re-assigned
+// releases: they must be on the roster and not assigned to another release
+// whose window overlaps. Availability only produces warnings, see
+// availabilityWarnings.
+func checkAssignments(current, next ReleasesData) error {
+	team, err := loadTeam()
+	if err != nil {
+		return err
+	}
+
+	changed := reassigned(current, next)
+	ids := make([]string, 0, len(changed))
+	for id := range changed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		e := changed[id]
+		env, _, _ := parseReleaseID(id)
+		for _, person := range e.assignees() {
+			if _, ok := team.person(person); !ok {
+				return fmt.Errorf("%s: %s is not on the team roster", id, person)
+			}
+			if other := overlappingAssignment(next, env, e, person); other != "" {
+				return fmt.Errorf("%s: %s is already assigned to %s in the same window", id, person, other)
+			}
+		}
+	}
+	return nil
+}
+
+// availabilityWarning flags an assignee who may not be available for a release
+type availabilityWarning struct {
+	Release string `json:"release"`
+	Person  string `json:"person"`
+	Role    string `json:"role"`   // releaseManager or deployer
+	Reason  string `json:"reason"` // absence or onCall
+	Message string `json:"message"`
+}
+
+// availabilityWarnings cross-checks the assignees of new or re-assigned
+// releases against absences and on-call shifts. The release is still saved.
+func availabilityWarnings(current, next ReleasesData) ([]availabilityWarning, error) {
+	team, err := loadTeam()
+	if err != nil {
+		return nil, err
+	}
+	absences, err := loadAbsences()
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := []availabilityWarning{}
+	for id, e := range reassigned(current, next) {
+		roles := map[string]string{}
+		for _, d := range e.Deployers {
+			roles[d] = "deployer"
+		}
+		if e.ReleaseManager != "" {
+			roles[e.ReleaseManager] = "releaseManager"
+		}
+		for person, role := range roles {
+			label := "deployer " + person
+			if role == "releaseManager" {
+				label = "release manager " + person
+			}
+			if off := absences.absencesOn(person, e.Date); len(off) > 0 {
+				kind := off[0].Type
+				if kind == "" {
+					kind = "absent"
+				} else {
+					kind = "on " + kind
+				}
+				warnings = append(warnings, availabilityWarning{
+					Release: id, Person: person, Role: role, Reason: "absence",
+					Message: fmt.Sprintf("%s is %s that day (%s to %s)", label, kind, off[0].From, off[0].To),
+				})
+			}
+			if shift, ok := team.onCallOn(person, e.Date); ok {
+				warnings = append(warnings, availabilityWarning{
+					Release: id, Person: person, Role: role, Reason: "onCall",
+					Message: fmt.Sprintf("%s is on call that day (%s to %s)", label, shift.From, shift.To),
+				})
+			}
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Release != warnings[j].Release {
+			return warnings[i].Release < warnings[j].Release
+		}
+		return warnings[i].Person < warnings[j].Person
+	})
+	return warnings, nil
+}
+
+// overlappingAssignment returns the ID of another release the person is
+// assigned to whose window overlaps the given release
+func overlappingAssignment(releases ReleasesData, env string, e ReleaseEntry, person string) string {
+	start, end, err := e.window()
+	if err != nil {
+		return ""
+	}
+	for otherEnv, entries := range releases {
+		for _, other := range entries {
+			if otherEnv == env && other.Date == e.Date {
+				continue
+			}
+			assigned := false
+			for _, p := range other.assignees() {
+				if p == person {
+					assigned = true
+					break
+				}
+			}
+			if !assigned {
+				continue
+			}
+			s, en, err := other.window()
+			if err == nil && s.Before(end) && start.Before(en) {
+				return releaseID(otherEnv, other.Date)
+			}
+		}
+	}
+	return ""
+}
+
+// Handle team.json
+func handleTeam(w http.ResponseWriter, r *http.Request) {
+	filePath := filepath.Join(dataDir, "team.json")
+
+	switch r.Method {
+	case http.MethodGet:
+		serveJSONFile(w, filePath)
+	case http.MethodPost:
+		updateJSONFileWithBackup(w, r, filePath, maxBackupsFromRequest(r))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// assignmentRequest is the body of PUT /api/releases/{id}/assignments
+type assignmentRequest struct {
+	ReleaseManager string   `json:"releaseManager"`
+	Deployers      []string `json:"deployers"`
+}
+
+// Handle release assignments: GET shows them, PUT replaces them and
+// reports availability warnings
+func handleReleaseAssignments(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		resp := assignmentRequest{Deployers: []string{}}
+		resp.ReleaseManager, _ = entry["releaseManager"].(string)
+		var deployers []string
+		decodeInto(entry["deployers"], &deployers)
+		if deployers != nil {
+			resp.Deployers = deployers
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+		return
+
+	case http.MethodPut:
+		if err := authorizeEnvironments(r, env); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		var req assignmentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		req.ReleaseManager = strings.TrimSpace(req.ReleaseManager)
+		if req.ReleaseManager == "" {
+			delete(entry, "releaseManager")
+		} else {
+			entry["releaseManager"] = req.ReleaseManager
+		}
+		if len(req.Deployers) == 0 {
+			delete(entry, "deployers")
+		} else {
+			deployers := make([]interface{}, len(req.Deployers))
+			for i, d := range req.Deployers {
+				deployers[i] = d
+			}
+			entry["deployers"] = deployers
+		}
+
+		filePath := filepath.Join(dataDir, "releases.json")
+		warnings := warningsByPath(filePath, doc)
+		newETag, err := writeJSONFile(r.Context(), filePath, doc, etag, maxBackupsFromRequest(r), requestUser(r))
+		if err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		w.Header().Set("ETag", newETag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"release":  entry,
+			"warnings": warnings,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TeamsConfig is teams-config.json, kept on disk only since webhook URLs
+// are credentials. Release events are posted as Adaptive Cards to the
+// channels routed for their environment.
+type TeamsConfig struct {
+	webhookRouting
+	Templates map[string]string `json:"templates,omitempty"` // event type -> card title, text/template over releaseEvent
+	BaseURL   string            `json:"baseUrl,omitempty"`   // planner URL, linked from every card
+}
+
+// defaultTeamsTemplates title the cards of events without a configured template
+var defaultTeamsTemplates = map[string]string{
+	eventCreated:   `{{.Name}} scheduled on {{.EnvironmentName}}`,
+	eventMoved:     `{{.Name}} on {{.EnvironmentName}} moved to {{.Date}}`,
+	eventApproved:  `{{.Name}} on {{.EnvironmentName}} is {{.Status}}`,
+	eventCancelled: `{{.Name}} on {{.EnvironmentName}} was cancelled`,
+	eventReminder:  `{{.Name}} on {{.EnvironmentName}} in {{.Reminder}}{{if .Unapproved}}, not approved yet{{end}}`,
+}
+
+// teamsEventColors are the Adaptive Card colors of the title per event
+var teamsEventColors = map[string]string{
+	eventCreated:   "Accent",
+	eventMoved:     "Warning",
+	eventApproved:  "Good",
+	eventCancelled: "Attention",
+	eventReminder:  "Accent",
+}
+
+// loadTeamsConfig reads teams-config.json; ok is false when Teams isn't configured
+func loadTeamsConfig() (cfg TeamsConfig, ok bool, err error) {
+	if err := readDataFile("teams-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	return cfg, len(cfg.Webhooks) > 0, nil
+}
+
+// teamsCard builds the incoming webhook message for an event: a title and
+// the release's facts, with a link to the planner
+func teamsCard(title string, event releaseEvent, baseURL string) map[string]interface{} {
+	facts := []map[string]string{
+		{"title": "Environment", "value": event.EnvironmentName},
+		{"title": "Date", "value": event.Date},
+	}
+	if event.PreviousDate != "" {
+		facts = append(facts, map[string]string{"title": "Previously", "value": event.PreviousDate})
+	}
+	if event.Window != "" {
+		facts = append(facts, map[string]string{"title": "Window", "value": event.Window})
+	}
+	status := event.Status
+	if event.PreviousStatus != "" && event.PreviousStatus != event.Status {
+		status = event.PreviousStatus + " → " + event.Status
+	}
+	facts = append(facts, map[string]string{"title": "Status", "value": status})
+	if len(event.OpenItems) > 0 {
+		facts = append(facts, map[string]string{"title": "Open checklist", "value": strings.Join(event.OpenItems, ", ")})
+	}
+	if event.Release.FeTag != "" {
+		facts = append(facts, map[string]string{"title": "Frontend", "value": event.Release.FeTag})
+	}
+	if event.Release.BeTag != "" {
+		facts = append(facts, map[string]string{"title": "Backend", "value": event.Release.BeTag})
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]interface{}{
+			{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true, "color": teamsEventColors[event.Type]},
+			{"type": "FactSet", "facts": facts},
+		},
+	}
+	if baseURL != "" {
+		card["actions"] = []map[string]string{{"type": "Action.OpenUrl", "title": "Open release planner", "url": baseURL}}
+	}
+	return map[string]interface{}{
+		"type": "message",
+		"attachments": []map[string]interface{}{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
+
+func init() {
+	registerNotificationChannel("teams", notificationChannel{defaults: teamsChannels, send: sendTeams})
+}
+
+// teamsChannels returns the channels teams-config.json routes an event to
+func teamsChannels(event releaseEvent) ([]string, error) {
+	cfg, ok, err := loadTeamsConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok || !cfg.wants(event) {
+		return nil, nil
+	}
+	return cfg.channels(event, "Teams"), nil
+}
+
+// sendTeams posts an event to Microsoft Teams channels
+func sendTeams(event releaseEvent, channels []string) error {
+	cfg, ok, err := loadTeamsConfig()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok {
+		return errNotConfigured
+	}
+	title, err := renderEventTemplate(cfg.Templates, defaultTeamsTemplates, event, cfg.BaseURL)
+	if err != nil || title == "" {
+		return err
+	}
+	message := teamsCard(title, event, cfg.BaseURL)
+	var errs []error
+	for _, channel := range channels {
+		webhook, ok := cfg.Webhooks[channel]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown channel %q", channel))
+			continue
+		}
+		req, err := http.NewRequest(http.MethodPost, webhook, nil)
+		if err == nil {
+			err = doJSON(req, message, nil)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", channel, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// jiraKeyPattern matches an issue key such as REL-123
+var jiraKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+// enrichTickets looks the keys up in the Jira ticket cache; keys Jira
+// doesn't return (or all of them while Jira is down) are listed bare
+func enrichTickets(keys []string) []map[string]interface{} {
+	if len(keys) == 0 {
+		return []map[string]interface{}{}
+	}
+	result, _ := cachedJiraTickets(false)
+	return lookupTickets(keys, result, "")
+}
+
+// releaseTickets returns the tickets of a release from its ticket provider
+func releaseTickets(release ReleaseEntry) []map[string]interface{} {
+	info, ok := ticketProviderFor(release.TicketProvider)
+	if !ok {
+		return lookupTickets(release.linkedTickets(), jiraTicketsResult{}, release.TicketProvider)
+	}
+	return info.provider.Get(release)
+}
+
+// jiraReleaseTickets returns the tickets of a release using Jira: the linked
+// ones and, once it has a Jira fixVersion, every issue assigned to that version
+func jiraReleaseTickets(release ReleaseEntry) []map[string]interface{} {
+	tickets := enrichTickets(release.linkedTickets())
+	if release.JiraVersion == "" {
+		return tickets
+	}
+	config, err := loadJiraConfig()
+	if err != nil {
+		return tickets
+	}
+	result, err := cachedJiraSearch(config, fmt.Sprintf("fixVersion = %s", release.JiraVersion), false)
+	if err != nil {
+		logJira.Error("Fetching fixVersion issues failed", "version", release.JiraVersion, "err", err)
+		return tickets
+	}
+	return appendNewTickets(tickets, result.tickets)
+}
+
+// jiraProvider serves releases without a ticketProvider or with "jira"
+type jiraProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "jira", Name: "Jira", ConfigFile: "jira-config.json",
+		KeyFormat: "PROJECT-number", KeyExample: "REL-46"}, jiraProvider{})
+}
+
+// Search merges the default searches of the profiles in ?profile=, narrowed
+// to ?sprint= when given
+func (jiraProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	profiles, err := jiraProfilesParam(query.Get("profile"))
+	if err != nil {
+		return jiraTicketsResult{}, err
+	}
+	result, failed, err := cachedProfileTickets(profiles, query.Get("sprint"), refresh)
+	result.warnings = failed
+	return result, err
+}
+
+func (jiraProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	return jiraReleaseTickets(release)
+}
+
+func (jiraProvider) Link(key string) (string, bool) {
+	key = strings.ToUpper(key)
+	return key, jiraKeyPattern.MatchString(key)
+}
+
+// ticketLinkRequest is the body of POST /api/releases/{id}/tickets
+type ticketLinkRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// Handle the tickets of a release: GET lists them with their details from
+// the release's ticket provider, POST links more tickets
+func handleReleaseTickets(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var release ReleaseEntry
+		decodeInto(entry, &release)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(releaseTickets(release))
+
+	case http.MethodPost:
+		if err := authorizeEnvironments(r, env); err != nil {
+			writeSaveError(w, err)
+			return
+		}
+		var req ticketLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Keys) == 0 {
+			http.Error(w, "Invalid request body, expected {\"keys\": [...]}", http.StatusBadRequest)
+			return
+		}
+
+		linked, _ := entry["tickets"].([]interface{})
+		existing := map[string]bool{}
+		for _, k := range linked {
+			if s, ok := k.(string); ok {
+				existing[s] = true
+			}
+		}
+		provider, _ := entry["ticketProvider"].(string)
+		info, ok := ticketProviderFor(provider)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown ticket provider %q", provider), http.StatusBadRequest)
+			return
+		}
+		for _, key := range req.Keys {
+			key, ok := info.provider.Link(strings.TrimSpace(key))
+			if !ok {
+				http.Error(w, fmt.Sprintf("Invalid %s key %q, expected %s", info.Name, key, info.KeyFormat), http.StatusBadRequest)
+				return
+			}
+			if !existing[key] {
+				existing[key] = true
+				linked = append(linked, key)
+			}
+		}
+		entry["tickets"] = linked
+		writeReleaseTickets(w, r, doc, etag, entry)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle unlinking a single ticket from a release
+func handleReleaseTicket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.PathValue("id")
+	env, _, ok := parseReleaseID(id)
+	if !ok {
+		http.Error(w, "Invalid release id, expected environment:date", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeEnvironments(r, env); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+
+	doc, etag, err := loadReleasesDocument()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading releases: %v", err), http.StatusInternalServerError)
+		return
+	}
+	entry, ok := findReleaseEntry(doc, id)
+	if !ok {
+		http.Error(w, "Release not found", http.StatusNotFound)
+		return
+	}
+
+	key := r.PathValue("key")
+	linked, _ := entry["tickets"].([]interface{})
+	kept := []interface{}{}
+	for _, k := range linked {
+		if k != key {
+			kept = append(kept, k)
+		}
+	}
+	if len(kept) == len(linked) {
+		http.Error(w, "Ticket is not linked to this release", http.StatusNotFound)
+		return
+	}
+	if len(kept) == 0 {
+		delete(entry, "tickets")
+	} else {
+		entry["tickets"] = kept
+	}
+	writeReleaseTickets(w, r, doc, etag, entry)
+}
+
+// writeReleaseTickets saves the releases document and responds with the
+// release's tickets
+func writeReleaseTickets(w http.ResponseWriter, r *http.Request, doc map[string]interface{}, etag string, entry map[string]interface{}) {
+	newETag, err := writeJSONFile(r.Context(), filepath.Join(dataDir, "releases.json"), doc, etag, maxBackupsFromRequest(r), requestUser(r))
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	var release ReleaseEntry
+	decodeInto(entry, &release)
+	w.Header().Set("ETag", newETag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(releaseTickets(release))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// timelineBar is a single bar on a timeline row
+type timelineBar struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	Label      string       `json:"label"`
+	Start      time.Time    `json:"start"`
+	End        time.Time    `json:"end"`
+	Lane       int          `json:"lane"`
+	Status     string       `json:"status,omitempty"`
+	Color      *ColorConfig `json:"color,omitempty"`
+	DependsOn  string       `json:"dependsOn,omitempty"`
+	JiraTicket string       `json:"jiraTicket,omitempty"`
+}
+
+// timelineRow groups the bars of one environment; Lanes is the number of
+// stacked lanes needed so that no two bars in a lane overlap
+type timelineRow struct {
+	Environment string           `json:"environment"`
+	DisplayName string           `json:"displayName"`
+	Lanes       int              `json:"lanes"`
+	Bars        []timelineBar    `json:"bars"`
+	Freezes     []timelineBar    `json:"freezes"`
+	Lock        *EnvironmentLock `json:"lock,omitempty"`
+}
+
+// timelineData is the response of GET /api/timeline
+type timelineData struct {
+	From     string        `json:"from"`
+	To       string        `json:"to"`
+	Rows     []timelineRow `json:"rows"`
+	Holidays []timelineBar `json:"holidays"`
+	Sprints  []timelineBar `json:"sprints"`
+}
+
+// assignLanes sorts bars by start and places each one on the first lane
+// whose previous bar has already ended. It returns the number of lanes used.
+func assignLanes(bars []timelineBar) int {
+	sort.Slice(bars, func(i, j int) bool {
+		if bars[i].Start.Equal(bars[j].Start) {
+			return bars[i].End.Before(bars[j].End)
+		}
+		return bars[i].Start.Before(bars[j].Start)
+	})
+
+	var laneEnds []time.Time
+	for i := range bars {
+		placed := false
+		for lane, end := range laneEnds {
+			if !bars[i].Start.Before(end) {
+				bars[i].Lane = lane
+				laneEnds[lane] = bars[i].End
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			bars[i].Lane = len(laneEnds)
+			laneEnds = append(laneEnds, bars[i].End)
+		}
+	}
+	return len(laneEnds)
+}
+
+// rowEnvironments returns the environments of timeline rows: the configured
+// order, then any environment that only exists in releases.json. A non-empty
+// group limits them to that group's environments.
+func rowEnvironments(envs EnvironmentsData, releases ReleasesData, group string) ([]Environment, error) {
+	order := []Environment{}
+	known := map[string]bool{}
+	for _, env := range envs.Environments {
+		order = append(order, env)
+		known[env.Name] = true
+	}
+	for _, name := range releases.sortedEnvironmentNames() {
+		if !known[name] {
+			order = append(order, Environment{Name: name, DisplayName: name, Visible: true})
+		}
+	}
+
+	if group == "" {
+		return order, nil
+	}
+	if _, ok := envs.group(group); !ok {
+		return nil, fmt.Errorf("unknown group %q", group)
+	}
+	members := map[string]bool{}
+	for _, name := range envs.groupEnvironments(group) {
+		members[name] = true
+	}
+	filtered := []Environment{}
+	for _, env := range order {
+		if members[env.Name] {
+			filtered = append(filtered, env)
+		}
+	}
+	return filtered, nil
+}
+
+// buildTimeline shapes releases, freezes and holidays between from and to,
+// holidays named in the first of langs they have a name in
+// (inclusive dates) into timeline rows, one per environment. A non-empty
+// group limits the rows to that group's environments.
+func buildTimeline(from, to time.Time, group string, langs []string) (timelineData, error) {
+	releases, err := loadReleases()
+	if err != nil {
+		return timelineData{}, err
+	}
+	holidays, err := loadHolidays()
+	if err != nil {
+		return timelineData{}, err
+	}
+	holidays = localizeHolidays(holidays, langs)
+	envs, err := loadEnvironments()
+	if err != nil {
+		return timelineData{}, err
+	}
+
+	rangeEnd := to.AddDate(0, 0, 1)
+	data := timelineData{
+		From:     from.Format(dateLayout),
+		To:       to.Format(dateLayout),
+		Rows:     []timelineRow{},
+		Holidays: []timelineBar{},
+	}
+
+	order, err := rowEnvironments(envs, releases, group)
+	if err != nil {
+		return timelineData{}, err
+	}
+	for _, env := range order {
+		row := timelineRow{Environment: env.Name, DisplayName: env.DisplayName, Bars: []timelineBar{}, Freezes: []timelineBar{}}
+		if env.Lock.active(time.Now()) {
+			row.Lock = env.Lock
+		}
+		for _, g := range envs.groupsOf(env.Name) {
+			for _, f := range g.Freezes {
+				start, err1 := time.ParseInLocation(dateLayout, f.From, time.Local)
+				end, err2 := time.ParseInLocation(dateLayout, f.To, time.Local)
+				if err1 != nil || err2 != nil || !start.Before(rangeEnd) || end.Before(from) {
+					continue
+				}
+				row.Freezes = append(row.Freezes, timelineBar{
+					ID:    "freeze:" + g.Name + ":" + f.From,
+					Type:  "freeze",
+					Label: strings.TrimSpace(g.Name + " " + f.Reason),
+					Start: start,
+					End:   end.AddDate(0, 0, 1),
+				})
+			}
+		}
+		assignLanes(row.Freezes)
+		for _, e := range releases[env.Name] {
+			start, end, err := e.window()
+			if err != nil || !start.Before(rangeEnd) || !end.After(from) {
+				continue
+			}
+			bar := timelineBar{
+				ID:         releaseID(env.Name, e.Date),
+				Type:       "release",
+				Label:      e.ReleaseName,
+				Start:      start,
+				End:        end,
+				Status:     e.Status,
+				DependsOn:  e.DependsOn,
+				JiraTicket: e.JiraTicket,
+			}
+			if bar.Label == "" {
+				bar.Label = e.Status
+			}
+			if c, ok := envs.ReleaseStatuses[e.Status]; ok {
+				bar.Color = &c
+			}
+			row.Bars = append(row.Bars, bar)
+		}
+		row.Lanes = assignLanes(row.Bars)
+		data.Rows = append(data.Rows, row)
+	}
+
+	for _, h := range holidays.Holidays {
+		start, err := time.ParseInLocation(dateLayout, h.Date, time.Local)
+		if err != nil || start.Before(from) || !start.Before(rangeEnd) {
+			continue
+		}
+		data.Holidays = append(data.Holidays, timelineBar{
+			ID:    "holiday:" + h.Date,
+			Type:  "holiday",
+			Label: h.Name,
+			Start: start,
+			End:   start.AddDate(0, 0, 1),
+		})
+	}
+	assignLanes(data.Holidays)
+
+	// Sprint boundaries of the configured Jira boards, best effort
+	data.Sprints = sprintBars(from, rangeEnd)
+
+	return data, nil
+}
+
+// Handle Gantt/timeline data API
+func handleTimeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, ok := parseDateParam(r, "from", today())
+	if !ok {
+		http.Error(w, "Invalid 'from' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	to, ok := parseDateParam(r, "to", from.AddDate(0, 3, 0))
+	if !ok {
+		http.Error(w, "Invalid 'to' date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	if to.Before(from) {
+		http.Error(w, "'to' must not be before 'from'", http.StatusBadRequest)
+		return
+	}
+	group := r.URL.Query().Get("group")
+	if group != "" {
+		if envs, err := loadEnvironments(); err == nil {
+			if _, ok := envs.group(group); !ok {
+				http.Error(w, fmt.Sprintf("Unknown group %q", group), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	data, err := buildTimeline(from, to, group, requestLanguages(r))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error building timeline: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(data)
+}
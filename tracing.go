@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TracingConfig is tracing-config.json, read at startup: spans of requests,
+// data file saves and Jira calls are exported there by OTLP over HTTP. The
+// standard OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME variables
+// apply without it.
+type TracingConfig struct {
+	Endpoint    string            `json:"endpoint,omitempty"`    // collector, e.g. http://localhost:4318; nothing is traced without
+	Headers     map[string]string `json:"headers,omitempty"`     // sent with every export, e.g. an API key
+	ServiceName string            `json:"serviceName,omitempty"` // default relplanner
+	SampleRatio *float64          `json:"sampleRatio,omitempty"` // of traces started here, default 1
+}
+
+// OTLP span kinds and status codes
+const (
+	spanInternal = 1
+	spanServer   = 2
+	spanClient   = 3
+
+	spanStatusError = 2
+)
+
+// traceBatchSize and traceBatchInterval bound how many spans wait before
+// being exported
+const (
+	traceBatchSize     = 512
+	traceBatchInterval = 5 * time.Second
+)
+
+// tracing is the exporter's setup; spans are only made once it is enabled
+var tracing struct {
+	enabled bool
+	cfg     TracingConfig
+	queue   chan *span
+}
+
+// span is an operation of a trace
+type span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	name     string
+	kind     int
+	start    time.Time
+	end      time.Time
+	sampled  bool
+
+	mu     sync.Mutex
+	attrs  map[string]interface{}
+	errMsg string
+	ended  bool
+}
+
+// spanKey is the context key of the current span
+type spanKey struct{}
+
+// spanFrom returns the current span of a context, nil when none
+func spanFrom(ctx context.Context) *span {
+	s, _ := ctx.Value(spanKey{}).(*span)
+	return s
+}
+
+// remoteSpan is the parent of a request's span, from its traceparent header
+type remoteSpan struct {
+	traceID [16]byte
+	spanID  [8]byte
+	sampled bool
+}
+
+// parseTraceparent parses a W3C traceparent header
+func parseTraceparent(h string) (remoteSpan, bool) {
+	var p remoteSpan
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return p, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if _, err1 := hex.Decode(p.traceID[:], []byte(parts[1])); err1 != nil || err != nil {
+		return p, false
+	}
+	if _, err := hex.Decode(p.spanID[:], []byte(parts[2])); err != nil {
+		return p, false
+	}
+	if p.traceID == [16]byte{} || p.spanID == [8]byte{} {
+		return p, false
+	}
+	p.sampled = flags[0]&1 == 1
+	return p, true
+}
+
+// traceparent is the W3C traceparent header continuing a span's trace
+func (s *span) traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", s.traceID, s.spanID, flags)
+}
+
+// sampleRoot decides whether a trace started here is exported
+func sampleRoot(traceID [16]byte) bool {
+	ratio := 1.0
+	if tracing.cfg.SampleRatio != nil {
+		ratio = *tracing.cfg.SampleRatio
+	}
+	if ratio >= 1 {
+		return true
+	}
+	// The trace ID's low bits are random, so compare them to the ratio
+	return float64(binary.BigEndian.Uint64(traceID[8:])>>11) < ratio*float64(1<<53)
+}
+
+// startSpan starts a span, a child of the context's span or of a remote
+// one; it is nil, and its methods do nothing, while tracing is off
+func startSpan(ctx context.Context, name string, kind int, remote *remoteSpan) (context.Context, *span) {
+	if !tracing.enabled {
+		return ctx, nil
+	}
+	s := &span{name: name, kind: kind, start: time.Now(), attrs: map[string]interface{}{}}
+	rand.Read(s.spanID[:])
+	switch parent := spanFrom(ctx); {
+	case parent != nil:
+		s.traceID, s.parentID, s.sampled = parent.traceID, parent.spanID, parent.sampled
+	case remote != nil:
+		s.traceID, s.parentID, s.sampled = remote.traceID, remote.spanID, remote.sampled
+	default:
+		rand.Read(s.traceID[:])
+		s.sampled = sampleRoot(s.traceID)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// set sets an attribute of the span
+func (s *span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// finish ends the span, failed when err isn't nil, and queues it for export
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.end = true, time.Now()
+	if err != nil {
+		s.errMsg = err.Error()
+	}
+	s.mu.Unlock()
+	if !s.sampled {
+		return
+	}
+	select {
+	case tracing.queue <- s:
+	default:
+		// The collector can't keep up; drop rather than slow requests
+	}
+}
+
+// otlpValue is an OTLP attribute value
+func otlpValue(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case bool:
+		return map[string]interface{}{"boolValue": v}
+	case int:
+		return map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		return map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		return map[string]interface{}{"doubleValue": v}
+	default:
+		return map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+}
+
+// otlpAttributes renders attributes as OTLP key values
+func otlpAttributes(attrs map[string]interface{}) []map[string]interface{} {
+	out := []map[string]interface{}{}
+	for k, v := range attrs {
+		out = append(out, map[string]interface{}{"key": k, "value": otlpValue(v)})
+	}
+	return out
+}
+
+// otlp renders the span in OTLP's JSON encoding
+func (s *span) otlp() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := map[string]interface{}{
+		"traceId":           hex.EncodeToString(s.traceID[:]),
+		"spanId":            hex.EncodeToString(s.spanID[:]),
+		"name":              s.name,
+		"kind":              s.kind,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attrs),
+	}
+	if s.parentID != [8]byte{} {
+		o["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if s.errMsg != "" {
+		o["status"] = map[string]interface{}{"code": spanStatusError, "message": s.errMsg}
+	}
+	return o
+}
+
+// exportSpans sends spans to the collector
+func exportSpans(client *http.Client, spans []*span) error {
+	rendered := make([]map[string]interface{}, len(spans))
+	for i, s := range spans {
+		rendered[i] = s.otlp()
+	}
+	hostname, _ := os.Hostname()
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(map[string]interface{}{
+				"service.name": tracing.cfg.ServiceName, "host.name": hostname,
+			})},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "relplanner"},
+				"spans": rendered,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(tracing.cfg.Endpoint, "/")+"/v1/traces", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range tracing.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// startTracing reads tracing-config.json and, when it names a collector,
+// starts exporting spans to it
+func startTracing() error {
+	var cfg TracingConfig
+	err := readDataFile("tracing-config.json", &cfg)
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = os.Getenv("OTEL_SERVICE_NAME")
+	}
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = "relplanner"
+	}
+	if err != nil || cfg.Endpoint == "" {
+		return err
+	}
+	tracing.cfg, tracing.queue, tracing.enabled = cfg, make(chan *span, 4*traceBatchSize), true
+	logServer.Info("Exporting traces", "endpoint", cfg.Endpoint, "service", cfg.ServiceName)
+	go runTraceExport()
+	return nil
+}
+
+// runTraceExport exports queued spans in batches
+func runTraceExport() {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ticker := time.NewTicker(traceBatchInterval)
+	defer ticker.Stop()
+	var batch []*span
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := exportSpans(client, batch); err != nil {
+			logServer.Warn("Exporting traces failed, dropped spans", "spans", len(batch), "err", err)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case s := <-tracing.queue:
+			if batch = append(batch, s); len(batch) >= traceBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// traceRequests gives every request a server span, continuing the trace of
+// a traceparent header
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tracing.enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var remote *remoteSpan
+		if p, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			remote = &p
+		}
+		// Name spans by route, not by path, which would be too many names
+		_, route := http.DefaultServeMux.Handler(r)
+		name := r.Method + " " + strings.TrimPrefix(route, r.Method+" ")
+		ctx, s := startSpan(r.Context(), name, spanServer, remote)
+		s.set("http.request.method", r.Method)
+		s.set("url.path", r.URL.Path)
+		s.set("http.route", route)
+		s.set("client.address", clientIP(r))
+		if id := requestIDFrom(ctx); id != "" {
+			s.set("http.request.id", id)
+		}
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		s.set("http.response.status_code", rec.status)
+		var err error
+		if rec.status >= 500 {
+			err = fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status))
+		}
+		s.finish(err)
+	})
+}
+
+// tracingTransport gives outgoing requests client spans, children of the
+// request's context span or else of the span the client was made for
+type tracingTransport struct {
+	base    http.RoundTripper
+	ctx     context.Context
+	service string
+}
+
+// traceClient makes a client's requests spans of a service, e.g. Jira
+func traceClient(ctx context.Context, client *http.Client, service string) *http.Client {
+	if !tracing.enabled {
+		return client
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	traced := *client
+	traced.Transport = &tracingTransport{base: base, ctx: ctx, service: service}
+	return &traced
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parent := req.Context()
+	if spanFrom(parent) == nil {
+		parent = t.ctx
+	}
+	_, s := startSpan(parent, t.service+" "+req.Method, spanClient, nil)
+	s.set("http.request.method", req.Method)
+	s.set("server.address", req.URL.Host)
+	s.set("url.path", req.URL.Path)
+	if s != nil {
+		req = req.Clone(req.Context())
+		req.Header.Set("traceparent", s.traceparent())
+	}
+	resp, err := t.base.RoundTrip(req)
+	spanErr := err
+	if err == nil {
+		s.set("http.response.status_code", resp.StatusCode)
+		if resp.StatusCode >= 400 {
+			spanErr = fmt.Errorf("%s answered %s", t.service, resp.Status)
+		}
+	}
+	s.finish(spanErr)
+	return resp, err
+}
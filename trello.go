@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TrelloConfig is trello-config.json, kept on disk only since it holds an
+// API token. Cards of the listed boards and lists can be linked to
+// releases that use the Trello ticket provider.
+type TrelloConfig struct {
+	APIKey          string              `json:"apiKey"`
+	Token           string              `json:"token"`
+	APIURL          string              `json:"apiUrl,omitempty"` // default https://api.trello.com/1
+	Boards          []TrelloBoardFilter `json:"boards"`
+	MaxTotalResults int                 `json:"maxTotalResults,omitempty"`
+	CacheTTLSeconds *int                `json:"cacheTTLSeconds,omitempty"`
+}
+
+// TrelloBoardFilter selects the cards of one board
+type TrelloBoardFilter struct {
+	Board string   `json:"board"`           // board ID or short link
+	Lists []string `json:"lists,omitempty"` // list names or IDs, every open list when empty
+}
+
+// trelloKeyPattern matches a card short link, the ID in trello.com/c/... URLs
+var trelloKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]{8}$`)
+
+// trelloCache holds the cards of the configured boards
+var trelloCache = &jiraTicketCache{entries: map[string]jiraCacheEntry{}}
+
+// loadTrelloConfig reads trello-config.json; ok is false when Trello isn't configured
+func loadTrelloConfig() (cfg TrelloConfig, ok bool, err error) {
+	if err := readDataFile("trello-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://api.trello.com/1"
+	}
+	cfg.APIURL = strings.TrimSuffix(cfg.APIURL, "/")
+	return cfg, cfg.APIKey != "" && cfg.Token != "" && len(cfg.Boards) > 0, nil
+}
+
+// trelloGet fetches a Trello API path into out; the key and token go in the query
+func trelloGet(cfg TrelloConfig, path string, params url.Values, out interface{}) error {
+	params.Set("key", cfg.APIKey)
+	params.Set("token", cfg.Token)
+	req, err := http.NewRequest(http.MethodGet, cfg.APIURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return doJSON(req, nil, out)
+}
+
+// trelloCard is the part of a card we use
+type trelloCard struct {
+	ShortLink string `json:"shortLink"`
+	Name      string `json:"name"`
+	ShortURL  string `json:"shortUrl"`
+	IDList    string `json:"idList"`
+	Due       string `json:"due"`
+	Labels    []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Members []struct {
+		FullName string `json:"fullName"`
+	} `json:"members"`
+}
+
+// fetchTrelloCards loads the cards of the configured lists, up to maxTotalResults
+func fetchTrelloCards(cfg TrelloConfig) ([]map[string]interface{}, error) {
+	limit := defaultJiraResultLimit
+	if cfg.MaxTotalResults > 0 {
+		limit = min(cfg.MaxTotalResults, jiraResultHardCap)
+	}
+	tickets := []map[string]interface{}{}
+	for _, b := range cfg.Boards {
+		board := url.PathEscape(b.Board)
+		var lists []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := trelloGet(cfg, "/boards/"+board+"/lists", url.Values{"fields": {"name"}}, &lists); err != nil {
+			return nil, fmt.Errorf("board %s: %w", b.Board, err)
+		}
+		names := map[string]string{}
+		for _, l := range lists {
+			if len(b.Lists) == 0 {
+				names[l.ID] = l.Name
+			}
+			for _, want := range b.Lists {
+				if want == l.ID || strings.EqualFold(want, l.Name) {
+					names[l.ID] = l.Name
+				}
+			}
+		}
+
+		var cards []trelloCard
+		params := url.Values{
+			"fields":        {"name,shortLink,shortUrl,idList,labels,due"},
+			"members":       {"true"},
+			"member_fields": {"fullName"},
+		}
+		if err := trelloGet(cfg, "/boards/"+board+"/cards", params, &cards); err != nil {
+			return nil, fmt.Errorf("board %s: %w", b.Board, err)
+		}
+		for _, c := range cards {
+			list, ok := names[c.IDList]
+			if !ok {
+				continue
+			}
+			if len(tickets) >= limit {
+				return tickets, nil
+			}
+			ticket := map[string]interface{}{
+				"key":      c.ShortLink,
+				"summary":  c.Name,
+				"status":   list,
+				"url":      c.ShortURL,
+				"provider": "trello",
+			}
+			var labels, members []string
+			for _, l := range c.Labels {
+				if l.Name != "" {
+					labels = append(labels, l.Name)
+				}
+			}
+			for _, m := range c.Members {
+				members = append(members, m.FullName)
+			}
+			if len(labels) > 0 {
+				ticket["labels"] = labels
+			}
+			if len(members) > 0 {
+				ticket["assignee"] = strings.Join(members, ", ")
+			}
+			if c.Due != "" {
+				ticket["due"] = c.Due
+			}
+			tickets = append(tickets, ticket)
+		}
+	}
+	return tickets, nil
+}
+
+// cachedTrelloTickets returns the cards of the configured lists, cached and
+// served stale while Trello is unavailable like Jira searches
+func cachedTrelloTickets(refresh bool) (jiraTicketsResult, error) {
+	cfg, ok, err := loadTrelloConfig()
+	if err != nil {
+		return jiraTicketsResult{}, &jiraError{http.StatusInternalServerError, "Invalid Trello config"}
+	}
+	if !ok {
+		return jiraTicketsResult{tickets: []map[string]interface{}{}, cacheStatus: "MISS"}, nil
+	}
+	ttl := defaultJiraCacheTTL
+	if cfg.CacheTTLSeconds != nil && *cfg.CacheTTLSeconds >= 0 {
+		ttl = time.Duration(*cfg.CacheTTLSeconds) * time.Second
+	}
+	cached, hit := trelloCache.get("")
+	if hit && !refresh && time.Since(cached.fetchedAt) < ttl {
+		return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "HIT"}, nil
+	}
+	tickets, err := fetchTrelloCards(cfg)
+	if err != nil {
+		logTrello.Error("Trello fetch failed", "err", err)
+		if hit {
+			return jiraTicketsResult{tickets: cached.tickets, fetchedAt: cached.fetchedAt, cacheStatus: "STALE", stale: true}, nil
+		}
+		return jiraTicketsResult{}, &jiraError{http.StatusBadGateway, fmt.Sprintf("Trello API error: %v", err)}
+	}
+	entry := trelloCache.put("", tickets)
+	return jiraTicketsResult{tickets: entry.tickets, fetchedAt: entry.fetchedAt, cacheStatus: "MISS"}, nil
+}
+
+// trelloProvider serves releases using the "trello" ticket provider: the
+// linked cards and those labelled with the release name
+type trelloProvider struct{}
+
+func init() {
+	registerTicketProvider(ticketProviderInfo{ID: "trello", Name: "Trello", ConfigFile: "trello-config.json",
+		KeyFormat: "a card short link", KeyExample: "aBcD1234"}, trelloProvider{})
+}
+
+func (trelloProvider) Search(query url.Values, refresh bool) (jiraTicketsResult, error) {
+	return cachedTrelloTickets(refresh)
+}
+
+func (trelloProvider) Get(release ReleaseEntry) []map[string]interface{} {
+	result, _ := cachedTrelloTickets(false)
+	tickets := lookupTickets(release.linkedTickets(), result, "trello")
+	if release.ReleaseName == "" {
+		return tickets
+	}
+	var labelled []map[string]interface{}
+	for _, t := range result.tickets {
+		labels, _ := t["labels"].([]string)
+		for _, l := range labels {
+			if strings.EqualFold(l, release.ReleaseName) {
+				labelled = append(labelled, t)
+				break
+			}
+		}
+	}
+	return appendNewTickets(tickets, labelled)
+}
+
+// Link accepts a short link or a card URL such as https://trello.com/c/aBcD1234/12-title
+func (trelloProvider) Link(key string) (string, bool) {
+	if i := strings.Index(key, "trello.com/c/"); i >= 0 {
+		key, _, _ = strings.Cut(key[i+len("trello.com/c/"):], "/")
+	}
+	return key, trelloKeyPattern.MatchString(key)
+}
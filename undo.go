@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+)
+
+// undoDepth is how many versions of a data file can be undone
+const undoDepth = 20
+
+// undoEntry is a version of a data file replaced by a save
+type undoEntry struct {
+	content []byte
+	next    string // ETag of the version that replaced it
+}
+
+// undoStack holds the versions a data file's undo and redo go back to,
+// latest last
+type undoStack struct {
+	undo, redo []undoEntry
+}
+
+// undoStacks are kept in memory for the watched data files, apart from the
+// backups: they only go back a few saves, and not across restarts. Guarded
+// by fileMu.
+var undoStacks = map[string]*undoStack{}
+
+// pushUndo records a save of a data file replacing before with the version
+// of etag; fileMu must be held. Saves undo the redo stack, undos and redos
+// move the version between the stacks.
+func pushUndo(file string, before []byte, etag, action string) {
+	if !watchedFile(file) || before == nil {
+		return
+	}
+	s, ok := undoStacks[file]
+	if !ok {
+		s = &undoStack{}
+		undoStacks[file] = s
+	}
+	entry := undoEntry{content: before, next: etag}
+	switch action {
+	case auditUndo:
+		s.undo = s.undo[:max(len(s.undo)-1, 0)]
+		s.redo = append(s.redo, entry)
+	case auditRedo:
+		s.redo = s.redo[:max(len(s.redo)-1, 0)]
+		s.undo = append(s.undo, entry)
+	default:
+		s.undo = append(s.undo, entry)
+		s.redo = nil
+	}
+	if len(s.undo) > undoDepth {
+		s.undo = s.undo[len(s.undo)-undoDepth:]
+	}
+}
+
+// undoState is the JSON response of /api/undo and /api/redo
+type undoState struct {
+	File string `json:"file"`
+	Undo int    `json:"undo"` // versions that can be undone
+	Redo int    `json:"redo"`
+}
+
+// currentUndoState returns the depths of a file's stacks; fileMu must be
+// held
+func currentUndoState(file string) undoState {
+	state := undoState{File: file}
+	if s, ok := undoStacks[file]; ok {
+		state.Undo, state.Redo = len(s.undo), len(s.redo)
+	}
+	return state
+}
+
+// Handle undoing the last save of the ?file= data file, or redoing the last
+// undo, on /api/undo and /api/redo. The version gone back to is saved like
+// any other, so it is checked, backed up and audited; GET returns how many
+// steps there are.
+func handleUndo(w http.ResponseWriter, r *http.Request) {
+	file := r.URL.Query().Get("file")
+	if !watchedFile(file) {
+		http.Error(w, "Unknown 'file'", http.StatusBadRequest)
+		return
+	}
+	redo := r.URL.Path == "/api/redo"
+
+	switch r.Method {
+	case http.MethodGet:
+		fileMu.Lock()
+		state := currentUndoState(file)
+		fileMu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state)
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileMu.Lock()
+	var stack []undoEntry
+	if s, ok := undoStacks[file]; ok {
+		stack = s.undo
+		if redo {
+			stack = s.redo
+		}
+	}
+	var top undoEntry
+	if len(stack) > 0 {
+		top = stack[len(stack)-1]
+	}
+	fileMu.Unlock()
+	if top.content == nil {
+		if redo {
+			http.Error(w, "Nothing to redo", http.StatusConflict)
+		} else {
+			http.Error(w, "Nothing to undo", http.StatusConflict)
+		}
+		return
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(top.content, &data); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusInternalServerError)
+		return
+	}
+	filePath := filepath.Join(dataDir, file)
+	if err := authorizeWrite(r, filePath, data); err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	action := auditUndo
+	if redo {
+		action = auditRedo
+	}
+
+	// Only while the version it replaced is still the saved one
+	etag, err := writeJSONFileAction(withServerFields(r.Context()), filePath, data, top.next, maxBackupsFromRequest(r), requestUser(r), action)
+	if err != nil {
+		writeSaveError(w, err)
+		return
+	}
+	fileMu.Lock()
+	state := currentUndoState(file)
+	fileMu.Unlock()
+	w.Header().Set("ETag", etag)
+	setModifiedHeaders(w, filePath)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
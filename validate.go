@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// validateDataDir checks the data files of a directory as saves do, then
+// across files: releases of environments that don't exist, dependencies on
+// releases that don't, people missing from the roster and malformed dates
+// and times. It returns the problems found, by file.
+func validateDataDir(dir string) (files int, problems []string, err error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return 0, nil, err
+	}
+	docs := map[string][]byte{}
+	for _, path := range paths {
+		name := filepath.Base(path)
+		content, err := os.ReadFile(path)
+		if err == nil {
+			err = validateDataFile(name, content)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		docs[name] = content
+	}
+	return len(paths), append(problems, crossCheckDataFiles(docs)...), nil
+}
+
+// crossCheckDataFiles checks the references between valid data files; a
+// file missing or invalid is not checked against
+func crossCheckDataFiles(docs map[string][]byte) []string {
+	var problems []string
+	report := func(file, format string, args ...interface{}) {
+		problems = append(problems, file+": "+fmt.Sprintf(format, args...))
+	}
+	validDate := func(s string) bool {
+		_, err := time.Parse(dateLayout, s)
+		return err == nil
+	}
+
+	var envs *EnvironmentsData
+	if content, ok := docs["environments.json"]; ok {
+		envs = &EnvironmentsData{}
+		json.Unmarshal(content, envs)
+	}
+	var people map[string]bool
+	if content, ok := docs["team.json"]; ok {
+		var team TeamData
+		json.Unmarshal(content, &team)
+		people = map[string]bool{}
+		for _, p := range team.People {
+			people[p.ID] = true
+		}
+		for i, shift := range team.OnCall {
+			if !validDate(shift.From) || !validDate(shift.To) {
+				report("team.json", "on-call shift %d: from/to must be dates (YYYY-MM-DD)", i)
+			}
+			if !people[shift.Person] {
+				report("team.json", "on-call shift %d: unknown person %q", i, shift.Person)
+			}
+		}
+	}
+
+	if content, ok := docs["releases.json"]; ok {
+		var releases ReleasesData
+		if err := json.Unmarshal(content, &releases); err != nil {
+			report("releases.json", "malformed release entries: %v", err)
+		}
+		known := map[string]bool{}
+		if envs != nil {
+			for _, e := range envs.Environments {
+				known[e.Name] = true
+			}
+		}
+		names := []string{}
+		for env := range releases {
+			names = append(names, env)
+		}
+		sort.Strings(names)
+		for _, env := range names {
+			if envs != nil && !known[env] {
+				report("releases.json", "releases of environment %q, which is not in environments.json", env)
+			}
+			dates := map[string]bool{}
+			for i, e := range releases[env] {
+				id := releaseID(env, e.Date)
+				if !validDate(e.Date) {
+					report("releases.json", "%s release %d: date %q must be YYYY-MM-DD", env, i, e.Date)
+					continue
+				}
+				if dates[e.Date] {
+					report("releases.json", "%s: more than one release", id)
+				}
+				dates[e.Date] = true
+				if envs != nil && len(envs.ReleaseStatuses) > 0 && e.Status != "" {
+					if _, ok := envs.ReleaseStatuses[e.Status]; !ok {
+						report("releases.json", "%s: status %q is not in environments.json", id, e.Status)
+					}
+				}
+				if e.StartTime != "" {
+					if _, err := time.Parse("15:04", e.StartTime); err != nil {
+						report("releases.json", "%s: startTime %q must be HH:MM", id, e.StartTime)
+					}
+				}
+				if e.EndDateTime != "" {
+					if _, err := time.Parse(dateTimeLayout, e.EndDateTime); err != nil {
+						report("releases.json", "%s: endDateTime %q must be YYYY-MM-DDTHH:MM", id, e.EndDateTime)
+					}
+				}
+				if e.Risk != "" && !environmentTiers[e.Risk] {
+					report("releases.json", "%s: risk %q must be critical, high, medium or low", id, e.Risk)
+				}
+				if e.DependsOn != "" {
+					depEnv, depDate, ok := parseReleaseID(e.DependsOn)
+					if !ok || !hasRelease(releases[depEnv], depDate) {
+						report("releases.json", "%s: depends on %s, which does not exist", id, e.DependsOn)
+					}
+				}
+				if people != nil {
+					for _, person := range append([]string{e.ReleaseManager}, e.Deployers...) {
+						if person != "" && !people[person] {
+							report("releases.json", "%s: %q is not in team.json", id, person)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if content, ok := docs["holidays.json"]; ok {
+		var holidays HolidaysData
+		json.Unmarshal(content, &holidays)
+		seen := map[string]bool{}
+		for i, h := range holidays.Holidays {
+			if !validDate(h.Date) {
+				report("holidays.json", "holiday %d: date %q must be YYYY-MM-DD", i, h.Date)
+			} else if seen[h.Date] {
+				report("holidays.json", "more than one holiday on %s", h.Date)
+			}
+			seen[h.Date] = true
+		}
+	}
+
+	if content, ok := docs["absences.json"]; ok && people != nil {
+		var absences AbsencesData
+		json.Unmarshal(content, &absences)
+		for i, a := range absences.Absences {
+			if !people[a.Person] {
+				report("absences.json", "absence %d: %q is not in team.json", i, a.Person)
+			}
+		}
+	}
+	return problems
+}
+
+// hasRelease reports whether an environment has a release on a date
+func hasRelease(entries []ReleaseEntry, date string) bool {
+	for _, e := range entries {
+		if e.Date == date {
+			return true
+		}
+	}
+	return false
+}
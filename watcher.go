@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// externalEditor is who edits data files outside the server, in the
+// modification records and the audit log
+const externalEditor = "external"
+
+// watchSettle is how long a data file must stay unchanged before an edit is
+// taken in, so editors and scripts writing in steps are seen once
+const watchSettle = 500 * time.Millisecond
+
+// serverStateFiles are files of the data directory the server keeps its own
+// state in, which change without going through writeJSONFile
+var serverStateFiles = map[string]bool{
+	"modifications.json":           true,
+	"cloud-export.json":            true,
+	"confluence-publish.json":      true,
+	"email-notified.json":          true,
+	"github-actions.json":          true,
+	"github-sync.json":             true,
+	"jira-sync.json":               true,
+	"maintenance-windows.json":     true,
+	"reminders-sent.json":          true,
+	"servicenow-changes.json":      true,
+	"statuspage-maintenances.json": true,
+}
+
+// watchedFile reports whether edits of a data file are watched for
+func watchedFile(name string) bool {
+	return sharedFile(name) && !serverStateFiles[name]
+}
+
+// dataFiles is the content of the watched data files as the server last
+// wrote or saw them, telling its own writes from external edits. Guarded by
+// fileMu.
+var dataFiles = map[string][]byte{}
+
+// noteDataWrite records content the server wrote to a data file; fileMu must
+// be held
+func noteDataWrite(name string, content []byte) {
+	if watchedFile(name) {
+		dataFiles[name] = content
+	}
+}
+
+// startDataWatcher watches the data directory for edits made outside the
+// server, by scripts or by hand. They are backed up, recorded and audited
+// like saves, pushed to the change feed and run the data change hooks, so
+// caches such as the search index follow.
+func startDataWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(dataDir); err != nil {
+		watcher.Close()
+		return err
+	}
+	fileMu.Lock()
+	names, _ := filepath.Glob(filepath.Join(dataDir, "*.json"))
+	for _, path := range names {
+		if content, err := os.ReadFile(path); err == nil {
+			noteDataWrite(filepath.Base(path), content)
+		}
+	}
+	fileMu.Unlock()
+
+	go func() {
+		var mu sync.Mutex
+		pending := map[string]*time.Timer{}
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				name := filepath.Base(event.Name)
+				if !watchedFile(name) || filepath.Dir(event.Name) != filepath.Clean(dataDir) {
+					continue
+				}
+				mu.Lock()
+				if t, ok := pending[name]; ok {
+					t.Reset(watchSettle)
+				} else {
+					pending[name] = time.AfterFunc(watchSettle, func() {
+						mu.Lock()
+						delete(pending, name)
+						mu.Unlock()
+						checkExternalEdit(name)
+					})
+				}
+				mu.Unlock()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logServer.Warn("Data directory watch error", "err", err)
+			}
+		}
+	}()
+	logServer.Info("Watching the data directory for external edits", "dir", dataDir)
+	return nil
+}
+
+// checkExternalEdit takes in a data file changed on disk unless the server
+// wrote it. The version it replaced is backed up first; an edit leaving
+// invalid JSON is only logged, until it is fixed.
+func checkExternalEdit(name string) {
+	path := filepath.Join(dataDir, name)
+	release, err := clusterLock(context.Background())
+	if err != nil {
+		logServer.Warn("Could not take in a data file edited externally", "file", name, "err", err)
+		return
+	}
+	defer release()
+	fileMu.Lock()
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		fileMu.Unlock()
+		logServer.Warn("Could not read a data file edited externally", "file", name, "err", err)
+		return
+	}
+	previous, known := dataFiles[name]
+	if bytes.Equal(content, previous) && (content != nil || !known) {
+		fileMu.Unlock()
+		return
+	}
+	if content != nil && !json.Valid(content) {
+		fileMu.Unlock()
+		logServer.Error("Data file edited externally is not valid JSON", "file", name)
+		return
+	}
+
+	// Another instance's save was backed up, audited and notified by it
+	if content != nil && peerSaved(name, previous) {
+		dataFiles[name] = content
+		publishLiveChange(liveChange{Time: time.Now().UTC().Format(time.RFC3339), File: name, Action: auditUpdate,
+			Records: changedRecords(name, previous, content), By: "another instance", ETag: checksum(content)})
+		fileMu.Unlock()
+		dropDataCaches(nil)
+		logServer.Debug("Data file saved by another instance", "file", name)
+		return
+	}
+
+	// Safety backup of the version replaced, restorable like any other
+	backupFilename := ""
+	if previous != nil {
+		backupFilename = fmt.Sprintf("%s.%s.json", strings.TrimSuffix(name, ".json"), time.Now().Format("20060102-150405"))
+		backupPath := filepath.Join(backupDir, backupFilename)
+		if err := os.WriteFile(backupPath, previous, 0644); err != nil {
+			logServer.Warn("Could not back up a data file edited externally", "file", name, "err", err)
+			backupFilename = ""
+		} else {
+			writeChecksum(backupPath)
+			if err := cleanupOldBackups(name, defaultMaxBackups); err != nil {
+				logServer.Warn("Error cleaning up old backups", "file", name, "err", err)
+			}
+		}
+	}
+	if content == nil {
+		delete(dataFiles, name)
+	} else {
+		dataFiles[name] = content
+	}
+	action := ""
+	if content == nil {
+		action = auditDelete
+	} else {
+		pushUndo(name, previous, computeETag(content), "")
+	}
+	recordModification(name, backupFilename, externalEditor)
+	entry := auditWrite(externalEditor, action, name, "", previous, content)
+	publishLiveChange(liveChange{Seq: entry.Seq, Time: time.Now().UTC().Format(time.RFC3339), File: name,
+		Action: entry.Action, Records: changedRecords(name, previous, content), By: externalEditor, ETag: checksum(content)})
+	runPostSaveHooks(name, externalEditor, entry.Action, previous, content)
+	fileMu.Unlock()
+
+	logServer.Warn("Data file edited externally", "file", name, "backup", backupFilename)
+	notifyDataChange(name)
+}
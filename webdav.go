@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVConfig is webdav-config.json: the managed data files served over
+// WebDAV under /dav/, so they can be opened in desktop tools
+type WebDAVConfig struct {
+	Enabled bool `json:"enabled"`
+	// ReadWrite lets clients lock and save the files; saves are validated,
+	// backed up and audited like the API's. Read-only by default.
+	ReadWrite bool `json:"readWrite,omitempty"`
+}
+
+// loadWebDAVConfig reads webdav-config.json
+func loadWebDAVConfig() (WebDAVConfig, error) {
+	var cfg WebDAVConfig
+	err := readDataFile("webdav-config.json", &cfg)
+	return cfg, err
+}
+
+// managedFiles are the data files served over WebDAV: those with their own
+// API and the datasets of datasets-config.json, with the backups each keeps
+// (0 for the request's default)
+func managedFiles() map[string]int {
+	files := map[string]int{"environments.json": 0, "releases.json": 0, "holidays.json": 0}
+	if cfg, err := loadDatasets(); err == nil {
+		for _, d := range cfg.Datasets {
+			files[d.File] = d.MaxBackups
+		}
+	}
+	return files
+}
+
+// davRequestKey carries the request and the outcome of its save to the
+// file system, which only gets the context
+type davRequestKey struct{}
+
+// davRequest is a WebDAV request as its files see it
+type davRequest struct {
+	r       *http.Request
+	saveErr error
+}
+
+// davFS is the data directory as WebDAV sees it: one folder of the managed
+// files. Files can't be created outside the registry, deleted or renamed, so
+// tools saving through a temporary file and a rename can only read.
+type davFS struct{}
+
+func (davFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (davFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (davFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+// managedName returns the data file a WebDAV path names, if it is managed
+func managedName(name string) (string, bool) {
+	file := strings.TrimPrefix(path.Clean("/"+name), "/")
+	_, ok := managedFiles()[file]
+	return file, ok
+}
+
+func (davFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if path.Clean("/"+name) == "/" {
+		return davFileInfo{name: "/", dir: true, modTime: time.Now()}, nil
+	}
+	file, ok := managedName(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	content, err := os.ReadFile(filepath.Join(dataDir, file))
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(filepath.Join(dataDir, file))
+	if err != nil {
+		return nil, err
+	}
+	return davFileInfo{name: file, size: int64(len(content)), modTime: info.ModTime(), etag: computeETag(content)}, nil
+}
+
+func (fs davFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if path.Clean("/"+name) == "/" {
+		var entries []os.FileInfo
+		files := managedFiles()
+		names := make([]string, 0, len(files))
+		for file := range files {
+			names = append(names, file)
+		}
+		sort.Strings(names)
+		for _, file := range names {
+			if info, err := fs.Stat(ctx, file); err == nil {
+				entries = append(entries, info)
+			}
+		}
+		return &davFile{info: davFileInfo{name: "/", dir: true, modTime: time.Now()}, entries: entries}, nil
+	}
+	file, ok := managedName(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		req, _ := ctx.Value(davRequestKey{}).(*davRequest)
+		if req == nil {
+			return nil, os.ErrPermission
+		}
+		f := &davFile{info: davFileInfo{name: file, modTime: time.Now()}, write: &bytes.Buffer{}, req: req}
+		return f, nil
+	}
+	content, err := os.ReadFile(filepath.Join(dataDir, file))
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	return &davFile{info: info.(davFileInfo), content: bytes.NewReader(content)}, nil
+}
+
+// davFileInfo describes a managed file, or the folder of them
+type davFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	etag    string
+}
+
+func (i davFileInfo) Name() string       { return path.Base(i.name) }
+func (i davFileInfo) Size() int64        { return i.size }
+func (i davFileInfo) ModTime() time.Time { return i.modTime }
+func (i davFileInfo) IsDir() bool        { return i.dir }
+func (i davFileInfo) Sys() interface{}   { return nil }
+
+func (i davFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+// ETag is the data file's as the API reports it
+func (i davFileInfo) ETag(ctx context.Context) (string, error) {
+	if i.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return i.etag, nil
+}
+
+func (i davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if i.dir {
+		return "", webdav.ErrNotImplemented
+	}
+	return "application/json", nil
+}
+
+// davFile is a managed file opened for reading, or for a save buffered
+// until it is closed
+type davFile struct {
+	info    davFileInfo
+	content *bytes.Reader
+	entries []os.FileInfo
+	write   *bytes.Buffer
+	req     *davRequest
+}
+
+func (f *davFile) Read(p []byte) (int, error) {
+	if f.content == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.content.Read(p)
+}
+
+func (f *davFile) Seek(offset int64, whence int) (int64, error) {
+	if f.content == nil {
+		return 0, os.ErrInvalid
+	}
+	return f.content.Seek(offset, whence)
+}
+
+func (f *davFile) Write(p []byte) (int, error) {
+	if f.write == nil {
+		return 0, os.ErrPermission
+	}
+	return f.write.Write(p)
+}
+
+func (f *davFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+		return entries, nil
+	}
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.entries) {
+		count = len(f.entries)
+	}
+	entries := f.entries[:count]
+	f.entries = f.entries[count:]
+	return entries, nil
+}
+
+// Stat of a file being saved reports the ETag of the save once closed
+func (f *davFile) Stat() (os.FileInfo, error) {
+	if f.write != nil {
+		f.info.size = int64(f.write.Len())
+		return &f.info, nil
+	}
+	return f.info, nil
+}
+
+// Close saves a file opened for writing as POST to the API does, leaving
+// the error for handleWebDAV to report
+func (f *davFile) Close() error {
+	if f.write == nil {
+		return nil
+	}
+	r := f.req.r
+	// Locking a file that doesn't exist yet opens it without saving
+	if r.Method == "LOCK" && f.write.Len() == 0 {
+		return nil
+	}
+	filePath := filepath.Join(dataDir, f.info.name)
+	var data interface{}
+	if err := json.Unmarshal(f.write.Bytes(), &data); err != nil {
+		f.req.saveErr = &saveError{status: http.StatusBadRequest, msg: "Invalid JSON"}
+		return f.req.saveErr
+	}
+	if err := authorizeWrite(r, filePath, data); err != nil {
+		f.req.saveErr = err
+		return err
+	}
+	maxBackups := managedFiles()[f.info.name]
+	if maxBackups == 0 {
+		maxBackups = maxBackupsFromRequest(r)
+	}
+	etag, err := writeJSONFileAction(r.Context(), filePath, data, r.Header.Get("If-Match"), maxBackups, requestUser(r), "")
+	if err != nil {
+		f.req.saveErr = err
+		return err
+	}
+	f.info.etag = etag
+	return nil
+}
+
+// davHandler serves the WebDAV protocol; its locks are held in memory
+var davHandler = &webdav.Handler{
+	Prefix:     "/dav",
+	FileSystem: davFS{},
+	LockSystem: webdav.NewMemLS(),
+	Logger: func(r *http.Request, err error) {
+		if err != nil {
+			logServer.DebugContext(r.Context(), "WebDAV request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+		}
+	},
+}
+
+// davWriteMethods are the WebDAV methods changing files
+var davWriteMethods = map[string]bool{"PUT": true, "LOCK": true, "UNLOCK": true, "PROPPATCH": true,
+	"DELETE": true, "MKCOL": true, "COPY": true, "MOVE": true}
+
+// davResponseWriter reports a failed save with its own status and message
+// rather than the 405 the WebDAV handler answers any failed PUT with
+type davResponseWriter struct {
+	http.ResponseWriter
+	req      *davRequest
+	reported bool
+}
+
+func (w *davResponseWriter) WriteHeader(status int) {
+	if w.req.saveErr != nil && !w.reported {
+		w.reported = true
+		writeSaveError(w.ResponseWriter, w.req.saveErr)
+		return
+	}
+	if !w.reported {
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *davResponseWriter) Write(p []byte) (int, error) {
+	if w.reported {
+		return len(p), nil
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Handle WebDAV access to the managed data files. Clients authenticate with
+// an API key, as a bearer token or the password of basic auth, since they
+// can't log in; writes need read-write mode and the planner role, and are
+// saved as API writes are.
+func handleWebDAV(w http.ResponseWriter, r *http.Request) {
+	cfg, err := loadWebDAVConfig()
+	if err != nil {
+		http.Error(w, "Error reading webdav-config.json", http.StatusInternalServerError)
+		return
+	}
+	if !cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+	if _, key, ok := r.BasicAuth(); ok && strings.HasPrefix(key, apiKeyPrefix) {
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	if _, bearer := bearerAPIKey(r); bearer {
+		if _, ok := requestAPIKey(r); !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="relplanner"`)
+			http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+			return
+		}
+	} else if accountsEnabled() {
+		w.Header().Set("WWW-Authenticate", `Basic realm="relplanner"`)
+		http.Error(w, "An API key is required, as the password", http.StatusUnauthorized)
+		return
+	}
+
+	if davWriteMethods[r.Method] {
+		switch _, _, role := requestIdentity(r); {
+		case !cfg.ReadWrite:
+			http.Error(w, "WebDAV access is read-only", http.StatusForbidden)
+			return
+		case !roleAllows(role, "planner"):
+			http.Error(w, "Your role "+role+" can't change the data files", http.StatusForbidden)
+			return
+		}
+		if r.Method != "PUT" && r.Method != "LOCK" && r.Method != "UNLOCK" {
+			http.Error(w, "Data files can only be read and saved over WebDAV", http.StatusForbidden)
+			return
+		}
+		if _, ok := managedName(strings.TrimPrefix(r.URL.Path, "/dav")); !ok && r.Method == "PUT" {
+			http.Error(w, "Only the managed data files can be saved", http.StatusForbidden)
+			return
+		}
+	}
+	req := &davRequest{r: r}
+	ctx := context.WithValue(r.Context(), davRequestKey{}, req)
+	req.r = r.WithContext(ctx)
+	davHandler.ServeHTTP(&davResponseWriter{ResponseWriter: w, req: req}, req.r)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Outbound webhook event types besides "release." + a release event type
+const webhookDataChanged = "data.changed"
+
+// WebhooksConfig is webhooks-config.json, kept on disk only since it holds
+// the signing secrets. Every endpoint gets the events it subscribes to as a
+// JSON POST signed with its secret.
+type WebhooksConfig struct {
+	Endpoints        []WebhookEndpoint `json:"endpoints"`
+	MaxAttempts      int               `json:"maxAttempts,omitempty"`      // default 5
+	RetryBaseSeconds int               `json:"retryBaseSeconds,omitempty"` // first retry delay, doubled per attempt; default 10
+}
+
+// WebhookEndpoint is a URL receiving events. Events lists event types such
+// as "release.moved" or "data.changed"; empty means all of them.
+type WebhookEndpoint struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// webhookPayload is the body of an outbound webhook
+type webhookPayload struct {
+	ID        string      `json:"id"` // delivery ID, the same across retries
+	Type      string      `json:"type"`
+	Timestamp string      `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// webhookAttempt is one try at delivering a webhook
+type webhookAttempt struct {
+	At         string `json:"at"`
+	StatusCode int    `json:"statusCode,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// webhookDelivery is an event sent to an endpoint, see handleWebhookDeliveries
+type webhookDelivery struct {
+	ID        string           `json:"id"`
+	Endpoint  string           `json:"endpoint"`
+	Type      string           `json:"type"`
+	Status    string           `json:"status"` // pending, delivered or failed
+	CreatedAt string           `json:"createdAt"`
+	Attempts  []webhookAttempt `json:"attempts"`
+
+	// Redelivery is set on deliveries resent through the API; they keep the
+	// ID of the original so receivers can deduplicate
+	Redelivery bool `json:"redelivery,omitempty"`
+
+	body []byte
+}
+
+// webhookLogSize is how many deliveries the log keeps
+const webhookLogSize = 500
+
+// webhookLog holds the recent deliveries, newest last
+var webhookLog struct {
+	sync.Mutex
+	deliveries []*webhookDelivery
+}
+
+// loadWebhooksConfig reads webhooks-config.json; ok is false without endpoints
+func loadWebhooksConfig() (cfg WebhooksConfig, ok bool, err error) {
+	if err := readDataFile("webhooks-config.json", &cfg); err != nil {
+		return cfg, false, err
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.RetryBaseSeconds <= 0 {
+		cfg.RetryBaseSeconds = 10
+	}
+	return cfg, len(cfg.Endpoints) > 0, nil
+}
+
+// wants reports whether an endpoint subscribes to an event type
+func (e WebhookEndpoint) wants(kind string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, k := range e.Events {
+		if k == kind || k == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// signWebhook returns the X-Relplanner-Signature of a body: the hex
+// HMAC-SHA256 of the body with the endpoint's secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDeliveryID returns a random delivery ID
+func newDeliveryID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// emitWebhook queues an event for the endpoints given, or for every
+// endpoint subscribed to it when endpoints is nil
+func emitWebhook(kind string, data interface{}, endpoints []string) error {
+	cfg, ok, err := loadWebhooksConfig()
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	for _, ep := range cfg.Endpoints {
+		if endpoints == nil && !ep.wants(kind) || endpoints != nil && !anyOf(endpoints, ep.ID) {
+			continue
+		}
+		d := &webhookDelivery{ID: newDeliveryID(), Endpoint: ep.ID, Type: kind, Status: "pending", CreatedAt: time.Now().Format(time.RFC3339), Attempts: []webhookAttempt{}}
+		d.body, err = json.Marshal(webhookPayload{ID: d.ID, Type: kind, Timestamp: d.CreatedAt, Data: data})
+		if err != nil {
+			return err
+		}
+		queueWebhook(d)
+	}
+	return nil
+}
+
+// queueWebhook logs a delivery and starts sending it
+func queueWebhook(d *webhookDelivery) {
+	webhookLog.Lock()
+	webhookLog.deliveries = append(webhookLog.deliveries, d)
+	if n := len(webhookLog.deliveries); n > webhookLogSize {
+		webhookLog.deliveries = webhookLog.deliveries[n-webhookLogSize:]
+	}
+	webhookLog.Unlock()
+	go deliverWebhook(d)
+}
+
+// deliverWebhook posts a delivery until the endpoint accepts it or the
+// attempts run out, waiting twice as long after every failure
+func deliverWebhook(d *webhookDelivery) {
+	for attempt := 0; ; attempt++ {
+		cfg, _, err := loadWebhooksConfig()
+		var ep *WebhookEndpoint
+		for i := range cfg.Endpoints {
+			if cfg.Endpoints[i].ID == d.Endpoint {
+				ep = &cfg.Endpoints[i]
+			}
+		}
+		if err != nil || ep == nil {
+			msg := "endpoint no longer configured"
+			if err != nil {
+				msg = "invalid config: " + err.Error()
+			}
+			webhookLog.Lock()
+			d.Status = "failed"
+			d.Attempts = append(d.Attempts, webhookAttempt{At: time.Now().Format(time.RFC3339), Error: msg})
+			webhookLog.Unlock()
+			return
+		}
+
+		result := postWebhook(*ep, d)
+		webhookLog.Lock()
+		d.Attempts = append(d.Attempts, result)
+		done := result.Error == ""
+		if done {
+			d.Status = "delivered"
+		} else if attempt+1 >= cfg.MaxAttempts {
+			d.Status = "failed"
+		}
+		webhookLog.Unlock()
+		if done {
+			return
+		}
+		if attempt+1 >= cfg.MaxAttempts {
+			logNotify.Error("Webhook failed", "type", d.Type, "endpoint", d.Endpoint, "attempts", attempt+1, "err", result.Error)
+			return
+		}
+		time.Sleep(time.Duration(cfg.RetryBaseSeconds) * time.Second << attempt)
+	}
+}
+
+// postWebhook makes one delivery attempt; non-2xx responses are failures
+func postWebhook(ep WebhookEndpoint, d *webhookDelivery) webhookAttempt {
+	start := time.Now()
+	attempt := webhookAttempt{At: start.Format(time.RFC3339)}
+	req, err := http.NewRequest(http.MethodPost, ep.URL, bytes.NewReader(d.body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "relplanner-webhooks")
+	req.Header.Set("X-Relplanner-Event", d.Type)
+	req.Header.Set("X-Relplanner-Delivery", d.ID)
+	if ep.Secret != "" {
+		req.Header.Set("X-Relplanner-Signature", signWebhook(ep.Secret, d.body))
+	}
+	resp, err := maintenanceHTTPClient.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		attempt.Error = fmt.Sprintf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return attempt
+}
+
+func init() {
+	registerNotificationChannel("webhook", notificationChannel{defaults: webhookEndpoints, send: sendWebhookEvent})
+}
+
+// webhookEndpoints returns the endpoints subscribed to a release event
+func webhookEndpoints(event releaseEvent) ([]string, error) {
+	cfg, ok, err := loadWebhooksConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	var ids []string
+	for _, ep := range cfg.Endpoints {
+		if ep.wants("release." + event.Type) {
+			ids = append(ids, ep.ID)
+		}
+	}
+	return ids, nil
+}
+
+// sendWebhookEvent queues a release event for endpoints
+func sendWebhookEvent(event releaseEvent, endpoints []string) error {
+	return emitWebhook("release."+event.Type, event, endpoints)
+}
+
+// webhooksOnChange is the data change hook emitting data.changed
+func webhooksOnChange(filename string) {
+	if err := emitWebhook(webhookDataChanged, map[string]string{"file": filename}, nil); err != nil {
+		logNotify.Error("Webhook failed", "type", webhookDataChanged, "err", err)
+	}
+}
+
+// Handle the webhook delivery log, newest first: GET with optional
+// endpoint, type and status filters
+func handleWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	result := []webhookDelivery{}
+	webhookLog.Lock()
+	for i := len(webhookLog.deliveries) - 1; i >= 0; i-- {
+		d := webhookLog.deliveries[i]
+		if (q.Get("endpoint") == "" || d.Endpoint == q.Get("endpoint")) &&
+			(q.Get("type") == "" || d.Type == q.Get("type")) &&
+			(q.Get("status") == "" || d.Status == q.Get("status")) {
+			copied := *d
+			copied.Attempts = append([]webhookAttempt{}, d.Attempts...)
+			result = append(result, copied)
+		}
+	}
+	webhookLog.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// Handle redelivering a logged webhook: the payload is sent again as a new
+// delivery in the log
+func handleWebhookRedeliver(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	webhookLog.Lock()
+	var found *webhookDelivery
+	for _, d := range webhookLog.deliveries {
+		if d.ID == r.PathValue("id") {
+			found = d
+		}
+	}
+	webhookLog.Unlock()
+	if found == nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	d := &webhookDelivery{ID: found.ID, Endpoint: found.Endpoint, Type: found.Type, Status: "pending",
+		CreatedAt: time.Now().Format(time.RFC3339), Attempts: []webhookAttempt{}, Redelivery: true, body: found.body}
+	resp := *d
+	queueWebhook(d)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WorkspacesConfig is workspaces-config.json: independent plans hosted by
+// the server, each with its own data directory, backups, integrations,
+// accounts and permissions
+type WorkspacesConfig struct {
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+// Workspace is a plan of its own, e.g. a department's
+type Workspace struct {
+	Name        string `json:"name"` // in /api/{name}/...
+	DisplayName string `json:"displayName,omitempty"`
+	// Dir holds its data directory and logs, workspaces/{name} by default
+	Dir string `json:"dir,omitempty"`
+}
+
+// workspaceListenEnv is set for the server of a workspace to the Unix
+// socket it serves on
+const workspaceListenEnv = "RELPLANNER_LISTEN"
+
+// workspaceSocket is the socket of a workspace server, in its directory
+const workspaceSocket = "relplanner.sock"
+
+// workspaceCookie selects the workspace the web app works on, for its
+// requests to /api/... without a workspace
+const workspaceCookie = "relplanner_workspace"
+
+var workspaceNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// workspaces are the workspaces served, by name, from workspaces-config.json
+// at startup
+var workspaces = map[string]*workspaceServer{}
+
+// workspaceServer is the server process of a workspace and the proxy to it
+type workspaceServer struct {
+	Workspace
+	proxy *httputil.ReverseProxy
+	// handler is the proxy behind the network restrictions and rate limits,
+	// which the workspace server can't apply to requests arriving proxied
+	handler http.Handler
+}
+
+// loadWorkspacesConfig reads workspaces-config.json. Names must be unique
+// and not shadow the API's own paths, such as /api/releases/.
+func loadWorkspacesConfig() (WorkspacesConfig, error) {
+	var cfg WorkspacesConfig
+	if err := readDataFile("workspaces-config.json", &cfg); err != nil {
+		return cfg, err
+	}
+	seen := map[string]bool{}
+	for i, ws := range cfg.Workspaces {
+		if !workspaceNamePattern.MatchString(ws.Name) {
+			return cfg, fmt.Errorf("invalid workspace name %q, expected lowercase letters, digits and dashes", ws.Name)
+		}
+		if seen[ws.Name] {
+			return cfg, fmt.Errorf("workspace %q is configured twice", ws.Name)
+		}
+		seen[ws.Name] = true
+		for _, route := range apiRoutes {
+			if route.path == "/api/"+ws.Name || strings.HasPrefix(route.path, "/api/"+ws.Name+"/") {
+				return cfg, fmt.Errorf("workspace name %q is taken by %s", ws.Name, route.path)
+			}
+		}
+		if ws.Dir == "" {
+			cfg.Workspaces[i].Dir = filepath.Join("workspaces", ws.Name)
+		}
+	}
+	return cfg, nil
+}
+
+// startWorkspaces starts a server for each workspace, in its directory so
+// its data, backups, configs and logs are its own, and proxies to it
+func startWorkspaces() error {
+	if os.Getenv(workspaceListenEnv) != "" {
+		return nil // a workspace's server hosts no workspaces
+	}
+	cfg, err := loadWorkspacesConfig()
+	if err != nil {
+		return err
+	}
+	for _, ws := range cfg.Workspaces {
+		if err := os.MkdirAll(ws.Dir, 0755); err != nil {
+			return err
+		}
+		socket := filepath.Join(ws.Dir, workspaceSocket)
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		server := &workspaceServer{Workspace: ws, proxy: &httputil.ReverseProxy{
+			Rewrite: func(pr *httputil.ProxyRequest) {
+				pr.Out.URL.Scheme, pr.Out.URL.Host = "http", "workspace"
+				pr.Out.Host = pr.In.Host
+				pr.SetXForwarded()
+				// The client as this server sees it, behind its own proxies,
+				// and the user only as a trusted proxy authenticated it
+				pr.Out.Header.Set("X-Forwarded-For", clientIP(pr.In))
+				if !fromTrustedProxy(pr.In) {
+					pr.Out.Header.Del("X-Remote-User")
+				}
+			},
+			Transport: transport,
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				logServer.WarnContext(r.Context(), "Workspace unavailable", "workspace", ws.Name, "err", err)
+				http.Error(w, fmt.Sprintf("Workspace %s is unavailable", ws.Name), http.StatusBadGateway)
+			},
+		}}
+		server.handler = restrictNetworks(rateLimit(server.proxy))
+		workspaces[ws.Name] = server
+		go server.run()
+	}
+	return nil
+}
+
+// run keeps the server process of a workspace running, restarting it with
+// backoff when it exits
+func (s *workspaceServer) run() {
+	executable, err := os.Executable()
+	if err != nil {
+		logServer.Error("Cannot start workspace servers", "err", err)
+		return
+	}
+	delay := time.Second
+	for {
+		cmd := exec.Command(executable)
+		cmd.Dir = s.Dir
+		cmd.Env = append(os.Environ(), workspaceListenEnv+"="+workspaceSocket)
+		started := time.Now()
+		logServer.Info("Starting workspace server", "workspace", s.Name, "dir", s.Dir)
+		err := cmd.Run()
+		logServer.Error("Workspace server stopped", "workspace", s.Name, "err", err)
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		time.Sleep(delay)
+		delay = min(delay*2, time.Minute)
+	}
+}
+
+// serverListener listens on the server's port, or on its socket when it
+// serves a workspace; such a server exits with the one that started it
+func serverListener() (net.Listener, error) {
+	socket := os.Getenv(workspaceListenEnv)
+	if socket == "" {
+		return net.Listen("tcp", fmt.Sprintf(":%d", port))
+	}
+	os.Remove(socket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	parent := os.Getppid()
+	go func() {
+		for range time.Tick(2 * time.Second) {
+			if os.Getppid() != parent {
+				logServer.Info("Workspace host stopped, stopping")
+				os.Exit(0)
+			}
+		}
+	}()
+	return listener, nil
+}
+
+// routeWorkspaces passes requests for workspaces to their servers:
+// /api/{workspace}/... as /api/..., and the web app's /api/... while its
+// workspace cookie names one. As the servers are on one host, a browser
+// keeps one session at a time across them.
+func routeWorkspaces(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(workspaces) == 0 || !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/workspaces" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+		if ws, ok := workspaces[name]; ok {
+			r2 := r.Clone(r.Context())
+			r2.URL.Path = "/api/" + rest
+			r2.URL.RawPath = ""
+			ws.handler.ServeHTTP(w, r2)
+			return
+		}
+		if c, err := r.Cookie(workspaceCookie); err == nil {
+			if ws, ok := workspaces[c.Value]; ok {
+				ws.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// workspaceInfo is a workspace in GET /api/workspaces
+type workspaceInfo struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName,omitempty"`
+	API         string `json:"api"` // prefix of its API
+}
+
+// Handle listing the workspaces, with the one the web app works on
+func handleWorkspaces(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := []workspaceInfo{}
+	for _, ws := range workspaces {
+		list = append(list, workspaceInfo{Name: ws.Name, DisplayName: ws.DisplayName, API: "/api/" + ws.Name + "/"})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	current := ""
+	if c, err := r.Cookie(workspaceCookie); err == nil && workspaces[c.Value] != nil {
+		current = c.Value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"current": current, "workspaces": list})
+}
+
+// Handle switching the web app to a workspace, /w/{workspace}, or back to
+// the server's own plan, /w/
+func handleWorkspaceSwitch(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("workspace")
+	if name == "" {
+		http.SetCookie(w, &http.Cookie{Name: workspaceCookie, Value: "", Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	if workspaces[name] == nil {
+		http.Error(w, "Unknown workspace", http.StatusNotFound)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: workspaceCookie, Value: name, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, r, "/", http.StatusFound)
+}